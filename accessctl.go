@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"pair-gui/pairserver"
+)
+
+// accessWindow 访问控制窗口，同一时间只打开一个
+var accessWindow fyne.Window
+
+// showAccessControl 打开访问控制窗口：编辑允许/屏蔽的IP或网段，并可直接屏蔽最近访问的客户端
+func showAccessControl(a fyne.App) {
+	if accessWindow != nil {
+		accessWindow.RequestFocus()
+		return
+	}
+
+	w := a.NewWindow(tr("访问控制"))
+	accessWindow = w
+	w.SetOnClosed(func() { accessWindow = nil })
+
+	allowEntry := widget.NewMultiLineEntry()
+	allowEntry.SetPlaceHolder("192.168.1.0/24\n192.168.1.10")
+	allowEntry.SetText(strings.Join(appSettings.Allowlist, "\n"))
+	blockEntry := widget.NewMultiLineEntry()
+	blockEntry.SetPlaceHolder("192.168.1.66")
+	blockEntry.SetText(strings.Join(appSettings.Blocklist, "\n"))
+
+	// 最近访问的客户端，每项带屏蔽/解除屏蔽按钮
+	var clients []pairserver.Client
+	var clientList *widget.List
+	clientList = widget.NewList(
+		func() int {
+			return len(clients)
+		},
+		func() fyne.CanvasObject {
+			return container.NewBorder(nil, nil, nil, widget.NewButton("", nil), widget.NewLabel(""))
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			if id >= len(clients) {
+				return
+			}
+			c := clients[id]
+			row := obj.(*fyne.Container)
+			row.Objects[0].(*widget.Label).SetText(fmt.Sprintf("%s  (%s)", c.IP, c.LastSeen.Format("15:04:05")))
+			btn := row.Objects[1].(*widget.Button)
+			if c.Blocked {
+				btn.SetText(tr("解除屏蔽"))
+			} else {
+				btn.SetText(tr("屏蔽"))
+			}
+			btn.OnTapped = func() {
+				rules := splitRules(blockEntry.Text)
+				if c.Blocked {
+					rules = removeRule(rules, c.IP)
+				} else {
+					rules = append(rules, c.IP)
+				}
+				blockEntry.SetText(strings.Join(rules, "\n"))
+				if applyIPRules(w, splitRules(allowEntry.Text), rules) {
+					clients = server.RecentClients()
+					clientList.Refresh()
+				}
+			}
+		},
+	)
+	refreshBtn := widget.NewButton(tr("刷新"), func() {
+		clients = server.RecentClients()
+		clientList.Refresh()
+	})
+	clients = server.RecentClients()
+
+	saveBtn := widget.NewButton(tr("保存"), func() {
+		if applyIPRules(w, splitRules(allowEntry.Text), splitRules(blockEntry.Text)) {
+			clients = server.RecentClients()
+			clientList.Refresh()
+		}
+	})
+	saveBtn.Importance = widget.HighImportance
+
+	rulesTab := container.NewBorder(nil, saveBtn, nil, nil,
+		container.NewGridWithRows(2,
+			container.NewBorder(widget.NewLabel(tr("允许列表（每行一个IP或网段，为空表示允许所有）：")), nil, nil, nil, allowEntry),
+			container.NewBorder(widget.NewLabel(tr("屏蔽列表（每行一个IP或网段）：")), nil, nil, nil, blockEntry),
+		),
+	)
+	clientsTab := container.NewBorder(nil, refreshBtn, nil, nil, clientList)
+
+	w.SetContent(container.NewAppTabs(
+		container.NewTabItem(tr("规则"), rulesTab),
+		container.NewTabItem(tr("最近访问"), clientsTab),
+	))
+	w.Resize(fyne.NewSize(480, 420))
+	w.Show()
+}
+
+// applyIPRules 校验并应用IP规则，成功后保存设置
+func applyIPRules(w fyne.Window, allow, block []string) bool {
+	if err := server.SetAllowlist(allow); err != nil {
+		dialog.ShowError(err, w)
+		return false
+	}
+	if err := server.SetBlocklist(block); err != nil {
+		dialog.ShowError(err, w)
+		return false
+	}
+	updateSettings(func(s *Settings) {
+		s.Allowlist = allow
+		s.Blocklist = block
+	})
+	return true
+}
+
+// splitRules 将多行文本拆分为规则列表，忽略空行
+func splitRules(text string) []string {
+	var rules []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			rules = append(rules, line)
+		}
+	}
+	return rules
+}
+
+// removeRule 从规则列表中移除指定规则
+func removeRule(rules []string, rule string) []string {
+	var out []string
+	for _, r := range rules {
+		if r != rule {
+			out = append(out, r)
+		}
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"pair-gui/pairserver"
+)
+
+// refreshSharedFiles 刷新分享页面的文件列表，切换语言重建界面时替换
+var refreshSharedFiles func()
+
+// apiControl 返回管理接口启动和停止服务时调用的方法，与界面上的操作一样更新托盘菜单和文件列表
+func apiControl() pairserver.APIControl {
+	return pairserver.APIControl{
+		Start: func(port int) (url string, err error) {
+			fyne.DoAndWait(func() {
+				if port == 0 {
+					port = appSettings.Port
+				}
+				url, err = startService(port)
+			})
+			return url, err
+		},
+		Stop: func() (err error) {
+			fyne.DoAndWait(func() {
+				if err = server.Stop(); err == nil {
+					serviceURL = ""
+					refreshServiceState()
+				}
+			})
+			return err
+		},
+		URL: func() (url string) {
+			fyne.DoAndWait(func() { url = serviceURL })
+			return url
+		},
+		FilesChanged: func() {
+			fyne.Do(func() {
+				if refreshSharedFiles != nil {
+					refreshSharedFiles()
+				}
+			})
+		},
+	}
+}
+
+// applyAPI 按设置启动或停止管理接口
+func applyAPI() error {
+	if !appSettings.API || appSettings.APIKey == "" {
+		server.StopAPI()
+		return nil
+	}
+	return server.StartAPI(appSettings.apiAddr(), appSettings.APIKey)
+}
+
+// makeAPIRow 创建管理接口开关及密钥显示，首次启用时生成密钥
+func makeAPIRow() fyne.CanvasObject {
+	keyLabel := widget.NewLabel(appSettings.APIKey)
+	keyLabel.TextStyle = fyne.TextStyle{Monospace: true}
+	keyLabel.Truncation = fyne.TextTruncateEllipsis
+	keyLabel.Selectable = true
+	copyBtn := widget.NewButtonWithIcon("", theme.ContentCopyIcon(), func() {
+		fyne.CurrentApp().Clipboard().SetContent(appSettings.APIKey)
+	})
+	regenBtn := widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), nil)
+	keyBox := container.NewBorder(nil, nil, nil, container.NewHBox(copyBtn, regenBtn), keyLabel)
+
+	setKey := func(key string) {
+		updateSettings(func(s *Settings) { s.APIKey = key })
+		keyLabel.SetText(key)
+		if err := applyAPI(); err != nil {
+			dialog.ShowError(fmt.Errorf(tr("启动管理接口失败: %v"), err), mainWindow)
+		}
+	}
+	regenBtn.OnTapped = func() {
+		setKey(pairserver.GenerateAPIKey())
+	}
+	apiCheck := widget.NewCheck(tr("管理接口（%s，供脚本添加文件和启停服务）", appSettings.apiAddr()), func(checked bool) {
+		updateSettings(func(s *Settings) { s.API = checked })
+		if checked {
+			keyBox.Show()
+		} else {
+			keyBox.Hide()
+		}
+		if checked && appSettings.APIKey == "" {
+			setKey(pairserver.GenerateAPIKey())
+			return
+		}
+		if err := applyAPI(); err != nil {
+			dialog.ShowError(fmt.Errorf(tr("启动管理接口失败: %v"), err), mainWindow)
+		}
+	})
+	apiCheck.Checked = appSettings.API
+	keyBox.Hidden = !appSettings.API
+	return container.NewVBox(apiCheck, keyBox)
+}
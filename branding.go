@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"pair-gui/pairserver"
+)
+
+// branding 返回设置中的网页品牌定制
+func (s Settings) branding() pairserver.Branding {
+	return pairserver.Branding{Title: s.BrandTitle, Logo: s.BrandLogo, Accent: s.BrandAccent}
+}
+
+// windowTitle 主窗口标题，设置了品牌名称时使用该名称
+func windowTitle() string {
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
+
+	if appSettings.BrandTitle != "" {
+		return appSettings.BrandTitle
+	}
+	return tr("跨平台文件传输工具")
+}
+
+// brandingWindow 网页品牌设置窗口，同一时间只打开一个
+var brandingWindow fyne.Window
+
+// showBranding 打开网页品牌设置窗口，可设置名称、Logo和主题色，
+// 名称同时作为主窗口标题
+func showBranding(a fyne.App) {
+	if brandingWindow != nil {
+		brandingWindow.RequestFocus()
+		return
+	}
+
+	w := a.NewWindow(tr("网页品牌"))
+	brandingWindow = w
+	w.SetOnClosed(func() { brandingWindow = nil })
+
+	settingsMutex.RLock()
+	s := appSettings
+	settingsMutex.RUnlock()
+
+	titleEntry := widget.NewEntry()
+	titleEntry.SetText(s.BrandTitle)
+	titleEntry.SetPlaceHolder(tr("如：三年级二班"))
+
+	accentEntry := widget.NewEntry()
+	accentEntry.SetText(s.BrandAccent)
+	accentEntry.SetPlaceHolder("#4285f4")
+
+	logoLabel := widget.NewLabel(s.BrandLogo)
+	logoLabel.Truncation = fyne.TextTruncateEllipsis
+	logo := s.BrandLogo
+	logoBtn := widget.NewButtonWithIcon("", theme.FolderOpenIcon(), func() {
+		d := dialog.NewFileOpen(func(r fyne.URIReadCloser, err error) {
+			if err != nil || r == nil {
+				return
+			}
+			r.Close()
+			logo = r.URI().Path()
+			logoLabel.SetText(logo)
+		}, w)
+		d.SetFilter(storage.NewExtensionFileFilter([]string{".png", ".jpg", ".jpeg", ".gif", ".webp"}))
+		d.Show()
+	})
+	clearLogoBtn := widget.NewButtonWithIcon("", theme.ContentClearIcon(), func() {
+		logo = ""
+		logoLabel.SetText("")
+	})
+
+	saveBtn := widget.NewButton(tr("保存"), func() {
+		b := pairserver.Branding{Title: strings.TrimSpace(titleEntry.Text), Logo: logo}
+		if text := strings.TrimSpace(accentEntry.Text); text != "" {
+			c, err := parseHexColor(text)
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			b.Accent = hexColor(c)
+		}
+		// 先在服务上验证Logo，失败时不保存
+		if err := server.SetBranding(b); err != nil {
+			dialog.ShowError(fmt.Errorf(tr("读取Logo失败: %v"), err), w)
+			return
+		}
+		updateSettings(func(s *Settings) {
+			s.BrandTitle = b.Title
+			s.BrandLogo = b.Logo
+			s.BrandAccent = b.Accent
+		})
+		mainWindow.SetTitle(windowTitle())
+		w.Close()
+	})
+	saveBtn.Importance = widget.HighImportance
+
+	form := widget.NewForm(
+		widget.NewFormItem(tr("名称"), titleEntry),
+		widget.NewFormItem("Logo", container.NewBorder(nil, nil, nil,
+			container.NewHBox(logoBtn, clearLogoBtn), logoLabel)),
+		widget.NewFormItem(tr("主题色"), accentEntry),
+	)
+	hint := widget.NewLabel(tr("名称和Logo显示在手机网页的顶部，名称同时作为网页和本窗口的标题；主题色用于网页的按钮和链接，留空使用默认的蓝色"))
+	hint.Wrapping = fyne.TextWrapWord
+	w.SetContent(container.NewBorder(nil, saveBtn, nil, nil, container.NewVBox(form, hint)))
+	w.Resize(fyne.NewSize(480, 0))
+	w.Show()
+}
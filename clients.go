@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"pair-gui/pairserver"
+)
+
+// clientRefreshInterval 刷新设备列表的间隔
+const clientRefreshInterval = 2 * time.Second
+
+var (
+	clients    []pairserver.Client // 设备列表当前显示的内容
+	clientList *widget.List        // 设备页面的列表，切换语言重建界面时替换
+	clientNone *widget.Label       // 没有设备访问时显示的提示
+)
+
+// makeClientsTab 创建“设备”页面，列出访问过服务的设备及其传输量，可命名、查看记录和屏蔽
+func makeClientsTab() *container.TabItem {
+	clientNone = widget.NewLabel(tr("还没有设备访问过服务"))
+	clientList = widget.NewList(
+		func() int {
+			return len(clients)
+		},
+		func() fyne.CanvasObject {
+			title := widget.NewLabel("")
+			title.Truncation = fyne.TextTruncateEllipsis
+			title.TextStyle = fyne.TextStyle{Bold: true}
+			detail := widget.NewLabel("")
+			detail.Truncation = fyne.TextTruncateEllipsis
+			buttons := container.NewHBox(
+				widget.NewButtonWithIcon("", theme.HistoryIcon(), nil),
+				widget.NewButtonWithIcon("", theme.DocumentCreateIcon(), nil),
+				widget.NewButton("", nil),
+			)
+			return container.NewBorder(nil, nil, nil, buttons, container.NewVBox(title, detail))
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			if id >= len(clients) {
+				return
+			}
+			c := clients[id]
+			row := obj.(*fyne.Container)
+			info := row.Objects[0].(*fyne.Container)
+			info.Objects[0].(*widget.Label).SetText(clientTitle(c))
+			info.Objects[1].(*widget.Label).SetText(clientDetail(c))
+
+			buttons := row.Objects[1].(*fyne.Container)
+			buttons.Objects[0].(*widget.Button).OnTapped = func() { showClientHistory(c) }
+			buttons.Objects[1].(*widget.Button).OnTapped = func() { renameClient(c) }
+			blockBtn := buttons.Objects[2].(*widget.Button)
+			if c.Blocked {
+				blockBtn.SetText(tr("解除屏蔽"))
+			} else {
+				blockBtn.SetText(tr("屏蔽"))
+			}
+			blockBtn.OnTapped = func() { toggleBlockClient(c) }
+		},
+	)
+	clientNone.Hidden = len(clients) > 0
+	return container.NewTabItem(tr("设备"), container.NewStack(clientList, container.NewCenter(clientNone)))
+}
+
+// clientTitle 返回设备的名称，未命名时为设备类型和IP
+func clientTitle(c pairserver.Client) string {
+	if c.Name != "" {
+		return c.Name
+	}
+	if c.Device != "" {
+		return fmt.Sprintf("%s（%s）", c.Device, c.IP)
+	}
+	return c.IP
+}
+
+// clientDetail 返回设备的IP、上传下载量和最近访问时间
+func clientDetail(c pairserver.Client) string {
+	parts := []string{c.IP}
+	if c.Name != "" && c.Device != "" {
+		parts = append(parts, c.Device)
+	}
+	parts = append(parts,
+		tr("上传 %s", formatBytes(c.Uploaded)),
+		tr("下载 %s", formatBytes(c.Downloaded)),
+		tr("最近访问 %s", c.LastSeen.Format("15:04:05")),
+	)
+	if c.Blocked {
+		parts = append(parts, tr("已屏蔽"))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// showClientHistory 显示设备最近上传和下载的文件
+func showClientHistory(c pairserver.Client) {
+	if len(c.History) == 0 {
+		dialog.ShowInformation(clientTitle(c), tr("该设备还没有传输过文件"), mainWindow)
+		return
+	}
+	lines := make([]string, 0, len(c.History))
+	for i := len(c.History) - 1; i >= 0; i-- {
+		h := c.History[i]
+		arrow := "↓"
+		if h.Direction == pairserver.TransferUpload {
+			arrow = "↑"
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s %s (%s)", h.Time.Format("15:04:05"), arrow, h.Filename, formatBytes(h.Bytes)))
+	}
+	label := widget.NewLabel(strings.Join(lines, "\n"))
+	d := dialog.NewCustom(clientTitle(c), tr("关闭"), container.NewVScroll(label), mainWindow)
+	d.Resize(fyne.NewSize(460, 360))
+	d.Show()
+}
+
+// renameClient 为设备设置名称，名称按IP保存，为空时恢复使用手机自己设置的名称
+func renameClient(c pairserver.Client) {
+	entry := widget.NewEntry()
+	entry.SetText(c.Name)
+	entry.SetPlaceHolder(tr("如：小明的手机"))
+	dialog.ShowForm(tr("设备名称"), tr("保存"), tr("取消"), []*widget.FormItem{
+		widget.NewFormItem(c.IP, entry),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+		name := strings.TrimSpace(entry.Text)
+		updateSettings(func(s *Settings) {
+			var names []string
+			for _, e := range s.ClientNames {
+				if !strings.HasPrefix(e, c.IP+"=") {
+					names = append(names, e)
+				}
+			}
+			if name != "" {
+				names = append(names, c.IP+"="+name)
+			}
+			s.ClientNames = names
+		})
+		refreshClients()
+	}, mainWindow)
+}
+
+// toggleBlockClient 屏蔽设备并中断其进行中的传输，或解除屏蔽
+func toggleBlockClient(c pairserver.Client) {
+	block := appSettings.Blocklist
+	if c.Blocked {
+		block = removeRule(block, c.IP)
+	} else {
+		block = append(append([]string(nil), block...), c.IP)
+	}
+	if !applyIPRules(mainWindow, appSettings.Allowlist, block) {
+		return
+	}
+	if !c.Blocked {
+		for _, t := range server.Transfers() {
+			if t.ClientIP == c.IP {
+				server.CancelTransfer(t.ID)
+			}
+		}
+	}
+	refreshClients()
+}
+
+// refreshClients 从服务读取设备列表并刷新设备页面
+func refreshClients() {
+	clients = server.RecentClients()
+	if clientList == nil {
+		return
+	}
+	clientList.Refresh()
+	clientNone.Hidden = len(clients) > 0
+	clientNone.Refresh()
+}
+
+// watchClients 定期刷新设备页面
+func watchClients() {
+	go func() {
+		ticker := time.NewTicker(clientRefreshInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			fyne.Do(refreshClients)
+		}
+	}()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// clipboardPollInterval 检查电脑剪贴板变化的间隔
+const clipboardPollInterval = time.Second
+
+// watchClipboard 开启剪贴板同步时定期读取电脑剪贴板，内容变化后推送给手机网页；
+// 手机端的剪贴板变化则写入电脑剪贴板
+func watchClipboard(a fyne.App) {
+	server.SetClipboardHandler(func(text string) {
+		fyne.Do(func() {
+			a.Clipboard().SetContent(text)
+		})
+	})
+
+	go func() {
+		ticker := time.NewTicker(clipboardPollInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if !server.ClipboardSync() {
+				continue
+			}
+			var text string
+			fyne.DoAndWait(func() {
+				text = a.Clipboard().Content()
+			})
+			server.SetClipboard(text)
+		}
+	}()
+}
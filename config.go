@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"pair-gui/pairserver"
+)
+
+// configFileName 配置文件名，位于用户配置目录下的pair-gui子目录
+const configFileName = "config.toml"
+
+// configDir 返回配置目录，如 ~/.config/pair-gui，自签名证书等也缓存在此目录
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pair-gui"), nil
+}
+
+// configPath 返回配置文件路径，如 ~/.config/pair-gui/config.toml
+func configPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, configFileName), nil
+}
+
+// defaultSettings 返回内置默认设置
+func defaultSettings() Settings {
+	return Settings{
+		Port:           defaultPort,
+		Theme:          defaultTheme,
+		AccessToken:    true,
+		Discovery:      true,
+		NotifyUploads:  true,
+		FTPPort:        pairserver.DefaultFTPPort,
+		APIAddr:        pairserver.DefaultAPIAddr,
+		ConflictPolicy: string(pairserver.ConflictRename),
+		LogMaxMB:       defaultLogMaxMB,
+		LogBackups:     defaultLogBackup,
+		LogLevel:       logInfo,
+		ReadHeaderTO:   int(pairserver.DefaultReadHeaderTimeout / time.Second),
+		IdleTO:         int(pairserver.DefaultIdleTimeout / time.Second),
+		StallTO:        int(pairserver.DefaultStallTimeout / time.Second),
+		QRSize:         defaultQRSize,
+		QRLevel:        "medium",
+		QRForeground:   "#000000",
+		QRBackground:   "#ffffff",
+	}
+}
+
+// errConfigUnreadable 配置文件存在但无法读取或解析时拒绝写回，以免覆盖用户手动修改的内容
+var errConfigUnreadable = errors.New("配置文件无法解析，修正或删除后才会保存设置")
+
+// configUnreadable 启动时读取的配置文件存在但无法读取或解析，本次运行中不写回配置文件
+var configUnreadable bool
+
+// loadConfigFile 读取配置文件，found表示成功读取了文件；文件不存在时返回默认设置。
+// 文件存在但无法读取或解析时返回默认设置和错误，之后saveConfigFile不再写入该文件
+func loadConfigFile() (s Settings, found bool, err error) {
+	s = defaultSettings()
+
+	path, err := configPath()
+	if err != nil {
+		return s, false, err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return s, false, nil
+	}
+	if _, err := toml.DecodeFile(path, &s); err != nil {
+		configUnreadable = true
+		return defaultSettings(), false, err
+	}
+	return s, true, nil
+}
+
+// saveConfigFile 将设置写回配置文件。配置中有密码、API密钥和同步密钥，文件只允许本人读写；
+// 先写入同目录的临时文件再替换，写到一半时崩溃不会留下损坏的配置。启动时无法解析的配置文件不会被覆盖
+func saveConfigFile(s Settings) error {
+	if configUnreadable {
+		return errConfigUnreadable
+	}
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "config-*.toml.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	err = f.Chmod(0o600)
+	if err == nil {
+		err = toml.NewEncoder(f).Encode(s)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
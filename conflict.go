@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"pair-gui/pairserver"
+)
+
+// conflictPolicies 重名处理方式及其显示名称，按下拉框中的顺序排列
+var conflictPolicies = []struct {
+	policy pairserver.ConflictPolicy
+	label  string
+}{
+	{pairserver.ConflictRename, "自动重命名"},
+	{pairserver.ConflictOverwrite, "覆盖"},
+	{pairserver.ConflictReject, "拒绝"},
+	{pairserver.ConflictAsk, "每次询问"},
+}
+
+// makeConflictSelect 创建选择重名处理方式的下拉框
+func makeConflictSelect() *widget.Select {
+	labels := make([]string, len(conflictPolicies))
+	for i, c := range conflictPolicies {
+		labels[i] = tr(c.label)
+	}
+
+	sel := widget.NewSelect(labels, nil)
+	for i, c := range conflictPolicies {
+		if string(c.policy) == appSettings.ConflictPolicy {
+			sel.SetSelectedIndex(i)
+		}
+	}
+	sel.OnChanged = func(string) {
+		policy := conflictPolicies[sel.SelectedIndex()].policy
+		updateSettings(func(s *Settings) { s.ConflictPolicy = string(policy) })
+	}
+	return sel
+}
+
+// askConflict 在主窗口中询问如何处理重名的上传文件，阻塞直到用户选择
+func askConflict(name string) pairserver.ConflictPolicy {
+	result := make(chan pairserver.ConflictPolicy, 1)
+
+	fyne.Do(func() {
+		var d dialog.Dialog
+		choose := func(policy pairserver.ConflictPolicy) func() {
+			return func() {
+				result <- policy
+				d.Hide()
+			}
+		}
+		buttons := container.NewHBox(
+			widget.NewButton(tr("自动重命名"), choose(pairserver.ConflictRename)),
+			widget.NewButton(tr("覆盖"), choose(pairserver.ConflictOverwrite)),
+			widget.NewButton(tr("拒绝"), choose(pairserver.ConflictReject)),
+		)
+		content := container.NewVBox(
+			widget.NewLabel(tr("上传目录中已存在文件“%s”，如何处理？", name)),
+			buttons,
+		)
+		d = dialog.NewCustomWithoutButtons(tr("文件重名"), content, mainWindow)
+		d.Show()
+		mainWindow.Show()
+	})
+
+	return <-result
+}
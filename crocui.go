@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"pair-gui/pairserver"
+)
+
+// crocRelay 返回设置中的croc中继，未设置时使用croc的公共中继
+func (s Settings) crocRelay() pairserver.CrocRelay {
+	relay := pairserver.DefaultCrocRelay
+	if s.CrocRelay != "" {
+		relay.Address = s.CrocRelay
+	}
+	if s.CrocPassword != "" {
+		relay.Password = s.CrocPassword
+	}
+	return relay
+}
+
+// showCrocSend 生成croc代码并通过中继发送下载列表中的文件，对方输入代码接收后显示发送进度
+func showCrocSend() {
+	files := server.Files()
+	if len(files) == 0 {
+		dialog.ShowInformation(tr("提示"), tr("请先选择需要发送的文件"), mainWindow)
+		return
+	}
+
+	code := pairserver.NewCrocCode()
+	codeLabel := widget.NewLabel(code)
+	codeLabel.TextStyle = fyne.TextStyle{Monospace: true}
+	codeLabel.Selectable = true
+	copyBtn := widget.NewButtonWithIcon("", theme.ContentCopyIcon(), func() {
+		fyne.CurrentApp().Clipboard().SetContent(code)
+	})
+	hint := widget.NewLabel(tr("在另一台电脑的pair-gui中点击“croc接收”并输入代码 %s", code))
+	hint.Wrapping = fyne.TextWrapWord
+
+	ctx, cancel := context.WithCancel(context.Background())
+	status := widget.NewLabel(tr("等待对方输入代码…"))
+	bar := widget.NewProgressBar()
+	content := container.NewVBox(container.NewBorder(nil, nil, nil, copyBtn, codeLabel), hint, status, bar,
+		widget.NewButton(tr("取消"), cancel))
+	d := dialog.NewCustomWithoutButtons(tr("croc发送"), content, mainWindow)
+	d.Resize(fyne.NewSize(460, 0))
+	d.Show()
+
+	go func() {
+		err := pairserver.CrocSend(ctx, appSettings.crocRelay(), code, files, func(sent, total int64) {
+			fyne.Do(func() {
+				status.SetText(tr("正在发送…"))
+				if total > 0 {
+					bar.SetValue(float64(sent) / float64(total))
+				}
+			})
+		})
+		cancel()
+		fyne.Do(func() {
+			d.Hide()
+			switch {
+			case errors.Is(err, context.Canceled):
+			case err != nil:
+				dialog.ShowError(fmt.Errorf(tr("发送失败: %v"), err), mainWindow)
+			default:
+				dialog.ShowInformation(tr("croc发送"), tr("已发送 %d 个文件", len(files)), mainWindow)
+			}
+		})
+	}()
+}
+
+// showCrocReceive 输入对方的croc代码，通过中继接收文件并保存到上传目录
+func showCrocReceive() {
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("1234-apple-river-stone")
+	dialog.ShowForm(tr("croc接收"), tr("接收"), tr("取消"),
+		[]*widget.FormItem{widget.NewFormItem(tr("代码"), entry)},
+		func(ok bool) {
+			if ok {
+				crocReceive(entry.Text)
+			}
+		}, mainWindow)
+}
+
+// crocReceive 用code接收文件，接收进度显示在传输页面中
+func crocReceive(code string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	content := container.NewVBox(widget.NewLabel(tr("正在接收，进度见传输页面…")), widget.NewButton(tr("取消"), cancel))
+	d := dialog.NewCustomWithoutButtons(tr("croc接收"), content, mainWindow)
+	d.Show()
+
+	go func() {
+		saved, err := server.CrocReceive(ctx, appSettings.crocRelay(), code)
+		cancel()
+		fyne.Do(func() {
+			d.Hide()
+			switch {
+			case errors.Is(err, context.Canceled):
+			case err != nil:
+				dialog.ShowError(fmt.Errorf(tr("接收失败: %v"), err), mainWindow)
+			default:
+				dialog.ShowInformation(tr("croc接收"), tr("已接收 %d 个文件", len(saved)), mainWindow)
+			}
+		})
+	}()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"pair-gui/pairserver"
+)
+
+// showMaxDownloads 为下载列表中的单个文件设置允许下载的次数，0或留空表示不限
+func showMaxDownloads(f pairserver.File, onSet func()) {
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder(tr("不限"))
+	if f.MaxDownloads > 0 {
+		entry.SetText(strconv.Itoa(f.MaxDownloads))
+	}
+	entry.Validator = func(s string) error {
+		if n, err := strconv.Atoi(s); s != "" && (err != nil || n < 0) {
+			return errors.New(tr("请输入有效的数字"))
+		}
+		return nil
+	}
+	dialog.ShowForm(tr("下载次数上限"), tr("确定"), tr("取消"),
+		[]*widget.FormItem{widget.NewFormItem(f.Filename, entry)},
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			n, _ := strconv.Atoi(entry.Text)
+			server.SetFileMaxDownloads(f.AbsPath, n)
+			onSet()
+		}, mainWindow)
+}
+
+// fileDownloadsText 返回文件列表中显示的下载次数
+func fileDownloadsText(f pairserver.File) string {
+	switch {
+	case f.Exhausted():
+		return "  " + tr("（下载次数已用完）")
+	case f.MaxDownloads > 0:
+		return "  " + tr("（已下载 %d/%d 次）", f.Downloads, f.MaxDownloads)
+	default:
+		return "  " + tr("（已下载 %d 次）", f.Downloads)
+	}
+}
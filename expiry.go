@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"pair-gui/pairserver"
+)
+
+// ttlPresets 可选的分享有效期，0表示不限
+var ttlPresets = []time.Duration{0, 15 * time.Minute, time.Hour, 24 * time.Hour}
+
+// ttlLabel 返回有效期的显示文字
+func ttlLabel(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return tr("不限")
+	case d%time.Hour == 0:
+		return tr("%d小时", int(d/time.Hour))
+	default:
+		return tr("%d分钟", int(d/time.Minute))
+	}
+}
+
+// expiryAt 返回从现在起经过有效期d后的时间，d为0时返回零值表示不过期
+func expiryAt(d time.Duration) time.Time {
+	if d <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(d)
+}
+
+// makeTTLSelect 创建有效期选择框，包含预设的有效期和“自定义…”；选择自定义时输入分钟数。
+// onChanged在有效期变化后调用
+func makeTTLSelect(current time.Duration, onChanged func(time.Duration)) *widget.Select {
+	sel := widget.NewSelect(nil, nil)
+	custom := tr("自定义…")
+	// setOptions 按当前有效期更新选项，不在预设中的有效期单独列出
+	setOptions := func() {
+		var options []string
+		found := false
+		for _, d := range ttlPresets {
+			options = append(options, ttlLabel(d))
+			found = found || d == current
+		}
+		if !found {
+			options = append(options, ttlLabel(current))
+		}
+		sel.SetOptions(append(options, custom))
+		sel.Selected = ttlLabel(current)
+		sel.Refresh()
+	}
+	setOptions()
+
+	sel.OnChanged = func(label string) {
+		if label != custom {
+			for _, d := range append(ttlPresets, current) {
+				if ttlLabel(d) == label && d != current {
+					current = d
+					onChanged(d)
+					break
+				}
+			}
+			return
+		}
+
+		entry := widget.NewEntry()
+		entry.SetPlaceHolder("90")
+		entry.Validator = func(s string) error {
+			if n, err := strconv.Atoi(s); err != nil || n <= 0 {
+				return errors.New(tr("请输入有效的数字"))
+			}
+			return nil
+		}
+		dialog.ShowForm(tr("自定义有效期"), tr("确定"), tr("取消"),
+			[]*widget.FormItem{widget.NewFormItem(tr("分钟"), entry)},
+			func(ok bool) {
+				if n, err := strconv.Atoi(entry.Text); ok && err == nil && n > 0 {
+					current = time.Duration(n) * time.Minute
+					onChanged(current)
+				}
+				setOptions()
+			}, mainWindow)
+	}
+	return sel
+}
+
+// showFileExpiry 为下载列表中的单个文件设置有效期，从现在开始计时
+func showFileExpiry(f pairserver.File, onSet func()) {
+	var ttl time.Duration
+	sel := makeTTLSelect(0, func(d time.Duration) { ttl = d })
+	dialog.ShowForm(tr("文件有效期"), tr("确定"), tr("取消"),
+		[]*widget.FormItem{widget.NewFormItem(f.Filename, sel)},
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			server.SetFileExpiry(f.AbsPath, expiryAt(ttl))
+			onSet()
+		}, mainWindow)
+}
+
+// fileExpiryText 返回文件列表中显示的过期说明，不过期时为空
+func fileExpiryText(f pairserver.File) string {
+	switch {
+	case f.Expires.IsZero():
+		return ""
+	case f.Expired():
+		return "  " + tr("（已过期）")
+	default:
+		return "  " + tr("（%s 过期）", f.Expires.Format("01-02 15:04"))
+	}
+}
+
+// watchExpiry 每秒更新label中的分享剩余时间，直到stop被关闭
+func watchExpiry(label *widget.Label, expiry time.Time, stop <-chan struct{}) {
+	update := func() {
+		if left := time.Until(expiry); left > 0 {
+			label.SetText(tr("链接将在 %s 后过期", left.Round(time.Second)))
+		} else {
+			label.SetText(tr("链接已过期"))
+		}
+	}
+	update()
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fyne.Do(update)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"pair-gui/pairserver"
+)
+
+// showFilePassword 为下载列表中的单个文件设置下载密码，留空表示取消密码；密码不保存到设置中
+func showFilePassword(f pairserver.File, onSet func()) {
+	entry := widget.NewPasswordEntry()
+	entry.SetText(f.Password)
+	entry.SetPlaceHolder(tr("留空表示不需要密码"))
+	dialog.ShowForm(tr("文件密码"), tr("确定"), tr("取消"),
+		[]*widget.FormItem{widget.NewFormItem(f.Filename, entry)},
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			server.SetFilePassword(f.AbsPath, entry.Text)
+			onSet()
+		}, mainWindow)
+}
+
+// filePasswordText 返回文件列表中显示的密码说明，没有密码时为空
+func filePasswordText(f pairserver.File) string {
+	if !f.Protected() {
+		return ""
+	}
+	return "  " + tr("（需要密码）")
+}
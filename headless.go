@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+
+	"pair-gui/pairserver"
+)
+
+// stringList 可重复指定的字符串命令行参数
+type stringList []string
+
+// String 实现flag.Value接口
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set 实现flag.Value接口
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// cliOptions 命令行参数
+type cliOptions struct {
+	Headless  bool          // 无界面模式
+	Port      int           // 服务端口
+	TLS       bool          // 启用HTTPS
+	HTTP3     bool          // 启用HTTPS时同时提供HTTP/3
+	PIN       string        // 访问PIN码
+	Basic     string        // HTTP基本认证，格式为“用户名:密码”
+	Token     bool          // 要求访问令牌
+	MDNS      bool          // 通过mDNS广播主机名
+	Internet  bool          // 请求路由器端口映射
+	Tor       bool          // 通过Tor洋葱服务分享
+	Host      string        // URL使用的主机地址
+	WebDAV    bool          // 启用WebDAV
+	FTPPort   int           // FTP服务端口，0表示不启用
+	DLNA      bool          // 作为DLNA媒体服务器
+	API       bool          // 启用管理接口
+	Webhooks  []string      // 传输完成时通知的Webhook地址
+	Exec      string        // 上传完成后执行的命令
+	Once      bool          // 每个文件都被下载一次后停止服务
+	TTL       time.Duration // 分享链接的有效期，0表示不过期
+	Limit     int           // 每个分享文件允许下载的次数，0表示不限
+	LogFile   bool          // 将请求日志和程序日志写入日志文件
+	LogLevel  string        // 日志详细程度
+	Stall     time.Duration // 下载停滞的超时，0表示不限制
+	Templates string        // 覆盖内置网页模板的目录
+	Prefix    string        // 网页的路径前缀
+	Share     []string      // 分享的文件
+	ShareDir  []string      // 共享的目录
+}
+
+// parseFlags 解析命令行参数，--share之后的其余参数也视为分享文件；
+// 端口默认值取自配置文件
+func parseFlags(args []string, cfg Settings) (cliOptions, error) {
+	var opts cliOptions
+	var share, shareDir stringList
+	webhooks := stringList(cfg.Webhooks)
+	_, _, stall := cfg.timeouts()
+
+	fs := flag.NewFlagSet("pair-gui", flag.ContinueOnError)
+	fs.BoolVar(&opts.Headless, "headless", false, "不启动图形界面，仅在终端运行HTTP服务")
+	fs.IntVar(&opts.Port, "port", cfg.Port, "HTTP服务端口")
+	fs.BoolVar(&opts.TLS, "tls", cfg.TLS, "使用自签名证书启用HTTPS")
+	fs.BoolVar(&opts.HTTP3, "http3", cfg.HTTP3, "启用HTTPS时同时在UDP同一端口提供HTTP/3（QUIC）")
+	fs.BoolVar(&opts.Token, "token", cfg.AccessToken, "URL附带一次性访问令牌，无令牌的请求返回403")
+	fs.BoolVar(&opts.MDNS, "mdns", cfg.MDNS, "通过mDNS广播 "+pairserver.DefaultMDNSName+".local，URL使用主机名代替IP")
+	fs.BoolVar(&opts.Internet, "internet", cfg.InternetSharing, "请求路由器端口映射（NAT-PMP/UPnP），输出外网访问地址，并强制要求访问令牌")
+	fs.BoolVar(&opts.Tor, "tor", cfg.Tor, "通过本机Tor发布临时洋葱服务，输出.onion地址，并强制要求访问令牌")
+	fs.StringVar(&opts.Host, "host", cfg.QRHost, "URL使用的主机地址，如Tailscale IP或MagicDNS名称，默认为局域网IP")
+	fs.BoolVar(&opts.WebDAV, "webdav", cfg.WebDAV, "通过WebDAV提供分享文件和上传目录，可挂载为网络驱动器")
+	fs.IntVar(&opts.FTPPort, "ftp", cfg.ftpPort(), "同时在该端口提供FTP服务，0表示不启用")
+	fs.BoolVar(&opts.DLNA, "dlna", cfg.DLNA, "作为DLNA媒体服务器，电视和播放器可直接浏览播放分享的媒体文件（不支持HTTPS和基本认证）")
+	fs.BoolVar(&opts.API, "api", cfg.API, "在 "+cfg.apiAddr()+" 提供管理接口，密钥取自配置文件中的api_key，为空时随机生成")
+	fs.StringVar(&opts.Exec, "exec", cfg.PostReceive, "每次上传完成后执行的shell命令，可使用{file}等占位符或PAIR_FILE等环境变量")
+	fs.DurationVar(&opts.TTL, "ttl", cfg.shareTTL(), "分享链接的有效期（如 15m、1h、24h），过期后请求返回410，0表示不过期")
+	fs.IntVar(&opts.Limit, "max-downloads", 0, "--share的每个文件允许完整下载的次数，达到后不再提供该文件，0表示不限")
+	fs.StringVar(&opts.LogLevel, "log-level", cfg.logLevel(), "日志详细程度：off、info或debug，日志输出到终端（stderr）")
+	fs.BoolVar(&opts.LogFile, "log-file", cfg.LogFile, "将请求日志和程序日志写入配置目录下的logs/pair-gui.log，按大小轮转")
+	fs.DurationVar(&opts.Stall, "stall-timeout", stall, "下载停滞超过该时间后断开连接（如 30s、5m），0表示不限制")
+	fs.StringVar(&opts.Templates, "templates", cfg.TemplateDir, "覆盖内置网页模板的目录，其中与内置模板同名的.html文件替换内置版本")
+	fs.StringVar(&opts.Prefix, "prefix", cfg.PathPrefix, "网页的路径前缀（如 /share），放在反向代理后与其他服务共用域名时使用")
+	fs.BoolVar(&opts.Once, "once", cfg.OneShot, "--share的每个文件都被完整下载过一次后自动停止服务并退出")
+	fs.StringVar(&opts.Basic, "basic-auth", basicAuthFlag(cfg), "所有请求都要求HTTP基本认证，格式为 用户名:密码")
+	fs.StringVar(&opts.PIN, "pin", cfg.PIN, "网页访问PIN码（4-6位数字），设为random时随机生成")
+	fs.Var(&share, "share", "分享给手机下载的文件，可重复指定，或在其后直接列出多个文件")
+	fs.Var(&shareDir, "share-dir", "共享给手机浏览的目录，可重复指定")
+	fs.Var(&webhooks, "webhook", "上传完成或文件被下载时以JSON POST通知该URL，可重复指定，配置文件中的地址同样生效")
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+
+	opts.Share = append(share, fs.Args()...)
+	opts.ShareDir = shareDir
+	opts.Webhooks = webhooks
+	return opts, nil
+}
+
+// runHeadless 无界面模式：启动HTTP服务并在终端打印访问地址和二维码，Ctrl+C退出
+func runHeadless(opts cliOptions) error {
+	appSettings.LogLevel = opts.LogLevel
+	if appSettings.logLevel() != opts.LogLevel {
+		return fmt.Errorf("无效的日志详细程度: %s", opts.LogLevel)
+	}
+	setLogLevel(opts.LogLevel)
+	appSettings.LogFile = opts.LogFile
+	if err := applyLogFile(appSettings); err != nil {
+		return fmt.Errorf("打开日志文件失败: %v", err)
+	}
+	logToStderr = true
+	server.SetAccessLogHandler(logRequest)
+	for _, path := range opts.Share {
+		f, err := server.AddFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		server.SetFileMaxDownloads(f.AbsPath, opts.Limit)
+	}
+	for _, path := range opts.ShareDir {
+		if _, err := server.AddDir(path); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	if opts.PIN == "random" {
+		opts.PIN = pairserver.GeneratePIN(6)
+	}
+	if err := validatePIN(opts.PIN); err != nil {
+		return err
+	}
+	server.SetPIN(opts.PIN)
+	if opts.Basic != "" {
+		user, password, ok := strings.Cut(opts.Basic, ":")
+		if !ok || password == "" {
+			return errors.New("--basic-auth 的格式应为 用户名:密码")
+		}
+		server.SetBasicAuth(user, password)
+	}
+	server.SetRequireToken(opts.Token || opts.Internet || opts.Tor)
+	if opts.MDNS {
+		server.SetMDNSName(pairserver.DefaultMDNSName)
+	}
+	appSettings.QRHost = opts.Host
+	server.SetWebDAV(opts.WebDAV)
+	if err := server.SetWebhooks(opts.Webhooks); err != nil {
+		return err
+	}
+	server.SetPostReceiveCommand(opts.Exec)
+	if opts.Once && len(server.Files()) == 0 {
+		return errors.New("--once 需要通过 --share 分享文件")
+	}
+	server.SetShareExpiry(expiryAt(opts.TTL))
+	finished := make(chan struct{})
+	server.SetOneShot(opts.Once)
+	server.SetOneShotHandler(func() { close(finished) })
+	server.SetFTPPort(opts.FTPPort)
+	if opts.DLNA {
+		server.SetDLNAName("pair-gui (" + deviceName() + ")")
+	}
+
+	fingerprint, err := prepareTLS(opts.TLS)
+	if err != nil {
+		return fmt.Errorf("配置HTTPS失败: %v", err)
+	}
+	if opts.HTTP3 && !opts.TLS {
+		return errors.New("--http3 需要同时指定 --tls")
+	}
+	server.SetHTTP3(opts.HTTP3)
+	readHeader, idle, _ := appSettings.timeouts()
+	server.SetTimeouts(readHeader, idle, opts.Stall)
+	if err := server.SetTemplateDir(opts.Templates); err != nil {
+		return fmt.Errorf("加载网页模板失败: %v", err)
+	}
+	if err := server.SetPathPrefix(opts.Prefix); err != nil {
+		return err
+	}
+	if err := server.SetBranding(appSettings.branding()); err != nil {
+		return fmt.Errorf("应用品牌设置失败: %v", err)
+	}
+	if err := server.Start(opts.Port); err != nil {
+		return fmt.Errorf("服务启动失败: %v", err)
+	}
+	if opts.API {
+		generated := appSettings.APIKey == ""
+		if generated {
+			appSettings.APIKey = pairserver.GenerateAPIKey()
+		}
+		if err := server.StartAPI(appSettings.apiAddr(), appSettings.APIKey); err != nil {
+			return fmt.Errorf("启动管理接口失败: %v", err)
+		}
+		defer server.StopAPI()
+		fmt.Printf("管理接口：http://%s/api/\n", server.APIAddr())
+		if generated {
+			fmt.Printf("管理接口密钥：%s\n", appSettings.APIKey)
+		}
+	}
+	applyDiscovery(appSettings.Discovery)
+	defer server.StopDiscovery()
+	applySync()
+	defer server.StopSync()
+
+	url := server.URL(serviceHost())
+	switch {
+	case opts.Tor:
+		onion, err := startOnion(appSettings.TorControl)
+		if err != nil {
+			return fmt.Errorf("Tor 分享失败: %v", err)
+		}
+		url = onion
+		fmt.Println("洋葱地址需要约一分钟发布到Tor网络，请用Tor Browser访问")
+	case opts.Internet:
+		public, err := mapInternet()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Internet 分享失败，仅局域网可访问: %v\n", err)
+		} else {
+			url = public
+			if m, _ := server.PortMapping(); !m.Public() {
+				fmt.Fprintf(os.Stderr, "路由器的外部地址 %s 不是公网IP，外网可能无法访问\n", m.ExternalIP)
+			}
+		}
+	}
+
+	qr, err := qrcode.New(url, qrcode.Medium)
+	if err != nil {
+		return fmt.Errorf("生成二维码失败: %v", err)
+	}
+	if count := len(server.Files()); count > 0 {
+		fmt.Printf("文件下载服务已启动，共分享 %d 个文件\n", count)
+	} else if count := len(server.Dirs()); count > 0 {
+		fmt.Printf("文件浏览服务已启动，共享 %d 个目录\n", count)
+	} else {
+		fmt.Println("文件上传服务已启动")
+	}
+	fmt.Println(url)
+	if codeURL := server.WordCodeURL(serviceHost()); codeURL != "" {
+		fmt.Printf("无法扫码时可访问：%s\n", codeURL)
+	}
+	if opts.PIN != "" {
+		fmt.Printf("访问PIN码：%s\n", opts.PIN)
+	}
+	if user, password := server.BasicAuth(); password != "" {
+		fmt.Printf("登录用户名：%s，密码：%s\n", user, password)
+	}
+	if davURL := server.WebDAVURL(serviceHost()); davURL != "" {
+		fmt.Printf("WebDAV地址：%s\n", davURL)
+	}
+	if ftpURL := server.FTPURL(serviceHost()); ftpURL != "" {
+		fmt.Printf("FTP地址：%s\n", ftpURL)
+		if _, basic := server.BasicAuth(); basic == "" && opts.PIN == "" && server.Token() != "" {
+			fmt.Printf("FTP密码：%s\n", server.Token())
+		}
+	}
+	if fingerprint != "" {
+		fmt.Printf("证书指纹（SHA-256）：%s\n", fingerprint)
+	}
+	if names := pluginNames(); len(names) > 0 {
+		fmt.Printf("已加载插件：%s\n", strings.Join(names, ", "))
+	}
+	fmt.Println(qr.ToSmallString(false))
+	if opts.Once {
+		fmt.Println("每个文件都被下载一次后自动停止服务")
+	}
+	if expiry := server.ShareExpiry(); !expiry.IsZero() {
+		fmt.Printf("链接有效期至 %s\n", expiry.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Println("按 Ctrl+C 停止服务")
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-sigCh:
+	case <-finished:
+		fmt.Println("所有文件都已被下载，服务已停止")
+		return nil
+	}
+
+	// 等待正在进行的传输完成，再次按Ctrl+C强制停止
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if active := server.ActiveTransfers(); active > 0 {
+		fmt.Printf("正在等待 %d 个传输完成，再次按 Ctrl+C 强制停止\n", active)
+		go func() {
+			<-sigCh
+			cancel()
+		}()
+	}
+	if err := server.Shutdown(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// basicAuthFlag 返回配置文件中的基本认证对应的--basic-auth默认值，未启用时为空
+func basicAuthFlag(cfg Settings) string {
+	if cfg.BasicPassword == "" {
+		return ""
+	}
+	return cfg.BasicUser + ":" + cfg.BasicPassword
+}
+
+// validatePIN 校验PIN码为空或4-6位数字
+func validatePIN(pin string) error {
+	if pin == "" {
+		return nil
+	}
+	if len(pin) < 4 || len(pin) > 6 {
+		return fmt.Errorf("PIN码必须为4-6位数字")
+	}
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("PIN码必须为4-6位数字")
+		}
+	}
+	return nil
+}
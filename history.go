@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"pair-gui/pairserver"
+)
+
+// 传输记录数据库的文件名，与配置文件保存在同一目录；早期版本的记录文件在首次打开数据库时导入
+const (
+	historyFileName   = "history.db"
+	legacyHistoryName = "history.jsonl"
+)
+
+var (
+	history      []pairserver.HistoryEntry // 历史页面当前显示的记录
+	historyQuery string                    // 历史页面的搜索关键字
+	historyList  *widget.List              // 历史页面的列表，切换语言重建界面时替换
+	historyNone  *widget.Label             // 没有记录时显示的提示
+)
+
+// openHistory 打开配置目录中的传输记录，之后完成的上传和下载都会记入其中
+func openHistory() {
+	dir, err := configDir()
+	if err != nil {
+		log.Printf("获取配置目录失败: %v", err)
+		return
+	}
+	h, err := pairserver.OpenHistory(filepath.Join(dir, historyFileName))
+	if err != nil {
+		log.Printf("打开传输记录失败: %v", err)
+		return
+	}
+	importLegacyHistory(h, filepath.Join(dir, legacyHistoryName))
+	server.SetHistory(h)
+}
+
+// importLegacyHistory 将早期版本的记录文件（及其轮转的.1文件）导入数据库，导入后改名，不再重复导入
+func importLegacyHistory(h *pairserver.History, path string) {
+	for _, p := range []string{path + ".1", path} {
+		f, err := os.Open(p)
+		if err != nil {
+			continue
+		}
+		n, err := h.ImportJSONLines(f)
+		f.Close()
+		if err != nil {
+			log.Printf("导入传输记录 %s 失败: %v", p, err)
+			return
+		}
+		os.Rename(p, p+".imported")
+		log.Printf("已导入 %d 条传输记录: %s", n, p)
+	}
+}
+
+// makeHistoryTab 创建“历史”页面，列出以往的上传和下载，可搜索，并可打开、在文件夹中显示或重新分享其中的文件；
+// onShare在重新分享文件后调用，用于刷新分享列表
+func makeHistoryTab(onShare func()) *container.TabItem {
+	search := widget.NewEntry()
+	search.SetPlaceHolder(tr("搜索文件名或设备"))
+	search.SetText(historyQuery)
+	search.OnChanged = func(text string) {
+		historyQuery = text
+		refreshHistory()
+	}
+
+	historyNone = widget.NewLabel(tr("暂无传输记录"))
+	historyList = widget.NewList(
+		func() int {
+			return len(history)
+		},
+		func() fyne.CanvasObject {
+			name := widget.NewLabel("")
+			name.Truncation = fyne.TextTruncateEllipsis
+			name.TextStyle = fyne.TextStyle{Bold: true}
+			detail := widget.NewLabel("")
+			detail.Truncation = fyne.TextTruncateEllipsis
+			return container.NewBorder(nil, nil, nil,
+				container.NewHBox(
+					widget.NewButtonWithIcon(tr("打开"), theme.FileIcon(), nil),
+					widget.NewButtonWithIcon(tr("所在文件夹"), theme.FolderOpenIcon(), nil),
+					widget.NewButtonWithIcon(tr("重新分享"), theme.MailForwardIcon(), nil)),
+				container.NewVBox(name, detail))
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			if id >= len(history) {
+				return
+			}
+			e := history[id]
+			row := obj.(*fyne.Container)
+			info := row.Objects[0].(*fyne.Container)
+			info.Objects[0].(*widget.Label).SetText(historyTitle(e))
+			info.Objects[1].(*widget.Label).SetText(historyDetail(e))
+
+			btns := row.Objects[1].(*fyne.Container).Objects
+			btns[0].(*widget.Button).OnTapped = func() { showOpenError(openPath(e.Path)) }
+			btns[1].(*widget.Button).OnTapped = func() { showOpenError(revealPath(e.Path)) }
+			btns[2].(*widget.Button).OnTapped = func() { reshare(e, onShare) }
+			// 文件已被移动或删除时不能打开或重新分享
+			_, err := os.Stat(e.Path)
+			for _, btn := range btns {
+				if e.Path == "" || err != nil {
+					btn.(*widget.Button).Disable()
+				} else {
+					btn.(*widget.Button).Enable()
+				}
+			}
+		},
+	)
+	refreshHistory()
+	exportBtns := container.NewHBox(
+		widget.NewButtonWithIcon(tr("导出CSV"), theme.DocumentSaveIcon(), func() { exportHistory("csv") }),
+		widget.NewButtonWithIcon(tr("导出JSON"), theme.DocumentSaveIcon(), func() { exportHistory("json") }),
+	)
+	return container.NewTabItem(tr("历史"), container.NewBorder(
+		container.NewBorder(nil, nil, nil, exportBtns, search), nil, nil, nil,
+		container.NewStack(historyList, container.NewCenter(historyNone))))
+}
+
+// historyTitle 返回记录的方向和文件名
+func historyTitle(e pairserver.HistoryEntry) string {
+	return transferTitle(pairserver.Transfer{Direction: e.Direction, Filename: e.Filename})
+}
+
+// historyDetail 返回记录的时间、设备、大小、耗时和结果
+func historyDetail(e pairserver.HistoryEntry) string {
+	peer := e.ClientIP
+	if e.ClientName != "" {
+		peer = e.ClientName + "（" + e.ClientIP + "）"
+	}
+	parts := []string{
+		e.Time.Local().Format("2006-01-02 15:04"),
+		peer,
+		formatBytes(e.Size),
+		e.Duration.Round(time.Second).String(),
+	}
+	switch e.Result {
+	case pairserver.HistoryFailed:
+		parts = append(parts, tr("失败"))
+	case pairserver.HistoryCanceled:
+		parts = append(parts, tr("已取消"))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// showOpenError 显示打开文件失败的原因
+func showOpenError(err error) {
+	if err != nil {
+		dialog.ShowError(fmt.Errorf(tr("打开失败: %v"), err), mainWindow)
+	}
+}
+
+// reshare 将记录中的文件重新加入分享列表并切换到分享页面
+func reshare(e pairserver.HistoryEntry, onShare func()) {
+	f, err := newDownloadFile(e.Path)
+	if err != nil {
+		dialog.ShowError(err, mainWindow)
+		return
+	}
+	server.AddFiles(f)
+	onShare()
+	mainTabs.SelectIndex(0)
+}
+
+// exportHistory 将全部传输记录导出为CSV或JSON文件，format为csv或json
+func exportHistory(format string) {
+	h := server.History()
+	n := 0
+	if h != nil {
+		n, _ = h.Count()
+	}
+	if n == 0 {
+		dialog.ShowInformation(tr("导出记录"), tr("暂无传输记录"), mainWindow)
+		return
+	}
+	d := dialog.NewFileSave(func(w fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, mainWindow)
+			return
+		}
+		if w == nil {
+			return
+		}
+		var count int
+		if format == "csv" {
+			count, err = h.WriteCSV(w)
+		} else {
+			count, err = h.WriteJSON(w)
+		}
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			dialog.ShowError(fmt.Errorf(tr("导出失败: %v"), err), mainWindow)
+			return
+		}
+		dialog.ShowInformation(tr("导出记录"), tr("已导出 %d 条记录到 %s", count, w.URI().Path()), mainWindow)
+	}, mainWindow)
+	d.SetFileName("pair-gui-history." + format)
+	d.Show()
+}
+
+// refreshHistory 按搜索关键字重新读取传输记录并刷新历史页面
+func refreshHistory() {
+	history = nil
+	if h := server.History(); h != nil {
+		history = h.Search(historyQuery)
+	}
+	if historyList == nil {
+		return
+	}
+	historyList.Refresh()
+	historyNone.Hidden = len(history) > 0
+	historyNone.Refresh()
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/lang"
+)
+
+// 界面语言选项
+const (
+	langAuto = ""   // 跟随系统
+	langZh   = "zh" // 中文
+	langEn   = "en" // English
+)
+
+// 当前界面语言
+var (
+	currentLang      = langZh
+	currentLangMutex sync.RWMutex
+)
+
+// guiMessages 界面字符串表，以中文原文为键，中文直接使用原文
+var guiMessages = map[string]map[string]string{
+	langEn: {
+		"跨平台文件传输工具":       "Cross-Platform File Transfer",
+		"设置":              "Settings",
+		"主题":              "Theme",
+		"浅色":              "Light",
+		"深色":              "Dark",
+		"跟随系统":            "Follow System",
+		"语言":              "Language",
+		"输入端口号（如1082）":    "Enter port (e.g. 1082)",
+		"请输入有效的数字端口":      "Please enter a valid numeric port",
+		"更改":              "Change",
+		"未选择任何文件":         "No files selected",
+		"清空列表":            "Clear List",
+		"确定移除全部 %d 个文件吗？": "Remove all %d files?",
+		"选择需要下载的文件":       "Select Files to Share",
+		"从文件夹中多选文件":       "Select Files from Folder",
+		"启动服务":            "Start Service",
+		"端口格式错误: %v":      "Invalid port: %v",
+		"服务启动失败: %v":      "Failed to start service: %v",
+		"停止服务":            "Stop Service",
+		"停止服务失败: %v":      "Failed to stop service: %v",
+		"成功":              "Success",
+		"服务已停止":           "Service stopped",
+		"提示":              "Notice",
+		"当前无运行中的服务":       "No service is running",
+		"端口设置：":           "Port:",
+		"上传文件保存目录：":       "Upload directory:",
+		"文件选择：":           "Files:",
+		"已选择 %d 个文件：":     "%d files selected:",
+		"获取文件路径失败: %v":    "Failed to resolve file path: %v",
+		"文件不存在: %v":       "File not found: %v",
+		"请选择文件而非目录":       "Please select a file, not a directory",
+		"本次已选择 %d 个文件：\n%s\n是否继续添加？": "%d files selected so far:\n%s\nAdd more?",
+		"继续添加":       "Add More",
+		"读取目录失败: %v": "Failed to read directory: %v",
+		"该目录下没有文件":   "This folder contains no files",
+		"全选":         "Select All",
+		"选择文件":       "Select Files",
+		"添加":         "Add",
+		"取消":         "Cancel",
+		"添加完成":       "Files Added",
+		"已添加 %d 个文件（跳过 %d 个重复文件）": "Added %d files (skipped %d duplicates)",
+		"生成二维码失败: %v":             "Failed to generate QR code: %v",
+		"文件下载服务已启动":               "Download Service Started",
+		"下载列表地址：%s\n扫码直接进入下载页面":   "Download list: %s\nScan to open the download page",
+		"文件上传服务已启动":               "Upload Service Started",
+		"上传页面地址：%s\n扫码直接进入上传页面":   "Upload page: %s\nScan to open the upload page",
+		"关闭":     "Close",
+		"等待传输完成": "Wait for Transfers",
+		"强制停止":   "Force Stop",
+		"当前有 %d 个传输正在进行，立即停止会中断这些传输。": "%d transfers are in progress. Stopping now will interrupt them.",
+		"正在等待传输完成…":          "Waiting for transfers to finish…",
+		"显示主窗口":              "Show Window",
+		"服务未启动":              "Service not running",
+		"退出":                 "Quit",
+		"启用HTTPS（自签名证书）":     "Enable HTTPS (self-signed certificate)",
+		"证书指纹（SHA-256）：\n%s": "Certificate fingerprint (SHA-256):\n%s",
+		"启用PIN码保护":           "Require PIN",
+		"访问PIN码：%s":          "Access PIN: %s",
+		"二维码附带访问令牌（仅扫码可访问）": "Add access token to QR code (scan-only access)",
+		"访问控制":  "Access Control",
+		"访问控制…": "Access Control…",
+		"解除屏蔽":  "Unblock",
+		"屏蔽":    "Block",
+		"刷新":    "Refresh",
+		"保存":    "Save",
+		"允许列表（每行一个IP或网段，为空表示允许所有）：": "Allowlist (one IP or subnet per line, empty allows all):",
+		"屏蔽列表（每行一个IP或网段）：":          "Blocklist (one IP or subnet per line):",
+		"规则":    "Rules",
+		"最近访问":  "Recent Clients",
+		"同名文件：": "Existing files:",
+		"自动重命名": "Rename",
+		"覆盖":    "Overwrite",
+		"拒绝":    "Reject",
+		"每次询问":  "Ask each time",
+		"文件重名":  "File Already Exists",
+		"上传目录中已存在文件“%s”，如何处理？":    "\"%s\" already exists in the upload folder. What should be done?",
+		"上传大小限制（MB，0为不限）：":        "Max upload size (MB, 0 = unlimited):",
+		"请输入有效的数字":                "Please enter a valid number",
+		"共享文件夹":                   "Share Folder",
+		"取消共享":                    "Unshare All",
+		"共享文件夹失败: %v":             "Failed to share folder: %v",
+		"未共享文件夹":                  "No shared folders",
+		"文件浏览服务已启动":               "Browse Service Started",
+		"浏览页面地址：%s\n扫码直接进入共享文件夹":  "Browse page: %s\nScan to open the shared folders",
+		"发送文本":                    "Send Text",
+		"发送":                      "Send",
+		"输入要发送到手机的文本，如链接、Wi-Fi密码": "Type text to send to the phone, e.g. a link or a Wi-Fi password",
+		"收到文本":                    "Text Received",
+		"复制":                      "Copy",
+		"与手机同步剪贴板":                "Sync clipboard with the phone",
+		"二维码使用主机名 %s.local（mDNS）": "Use hostname %s.local in the QR code (mDNS)",
+		"Internet 分享（路由器端口映射，强制访问令牌）":               "Internet sharing (router port mapping, access token required)",
+		"通过Tor洋葱服务分享（需本机运行Tor，强制访问令牌）":              "Share via a Tor onion service (requires Tor running locally, access token required)",
+		"无法通过Tor分享（需运行Tor或Tor Browser），二维码仅在局域网内可用": "Could not share via Tor (Tor or Tor Browser must be running); the QR code only works on the LAN",
+		"洋葱地址需要约一分钟发布到Tor网络，请用Tor Browser扫码访问":      "The onion address takes about a minute to publish on the Tor network; open it with Tor Browser",
+		"二维码地址：":    "QR code address:",
+		"局域网IP（自动）": "LAN IP (automatic)",
+		"%s（未连接）":   "%s (not connected)",
+		"WebDAV（在文件管理器中挂载为网络驱动器）": "WebDAV (mount as a network drive in the file manager)",
+		"WebDAV地址：%s":   "WebDAV address: %s",
+		"用户名任意，密码为PIN码": "Any user name; the password is the PIN",
+		"FTP服务（端口 %d，供电视等只支持FTP的设备使用）": "FTP server (port %d, for TVs and other devices that only speak FTP)",
+		"FTP地址：%s":    "FTP address: %s",
+		"用户名任意，密码：%s": "Any user name; password: %s",
+		"DLNA媒体服务器（电视可直接播放分享的视频和音乐，无需PIN码；启用HTTPS或基本认证时不可用）": "DLNA media server (TVs can play shared videos and music directly, no PIN; unavailable with HTTPS or Basic Auth)",
+		"%s（默认）":        "%s (default)",
+		"%s（%s，VPN）":    "%s (%s, VPN)",
+		"分享":            "Share",
+		"传输":            "Transfers",
+		"传输 (%d)":       "Transfers (%d)",
+		"暂无进行中的传输":      "No transfers in progress",
+		"（未知文件）":        "(unknown file)",
+		"剩余 %s":         "%s left",
+		"取消传输":          "Cancel Transfer",
+		"确定取消 %s 的传输吗？": "Cancel the transfer of %s?",
+		"传输已结束":         "The transfer has already finished",
+		"接收上传前询问（可信任设备后自动接收）": "Ask before accepting uploads (trusted devices are accepted automatically)",
+		"信任该设备，本次服务期间自动接收":    "Trust this device and accept its uploads until the service stops",
+		"大小未知":           "unknown size",
+		"%s 想发送 %s（%s）":  "%s wants to send %s (%s)",
+		"设备":             "Devices",
+		"还没有设备访问过服务":     "No device has accessed the service yet",
+		"上传 %s":          "Uploaded %s",
+		"下载 %s":          "Downloaded %s",
+		"最近访问 %s":        "Last seen %s",
+		"已屏蔽":            "Blocked",
+		"该设备还没有传输过文件":    "This device has not transferred any files yet",
+		"如：小明的手机":        "e.g. Alex's phone",
+		"设备名称":           "Device Name",
+		"历史":             "History",
+		"搜索文件名或设备":       "Search by file name or device",
+		"暂无传输记录":         "No transfer history",
+		"重新分享":           "Share Again",
+		"失败":             "Failed",
+		"已取消":            "Canceled",
+		"导出CSV":          "Export CSV",
+		"导出JSON":         "Export JSON",
+		"导出记录":           "Export History",
+		"导出失败: %v":       "Export failed: %v",
+		"已导出 %d 条记录到 %s": "Exported %d records to %s",
+		"管理接口（%s，供脚本添加文件和启停服务）": "Management API (%s, lets scripts add files and start/stop the server)",
+		"启动管理接口失败: %v":          "Failed to start the management API: %v",
+		"Webhook…":              "Webhooks…",
+		"Webhook地址（每行一个，上传完成或文件被下载时发送JSON POST）：": "Webhook URLs (one per line, each receives a JSON POST when an upload completes or a file is downloaded):",
+		"接收后执行：": "Run after receiving:",
+		"如 mv {file} ~/Pictures，也可使用环境变量 PAIR_FILE": "e.g. mv {file} ~/Pictures; PAIR_FILE and other variables are also set",
+		"收到文件时弹出系统通知":                               "Show a system notification when a file is received",
+		"收到文件":                                      "File Received",
+		"收到 %s，%s 来自 %s":                            "Received %s, %s from %s",
+		"收到 %s 等 %d 个文件，共 %s":                       "Received %s and others, %d files, %s in total",
+		"打开接收文件夹":                                   "Open Receive Folder",
+		"提示音：":                                      "Sounds:",
+		"开始下载":                                      "Download started",
+		"传输失败":                                      "Transfer failed",
+		"所在文件夹":                                     "Show in Folder",
+		"打开失败: %v":                                  "Failed to open: %v",
+		"每个文件都被下载一次后自动停止服务":                         "Stop the service once every file has been downloaded",
+		"所有文件都已被下载，服务已自动停止":                         "Every file has been downloaded; the service was stopped",
+		"分享已结束":                                     "Sharing Finished",
+		"不限":                                        "Unlimited",
+		"%d小时":                                      "%d h",
+		"%d分钟":                                      "%d min",
+		"自定义…":                                      "Custom…",
+		"自定义有效期":                                    "Custom Expiry",
+		"确定":                                        "OK",
+		"分钟":                                        "Minutes",
+		"文件有效期":                                     "File Expiry",
+		"（已过期）":                                     "(expired)",
+		"（%s 过期）":                                   "(expires %s)",
+		"链接将在 %s 后过期":                               "The link expires in %s",
+		"链接已过期":                                     "The link has expired",
+		"链接有效期：":                                    "Link expiry:",
+		"文件密码":                                      "File Password",
+		"留空表示不需要密码":                                 "Leave empty for no password",
+		"（需要密码）":                                    " (password required)",
+		"下载次数上限":                                    "Download Limit",
+		"（下载次数已用完）":                                 " (download limit reached)",
+		"（已下载 %d/%d 次）":                             " (downloaded %d/%d times)",
+		"（已下载 %d 次）":                                " (downloaded %d times)",
+		"下载链接":                                      "Download Link",
+		"请先启动服务":                                    "Start the service first",
+		"生成":                                        "Create",
+		"有效期":                                       "Valid for",
+		"链接已复制到剪贴板，无需PIN码即可下载 %s": "Link copied to the clipboard; it downloads %s without the PIN",
+		"用户名":            "Username",
+		"密码，留空表示不启用":     "Password, leave empty to disable",
+		"HTTP基本认证：":      "HTTP Basic Auth:",
+		"用户名：%s，密码：%s":   "Username: %s, password: %s",
+		"登录用户名：%s　密码：%s": "Login username: %s   Password: %s",
+		"暂无日志":           "No log entries yet",
+		"过滤，如IP、路径或状态码":  "Filter, e.g. IP, path or status code",
+		"日志":             "Log",
+		"清空":             "Clear",
+		"同时写入日志文件":       "Also write to a log file",
+		"调试":             "Debug",
+		"信息":             "Info",
+		"详细程度：":          "Verbosity:",
+		"点击“启动服务”后在此显示二维码": "Click \"Start Service\" to show the QR code here",
+		"复制地址":         "Copy URL",
+		"在浏览器中打开":      "Open in Browser",
+		"保存二维码":        "Save QR Code",
+		"保存二维码失败: %v":  "Failed to save QR code: %v",
+		"二维码已保存到 %s":   "QR code saved to %s",
+		"二维码样式…":       "QR Code Style…",
+		"二维码样式":        "QR Code Style",
+		"大小（像素）":       "Size (pixels)",
+		"纠错级别":         "Error correction",
+		"低（7%）":        "Low (7%)",
+		"中（15%）":       "Medium (15%)",
+		"高（25%）":       "High (25%)",
+		"最高（30%）":      "Highest (30%)",
+		"前景色":          "Foreground",
+		"背景色":          "Background",
+		"中央Logo":       "Center logo",
+		"无效的颜色: %s":    "Invalid color: %s",
+		"读取Logo失败: %v": "Failed to read logo: %v",
+		"二维码大小应在 %d 到 %d 像素之间":                     "QR code size must be between %d and %d pixels",
+		"嵌入Logo时纠错级别至少为“高”；前景色应明显深于背景色，否则部分手机无法识别": "With a logo the error correction is at least \"High\"; keep the foreground clearly darker than the background or some phones cannot scan it",
+		"配对码：%s\n无法扫码时可在浏览器中输入 %s":                 "Pairing code: %s\nIf you cannot scan, open %s in a browser",
+		"同时提供HTTP/3（QUIC，需启用HTTPS，UDP同一端口）":        "Also serve HTTP/3 (QUIC, requires HTTPS, same UDP port)",
+		"正在接收":          "Receiving",
+		"未同步文件夹":        "No folder sync",
+		"正在与 %s 同步：%s":  "Syncing with %s: %s",
+		"选择":            "Choose",
+		"双方设置相同的密钥":     "Use the same key on both devices",
+		"与 %s 同步文件夹":    "Sync Folder with %s",
+		"开始同步":          "Start Sync",
+		"本地文件夹":         "Local folder",
+		"同步密钥":          "Sync key",
+		"请选择文件夹并设置同步密钥": "Please choose a folder and set a sync key",
+		"同步":            "Sync",
+		"停止同步":          "Stop Sync",
+		"网页品牌…":         "Web Page Branding…",
+		"网页品牌":          "Web Page Branding",
+		"如：三年级二班":       "e.g. Room 101",
+		"名称":            "Name",
+		"主题色":           "Accent color",
+		"名称和Logo显示在手机网页的顶部，名称同时作为网页和本窗口的标题；主题色用于网页的按钮和链接，留空使用默认的蓝色": "The name and logo appear at the top of the web pages, and the name is also used as the page and window title. The accent color is used for buttons and links on the web pages; leave it empty for the default blue.",
+		"外网分享": "Internet Sharing",
+		"路由器端口映射失败（需开启UPnP或NAT-PMP），二维码仅在局域网内可用":     "Router port mapping failed (UPnP or NAT-PMP must be enabled); the QR code only works on the LAN",
+		"路由器的外部地址 %s 不是公网IP（可能处于运营商级NAT之后），外网可能无法访问": "The router's external address %s is not a public IP (possibly behind carrier-grade NAT); the service may not be reachable from the Internet",
+		"附近设备…":     "Nearby Devices…",
+		"附近设备":      "Nearby Devices",
+		"未发现其他设备":   "No other devices found",
+		"打开":        "Open",
+		"未启动服务":     "Not sharing",
+		"正在共享 %d 项": "Sharing %d items",
+		"在局域网中发现其他设备并显示本机": "Discover other devices on the LAN and show this one",
+		"本机名称：%s":                  "This device: %s",
+		"发送文件":                     "Send Files",
+		"请先选择需要发送的文件":              "Select the files to send first",
+		"等待 %s 确认接收…":              "Waiting for %s to accept…",
+		"正在发送到 %s…":                "Sending to %s…",
+		"%s 拒绝接收":                  "%s declined the files",
+		"发送失败: %v":                 "Send failed: %v",
+		"已发送 %d 个文件到 %s":           "Sent %d files to %s",
+		"%s（%s）想发送 %d 个文件（%d KB）：": "%s (%s) wants to send you %d files (%d KB):",
+		"接收文件":                     "Receive Files",
+		"接收":                       "Accept",
+		"croc发送":                   "croc Send",
+		"croc接收":                   "croc Receive",
+		"在另一台电脑的pair-gui中点击“croc接收”并输入代码 %s": "On the other computer, click \"croc Receive\" in pair-gui and enter the code %s",
+		"wormhole发送": "wormhole Send",
+		"wormhole接收": "wormhole Receive",
+		"正在获取代码…":    "Getting a code…",
+		"对方运行 wormhole receive %s，或在pair-gui中点击“wormhole接收”并输入该代码": "The other side runs wormhole receive %s, or clicks \"wormhole Receive\" in pair-gui and enters the code",
+		"等待对方输入代码…":     "Waiting for the other side to enter the code…",
+		"正在发送…":         "Sending…",
+		"已发送 %d 个文件":    "Sent %d files",
+		"代码":            "Code",
+		"正在接收，进度见传输页面…": "Receiving, see the Transfers tab for progress…",
+		"接收失败: %v":      "Receive failed: %v",
+		"已接收 %d 个文件":    "Received %d files",
+		"重新生成":          "Regenerate",
+		"同步密钥至少需要%d个字符，请使用随机生成的密钥":           "The sync key needs at least %d characters; use a randomly generated key",
+		"读取配置文件失败，使用默认设置，本次运行中修改的设置不会保存: %v": "Failed to read the config file; using defaults, and changes made in this session will not be saved: %v",
+	},
+}
+
+// tr 翻译界面字符串，有参数时按格式化字符串处理，缺少译文时使用中文原文
+func tr(key string, args ...any) string {
+	currentLangMutex.RLock()
+	l := currentLang
+	currentLangMutex.RUnlock()
+
+	text := key
+	if msgs, ok := guiMessages[l]; ok {
+		if t, ok := msgs[key]; ok {
+			text = t
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// detectLanguage 根据系统区域设置选择界面语言
+func detectLanguage() string {
+	if strings.HasPrefix(strings.ToLower(lang.SystemLocale().LanguageString()), "zh") {
+		return langZh
+	}
+	return langEn
+}
+
+// setLanguage 设置界面语言，langAuto表示跟随系统
+func setLanguage(l string) {
+	if l == langAuto {
+		l = detectLanguage()
+	}
+
+	currentLangMutex.Lock()
+	defer currentLangMutex.Unlock()
+	currentLang = l
+}
+
+// makeLanguageMenu 创建语言切换菜单，选择后保存设置并调用onChange刷新界面
+func makeLanguageMenu(onChange func()) *fyne.MenuItem {
+	options := []struct {
+		name  string
+		label string
+	}{
+		{langAuto, tr("跟随系统")},
+		{langZh, "中文"},
+		{langEn, "English"},
+	}
+
+	items := make([]*fyne.MenuItem, len(options))
+	for i, opt := range options {
+		items[i] = fyne.NewMenuItem(opt.label, func() {
+			setLanguage(opt.name)
+			updateSettings(func(s *Settings) { s.Language = opt.name })
+			onChange()
+		})
+		items[i].Checked = opt.name == appSettings.Language
+	}
+
+	langItem := fyne.NewMenuItem(tr("语言"), nil)
+	langItem.ChildMenu = fyne.NewMenu("", items...)
+	return langItem
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 日志文件
+const (
+	logDirName       = "logs"         // 日志文件所在的目录，位于配置目录下
+	logFileName      = "pair-gui.log" // 当前写入的日志文件，轮转后依次为 pair-gui.log.1、pair-gui.log.2…
+	defaultLogMaxMB  = 10             // 单个日志文件的默认大小上限(MB)
+	defaultLogBackup = 5              // 默认保留的旧日志文件数
+)
+
+// logFile 当前写入的日志文件，未启用时file为nil
+var logFile struct {
+	mu     sync.Mutex
+	file   *os.File
+	path   string
+	size   int64
+	maxLen int64 // 超过该大小时轮转
+	keep   int   // 保留的旧日志文件数
+}
+
+// logDir 返回日志文件所在的目录，如 ~/.config/pair-gui/logs
+func logDir() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, logDirName), nil
+}
+
+// applyLogFile 按设置打开或关闭日志文件
+func applyLogFile(s Settings) error {
+	logFile.mu.Lock()
+	defer logFile.mu.Unlock()
+
+	logFile.maxLen = int64(s.logMaxMB()) * 1024 * 1024
+	logFile.keep = s.logBackups()
+	if !s.LogFile {
+		closeLogFileLocked()
+		return nil
+	}
+	if logFile.file != nil {
+		return nil
+	}
+
+	dir, err := logDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	logFile.path = filepath.Join(dir, logFileName)
+	return openLogFileLocked()
+}
+
+// openLogFileLocked 以追加方式打开日志文件，调用时须持有logFile.mu
+func openLogFileLocked() error {
+	f, err := os.OpenFile(logFile.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	logFile.file = f
+	logFile.size = info.Size()
+	return nil
+}
+
+// closeLogFileLocked 关闭日志文件，调用时须持有logFile.mu
+func closeLogFileLocked() {
+	if logFile.file != nil {
+		logFile.file.Close()
+		logFile.file = nil
+	}
+}
+
+// writeLogFile 将一行日志写入日志文件，文件超过大小上限时先轮转；未启用时忽略
+func writeLogFile(t time.Time, text string) {
+	logFile.mu.Lock()
+	defer logFile.mu.Unlock()
+
+	if logFile.file == nil {
+		return
+	}
+	line := t.Format("2006-01-02 15:04:05") + "  " + text + "\n"
+	if logFile.size > 0 && logFile.size+int64(len(line)) > logFile.maxLen {
+		if err := rotateLogFileLocked(); err != nil {
+			fmt.Fprintf(os.Stderr, "轮转日志文件失败: %v\n", err)
+			return
+		}
+	}
+	n, _ := logFile.file.WriteString(line)
+	logFile.size += int64(n)
+}
+
+// rotateLogFileLocked 将 pair-gui.log.N 依次改名为 N+1，超出保留数的旧文件删除，
+// 再将当前文件改名为 pair-gui.log.1 并重新打开，调用时须持有logFile.mu
+func rotateLogFileLocked() error {
+	closeLogFileLocked()
+	os.Remove(fmt.Sprintf("%s.%d", logFile.path, logFile.keep))
+	for i := logFile.keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", logFile.path, i), fmt.Sprintf("%s.%d", logFile.path, i+1))
+	}
+	if logFile.keep > 0 {
+		if err := os.Rename(logFile.path, logFile.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(logFile.path); err != nil {
+		return err
+	}
+	return openLogFileLocked()
+}
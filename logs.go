@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"pair-gui/pairserver"
+)
+
+// 日志页面
+const (
+	maxLogLines        = 1000                   // 日志页面保留的最多行数
+	logRefreshInterval = 500 * time.Millisecond // 有新日志时刷新列表的间隔
+)
+
+// 日志详细程度，同时作用于日志页面、日志文件和无界面模式的终端输出
+const (
+	logOff   = "off"   // 不记录日志
+	logInfo  = "info"  // 记录程序日志和请求，忽略轮询进度、缩略图和上传分块等频繁的请求
+	logDebug = "debug" // 记录全部请求，并附带耗时和User-Agent
+)
+
+// logLevels 可选的日志详细程度
+var logLevels = []string{logOff, logInfo, logDebug}
+
+// verbosePaths 仅在调试级别记录的频繁请求
+var verbosePaths = map[string]bool{
+	"/progress":  true,
+	"/thumb":     true,
+	"/checksum":  true,
+	"/clipboard": true,
+	"/text":      true,
+	"/ws":        true,
+}
+
+var (
+	currentLogLevel atomic.Value // 当前的日志详细程度，日志可能在持有设置锁时写入，因此不读取appSettings
+	logToStderr     bool         // 无界面模式下同时输出到终端
+)
+
+// appLog 请求日志和程序日志，按时间顺序保存最近的maxLogLines行
+var appLog struct {
+	mu    sync.Mutex
+	lines []string
+	dirty bool // 有尚未显示的新日志
+}
+
+var (
+	logFilter string        // 日志页面的过滤条件，只显示包含该文字的行
+	logShown  []string      // 日志页面当前显示的行
+	logList   *widget.List  // 日志页面的列表，切换语言重建界面时替换
+	logNone   *widget.Label // 没有日志时显示的提示
+)
+
+// setLogLevel 设置日志详细程度
+func setLogLevel(level string) {
+	currentLogLevel.Store(level)
+}
+
+// logEnabled 返回当前的详细程度是否记录该级别的日志
+func logEnabled(level string) bool {
+	current, _ := currentLogLevel.Load().(string)
+	switch current {
+	case logOff:
+		return false
+	case logDebug:
+		return true
+	default:
+		return level == logInfo
+	}
+}
+
+// logLevelLabel 返回日志详细程度的显示文字
+func logLevelLabel(level string) string {
+	switch level {
+	case logOff:
+		return tr("不记录")
+	case logDebug:
+		return tr("调试")
+	default:
+		return tr("信息")
+	}
+}
+
+// appendLog 添加一行日志，超出行数时丢弃最早的日志；日志已关闭时忽略
+func appendLog(t time.Time, text string) {
+	if !logEnabled(logInfo) {
+		return
+	}
+	writeLogFile(t, text)
+	if logToStderr {
+		fmt.Fprintln(os.Stderr, t.Format("2006-01-02 15:04:05")+"  "+text)
+	}
+
+	appLog.mu.Lock()
+	defer appLog.mu.Unlock()
+
+	appLog.lines = append(appLog.lines, t.Format("15:04:05")+"  "+text)
+	if n := len(appLog.lines) - maxLogLines; n > 0 {
+		appLog.lines = append([]string(nil), appLog.lines[n:]...)
+	}
+	appLog.dirty = true
+}
+
+// logWriter 将log包的输出逐行写入日志页面
+type logWriter struct{}
+
+// Write 实现io.Writer接口，log包每次调用写入一条完整的日志
+func (logWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		appendLog(time.Now(), line)
+	}
+	return len(p), nil
+}
+
+// logRequest 按日志详细程度记录一条请求，调试级别附带耗时和User-Agent
+func logRequest(e pairserver.AccessLogEntry) {
+	level := logInfo
+	path, _, _ := strings.Cut(e.Path, "?")
+	if verbosePaths[path] || e.Method == http.MethodHead || e.Method == http.MethodOptions ||
+		(e.Method == http.MethodPatch && strings.HasPrefix(path, "/files/")) {
+		level = logDebug
+	}
+	if !logEnabled(level) {
+		return
+	}
+
+	text := fmt.Sprintf("%-15s %-7s %s %d %s", e.ClientIP, e.Method, e.Path, e.Status, formatBytes(e.Bytes))
+	if logEnabled(logDebug) {
+		text += fmt.Sprintf(" %s %q", e.Duration.Round(time.Millisecond), e.UserAgent)
+	}
+	appendLog(e.Time, text)
+}
+
+// makeLogTab 创建“日志”页面，显示请求日志和程序日志，可过滤和复制
+func makeLogTab() *container.TabItem {
+	logNone = widget.NewLabel(tr("暂无日志"))
+	logList = widget.NewList(
+		func() int {
+			return len(logShown)
+		},
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.TextStyle = fyne.TextStyle{Monospace: true}
+			label.Truncation = fyne.TextTruncateEllipsis
+			return label
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			if id < len(logShown) {
+				obj.(*widget.Label).SetText(logShown[id])
+			}
+		},
+	)
+
+	filterEntry := widget.NewEntry()
+	filterEntry.SetPlaceHolder(tr("过滤，如IP、路径或状态码"))
+	filterEntry.SetText(logFilter)
+	filterEntry.OnChanged = func(text string) {
+		logFilter = text
+		refreshLogs()
+	}
+	copyBtn := widget.NewButtonWithIcon(tr("复制"), theme.ContentCopyIcon(), func() {
+		fyne.CurrentApp().Clipboard().SetContent(strings.Join(logShown, "\n"))
+	})
+	clearBtn := widget.NewButtonWithIcon(tr("清空"), theme.ContentClearIcon(), func() {
+		appLog.mu.Lock()
+		appLog.lines = nil
+		appLog.mu.Unlock()
+		refreshLogs()
+	})
+	refreshLogs()
+
+	// 写入日志文件，文件夹按钮打开日志目录
+	fileCheck := widget.NewCheck(tr("同时写入日志文件"), func(checked bool) {
+		updateSettings(func(s *Settings) { s.LogFile = checked })
+	})
+	fileCheck.SetChecked(appSettings.LogFile)
+	folderBtn := widget.NewButtonWithIcon("", theme.FolderOpenIcon(), func() {
+		dir, err := logDir()
+		if err == nil {
+			if err = os.MkdirAll(dir, 0o755); err == nil {
+				err = openPath(dir)
+			}
+		}
+		if err != nil {
+			dialog.ShowError(err, mainWindow)
+		}
+	})
+
+	// 详细程度
+	labels := make([]string, len(logLevels))
+	for i, level := range logLevels {
+		labels[i] = logLevelLabel(level)
+	}
+	levelSelect := widget.NewSelect(labels, nil)
+	levelSelect.SetSelected(logLevelLabel(appSettings.logLevel()))
+	levelSelect.OnChanged = func(string) {
+		level := logLevels[levelSelect.SelectedIndex()]
+		updateSettings(func(s *Settings) { s.LogLevel = level })
+	}
+
+	return container.NewTabItem(tr("日志"), container.NewBorder(
+		container.NewBorder(nil, nil, nil, container.NewHBox(copyBtn, clearBtn), filterEntry),
+		container.NewHBox(widget.NewLabel(tr("详细程度：")), levelSelect, fileCheck, folderBtn),
+		nil, nil,
+		container.NewStack(logList, container.NewCenter(logNone)),
+	))
+}
+
+// refreshLogs 按过滤条件更新日志页面，显示最新的日志
+func refreshLogs() {
+	appLog.mu.Lock()
+	lines := appLog.lines
+	appLog.dirty = false
+	appLog.mu.Unlock()
+
+	logShown = logShown[:0]
+	filter := strings.ToLower(strings.TrimSpace(logFilter))
+	for _, line := range lines {
+		if filter == "" || strings.Contains(strings.ToLower(line), filter) {
+			logShown = append(logShown, line)
+		}
+	}
+	if logList == nil {
+		return
+	}
+	logNone.Hidden = len(logShown) > 0
+	logNone.Refresh()
+	logList.Refresh()
+	logList.ScrollToBottom()
+}
+
+// watchLogs 将程序日志和请求日志写入日志页面，并定时显示新的日志
+func watchLogs() {
+	server.SetAccessLogHandler(logRequest)
+	go func() {
+		ticker := time.NewTicker(logRefreshInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			appLog.mu.Lock()
+			dirty := appLog.dirty
+			appLog.mu.Unlock()
+			if dirty {
+				fyne.Do(refreshLogs)
+			}
+		}
+	}()
+}
@@ -1,789 +1,952 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"html/template"
-	"io"
 	"log"
-	"net"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
-	"sync/atomic"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
-	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
-	"github.com/jackpal/gateway"
-	"github.com/skip2/go-qrcode"
-)
-
-// UploadProgress 上传进度结构体
-type UploadProgress struct {
-	TotalSize int64
-	Uploaded  int64
-}
 
-// DownloadFile 下载文件信息结构体
-type DownloadFile struct {
-	Filename string // 文件名
-	AbsPath  string // 绝对路径
-	SizeKB   int64  // 文件大小(KB)
-}
+	"pair-gui/pairserver"
+)
 
 // 全局变量
 var (
-	progressMap      = make(map[string]*UploadProgress) // 上传进度映射
-	downloadFiles    []DownloadFile                     // 待下载文件列表
-	httpServer       *http.Server                       // HTTP服务实例
-	mainWindow       fyne.Window                        // 主窗口
-	routesRegistered bool                               // 路由是否已注册
-	routesMutex      sync.Mutex                         // 路由注册互斥锁
+	server          = pairserver.New() // 文件传输服务
+	serviceURL      string             // 当前服务的访问地址
+	certFingerprint string             // 当前HTTPS证书指纹，未启用HTTPS时为空
+	mainWindow      fyne.Window        // 主窗口
+	appPrefs        fyne.Preferences   // 偏好设置存储
+	appSettings     Settings           // 当前应用设置
+	settingsMutex   sync.RWMutex       // 应用设置读写锁
 )
 
 func main() {
-        log.SetOutput(io.Discard)
-	// 1. 初始化：只注册一次路由
-	registerRoutesOnce()
+	// 程序日志按详细程度显示在日志页面中，或写入日志文件；日志页面自带时间
+	setLogLevel(logInfo)
+	log.SetOutput(logWriter{})
+	log.SetFlags(0)
+
+	// 读取配置文件，作为命令行参数和偏好设置的默认值
+	cfg, cfgFound, cfgErr := loadConfigFile()
+	if cfgErr != nil {
+		fmt.Fprintf(os.Stderr, "读取配置文件失败，使用默认设置，本次运行中不会写回配置文件: %v\n", cfgErr)
+	}
+
+	opts, err := parseFlags(os.Args[1:], cfg)
+	if err != nil {
+		os.Exit(2)
+	}
+	openHistory()
+
+	// 无界面模式：不创建Fyne窗口，直接使用配置文件中的设置
+	if opts.Headless {
+		appSettings = cfg
+		applyServerSettings()
+		if err := runHeadless(opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	// 创建Fyne应用并强制设置为浅色模式（核心修改）
-	myApp := app.New()
-	myApp.Settings().SetTheme(theme.LightTheme()) // 切换为LightMode
+	// 创建Fyne应用并读取上次保存的设置
+	myApp := app.NewWithID("io.github.cjacker.pair-gui")
+	appPrefs = myApp.Preferences()
+	appSettings = loadSettings(appPrefs, cfg, cfgFound)
+	if !cfgFound && cfgErr == nil {
+		// 第一次运行或从旧版本升级：将偏好设置中的值迁移到配置文件
+		saveSettings(appPrefs, appSettings)
+	}
+	applyTheme(myApp, appSettings.Theme)
+	setLanguage(appSettings.Language)
+	applyServerSettings()
+	server.SetConflictHandler(askConflict)
+	server.SetTextHandler(showReceivedText)
+	server.SetPushHandler(askPush)
+	server.SetUploadApprover(askUpload)
+	server.SetAPIControl(apiControl())
+	server.SetOneShotHandler(oneShotFinished)
+	watchClipboard(myApp)
+	watchTransfers()
+	watchClients()
+	watchLogs()
+	watchEvents(myApp)
+	applyDiscovery(appSettings.Discovery)
+	applySync()
+
+	// 恢复上次分享的文件（已不存在的文件自动忽略）
+	for _, path := range appSettings.SharedFiles {
+		server.AddFile(path)
+	}
+	for _, path := range appSettings.SharedDirs {
+		server.AddDir(path)
+	}
 
 	// 创建主窗口
-	mainWindow = myApp.NewWindow("跨平台文件传输工具")
+	mainWindow = myApp.NewWindow(windowTitle())
 	mainWindow.Resize(fyne.NewSize(600, 500))
 
 	// 2. 创建UI组件
+	buildMainUI(myApp)
+	setupTray(myApp)
+	if err := applyAPI(); err != nil {
+		log.Printf("启动管理接口失败: %v", err)
+	}
+	if cfgErr != nil {
+		dialog.ShowError(fmt.Errorf(tr("读取配置文件失败，使用默认设置，本次运行中修改的设置不会保存: %v"), cfgErr), mainWindow)
+	}
+
+	// 运行应用
+	mainWindow.ShowAndRun()
+}
+
+// buildMainUI 创建主窗口的菜单和界面组件，切换语言时重新调用以刷新全部文字
+func buildMainUI(myApp fyne.App) {
+	mainWindow.SetTitle(windowTitle())
+	mainWindow.SetMainMenu(fyne.NewMainMenu(
+		fyne.NewMenu(tr("设置"),
+			makeThemeMenu(myApp),
+			makeLanguageMenu(func() { buildMainUI(myApp) }),
+			fyne.NewMenuItemSeparator(),
+			fyne.NewMenuItem(tr("访问控制…"), func() { showAccessControl(myApp) }),
+			fyne.NewMenuItem(tr("附近设备…"), func() { showNearbyDevices(myApp) }),
+			fyne.NewMenuItem(tr("Webhook…"), func() { showWebhooks(myApp) }),
+			fyne.NewMenuItem(tr("二维码样式…"), func() { showQRStyle(myApp) }),
+			fyne.NewMenuItem(tr("网页品牌…"), func() { showBranding(myApp) }),
+		),
+	))
+
 	// 端口输入框
 	portEntry := widget.NewEntry()
-	portEntry.SetText("1082")
-	portEntry.PlaceHolder = "输入端口号（如1082）"
+	portEntry.SetText(appSettings.portString())
+	portEntry.PlaceHolder = tr("输入端口号（如1082）")
 	portEntry.Validator = func(s string) error {
 		_, err := strconv.Atoi(s)
 		if err != nil {
-			return fmt.Errorf("请输入有效的数字端口")
+			return errors.New(tr("请输入有效的数字端口"))
 		}
 		return nil
 	}
+	portEntry.OnChanged = func(text string) {
+		if port, err := strconv.Atoi(text); err == nil {
+			updateSettings(func(s *Settings) { s.Port = port })
+		}
+	}
 
-	// 已选文件展示标签
-	fileLabel := widget.NewLabel("未选择任何文件")
-	fileLabel.Wrapping = fyne.TextWrapWord
-
-	// 选择文件按钮
-	selectFilesBtn := widget.NewButton("选择需要下载的文件", func() {
-		dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
-			if err != nil || reader == nil {
+	// 上传目录选择
+	uploadDirLabel := widget.NewLabel(appSettings.uploadDirOrDefault())
+	uploadDirLabel.Truncation = fyne.TextTruncateEllipsis
+	uploadDirBtn := widget.NewButtonWithIcon(tr("更改"), theme.FolderOpenIcon(), func() {
+		dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+			if err != nil || dir == nil {
 				return
 			}
-			defer reader.Close()
+			updateSettings(func(s *Settings) { s.UploadDir = dir.Path() })
+			uploadDirLabel.SetText(dir.Path())
+		}, mainWindow)
+	})
 
-			// 支持多选文件（Fyne默认单文件，可多次选择添加）
-			filePath := reader.URI().Path()
-			absPath, err := filepath.Abs(filePath)
-			if err != nil {
-				dialog.ShowError(fmt.Errorf("获取文件路径失败: %v", err), mainWindow)
-				return
-			}
+	// 上传大小限制
+	maxUploadEntry := widget.NewEntry()
+	maxUploadEntry.SetText(strconv.Itoa(appSettings.MaxUploadMB))
+	maxUploadEntry.Validator = func(s string) error {
+		if n, err := strconv.Atoi(s); err != nil || n < 0 {
+			return errors.New(tr("请输入有效的数字"))
+		}
+		return nil
+	}
+	maxUploadEntry.OnChanged = func(text string) {
+		if n, err := strconv.Atoi(text); err == nil && n >= 0 {
+			updateSettings(func(s *Settings) { s.MaxUploadMB = n })
+		}
+	}
+
+	// 接收后命令
+	postReceiveEntry := widget.NewEntry()
+	postReceiveEntry.SetText(appSettings.PostReceive)
+	postReceiveEntry.PlaceHolder = tr("如 mv {file} ~/Pictures，也可使用环境变量 PAIR_FILE")
+	postReceiveEntry.OnChanged = func(text string) {
+		updateSettings(func(s *Settings) { s.PostReceive = text })
+	}
+
+	// HTTP基本认证，密码为空表示不启用
+	basicUserEntry := widget.NewEntry()
+	basicUserEntry.SetText(appSettings.BasicUser)
+	basicUserEntry.PlaceHolder = tr("用户名")
+	basicUserEntry.OnChanged = func(text string) {
+		updateSettings(func(s *Settings) { s.BasicUser = text })
+	}
+	basicPasswordEntry := widget.NewPasswordEntry()
+	basicPasswordEntry.SetText(appSettings.BasicPassword)
+	basicPasswordEntry.PlaceHolder = tr("密码，留空表示不启用")
+	basicPasswordEntry.OnChanged = func(text string) {
+		updateSettings(func(s *Settings) { s.BasicPassword = text })
+	}
+
+	// HTTPS开关
+	tlsCheck := widget.NewCheck(tr("启用HTTPS（自签名证书）"), func(checked bool) {
+		updateSettings(func(s *Settings) { s.TLS = checked })
+	})
+	tlsCheck.SetChecked(appSettings.TLS)
+
+	// HTTP/3开关，仅在启用HTTPS时生效
+	http3Check := widget.NewCheck(tr("同时提供HTTP/3（QUIC，需启用HTTPS，UDP同一端口）"), func(checked bool) {
+		updateSettings(func(s *Settings) { s.HTTP3 = checked })
+	})
+	http3Check.SetChecked(appSettings.HTTP3)
+
+	// 剪贴板同步开关
+	clipboardCheck := widget.NewCheck(tr("与手机同步剪贴板"), func(checked bool) {
+		updateSettings(func(s *Settings) { s.ClipboardSync = checked })
+	})
+	clipboardCheck.SetChecked(appSettings.ClipboardSync)
+
+	// 接收上传前确认
+	confirmUploadsCheck := widget.NewCheck(tr("接收上传前询问（可信任设备后自动接收）"), func(checked bool) {
+		updateSettings(func(s *Settings) { s.ConfirmUploads = checked })
+	})
+	confirmUploadsCheck.SetChecked(appSettings.ConfirmUploads)
 
-			// 验证文件
-			fileInfo, err := os.Stat(absPath)
-			if err != nil {
-				dialog.ShowError(fmt.Errorf("文件不存在: %v", err), mainWindow)
+	// 一次性分享
+	oneShotCheck := widget.NewCheck(tr("每个文件都被下载一次后自动停止服务"), func(checked bool) {
+		updateSettings(func(s *Settings) { s.OneShot = checked })
+	})
+	oneShotCheck.SetChecked(appSettings.OneShot)
+
+	// 收到文件时通知
+	notifyCheck := widget.NewCheck(tr("收到文件时弹出系统通知"), func(checked bool) {
+		updateSettings(func(s *Settings) { s.NotifyUploads = checked })
+	})
+	notifyCheck.SetChecked(appSettings.NotifyUploads)
+
+	// 提示音开关
+	soundUploadCheck := widget.NewCheck(tr("收到文件"), func(checked bool) {
+		updateSettings(func(s *Settings) { s.SoundUpload = checked })
+	})
+	soundUploadCheck.SetChecked(appSettings.SoundUpload)
+	soundDownloadCheck := widget.NewCheck(tr("开始下载"), func(checked bool) {
+		updateSettings(func(s *Settings) { s.SoundDownload = checked })
+	})
+	soundDownloadCheck.SetChecked(appSettings.SoundDownload)
+	soundErrorCheck := widget.NewCheck(tr("传输失败"), func(checked bool) {
+		updateSettings(func(s *Settings) { s.SoundError = checked })
+	})
+	soundErrorCheck.SetChecked(appSettings.SoundError)
+
+	// mDNS主机名广播
+	mdnsCheck := widget.NewCheck(tr("二维码使用主机名 %s.local（mDNS）", pairserver.DefaultMDNSName), func(checked bool) {
+		updateSettings(func(s *Settings) { s.MDNS = checked })
+	})
+	mdnsCheck.SetChecked(appSettings.MDNS)
+
+	// Internet分享：启动服务时请求路由器端口映射
+	internetCheck := widget.NewCheck(tr("Internet 分享（路由器端口映射，强制访问令牌）"), func(checked bool) {
+		updateSettings(func(s *Settings) { s.InternetSharing = checked })
+	})
+	internetCheck.SetChecked(appSettings.InternetSharing)
+
+	// Tor分享：启动服务时创建临时洋葱服务，优先于Internet分享
+	torCheck := widget.NewCheck(tr("通过Tor洋葱服务分享（需本机运行Tor，强制访问令牌）"), func(checked bool) {
+		updateSettings(func(s *Settings) { s.Tor = checked })
+	})
+	torCheck.SetChecked(appSettings.Tor)
+
+	// WebDAV开关
+	webdavCheck := widget.NewCheck(tr("WebDAV（在文件管理器中挂载为网络驱动器）"), func(checked bool) {
+		updateSettings(func(s *Settings) { s.WebDAV = checked })
+	})
+	webdavCheck.SetChecked(appSettings.WebDAV)
+
+	// DLNA媒体服务器开关
+	dlnaCheck := widget.NewCheck(tr("DLNA媒体服务器（电视可直接播放分享的视频和音乐，无需PIN码；启用HTTPS或基本认证时不可用）"), func(checked bool) {
+		updateSettings(func(s *Settings) { s.DLNA = checked })
+	})
+	dlnaCheck.SetChecked(appSettings.DLNA)
+
+	// FTP服务开关
+	ftpCheck := widget.NewCheck(tr("FTP服务（端口 %d，供电视等只支持FTP的设备使用）", appSettings.ftpPort()), nil)
+	ftpCheck.SetChecked(appSettings.FTP)
+	ftpCheck.OnChanged = func(checked bool) {
+		updateSettings(func(s *Settings) { s.FTP = checked })
+		ftpCheck.SetText(tr("FTP服务（端口 %d，供电视等只支持FTP的设备使用）", appSettings.ftpPort()))
+	}
+
+	// 访问令牌开关
+	tokenCheck := widget.NewCheck(tr("二维码附带访问令牌（仅扫码可访问）"), func(checked bool) {
+		updateSettings(func(s *Settings) { s.AccessToken = checked })
+	})
+	tokenCheck.SetChecked(appSettings.AccessToken)
+
+	// PIN码保护
+	pinLabel := widget.NewLabel("")
+	pinLabel.TextStyle = fyne.TextStyle{Bold: true, Monospace: true}
+	regenPINBtn := widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), func() {
+		pin := pairserver.GeneratePIN(6)
+		updateSettings(func(s *Settings) { s.PIN = pin })
+		pinLabel.SetText(pin)
+	})
+	pinCheck := widget.NewCheck(tr("启用PIN码保护"), func(checked bool) {
+		pin := ""
+		if checked {
+			pin = pairserver.GeneratePIN(6)
+			regenPINBtn.Show()
+		} else {
+			regenPINBtn.Hide()
+		}
+		updateSettings(func(s *Settings) { s.PIN = pin })
+		pinLabel.SetText(pin)
+	})
+	pinLabel.SetText(appSettings.PIN)
+	pinCheck.Checked = appSettings.PIN != ""
+	if !pinCheck.Checked {
+		regenPINBtn.Hide()
+	}
+
+	// 已选文件列表（每项带删除按钮）
+	fileCountLabel := widget.NewLabel(tr("未选择任何文件"))
+	var fileList *widget.List
+	fileList = widget.NewList(
+		func() int {
+			return len(server.Files())
+		},
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.Truncation = fyne.TextTruncateEllipsis
+			return container.NewBorder(nil, nil, nil,
+				container.NewHBox(
+					widget.NewButtonWithIcon("", theme.ContentCopyIcon(), nil),
+					widget.NewButtonWithIcon("", theme.DownloadIcon(), nil),
+					widget.NewButtonWithIcon("", theme.VisibilityOffIcon(), nil),
+					widget.NewButtonWithIcon("", theme.HistoryIcon(), nil),
+					widget.NewButtonWithIcon("", theme.DeleteIcon(), nil)),
+				label)
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			files := server.Files()
+			if id >= len(files) {
 				return
 			}
-			if fileInfo.IsDir() {
-				dialog.ShowError(fmt.Errorf("请选择文件而非目录"), mainWindow)
-				return
+			f := files[id]
+			row := obj.(*fyne.Container)
+			label := row.Objects[0].(*widget.Label)
+			label.SetText(fmt.Sprintf("%d. %s (%d KB)", id+1, f.Filename, f.SizeKB) + fileDownloadsText(f) + filePasswordText(f) + fileExpiryText(f))
+			btns := row.Objects[1].(*fyne.Container).Objects
+			btns[0].(*widget.Button).OnTapped = func() { showSignedLink(f) }
+			btns[1].(*widget.Button).OnTapped = func() {
+				showMaxDownloads(f, func() { fileList.Refresh() })
 			}
+			btns[2].(*widget.Button).OnTapped = func() {
+				showFilePassword(f, func() { fileList.Refresh() })
+			}
+			btns[3].(*widget.Button).OnTapped = func() {
+				showFileExpiry(f, func() { fileList.Refresh() })
+			}
+			delBtn := btns[4].(*widget.Button)
+			delBtn.OnTapped = func() {
+				server.RemoveFile(f.AbsPath)
+				refreshFileList(fileList, fileCountLabel)
+			}
+		},
+	)
 
-			// 计算文件大小(KB)
-			sizeKB := fileInfo.Size() / 1024
-			if fileInfo.Size()%1024 != 0 {
-				sizeKB += 1
+	refreshFileList(fileList, fileCountLabel)
+	refreshSharedFiles = func() { refreshFileList(fileList, fileCountLabel) }
+
+	// 清空列表按钮
+	clearFilesBtn := widget.NewButtonWithIcon(tr("清空列表"), theme.ContentClearIcon(), func() {
+		count := len(server.Files())
+		if count == 0 {
+			return
+		}
+		dialog.ShowConfirm(tr("清空列表"), tr("确定移除全部 %d 个文件吗？", count), func(ok bool) {
+			if !ok {
+				return
 			}
+			server.ClearFiles()
+			refreshFileList(fileList, fileCountLabel)
+		}, mainWindow)
+	})
 
-			// 添加到下载文件列表
-			downloadFiles = append(downloadFiles, DownloadFile{
-				Filename: filepath.Base(absPath),
-				AbsPath:  absPath,
-				SizeKB:   sizeKB,
-			})
+	// 选择文件按钮（逐个选择，每次选择后询问是否继续添加）
+	selectFilesBtn := widget.NewButton(tr("选择需要下载的文件"), func() {
+		pickFilesLoop(nil, func(files []pairserver.File) {
+			refreshFileList(fileList, fileCountLabel)
+		})
+	})
 
-			// 更新文件展示标签
-			fileLabel.SetText(fmt.Sprintf("已选择文件：\n%s", getSelectedFilesText()))
+	// 从目录中多选文件按钮
+	selectFromDirBtn := widget.NewButton(tr("从文件夹中多选文件"), func() {
+		pickFilesFromDir(func(files []pairserver.File) {
+			refreshFileList(fileList, fileCountLabel)
+		})
+	})
+
+	// 共享文件夹：手机端可逐级浏览并下载其中的文件
+	dirsLabel := widget.NewLabel("")
+	dirsLabel.Wrapping = fyne.TextWrapWord
+	refreshSharedDirs(dirsLabel)
+	shareDirBtn := widget.NewButtonWithIcon(tr("共享文件夹"), theme.FolderIcon(), func() {
+		dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+			if err != nil || dir == nil {
+				return
+			}
+			if _, err := server.AddDir(dir.Path()); err != nil {
+				dialog.ShowError(fmt.Errorf(tr("共享文件夹失败: %v"), err), mainWindow)
+				return
+			}
+			refreshSharedDirs(dirsLabel)
 		}, mainWindow)
 	})
+	clearDirsBtn := widget.NewButtonWithIcon(tr("取消共享"), theme.ContentClearIcon(), func() {
+		server.ClearDirs()
+		refreshSharedDirs(dirsLabel)
+	})
 
 	// 启动服务按钮
-	startBtn := widget.NewButton("启动服务", func() {
+	startBtn := widget.NewButton(tr("启动服务"), func() {
 		// 验证端口
-		portStr := portEntry.Text
-		port, err := strconv.Atoi(portStr)
+		port, err := strconv.Atoi(portEntry.Text)
 		if err != nil {
-			dialog.ShowError(fmt.Errorf("端口格式错误: %v", err), mainWindow)
+			dialog.ShowError(fmt.Errorf(tr("端口格式错误: %v"), err), mainWindow)
 			return
 		}
 
-		// 停止已有服务
-		if httpServer != nil {
-			if err := httpServer.Close(); err != nil {
-				log.Printf("停止原有服务失败: %v", err)
-			}
-			httpServer = nil
-		}
-
-		// 获取本机IP
-		localIP, err := getLocalIP()
-		if err != nil {
-			localIP = "localhost"
-			log.Printf("获取本机IP失败: %v", err)
+		// 二维码显示在主窗口右侧
+		if _, err := startService(port); err != nil {
+			dialog.ShowError(fmt.Errorf(tr("服务启动失败: %v"), err), mainWindow)
+			return
 		}
-
-		// 仅创建并启动HTTP服务
-		addr := fmt.Sprintf(":%d", port)
-		httpServer = &http.Server{Addr: addr}
-
-		go func() {
-			log.Printf("服务启动成功: http://%s:%d", localIP, port)
-			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				dialog.ShowError(fmt.Errorf("服务启动失败: %v", err), mainWindow)
-			}
-		}()
-
-		// 核心修改：动态生成不同页面的URL
-		var qrURL string
-		if len(downloadFiles) > 0 {
-			// 有下载文件：生成下载列表页面URL
-			qrURL = fmt.Sprintf("http://%s:%d/download-page", localIP, port)
-			log.Printf("生成下载列表页面二维码: %s", qrURL)
-		} else {
-			// 无下载文件：生成上传页面URL
-			qrURL = fmt.Sprintf("http://%s:%d", localIP, port)
-			log.Printf("生成上传页面二维码: %s", qrURL)
+		if msg := internetWarning(); msg != "" {
+			dialog.ShowInformation(tr("外网分享"), msg, mainWindow)
 		}
-		// 展示二维码
-		showQRCodeDialog(qrURL)
 	})
 
 	// 停止服务按钮
-	stopBtn := widget.NewButton("停止服务", func() {
-		if httpServer != nil {
-			if err := httpServer.Close(); err != nil {
-				dialog.ShowError(fmt.Errorf("停止服务失败: %v", err), mainWindow)
-				return
-			}
-			httpServer = nil
-			dialog.ShowInformation("成功", "服务已停止", mainWindow)
-		} else {
-			dialog.ShowInformation("提示", "当前无运行中的服务", mainWindow)
-		}
-	})
+	stopBtn := widget.NewButton(tr("停止服务"), requestStopService)
 
-	// 3. 组装UI布局
-	topContainer := container.NewVBox(
-		widget.NewLabel("端口设置："),
+	// 发送文本按钮
+	sendTextBtn := widget.NewButtonWithIcon(tr("发送文本"), theme.MailSendIcon(), showSendText)
+
+	// 不在同一网络时通过croc或magic-wormhole中继收发文件
+	crocSendBtn := widget.NewButtonWithIcon(tr("croc发送"), theme.UploadIcon(), showCrocSend)
+	crocReceiveBtn := widget.NewButtonWithIcon(tr("croc接收"), theme.DownloadIcon(), showCrocReceive)
+	wormholeSendBtn := widget.NewButtonWithIcon(tr("wormhole发送"), theme.UploadIcon(), showWormholeSend)
+	wormholeReceiveBtn := widget.NewButtonWithIcon(tr("wormhole接收"), theme.DownloadIcon(), showWormholeReceive)
+
+	// 3. 组装UI布局：设置项较多，放在单独的可滚动页面中，分享页面只保留文件选择、文件列表和二维码
+	settingsContainer := container.NewVScroll(container.NewVBox(
+		widget.NewLabel(tr("端口设置：")),
 		portEntry,
 		widget.NewSeparator(),
-		widget.NewLabel("文件选择："),
-		selectFilesBtn,
-		fileLabel,
-		widget.NewSeparator(),
+		widget.NewLabel(tr("上传文件保存目录：")),
+		container.NewBorder(nil, nil, nil, container.NewHBox(uploadDirBtn,
+			widget.NewButtonWithIcon(tr("打开"), theme.FolderIcon(), openReceiveFolder)), uploadDirLabel),
+		container.NewBorder(nil, nil, widget.NewLabel(tr("同名文件：")), nil, makeConflictSelect()),
+		container.NewBorder(nil, nil, widget.NewLabel(tr("二维码地址：")), nil, makeHostSelect()),
+		container.NewBorder(nil, nil, widget.NewLabel(tr("上传大小限制（MB，0为不限）：")), nil, maxUploadEntry),
+		container.NewBorder(nil, nil, widget.NewLabel(tr("链接有效期：")), nil, makeTTLSelect(appSettings.shareTTL(), func(d time.Duration) {
+			updateSettings(func(s *Settings) { s.ShareTTL = int(d / time.Minute) })
+		})),
+		container.NewBorder(nil, nil, widget.NewLabel(tr("接收后执行：")), nil, postReceiveEntry),
+		tlsCheck,
+		http3Check,
+		tokenCheck,
+		clipboardCheck,
+		confirmUploadsCheck,
+		notifyCheck,
+		container.NewHBox(widget.NewLabel(tr("提示音：")), soundUploadCheck, soundDownloadCheck, soundErrorCheck),
+		mdnsCheck,
+		internetCheck,
+		torCheck,
+		webdavCheck,
+		ftpCheck,
+		dlnaCheck,
+		container.NewHBox(pinCheck, pinLabel, regenPINBtn),
+		container.NewBorder(nil, nil, widget.NewLabel(tr("HTTP基本认证：")), nil,
+			container.NewGridWithColumns(2, basicUserEntry, basicPasswordEntry)),
+		makeAPIRow(),
+	))
+
+	topContainer := container.NewVBox(
+		widget.NewLabel(tr("文件选择：")),
+		container.NewHBox(selectFilesBtn, selectFromDirBtn, clearFilesBtn),
+		oneShotCheck,
+		container.NewBorder(nil, nil, container.NewHBox(shareDirBtn, clearDirsBtn), nil, dirsLabel),
+		fileCountLabel,
 	)
 
 	btnContainer := container.NewHBox(
 		startBtn,
 		stopBtn,
+		sendTextBtn,
+		crocSendBtn,
+		crocReceiveBtn,
+		wormholeSendBtn,
+		wormholeReceiveBtn,
 	)
 
+	// 中间区域：左侧为已选文件列表，右侧为二维码和服务状态
+	centerSplit := container.NewHSplit(fileList, makeSharePanel())
+	centerSplit.Offset = 0.55
 	mainContainer := container.NewBorder(
 		topContainer,
 		btnContainer,
 		nil,
 		nil,
-		container.NewVBox(), // 中间空白区域
+		centerSplit,
 	)
 
-	// 设置主窗口内容
-	mainWindow.SetContent(mainContainer)
-
-	// 运行应用
-	mainWindow.ShowAndRun()
-}
-
-// registerRoutesOnce 确保路由只注册一次
-func registerRoutesOnce() {
-	routesMutex.Lock()
-	defer routesMutex.Unlock()
-
-	if !routesRegistered {
-		// 只注册一次路由
-		http.HandleFunc("/", indexHandler)                     // 上传页面
-		http.HandleFunc("/upload", uploadHandler)              // 上传接口
-		http.HandleFunc("/progress", progressHandler)          // 进度查询接口
-		http.HandleFunc("/download", downloadHandler)          // 下载接口
-		http.HandleFunc("/download-page", downloadListHandler) // 下载列表页面
-		routesRegistered = true
-		log.Println("路由注册完成（仅执行一次）")
-	}
-}
-
-// getSelectedFilesText 生成已选文件的展示文本
-func getSelectedFilesText() string {
-	if len(downloadFiles) == 0 {
-		return "未选择任何文件"
-	}
-	text := ""
-	for i, f := range downloadFiles {
-		text += fmt.Sprintf("%d. %s (%d KB)\n", i+1, f.Filename, f.SizeKB)
+	// 设置主窗口内容：分享、设置、传输列表、设备和历史记录页面，以及插件提供的页面
+	mainTabs = container.NewAppTabs(
+		container.NewTabItem(tr("分享"), mainContainer),
+		container.NewTabItem(tr("设置"), settingsContainer),
+		makeTransferTab(),
+		makeClientsTab(),
+		makeHistoryTab(refreshSharedFiles),
+		makeLogTab(),
+	)
+	for _, tab := range makePluginTabs() {
+		mainTabs.Append(tab)
 	}
-	return text
+	mainWindow.SetContent(mainTabs)
+	refreshTrayMenu()
 }
 
-// getLocalIP 获取本机局域网IP
-func getLocalIP() (string, error) {
-	gwIP, err := gateway.DiscoverGateway()
+// startService 在指定端口启动HTTP服务（已有服务会先停止），返回二维码对应的访问地址
+func startService(port int) (string, error) {
+	fingerprint, err := prepareTLS(appSettings.TLS)
 	if err != nil {
 		return "", err
 	}
+	certFingerprint = fingerprint
 
-	interfaces, err := net.Interfaces()
-	if err != nil {
+	server.SetShareExpiry(expiryAt(appSettings.shareTTL()))
+	if err := server.Start(port); err != nil {
+		serviceURL = ""
+		refreshServiceState()
 		return "", err
 	}
 
-	for _, iface := range interfaces {
-		if iface.Flags&net.FlagUp == 0 {
-			continue
-		}
-
-		addrs, err := iface.Addrs()
-		if err != nil {
-			continue
+	serviceURL = server.URL(serviceHost())
+	switch {
+	case appSettings.Tor:
+		if onion, err := startOnion(appSettings.TorControl); err != nil {
+			log.Printf("Tor 分享失败: %v", err)
+		} else {
+			serviceURL = onion
 		}
-
-		for _, addr := range addrs {
-			ipnet, ok := addr.(*net.IPNet)
-			if !ok || ipnet.IP.IsLoopback() {
-				continue
-			}
-
-			ipv4 := ipnet.IP.To4()
-			if ipv4 != nil && ipnet.Contains(gwIP) {
-				return ipv4.String(), nil
-			}
+	case appSettings.InternetSharing:
+		if public, err := mapInternet(); err != nil {
+			log.Printf("Internet 分享失败: %v", err)
+		} else {
+			serviceURL = public
 		}
 	}
-
-	return "", fmt.Errorf("未找到有效局域网IP")
+	log.Printf("生成二维码: %s", serviceURL)
+	refreshServiceState()
+	return serviceURL, nil
 }
 
-// 优化：更新二维码对话框的提示信息
-func showQRCodeDialog(url string) {
-	// 生成二维码图片
-	qrBytes, err := qrcode.Encode(url, qrcode.Medium, 256)
+// mapInternet 请求路由器将服务端口映射到公网，返回外网访问地址
+func mapInternet() (string, error) {
+	// 路由器不支持时NAT-PMP和UPnP都需等待超时，限制总时长以免界面长时间无响应
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m, err := server.MapPort(ctx)
 	if err != nil {
-		dialog.ShowError(fmt.Errorf("生成二维码失败: %v", err), mainWindow)
-		return
+		return "", err
 	}
-
-	// 创建二维码图片资源
-	qrResource := fyne.NewStaticResource("qrcode.png", qrBytes)
-	qrImage := canvas.NewImageFromResource(qrResource)
-	qrImage.SetMinSize(fyne.NewSize(256, 256))
-	qrImage.FillMode = canvas.ImageFillContain
-
-	// 动态生成提示文本
-	var title, tipText string
-	if len(downloadFiles) > 0 {
-		title = "文件下载服务已启动"
-		tipText = fmt.Sprintf("下载列表地址：%s\n扫码直接进入下载页面", url)
-	} else {
-		title = "文件上传服务已启动"
-		tipText = fmt.Sprintf("上传页面地址：%s\n扫码直接进入上传页面", url)
+	if !m.Public() {
+		log.Printf("路由器的外部地址 %s 不是公网IP，外网可能无法访问", m.ExternalIP)
 	}
+	return server.PublicURL(), nil
+}
 
-	// 创建对话框内容
-	content := container.NewVBox(
-		widget.NewLabel(tipText),
-		qrImage,
-	)
+// startOnion 通过本机Tor创建洋葱服务，返回.onion访问地址
+func startOnion(controlAddr string) (string, error) {
+	if _, err := server.StartOnion(context.Background(), controlAddr); err != nil {
+		return "", err
+	}
+	return server.OnionURL(), nil
+}
 
-	// 显示对话框
-	dialog.ShowCustom(title, "关闭", content, mainWindow)
+// internetWarning 返回Internet分享或Tor分享未生效的原因，已生效或未开启时为空
+func internetWarning() string {
+	if appSettings.Tor {
+		if server.OnionURL() == "" {
+			return tr("无法通过Tor分享（需运行Tor或Tor Browser），二维码仅在局域网内可用")
+		}
+		return tr("洋葱地址需要约一分钟发布到Tor网络，请用Tor Browser扫码访问")
+	}
+	if !appSettings.InternetSharing {
+		return ""
+	}
+	m, ok := server.PortMapping()
+	if !ok {
+		return tr("路由器端口映射失败（需开启UPnP或NAT-PMP），二维码仅在局域网内可用")
+	}
+	if !m.Public() {
+		return tr("路由器的外部地址 %s 不是公网IP（可能处于运营商级NAT之后），外网可能无法访问", m.ExternalIP)
+	}
+	return ""
 }
 
-// -------------------------- HTTP处理器 --------------------------
-
-// indexHandler 上传页面处理器【调整按钮样式：放大字号/尺寸】
-func indexHandler(w http.ResponseWriter, r *http.Request) {
-	html := `
-<!DOCTYPE html>
-<html lang="zh-CN">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>文件上传（带进度）</title>
-    <style>
-        * { margin: 0; padding: 0; box-sizing: border-box; }
-        body { max-width: 800px; margin: 2rem auto; padding: 0 1rem; font-family: sans-serif; }
-        h1 { text-align: center; margin-bottom: 2rem; font-size: 24px; }
-        
-        .upload-container { 
-            border: 2px dashed #ccc; 
-            padding: 3rem 2rem; /* 加大容器内边距 */
-            text-align: center; 
-            border-radius: 8px; 
-            margin-bottom: 2rem; 
-        }
-        
-        #file-input { display: none; }
-        
-        /* 核心修改：放大按钮尺寸和字号 */
-        .select-btn, .upload-btn { 
-            padding: 1.2rem 3rem; /* 加大按钮内边距 */
-            border: none; 
-            border-radius: 8px; /* 加大圆角 */
-            color: white; 
-            cursor: pointer; 
-            margin: 0.8rem; 
-            font-size: 18px; /* 放大字号 */
-            font-weight: bold; /* 加粗文字 */
-            min-width: 200px; /* 最小宽度，保证按钮大小 */
-            height: 60px; /* 固定高度 */
-        }
-        
-        .select-btn { background: #4285f4; }
-        .upload-btn { background: #0f9d58; }
-        
-        /* 按钮hover效果 */
-        .select-btn:hover, .upload-btn:hover {
-            opacity: 0.9;
-            transform: scale(1.02); /* 轻微放大，提升交互感 */
-        }
-        
-        .progress-item { margin: 1rem 0; padding: 1rem; border: 1px solid #eee; border-radius: 4px; }
-        .progress-bar { height: 20px; background: #eee; border-radius: 10px; overflow: hidden; margin-top: 0.5rem; }
-        .progress-fill { height: 100%; background: #4285f4; width: 0%; transition: width 0.3s ease; }
-        
-        .nav-link { margin-top: 2rem; text-align: center; }
-        .nav-link a { 
-            color: #4285f4; 
-            text-decoration: none; 
-            padding: 0.8rem 1.5rem; 
-            border: 1px solid #4285f4; 
-            border-radius: 4px; 
-            font-size: 16px;
-        }
-        
-        .nav-link a:hover { 
-            background: #4285f4; 
-            color: white; 
-        }
-    </style>
-</head>
-<body>
-    <h1>多文件上传</h1>
-    <div class="upload-container">
-        <button class="select-btn" onclick="document.getElementById('file-input').click()">选择文件</button>
-        <input type="file" id="file-input" multiple>
-        <button class="upload-btn" id="upload-btn" onclick="uploadFiles()" style="display:none;">开始上传</button>
-    </div>
-    <div id="file-list"></div>
-    <div class="nav-link">
-        <a href="/download-page">前往文件下载页面</a>
-    </div>
-
-    <script>
-        let files = [];
-        const fileInput = document.getElementById('file-input');
-        const uploadBtn = document.getElementById('upload-btn');
-        const fileList = document.getElementById('file-list');
-
-        fileInput.addEventListener('change', function(e) {
-            files = Array.from(e.target.files);
-            if (files.length === 0) return;
-            uploadBtn.style.display = 'inline-block';
-            fileList.innerHTML = '';
-            
-            files.forEach((file, index) => {
-                const item = document.createElement('div');
-                item.className = 'progress-item';
-                item.innerHTML = ` + "`" + `
-                    <div>${file.name} (${formatSize(file.size)})</div>
-                    <div class="progress-bar">
-                        <div class="progress-fill" id="progress-${index}"></div>
-                    </div>
-                    <div id="progress-text-${index}">0%</div>
-                ` + "`" + `;
-                fileList.appendChild(item);
-            });
-        });
-
-        function formatSize(bytes) {
-            if (bytes < 1024) return bytes + ' B';
-            if (bytes < 1048576) return (bytes / 1024).toFixed(1) + ' KB';
-            return (bytes / 1048576).toFixed(1) + ' MB';
-        }
-
-        function uploadFiles() {
-            files.forEach((file, index) => {
-                const formData = new FormData();
-                formData.append('file', file);
-                const uploadId = Math.random().toString(36).substring(2, 15);
-                
-                const xhr = new XMLHttpRequest();
-                xhr.open('POST', '/upload?uploadId=' + uploadId, true);
-                xhr.upload.addEventListener('progress', function(e) {
-                    if (e.lengthComputable) {
-                        const percent = (e.loaded / e.total) * 100;
-                        updateProgress(index, percent);
-                    }
-                });
-
-                xhr.onload = function() {
-                    if (xhr.status === 200) {
-                        updateProgress(index, 100, '上传完成');
-                    } else {
-                        updateProgress(index, 0, '上传失败');
-                    }
-                };
-
-                xhr.onerror = function() {
-                    updateProgress(index, 0, '上传失败（网络错误）');
-                };
-
-                xhr.send(formData);
-            });
-            uploadBtn.style.display = 'none';
-            fileInput.value = '';
-        }
-
-        function updateProgress(index, percent, text = '') {
-            const fill = document.getElementById('progress-' + index);
-            const textEl = document.getElementById('progress-text-' + index);
-            fill.style.width = percent + '%';
-            textEl.textContent = text || Math.round(percent) + '%';
-            if (text.includes('失败')) fill.style.backgroundColor = '#ea4335';
-            if (text.includes('完成')) fill.style.backgroundColor = '#0f9d58';
-        }
-    </script>
-</body>
-</html>
-	`
-	tmpl, err := template.New("upload").Parse(html)
+// serviceHost 返回二维码中的主机地址：优先使用设置中选择的VPN地址，其次为mDNS广播的主机名，否则为本机局域网IP
+func serviceHost() string {
+	if host := vpnHost(appSettings.QRHost); host != "" {
+		return host
+	}
+	if host := server.MDNSHost(); host != "" {
+		return host
+	}
+	localIP, err := pairserver.LocalIP()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("解析模板失败: %v", err), http.StatusInternalServerError)
-		return
+		log.Printf("获取本机IP失败: %v", err)
+		return "localhost"
 	}
-	tmpl.Execute(w, nil)
+	return localIP
 }
 
-// downloadListHandler 下载列表页面处理器【修复水平对齐问题】
-// downloadListHandler 下载列表页面处理器【支持文件名折行】
-func downloadListHandler(w http.ResponseWriter, r *http.Request) {
-	htmlTemplate := `
-<!DOCTYPE html>
-<html lang="zh-CN">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>文件下载列表</title>
-    <style>
-        * { margin: 0; padding: 0; box-sizing: border-box; }
-        body { max-width: 800px; margin: 2rem auto; padding: 0 1rem; font-family: sans-serif; }
-        h1 { text-align: center; margin-bottom: 2rem; font-size: 24px; }
-        
-        /* 改用弹性布局容器替代表格，彻底解决列挤压问题 */
-        .file-list-container {
-            margin-top: 2rem;
-            border: 1px solid #eee;
-            border-radius: 8px;
-            overflow: hidden;
-        }
-        
-        /* 列表头部 */
-        .file-list-header {
-            display: flex;
-            background: #4285f4;
-            color: white;
-            font-weight: bold;
-            font-size: 16px;
-        }
-        
-        /* 列表项 */
-        .file-list-item {
-            display: flex;
-            border-bottom: 1px solid #eee;
-            align-items: stretch; /* 改为stretch，让列高度自适应内容 */
-        }
-        
-        /* 最后一项去掉下边框 */
-        .file-list-item:last-child {
-            border-bottom: none;
-        }
-        
-        /* 列样式 - 核心布局：操作列固定宽度，其余空间分配 + 支持文件名折行 */
-        .col-name {
-            flex: 1; /* 占剩余所有空间 */
-            padding: 1.2rem 1rem; /* 统一内边距 */
-            font-size: 16px;
-            line-height: 1.6; /* 增大行高，优化折行显示 */
-            white-space: normal; /* 允许折行（关键） */
-            word-wrap: break-word; /* 长单词/文件名强制折行 */
-            word-break: break-all; /* 兼容所有字符的折行（包括中文/英文） */
-            align-self: center; /* 垂直居中 */
-        }
-        
-        .col-size {
-            width: 100px; /* 固定宽度，足够显示文件大小 */
-            padding: 1.2rem 1rem; /* 统一内边距，和其他列保持一致 */
-            text-align: center;
-            white-space: nowrap; /* 大小数字不折行 */
-            font-size: 16px;
-            align-self: center; /* 垂直居中 */
-        }
-        
-        .col-op {
-            width: 100px; /* 固定宽度，保证按钮不挤压 */
-            padding: 1.2rem 1rem; /* 统一内边距 */
-            text-align: center;
-            align-self: center; /* 垂直居中 */
-        }
-        
-        /* 下载按钮样式 */
-        .download-btn {
-            display: inline-block;
-            background: #4285f4;
-            color: white;
-            padding: 0.8rem 1.5rem; /* 加大按钮内边距 */
-            text-decoration: none;
-            border-radius: 6px;
-            white-space: nowrap; /* 按钮文字不折行 */
-            font-size: 16px; /* 放大按钮文字 */
-            width: 80px; /* 按钮固定宽度 */
-            text-align: center;
-        }
-        
-        /* 空列表提示 */
-        .empty-tip {
-            padding: 2rem;
-            text-align: center;
-            color: #999;
-            font-size: 16px;
-        }
-        
-        /* 头部列样式统一 */
-        .file-list-header .col-name,
-        .file-list-header .col-size,
-        .file-list-header .col-op {
-            padding: 1.2rem 1rem;
-            align-self: center;
-        }
-        
-        .file-list-header .col-name {
-            text-align: left; /* 文件名头部左对齐 */
-        }
-        
-        .nav-link { margin-top: 2rem; text-align: center; }
-        .nav-link a { 
-            color: #4285f4; 
-            text-decoration: none; 
-            padding: 0.8rem 1.5rem; 
-            border: 1px solid #4285f4; 
-            border-radius: 4px; 
-            font-size: 16px;
-        }
-        
-        .nav-link a:hover { 
-            background: #4285f4; 
-            color: white; 
-        }
-    </style>
-</head>
-<body>
-    <h1>文件下载列表</h1>
-    
-    <div class="file-list-container">
-        <!-- 列表头部 -->
-        <div class="file-list-header">
-            <div class="col-name">文件名</div>
-            <div class="col-size">文件大小 (KB)</div>
-            <div class="col-op">操作</div>
-        </div>
-        
-        <!-- 列表内容 -->
-        {{if eq (len .) 0}}
-        <div class="empty-tip">暂无可下载文件</div>
-        {{else}}
-        {{range .}}
-        <div class="file-list-item">
-            <div class="col-name">{{.Filename}}</div>
-            <div class="col-size">{{.SizeKB}}</div>
-            <div class="col-op"><a href="/download?file={{.Filename}}" class="download-btn" download>下载</a></div>
-        </div>
-        {{end}}
-        {{end}}
-    </div>
-    
-    <div class="nav-link">
-        <a href="/">前往文件上传页面</a>
-    </div>
-</body>
-</html>
-	`
-	tmpl, err := template.New("downloadList").Parse(htmlTemplate)
+// prepareTLS 根据设置为服务配置HTTPS证书（首次使用时生成并缓存），返回证书指纹
+func prepareTLS(enabled bool) (string, error) {
+	if !enabled {
+		server.SetTLSCert(nil)
+		return "", nil
+	}
+
+	dir, err := configDir()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("解析模板失败: %v", err), http.StatusInternalServerError)
-		return
+		return "", err
 	}
-	if err := tmpl.Execute(w, downloadFiles); err != nil {
-		http.Error(w, fmt.Sprintf("渲染页面失败: %v", err), http.StatusInternalServerError)
-		return
+	cert, err := pairserver.LoadOrCreateCert(dir)
+	if err != nil {
+		return "", err
 	}
+	server.SetTLSCert(&cert)
+	return pairserver.CertFingerprint(cert), nil
 }
 
-
-// uploadHandler 文件上传接口处理器
-func uploadHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "仅支持POST方法", http.StatusMethodNotAllowed)
+// requestStopService 停止HTTP服务；有正在进行的传输时询问等待完成、强制停止或取消
+func requestStopService() {
+	if !server.Running() {
+		dialog.ShowInformation(tr("提示"), tr("当前无运行中的服务"), mainWindow)
 		return
 	}
 
-	uploadId := r.URL.Query().Get("uploadId")
-	if uploadId == "" {
-		http.Error(w, "缺少uploadId参数", http.StatusBadRequest)
+	active := server.ActiveTransfers()
+	if active == 0 {
+		finishStopService(server.Stop())
 		return
 	}
 
-	err := r.ParseMultipartForm(100 << 20) // 100MB上传限制
-	if err != nil {
-		http.Error(w, fmt.Sprintf("解析表单失败: %v", err), http.StatusBadRequest)
-		return
-	}
+	var d dialog.Dialog
+	waitBtn := widget.NewButton(tr("等待传输完成"), func() {
+		d.Hide()
+		waitForTransfers()
+	})
+	waitBtn.Importance = widget.HighImportance
+	forceBtn := widget.NewButton(tr("强制停止"), func() {
+		d.Hide()
+		finishStopService(server.Stop())
+	})
+	forceBtn.Importance = widget.DangerImportance
+	cancelBtn := widget.NewButton(tr("取消"), func() {
+		d.Hide()
+	})
 
-	file, fileHeader, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, fmt.Sprintf("获取文件失败: %v", err), http.StatusBadRequest)
+	content := container.NewVBox(
+		widget.NewLabel(tr("当前有 %d 个传输正在进行，立即停止会中断这些传输。", active)),
+		container.NewHBox(waitBtn, forceBtn, cancelBtn),
+	)
+	d = dialog.NewCustomWithoutButtons(tr("停止服务"), content, mainWindow)
+	d.Show()
+}
+
+// waitForTransfers 停止接受新请求并等待正在进行的传输完成，等待期间可强制停止
+func waitForTransfers() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	forceBtn := widget.NewButton(tr("强制停止"), cancel)
+	content := container.NewVBox(
+		widget.NewLabel(tr("正在等待传输完成…")),
+		widget.NewProgressBarInfinite(),
+		forceBtn,
+	)
+	d := dialog.NewCustomWithoutButtons(tr("停止服务"), content, mainWindow)
+	d.Show()
+
+	go func() {
+		err := server.Shutdown(ctx)
+		cancel()
+		fyne.Do(func() {
+			d.Hide()
+			// 用户选择强制停止时连接已被关闭，视为停止成功
+			if errors.Is(err, context.Canceled) {
+				err = nil
+			}
+			finishStopService(err)
+		})
+	}()
+}
+
+// oneShotFinished 一次性分享的文件都已下载、服务自动停止后更新界面并通知
+func oneShotFinished() {
+	fyne.Do(func() {
+		serviceURL = ""
+		refreshServiceState()
+		msg := tr("所有文件都已被下载，服务已自动停止")
+		fyne.CurrentApp().SendNotification(fyne.NewNotification(tr("分享已结束"), msg))
+		dialog.ShowInformation(tr("分享已结束"), msg, mainWindow)
+	})
+}
+
+// finishStopService 更新服务停止后的界面状态
+func finishStopService(err error) {
+	if err != nil && err != pairserver.ErrNotRunning {
+		dialog.ShowError(fmt.Errorf(tr("停止服务失败: %v"), err), mainWindow)
 		return
 	}
-	defer file.Close()
+	serviceURL = ""
+	refreshServiceState()
+	dialog.ShowInformation(tr("成功"), tr("服务已停止"), mainWindow)
+}
 
-	// 初始化上传进度
-	progress := &UploadProgress{
-		TotalSize: fileHeader.Size,
-		Uploaded:  0,
+// refreshFileList 刷新已选文件列表及数量提示
+func refreshFileList(list *widget.List, countLabel *widget.Label) {
+	files := server.Files()
+	if len(files) == 0 {
+		countLabel.SetText(tr("未选择任何文件"))
+	} else {
+		countLabel.SetText(tr("已选择 %d 个文件：", len(files)))
 	}
-	progressMap[uploadId] = progress
+	list.UnselectAll()
+	list.Refresh()
 
-	// 保存文件到当前目录
-	filename := filepath.Base(fileHeader.Filename)
-	outFile, err := os.Create(filename)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("创建文件失败: %v", err), http.StatusInternalServerError)
-		return
+	// 文件列表变化时同步保存到偏好设置
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, f.AbsPath)
 	}
-	defer outFile.Close()
+	updateSettings(func(s *Settings) { s.SharedFiles = paths })
+}
 
-	// 包装Reader以跟踪进度
-	progressReader := &ProgressReader{
-		Reader:   file,
-		Progress: progress,
+// refreshSharedDirs 刷新共享文件夹提示并保存到偏好设置
+func refreshSharedDirs(label *widget.Label) {
+	dirs := server.Dirs()
+	names := make([]string, 0, len(dirs))
+	paths := make([]string, 0, len(dirs))
+	for _, d := range dirs {
+		names = append(names, d.Name)
+		paths = append(paths, d.AbsPath)
+	}
+	if len(dirs) == 0 {
+		label.SetText(tr("未共享文件夹"))
+	} else {
+		label.SetText(strings.Join(names, ", "))
 	}
+	updateSettings(func(s *Settings) { s.SharedDirs = paths })
+}
 
-	// 写入文件
-	_, err = io.Copy(outFile, progressReader)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("保存文件失败: %v", err), http.StatusInternalServerError)
-		return
+// updateSettings 修改当前设置并立即持久化，再应用到文件传输服务
+func updateSettings(modify func(s *Settings)) {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+
+	prev := appSettings
+	modify(&appSettings)
+	if appPrefs != nil {
+		saveSettings(appPrefs, appSettings)
 	}
+	applySettings(&prev, appSettings)
+}
 
-	// 移除进度记录
-	delete(progressMap, uploadId)
+// applyServerSettings 将当前设置应用到文件传输服务
+func applyServerSettings() {
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "文件上传成功: %s", filename)
+	applySettings(nil, appSettings)
 }
 
-// downloadHandler 文件下载接口处理器
-func downloadHandler(w http.ResponseWriter, r *http.Request) {
-	filename := r.URL.Query().Get("file")
-	if filename == "" {
-		http.Error(w, "缺少file参数", http.StatusBadRequest)
-		return
+// applySettings 将设置s应用到文件传输服务和日志，调用方持有settingsMutex。
+// 网页模板、品牌和日志文件需要读取磁盘，prev不为空时只在相应设置相对prev有变化时重新加载，
+// 避免在设置框中每输入一个字符就读一次
+func applySettings(prev *Settings, s Settings) {
+	server.SetUploadDir(s.uploadDirOrDefault())
+	server.SetRateLimit(s.RateLimitKB)
+	server.SetPIN(s.PIN)
+	server.SetRequireToken(s.requireToken())
+	server.SetConflictPolicy(pairserver.ConflictPolicy(s.ConflictPolicy))
+	server.SetMaxUploadSize(s.maxUploadSize())
+	server.SetClipboardSync(s.ClipboardSync)
+	server.SetUploadApproval(s.ConfirmUploads)
+	server.SetWebDAV(s.WebDAV)
+	server.SetFTPPort(s.ftpPort())
+	server.SetDLNAName(s.dlnaName())
+	server.SetMDNSName(s.mdnsName())
+	server.SetPostReceiveCommand(s.PostReceive)
+	server.SetOneShot(s.OneShot)
+	server.SetBasicAuth(s.BasicUser, s.BasicPassword)
+	server.SetHTTP3(s.HTTP3)
+	server.SetTimeouts(s.timeouts())
+	if prev == nil || prev.TemplateDir != s.TemplateDir {
+		if err := server.SetTemplateDir(s.TemplateDir); err != nil {
+			log.Printf("加载网页模板失败: %v", err)
+		}
 	}
-
-	// 查找文件
-	var targetFile DownloadFile
-	found := false
-	for _, f := range downloadFiles {
-		if f.Filename == filename {
-			targetFile = f
-			found = true
-			break
+	if err := server.SetPathPrefix(s.PathPrefix); err != nil {
+		log.Printf("设置路径前缀失败: %v", err)
+	}
+	if prev == nil || prev.branding() != s.branding() {
+		if err := server.SetBranding(s.branding()); err != nil {
+			log.Printf("应用品牌设置失败: %v", err)
 		}
 	}
-
-	if !found {
-		http.Error(w, "文件不存在", http.StatusNotFound)
-		return
+	if err := server.SetAllowlist(s.Allowlist); err != nil {
+		log.Printf("允许列表无效: %v", err)
 	}
+	if err := server.SetBlocklist(s.Blocklist); err != nil {
+		log.Printf("屏蔽列表无效: %v", err)
+	}
+	server.SetClientNames(s.clientNames())
+	if err := server.SetWebhooks(s.Webhooks); err != nil {
+		log.Printf("Webhook地址无效: %v", err)
+	}
+	setLogLevel(s.logLevel())
+	if prev == nil || prev.LogFile != s.LogFile || prev.LogMaxMB != s.LogMaxMB || prev.LogBackups != s.LogBackups {
+		if err := applyLogFile(s); err != nil {
+			log.Printf("打开日志文件失败: %v", err)
+		}
+	}
+}
 
-	// 设置下载响应头
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", targetFile.Filename))
-	w.Header().Set("Content-Type", "application/octet-stream")
-
-	// 打开文件并写入响应
-	file, err := os.Open(targetFile.AbsPath)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("打开文件失败: %v", err), http.StatusInternalServerError)
-		return
+// formatFilesText 将文件列表格式化为带序号的文本
+func formatFilesText(files []pairserver.File) string {
+	text := ""
+	for i, f := range files {
+		text += fmt.Sprintf("%d. %s (%d KB)\n", i+1, f.Filename, f.SizeKB)
 	}
-	defer file.Close()
+	return text
+}
 
-	_, err = io.Copy(w, file)
+// newDownloadFile 校验文件路径并生成下载文件信息，错误信息按界面语言翻译
+func newDownloadFile(path string) (pairserver.File, error) {
+	f, err := pairserver.NewFile(path)
+	if errors.Is(err, pairserver.ErrIsDir) {
+		return f, errors.New(tr("请选择文件而非目录"))
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("下载文件失败: %v", err), http.StatusInternalServerError)
-		return
+		return f, fmt.Errorf(tr("文件不存在: %v"), err)
 	}
+	return f, nil
 }
 
-// progressHandler 上传进度查询接口
-func progressHandler(w http.ResponseWriter, r *http.Request) {
-	uploadId := r.URL.Query().Get("uploadId")
-	if uploadId == "" {
-		http.Error(w, "缺少uploadId参数", http.StatusBadRequest)
-		return
+// pickFilesLoop 循环打开文件对话框，每选一个文件后显示汇总并询问是否继续添加，
+// 结束时将本轮选择的所有文件一次性加入下载列表
+func pickFilesLoop(pending []pairserver.File, onDone func([]pairserver.File)) {
+	finish := func() {
+		if len(pending) == 0 {
+			return
+		}
+		onDone(server.AddFiles(pending...))
 	}
 
-	progress, exists := progressMap[uploadId]
-	if !exists {
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, `{"total":0,"uploaded":0}`)
-		return
-	}
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			// 取消选择：提交已选文件
+			finish()
+			return
+		}
+		reader.Close()
 
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"total":%d,"uploaded":%d}`, progress.TotalSize, atomic.LoadInt64(&progress.Uploaded))
-}
+		f, err := newDownloadFile(reader.URI().Path())
+		if err != nil {
+			dialog.ShowError(err, mainWindow)
+			finish()
+			return
+		}
+		pending = append(pending, f)
 
-// ProgressReader 包装io.Reader以跟踪读取进度
-type ProgressReader struct {
-	Reader   io.Reader
-	Progress *UploadProgress
+		// 显示本轮已选汇总，询问是否继续添加
+		summary := tr("本次已选择 %d 个文件：\n%s\n是否继续添加？", len(pending), formatFilesText(pending))
+		dialog.ShowConfirm(tr("继续添加"), summary, func(more bool) {
+			if more {
+				pickFilesLoop(pending, onDone)
+				return
+			}
+			finish()
+		}, mainWindow)
+	}, mainWindow)
 }
 
-// Read 实现io.Reader接口，更新上传进度
-func (pr *ProgressReader) Read(p []byte) (n int, err error) {
-	n, err = pr.Reader.Read(p)
-	atomic.AddInt64(&pr.Progress.Uploaded, int64(n))
-	return
+// pickFilesFromDir 选择一个文件夹，并在其中勾选多个文件一次性加入下载列表
+func pickFilesFromDir(onDone func([]pairserver.File)) {
+	dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+		if err != nil || dir == nil {
+			return
+		}
+
+		entries, err := os.ReadDir(dir.Path())
+		if err != nil {
+			dialog.ShowError(fmt.Errorf(tr("读取目录失败: %v"), err), mainWindow)
+			return
+		}
+
+		var names []string
+		for _, e := range entries {
+			if !e.IsDir() {
+				names = append(names, e.Name())
+			}
+		}
+		if len(names) == 0 {
+			dialog.ShowInformation(tr("提示"), tr("该目录下没有文件"), mainWindow)
+			return
+		}
+
+		checkGroup := widget.NewCheckGroup(names, nil)
+		selectAll := widget.NewCheck(tr("全选"), func(checked bool) {
+			if checked {
+				checkGroup.SetSelected(names)
+			} else {
+				checkGroup.SetSelected(nil)
+			}
+		})
+		content := container.NewBorder(selectAll, nil, nil, nil, container.NewVScroll(checkGroup))
+
+		d := dialog.NewCustomConfirm(tr("选择文件"), tr("添加"), tr("取消"), content, func(ok bool) {
+			if !ok || len(checkGroup.Selected) == 0 {
+				return
+			}
+
+			var files []pairserver.File
+			for _, name := range checkGroup.Selected {
+				f, err := newDownloadFile(filepath.Join(dir.Path(), name))
+				if err != nil {
+					dialog.ShowError(err, mainWindow)
+					return
+				}
+				files = append(files, f)
+			}
+
+			added := server.AddFiles(files...)
+			onDone(added)
+			dialog.ShowInformation(tr("添加完成"),
+				tr("已添加 %d 个文件（跳过 %d 个重复文件）", len(added), len(files)-len(added)), mainWindow)
+		}, mainWindow)
+		d.Resize(fyne.NewSize(480, 400))
+		d.Show()
+	}, mainWindow)
 }
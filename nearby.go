@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"pair-gui/pairserver"
+)
+
+// nearbyWindow 附近设备窗口，同一时间只打开一个
+var nearbyWindow fyne.Window
+
+// deviceName 返回广播给其他设备的本机名称
+func deviceName() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "pair-gui"
+	}
+	return name
+}
+
+// applyDiscovery 按设置开始或停止局域网设备发现
+func applyDiscovery(enabled bool) {
+	if !enabled {
+		server.StopDiscovery()
+		return
+	}
+	if err := server.StartDiscovery(deviceName()); err != nil {
+		log.Printf("启动设备发现失败: %v", err)
+	}
+}
+
+// applySync 按设置开始或停止与附近设备的文件夹同步
+func applySync() {
+	if appSettings.SyncDir == "" || appSettings.SyncPeer == "" {
+		server.StopSync()
+		return
+	}
+	cfg := pairserver.SyncConfig{Dir: appSettings.SyncDir, Peer: appSettings.SyncPeer, Key: appSettings.SyncKey}
+	if err := server.StartSync(cfg); err != nil {
+		log.Printf("启动文件夹同步失败: %v", err)
+	}
+}
+
+// syncStatus 返回文件夹同步状态的说明
+func syncStatus() string {
+	if appSettings.SyncDir == "" || appSettings.SyncPeer == "" {
+		return tr("未同步文件夹")
+	}
+	return tr("正在与 %s 同步：%s", appSettings.SyncPeer, appSettings.SyncDir)
+}
+
+// showSyncDialog 设置与附近设备的文件夹同步：选择本地目录并输入双方相同的同步密钥，
+// 对方也需要选择本机并设置相同的密钥
+func showSyncDialog(w fyne.Window, peer string, onChanged func()) {
+	dir := appSettings.SyncDir
+	dirLabel := widget.NewLabel(dir)
+	dirLabel.Truncation = fyne.TextTruncateEllipsis
+	dirBtn := widget.NewButtonWithIcon(tr("选择"), theme.FolderOpenIcon(), func() {
+		dialog.ShowFolderOpen(func(uri fyne.ListableURI, err error) {
+			if err != nil || uri == nil {
+				return
+			}
+			dir = uri.Path()
+			dirLabel.SetText(dir)
+		}, w)
+	})
+	// 密钥须随机生成，对方可凭收到的证明离线猜测容易猜到的密钥；在一台设备上生成，再输入到另一台
+	keyEntry := widget.NewPasswordEntry()
+	if appSettings.SyncPeer == peer {
+		keyEntry.SetText(appSettings.SyncKey)
+	}
+	if keyEntry.Text == "" {
+		keyEntry.SetText(pairserver.NewSyncKey())
+	}
+	keyEntry.SetPlaceHolder(tr("双方设置相同的密钥"))
+	keyBtn := widget.NewButtonWithIcon(tr("重新生成"), theme.ViewRefreshIcon(), func() {
+		keyEntry.SetText(pairserver.NewSyncKey())
+	})
+
+	dialog.ShowForm(tr("与 %s 同步文件夹", peer), tr("开始同步"), tr("取消"), []*widget.FormItem{
+		widget.NewFormItem(tr("本地文件夹"), container.NewBorder(nil, nil, nil, dirBtn, dirLabel)),
+		widget.NewFormItem(tr("同步密钥"), container.NewBorder(nil, nil, nil, keyBtn, keyEntry)),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+		if dir == "" || keyEntry.Text == "" {
+			dialog.ShowInformation(tr("提示"), tr("请选择文件夹并设置同步密钥"), w)
+			return
+		}
+		if len(keyEntry.Text) < pairserver.MinSyncKeyLength {
+			dialog.ShowInformation(tr("提示"), tr("同步密钥至少需要%d个字符，请使用随机生成的密钥", pairserver.MinSyncKeyLength), w)
+			return
+		}
+		updateSettings(func(s *Settings) {
+			s.SyncDir = dir
+			s.SyncPeer = peer
+			s.SyncKey = keyEntry.Text
+		})
+		applySync()
+		onChanged()
+	}, w)
+}
+
+// showNearbyDevices 打开附近设备窗口：列出局域网中运行的其他pair-gui实例和LocalSend应用，
+// 可直接发送文件，正在共享的pair-gui实例还可在浏览器中打开
+func showNearbyDevices(a fyne.App) {
+	if nearbyWindow != nil {
+		nearbyWindow.RequestFocus()
+		return
+	}
+
+	w := a.NewWindow(tr("附近设备"))
+	nearbyWindow = w
+
+	syncLabel := widget.NewLabel("")
+	syncLabel.Truncation = fyne.TextTruncateEllipsis
+	stopSyncBtn := widget.NewButton(tr("停止同步"), nil)
+	updateSync := func() {
+		syncLabel.SetText(syncStatus())
+		if appSettings.SyncDir == "" {
+			stopSyncBtn.Disable()
+		} else {
+			stopSyncBtn.Enable()
+		}
+	}
+	stopSyncBtn.OnTapped = func() {
+		updateSettings(func(s *Settings) { s.SyncDir = "" })
+		applySync()
+		updateSync()
+	}
+	updateSync()
+
+	peers := server.Peers()
+	emptyLabel := widget.NewLabel(tr("未发现其他设备"))
+	peerList := widget.NewList(
+		func() int {
+			return len(peers)
+		},
+		func() fyne.CanvasObject {
+			buttons := container.NewHBox(widget.NewButton(tr("发送文件"), nil), widget.NewButton(tr("打开"), nil),
+				widget.NewButton(tr("同步"), nil))
+			return container.NewBorder(nil, nil, nil, buttons, widget.NewLabel(""))
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			if id >= len(peers) {
+				return
+			}
+			p := peers[id]
+			row := obj.(*fyne.Container)
+			status := tr("未启动服务")
+			switch {
+			case p.LocalSend:
+				status = "LocalSend"
+			case p.Sharing:
+				status = tr("正在共享 %d 项", p.Files)
+			}
+			row.Objects[0].(*widget.Label).SetText(fmt.Sprintf("%s  %s  (%s)", p.Name, p.IP, status))
+			buttons := row.Objects[1].(*fyne.Container)
+			sendBtn := buttons.Objects[0].(*widget.Button)
+			openBtn := buttons.Objects[1].(*widget.Button)
+			syncBtn := buttons.Objects[2].(*widget.Button)
+			if p.URL() == "" {
+				sendBtn.Disable()
+				openBtn.Disable()
+				syncBtn.Disable()
+				return
+			}
+			sendBtn.Enable()
+			sendBtn.OnTapped = func() { pushToPeer(w, p) }
+			// LocalSend应用没有网页界面，只能发送文件
+			if p.LocalSend {
+				openBtn.Disable()
+				syncBtn.Disable()
+				return
+			}
+			syncBtn.Enable()
+			syncBtn.OnTapped = func() { showSyncDialog(w, p.Name, updateSync) }
+			openBtn.Enable()
+			openBtn.OnTapped = func() {
+				u, err := url.Parse(p.URL())
+				if err != nil {
+					dialog.ShowError(err, w)
+					return
+				}
+				a.OpenURL(u)
+			}
+		},
+	)
+	refresh := func() {
+		peers = server.Peers()
+		emptyLabel.Hidden = len(peers) > 0
+		emptyLabel.Refresh()
+		peerList.Refresh()
+	}
+	server.SetPeersHandler(func() { fyne.Do(refresh) })
+	w.SetOnClosed(func() {
+		server.SetPeersHandler(nil)
+		nearbyWindow = nil
+	})
+
+	discoveryCheck := widget.NewCheck(tr("在局域网中发现其他设备并显示本机"), nil)
+	discoveryCheck.Checked = appSettings.Discovery
+	discoveryCheck.OnChanged = func(checked bool) {
+		updateSettings(func(s *Settings) { s.Discovery = checked })
+		applyDiscovery(checked)
+		refresh()
+	}
+	refresh()
+
+	w.SetContent(container.NewBorder(
+		container.NewVBox(discoveryCheck, widget.NewLabel(tr("本机名称：%s", deviceName())),
+			container.NewBorder(nil, nil, nil, stopSyncBtn, syncLabel)),
+		nil, nil, nil,
+		container.NewStack(peerList, container.NewCenter(emptyLabel)),
+	))
+	w.Resize(fyne.NewSize(560, 400))
+	w.Show()
+}
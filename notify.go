@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+
+	"pair-gui/pairserver"
+)
+
+// notifyDelay 上传完成后等待的时间，期间完成的其他上传合并为一条通知
+const notifyDelay = 2 * time.Second
+
+// received 等待合并通知的上传
+var received struct {
+	mu      sync.Mutex
+	entries []pairserver.HistoryEntry
+}
+
+// watchEvents 订阅服务事件，按设置播放提示音，分享文件变化（如下载次数增加）时刷新文件列表，
+// 并在上传完成时弹出系统通知
+func watchEvents(a fyne.App) {
+	events, _ := server.Subscribe()
+	go func() {
+		for e := range events {
+			if e.Type == pairserver.EventFilesChanged {
+				fyne.Do(func() {
+					if refreshSharedFiles != nil {
+						refreshSharedFiles()
+					}
+					refreshSharePanel()
+				})
+			}
+			if kind, ok := eventSound(e); ok {
+				playSound(kind)
+			}
+			entry, ok := e.Data.(pairserver.HistoryEntry)
+			if e.Type != pairserver.EventUploadFinished || !ok || entry.Result != pairserver.HistoryCompleted {
+				continue
+			}
+			settingsMutex.RLock()
+			enabled := appSettings.NotifyUploads
+			settingsMutex.RUnlock()
+			if !enabled {
+				continue
+			}
+
+			received.mu.Lock()
+			received.entries = append(received.entries, entry)
+			if len(received.entries) == 1 {
+				time.AfterFunc(notifyDelay, func() { notifyReceived(a) })
+			}
+			received.mu.Unlock()
+		}
+	}()
+}
+
+// notifyReceived 为等待中的上传发送一条系统通知
+func notifyReceived(a fyne.App) {
+	received.mu.Lock()
+	entries := received.entries
+	received.entries = nil
+	received.mu.Unlock()
+	if len(entries) == 0 {
+		return
+	}
+
+	first := entries[0]
+	peer := first.ClientIP
+	if first.ClientName != "" {
+		peer = first.ClientName
+	}
+	var content string
+	if len(entries) == 1 {
+		content = tr("收到 %s，%s 来自 %s", first.Filename, formatBytes(first.Size), peer)
+	} else {
+		var total int64
+		for _, e := range entries {
+			total += e.Size
+		}
+		content = tr("收到 %s 等 %d 个文件，共 %s", first.Filename, len(entries), formatBytes(total))
+	}
+	a.SendNotification(fyne.NewNotification(tr("收到文件"), content))
+}
+
+// openReceiveFolder 在系统文件管理器中打开上传文件保存目录
+func openReceiveFolder() {
+	dir, err := filepath.Abs(appSettings.uploadDirOrDefault())
+	if err == nil {
+		err = openPath(dir)
+	}
+	if err != nil {
+		dialog.ShowError(err, mainWindow)
+	}
+}
+
+// startCommand 启动打开文件的命令，不等待其结束
+func startCommand(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
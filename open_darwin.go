@@ -0,0 +1,13 @@
+package main
+
+import "os/exec"
+
+// openPath 用默认应用打开文件或目录
+func openPath(path string) error {
+	return startCommand(exec.Command("open", path))
+}
+
+// revealPath 在Finder中显示文件并选中
+func revealPath(path string) error {
+	return startCommand(exec.Command("open", "-R", path))
+}
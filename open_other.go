@@ -0,0 +1,28 @@
+//go:build !darwin && !windows
+
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+
+	"fyne.io/fyne/v2/storage"
+)
+
+// openPath 用默认应用打开文件或目录
+func openPath(path string) error {
+	return startCommand(exec.Command("xdg-open", path))
+}
+
+// revealPath 通过freedesktop的FileManager1接口在文件管理器中显示文件并选中，
+// 不支持该接口时打开文件所在的目录
+func revealPath(path string) error {
+	uri := storage.NewFileURI(path).String()
+	err := exec.Command("dbus-send", "--session", "--print-reply", "--dest=org.freedesktop.FileManager1",
+		"/org/freedesktop/FileManager1", "org.freedesktop.FileManager1.ShowItems",
+		"array:string:"+uri, "string:").Run()
+	if err == nil {
+		return nil
+	}
+	return openPath(filepath.Dir(path))
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// openPath 用默认应用打开文件或目录
+func openPath(path string) error {
+	return startCommand(exec.Command("rundll32", "url.dll,FileProtocolHandler", path))
+}
+
+// revealPath 在资源管理器中显示文件并选中；/select参数不能按程序参数规则整体加引号，因此直接设置命令行
+func revealPath(path string) error {
+	cmd := exec.Command("explorer")
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: `explorer /select,"` + path + `"`}
+	return startCommand(cmd)
+}
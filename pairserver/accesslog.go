@@ -0,0 +1,142 @@
+package pairserver
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// AccessLogEntry 一条HTTP请求记录
+type AccessLogEntry struct {
+	Time     time.Time     // 收到请求的时间
+	ClientIP string        // 客户端IP
+	Method   string        // 请求方法
+	Path     string        // 请求路径和参数，已去掉访问令牌和签名
+	Status   int           // 响应状态码
+	Bytes    int64         // 响应体的字节数
+	Duration time.Duration // 处理耗时
+
+	UserAgent string // 客户端的User-Agent
+}
+
+// AccessLogHandler 每个请求处理完成后调用，在处理请求的协程中执行，应尽快返回
+type AccessLogHandler func(AccessLogEntry)
+
+// accessLog 请求日志的回调
+type accessLog struct {
+	mu      sync.RWMutex
+	handler AccessLogHandler
+}
+
+// redactedParams 记录请求时隐去的参数
+var redactedParams = []string{"token", "sig"}
+
+// SetAccessLogHandler 设置请求日志的回调，nil表示不记录
+func (s *Server) SetAccessLogHandler(h AccessLogHandler) {
+	s.accessLog.mu.Lock()
+	defer s.accessLog.mu.Unlock()
+
+	s.accessLog.handler = h
+}
+
+// logRequests 请求处理完成后将请求记录交给回调，未设置回调时直接处理请求
+func (s *Server) logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.accessLog.mu.RLock()
+		handler := s.accessLog.handler
+		s.accessLog.mu.RUnlock()
+		if handler == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		lw := &loggingResponseWriter{ResponseWriter: w}
+		defer func() {
+			if lw.status == 0 {
+				lw.status = http.StatusOK
+			}
+			handler(AccessLogEntry{
+				Time:     start,
+				ClientIP: clientIP(r),
+				Method:   r.Method,
+				Path:     redactedURI(r.URL),
+				Status:   lw.status,
+				Bytes:    lw.bytes,
+				Duration: time.Since(start),
+
+				UserAgent: r.UserAgent(),
+			})
+		}()
+		h.ServeHTTP(lw, r)
+	})
+}
+
+// redactedURI 返回隐去访问令牌和签名参数的请求路径，参数不做转义以便阅读
+func redactedURI(u *url.URL) string {
+	q := u.Query()
+	for _, key := range redactedParams {
+		if q.Has(key) {
+			q.Set(key, "***")
+		}
+	}
+	if len(q) == 0 {
+		return u.Path
+	}
+	query := q.Encode()
+	if unescaped, err := url.QueryUnescape(query); err == nil {
+		query = unescaped
+	}
+	return u.Path + "?" + query
+}
+
+// loggingResponseWriter 记录响应的状态码和字节数
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// WriteHeader 记录第一次写入的状态码
+func (w *loggingResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write 统计写出的字节数
+func (w *loggingResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush 供进度推送等流式响应使用
+func (w *loggingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 供WebSocket接管连接，接管后的状态记为101
+func (w *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("连接不支持接管")
+	}
+	w.status = http.StatusSwitchingProtocols
+	return hj.Hijack()
+}
+
+// Unwrap 供http.ResponseController访问原始的ResponseWriter
+func (w *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,436 @@
+package pairserver
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 管理接口参数
+const (
+	DefaultAPIAddr = "127.0.0.1:1083" // 管理接口默认只允许本机访问
+	apiKeyHeader   = "X-API-Key"
+	apiMaxBody     = 1 << 20 // 管理接口请求体的最大字节数
+)
+
+// APIControl 管理接口启动和停止服务时调用的方法，由嵌入服务的程序提供以便同步界面状态；
+// 字段为nil时直接调用Server的对应方法
+type APIControl struct {
+	Start        func(port int) (url string, err error) // port为0时使用程序设置的端口
+	Stop         func() error
+	URL          func() string // 返回服务的访问地址
+	FilesChanged func()        // 通过管理接口修改分享文件列表后调用
+}
+
+// apiState 管理接口的状态
+type apiState struct {
+	mu      sync.Mutex
+	key     string
+	control APIControl
+	server  *http.Server
+	addr    string
+}
+
+// APIStatus 管理接口返回的服务状态
+type APIStatus struct {
+	Running         bool   `json:"running"`
+	Port            int    `json:"port,omitempty"`
+	URL             string `json:"url,omitempty"`
+	Files           int    `json:"files"`
+	Dirs            int    `json:"dirs"`
+	ActiveTransfers int    `json:"active_transfers"`
+	UploadDir       string `json:"upload_dir"`
+}
+
+// APIFile 管理接口返回的分享文件
+type APIFile struct {
+	Name     string     `json:"name"`
+	Path     string     `json:"path"`
+	SizeKB   int64      `json:"size_kb"`
+	MimeType string     `json:"mime_type"`
+	Modified time.Time  `json:"modified"`
+	Expires  *time.Time `json:"expires,omitempty"` // 分享的过期时间，不过期时省略
+	Locked   bool       `json:"locked,omitempty"`  // 是否设有单独的下载密码
+
+	Downloads    int `json:"downloads"`               // 已完整下载的次数
+	MaxDownloads int `json:"max_downloads,omitempty"` // 允许下载的次数，不限时省略
+}
+
+// GenerateAPIKey 生成随机的管理接口密钥
+func GenerateAPIKey() string {
+	return newSessionID() + newSessionID()
+}
+
+// SetAPIControl 设置管理接口启动和停止服务时调用的方法
+func (s *Server) SetAPIControl(c APIControl) {
+	s.api.mu.Lock()
+	defer s.api.mu.Unlock()
+
+	s.api.control = c
+}
+
+// StartAPI 在addr上启动管理接口，请求需在X-API-Key或Authorization: Bearer请求头中附带key；
+// 管理接口独立于文件传输服务运行，停止传输服务后仍可通过它重新启动。已在运行时先停止
+func (s *Server) StartAPI(addr, key string) error {
+	if key == "" {
+		return errors.New("管理接口密钥不能为空")
+	}
+	s.StopAPI()
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: s.APIHandler(), ReadHeaderTimeout: 10 * time.Second}
+
+	s.api.mu.Lock()
+	s.api.key = key
+	s.api.server = server
+	s.api.addr = ln.Addr().String()
+	s.api.mu.Unlock()
+
+	go func() {
+		log.Printf("管理接口启动成功: %s", ln.Addr())
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("管理接口运行失败: %v", err)
+		}
+	}()
+	return nil
+}
+
+// StopAPI 停止管理接口，未运行时不做任何事
+func (s *Server) StopAPI() {
+	s.api.mu.Lock()
+	server := s.api.server
+	s.api.server = nil
+	s.api.addr = ""
+	s.api.mu.Unlock()
+
+	if server != nil {
+		server.Close()
+	}
+}
+
+// APIAddr 返回管理接口监听的地址，未运行时为空
+func (s *Server) APIAddr() string {
+	s.api.mu.Lock()
+	defer s.api.mu.Unlock()
+
+	return s.api.addr
+}
+
+// APIHandler 创建管理接口的路由：
+//
+//	GET    /api/status        服务状态
+//	GET    /api/files         分享文件列表
+//	POST   /api/files         添加分享文件，请求体为 {"paths": ["/path/to/file"]}
+//	DELETE /api/files?path=   移除分享文件，也可用 name 参数指定文件名
+//	GET    /api/files/link?name=&ttl=  生成文件的签名下载链接，ttl如 1h，默认1小时
+//	POST   /api/server/start  启动服务，请求体可为 {"port": 1082}
+//	POST   /api/server/stop   停止服务
+//	GET    /ws                服务事件推送（WebSocket）
+func (s *Server) APIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/status", s.apiStatusHandler)
+	mux.HandleFunc("/api/files", s.apiFilesHandler)
+	mux.HandleFunc("/api/files/link", s.apiLinkHandler)
+	mux.HandleFunc("/api/server/start", s.apiStartHandler)
+	mux.HandleFunc("/api/server/stop", s.apiStopHandler)
+	mux.Handle("/ws", s.wsHandler(false))
+	return s.requireAPIKey(mux)
+}
+
+// requireAPIKey 校验请求附带的管理接口密钥
+func (s *Server) requireAPIKey(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.api.mu.Lock()
+		key := s.api.key
+		s.api.mu.Unlock()
+
+		got := r.Header.Get(apiKeyHeader)
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			got = bearer
+		}
+		if key == "" || subtle.ConstantTimeCompare([]byte(got), []byte(key)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pair-gui"`)
+			writeAPIError(w, http.StatusUnauthorized, "管理接口密钥无效")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// apiStatusHandler 返回服务状态
+func (s *Server) apiStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "仅支持GET方法")
+		return
+	}
+
+	status := APIStatus{
+		Running:         s.Running(),
+		Files:           len(s.Files()),
+		Dirs:            len(s.Dirs()),
+		ActiveTransfers: s.ActiveTransfers(),
+		UploadDir:       s.UploadDir(),
+	}
+	if status.Running {
+		s.mu.RLock()
+		status.Port = s.port
+		s.mu.RUnlock()
+		s.api.mu.Lock()
+		url := s.api.control.URL
+		s.api.mu.Unlock()
+		if url == nil {
+			url = s.localURL
+		}
+		status.URL = url()
+	}
+	writeAPIJSON(w, http.StatusOK, status)
+}
+
+// apiFilesHandler 列出、添加或移除分享文件
+func (s *Server) apiFilesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeAPIJSON(w, http.StatusOK, apiFiles(s.Files()))
+
+	case http.MethodPost:
+		var req struct {
+			Path  string   `json:"path"`
+			Paths []string `json:"paths"`
+		}
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		if req.Path != "" {
+			req.Paths = append(req.Paths, req.Path)
+		}
+		if len(req.Paths) == 0 {
+			writeAPIError(w, http.StatusBadRequest, "缺少paths参数")
+			return
+		}
+		// 全部文件校验通过后才添加，以免只添加了一部分
+		files := make([]File, 0, len(req.Paths))
+		for _, p := range req.Paths {
+			f, err := NewFile(p)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", p, err))
+				return
+			}
+			files = append(files, f)
+		}
+		added := s.AddFiles(files...)
+		s.apiFilesChanged()
+		writeAPIJSON(w, http.StatusCreated, apiFiles(added))
+
+	case http.MethodDelete:
+		query := r.URL.Query()
+		absPath, name := query.Get("path"), query.Get("name")
+		switch {
+		case absPath != "":
+			absPath, _ = filepath.Abs(absPath)
+		case name != "":
+			if f, ok := s.findFile(name); ok {
+				absPath = f.AbsPath
+			}
+		default:
+			writeAPIError(w, http.StatusBadRequest, "缺少path或name参数")
+			return
+		}
+		if absPath == "" || !s.hasFile(absPath) {
+			writeAPIError(w, http.StatusNotFound, "文件不在分享列表中")
+			return
+		}
+		s.RemoveFile(absPath)
+		s.apiFilesChanged()
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "仅支持GET、POST和DELETE方法")
+	}
+}
+
+// apiLinkHandler 为分享文件生成签名下载链接，服务未运行时返回409
+func (s *Server) apiLinkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "仅支持GET方法")
+		return
+	}
+	if !s.Running() {
+		writeAPIError(w, http.StatusConflict, ErrNotRunning.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	ttl := defaultLinkTTL
+	if v := query.Get("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeAPIError(w, http.StatusBadRequest, "ttl无效")
+			return
+		}
+		ttl = d
+	}
+	name := query.Get("name")
+	if _, found := s.findFile(name); !found {
+		writeAPIError(w, http.StatusNotFound, "文件不在分享列表中")
+		return
+	}
+
+	s.api.mu.Lock()
+	base := s.api.control.URL
+	s.api.mu.Unlock()
+	if base == nil {
+		base = s.localURL
+	}
+	link, err := s.SignedDownloadURL(base(), name, ttl)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]any{"url": link, "expires": time.Now().Add(ttl)})
+}
+
+// apiStartHandler 启动或重启服务
+func (s *Server) apiStartHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "仅支持POST方法")
+		return
+	}
+	var req struct {
+		Port int `json:"port"`
+	}
+	if r.ContentLength != 0 && !decodeAPIRequest(w, r, &req) {
+		return
+	}
+	if req.Port < 0 || req.Port > 65535 {
+		writeAPIError(w, http.StatusBadRequest, "端口无效")
+		return
+	}
+
+	s.api.mu.Lock()
+	start := s.api.control.Start
+	s.api.mu.Unlock()
+	if start == nil {
+		start = s.apiDefaultStart
+	}
+	url, err := start(req.Port)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, fmt.Sprintf("服务启动失败: %v", err))
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]string{"url": url})
+}
+
+// apiDefaultStart 未设置APIControl.Start时启动服务，port为0时使用上次的端口
+func (s *Server) apiDefaultStart(port int) (string, error) {
+	if port == 0 {
+		s.mu.RLock()
+		port = s.port
+		s.mu.RUnlock()
+	}
+	if port == 0 {
+		return "", errors.New("缺少port参数")
+	}
+	if err := s.Start(port); err != nil {
+		return "", err
+	}
+	return s.localURL(), nil
+}
+
+// localURL 返回使用本机局域网IP的访问地址
+func (s *Server) localURL() string {
+	host, err := LocalIP()
+	if err != nil {
+		host = "localhost"
+	}
+	return s.URL(host)
+}
+
+// apiStopHandler 停止服务，未运行时返回409
+func (s *Server) apiStopHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "仅支持POST方法")
+		return
+	}
+
+	s.api.mu.Lock()
+	stop := s.api.control.Stop
+	s.api.mu.Unlock()
+	if stop == nil {
+		stop = s.Stop
+	}
+	err := stop()
+	if errors.Is(err, ErrNotRunning) {
+		writeAPIError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, fmt.Sprintf("停止服务失败: %v", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiFilesChanged 通知程序分享文件列表已通过管理接口修改
+func (s *Server) apiFilesChanged() {
+	s.api.mu.Lock()
+	changed := s.api.control.FilesChanged
+	s.api.mu.Unlock()
+
+	if changed != nil {
+		changed()
+	}
+}
+
+// hasFile 判断文件是否在下载列表中
+func (s *Server) hasFile(absPath string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.hasFileLocked(absPath)
+}
+
+// apiFiles 将分享文件转换为管理接口返回的格式
+func apiFiles(files []File) []APIFile {
+	list := make([]APIFile, 0, len(files))
+	for _, f := range files {
+		af := APIFile{Name: f.Filename, Path: f.AbsPath, SizeKB: f.SizeKB, MimeType: f.MimeType, Modified: f.ModTime, Locked: f.Protected(),
+			Downloads: f.Downloads, MaxDownloads: f.MaxDownloads}
+		if !f.Expires.IsZero() {
+			af.Expires = &f.Expires
+		}
+		list = append(list, af)
+	}
+	return list
+}
+
+// decodeAPIRequest 解析JSON请求体，失败时返回400和false
+func decodeAPIRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxBody)).Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("解析请求失败: %v", err))
+		return false
+	}
+	return true
+}
+
+// writeAPIJSON 以JSON返回管理接口的结果
+func writeAPIJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError 以JSON返回管理接口的错误
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeAPIJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,115 @@
+package pairserver
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// UploadRequest 等待确认的上传
+type UploadRequest struct {
+	Filename  string `json:"filename"`
+	Size      int64  `json:"size"` // 文件大小，未知时为-1
+	IP        string `json:"client_ip"`
+	UserAgent string `json:"user_agent"`
+
+	untrusted bool // 来源无法按IP区分（如经中继的croc发送方），不按IP信任
+}
+
+// UploadApprover 询问是否接收上传，在处理请求的协程中调用，返回前不写入任何数据；
+// trust为true时本次服务运行期间自动接收该IP之后的上传
+type UploadApprover func(UploadRequest) (accept, trust bool)
+
+// approvalState 上传确认状态
+type approvalState struct {
+	mu       sync.Mutex
+	enabled  bool
+	approver UploadApprover
+	trusted  map[string]bool // 本次服务运行期间自动接收的客户端IP
+}
+
+// SetUploadApproval 设置是否在接收每个上传前询问；未设置询问回调时（如无界面模式）直接接收
+func (s *Server) SetUploadApproval(enabled bool) {
+	s.approval.mu.Lock()
+	defer s.approval.mu.Unlock()
+
+	s.approval.enabled = enabled
+}
+
+// SetUploadApprover 设置接收上传前的询问回调
+func (s *Server) SetUploadApprover(h UploadApprover) {
+	s.approval.mu.Lock()
+	defer s.approval.mu.Unlock()
+
+	s.approval.approver = h
+}
+
+// resetTrusted 清除信任的客户端，重新启动服务时调用
+func (s *Server) resetTrusted() {
+	s.approval.mu.Lock()
+	defer s.approval.mu.Unlock()
+
+	s.approval.trusted = nil
+}
+
+// approveRequest 请用户确认是否接收HTTP请求中的上传
+func (s *Server) approveRequest(r *http.Request, name string, size int64) bool {
+	return s.approveUpload(r.Context(), UploadRequest{Filename: name, Size: size, IP: clientIP(r), UserAgent: r.UserAgent()})
+}
+
+// approveUpload 先交给插件检查，再请用户确认是否接收上传，接收时发布上传开始的事件
+func (s *Server) approveUpload(ctx context.Context, req UploadRequest) bool {
+	if err := filterUpload(req); err != nil {
+		log.Printf("插件拒绝上传 %s: %v", req.Filename, err)
+		return false
+	}
+	if !s.askUpload(ctx, req) {
+		return false
+	}
+	s.publish(EventUploadStarted, req)
+	return true
+}
+
+// askUpload 请用户确认是否接收上传；未启用确认、客户端已被信任时直接接收，
+// 客户端断开或超时未确认视为拒绝。洋葱服务的访问者和经中继的发送方无法按IP区分，不会被信任
+func (s *Server) askUpload(ctx context.Context, req UploadRequest) bool {
+	trustable := req.IP != onionClientIP && !req.untrusted
+	s.approval.mu.Lock()
+	approver := s.approval.approver
+	skip := !s.approval.enabled || approver == nil || trustable && s.approval.trusted[req.IP]
+	s.approval.mu.Unlock()
+	if skip {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pushPromptTimeout)
+	defer cancel()
+	type answer struct{ accept, trust bool }
+	result := make(chan answer, 1)
+	go func() {
+		accept, trust := approver(req)
+		result <- answer{accept, trust}
+	}()
+
+	var a answer
+	select {
+	case a = <-result:
+	case <-ctx.Done():
+		return false
+	}
+	if a.accept && a.trust && trustable {
+		s.approval.mu.Lock()
+		if s.approval.trusted == nil {
+			s.approval.trusted = make(map[string]bool)
+		}
+		s.approval.trusted[req.IP] = true
+		s.approval.mu.Unlock()
+	}
+	return a.accept
+}
+
+// writeUploadDenied 返回上传被拒绝的说明
+func writeUploadDenied(w http.ResponseWriter, r *http.Request) {
+	writeUploadError(w, http.StatusForbidden, uploadError{Error: webStrings(r)["UploadDenied"]})
+}
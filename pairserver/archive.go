@@ -0,0 +1,131 @@
+package pairserver
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// archiveName 打包下载时的ZIP文件名
+const archiveName = "pair-gui-files.zip"
+
+// downloadAllHandler 将下载列表中的全部文件即时打包为ZIP流式返回，不生成临时文件
+func (s *Server) downloadAllHandler(w http.ResponseWriter, r *http.Request) {
+	files := s.unlockedFiles(r, s.activeFiles())
+	if len(files) == 0 {
+		http.Error(w, "暂无可下载文件", http.StatusNotFound)
+		return
+	}
+	s.serveZip(w, r, files)
+}
+
+// downloadSelectedHandler 将表单中选中的文件（可重复的file字段）打包为ZIP流式返回
+func (s *Server) downloadSelectedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("解析表单失败: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var files []File
+	for _, name := range r.PostForm["file"] {
+		f, found := s.findFile(name)
+		if !found {
+			s.writeNotFound(w, name)
+			return
+		}
+		if !s.requireFilePassword(w, r, f, false) {
+			return
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		http.Error(w, "未选择文件", http.StatusBadRequest)
+		return
+	}
+	s.serveZip(w, r, files)
+}
+
+// serveZip 将文件逐个写入ZIP流返回；响应头发出后出错只能中断连接，客户端会得到不完整的压缩包。
+// 客户端断开后立即停止读取剩余的文件
+func (s *Server) serveZip(w http.ResponseWriter, r *http.Request, files []File) {
+	slot, ok := s.reserveDownload(files...)
+	if !ok {
+		http.Error(w, "文件的下载次数已用完", http.StatusGone)
+		return
+	}
+	defer slot.finish(false)
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", archiveName))
+
+	zw := zip.NewWriter(w)
+	names := make(map[string]bool)
+	for _, f := range files {
+		if err := s.addToZip(r.Context(), zw, f, uniqueEntryName(names, f.Filename)); err != nil {
+			if r.Context().Err() != nil {
+				panic(http.ErrAbortHandler)
+			}
+			log.Printf("打包文件失败: %s: %v", f.AbsPath, err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("写入压缩包失败: %v", err)
+		return
+	}
+	slot.finish(true)
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.AbsPath
+	}
+	s.markServed(paths...)
+}
+
+// addToZip 将单个文件以name为条目名写入ZIP，ctx结束时中止
+func (s *Server) addToZip(ctx context.Context, zw *zip.Writer, f File, name string) error {
+	file, err := os.Open(f.AbsPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	entry, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, newRateLimitedReader(ctx, file, s.RateLimit()))
+	return err
+}
+
+// uniqueEntryName 返回压缩包内不重复的条目名，不同目录下的同名文件追加序号，如 a (1).txt
+func uniqueEntryName(used map[string]bool, name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	unique := name
+	for i := 1; used[unique]; i++ {
+		unique = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	used[unique] = true
+	return unique
+}
@@ -0,0 +1,258 @@
+package pairserver
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"math/big"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Cookie名称
+const (
+	sessionCookie = "pair_session" // PIN验证通过后的会话
+	tokenCookie   = "pair_token"   // 访问令牌
+)
+
+// PIN码错误次数限制
+const (
+	maxPINAttempts = 5           // 允许连续输错的次数
+	pinLockout     = time.Minute // 输错过多后的锁定时间
+)
+
+// authState 访问控制状态
+type authState struct {
+	mu       sync.Mutex
+	pin      string                  // PIN码，空表示不需要
+	useToken bool                    // 是否要求访问令牌
+	token    string                  // 本次服务的访问令牌，服务启动时生成
+	code     string                  // 本次服务的配对码，服务启动时生成
+	sessions map[string]bool         // 已通过验证的会话
+	failures map[string]*pinFailures // 按客户端IP统计的PIN输错次数
+
+	codeFailures int       // 当前时段内全部客户端输错配对码的次数
+	codeReset    time.Time // 配对码输错次数清零的时间
+}
+
+// pinFailures 客户端PIN输错记录
+type pinFailures struct {
+	count int
+	until time.Time
+}
+
+// GeneratePIN 生成指定位数的随机数字PIN码
+func GeneratePIN(digits int) string {
+	pin := make([]byte, digits)
+	for i := range pin {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			panic(err)
+		}
+		pin[i] = byte('0' + n.Int64())
+	}
+	return string(pin)
+}
+
+// SetPIN 设置访问PIN码，空字符串表示关闭PIN保护；修改PIN后已有会话全部失效
+func (s *Server) SetPIN(pin string) {
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+
+	if pin != s.auth.pin {
+		s.auth.sessions = make(map[string]bool)
+	}
+	s.auth.pin = pin
+}
+
+// PIN 返回当前的访问PIN码
+func (s *Server) PIN() string {
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+
+	return s.auth.pin
+}
+
+// SetRequireToken 设置是否要求访问令牌；启用后每次启动服务都会生成新的令牌并附加到URL中
+func (s *Server) SetRequireToken(enabled bool) {
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+
+	s.auth.useToken = enabled
+	if !enabled {
+		s.auth.token = ""
+	}
+}
+
+// Token 返回本次服务的访问令牌，未启用时为空
+func (s *Server) Token() string {
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+
+	return s.auth.token
+}
+
+// resetToken 服务启动时生成新的访问令牌，旧令牌随之失效
+func (s *Server) resetToken() {
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+
+	s.auth.token = ""
+	if s.auth.useToken {
+		s.auth.token = newSessionID()
+	}
+}
+
+// validToken 判断请求携带的令牌（查询参数或Cookie）是否有效
+func (s *Server) validToken(r *http.Request) (ok bool, fromQuery bool) {
+	s.auth.mu.Lock()
+	token := s.auth.token
+	s.auth.mu.Unlock()
+
+	if token == "" {
+		return true, false
+	}
+	if q := r.URL.Query().Get("token"); q != "" {
+		return subtle.ConstantTimeCompare([]byte(q), []byte(token)) == 1, true
+	}
+	c, err := r.Cookie(tokenCookie)
+	return err == nil && subtle.ConstantTimeCompare([]byte(c.Value), []byte(token)) == 1, false
+}
+
+// requireToken 访问令牌中间件：令牌无效时返回403；通过URL携带令牌时写入Cookie，
+// 页面请求再跳转到去掉令牌的地址，之后的请求凭Cookie访问
+func (s *Server) requireToken(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, fromQuery := s.validToken(r)
+		if !ok {
+			http.Error(w, "访问令牌无效，请重新扫描二维码", http.StatusForbidden)
+			return
+		}
+		if fromQuery {
+			http.SetCookie(w, &http.Cookie{
+				Name:     tokenCookie,
+				Value:    r.URL.Query().Get("token"),
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+			if r.Method == http.MethodGet {
+				u := *r.URL
+				q := u.Query()
+				q.Del("token")
+				u.RawQuery = q.Encode()
+				http.Redirect(w, r, s.sitePath(u.RequestURI()), http.StatusSeeOther)
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+// authorized 判断请求是否已通过验证
+func (s *Server) authorized(r *http.Request) bool {
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+
+	if s.auth.pin == "" {
+		return true
+	}
+	c, err := r.Cookie(sessionCookie)
+	return err == nil && s.auth.sessions[c.Value]
+}
+
+// checkPIN 校验PIN码，正确时创建新会话并返回会话ID；输错过多时locked为true
+func (s *Server) checkPIN(r *http.Request, pin string) (session string, locked bool) {
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+
+	ok, locked := s.matchPIN(clientIP(r), pin)
+	if !ok {
+		return "", locked
+	}
+	session = newSessionID()
+	if s.auth.sessions == nil {
+		s.auth.sessions = make(map[string]bool)
+	}
+	s.auth.sessions[session] = true
+	return session, false
+}
+
+// verifyPIN 校验客户端ip提交的PIN码而不创建会话，用于WebDAV基本认证和FTP登录
+func (s *Server) verifyPIN(ip, pin string) (ok, locked bool) {
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+
+	return s.matchPIN(ip, pin)
+}
+
+// matchPIN 比较PIN码并统计客户端的输错次数，调用时须持有s.auth.mu
+func (s *Server) matchPIN(ip, pin string) (ok, locked bool) {
+	return s.matchSecret(ip, pin, s.auth.pin)
+}
+
+// matchSecret 比较客户端提交的密码并统计输错次数，输错过多时锁定一段时间，调用时须持有s.auth.mu
+func (s *Server) matchSecret(ip, got, want string) (ok, locked bool) {
+	if s.auth.failures == nil {
+		s.auth.failures = make(map[string]*pinFailures)
+	}
+	f := s.auth.failures[ip]
+	if f != nil && time.Now().Before(f.until) {
+		return false, true
+	}
+
+	if subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+		if f == nil {
+			f = &pinFailures{}
+			s.auth.failures[ip] = f
+		}
+		f.count++
+		if f.count >= maxPINAttempts {
+			f.count = 0
+			f.until = time.Now().Add(pinLockout)
+		}
+		return false, false
+	}
+
+	delete(s.auth.failures, ip)
+	return true, false
+}
+
+// requireAuth 访问控制中间件：页面请求未验证时显示PIN输入页，接口请求返回401
+func (s *Server) requireAuth(h http.HandlerFunc, page bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.authorized(r) {
+			h(w, r)
+			return
+		}
+		if page {
+			s.pinPage(w, r, "")
+			return
+		}
+		http.Error(w, "需要输入PIN码", http.StatusUnauthorized)
+	}
+}
+
+// newSessionID 生成随机会话ID
+func newSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// clientIP 返回请求的客户端IP，通过洋葱服务访问时返回onionClientIP
+func clientIP(r *http.Request) string {
+	if viaOnion(r) {
+		return onionClientIP
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,78 @@
+package pairserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SetBasicAuth 设置所有请求都要求的HTTP基本认证用户名和密码，密码为空表示不启用。
+// 启用后WebDAV和FTP同样使用该用户名和密码登录，不再使用PIN码
+func (s *Server) SetBasicAuth(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.basicUser, s.basicPass = username, password
+}
+
+// BasicAuth 返回HTTP基本认证的用户名和密码，密码为空表示未启用
+func (s *Server) BasicAuth() (username, password string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.basicUser, s.basicPass
+}
+
+// basicAuthExempt 不要求基本认证的路径前缀：设备之间直接传输有各自的确认流程，
+// 文件夹同步以同步密钥验证。DLNA播放器无法输入密码，启用基本认证时不提供DLNA
+var basicAuthExempt = []string{"/push/", "/sync/", localSendAPI}
+
+// checkBasicAuth 校验客户端ip提交的用户名和密码，与PIN码共用输错次数限制；
+// 用户名和密码一起比较，用户名错误同样计入输错次数
+func (s *Server) checkBasicAuth(ip, username, password string) (ok, locked bool) {
+	wantUser, wantPass := s.BasicAuth()
+
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+
+	return s.matchSecret(ip, basicCredential(username, password), basicCredential(wantUser, wantPass))
+}
+
+// basicCredential 将用户名和密码编码为一个字符串用于比较，用户名带长度前缀，
+// 含冒号的用户名不会与其他组合混淆
+func basicCredential(username, password string) string {
+	return fmt.Sprintf("%d:%s:%s", len(username), username, password)
+}
+
+// requireBasicAuth 启用基本认证时校验每个请求的用户名和密码，失败时返回401由浏览器弹出登录框
+func (s *Server) requireBasicAuth(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, password := s.BasicAuth(); password == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		for _, prefix := range basicAuthExempt {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		// 浏览器首次请求不带用户名和密码，只返回401弹出登录框，不计入输错次数
+		username, password, sent := r.BasicAuth()
+		ok, locked := false, false
+		if sent {
+			ok, locked = s.checkBasicAuth(clientIP(r), username, password)
+		}
+		if locked {
+			http.Error(w, "密码输错次数过多，请稍后再试", http.StatusTooManyRequests)
+			return
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="pair-gui", charset="UTF-8"`)
+			http.Error(w, "需要输入用户名和密码", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,47 @@
+package pairserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestCheckBasicAuth 用户名和密码须同时正确，用户名错误同样计入输错次数
+func TestCheckBasicAuth(t *testing.T) {
+	s := New()
+	s.SetBasicAuth("alice", "b:c")
+
+	tests := []struct {
+		user, pass string
+		want       bool
+	}{
+		{"alice", "b:c", true},
+		{"alice", "wrong", false},
+		{"bob", "b:c", false},
+		{"alice:b", "c", false},
+		{"", "alice:b:c", false},
+	}
+	for _, tt := range tests {
+		if ok, _ := s.checkBasicAuth("10.0.0.1", tt.user, tt.pass); ok != tt.want {
+			t.Errorf("checkBasicAuth(%q, %q) = %v，应为 %v", tt.user, tt.pass, ok, tt.want)
+		}
+	}
+
+	for range maxPINAttempts {
+		s.checkBasicAuth("10.0.0.2", "bob", "b:c")
+	}
+	if ok, locked := s.checkBasicAuth("10.0.0.2", "alice", "b:c"); ok || !locked {
+		t.Errorf("用户名连续输错后应被锁定，实际为 ok=%v locked=%v", ok, locked)
+	}
+}
+
+// TestBasicAuthDLNA 启用基本认证时DLNA接口同样要求认证
+func TestBasicAuthDLNA(t *testing.T) {
+	s := New()
+	s.SetBasicAuth("alice", "secret")
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, dlnaPrefix+"device.xml", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("未认证的DLNA请求返回 %d，应为401", w.Code)
+	}
+}
@@ -0,0 +1,88 @@
+package pairserver
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+)
+
+// 网页的品牌定制：在办公室或教室部署时，各页面顶部显示自己的名称和Logo，
+// 标签页标题带上该名称，按钮等处使用自己的主题色
+const maxBrandLogoSize = 1 << 20 // Logo图片的最大字节数
+
+// accentPattern 主题色的格式：#rrggbb或#rgb
+var accentPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}){1,2}$`)
+
+// Branding 网页的品牌定制，各项为空时使用默认值
+type Branding struct {
+	Title  string // 显示在页面顶部和标签页标题中的名称
+	Logo   string // Logo图片路径，支持PNG、JPEG、GIF和WebP
+	Accent string // 主题色，格式为#rrggbb
+}
+
+// brandState 生效的品牌定制和已读取的Logo
+type brandState struct {
+	Branding
+	logo     []byte
+	logoType string
+	loaded   time.Time
+}
+
+// SetBranding 设置网页的品牌定制。主题色格式无效或Logo无法读取时返回错误，原有设置不变
+func (s *Server) SetBranding(b Branding) error {
+	if b.Accent != "" && !accentPattern.MatchString(b.Accent) {
+		return fmt.Errorf("无效的主题色: %s", b.Accent)
+	}
+	state := brandState{Branding: b, loaded: time.Now()}
+	if b.Logo != "" {
+		data, err := os.ReadFile(b.Logo)
+		if err != nil {
+			return err
+		}
+		if len(data) > maxBrandLogoSize {
+			return fmt.Errorf("Logo图片超过 %s", formatSize(maxBrandLogoSize))
+		}
+		// SVG可能包含脚本，不作为同源图片提供
+		switch state.logoType = http.DetectContentType(data); state.logoType {
+		case "image/png", "image/jpeg", "image/gif", "image/webp":
+		default:
+			return fmt.Errorf("不支持的Logo格式: %s", state.logoType)
+		}
+		state.logo = data
+	}
+
+	s.mu.Lock()
+	s.brand = state
+	s.mu.Unlock()
+	return nil
+}
+
+// branding 返回生效的品牌定制
+func (s *Server) branding() brandState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.brand
+}
+
+// accentColor 返回页面的主题色，未设置时为默认的蓝色
+func (s *Server) accentColor() string {
+	if accent := s.branding().Accent; accent != "" {
+		return accent
+	}
+	return pwaThemeColor
+}
+
+// brandLogoHandler 返回品牌Logo，未设置时返回404。PIN码页面也会显示，因此无需验证
+func (s *Server) brandLogoHandler(w http.ResponseWriter, r *http.Request) {
+	brand := s.branding()
+	if brand.logo == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", brand.logoType)
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "", brand.loaded, bytes.NewReader(brand.logo))
+}
@@ -0,0 +1,55 @@
+package pairserver
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"strings"
+)
+
+// statusChecksumMismatch tus协议规定的校验和不匹配状态码
+const statusChecksumMismatch = 460
+
+// checksumAlgorithms 支持的分块校验算法；浏览器在非HTTPS页面无法使用crypto.subtle，
+// 此时上传页面使用crc32
+var checksumAlgorithms = []string{"sha256", "sha1", "crc32"}
+
+// chunkChecksum 分块的期望校验和及计算中的哈希
+type chunkChecksum struct {
+	hash     hash.Hash
+	expected []byte
+}
+
+// parseChecksum 解析Upload-Checksum请求头，格式为“算法 base64校验和”
+func parseChecksum(header string) (*chunkChecksum, error) {
+	algo, value, ok := strings.Cut(strings.TrimSpace(header), " ")
+	if !ok {
+		return nil, errors.New("无效的Upload-Checksum")
+	}
+	expected, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("无效的Upload-Checksum")
+	}
+
+	var h hash.Hash
+	switch algo {
+	case "sha256":
+		h = sha256.New()
+	case "sha1":
+		h = sha1.New()
+	case "crc32":
+		h = crc32.NewIEEE()
+	default:
+		return nil, errors.New("不支持的校验算法: " + algo)
+	}
+	return &chunkChecksum{hash: h, expected: expected}, nil
+}
+
+// match 返回已写入数据的校验和是否与期望值一致
+func (c *chunkChecksum) match() bool {
+	return bytes.Equal(c.hash.Sum(nil), c.expected)
+}
@@ -0,0 +1,195 @@
+package pairserver
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// 客户端记录参数
+const (
+	deviceCookie       = "pair_device" // 手机自己设置的设备名称，保存在手机浏览器中
+	maxDeviceName      = 40            // 设备名称的最大字符数
+	maxClientHistory   = 50            // 每个客户端保留的传输记录数
+	deviceCookieMaxAge = 365 * 24 * 60 * 60
+)
+
+// ClientTransfer 客户端完成或中断的一次传输
+type ClientTransfer struct {
+	Direction TransferDirection
+	Filename  string
+	Bytes     int64 // 实际传输的字节数
+	Time      time.Time
+}
+
+// clientInfo 客户端的名称、浏览器和传输记录
+type clientInfo struct {
+	userAgent  string
+	selfName   string // 手机在网页中设置的名称
+	uploaded   int64
+	downloaded int64
+	history    []ClientTransfer
+}
+
+// clientRegistry 按IP记录的客户端信息
+type clientRegistry struct {
+	mu    sync.Mutex
+	info  map[string]*clientInfo
+	names map[string]string // 在电脑上为客户端设置的名称，优先于手机自己设置的名称
+}
+
+// get 返回IP对应的客户端信息，调用方需持有锁
+func (c *clientRegistry) get(ip string) *clientInfo {
+	if c.info == nil {
+		c.info = make(map[string]*clientInfo)
+	}
+	info, ok := c.info[ip]
+	if !ok {
+		info = &clientInfo{}
+		c.info[ip] = info
+	}
+	return info
+}
+
+// seen 记录请求的浏览器和手机设置的设备名称，返回是否为首次访问的客户端
+func (c *clientRegistry) seen(r *http.Request) bool {
+	ip := clientIP(r)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, known := c.info[ip]
+	info := c.get(ip)
+	if ua := r.UserAgent(); ua != "" {
+		info.userAgent = ua
+	}
+	if cookie, err := r.Cookie(deviceCookie); err == nil {
+		if name, err := url.QueryUnescape(cookie.Value); err == nil {
+			info.selfName = cleanDeviceName(name)
+		}
+	}
+	return !known
+}
+
+// record 记录客户端的一次传输
+func (c *clientRegistry) record(ip string, t ClientTransfer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info := c.get(ip)
+	if t.Direction == TransferUpload {
+		info.uploaded += t.Bytes
+	} else {
+		info.downloaded += t.Bytes
+	}
+	info.history = append(info.history, t)
+	if len(info.history) > maxClientHistory {
+		info.history = info.history[len(info.history)-maxClientHistory:]
+	}
+}
+
+// fill 将客户端信息填入Client
+func (c *clientRegistry) fill(client *Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	client.Name = c.names[client.IP]
+	info, ok := c.info[client.IP]
+	if !ok {
+		return
+	}
+	if client.Name == "" {
+		client.Name = info.selfName
+	}
+	client.UserAgent = info.userAgent
+	client.Device = DeviceType(info.userAgent)
+	client.Uploaded = info.uploaded
+	client.Downloaded = info.downloaded
+	client.History = append([]ClientTransfer(nil), info.history...)
+}
+
+// SetClientNames 设置在电脑上为客户端IP指定的名称
+func (s *Server) SetClientNames(names map[string]string) {
+	s.clients.mu.Lock()
+	defer s.clients.mu.Unlock()
+
+	s.clients.names = make(map[string]string, len(names))
+	for ip, name := range names {
+		if name = cleanDeviceName(name); name != "" {
+			s.clients.names[ip] = name
+		}
+	}
+}
+
+// ClientName 返回客户端IP的名称：优先使用电脑上指定的名称，其次为手机自己设置的名称，都没有时为空
+func (s *Server) ClientName(ip string) string {
+	client := Client{IP: ip}
+	s.clients.fill(&client)
+	return client.Name
+}
+
+// DeviceType 根据User-Agent返回简短的设备类型，如iPhone、Android、Windows
+func DeviceType(userAgent string) string {
+	types := []struct{ key, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"HarmonyOS", "HarmonyOS"},
+		{"Windows", "Windows"},
+		{"Macintosh", "Mac"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+		{"FTP", "FTP"},
+		{"LocalSend", "LocalSend"},
+		{"pair-gui", "pair-gui"},
+	}
+	for _, t := range types {
+		if strings.Contains(userAgent, t.key) {
+			return t.name
+		}
+	}
+	return ""
+}
+
+// cleanDeviceName 去掉设备名称首尾空白和控制字符，并限制长度
+func cleanDeviceName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(name))
+	for utf8.RuneCountInString(name) > maxDeviceName {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+// deviceNameHandler 手机为自己设置设备名称：保存在Cookie中，电脑端的设备列表显示该名称
+func (s *Server) deviceNameHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.checkCSRF(w, r) {
+		return
+	}
+	name := cleanDeviceName(r.FormValue("name"))
+	http.SetCookie(w, &http.Cookie{
+		Name:     deviceCookie,
+		Value:    url.QueryEscape(name),
+		Path:     "/",
+		MaxAge:   deviceCookieMaxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	s.clients.mu.Lock()
+	s.clients.get(clientIP(r)).selfName = name
+	s.clients.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,149 @@
+package pairserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// clipboardPollTimeout 剪贴板长轮询的最长等待时间
+const clipboardPollTimeout = 25 * time.Second
+
+// ClipboardHandler 手机端剪贴板变化时调用，在处理请求的协程中执行
+type ClipboardHandler func(text string)
+
+// clipboardState 电脑与手机之间同步的剪贴板内容
+type clipboardState struct {
+	mu      sync.Mutex
+	enabled bool
+	text    string
+	version int64         // 每次变化加1，网页据此判断是否有新内容
+	changed chan struct{} // 内容变化时关闭并替换，用于唤醒等待中的长轮询
+	handler ClipboardHandler
+}
+
+// clipboardSnapshot 返回给网页的剪贴板内容
+type clipboardSnapshot struct {
+	Text    string `json:"text"`
+	Version int64  `json:"version"`
+}
+
+// SetClipboardSync 开启或关闭剪贴板同步，关闭时清空已同步的内容
+func (s *Server) SetClipboardSync(enabled bool) {
+	s.clipboard.mu.Lock()
+	defer s.clipboard.mu.Unlock()
+
+	s.clipboard.enabled = enabled
+	if !enabled {
+		s.clipboard.text = ""
+	}
+}
+
+// ClipboardSync 返回是否开启了剪贴板同步
+func (s *Server) ClipboardSync() bool {
+	s.clipboard.mu.Lock()
+	defer s.clipboard.mu.Unlock()
+
+	return s.clipboard.enabled
+}
+
+// SetClipboardHandler 设置手机端剪贴板变化时的回调
+func (s *Server) SetClipboardHandler(h ClipboardHandler) {
+	s.clipboard.mu.Lock()
+	defer s.clipboard.mu.Unlock()
+
+	s.clipboard.handler = h
+}
+
+// SetClipboard 更新电脑端的剪贴板内容，正在等待的手机网页会立即收到；内容未变化或未开启同步时忽略
+func (s *Server) SetClipboard(text string) {
+	s.updateClipboard(text)
+}
+
+// updateClipboard 更新剪贴板内容并唤醒长轮询，返回内容是否发生变化
+func (s *Server) updateClipboard(text string) bool {
+	c := &s.clipboard
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.enabled || text == c.text {
+		return false
+	}
+	c.text = text
+	c.version++
+	if c.changed != nil {
+		close(c.changed)
+		c.changed = nil
+	}
+	return true
+}
+
+// clipboardSnapshot 返回当前内容，以及内容未超过since版本时用于等待变化的通道
+func (s *Server) clipboardSnapshot(since int64) (clipboardSnapshot, <-chan struct{}, bool) {
+	c := &s.clipboard
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snap := clipboardSnapshot{Text: c.text, Version: c.version}
+	if !c.enabled || c.version > since {
+		return snap, nil, c.enabled
+	}
+	if c.changed == nil {
+		c.changed = make(chan struct{})
+	}
+	return snap, c.changed, true
+}
+
+// clipboardHandler 剪贴板同步接口：GET按since参数长轮询等待新内容，POST提交手机端的text字段
+func (s *Server) clipboardHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		since, _ := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+		snap, wait, enabled := s.clipboardSnapshot(since)
+		if !enabled {
+			http.Error(w, "剪贴板同步未开启", http.StatusNotFound)
+			return
+		}
+		if wait != nil {
+			timer := time.NewTimer(clipboardPollTimeout)
+			defer timer.Stop()
+			select {
+			case <-wait:
+				snap, _, _ = s.clipboardSnapshot(since)
+			case <-timer.C:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(snap)
+	case http.MethodPost:
+		if !s.checkCSRF(w, r) {
+			return
+		}
+		if !s.ClipboardSync() {
+			http.Error(w, "剪贴板同步未开启", http.StatusNotFound)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxTextLength+1024)
+		text := r.FormValue("text")
+		if len(text) > maxTextLength {
+			http.Error(w, "文本过长", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if s.updateClipboard(text) {
+			s.clipboard.mu.Lock()
+			handler := s.clipboard.handler
+			s.clipboard.mu.Unlock()
+			if handler != nil {
+				handler(text)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+	}
+}
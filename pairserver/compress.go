@@ -0,0 +1,183 @@
+package pairserver
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// minCompressSize 小于该大小(字节)的响应不压缩，压缩后的体积和耗时都不划算
+const minCompressSize = 1024
+
+// compressibleTypes 除text/*外值得压缩的内容类型，图片、音视频和压缩包本身已压缩，不在其中
+var compressibleTypes = map[string]bool{
+	"application/json":       true,
+	"application/javascript": true,
+	"application/xml":        true,
+	"application/x-tar":      true,
+	"application/x-sh":       true,
+	"application/sql":        true,
+	"application/x-yaml":     true,
+	"application/toml":       true,
+	"image/svg+xml":          true,
+	"image/bmp":              true,
+}
+
+// textExtensions mime.TypeByExtension可能无法识别的文本类文件扩展名，如日志和源代码
+var textExtensions = map[string]bool{
+	".log": true, ".txt": true, ".md": true, ".csv": true, ".tsv": true,
+	".ini": true, ".conf": true, ".cfg": true, ".toml": true, ".yaml": true, ".yml": true,
+	".go": true, ".c": true, ".h": true, ".cpp": true, ".hpp": true, ".py": true, ".rs": true,
+	".java": true, ".kt": true, ".ts": true, ".sql": true, ".diff": true, ".patch": true,
+}
+
+// gzipWriters 复用gzip压缩器，避免每个请求重新分配压缩窗口
+var gzipWriters = sync.Pool{New: func() any {
+	// 局域网带宽较高，选择最快的压缩级别，避免CPU成为下载瓶颈
+	gz, _ := gzip.NewWriterLevel(nil, gzip.BestSpeed)
+	return gz
+}}
+
+// compress 按请求的Accept-Encoding对页面和文本类文件的响应进行gzip压缩，
+// 图片、音视频等已压缩的内容以及断点续传的部分响应原样返回
+func compress(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			h(w, r)
+			return
+		}
+		cw := &compressResponseWriter{ResponseWriter: w}
+		defer cw.close()
+		h(cw, r)
+	}
+}
+
+// acceptsGzip 判断客户端是否接受gzip编码，q=0表示明确拒绝
+func acceptsGzip(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressible 判断响应是否值得压缩；下载接口统一使用application/octet-stream，
+// 此时按Content-Disposition中的文件名判断
+func compressible(header http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if mediaType == "application/octet-stream" {
+		_, params, err := mime.ParseMediaType(header.Get("Content-Disposition"))
+		if err != nil {
+			return false
+		}
+		ext := strings.ToLower(path.Ext(params["filename"]))
+		if textExtensions[ext] {
+			return true
+		}
+		mediaType, _, _ = mime.ParseMediaType(mime.TypeByExtension(ext))
+	}
+	return strings.HasPrefix(mediaType, "text/") || compressibleTypes[mediaType] ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// compressResponseWriter 在写出响应头时决定是否压缩：只压缩足够大的完整(200)响应，
+// 未设置Content-Type的页面按第一次写入的内容推测类型
+type compressResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	decided bool
+	gz      *gzip.Writer
+}
+
+// WriteHeader 记录状态码；200且尚未确定内容类型时推迟到第一次写入再决定
+func (w *compressResponseWriter) WriteHeader(code int) {
+	if w.decided || w.status != 0 {
+		return
+	}
+	w.status = code
+	if code != http.StatusOK || w.Header().Get("Content-Type") != "" {
+		w.decide(nil)
+	}
+}
+
+// Write 压缩时写入gzip压缩器，否则直接写出
+func (w *compressResponseWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.decide(p)
+	}
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide 确定是否压缩并写出响应头；压缩后长度未知且字节范围不再对应，
+// 因此去掉Content-Length和Accept-Ranges，ETag改为弱校验
+func (w *compressResponseWriter) decide(p []byte) {
+	w.decided = true
+	header := w.Header()
+	if header.Get("Content-Type") == "" && len(p) > 0 {
+		header.Set("Content-Type", http.DetectContentType(p))
+	}
+	size, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if w.status == http.StatusOK && header.Get("Content-Encoding") == "" &&
+		(err != nil || size >= minCompressSize) && compressible(header) {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		w.gz = gzipWriters.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// Flush 先刷新压缩器中缓存的数据，供流式响应使用
+func (w *compressResponseWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.decide(nil)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// close 结束压缩流并归还压缩器
+func (w *compressResponseWriter) close() {
+	if !w.decided && w.status != 0 {
+		w.decide(nil)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		w.gz.Reset(nil)
+		gzipWriters.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+// Unwrap 供http.ResponseController访问原始的ResponseWriter
+func (w *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
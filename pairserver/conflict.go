@@ -0,0 +1,173 @@
+package pairserver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConflictPolicy 上传文件与已有文件重名时的处理方式
+type ConflictPolicy string
+
+// 重名处理方式
+const (
+	ConflictRename    ConflictPolicy = "rename"    // 自动重命名，追加序号，如 a (1).txt
+	ConflictOverwrite ConflictPolicy = "overwrite" // 覆盖已有文件
+	ConflictReject    ConflictPolicy = "reject"    // 拒绝上传
+	ConflictAsk       ConflictPolicy = "ask"       // 逐个询问，未设置询问回调时自动重命名
+)
+
+// ErrFileExists 上传的文件已存在且重名策略为拒绝
+var ErrFileExists = errors.New("文件已存在")
+
+// ConflictHandler 询问重名文件的处理方式，返回ConflictRename、ConflictOverwrite或ConflictReject；
+// 在处理上传请求的协程中调用，返回前上传请求保持等待
+type ConflictHandler func(name string) ConflictPolicy
+
+// SetConflictPolicy 设置上传文件重名时的处理方式
+func (s *Server) SetConflictPolicy(policy ConflictPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conflictPolicy = policy
+}
+
+// ConflictPolicy 返回上传文件重名时的处理方式
+func (s *Server) ConflictPolicy() ConflictPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.conflictPolicy
+}
+
+// SetConflictHandler 设置重名策略为ConflictAsk时使用的询问回调
+func (s *Server) SetConflictHandler(h ConflictHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conflictHandler = h
+}
+
+// saveAs 按重名策略确定上传文件在dir中的保存路径并调用save写入；
+// 确定路径和写入之间加锁，避免同名文件同时上传时选中同一个新名字
+func (s *Server) saveAs(dir, name string, save func(path string) error) error {
+	path := filepath.Join(dir, name)
+
+	s.mu.RLock()
+	policy, ask := s.conflictPolicy, s.conflictHandler
+	s.mu.RUnlock()
+
+	if policy == ConflictAsk {
+		policy = ConflictRename
+		if ask != nil && fileExists(path) {
+			policy = ask(name)
+		}
+	}
+
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	if fileExists(path) {
+		switch policy {
+		case ConflictReject:
+			return ErrFileExists
+		case ConflictOverwrite:
+		default:
+			path = uniquePath(dir, name)
+		}
+	}
+	return save(path)
+}
+
+// uploadFile 按重名策略新建的上传文件。覆盖已有文件时先写入partialDir中的临时文件，
+// commit后才改名替换原文件，上传失败或被取消时原文件保持不变
+type uploadFile struct {
+	*os.File
+	path string // 最终保存的路径；与File.Name()不同时写入的是临时文件
+}
+
+// createUpload 按重名策略确定dir中name的保存路径并新建文件，返回的文件写入完成后须调用commit或abort
+func (s *Server) createUpload(dir, name string) (*uploadFile, error) {
+	var f *uploadFile
+	err := s.saveAs(dir, name, func(path string) error {
+		if !fileExists(path) {
+			out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+			if err != nil {
+				return err
+			}
+			f = &uploadFile{File: out, path: path}
+			return nil
+		}
+		tmpDir := filepath.Join(s.UploadDir(), partialDir)
+		if err := os.MkdirAll(tmpDir, 0o755); err != nil {
+			return err
+		}
+		tmp, err := os.CreateTemp(tmpDir, "overwrite-*.part")
+		if err != nil {
+			return err
+		}
+		// 替换后保留原文件的权限
+		if info, err := os.Stat(path); err == nil {
+			tmp.Chmod(info.Mode().Perm())
+		}
+		f = &uploadFile{File: tmp, path: path}
+		return nil
+	})
+	return f, err
+}
+
+// overwrites 返回写入的是否为覆盖已有文件的临时文件
+func (f *uploadFile) overwrites() bool {
+	return f.Name() != f.path
+}
+
+// commit 关闭文件；写入的是临时文件时改名替换原文件
+func (f *uploadFile) commit() error {
+	if err := f.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		f.abort()
+		return err
+	}
+	if !f.overwrites() {
+		return nil
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// abort 关闭并删除写入的文件；覆盖时删除的是临时文件，原文件不受影响
+func (f *uploadFile) abort() {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// rejectsExisting 返回name在dir中已存在且重名策略为拒绝，用于在接收数据前提前拒绝
+func (s *Server) rejectsExisting(dir, name string) bool {
+	return s.ConflictPolicy() == ConflictReject && fileExists(filepath.Join(dir, name))
+}
+
+// uniquePath 在文件名后追加序号，返回dir中不存在的路径；追加后超过文件名长度限制时先缩短序号前的部分
+func uniquePath(dir, name string) string {
+	ext := filepath.Ext(name)
+	if len(ext) > maxFilenameBytes/4 {
+		ext = ""
+	}
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		suffix := fmt.Sprintf(" (%d)%s", i, ext)
+		path := filepath.Join(dir, truncateUTF8(base, maxFilenameBytes-len(suffix))+suffix)
+		if !fileExists(path) {
+			return path
+		}
+	}
+}
+
+// fileExists 返回路径是否已存在
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
@@ -0,0 +1,91 @@
+package pairserver
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// TestUniquePath 追加序号后的文件名不超过长度限制，缩短时不截断多字节字符并保留扩展名
+func TestUniquePath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string // 第一次追加序号后的文件名
+	}{
+		{"a.txt", "a (1).txt"},
+		{strings.Repeat("a", 251) + ".txt", strings.Repeat("a", 247) + " (1).txt"},
+		{strings.Repeat("照", 83) + ".txt", strings.Repeat("照", 82) + " (1).txt"},
+		{strings.Repeat("b", 255), strings.Repeat("b", 251) + " (1)"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, tt.name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got := filepath.Base(uniquePath(dir, tt.name))
+		if got != tt.want {
+			t.Errorf("uniquePath(%q) = %q，应为 %q", tt.name, got, tt.want)
+		}
+		if err := os.WriteFile(filepath.Join(dir, got), nil, 0o644); err != nil {
+			t.Fatalf("无法创建 %q: %v", got, err)
+		}
+		next := filepath.Base(uniquePath(dir, tt.name))
+		if len(next) > maxFilenameBytes || !utf8.ValidString(next) || next == got {
+			t.Errorf("第二次追加序号得到 %q（%d字节）", next, len(next))
+		}
+	}
+}
+
+// TestOverwriteFailedUpload 覆盖模式下上传中断时保留原文件，也不留下临时文件；上传完成后才替换原文件
+func TestOverwriteFailedUpload(t *testing.T) {
+	s, h := newRegistryServer(t, 0)
+	s.SetConflictPolicy(ConflictOverwrite)
+	target := filepath.Join(s.UploadDir(), "a.txt")
+	if err := os.WriteFile(target, []byte("original"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(content []byte, truncate bool) int {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", "a.txt")
+		fw.Write(content)
+		mw.Close()
+		data := body.Bytes()
+		if truncate {
+			data = data[:body.Len()-len(mw.Boundary())-8]
+		}
+		r := httptest.NewRequest(http.MethodPost, "/upload?uploadId=u", bytes.NewReader(data))
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		return serve(h, r)
+	}
+
+	if code := upload(bytes.Repeat([]byte("x"), 64<<10), true); code == http.StatusOK {
+		t.Fatalf("中断的上传返回 %d", code)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "original" {
+		t.Errorf("上传中断后原文件变为 %q", got)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(s.UploadDir(), partialDir)); len(entries) != 0 {
+		t.Errorf("上传中断后留下了 %d 个临时文件", len(entries))
+	}
+
+	if code := upload([]byte("new"), false); code != http.StatusOK {
+		t.Fatalf("上传返回 %d", code)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "new" {
+		t.Errorf("上传完成后文件内容为 %q，应为 \"new\"", got)
+	}
+	if fi, err := os.Stat(target); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("覆盖后文件权限为 %v, %v，应保留0600", fi.Mode().Perm(), err)
+	}
+	if entries, _ := os.ReadDir(s.UploadDir()); len(entries) != 2 {
+		t.Errorf("上传目录中有 %d 项，应只有原文件和临时目录", len(entries))
+	}
+}
@@ -0,0 +1,500 @@
+package pairserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// croc传输：不在同一网络、无法扫码访问时，通过croc的公共中继与对方的croc客户端或另一个pair-gui互传文件。
+// 双方输入相同的代码，由代码派生的口令协商密钥，文件内容端到端加密，中继无法解密
+
+// CrocRelay croc中继服务器
+type CrocRelay struct {
+	Address  string // 中继地址，如 croc.schollz.com:9009
+	Password string // 中继密码
+}
+
+// DefaultCrocRelay croc客户端默认使用的公共中继
+var DefaultCrocRelay = CrocRelay{Address: "croc.schollz.com:9009", Password: "pass123"}
+
+// ErrCrocCode croc代码格式不正确
+var ErrCrocCode = errors.New("croc代码格式不正确，应如 1234-apple-river-stone")
+
+// crocMachineID 告诉对方的本机标识
+const crocMachineID = "pair-gui"
+
+// NewCrocCode 生成形如 1234-apple-river-stone 的croc代码：前4位决定中继上的房间，其余部分是协商密钥的口令
+func NewCrocCode() string {
+	return fmt.Sprintf("%04d-%s-%s-%s", randomIndex(10000),
+		codeWords[randomIndex(len(codeWords))], codeWords[randomIndex(len(codeWords))], codeWords[randomIndex(len(codeWords))])
+}
+
+// CrocSend 通过中继将文件发送给输入相同代码的croc接收方，对方接收完全部文件后返回。
+// progress非nil时在发送过程中报告已发送和总字节数
+func CrocSend(ctx context.Context, relay CrocRelay, code string, files []File, progress func(sent, total int64)) error {
+	var infos []crocFileInfo
+	var total int64
+	for _, f := range files {
+		info, err := crocFile(f)
+		if err != nil {
+			return err
+		}
+		infos = append(infos, info)
+		total += info.Size
+	}
+
+	cs, err := openCrocSession(ctx, relay, code)
+	if err != nil {
+		return err
+	}
+	defer cs.close()
+	fail := func(err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	// 等待接收方加入房间，接收方可能先询问本机的局域网地址，回复空列表表示只通过中继传输
+	for waiting := true; waiting; {
+		data, err := cs.conns[0].receive()
+		if err != nil {
+			return fail(err)
+		}
+		switch string(data) {
+		case "ips?":
+			if err := cs.conns[0].send([]byte("[]")); err != nil {
+				return fail(err)
+			}
+		case "handshake":
+			waiting = false
+		}
+	}
+
+	var sent int64
+	for {
+		m, err := cs.receive()
+		if err != nil {
+			return fail(err)
+		}
+		switch m.Type {
+		case crocTypePAKE:
+			if cs.aead != nil {
+				return errors.New("重复的croc密钥协商")
+			}
+			pake, err := newCrocPake(cs.secret, 1, string(m.Bytes2))
+			if err != nil {
+				return err
+			}
+			if err := pake.update(m.Bytes); err != nil {
+				return err
+			}
+			salt, err := randomSalt()
+			if err != nil {
+				return err
+			}
+			if err := cs.send(crocMessage{Type: crocTypePAKE, Bytes: pake.bytes(), Bytes2: salt}); err != nil {
+				return fail(err)
+			}
+			if err := cs.setKey(pake, salt); err != nil {
+				return err
+			}
+			if err := cs.connectData(ctx); err != nil {
+				return fail(err)
+			}
+		case crocTypeExternalIP:
+			if err := cs.send(crocMessage{Type: crocTypeExternalIP, Message: cs.externalIP}); err != nil {
+				return fail(err)
+			}
+			info, err := json.Marshal(crocSenderInfo{FilesToTransfer: infos, MachineID: crocMachineID, NoCompress: true, HashAlgorithm: "md5"})
+			if err != nil {
+				return err
+			}
+			if err := cs.send(crocMessage{Type: crocTypeFileInfo, Bytes: info}); err != nil {
+				return fail(err)
+			}
+		case crocTypeRecipientReady:
+			var req crocFileRequest
+			if err := json.Unmarshal(m.Bytes, &req); err != nil {
+				return fmt.Errorf("解析croc消息失败: %v", err)
+			}
+			i := req.FilesToTransferCurrentNum
+			if i < 0 || i >= len(files) {
+				return fmt.Errorf("croc接收方请求的文件不存在: %d", i)
+			}
+			err := cs.sendFile(files[i].AbsPath, crocChunks(req.CurrentFileChunkRanges, infos[i].Size), func(n int) {
+				sent += int64(n)
+				if progress != nil {
+					progress(sent, total)
+				}
+			})
+			if err != nil {
+				return fail(fmt.Errorf("%s: %v", files[i].Filename, err))
+			}
+		case crocTypeCloseSender:
+			if err := cs.send(crocMessage{Type: crocTypeCloseRecipient}); err != nil {
+				return fail(err)
+			}
+		case crocTypeFinished:
+			cs.send(crocMessage{Type: crocTypeFinished})
+			return nil
+		case crocTypeError:
+			return fmt.Errorf("croc接收方出错: %s", m.Message)
+		}
+	}
+}
+
+// crocFile 返回发送文件f时告诉对方的文件信息，包括用于校验的MD5
+func crocFile(f File) (crocFileInfo, error) {
+	file, err := os.Open(f.AbsPath)
+	if err != nil {
+		return crocFileInfo{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return crocFileInfo{}, err
+	}
+	h := md5.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return crocFileInfo{}, err
+	}
+	return crocFileInfo{
+		Name:         f.Filename,
+		FolderRemote: ".",
+		FolderSource: filepath.Dir(f.AbsPath),
+		Hash:         h.Sum(nil),
+		Size:         info.Size(),
+		ModTime:      info.ModTime(),
+		Mode:         info.Mode().Perm(),
+	}, nil
+}
+
+// sendFile 将文件中want包含的数据块依次通过各个数据连接发送，want为nil时发送整个文件
+func (cs *crocSession) sendFile(path string, want map[int64]bool, progress func(n int)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data := cs.conns[1:]
+	buf := make([]byte, 8+crocChunkSize)
+	var pos int64
+	for i := 0; ; i++ {
+		n, err := f.ReadAt(buf[8:], pos)
+		if n > 0 && (want == nil || want[pos]) {
+			binary.LittleEndian.PutUint64(buf, uint64(pos))
+			chunk, err := crocEncrypt(cs.aead, buf[:8+n])
+			if err != nil {
+				return err
+			}
+			if err := data[i%len(data)].send(chunk); err != nil {
+				return err
+			}
+			progress(n)
+		}
+		pos += int64(n)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// crocReceiver 一次croc接收的状态
+type crocReceiver struct {
+	s    *Server
+	cs   *crocSession
+	ip   string // 中继的地址，用于接收确认和传输记录；发送方自称的公网地址无法验证，不使用
+	info crocSenderInfo
+	next int      // 下一个要检查的文件序号
+	done []string // 已保存的文件路径
+
+	mu      sync.Mutex
+	current *crocIncoming // 正在接收的文件，没有时为nil
+	err     error         // 数据连接上的错误
+}
+
+// crocIncoming 正在通过croc接收的文件
+type crocIncoming struct {
+	file     *uploadFile
+	t        *transfer
+	info     crocFileInfo
+	received int64
+	closing  bool // 已收到全部数据并通知了对方
+}
+
+// CrocReceive 通过中继接收croc发送方用code发送的文件，保存到上传目录，返回保存的文件路径。
+// 每个文件与网页上传一样经过上传过滤、接收确认、大小限制和重名策略，被拒绝的文件跳过
+func (s *Server) CrocReceive(ctx context.Context, relay CrocRelay, code string) ([]string, error) {
+	cs, err := openCrocSession(ctx, relay, code)
+	if err != nil {
+		return nil, err
+	}
+	defer cs.close()
+	ip, _, err := net.SplitHostPort(cs.conns[0].RemoteAddr().String())
+	if err != nil {
+		ip = relay.Address
+	}
+	r := &crocReceiver{s: s, cs: cs, ip: ip}
+	defer r.finish(false)
+
+	err = r.run(ctx)
+	r.mu.Lock()
+	if r.err != nil {
+		err = r.err
+	}
+	if r.current != nil && r.current.t.canceled() {
+		err = errTransferCanceled
+	}
+	r.mu.Unlock()
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return r.done, err
+}
+
+// run 完成握手并依次接收文件，直到发送方确认结束
+func (r *crocReceiver) run(ctx context.Context) error {
+	cs := r.cs
+	if err := cs.conns[0].send([]byte("handshake")); err != nil {
+		return err
+	}
+	pake, err := newCrocPake(cs.secret, 0, crocCurveP256)
+	if err != nil {
+		return err
+	}
+	if err := cs.send(crocMessage{Type: crocTypePAKE, Bytes: pake.bytes(), Bytes2: []byte(crocCurveP256)}); err != nil {
+		return err
+	}
+
+	for {
+		m, err := cs.receive()
+		if err != nil {
+			return err
+		}
+		switch m.Type {
+		case crocTypePAKE:
+			if cs.aead != nil {
+				return errors.New("重复的croc密钥协商")
+			}
+			if err := pake.update(m.Bytes); err != nil {
+				return err
+			}
+			if err := cs.setKey(pake, m.Bytes2); err != nil {
+				return err
+			}
+			if err := cs.connectData(ctx); err != nil {
+				return err
+			}
+			for _, conn := range cs.conns[1:] {
+				go r.readData(conn)
+			}
+			if err := cs.send(crocMessage{Type: crocTypeExternalIP, Message: cs.externalIP, Bytes: []byte(cs.externalIP)}); err != nil {
+				return err
+			}
+		case crocTypeFileInfo:
+			r.mu.Lock()
+			err := json.Unmarshal(m.Bytes, &r.info)
+			r.mu.Unlock()
+			if err != nil {
+				return fmt.Errorf("解析croc消息失败: %v", err)
+			}
+			if err := r.request(ctx); err != nil {
+				return err
+			}
+		case crocTypeCloseRecipient:
+			if err := r.finish(true); err != nil {
+				return err
+			}
+			if err := r.request(ctx); err != nil {
+				return err
+			}
+		case crocTypeFinished:
+			return nil
+		case crocTypeError:
+			return fmt.Errorf("croc发送方出错: %s", m.Message)
+		}
+	}
+}
+
+// request 准备接收下一个文件并请发送方发送；没有剩余文件时通知发送方结束
+func (r *crocReceiver) request(ctx context.Context) error {
+	s, dir := r.s, r.s.UploadDir()
+	for r.next < len(r.info.FilesToTransfer) {
+		i := r.next
+		r.next++
+		info := r.info.FilesToTransfer[i]
+		name := sanitizeFilename(info.Name)
+		if info.Symlink != "" || info.IsIgnored || info.Size < 0 {
+			continue
+		}
+		if limit := s.MaxUploadSize(); limit > 0 && info.Size > limit {
+			log.Printf("croc文件超过上传大小限制，已跳过: %s", name)
+			continue
+		}
+		if !s.approveUpload(ctx, UploadRequest{Filename: name, Size: info.Size, IP: r.ip, UserAgent: "croc", untrusted: true}) {
+			log.Printf("拒绝接收croc文件: %s", name)
+			continue
+		}
+		if free, ok := hasSpace(dir, info.Size); !ok {
+			return fmt.Errorf("磁盘空间不足: %s需要%d字节，剩余%d字节", name, info.Size, free)
+		}
+
+		file, err := s.createUpload(dir, name)
+		if errors.Is(err, ErrFileExists) {
+			log.Printf("croc文件已存在，已跳过: %s", name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		t := s.beginTransfer(TransferUpload, filepath.Base(file.path), r.ip, info.Size)
+		t.setAbort(r.cs.close)
+
+		r.mu.Lock()
+		r.current = &crocIncoming{file: file, t: t, info: info}
+		r.mu.Unlock()
+		if info.Size == 0 {
+			// 空文件没有数据可请求，创建后直接完成
+			if err := r.finish(true); err != nil {
+				return err
+			}
+			continue
+		}
+		req, err := json.Marshal(crocFileRequest{CurrentFileChunkRanges: []int64{}, FilesToTransferCurrentNum: i, MachineID: crocMachineID})
+		if err != nil {
+			return err
+		}
+		return r.cs.send(crocMessage{Type: crocTypeRecipientReady, Bytes: req})
+	}
+	return r.cs.send(crocMessage{Type: crocTypeFinished})
+}
+
+// finish 结束正在接收的文件：ok为真且数据完整、校验通过时保留文件，否则删除
+func (r *crocReceiver) finish(ok bool) error {
+	r.mu.Lock()
+	cur := r.current
+	r.current = nil
+	r.mu.Unlock()
+	if cur == nil {
+		return nil
+	}
+	defer r.s.endTransfer(cur.t)
+
+	err := cur.file.Close()
+	if err == nil && cur.received != cur.info.Size {
+		err = fmt.Errorf("文件不完整: %d/%d", cur.received, cur.info.Size)
+	}
+	if err == nil && r.info.HashAlgorithm == "md5" && len(cur.info.Hash) > 0 {
+		err = checkMD5(cur.file.Name(), cur.info.Hash)
+	}
+	if ok && err == nil {
+		err = cur.file.commit()
+	}
+	if !ok || err != nil {
+		cur.file.abort()
+		cur.t.fail()
+		if err != nil {
+			return fmt.Errorf("%s: %v", cur.info.Name, err)
+		}
+		return nil
+	}
+	cur.t.setFile(cur.file.path)
+	r.done = append(r.done, cur.file.path)
+	return nil
+}
+
+// checkMD5 校验文件的MD5
+func checkMD5(path string, want []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if !bytes.Equal(h.Sum(nil), want) {
+		return errors.New("文件校验失败")
+	}
+	return nil
+}
+
+// readData 读取数据连接上的文件数据块并写入正在接收的文件，出错时关闭会话
+func (r *crocReceiver) readData(conn *crocConn) {
+	for {
+		data, err := conn.receive()
+		if err != nil {
+			return
+		}
+		if bytes.Equal(data, crocPing) {
+			continue
+		}
+		if err := r.write(data); err != nil {
+			r.mu.Lock()
+			if r.err == nil {
+				r.err = err
+			}
+			r.mu.Unlock()
+			r.cs.close()
+			return
+		}
+	}
+}
+
+// write 解密一个数据块并写入正在接收的文件，收齐后通知发送方
+func (r *crocReceiver) write(data []byte) error {
+	data, err := crocDecrypt(r.cs.aead, data)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.info.NoCompress {
+		if data, err = crocDecompress(data, 8+crocChunkSize*4); err != nil {
+			return err
+		}
+	}
+	if len(data) < 8 {
+		return errors.New("croc数据块过短")
+	}
+	cur := r.current
+	if cur == nil || cur.closing {
+		return errors.New("收到多余的croc数据")
+	}
+	pos := int64(binary.LittleEndian.Uint64(data))
+	data = data[8:]
+	if pos < 0 || pos+int64(len(data)) > cur.info.Size {
+		return errors.New("croc数据块超出文件大小")
+	}
+	if _, err := cur.file.WriteAt(data, pos); err != nil {
+		return err
+	}
+	cur.received += int64(len(data))
+	cur.t.add(len(data))
+	if cur.received >= cur.info.Size {
+		cur.closing = true
+		return r.cs.send(crocMessage{Type: crocTypeCloseSender})
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package pairserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCrocRelay 测试用的croc中继：完成握手后把同一房间的两个连接互相转发
+type fakeCrocRelay struct {
+	password string
+	mu       sync.Mutex
+	rooms    map[string]net.Conn
+}
+
+// startFakeCrocRelay 启动监听一个主端口和两个数据端口的中继
+func startFakeCrocRelay(t *testing.T, password string) CrocRelay {
+	t.Helper()
+	r := &fakeCrocRelay{password: password, rooms: make(map[string]net.Conn)}
+	var lns []net.Listener
+	var ports []string
+	for range 3 {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		_, port, _ := net.SplitHostPort(ln.Addr().String())
+		lns, ports = append(lns, ln), append(ports, port)
+	}
+	banner := strings.Join(ports[1:], ",")
+	for _, ln := range lns {
+		go func() {
+			for {
+				c, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				go r.handle(c, banner)
+			}
+		}()
+	}
+	return CrocRelay{Address: lns[0].Addr().String(), Password: password}
+}
+
+// handle 完成与客户端的握手，房间中已有另一个连接时开始转发
+func (r *fakeCrocRelay) handle(c net.Conn, banner string) {
+	conn := &crocConn{Conn: c}
+	a, err := conn.receive()
+	if err != nil {
+		return
+	}
+	pake, _ := newCrocPake(crocRelayKey, 1, crocCurveSIEC)
+	if pake.update(a) != nil || conn.send(pake.bytes()) != nil {
+		return
+	}
+	salt, err := conn.receive()
+	if err != nil {
+		return
+	}
+	aead, _ := crocCipher(pake.key, salt)
+	reply := func(msg string) {
+		enc, _ := crocEncrypt(aead, []byte(msg))
+		conn.send(enc)
+	}
+	read := func() string {
+		data, err := conn.receive()
+		if err != nil {
+			return ""
+		}
+		plain, _ := crocDecrypt(aead, data)
+		return string(plain)
+	}
+
+	if read() != r.password {
+		reply("bad password")
+		c.Close()
+		return
+	}
+	reply(banner + "|||127.0.0.1")
+	room := read()
+	reply("ok")
+
+	r.mu.Lock()
+	other := r.rooms[room]
+	if other == nil {
+		r.rooms[room] = c
+		r.mu.Unlock()
+		return
+	}
+	delete(r.rooms, room)
+	r.mu.Unlock()
+	go func() {
+		io.Copy(other, c)
+		other.Close()
+	}()
+	io.Copy(c, other)
+	c.Close()
+}
+
+// TestCrocPake 双方口令相同时协商出相同的密钥，口令不同时密钥不同
+func TestCrocPake(t *testing.T) {
+	tests := []struct {
+		curve string
+		pw1   string
+		pw2   string
+		same  bool
+	}{
+		{crocCurveP256, "apple-river-stone", "apple-river-stone", true},
+		{crocCurveP256, "apple-river-stone", "apple-river-stove", false},
+		{crocCurveSIEC, "\x01\x02\x03", "\x01\x02\x03", true},
+		{crocCurveSIEC, "abc", "abd", false},
+	}
+	for _, tt := range tests {
+		a, err := newCrocPake([]byte(tt.pw1), 0, tt.curve)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := newCrocPake([]byte(tt.pw2), 1, tt.curve)
+		if err := b.update(a.bytes()); err != nil {
+			t.Fatalf("%s: %v", tt.curve, err)
+		}
+		if err := a.update(b.bytes()); err != nil {
+			t.Fatalf("%s: %v", tt.curve, err)
+		}
+		if bytes.Equal(a.key, b.key) != tt.same {
+			t.Errorf("%s 口令%q和%q协商的密钥是否相同应为%v", tt.curve, tt.pw1, tt.pw2, tt.same)
+		}
+	}
+
+	// 角色1收到不在曲线上的点时拒绝
+	a, _ := newCrocPake([]byte("pw"), 0, crocCurveSIEC)
+	a.Xu.Add(a.Xu, big.NewInt(1))
+	b, _ := newCrocPake([]byte("pw"), 1, crocCurveSIEC)
+	if b.update(a.bytes()) == nil {
+		t.Error("应拒绝不在曲线上的点")
+	}
+}
+
+// TestCrocPakeFormat PAKE消息的字段名与github.com/schollz/pake/v3相同，
+// 角色1收到croc客户端格式的消息（只含U、V、X，整数以JSON数字表示）时能完成协商
+func TestCrocPakeFormat(t *testing.T) {
+	a, _ := newCrocPake([]byte("pw"), 0, crocCurveP256)
+	msg := string(a.bytes())
+	for _, field := range []string{`"Role":0`, `"Uᵤ":`, `"Uᵥ":`, `"Vᵤ":`, `"Vᵥ":`, `"Xᵤ":`, `"Xᵥ":`} {
+		if !strings.Contains(msg, field) {
+			t.Errorf("PAKE消息缺少 %s: %s", field, msg)
+		}
+	}
+
+	g := siec.Params()
+	transcript := fmt.Sprintf(`{"Role":0,"Uᵤ":%s,"Uᵥ":%s,"Vᵤ":%s,"Vᵥ":%s,"Xᵤ":%s,"Xᵥ":%s}`, g.Gx, g.Gy, g.Gx, g.Gy, g.Gx, g.Gy)
+	b, _ := newCrocPake([]byte("pw"), 1, crocCurveSIEC)
+	if err := b.update([]byte(transcript)); err != nil {
+		t.Fatalf("解析croc格式的PAKE消息失败: %v", err)
+	}
+	if !siec.IsOnCurve(b.Yu, b.Yv) || len(b.key) != 32 {
+		t.Error("协商结果无效")
+	}
+}
+
+// TestCrocScalar 随机标量取自[1, N)的全部范围，而不只是64位
+func TestCrocScalar(t *testing.T) {
+	for _, curve := range []crocCurve{siec, elliptic.P256()} {
+		wide := false
+		for range 16 {
+			b, err := randomScalar(curve)
+			if err != nil {
+				t.Fatal(err)
+			}
+			k := new(big.Int).SetBytes(b)
+			if k.Sign() <= 0 || k.Cmp(curve.Params().N) >= 0 {
+				t.Fatalf("%s: 标量 %s 超出 [1, N)", curve.Params().Name, k)
+			}
+			wide = wide || k.BitLen() > 128
+		}
+		if !wide {
+			t.Errorf("%s: 16个随机标量都不超过128位", curve.Params().Name)
+		}
+	}
+}
+
+// TestSIEC 曲线参数符合SIEC的定义：p和阶N都是素数，迹t = p + 1 - N满足4p = t² + 3
+// （超孤立曲线的判别式为-3），基点在曲线上，乘以阶后为无穷远点
+func TestSIEC(t *testing.T) {
+	p := siec.Params()
+	if !p.P.ProbablyPrime(32) || !p.N.ProbablyPrime(32) {
+		t.Fatal("p或N不是素数")
+	}
+	trace := new(big.Int).Add(p.P, big.NewInt(1))
+	trace.Sub(trace, p.N)
+	d := new(big.Int).Lsh(p.P, 2)
+	d.Sub(d, trace.Mul(trace, trace))
+	if d.Cmp(big.NewInt(3)) != 0 {
+		t.Fatalf("4p - t² = %s，应为3", d)
+	}
+	if !siec.IsOnCurve(p.Gx, p.Gy) {
+		t.Fatal("基点不在曲线上")
+	}
+	x, y := siec.ScalarBaseMult(p.N.Bytes())
+	if x.Sign() != 0 || y.Sign() != 0 {
+		t.Error("基点乘以阶应为无穷远点")
+	}
+	x1, y1 := siec.ScalarBaseMult([]byte{2})
+	x2, y2 := siec.Add(p.Gx, p.Gy, p.Gx, p.Gy)
+	if x1.Cmp(x2) != 0 || y1.Cmp(y2) != 0 || !siec.IsOnCurve(x1, y1) {
+		t.Error("2G计算错误")
+	}
+}
+
+// TestCrocTransfer 通过中继发送和接收文件，接收的文件与原文件相同
+func TestCrocTransfer(t *testing.T) {
+	src := t.TempDir()
+	large := make([]byte, 3*crocChunkSize+123)
+	rand.Read(large)
+	files := map[string][]byte{"big.bin": large, "a<b>.txt": []byte("hello"), "empty.txt": nil}
+	var shared []File
+	for _, name := range []string{"big.bin", "a<b>.txt", "empty.txt"} {
+		path := filepath.Join(src, strings.NewReplacer("<", "", ">", "").Replace(name))
+		if err := os.WriteFile(path, files[name], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		shared = append(shared, File{Filename: name, AbsPath: path})
+	}
+
+	dir := t.TempDir()
+	s := New()
+	s.SetUploadDir(dir)
+	// 发送方无法按IP区分，选择信任后其余文件仍需确认
+	var asked []string
+	s.SetUploadApproval(true)
+	s.SetUploadApprover(func(req UploadRequest) (bool, bool) {
+		asked = append(asked, req.IP)
+		return true, true
+	})
+	relay := startFakeCrocRelay(t, "pass123")
+	code := NewCrocCode()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	sendErr := make(chan error, 1)
+	var sent int64
+	go func() {
+		sendErr <- CrocSend(ctx, relay, code, shared, func(n, total int64) { sent = n })
+	}()
+	saved, err := s.CrocReceive(ctx, relay, code)
+	if err != nil {
+		t.Fatalf("接收失败: %v", err)
+	}
+	if err := <-sendErr; err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	if len(saved) != 3 || sent != int64(len(large)+5) {
+		t.Errorf("保存了%d个文件，发送了%d字节", len(saved), sent)
+	}
+	if len(asked) != 3 || asked[0] != "127.0.0.1" {
+		t.Errorf("询问了%d次，客户端地址为%v，应询问3次且地址为中继的地址", len(asked), asked)
+	}
+	for name, want := range map[string][]byte{"big.bin": large, "a_b_.txt": []byte("hello"), "empty.txt": nil} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s 的内容不一致: %v", name, err)
+		}
+	}
+
+	// 超过上传大小限制的文件跳过
+	s.SetMaxUploadSize(10)
+	go func() {
+		sendErr <- CrocSend(ctx, relay, code, shared[:2], nil)
+	}()
+	saved, err = s.CrocReceive(ctx, relay, code)
+	if err != nil || <-sendErr != nil {
+		t.Fatalf("接收失败: %v", err)
+	}
+	if len(saved) != 1 || filepath.Base(saved[0]) != "a_b_ (1).txt" {
+		t.Errorf("应只保存小文件，保存了%v", saved)
+	}
+}
+
+// TestCrocErrors 中继密码或代码错误时返回错误
+func TestCrocErrors(t *testing.T) {
+	s := New()
+	s.SetUploadDir(t.TempDir())
+	relay := startFakeCrocRelay(t, "secret")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := s.CrocReceive(ctx, CrocRelay{Address: relay.Address, Password: "wrong"}, NewCrocCode()); err == nil || !strings.Contains(err.Error(), "bad password") {
+		t.Errorf("中继密码错误时应返回错误，得到%v", err)
+	}
+	if _, err := s.CrocReceive(ctx, relay, "123"); err != ErrCrocCode {
+		t.Errorf("代码过短时应返回ErrCrocCode，得到%v", err)
+	}
+
+	// 双方房间相同但口令不同时无法解密对方的消息
+	sendErr := make(chan error, 1)
+	go func() {
+		sendErr <- CrocSend(ctx, relay, "1234-apple-river-stone", nil, nil)
+	}()
+	if _, err := s.CrocReceive(ctx, relay, "1234-apple-river-stove"); err == nil {
+		t.Error("口令不同时应返回错误")
+	}
+	cancel()
+	<-sendErr
+}
+
+// TestSIECScalarMult 常数时间的标量乘法与按仿射公式独立计算的已知结果相同，加法正确处理互为相反数的点
+func TestSIECScalarMult(t *testing.T) {
+	hexInt := func(s string) *big.Int {
+		v, _ := new(big.Int).SetString(s, 16)
+		return v
+	}
+	tests := []struct {
+		k, x, y string
+	}{
+		{"2", "f0000000000000000000000007803cf1e000000000000000000f00f3cb5e78f", "21200000000000000000000001090869624000000000000000021221a611b4b6"},
+		{"010203", "2cb9a78156bd0896d57a1ed8e5fc66de56e3073d2bb47dca84d48957d011b6d9", "372bff83ddc6b9f7cabc840e14529911c8f08f7556b627d04212aec600516457"},
+		{"1eadbeefcafebabe123456788aab9d308011223344556677888da9f8cfc5efbc", "2c65b4e98d92c7ff1403aafac793959db411e32a16c77783db479f565883890f", "1bf0efe94fef6b3e4163fd645d49b7e4a5af70247188af8287d775837ce58374"},
+	}
+	for _, tt := range tests {
+		x, y := siec.ScalarBaseMult(hexInt(tt.k).Bytes())
+		if x.Cmp(hexInt(tt.x)) != 0 || y.Cmp(hexInt(tt.y)) != 0 {
+			t.Errorf("%s·G = (%x, %x)，应为 (%s, %s)", tt.k, x, y, tt.x, tt.y)
+		}
+	}
+
+	g := siec.Params()
+	// 2G + G = 3G，P + (-P) = 无穷远点
+	x2, y2 := siec.ScalarBaseMult([]byte{2})
+	x3, y3 := siec.Add(x2, y2, g.Gx, g.Gy)
+	if wx, wy := siec.ScalarBaseMult([]byte{3}); x3.Cmp(wx) != 0 || y3.Cmp(wy) != 0 {
+		t.Error("2G + G 与 3G 不同")
+	}
+	if x, y := siec.Add(g.Gx, g.Gy, g.Gx, new(big.Int).Sub(g.P, g.Gy)); x.Sign() != 0 || y.Sign() != 0 {
+		t.Errorf("G + (-G) = (%x, %x)，应为无穷远点", x, y)
+	}
+}
@@ -0,0 +1,765 @@
+package pairserver
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/elliptic"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/bigmod"
+)
+
+// croc协议的底层实现：消息帧、加密、PAKE和中继握手，按croc v9/v10的协议实现；
+// 只在pair-gui之间测试过，未与croc命令行程序验证互通。
+// 与中继和对方都先用PAKE协商密钥，之后的消息用AES-GCM加密，中继只能看到密文
+
+const (
+	crocMagic       = "croc"           // 每条消息的帧头
+	maxCrocMessage  = 64 << 20         // 单条消息的最大长度
+	crocChunkSize   = 32 << 10         // 每个文件数据块的大小，与croc相同
+	crocCurveP256   = "p256"           // croc客户端默认使用的PAKE曲线
+	crocCurveSIEC   = "siec"           // 与中继握手使用的PAKE曲线
+	crocDialTimeout = 30 * time.Second // 连接中继和握手的超时
+)
+
+// croc消息类型
+const (
+	crocTypePAKE           = "pake"
+	crocTypeExternalIP     = "externalip"
+	crocTypeFinished       = "finished"
+	crocTypeError          = "error"
+	crocTypeCloseRecipient = "close-recipient"
+	crocTypeCloseSender    = "close-sender"
+	crocTypeRecipientReady = "recipientready"
+	crocTypeFileInfo       = "fileinfo"
+)
+
+var (
+	// crocPing 中继在等待另一方加入时发送的保活消息
+	crocPing = []byte{1}
+	// crocRelayKey 与中继握手使用的固定弱口令，真正的认证依靠随后加密发送的中继密码
+	crocRelayKey = []byte{1, 2, 3}
+)
+
+// crocConn 一个croc连接，消息帧为"croc"、4字节小端长度和内容；发送可在多个协程中进行
+type crocConn struct {
+	net.Conn
+	mu sync.Mutex
+}
+
+// send 发送一条消息
+func (c *crocConn) send(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	buf := make([]byte, 8+len(data))
+	copy(buf, crocMagic)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(data)))
+	copy(buf[8:], data)
+	_, err := c.Write(buf)
+	return err
+}
+
+// receive 读取一条消息，同一连接只能在一个协程中读取
+func (c *crocConn) receive() ([]byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(c, header); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != crocMagic {
+		return nil, errors.New("不是croc协议的数据")
+	}
+	n := binary.LittleEndian.Uint32(header[4:])
+	if n > maxCrocMessage {
+		return nil, fmt.Errorf("croc消息过长: %d字节", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(c, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// crocCipher 由PAKE协商的密钥和salt派生AES-GCM密钥
+func crocCipher(secret, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, string(secret), salt, 100, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// crocEncrypt 加密data，随机nonce放在密文前面
+func crocEncrypt(aead cipher.AEAD, data []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// crocDecrypt 解密crocEncrypt的结果
+func crocDecrypt(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) <= aead.NonceSize() {
+		return nil, errors.New("croc密文过短")
+	}
+	n := aead.NonceSize()
+	plain, err := aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return nil, errors.New("croc消息解密失败，代码可能不正确")
+	}
+	return plain, nil
+}
+
+// crocCompress 按croc的方式压缩消息，只做Huffman编码
+func crocCompress(data []byte) []byte {
+	var b bytes.Buffer
+	w, _ := flate.NewWriter(&b, flate.HuffmanOnly)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+// crocDecompress 解压消息，解压后超过limit字节时返回错误
+func crocDecompress(data []byte, limit int64) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+
+	out, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("解压croc消息失败: %v", err)
+	}
+	if int64(len(out)) > limit {
+		return nil, errors.New("croc消息解压后过长")
+	}
+	return out, nil
+}
+
+// crocMessage 双方在第一个连接上交换的消息
+type crocMessage struct {
+	Type    string `json:"t,omitempty"`
+	Message string `json:"m,omitempty"`
+	Bytes   []byte `json:"b,omitempty"`
+	Bytes2  []byte `json:"b2,omitempty"`
+	Num     int    `json:"n,omitempty"`
+}
+
+// crocFileInfo 发送方提供的文件信息
+type crocFileInfo struct {
+	Name         string      `json:"n,omitempty"`
+	FolderRemote string      `json:"fr,omitempty"`
+	FolderSource string      `json:"fs,omitempty"`
+	Hash         []byte      `json:"h,omitempty"`
+	Size         int64       `json:"s,omitempty"`
+	ModTime      time.Time   `json:"m,omitempty"`
+	IsCompressed bool        `json:"c,omitempty"`
+	IsEncrypted  bool        `json:"e,omitempty"`
+	Symlink      string      `json:"sy,omitempty"`
+	Mode         fs.FileMode `json:"md,omitempty"`
+	TempFile     bool        `json:"tf,omitempty"`
+	IsIgnored    bool        `json:"ig,omitempty"`
+}
+
+// crocSenderInfo fileinfo消息的内容，字段名与croc相同
+type crocSenderInfo struct {
+	FilesToTransfer        []crocFileInfo
+	EmptyFoldersToTransfer []crocFileInfo
+	TotalNumberFolders     int
+	MachineID              string
+	Ask                    bool
+	SendingText            bool
+	NoCompress             bool
+	HashAlgorithm          string
+}
+
+// crocFileRequest recipientready消息的内容：接收方请求的文件序号和缺少的数据块，数据块为空表示整个文件
+type crocFileRequest struct {
+	CurrentFileChunkRanges    []int64
+	FilesToTransferCurrentNum int
+	MachineID                 string
+}
+
+// crocChunks 将请求的数据块范围[块大小, 起点, 块数, ...]转换为需要发送的偏移集合，nil表示发送整个文件
+func crocChunks(ranges []int64, size int64) map[int64]bool {
+	if len(ranges) < 3 || ranges[0] <= 0 {
+		return nil
+	}
+	want := make(map[int64]bool)
+	for i := 1; i+1 < len(ranges); i += 2 {
+		for j := int64(0); j < ranges[i+1]; j++ {
+			pos := ranges[i] + j*ranges[0]
+			if pos < 0 || pos >= size {
+				break
+			}
+			want[pos] = true
+		}
+	}
+	return want
+}
+
+// crocCurve PAKE使用的椭圆曲线，elliptic.Curve满足该接口
+type crocCurve interface {
+	Params() *elliptic.CurveParams
+	IsOnCurve(x, y *big.Int) bool
+	Add(x1, y1, x2, y2 *big.Int) (x, y *big.Int)
+	ScalarMult(x, y *big.Int, k []byte) (*big.Int, *big.Int)
+	ScalarBaseMult(k []byte) (*big.Int, *big.Int)
+}
+
+// siecCurve croc中继使用的SIEC255曲线 y² = x³ + 19，接口中用仿射坐标，(0, 0)表示无穷远点。
+// 点运算使用射影坐标下的完全加法公式（Renes-Costello-Batina 2016，算法7），域运算由bigmod以常数时间完成，
+// 标量乘法用Montgomery梯子按固定顺序处理标量的每一位，运算序列与标量的值无关
+type siecCurve struct {
+	params *elliptic.CurveParams
+	p      *bigmod.Modulus
+	b3     *bigmod.Nat // 3b
+}
+
+var siec = func() *siecCurve {
+	p, _ := new(big.Int).SetString("28948022309329048855892746252183396360603931420023084536990047309120118726721", 10)
+	n, _ := new(big.Int).SetString("28948022309329048855892746252183396360263649053102146073526672701688283398081", 10)
+	m, err := bigmod.NewModulus(p.Bytes())
+	if err != nil {
+		panic(err)
+	}
+	return &siecCurve{
+		params: &elliptic.CurveParams{P: p, N: n, B: big.NewInt(19), Gx: big.NewInt(5), Gy: big.NewInt(12), BitSize: 255, Name: "SIEC255"},
+		p:      m,
+		b3:     bigmod.NewNat().SetUint(3 * 19).ExpandFor(m),
+	}
+}()
+
+// siecPoint 射影坐标(X : Y : Z)表示的点，Z为0时为无穷远点
+type siecPoint struct {
+	x, y, z *bigmod.Nat
+}
+
+func (c *siecCurve) Params() *elliptic.CurveParams {
+	return c.params
+}
+
+func (c *siecCurve) IsOnCurve(x, y *big.Int) bool {
+	p := c.params.P
+	if x.Sign() < 0 || x.Cmp(p) >= 0 || y.Sign() < 0 || y.Cmp(p) >= 0 || (x.Sign() == 0 && y.Sign() == 0) {
+		return false
+	}
+	y2 := new(big.Int).Mul(y, y)
+	y2.Mod(y2, p)
+	x3 := new(big.Int).Mul(x, x)
+	x3.Mul(x3, x)
+	x3.Add(x3, c.params.B)
+	x3.Mod(x3, p)
+	return y2.Cmp(x3) == 0
+}
+
+func (c *siecCurve) Add(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	return c.affine(c.add(c.point(x1, y1), c.point(x2, y2)))
+}
+
+func (c *siecCurve) ScalarMult(x, y *big.Int, k []byte) (*big.Int, *big.Int) {
+	// 梯子中始终保持 r1 = r0 + P
+	r0, r1 := c.point(new(big.Int), new(big.Int)), c.point(x, y)
+	for _, b := range k {
+		for i := 7; i >= 0; i-- {
+			bit := uint(b >> i & 1)
+			c.swap(bit, &r0, &r1)
+			r1 = c.add(r0, r1)
+			r0 = c.add(r0, r0)
+			c.swap(bit, &r0, &r1)
+		}
+	}
+	return c.affine(r0)
+}
+
+func (c *siecCurve) ScalarBaseMult(k []byte) (*big.Int, *big.Int) {
+	return c.ScalarMult(c.params.Gx, c.params.Gy, k)
+}
+
+// nat 将[0, P)中的整数转换为域元素
+func (c *siecCurve) nat(v *big.Int) *bigmod.Nat {
+	n, err := bigmod.NewNat().SetBytes(v.FillBytes(make([]byte, 32)), c.p)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// point 将仿射坐标转换为射影坐标，(0, 0)转换为无穷远点(0 : 1 : 0)
+func (c *siecCurve) point(x, y *big.Int) siecPoint {
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return siecPoint{c.nat(x), c.nat(big.NewInt(1)), c.nat(x)}
+	}
+	return siecPoint{c.nat(x), c.nat(y), c.nat(big.NewInt(1))}
+}
+
+// affine 将射影坐标转换为仿射坐标，Z的逆元由费马小定理以常数时间计算
+func (c *siecCurve) affine(q siecPoint) (*big.Int, *big.Int) {
+	if q.z.IsZero() == 1 {
+		return new(big.Int), new(big.Int)
+	}
+	e := new(big.Int).Sub(c.params.P, big.NewInt(2))
+	inv := bigmod.NewNat().Exp(q.z, e.Bytes(), c.p)
+	x := bigmod.NewNat().ExpandFor(c.p).Add(q.x, c.p).Mul(inv, c.p)
+	y := bigmod.NewNat().ExpandFor(c.p).Add(q.y, c.p).Mul(inv, c.p)
+	return new(big.Int).SetBytes(x.Bytes(c.p)), new(big.Int).SetBytes(y.Bytes(c.p))
+}
+
+// swap bit为1时交换a和b：a' = a + bit·(b - a)，b' = b - bit·(b - a)，不按bit分支
+func (c *siecCurve) swap(bit uint, a, b *siecPoint) {
+	m := bigmod.NewNat().SetUint(bit).ExpandFor(c.p)
+	sel := func(u, v *bigmod.Nat) (*bigmod.Nat, *bigmod.Nat) {
+		d := bigmod.NewNat().ExpandFor(c.p).Add(v, c.p).Sub(u, c.p).Mul(m, c.p)
+		return bigmod.NewNat().ExpandFor(c.p).Add(u, c.p).Add(d, c.p), bigmod.NewNat().ExpandFor(c.p).Add(v, c.p).Sub(d, c.p)
+	}
+	a.x, b.x = sel(a.x, b.x)
+	a.y, b.y = sel(a.y, b.y)
+	a.z, b.z = sel(a.z, b.z)
+}
+
+// add 返回p + q，适用于包括倍点和无穷远点在内的所有输入（a = 0的完全加法公式）
+func (c *siecCurve) add(p, q siecPoint) siecPoint {
+	m := c.p
+	fe := func(v *bigmod.Nat) *bigmod.Nat { return bigmod.NewNat().ExpandFor(m).Add(v, m) }
+
+	t0 := fe(p.x).Mul(q.x, m)
+	t1 := fe(p.y).Mul(q.y, m)
+	t2 := fe(p.z).Mul(q.z, m)
+	t3 := fe(p.x).Add(p.y, m)
+	t4 := fe(q.x).Add(q.y, m)
+	t3.Mul(t4, m)
+	t4 = fe(t0).Add(t1, m)
+	t3.Sub(t4, m)
+	t4 = fe(p.y).Add(p.z, m)
+	x3 := fe(q.y).Add(q.z, m)
+	t4.Mul(x3, m)
+	x3 = fe(t1).Add(t2, m)
+	t4.Sub(x3, m)
+	x3 = fe(p.x).Add(p.z, m)
+	y3 := fe(q.x).Add(q.z, m)
+	x3.Mul(y3, m)
+	y3 = fe(t0).Add(t2, m)
+	y3 = fe(x3).Sub(y3, m)
+	x3 = fe(t0).Add(t0, m)
+	t0 = fe(x3).Add(t0, m)
+	t2.Mul(c.b3, m)
+	z3 := fe(t1).Add(t2, m)
+	t1.Sub(t2, m)
+	y3.Mul(c.b3, m)
+	x3 = fe(t4).Mul(y3, m)
+	t2 = fe(t3).Mul(t1, m)
+	x3 = fe(t2).Sub(x3, m)
+	y3.Mul(t0, m)
+	t1.Mul(z3, m)
+	y3 = fe(t1).Add(y3, m)
+	t0.Mul(t3, m)
+	z3.Mul(t4, m)
+	z3.Add(t0, m)
+	return siecPoint{x3, y3, z3}
+}
+
+// crocPakeCurve 按名称返回PAKE曲线
+func crocPakeCurve(name string) (crocCurve, error) {
+	switch name {
+	case crocCurveP256:
+		return elliptic.P256(), nil
+	case crocCurveSIEC:
+		return siec, nil
+	}
+	return nil, fmt.Errorf("不支持的PAKE曲线: %q", name)
+}
+
+// crocPake croc使用的SPAKE2密钥协商，JSON格式与github.com/schollz/pake/v3相同。
+// 角色0先发送U、V和X，角色1收到后回复Y，双方由此得到相同的会话密钥
+type crocPake struct {
+	Role int
+	Uu   *big.Int `json:"Uᵤ"`
+	Uv   *big.Int `json:"Uᵥ"`
+	Vu   *big.Int `json:"Vᵤ"`
+	Vv   *big.Int `json:"Vᵥ"`
+	Xu   *big.Int `json:"Xᵤ"`
+	Xv   *big.Int `json:"Xᵥ"`
+	Yu   *big.Int `json:"Yᵤ"`
+	Yv   *big.Int `json:"Yᵥ"`
+
+	curve  crocCurve
+	pw     []byte
+	secret []byte // 角色0的α或角色1的β
+	key    []byte // 协商得到的会话密钥
+}
+
+// randomScalar 返回[1, N)中均匀分布的随机标量，N为曲线的阶。标量只在本地使用，
+// 对方只看到由其计算的点，因此与使用较短标量的croc客户端兼容
+func randomScalar(curve crocCurve) ([]byte, error) {
+	n := new(big.Int).Sub(curve.Params().N, big.NewInt(1))
+	k, err := rand.Int(rand.Reader, n)
+	if err != nil {
+		return nil, err
+	}
+	return k.Add(k, big.NewInt(1)).Bytes(), nil
+}
+
+// randomSalt 返回协商会话密钥使用的8字节随机salt，与croc相同
+func randomSalt() ([]byte, error) {
+	salt := make([]byte, 8)
+	_, err := rand.Read(salt)
+	return salt, err
+}
+
+// newCrocPake 以口令pw创建role角色的PAKE
+func newCrocPake(pw []byte, role int, curveName string) (*crocPake, error) {
+	curve, err := crocPakeCurve(curveName)
+	if err != nil {
+		return nil, err
+	}
+	p := &crocPake{Role: role, curve: curve, pw: pw}
+	if role != 0 {
+		return p, nil
+	}
+
+	r1, err := randomScalar(curve)
+	if err != nil {
+		return nil, err
+	}
+	r2, err := randomScalar(curve)
+	if err != nil {
+		return nil, err
+	}
+	if p.secret, err = randomScalar(curve); err != nil {
+		return nil, err
+	}
+	p.Uu, p.Uv = curve.ScalarBaseMult(r1)
+	p.Vu, p.Vv = curve.ScalarBaseMult(r2)
+	// X = pw·U + α·G
+	upwX, upwY := curve.ScalarMult(p.Uu, p.Uv, pw)
+	ax, ay := curve.ScalarBaseMult(p.secret)
+	p.Xu, p.Xv = curve.Add(upwX, upwY, ax, ay)
+	return p, nil
+}
+
+// bytes 返回发给对方的公开部分
+func (p *crocPake) bytes() []byte {
+	b, _ := json.Marshal(p)
+	return b
+}
+
+// onCurve 判断点是否有效且在曲线上
+func (p *crocPake) onCurve(x, y *big.Int) bool {
+	return x != nil && y != nil && p.curve.IsOnCurve(x, y)
+}
+
+// sub 返回(x1, y1) - (x2, y2)
+func (p *crocPake) sub(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	ny := new(big.Int)
+	if y2.Sign() != 0 {
+		ny.Sub(p.curve.Params().P, y2)
+	}
+	return p.curve.Add(x1, y1, x2, ny)
+}
+
+// update 处理对方发来的公开部分并计算会话密钥
+func (p *crocPake) update(data []byte) error {
+	var q crocPake
+	if err := json.Unmarshal(data, &q); err != nil {
+		return fmt.Errorf("解析PAKE消息失败: %v", err)
+	}
+	if q.Role == p.Role {
+		return errors.New("PAKE双方角色相同")
+	}
+
+	var zx, zy *big.Int
+	if p.Role == 1 {
+		if !p.onCurve(q.Uu, q.Uv) || !p.onCurve(q.Vu, q.Vv) || !p.onCurve(q.Xu, q.Xv) {
+			return errors.New("PAKE消息中的点无效")
+		}
+		p.Uu, p.Uv, p.Vu, p.Vv, p.Xu, p.Xv = q.Uu, q.Uv, q.Vu, q.Vv, q.Xu, q.Xv
+		var err error
+		if p.secret, err = randomScalar(p.curve); err != nil {
+			return err
+		}
+		// Y = pw·V + β·G，Z = β·(X - pw·U)
+		vpwX, vpwY := p.curve.ScalarMult(p.Vu, p.Vv, p.pw)
+		bx, by := p.curve.ScalarBaseMult(p.secret)
+		p.Yu, p.Yv = p.curve.Add(vpwX, vpwY, bx, by)
+		upwX, upwY := p.curve.ScalarMult(p.Uu, p.Uv, p.pw)
+		zx, zy = p.sub(p.Xu, p.Xv, upwX, upwY)
+		zx, zy = p.curve.ScalarMult(zx, zy, p.secret)
+	} else {
+		if !p.onCurve(q.Yu, q.Yv) {
+			return errors.New("PAKE消息中的点无效")
+		}
+		p.Yu, p.Yv = q.Yu, q.Yv
+		// Z = α·(Y - pw·V)
+		vpwX, vpwY := p.curve.ScalarMult(p.Vu, p.Vv, p.pw)
+		zx, zy = p.sub(p.Yu, p.Yv, vpwX, vpwY)
+		zx, zy = p.curve.ScalarMult(zx, zy, p.secret)
+	}
+
+	h := sha256.New()
+	h.Write(p.pw)
+	for _, v := range []*big.Int{p.Xu, p.Xv, p.Yu, p.Yv, zx, zy} {
+		h.Write(v.Bytes())
+	}
+	p.key = h.Sum(nil)
+	return nil
+}
+
+// dialCrocRelay 连接中继并加入房间room，返回连接、中继的数据端口列表和中继看到的本机公网地址
+func dialCrocRelay(ctx context.Context, address, password, room string) (*crocConn, string, string, error) {
+	d := net.Dialer{Timeout: crocDialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("连接croc中继失败: %v", err)
+	}
+	conn := &crocConn{Conn: nc}
+	stop := context.AfterFunc(ctx, func() { nc.Close() })
+	defer stop()
+	nc.SetDeadline(time.Now().Add(crocDialTimeout))
+
+	banner, ip, err := crocRelayHandshake(conn, password, room)
+	if err != nil {
+		nc.Close()
+		if ctx.Err() != nil {
+			return nil, "", "", ctx.Err()
+		}
+		return nil, "", "", err
+	}
+	nc.SetDeadline(time.Time{})
+	return conn, banner, ip, nil
+}
+
+// crocRelayHandshake 与中继协商密钥、发送中继密码和房间名
+func crocRelayHandshake(conn *crocConn, password, room string) (banner, ip string, err error) {
+	pake, err := newCrocPake(crocRelayKey, 0, crocCurveSIEC)
+	if err != nil {
+		return "", "", err
+	}
+	if err := conn.send(pake.bytes()); err != nil {
+		return "", "", err
+	}
+	reply, err := conn.receive()
+	if err != nil {
+		return "", "", err
+	}
+	if err := pake.update(reply); err != nil {
+		return "", "", err
+	}
+	salt, err := randomSalt()
+	if err != nil {
+		return "", "", err
+	}
+	if err := conn.send(salt); err != nil {
+		return "", "", err
+	}
+	aead, err := crocCipher(pake.key, salt)
+	if err != nil {
+		return "", "", err
+	}
+
+	// exchange 加密发送data并解密中继的回复
+	exchange := func(data string) (string, error) {
+		enc, err := crocEncrypt(aead, []byte(data))
+		if err != nil {
+			return "", err
+		}
+		if err := conn.send(enc); err != nil {
+			return "", err
+		}
+		reply, err := conn.receive()
+		if err != nil {
+			return "", err
+		}
+		plain, err := crocDecrypt(aead, reply)
+		return string(plain), err
+	}
+
+	msg, err := exchange(password)
+	if err != nil {
+		return "", "", err
+	}
+	banner, ip, ok := strings.Cut(msg, "|||")
+	if !ok {
+		return "", "", fmt.Errorf("croc中继拒绝连接: %s", msg)
+	}
+	if msg, err = exchange(room); err != nil {
+		return "", "", err
+	}
+	if msg != "ok" {
+		return "", "", fmt.Errorf("croc中继拒绝加入房间: %s", msg)
+	}
+	return banner, ip, nil
+}
+
+// sha256Hex 返回s的SHA-256十六进制摘要
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// crocSession 双方通过中继建立的一次croc会话
+type crocSession struct {
+	relay      CrocRelay
+	room       string      // 第一个连接使用的房间名
+	secret     []byte      // 与对方协商密钥使用的口令
+	ports      []string    // 中继的数据端口
+	externalIP string      // 中继看到的本机公网地址
+	conns      []*crocConn // conns[0]传递消息，其余传输文件数据
+	aead       cipher.AEAD // 与对方协商的密钥，协商完成前为nil
+
+	mu     sync.Mutex
+	closed bool
+	stop   func() bool
+}
+
+// openCrocSession 连接中继并加入code对应的房间，ctx取消时关闭会话
+func openCrocSession(ctx context.Context, relay CrocRelay, code string) (*crocSession, error) {
+	code = strings.TrimSpace(code)
+	if len(code) < 6 {
+		return nil, ErrCrocCode
+	}
+	room := sha256Hex(code[:4] + "croc")
+	conn, banner, ip, err := dialCrocRelay(ctx, relay.Address, relay.Password, room)
+	if err != nil {
+		return nil, err
+	}
+	cs := &crocSession{relay: relay, room: room, secret: []byte(code[5:]), externalIP: ip, conns: []*crocConn{conn}}
+	if banner != "" {
+		cs.ports = strings.Split(banner, ",")
+	}
+	cs.stop = context.AfterFunc(ctx, cs.close)
+	return cs, nil
+}
+
+// close 关闭会话的全部连接
+func (cs *crocSession) close() {
+	cs.mu.Lock()
+	if cs.closed {
+		cs.mu.Unlock()
+		return
+	}
+	cs.closed = true
+	conns := cs.conns
+	cs.mu.Unlock()
+
+	if cs.stop != nil {
+		cs.stop()
+	}
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// setKey 由PAKE的会话密钥和salt设置之后消息使用的密钥
+func (cs *crocSession) setKey(pake *crocPake, salt []byte) error {
+	aead, err := crocCipher(pake.key, salt)
+	if err != nil {
+		return err
+	}
+	cs.aead = aead
+	return nil
+}
+
+// connectData 连接中继的各个数据端口，对方会加入相同的房间
+func (cs *crocSession) connectData(ctx context.Context) error {
+	if len(cs.ports) == 0 {
+		return errors.New("croc中继未提供数据端口")
+	}
+	host, _, err := net.SplitHostPort(cs.relay.Address)
+	if err != nil {
+		return err
+	}
+	conns := make([]*crocConn, len(cs.ports))
+	errs := make([]error, len(cs.ports))
+	var wg sync.WaitGroup
+	for i, port := range cs.ports {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			room := fmt.Sprintf("%s-%d", sha256Hex(cs.room)[:7], i)
+			conns[i], _, _, errs[i] = dialCrocRelay(ctx, net.JoinHostPort(host, port), cs.relay.Password, room)
+		}()
+	}
+	wg.Wait()
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	err = errors.Join(errs...)
+	if cs.closed || err != nil {
+		// 会话已在连接期间关闭或部分连接失败，关闭已建立的连接
+		for _, c := range conns {
+			if c != nil {
+				c.Close()
+			}
+		}
+		if err == nil {
+			err = net.ErrClosed
+		}
+		return err
+	}
+	cs.conns = append(cs.conns, conns...)
+	return nil
+}
+
+// send 在第一个连接上发送消息，密钥协商完成后加密
+func (cs *crocSession) send(m crocMessage) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	data = crocCompress(data)
+	if cs.aead != nil {
+		if data, err = crocEncrypt(cs.aead, data); err != nil {
+			return err
+		}
+	}
+	return cs.conns[0].send(data)
+}
+
+// receive 读取第一个连接上的下一条消息，跳过中继的保活消息
+func (cs *crocSession) receive() (crocMessage, error) {
+	var m crocMessage
+	for {
+		data, err := cs.conns[0].receive()
+		if err != nil {
+			return m, err
+		}
+		if bytes.Equal(data, crocPing) {
+			continue
+		}
+		if cs.aead != nil {
+			if data, err = crocDecrypt(cs.aead, data); err != nil {
+				return m, err
+			}
+		}
+		if data, err = crocDecompress(data, maxCrocMessage); err != nil {
+			return m, err
+		}
+		if err := json.Unmarshal(data, &m); err != nil {
+			return m, fmt.Errorf("解析croc消息失败: %v", err)
+		}
+		if cs.aead == nil && m.Type != crocTypePAKE {
+			return m, fmt.Errorf("密钥协商前收到croc消息: %s", m.Type)
+		}
+		return m, nil
+	}
+}
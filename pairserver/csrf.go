@@ -0,0 +1,55 @@
+package pairserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+)
+
+// CSRF防护
+const (
+	clientCookie = "pair_client"  // 浏览器会话，打开页面时设置，CSRF令牌由其派生
+	csrfHeader   = "X-CSRF-Token" // 修改请求携带CSRF令牌的请求头
+)
+
+// csrfToken 返回请求所在浏览器会话的CSRF令牌，会话Cookie不存在时先设置；页面处理器在输出页面前调用
+func (s *Server) csrfToken(w http.ResponseWriter, r *http.Request) string {
+	session := ""
+	if c, err := r.Cookie(clientCookie); err == nil && c.Value != "" {
+		session = c.Value
+	} else {
+		session = newSessionID()
+		http.SetCookie(w, &http.Cookie{
+			Name:     clientCookie,
+			Value:    session,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	return s.csrfFor(session)
+}
+
+// csrfFor 由会话ID计算CSRF令牌
+func (s *Server) csrfFor(session string) string {
+	mac := hmac.New(sha256.New, s.signKey())
+	mac.Write([]byte("csrf\x00" + session))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkCSRF 校验浏览器发出的上传、文本、剪贴板等修改请求携带的CSRF令牌，无效时返回403和false，
+// 以免手机上打开的恶意网页悄悄向电脑上传文件或写入剪贴板。浏览器发出的跨站请求总是带有Origin或Sec-Fetch-Site请求头，
+// 不带这两个请求头的请求来自curl、tus客户端等非网页程序，不受CSRF影响，不要求令牌
+func (s *Server) checkCSRF(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Origin") == "" && r.Header.Get("Sec-Fetch-Site") == "" {
+		return true
+	}
+	c, err := r.Cookie(clientCookie)
+	if err == nil && hmac.Equal([]byte(r.Header.Get(csrfHeader)), []byte(s.csrfFor(c.Value))) {
+		return true
+	}
+	http.Error(w, "CSRF令牌无效，请刷新页面后重试", http.StatusForbidden)
+	return false
+}
@@ -0,0 +1,345 @@
+package pairserver
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// 直接发送的增量传输（类似rsync）：接收方已有同名的旧文件时，先按块计算旧文件的签名(弱校验和+强校验)，
+// 发送方用滚动校验和在新文件中查找与旧文件相同的块，只发送变化的数据和对旧块的引用，
+// 接收方据此在旧文件的基础上重建新文件，最后以整个文件的SHA-256校验
+const (
+	minDeltaBlock   = 2 << 10   // 签名块的最小字节数
+	maxDeltaBlock   = 128 << 10 // 签名块的最大字节数
+	maxDeltaLiteral = 256 << 10 // 单个字面数据指令的最大字节数
+	deltaStrongSize = 16        // 强校验取SHA-256的前16字节
+)
+
+// 增量数据的指令，每条指令以一个字节的类型开始
+const (
+	deltaOpCopy    = 'C' // 复制旧文件的一块：块序号(uvarint)
+	deltaOpLiteral = 'L' // 写入新数据：长度(uvarint)和数据
+	deltaOpEnd     = 'E' // 结束：整个新文件的SHA-256
+)
+
+// errDeltaMismatch 重建的文件与发送方的文件不一致，通常是旧文件在传输期间被修改
+var errDeltaMismatch = errors.New("重建的文件校验失败")
+
+// deltaSignature 旧文件的块签名
+type deltaSignature struct {
+	BlockSize int      `json:"block_size"`
+	Size      int64    `json:"size"`
+	Weak      []uint32 `json:"weak"`
+	Strong    [][]byte `json:"strong"`
+}
+
+// valid 检查对方返回的签名是否完整
+func (sig *deltaSignature) valid() bool {
+	if sig.BlockSize != deltaBlockSize(sig.Size) || len(sig.Weak) != len(sig.Strong) ||
+		int64(len(sig.Weak)) != (sig.Size+int64(sig.BlockSize)-1)/int64(sig.BlockSize) {
+		return false
+	}
+	for _, strong := range sig.Strong {
+		if len(strong) != deltaStrongSize {
+			return false
+		}
+	}
+	return true
+}
+
+// deltaBlockSize 按文件大小选择块大小：约为文件大小的平方根，
+// 块数和每块的长度都随文件大小缓慢增长，签名不会太大，改动附近也不会重传太多数据
+func deltaBlockSize(size int64) int {
+	bs := int(math.Sqrt(float64(size)))
+	bs = (bs + 1023) &^ 1023
+	return min(max(bs, minDeltaBlock), maxDeltaBlock)
+}
+
+// strongSum 计算一块数据的强校验
+func strongSum(p []byte) []byte {
+	sum := sha256.Sum256(p)
+	return sum[:deltaStrongSize]
+}
+
+// weakSum 计算rsync的弱校验和：a为各字节之和，b为按位置加权之和，均取低16位
+func weakSum(p []byte) (a, b uint32) {
+	n := uint32(len(p))
+	for i, c := range p {
+		a += uint32(c)
+		b += (n - uint32(i)) * uint32(c)
+	}
+	return a & 0xffff, b & 0xffff
+}
+
+// rollSum 窗口向后移动一个字节：移出out，移入in，n为窗口长度
+func rollSum(a, b uint32, n int, out, in byte) (uint32, uint32) {
+	a = (a - uint32(out) + uint32(in)) & 0xffff
+	b = (b - uint32(n)*uint32(out) + a) & 0xffff
+	return a, b
+}
+
+// computeSignature 按块计算文件的签名
+func computeSignature(r io.Reader, size int64) (*deltaSignature, error) {
+	sig := &deltaSignature{BlockSize: deltaBlockSize(size)}
+	buf := make([]byte, sig.BlockSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			a, b := weakSum(buf[:n])
+			sig.Weak = append(sig.Weak, a|b<<16)
+			sig.Strong = append(sig.Strong, strongSum(buf[:n]))
+			sig.Size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sig, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// deltaWriter 写出增量指令
+type deltaWriter struct {
+	w   *bufio.Writer
+	tmp [binary.MaxVarintLen64 + 1]byte
+}
+
+// op 写出指令类型和一个无符号整数参数
+func (d *deltaWriter) op(kind byte, v uint64) error {
+	d.tmp[0] = kind
+	n := binary.PutUvarint(d.tmp[1:], v)
+	_, err := d.w.Write(d.tmp[:n+1])
+	return err
+}
+
+// literal 写出新数据，过长时拆成多条指令
+func (d *deltaWriter) literal(p []byte) error {
+	for len(p) > 0 {
+		chunk := p[:min(len(p), maxDeltaLiteral)]
+		if err := d.op(deltaOpLiteral, uint64(len(chunk))); err != nil {
+			return err
+		}
+		if _, err := d.w.Write(chunk); err != nil {
+			return err
+		}
+		p = p[len(chunk):]
+	}
+	return nil
+}
+
+// writeDelta 对照旧文件的签名，把src编码为增量指令写入w
+func writeDelta(w io.Writer, src io.Reader, sig *deltaSignature) error {
+	bs := sig.BlockSize
+	// 弱校验和到块序号的索引
+	index := make(map[uint32][]int, len(sig.Weak))
+	for i, weak := range sig.Weak {
+		index[weak] = append(index[weak], i)
+	}
+	// 旧文件最后一块可能不足一整块，只在新文件末尾与之比较
+	last := len(sig.Weak) - 1
+	lastSize := 0
+	if last >= 0 {
+		lastSize = int(sig.Size - int64(last)*int64(bs))
+	}
+
+	hash := sha256.New()
+	out := &deltaWriter{w: bufio.NewWriterSize(w, 64<<10)}
+	in := bufio.NewReaderSize(io.TeeReader(src, hash), 64<<10)
+	// buf中pos之前为尚未发出的新数据，pos开始为当前窗口
+	buf := make([]byte, 0, 2*maxDeltaLiteral+bs)
+	pos := 0
+	var a, b uint32
+	rolling := false
+	eof := false
+
+	match := func(win []byte, weak uint32) int {
+		var strong []byte
+		for _, i := range index[weak] {
+			if (i == last && len(win) != lastSize) || (i != last && len(win) != bs) {
+				continue
+			}
+			if strong == nil {
+				strong = strongSum(win)
+			}
+			if bytes.Equal(strong, sig.Strong[i]) {
+				return i
+			}
+		}
+		return -1
+	}
+	flush := func() error {
+		if err := out.literal(buf[:pos]); err != nil {
+			return err
+		}
+		buf = append(buf[:0], buf[pos:]...)
+		pos = 0
+		return nil
+	}
+
+	for {
+		// 补满窗口
+		for !eof && len(buf)-pos < bs {
+			c, err := in.ReadByte()
+			if err == io.EOF {
+				eof = true
+				break
+			}
+			if err != nil {
+				return err
+			}
+			buf = append(buf, c)
+			rolling = false
+		}
+		win := buf[pos:]
+		if len(win) == 0 {
+			break
+		}
+		if !rolling {
+			a, b = weakSum(win)
+			rolling = true
+		}
+		if len(index) > 0 {
+			if i := match(win, a|b<<16); i >= 0 {
+				if err := flush(); err != nil {
+					return err
+				}
+				if err := out.op(deltaOpCopy, uint64(i)); err != nil {
+					return err
+				}
+				buf = buf[:0]
+				rolling = false
+				continue
+			}
+		}
+		if eof {
+			// 已到末尾：再将末尾与旧文件不足一整块的最后一块比较一次，仍不匹配时剩余数据全部作为新数据
+			if len(win) > lastSize && lastSize < bs {
+				pos = len(buf) - lastSize
+				rolling = false
+				continue
+			}
+			pos = len(buf)
+			break
+		}
+		// 窗口后移一个字节，移出的字节成为新数据
+		c, err := in.ReadByte()
+		if err == io.EOF {
+			eof = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		a, b = rollSum(a, b, bs, buf[pos], c)
+		buf = append(buf, c)
+		pos++
+		if pos >= maxDeltaLiteral {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if err := out.op(deltaOpEnd, 0); err != nil {
+		return err
+	}
+	if _, err := out.w.Write(hash.Sum(nil)); err != nil {
+		return err
+	}
+	return out.w.Flush()
+}
+
+// applyDelta 按增量指令在basis的基础上重建新文件写入dst，重建的文件超过size或校验不一致时返回错误。
+// 块的划分由旧文件的大小basisSize确定，与发送方拿到的签名一致
+func applyDelta(dst io.Writer, delta io.Reader, basis io.ReaderAt, basisSize, size int64) error {
+	in := bufio.NewReaderSize(delta, 64<<10)
+	hash := sha256.New()
+	w := io.MultiWriter(dst, hash)
+	blockSize := int64(deltaBlockSize(basisSize))
+	block := make([]byte, blockSize)
+	var written int64
+	for {
+		kind, err := in.ReadByte()
+		if err != nil {
+			return fmt.Errorf("读取增量数据失败: %w", unexpectedEOF(err))
+		}
+		if kind == deltaOpEnd {
+			if _, err := binary.ReadUvarint(in); err != nil {
+				return fmt.Errorf("读取增量数据失败: %w", unexpectedEOF(err))
+			}
+			var want [sha256.Size]byte
+			if _, err := io.ReadFull(in, want[:]); err != nil {
+				return fmt.Errorf("读取增量数据失败: %w", unexpectedEOF(err))
+			}
+			if written != size || !bytes.Equal(hash.Sum(nil), want[:]) {
+				return errDeltaMismatch
+			}
+			return nil
+		}
+		v, err := binary.ReadUvarint(in)
+		if err != nil {
+			return fmt.Errorf("读取增量数据失败: %w", unexpectedEOF(err))
+		}
+		var n int64
+		switch kind {
+		case deltaOpCopy:
+			if v >= uint64((basisSize+blockSize-1)/blockSize) {
+				return fmt.Errorf("无效的块序号: %d", v)
+			}
+			off := int64(v) * blockSize
+			m, err := basis.ReadAt(block[:min(blockSize, basisSize-off)], off)
+			if err != nil && err != io.EOF {
+				return err
+			}
+			if written+int64(m) > size {
+				return errDeltaMismatch
+			}
+			if _, err := w.Write(block[:m]); err != nil {
+				return err
+			}
+			n = int64(m)
+		case deltaOpLiteral:
+			if v == 0 || v > maxDeltaLiteral || written+int64(v) > size {
+				return fmt.Errorf("无效的数据长度: %d", v)
+			}
+			if n, err = io.CopyN(w, in, int64(v)); err != nil {
+				return fmt.Errorf("读取增量数据失败: %w", unexpectedEOF(err))
+			}
+		default:
+			return fmt.Errorf("无效的增量指令: %q", kind)
+		}
+		written += n
+	}
+}
+
+// unexpectedEOF 增量数据在结束指令之前中断时以io.ErrUnexpectedEOF报告
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// openBasis 打开增量传输的旧文件，不存在或不是普通文件时返回错误
+func openBasis(path string) (*os.File, os.FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s 不是普通文件", path)
+	}
+	return f, info, nil
+}
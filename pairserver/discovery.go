@@ -0,0 +1,329 @@
+package pairserver
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// 局域网发现参数
+const (
+	discoveryInterval = 3 * time.Second  // 广播本机状态的间隔
+	discoveryExpiry   = 10 * time.Second // 超过该时间未收到广播的设备视为已离开
+	discoveryApp      = "pair-gui"       // 广播消息的应用标识，忽略其他程序的消息
+)
+
+// discoveryGroup 实例之间互相发现使用的组播地址（组织内部范围）
+var discoveryGroup = &net.UDPAddr{IP: net.IPv4(239, 255, 10, 82), Port: 41082}
+
+// Peer 局域网中发现的其他pair-gui实例
+type Peer struct {
+	ID        string    // 实例的随机标识
+	Name      string    // 设备名称
+	IP        string    // 设备IP
+	Port      int       // 服务端口，未运行服务时为0
+	HTTPS     bool      // 服务是否使用HTTPS
+	Sharing   bool      // 是否正在运行文件传输服务
+	Files     int       // 分享的文件和目录数量
+	LocalSend bool      // 是否为LocalSend应用
+	LastSeen  time.Time // 最近一次收到广播的时间
+}
+
+// URL 返回设备的服务地址，未运行服务时为空；LocalSend设备为其接收接口的地址
+func (p Peer) URL() string {
+	if !p.Sharing || p.Port == 0 {
+		return ""
+	}
+	scheme := "http"
+	if p.HTTPS {
+		scheme = "https"
+	}
+	base := scheme + "://" + net.JoinHostPort(p.IP, strconv.Itoa(p.Port)) + "/"
+	if p.LocalSend {
+		base += strings.TrimPrefix(localSendAPI, "/")
+	}
+	return base
+}
+
+// PeersHandler 附近设备列表变化时调用，在发现服务的协程中执行
+type PeersHandler func()
+
+// beacon 广播的本机状态
+type beacon struct {
+	App     string `json:"app"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Port    int    `json:"port,omitempty"`
+	HTTPS   bool   `json:"https,omitempty"`
+	Sharing bool   `json:"sharing"`
+	Files   int    `json:"files,omitempty"`
+	Bye     bool   `json:"bye,omitempty"` // 退出前发送，通知其他实例立即移除
+}
+
+// discovery 定期组播本机状态并收集其他实例的广播，同时兼容LocalSend应用的发现协议
+type discovery struct {
+	conn    *net.UDPConn
+	pc      *ipv4.PacketConn
+	lsConn  *net.UDPConn // LocalSend组播连接，端口被占用等无法加入时为nil
+	lsPC    *ipv4.PacketConn
+	id      string
+	name    string
+	done    chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	peers   map[string]Peer
+	handler PeersHandler
+}
+
+// StartDiscovery 开始在局域网中广播本机并发现其他实例，name为显示给其他设备的名称；
+// 与HTTP服务独立，未启动服务时也能被发现。已在运行时先停止
+func (s *Server) StartDiscovery(name string) error {
+	s.StopDiscovery()
+
+	conn, err := net.ListenMulticastUDP("udp4", nil, discoveryGroup)
+	if err != nil {
+		return err
+	}
+	d := &discovery{
+		conn:  conn,
+		pc:    ipv4.NewPacketConn(conn),
+		id:    newSessionID(),
+		name:  name,
+		done:  make(chan struct{}),
+		peers: make(map[string]Peer),
+	}
+	for _, iface := range multicastInterfaces() {
+		d.pc.JoinGroup(&iface, discoveryGroup)
+	}
+	// 同一台电脑上运行的多个实例也能互相发现
+	d.pc.SetMulticastLoopback(true)
+
+	if lsConn, err := net.ListenMulticastUDP("udp4", nil, localSendGroup); err != nil {
+		log.Printf("加入LocalSend组播失败: %v", err)
+	} else {
+		d.lsConn, d.lsPC = lsConn, ipv4.NewPacketConn(lsConn)
+		for _, iface := range multicastInterfaces() {
+			d.lsPC.JoinGroup(&iface, localSendGroup)
+		}
+	}
+
+	s.mu.Lock()
+	d.handler = s.peersHandler
+	s.discovery = d
+	s.mu.Unlock()
+
+	d.wg.Add(2)
+	go d.listen()
+	go d.broadcast(s)
+	if d.lsConn != nil {
+		d.wg.Add(1)
+		go d.listenLocalSend(s)
+	}
+	return nil
+}
+
+// StopDiscovery 停止广播，并通知其他实例移除本机
+func (s *Server) StopDiscovery() {
+	s.mu.Lock()
+	d := s.discovery
+	s.discovery = nil
+	s.mu.Unlock()
+
+	if d == nil {
+		return
+	}
+	close(d.done)
+	d.send(beacon{App: discoveryApp, ID: d.id, Name: d.name, Bye: true})
+	d.conn.Close()
+	if d.lsConn != nil {
+		d.lsConn.Close()
+	}
+	d.wg.Wait()
+}
+
+// Peers 返回附近的设备，按名称排序
+func (s *Server) Peers() []Peer {
+	s.mu.RLock()
+	d := s.discovery
+	s.mu.RUnlock()
+
+	if d == nil {
+		return nil
+	}
+	return d.list()
+}
+
+// SetPeersHandler 设置附近设备列表变化时的回调
+func (s *Server) SetPeersHandler(h PeersHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.peersHandler = h
+	if s.discovery != nil {
+		s.discovery.mu.Lock()
+		s.discovery.handler = h
+		s.discovery.mu.Unlock()
+	}
+}
+
+// status 返回本机当前状态
+func (s *Server) status() beacon {
+	s.mu.RLock()
+	running := s.httpServer != nil
+	b := beacon{
+		App:     discoveryApp,
+		Sharing: running,
+		HTTPS:   running && s.tlsCert != nil,
+		Files:   len(s.files) + len(s.dirs),
+	}
+	if running {
+		b.Port = s.port
+	}
+	s.mu.RUnlock()
+	return b
+}
+
+// broadcast 定期广播本机状态并清理超时的设备
+func (d *discovery) broadcast(s *Server) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(discoveryInterval)
+	defer ticker.Stop()
+	for {
+		b := s.status()
+		b.ID, b.Name = d.id, d.name
+		d.send(b)
+		// LocalSend应用只在启动时广播，定期发送公告使其回应，以便持续显示在设备列表中
+		d.sendLocalSend(s.localSendInfo(true))
+		d.expire()
+
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// send 在每个网卡上组播一条消息
+func (d *discovery) send(b beacon) {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return
+	}
+	for _, iface := range multicastInterfaces() {
+		d.pc.WriteTo(data, &ipv4.ControlMessage{IfIndex: iface.Index}, discoveryGroup)
+	}
+}
+
+// listen 接收其他实例的广播，直到连接关闭
+func (d *discovery) listen() {
+	defer d.wg.Done()
+
+	buf := make([]byte, 2048)
+	for {
+		n, src, err := d.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-d.done:
+			default:
+				log.Printf("接收设备广播失败: %v", err)
+			}
+			return
+		}
+		var b beacon
+		if json.Unmarshal(buf[:n], &b) != nil || b.App != discoveryApp || b.ID == "" || b.ID == d.id {
+			continue
+		}
+		d.update(b, src.IP.String())
+	}
+}
+
+// update 根据收到的广播更新设备列表，列表内容变化时调用回调
+func (d *discovery) update(b beacon, ip string) {
+	if b.Bye {
+		d.remove(b.ID)
+		return
+	}
+	d.add(Peer{
+		ID:       b.ID,
+		Name:     b.Name,
+		IP:       ip,
+		Port:     b.Port,
+		HTTPS:    b.HTTPS,
+		Sharing:  b.Sharing,
+		Files:    b.Files,
+		LastSeen: time.Now(),
+	})
+}
+
+// add 添加或更新设备，列表内容变化时调用回调
+func (d *discovery) add(peer Peer) {
+	d.mu.Lock()
+	old, existed := d.peers[peer.ID]
+	d.peers[peer.ID] = peer
+	old.LastSeen = peer.LastSeen // 只有收到时间变化不算列表变化
+	changed := !existed || old != peer
+	handler := d.handler
+	d.mu.Unlock()
+
+	if changed && handler != nil {
+		handler()
+	}
+}
+
+// remove 移除设备
+func (d *discovery) remove(id string) {
+	d.mu.Lock()
+	_, changed := d.peers[id]
+	delete(d.peers, id)
+	handler := d.handler
+	d.mu.Unlock()
+
+	if changed && handler != nil {
+		handler()
+	}
+}
+
+// expire 移除超时未广播的设备
+func (d *discovery) expire() {
+	d.mu.Lock()
+	changed := false
+	for id, p := range d.peers {
+		if time.Since(p.LastSeen) > discoveryExpiry {
+			delete(d.peers, id)
+			changed = true
+		}
+	}
+	handler := d.handler
+	d.mu.Unlock()
+
+	if changed && handler != nil {
+		handler()
+	}
+}
+
+// list 返回按名称排序的设备列表
+func (d *discovery) list() []Peer {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	peers := make([]Peer, 0, len(d.peers))
+	for _, p := range d.peers {
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		if peers[i].Name != peers[j].Name {
+			return peers[i].Name < peers[j].Name
+		}
+		return peers[i].IP < peers[j].IP
+	})
+	return peers
+}
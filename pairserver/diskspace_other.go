@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package pairserver
+
+import "errors"
+
+// freeSpace 当前平台不支持查询可用空间，调用方跳过检查
+func freeSpace(dir string) (uint64, error) {
+	return 0, errors.New("不支持查询磁盘可用空间")
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package pairserver
+
+import "golang.org/x/sys/windows"
+
+// freeSpace 返回dir所在磁盘中当前用户可用的字节数
+func freeSpace(dir string) (uint64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var avail uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &avail, nil, nil); err != nil {
+		return 0, err
+	}
+	return avail, nil
+}
@@ -0,0 +1,682 @@
+package pairserver
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// DLNA参数
+const (
+	dlnaPrefix         = "/dlna/"
+	dlnaMaxAge         = 1800             // SSDP公告的有效期（秒）
+	dlnaNotifyInterval = 15 * time.Minute // 重新发送公告的间隔，须小于有效期的一半
+	dlnaDeviceType     = "urn:schemas-upnp-org:device:MediaServer:1"
+	dlnaCDS            = "urn:schemas-upnp-org:service:ContentDirectory:1"
+	dlnaCMS            = "urn:schemas-upnp-org:service:ConnectionManager:1"
+	dlnaRootID         = "0"
+	dlnaContentFlags   = "DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=01700000000000000000000000000000"
+)
+
+// dlnaServer 运行中的DLNA媒体服务器：通过SSDP公告并响应搜索，内容目录和媒体流由HTTP服务提供
+type dlnaServer struct {
+	conn *net.UDPConn
+	pc   *ipv4.PacketConn
+	uuid string
+	name string
+	port int
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// SetDLNAName 设置DLNA媒体服务器在电视等设备上显示的名称，空表示不提供DLNA；下次启动服务时生效。
+// 分享的视频、音乐和图片，以及共享目录中的媒体文件可在局域网的播放器中直接浏览播放，无需PIN码和访问令牌；
+// 启用HTTPS或基本认证时不提供，端口映射或洋葱服务开启期间拒绝全部DLNA请求
+func (s *Server) SetDLNAName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dlnaName = name
+}
+
+// DLNAEnabled 返回DLNA媒体服务器是否正在运行
+func (s *Server) DLNAEnabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.dlna != nil
+}
+
+// startDLNA 按当前设置开始公告媒体服务器，失败时只记录日志，不影响HTTP服务。
+// 电视等设备普遍不接受自签名证书，启用HTTPS时不提供DLNA；播放器也无法输入密码，启用基本认证时同样不提供
+func (s *Server) startDLNA() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dlnaName == "" {
+		return
+	}
+	if s.tlsCert != nil {
+		log.Printf("DLNA不支持HTTPS，未启动媒体服务器")
+		return
+	}
+	if s.basicPass != "" {
+		log.Printf("DLNA不支持HTTP基本认证，未启动媒体服务器")
+		return
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, ssdpAddr)
+	if err != nil {
+		log.Printf("启动DLNA媒体服务器失败: %v", err)
+		return
+	}
+	d := &dlnaServer{
+		conn: conn,
+		pc:   ipv4.NewPacketConn(conn),
+		uuid: dlnaUUID(s.dlnaName),
+		name: s.dlnaName,
+		port: s.port,
+		done: make(chan struct{}),
+	}
+	for _, iface := range multicastInterfaces() {
+		d.pc.JoinGroup(&iface, ssdpAddr)
+	}
+	s.dlna = d
+	d.wg.Add(2)
+	go d.listen()
+	go d.announce()
+	log.Printf("DLNA媒体服务器: %s", d.name)
+}
+
+// stopDLNA 停止公告，并通知局域网中的设备移除媒体服务器
+func (s *Server) stopDLNA() {
+	s.mu.Lock()
+	d := s.dlna
+	s.dlna = nil
+	s.mu.Unlock()
+
+	if d == nil {
+		return
+	}
+	close(d.done)
+	d.notify("ssdp:byebye")
+	d.conn.Close()
+	d.wg.Wait()
+}
+
+// dlnaUUID 根据名称和主机名生成固定的设备UUID，重启后电视仍将其识别为同一台媒体服务器
+func dlnaUUID(name string) string {
+	host, _ := os.Hostname()
+	sum := sha1.Sum([]byte("pair-gui/dlna/" + host + "/" + name))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// targets 返回SSDP公告和搜索的目标类型
+func (d *dlnaServer) targets() []string {
+	return []string{"upnp:rootdevice", "uuid:" + d.uuid, dlnaDeviceType, dlnaCDS, dlnaCMS}
+}
+
+// usn 返回目标类型对应的唯一服务名
+func (d *dlnaServer) usn(target string) string {
+	if strings.HasPrefix(target, "uuid:") {
+		return target
+	}
+	return "uuid:" + d.uuid + "::" + target
+}
+
+// location 返回设备描述的地址，ip为本机在对应网络中的地址
+func (d *dlnaServer) location(ip string) string {
+	return fmt.Sprintf("http://%s:%d%sdevice.xml", ip, d.port, dlnaPrefix)
+}
+
+// announce 定期在每个网卡上发送存活公告
+func (d *dlnaServer) announce() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(dlnaNotifyInterval)
+	defer ticker.Stop()
+	for {
+		d.notify("ssdp:alive")
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// notify 在每个网卡上组播公告，nts为ssdp:alive或ssdp:byebye
+func (d *dlnaServer) notify(nts string) {
+	for _, iface := range multicastInterfaces() {
+		ip := interfaceIPv4(iface)
+		if ip == nil {
+			continue
+		}
+		for _, target := range d.targets() {
+			var b bytes.Buffer
+			fmt.Fprintf(&b, "NOTIFY * HTTP/1.1\r\nHOST: %s\r\nNT: %s\r\nNTS: %s\r\nUSN: %s\r\n", ssdpAddr, target, nts, d.usn(target))
+			if nts == "ssdp:alive" {
+				fmt.Fprintf(&b, "CACHE-CONTROL: max-age=%d\r\nLOCATION: %s\r\nSERVER: %s\r\n", dlnaMaxAge, d.location(ip.String()), dlnaServerHeader)
+			}
+			b.WriteString("\r\n")
+			d.pc.WriteTo(b.Bytes(), &ipv4.ControlMessage{IfIndex: iface.Index}, ssdpAddr)
+		}
+	}
+}
+
+// dlnaServerHeader SSDP消息和HTTP响应中的SERVER头
+const dlnaServerHeader = "pair-gui UPnP/1.0 DLNADOC/1.50"
+
+// listen 响应局域网中的SSDP搜索，直到连接关闭
+func (d *dlnaServer) listen() {
+	defer d.wg.Done()
+
+	buf := make([]byte, 2048)
+	for {
+		n, src, err := d.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-d.done:
+			default:
+				log.Printf("接收SSDP搜索失败: %v", err)
+			}
+			return
+		}
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(buf[:n])))
+		if err != nil || req.Method != "M-SEARCH" || req.Header.Get("Man") != `"ssdp:discover"` {
+			continue
+		}
+		ip := localIPFor(src.IP)
+		if ip == nil {
+			continue
+		}
+		st := req.Header.Get("St")
+		for _, target := range d.targets() {
+			if st != "ssdp:all" && st != target {
+				continue
+			}
+			resp := fmt.Sprintf("HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=%d\r\nEXT:\r\nLOCATION: %s\r\nSERVER: %s\r\nST: %s\r\nUSN: %s\r\n\r\n",
+				dlnaMaxAge, d.location(ip.String()), dlnaServerHeader, target, d.usn(target))
+			d.conn.WriteToUDP([]byte(resp), src)
+		}
+	}
+}
+
+// interfaceIPv4 返回网卡的第一个IPv4地址
+func interfaceIPv4(iface net.Interface) net.IP {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+			return ipnet.IP.To4()
+		}
+	}
+	return nil
+}
+
+// localIPFor 返回本机与remote处于同一网段的IPv4地址
+func localIPFor(remote net.IP) net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil && ipnet.Contains(remote) {
+			return ipnet.IP.To4()
+		}
+	}
+	return nil
+}
+
+// dlnaHandler DLNA的设备描述、服务描述、控制、事件订阅和媒体流接口；
+// 电视等播放器无法输入PIN码，因此不要求PIN码和访问令牌，服务从外网可访问时返回403
+func (s *Server) dlnaHandler(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	d := s.dlna
+	s.mu.RUnlock()
+	if d == nil {
+		http.NotFound(w, r)
+		return
+	}
+	// 不要求PIN码和访问令牌，只能在局域网中提供；通过端口映射或洋葱服务从外网访问时拒绝
+	if s.publiclyExposed() {
+		http.Error(w, "从外网访问时不提供DLNA", http.StatusForbidden)
+		return
+	}
+	if s.shareExpired() {
+		http.Error(w, "分享链接已过期", http.StatusGone)
+		return
+	}
+
+	w.Header().Set("Server", dlnaServerHeader)
+	switch strings.TrimPrefix(r.URL.Path, dlnaPrefix) {
+	case "device.xml":
+		writeXML(w, fmt.Sprintf(dlnaDeviceXML, xmlEscape(d.name), d.uuid, dlnaDeviceType, dlnaCDS, dlnaCMS, dlnaPrefix))
+	case "cds.xml":
+		writeXML(w, dlnaCDSXML)
+	case "cms.xml":
+		writeXML(w, dlnaCMSXML)
+	case "control/cds":
+		s.dlnaControl(w, r, dlnaCDS)
+	case "control/cms":
+		s.dlnaControl(w, r, dlnaCMS)
+	case "event/cds", "event/cms":
+		// 内容不会主动通知变化，只接受订阅以兼容要求订阅成功的播放器
+		if r.Method == "SUBSCRIBE" {
+			w.Header().Set("SID", "uuid:"+newSessionID())
+			w.Header().Set("TIMEOUT", fmt.Sprintf("Second-%d", dlnaMaxAge))
+		}
+		w.WriteHeader(http.StatusOK)
+	case "media":
+		s.trackTransfer(s.dlnaMediaHandler)(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// writeXML 写入XML响应
+func writeXML(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	fmt.Fprint(w, xml.Header+body)
+}
+
+// xmlEscape 转义XML文本
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// soapRequest SOAP请求，只关心操作名和参数
+type soapRequest struct {
+	Body struct {
+		Action struct {
+			XMLName xml.Name
+			Args    []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+// dlnaControl 处理ContentDirectory和ConnectionManager服务的SOAP调用
+func (s *Server) dlnaControl(w http.ResponseWriter, r *http.Request, service string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+	var req soapRequest
+	if err := xml.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushRequestSize)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("解析请求失败: %v", err), http.StatusBadRequest)
+		return
+	}
+	action := req.Body.Action.XMLName.Local
+	args := make(map[string]string)
+	for _, a := range req.Body.Action.Args {
+		args[a.XMLName.Local] = a.Value
+	}
+
+	var result [][2]string
+	switch service + "#" + action {
+	case dlnaCDS + "#Browse":
+		var err error
+		if result, err = s.dlnaBrowse(r, args); err != nil {
+			writeSOAPFault(w, 701, "No such object")
+			return
+		}
+	case dlnaCDS + "#GetSearchCapabilities":
+		result = [][2]string{{"SearchCaps", ""}}
+	case dlnaCDS + "#GetSortCapabilities":
+		result = [][2]string{{"SortCaps", ""}}
+	case dlnaCDS + "#GetSystemUpdateID":
+		result = [][2]string{{"Id", "0"}}
+	case dlnaCMS + "#GetProtocolInfo":
+		result = [][2]string{{"Source", "http-get:*:video/*:*,http-get:*:audio/*:*,http-get:*:image/*:*"}, {"Sink", ""}}
+	case dlnaCMS + "#GetCurrentConnectionIDs":
+		result = [][2]string{{"ConnectionIDs", "0"}}
+	default:
+		writeSOAPFault(w, 401, "Invalid Action")
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><u:%sResponse xmlns:u="%s">`, action, service)
+	for _, kv := range result {
+		fmt.Fprintf(&b, "<%s>%s</%s>", kv[0], xmlEscape(kv[1]), kv[0])
+	}
+	fmt.Fprintf(&b, "</u:%sResponse></s:Body></s:Envelope>", action)
+	writeXML(w, b.String())
+}
+
+// writeSOAPFault 返回UPnP错误
+func writeSOAPFault(w http.ResponseWriter, code int, desc string) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, `%s<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>%d</errorCode><errorDescription>%s</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`,
+		xml.Header, code, desc)
+}
+
+// dlnaObject 内容目录中的一项：根目录、共享目录或媒体文件
+type dlnaObject struct {
+	ID       string
+	ParentID string
+	Title    string
+	IsDir    bool
+	Children int
+	MimeType string
+	Size     int64
+	ModTime  time.Time
+}
+
+// dlnaMimeTypes 系统MIME数据库可能缺少的常见媒体类型
+var dlnaMimeTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mkv":  "video/x-matroska",
+	".avi":  "video/x-msvideo",
+	".mov":  "video/quicktime",
+	".ts":   "video/mp2t",
+	".webm": "video/webm",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".flac": "audio/flac",
+	".wav":  "audio/wav",
+	".ogg":  "audio/ogg",
+}
+
+// dlnaMediaType 返回可在播放器中播放的媒体类型，其他文件返回空
+func dlnaMediaType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	t, ok := dlnaMimeTypes[ext]
+	if !ok {
+		t = mimeType(name)
+	}
+	for _, prefix := range []string{"video/", "audio/", "image/"} {
+		if strings.HasPrefix(t, prefix) {
+			return t
+		}
+	}
+	return ""
+}
+
+// dlnaChildren 返回容器中的媒体文件和子目录。根目录包含分享的媒体文件和共享目录，
+// 对象ID为 f/文件名 或 d/浏览路径
+func (s *Server) dlnaChildren(id string) ([]dlnaObject, error) {
+	var objects []dlnaObject
+	if id == dlnaRootID {
+		for _, f := range s.publicFiles() {
+			if t := dlnaMediaType(f.Filename); t != "" {
+				if info, err := os.Stat(f.AbsPath); err == nil {
+					objects = append(objects, dlnaObject{ID: "f/" + f.Filename, ParentID: id, Title: f.Filename, MimeType: t, Size: info.Size(), ModTime: info.ModTime()})
+				}
+			}
+		}
+		for _, d := range s.Dirs() {
+			objects = append(objects, dlnaObject{ID: "d/" + d.Name, ParentID: id, Title: d.Name, IsDir: true, Children: dirEntryCount(d.AbsPath)})
+		}
+		return objects, nil
+	}
+
+	p, ok := strings.CutPrefix(id, "d/")
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	entries, err := s.listShared(p)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		obj := dlnaObject{ID: "d/" + e.Path, ParentID: id, Title: e.Name, IsDir: e.IsDir}
+		abs, err := s.resolveShared(e.Path)
+		if err != nil {
+			continue
+		}
+		if e.IsDir {
+			obj.Children = dirEntryCount(abs)
+		} else {
+			if obj.MimeType = dlnaMediaType(e.Name); obj.MimeType == "" {
+				continue
+			}
+			if info, err := os.Stat(abs); err == nil {
+				obj.Size, obj.ModTime = info.Size(), info.ModTime()
+			}
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// dirEntryCount 返回目录中的项数；部分播放器不显示子项数为0的目录，因此无需精确过滤非媒体文件
+func dirEntryCount(dir string) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	return len(entries)
+}
+
+// dlnaLookup 返回对象本身的信息
+func (s *Server) dlnaLookup(id string) (dlnaObject, error) {
+	if id == dlnaRootID {
+		children, err := s.dlnaChildren(id)
+		return dlnaObject{ID: id, ParentID: "-1", Title: "pair-gui", IsDir: true, Children: len(children)}, err
+	}
+	abs, err := s.dlnaPath(id)
+	if err != nil {
+		return dlnaObject{}, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return dlnaObject{}, err
+	}
+
+	obj := dlnaObject{ID: id, ParentID: dlnaRootID, Title: path.Base(id), IsDir: info.IsDir(), Size: info.Size(), ModTime: info.ModTime()}
+	if p, ok := strings.CutPrefix(id, "d/"); ok && strings.Contains(p, "/") {
+		obj.ParentID = "d/" + path.Dir(p)
+	}
+	if obj.IsDir {
+		children, _ := s.dlnaChildren(id)
+		obj.Children = len(children)
+	} else if obj.MimeType = dlnaMediaType(obj.Title); obj.MimeType == "" {
+		return dlnaObject{}, os.ErrNotExist
+	}
+	return obj, nil
+}
+
+// dlnaPath 将对象ID解析为磁盘上的路径
+func (s *Server) dlnaPath(id string) (string, error) {
+	if name, ok := strings.CutPrefix(id, "f/"); ok {
+		f, found := s.findFile(name)
+		if !found || f.Protected() {
+			return "", os.ErrNotExist
+		}
+		return f.AbsPath, nil
+	}
+	if p, ok := strings.CutPrefix(id, "d/"); ok {
+		return s.resolveShared(p)
+	}
+	return "", os.ErrNotExist
+}
+
+// dlnaBrowse 处理Browse调用，返回DIDL-Lite格式的结果
+func (s *Server) dlnaBrowse(r *http.Request, args map[string]string) ([][2]string, error) {
+	id := args["ObjectID"]
+	var objects []dlnaObject
+	total := 1
+	if args["BrowseFlag"] == "BrowseMetadata" {
+		obj, err := s.dlnaLookup(id)
+		if err != nil {
+			return nil, err
+		}
+		objects = []dlnaObject{obj}
+	} else {
+		children, err := s.dlnaChildren(id)
+		if err != nil {
+			return nil, err
+		}
+		total = len(children)
+		start, _ := strconv.Atoi(args["StartingIndex"])
+		count, _ := strconv.Atoi(args["RequestedCount"])
+		start = min(max(start, 0), total)
+		end := total
+		if count > 0 {
+			end = min(start+count, total)
+		}
+		objects = children[start:end]
+	}
+
+	base := "http://" + r.Host + dlnaPrefix + "media?id="
+	var b strings.Builder
+	b.WriteString(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">`)
+	for _, o := range objects {
+		if o.IsDir {
+			fmt.Fprintf(&b, `<container id="%s" parentID="%s" childCount="%d" restricted="1"><dc:title>%s</dc:title><upnp:class>object.container.storageFolder</upnp:class></container>`,
+				xmlEscape(o.ID), xmlEscape(o.ParentID), o.Children, xmlEscape(o.Title))
+			continue
+		}
+		fmt.Fprintf(&b, `<item id="%s" parentID="%s" restricted="1"><dc:title>%s</dc:title><upnp:class>%s</upnp:class>`,
+			xmlEscape(o.ID), xmlEscape(o.ParentID), xmlEscape(o.Title), dlnaClass(o.MimeType))
+		if !o.ModTime.IsZero() {
+			fmt.Fprintf(&b, "<dc:date>%s</dc:date>", o.ModTime.Format("2006-01-02T15:04:05"))
+		}
+		fmt.Fprintf(&b, `<res protocolInfo="http-get:*:%s:%s" size="%d">%s</res></item>`,
+			o.MimeType, dlnaContentFlags, o.Size, xmlEscape(base+url.QueryEscape(o.ID)))
+	}
+	b.WriteString("</DIDL-Lite>")
+
+	return [][2]string{
+		{"Result", b.String()},
+		{"NumberReturned", strconv.Itoa(len(objects))},
+		{"TotalMatches", strconv.Itoa(total)},
+		{"UpdateID", "0"},
+	}, nil
+}
+
+// dlnaClass 返回媒体类型对应的UPnP类别
+func dlnaClass(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "video/"):
+		return "object.item.videoItem"
+	case strings.HasPrefix(mimeType, "audio/"):
+		return "object.item.audioItem.musicTrack"
+	default:
+		return "object.item.imageItem.photo"
+	}
+}
+
+// dlnaMediaHandler 向播放器提供媒体流，支持Range请求以便拖动进度
+func (s *Server) dlnaMediaHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	abs, err := s.dlnaPath(id)
+	mimeType := dlnaMediaType(id)
+	if err != nil || mimeType == "" {
+		http.NotFound(w, r)
+		return
+	}
+	file, err := os.Open(abs)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("transferMode.dlna.org", "Streaming")
+	w.Header().Set("contentFeatures.dlna.org", dlnaContentFlags)
+	http.ServeContent(w, r, info.Name(), info.ModTime(), newRateLimitedReadSeeker(r.Context(), file, s.RateLimit()))
+}
+
+// dlnaDeviceXML 设备描述，参数依次为名称、UUID、设备类型、两个服务类型和接口前缀
+const dlnaDeviceXML = `<root xmlns="urn:schemas-upnp-org:device-1-0" xmlns:dlna="urn:schemas-dlna-org:device-1-0">
+<specVersion><major>1</major><minor>0</minor></specVersion>
+<device>
+<deviceType>%[3]s</deviceType>
+<friendlyName>%[1]s</friendlyName>
+<manufacturer>pair-gui</manufacturer>
+<modelName>pair-gui</modelName>
+<UDN>uuid:%[2]s</UDN>
+<dlna:X_DLNADOC>DMS-1.50</dlna:X_DLNADOC>
+<serviceList>
+<service><serviceType>%[4]s</serviceType><serviceId>urn:upnp-org:serviceId:ContentDirectory</serviceId><SCPDURL>%[6]scds.xml</SCPDURL><controlURL>%[6]scontrol/cds</controlURL><eventSubURL>%[6]sevent/cds</eventSubURL></service>
+<service><serviceType>%[5]s</serviceType><serviceId>urn:upnp-org:serviceId:ConnectionManager</serviceId><SCPDURL>%[6]scms.xml</SCPDURL><controlURL>%[6]scontrol/cms</controlURL><eventSubURL>%[6]sevent/cms</eventSubURL></service>
+</serviceList>
+</device>
+</root>`
+
+// dlnaCDSXML ContentDirectory服务描述
+const dlnaCDSXML = `<scpd xmlns="urn:schemas-upnp-org:service-1-0">
+<specVersion><major>1</major><minor>0</minor></specVersion>
+<actionList>
+<action><name>Browse</name><argumentList>
+<argument><name>ObjectID</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_ObjectID</relatedStateVariable></argument>
+<argument><name>BrowseFlag</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_BrowseFlag</relatedStateVariable></argument>
+<argument><name>Filter</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_Filter</relatedStateVariable></argument>
+<argument><name>StartingIndex</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_Index</relatedStateVariable></argument>
+<argument><name>RequestedCount</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_Count</relatedStateVariable></argument>
+<argument><name>SortCriteria</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_SortCriteria</relatedStateVariable></argument>
+<argument><name>Result</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_Result</relatedStateVariable></argument>
+<argument><name>NumberReturned</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_Count</relatedStateVariable></argument>
+<argument><name>TotalMatches</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_Count</relatedStateVariable></argument>
+<argument><name>UpdateID</name><direction>out</direction><relatedStateVariable>A_ARG_TYPE_UpdateID</relatedStateVariable></argument>
+</argumentList></action>
+<action><name>GetSearchCapabilities</name><argumentList><argument><name>SearchCaps</name><direction>out</direction><relatedStateVariable>SearchCapabilities</relatedStateVariable></argument></argumentList></action>
+<action><name>GetSortCapabilities</name><argumentList><argument><name>SortCaps</name><direction>out</direction><relatedStateVariable>SortCapabilities</relatedStateVariable></argument></argumentList></action>
+<action><name>GetSystemUpdateID</name><argumentList><argument><name>Id</name><direction>out</direction><relatedStateVariable>SystemUpdateID</relatedStateVariable></argument></argumentList></action>
+</actionList>
+<serviceStateTable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_ObjectID</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_BrowseFlag</name><dataType>string</dataType><allowedValueList><allowedValue>BrowseMetadata</allowedValue><allowedValue>BrowseDirectChildren</allowedValue></allowedValueList></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_Filter</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_Index</name><dataType>ui4</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_Count</name><dataType>ui4</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_SortCriteria</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_Result</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_UpdateID</name><dataType>ui4</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>SearchCapabilities</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>SortCapabilities</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="yes"><name>SystemUpdateID</name><dataType>ui4</dataType></stateVariable>
+</serviceStateTable>
+</scpd>`
+
+// dlnaCMSXML ConnectionManager服务描述
+const dlnaCMSXML = `<scpd xmlns="urn:schemas-upnp-org:service-1-0">
+<specVersion><major>1</major><minor>0</minor></specVersion>
+<actionList>
+<action><name>GetProtocolInfo</name><argumentList>
+<argument><name>Source</name><direction>out</direction><relatedStateVariable>SourceProtocolInfo</relatedStateVariable></argument>
+<argument><name>Sink</name><direction>out</direction><relatedStateVariable>SinkProtocolInfo</relatedStateVariable></argument>
+</argumentList></action>
+<action><name>GetCurrentConnectionIDs</name><argumentList>
+<argument><name>ConnectionIDs</name><direction>out</direction><relatedStateVariable>CurrentConnectionIDs</relatedStateVariable></argument>
+</argumentList></action>
+</actionList>
+<serviceStateTable>
+<stateVariable sendEvents="yes"><name>SourceProtocolInfo</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="yes"><name>SinkProtocolInfo</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="yes"><name>CurrentConnectionIDs</name><dataType>string</dataType></stateVariable>
+</serviceStateTable>
+</scpd>`
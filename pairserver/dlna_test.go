@@ -0,0 +1,40 @@
+package pairserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestDLNAPubliclyExposed DLNA不要求PIN码和访问令牌，端口映射或洋葱服务开启时拒绝全部请求
+func TestDLNAPubliclyExposed(t *testing.T) {
+	s, h := newRegistryServer(t, 1)
+	s.mu.Lock()
+	s.dlna = &dlnaServer{uuid: dlnaUUID("test"), name: "test"}
+	s.mu.Unlock()
+
+	paths := []string{dlnaPrefix + "device.xml", dlnaPrefix + "media?file=" + s.Files()[0].Filename}
+	for _, p := range paths {
+		if code := serve(h, httptest.NewRequest(http.MethodGet, p, nil)); code == http.StatusForbidden {
+			t.Errorf("局域网访问 %s 返回403", p)
+		}
+	}
+
+	for _, expose := range []func(){
+		func() { s.onion = &onionService{} },
+		func() { s.portMap = &activeMapping{} },
+	} {
+		s.mu.Lock()
+		s.onion, s.portMap = nil, nil
+		expose()
+		s.mu.Unlock()
+		for _, p := range paths {
+			if code := serve(h, httptest.NewRequest(http.MethodGet, p, nil)); code != http.StatusForbidden {
+				t.Errorf("外网可访问时 %s 返回 %d，应为403", p, code)
+			}
+		}
+	}
+	s.mu.Lock()
+	s.onion, s.portMap = nil, nil
+	s.mu.Unlock()
+}
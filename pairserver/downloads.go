@@ -0,0 +1,231 @@
+package pairserver
+
+import (
+	"cmp"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Exhausted 返回文件是否已达到下载次数上限
+func (f File) Exhausted() bool {
+	return f.MaxDownloads > 0 && f.Downloads >= f.MaxDownloads
+}
+
+// available 返回文件是否仍可下载：未过期且未达到下载次数上限
+func (f File) available() bool {
+	return !f.Expired() && !f.Exhausted()
+}
+
+// SetFileMaxDownloads 设置下载列表中单个文件允许完整下载的次数，达到后该文件不再列出，下载返回410；
+// 0表示不限。文件不在下载列表中时返回false
+func (s *Server) SetFileMaxDownloads(absPath string, n int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.files {
+		if s.files[i].AbsPath == absPath {
+			s.files[i].MaxDownloads = max(n, 0)
+			s.publish(EventFilesChanged, nil)
+			return true
+		}
+	}
+	return false
+}
+
+// countDownloads 为完整下载过的分享文件增加下载次数，不在下载列表中的路径忽略
+func (s *Server) countDownloads(paths ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.countDownloadsLocked(paths...)
+}
+
+// countDownloadsLocked 同countDownloads，调用时须持有s.mu
+func (s *Server) countDownloadsLocked(paths ...string) {
+	changed := false
+	for _, p := range paths {
+		for i := range s.files {
+			if s.files[i].AbsPath == p {
+				s.files[i].Downloads++
+				changed = true
+			}
+		}
+	}
+	if changed {
+		s.publish(EventFilesChanged, nil)
+	}
+}
+
+// downloadSlot 完整下载开始时预留的下载次数。下载次数在下载完成后才增加，
+// 限次文件若只在开始时检查，同时发起的多个下载都能通过；预留后并发的下载也不会超过上限。
+// 下载完成时计入下载次数，失败或取消时归还
+type downloadSlot struct {
+	s     *Server
+	paths []string // 下载的全部文件
+	held  []string // 其中预留了次数的限次文件
+	once  sync.Once
+}
+
+// reserveDownload 为即将完整下载的文件预留下载次数，其中任一文件已无剩余次数时不预留并返回false
+func (s *Server) reserveDownload(files ...File) (*downloadSlot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := &downloadSlot{s: s}
+	for _, f := range files {
+		d.paths = append(d.paths, f.AbsPath)
+		for i := range s.files {
+			sf := &s.files[i]
+			if sf.AbsPath != f.AbsPath || sf.MaxDownloads == 0 {
+				continue
+			}
+			if sf.Downloads+sf.reserved >= sf.MaxDownloads {
+				d.releaseLocked()
+				return nil, false
+			}
+			sf.reserved++
+			d.held = append(d.held, sf.AbsPath)
+		}
+	}
+	return d, true
+}
+
+// finish 结算预留的次数：completed为true时计入下载次数，否则归还。只有第一次调用有效
+func (d *downloadSlot) finish(completed bool) {
+	d.once.Do(func() {
+		d.s.mu.Lock()
+		defer d.s.mu.Unlock()
+
+		d.releaseLocked()
+		if completed {
+			d.s.countDownloadsLocked(d.paths...)
+		}
+	})
+}
+
+// releaseLocked 归还预留的次数，调用时须持有s.mu
+func (d *downloadSlot) releaseLocked() {
+	for _, p := range d.held {
+		for i := range d.s.files {
+			if d.s.files[i].AbsPath == p && d.s.files[i].reserved > 0 {
+				d.s.files[i].reserved--
+			}
+		}
+	}
+	d.held = nil
+}
+
+// reserveRequestDownload 下载单个文件的请求开始时预留下载次数，预留记在请求的传输上，传输结束时结算。
+// 范围覆盖整个文件的Range请求（如bytes=0-）同样取得整个文件，与完整下载一样预留，完整发送后计入次数；
+// 只取文件一部分的Range请求（拖动播放、bytes=-1）不预留，但文件已无剩余次数时同样拒绝。HEAD请求不预留。
+// 已无剩余次数时返回410和false
+func (s *Server) reserveRequestDownload(w http.ResponseWriter, r *http.Request, f File) bool {
+	t := requestTransfer(r)
+	if t == nil || r.Method != http.MethodGet {
+		return true
+	}
+	if rng := r.Header.Get("Range"); rng != "" {
+		info, err := os.Stat(f.AbsPath)
+		if err == nil && !rangeCoversFile(rng, info.Size()) {
+			if !s.downloadAvailable(f) {
+				http.Error(w, "文件的下载次数已用完", http.StatusGone)
+				return false
+			}
+			return true
+		}
+	}
+	slot, ok := s.reserveDownload(f)
+	if !ok {
+		http.Error(w, "文件的下载次数已用完", http.StatusGone)
+		return false
+	}
+	t.setSlot(slot)
+	return true
+}
+
+// downloadAvailable 返回文件是否还有未被使用或预留的下载次数
+func (s *Server) downloadAvailable(f File) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, sf := range s.files {
+		if sf.AbsPath == f.AbsPath && sf.MaxDownloads > 0 && sf.Downloads+sf.reserved >= sf.MaxDownloads {
+			return false
+		}
+	}
+	return true
+}
+
+// rangeCoversFile 返回Range请求头中的范围合起来是否覆盖大小为size的整个文件（如bytes=0-），
+// 只取文件一部分的请求（如bytes=100-、bytes=-1）返回false；无法解析的请求头按完整下载处理
+func rangeCoversFile(header string, size int64) bool {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return true
+	}
+	type span struct{ start, end int64 } // 左闭右开
+	var spans []span
+	for _, ra := range strings.Split(spec, ",") {
+		start, end, ok := strings.Cut(strings.TrimSpace(ra), "-")
+		if !ok {
+			return true
+		}
+		start, end = strings.TrimSpace(start), strings.TrimSpace(end)
+		var sp span
+		switch {
+		case start == "":
+			// bytes=-N为最后N个字节
+			n, err := strconv.ParseInt(end, 10, 64)
+			if err != nil {
+				return true
+			}
+			sp = span{max(size-n, 0), size}
+		default:
+			first, err := strconv.ParseInt(start, 10, 64)
+			if err != nil {
+				return true
+			}
+			sp = span{first, size}
+			if end != "" {
+				last, err := strconv.ParseInt(end, 10, 64)
+				if err != nil {
+					return true
+				}
+				sp.end = min(last+1, size)
+			}
+		}
+		spans = append(spans, sp)
+	}
+	slices.SortFunc(spans, func(a, b span) int { return cmp.Compare(a.start, b.start) })
+	covered := int64(0)
+	for _, sp := range spans {
+		if sp.start > covered {
+			return false
+		}
+		covered = max(covered, sp.end)
+	}
+	return covered >= size
+}
+
+// rangeCompleted 返回传输是否为完整发送的Range响应。覆盖整个文件的Range请求预留了下载次数，
+// 完整发送后计入
+func (t *transfer) rangeCompleted() bool {
+	snap := t.snapshot()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.status == http.StatusPartialContent && !t.failed && !t.canceled() &&
+		snap.Total >= 0 && snap.Done >= snap.Total
+}
+
+// setSlot 将预留的下载次数记在传输上，传输结束时结算
+func (t *transfer) setSlot(slot *downloadSlot) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.slot = slot
+}
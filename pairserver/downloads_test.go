@@ -0,0 +1,177 @@
+package pairserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestMaxDownloadsConcurrent 同时发起的多个下载不能超过文件的下载次数上限；
+// 失败的下载归还预留的次数
+func TestMaxDownloadsConcurrent(t *testing.T) {
+	s, h := newRegistryServer(t, 1)
+	f := s.Files()[0]
+	s.SetFileMaxDownloads(f.AbsPath, 2)
+	s.SetRateLimit(256) // 下载持续一段时间，使请求确实并发
+
+	var ok, gone atomic.Int32
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch serve(h, httptest.NewRequest(http.MethodGet, "/download?file="+f.Filename, nil)) {
+			case http.StatusOK:
+				ok.Add(1)
+			case http.StatusGone:
+				gone.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if ok.Load() != 2 || gone.Load() != 6 {
+		t.Fatalf("%d 个下载成功、%d 个返回410，应为2和6", ok.Load(), gone.Load())
+	}
+	if got := s.Files()[0]; got.Downloads != 2 || got.reserved != 0 {
+		t.Errorf("下载次数 %d、预留 %d，应为2和0", got.Downloads, got.reserved)
+	}
+
+	// 未完成的下载不计入次数
+	s.SetFileMaxDownloads(f.AbsPath, 3)
+	r := httptest.NewRequest(http.MethodGet, "/download?file="+f.Filename, nil)
+	r.Header.Set("Range", "bytes=0-9")
+	if code := serve(h, r); code != http.StatusPartialContent {
+		t.Fatalf("Range请求返回 %d", code)
+	}
+	if got := s.Files()[0]; got.Downloads != 2 || got.reserved != 0 {
+		t.Errorf("Range请求后下载次数 %d、预留 %d，应为2和0", got.Downloads, got.reserved)
+	}
+	if code := serve(h, httptest.NewRequest(http.MethodGet, "/download?file="+f.Filename, nil)); code != http.StatusOK {
+		t.Errorf("仍有剩余次数时下载返回 %d", code)
+	}
+}
+
+// TestMaxDownloadsDAVAndFTP 通过WebDAV和FTP的完整下载同样预留下载次数：进行中的下载占用次数，
+// 中断的下载归还，完成的下载计入
+func TestMaxDownloadsDAVAndFTP(t *testing.T) {
+	s, h := newRegistryServer(t, 1)
+	s.SetWebDAV(true)
+	f := s.Files()[0]
+	// 足够大的文件，客户端不读取时下载停在发送缓冲区满的位置
+	if err := os.WriteFile(f.AbsPath, make([]byte, 32<<20), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s.SetFileMaxDownloads(f.AbsPath, 1)
+	waitReleased := func() {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); s.Files()[0].reserved != 0; {
+			if time.Now().After(deadline) {
+				t.Fatal("中断的下载未归还预留的次数")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + davPrefix + f.Filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("WebDAV下载返回 %d", resp.StatusCode)
+	}
+	if code := serve(h, httptest.NewRequest(http.MethodGet, davPrefix+f.Filename, nil)); code != http.StatusGone {
+		t.Errorf("下载进行中时WebDAV返回 %d，应为410", code)
+	}
+	resp.Body.Close()
+	waitReleased()
+
+	c1, addr := newFTPTestServer(t, s, t.TempDir())
+	conn, code := c1.open("RETR /" + f.Filename)
+	if conn == nil {
+		t.Fatalf("FTP下载返回 %d", code)
+	}
+	c2 := dialFTP(t, addr)
+	if code := c2.retrieve("/" + f.Filename); code != 550 {
+		t.Errorf("下载进行中时FTP返回 %d，应为550", code)
+	}
+	c1.finish(conn)
+	waitReleased()
+
+	if code := c2.retrieve("/" + f.Filename); code != 226 {
+		t.Errorf("归还次数后FTP下载返回 %d", code)
+	}
+	if got := s.Files()[0]; got.Downloads != 1 || got.reserved != 0 {
+		t.Errorf("下载次数 %d、预留 %d，应为1和0", got.Downloads, got.reserved)
+	}
+}
+
+// TestMaxDownloadsRange 覆盖整个文件的Range请求同样取得整个文件，需占用下载次数；
+// 只取一部分的Range请求不占用次数，次数用完后也被拒绝
+func TestMaxDownloadsRange(t *testing.T) {
+	s, h := newRegistryServer(t, 1)
+	f := s.Files()[0]
+	s.SetFileMaxDownloads(f.AbsPath, 1)
+
+	get := func(path, rng string) int {
+		r := httptest.NewRequest(http.MethodGet, path+"?file="+f.Filename, nil)
+		r.Header.Set("Range", rng)
+		return serve(h, r)
+	}
+	for _, rng := range []string{"bytes=0-9", "bytes=-1", "bytes=100-"} {
+		if code := get("/download", rng); code != http.StatusPartialContent {
+			t.Fatalf("%s 返回 %d", rng, code)
+		}
+	}
+	if got := s.Files()[0]; got.Downloads != 0 || got.reserved != 0 {
+		t.Errorf("只取一部分的Range请求计入了 %d 次下载，预留 %d", got.Downloads, got.reserved)
+	}
+	if code := get("/download", "bytes=0-"); code != http.StatusPartialContent {
+		t.Fatalf("覆盖整个文件的Range请求返回 %d", code)
+	}
+	if got := s.Files()[0]; got.Downloads != 1 || got.reserved != 0 {
+		t.Errorf("下载次数 %d、预留 %d，应为1和0", got.Downloads, got.reserved)
+	}
+	for _, c := range []struct{ path, rng string }{
+		{"/download", "bytes=0-"},
+		{"/view", "bytes=0-"},
+		{"/download", "bytes=-100"},
+		{"/download", "bytes=0-9"},
+	} {
+		if code := get(c.path, c.rng); code != http.StatusGone {
+			t.Errorf("次数用完后 %s %s 返回 %d，应为410", c.path, c.rng, code)
+		}
+	}
+}
+
+// TestRangeCoversFile 判断Range请求的范围是否覆盖整个文件
+func TestRangeCoversFile(t *testing.T) {
+	for _, c := range []struct {
+		header string
+		want   bool
+	}{
+		{"bytes=0-", true},
+		{"bytes=0-99", true},
+		{"bytes=0-1000", true},
+		{"bytes=-100", true},
+		{"bytes=-1000", true},
+		{"bytes=0-49,50-", true},
+		{"bytes=50-,0-59", true},
+		{"bytes=100-", false},
+		{"bytes=99-", false},
+		{"bytes=-1", false},
+		{"bytes=0-98", false},
+		{"bytes=0-9,20-", false},
+		{"items=0-9", true},
+		{"bytes=x", true},
+	} {
+		if got := rangeCoversFile(c.header, 100); got != c.want {
+			t.Errorf("rangeCoversFile(%q) = %v，应为 %v", c.header, got, c.want)
+		}
+	}
+}
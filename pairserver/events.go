@@ -0,0 +1,143 @@
+package pairserver
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// 事件类型
+const (
+	EventFilesChanged     = "files_changed"     // 分享文件或共享目录列表变化
+	EventUploadStarted    = "upload_started"    // 开始接收上传，Data为UploadRequest
+	EventUploadFinished   = "upload_finished"   // 上传结束，Data为HistoryEntry
+	EventDownloadStarted  = "download_started"  // 开始下载完整的文件，Data包含filename、size和client_ip
+	EventDownloadFinished = "download_finished" // 下载结束，Data为HistoryEntry
+	EventClientConnected  = "client_connected"  // 新的客户端首次访问，Data包含client_ip、client_name、device和user_agent
+)
+
+// eventBuffer 每个订阅者缓存的事件数，处理不及时的订阅者会丢失之后的事件
+const eventBuffer = 64
+
+// Event 服务发生的事件
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data,omitempty"`
+}
+
+// eventHub 事件的订阅者
+type eventHub struct {
+	mu    sync.Mutex
+	subs  map[chan Event]struct{}
+	pages map[*websocket.Conn]struct{} // 分享服务中页面的连接，停止服务时断开
+}
+
+// Subscribe 订阅服务事件，返回事件通道和取消订阅的函数；取消后通道被关闭
+func (s *Server) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, eventBuffer)
+	s.events.mu.Lock()
+	if s.events.subs == nil {
+		s.events.subs = make(map[chan Event]struct{})
+	}
+	s.events.subs[ch] = struct{}{}
+	s.events.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.events.mu.Lock()
+			delete(s.events.subs, ch)
+			s.events.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// publish 将事件发送给全部订阅者，不会阻塞
+func (s *Server) publish(typ string, data any) {
+	e := Event{Type: typ, Time: time.Now(), Data: data}
+
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+
+	for ch := range s.events.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// wsHandler 通过WebSocket推送服务事件，每个事件为一条JSON文本消息。page为true时用于分享服务中的页面：
+// 只接受同源页面的连接，以免其他网站借用浏览器中的登录状态读取事件，并在停止服务时断开
+func (s *Server) wsHandler(page bool) http.Handler {
+	return websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			origin, err := websocket.Origin(config, r)
+			if err != nil {
+				return err
+			}
+			// 脚本等非浏览器客户端不发送Origin
+			if page && origin != nil && origin.Host != r.Host {
+				return websocket.ErrBadWebSocketOrigin
+			}
+			config.Origin = origin
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			if page {
+				s.events.mu.Lock()
+				if s.events.pages == nil {
+					s.events.pages = make(map[*websocket.Conn]struct{})
+				}
+				s.events.pages[ws] = struct{}{}
+				s.events.mu.Unlock()
+				defer func() {
+					s.events.mu.Lock()
+					delete(s.events.pages, ws)
+					s.events.mu.Unlock()
+				}()
+			}
+			s.streamEvents(ws)
+		},
+	}
+}
+
+// closePages 断开分享服务中页面的事件连接，停止服务时调用
+func (s *Server) closePages() {
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+
+	for ws := range s.events.pages {
+		ws.Close()
+	}
+}
+
+// streamEvents 将事件写入WebSocket连接，直到连接关闭
+func (s *Server) streamEvents(ws *websocket.Conn) {
+	events, cancel := s.Subscribe()
+	defer cancel()
+
+	// 客户端不发送数据，读取只用于发现连接已关闭
+	closed := make(chan struct{})
+	go func() {
+		var discard []byte
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+		close(closed)
+	}()
+
+	for {
+		select {
+		case e := <-events:
+			if err := websocket.JSON.Send(ws, e); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
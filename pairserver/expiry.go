@@ -0,0 +1,87 @@
+package pairserver
+
+import (
+	"net/http"
+	"time"
+)
+
+// Expired 返回文件的分享是否已过期
+func (f File) Expired() bool {
+	return !f.Expires.IsZero() && time.Now().After(f.Expires)
+}
+
+// SetShareExpiry 设置整个分享的过期时间，过期后网页、下载和WebDAV等请求返回410；零值表示不过期
+func (s *Server) SetShareExpiry(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.shareExpiry = t
+}
+
+// ShareExpiry 返回整个分享的过期时间，零值表示不过期
+func (s *Server) ShareExpiry() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.shareExpiry
+}
+
+// SetFileExpiry 设置下载列表中单个文件的过期时间，过期后该文件不再列出，下载返回410；
+// 零值表示不过期。文件不在下载列表中时返回false
+func (s *Server) SetFileExpiry(absPath string, t time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.files {
+		if s.files[i].AbsPath == absPath {
+			s.files[i].Expires = t
+			s.publish(EventFilesChanged, nil)
+			return true
+		}
+	}
+	return false
+}
+
+// shareExpired 返回整个分享是否已过期
+func (s *Server) shareExpired() bool {
+	expiry := s.ShareExpiry()
+	return !expiry.IsZero() && time.Now().After(expiry)
+}
+
+// activeFiles 返回下载列表中仍可下载的文件，供网页和其他客户端列出
+func (s *Server) activeFiles() []File {
+	var files []File
+	for _, f := range s.Files() {
+		if f.available() {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// writeNotFound 文件不存在时返回404，文件的分享已过期或下载次数已用完时返回410
+func (s *Server) writeNotFound(w http.ResponseWriter, filename string) {
+	for _, f := range s.Files() {
+		switch {
+		case f.Filename != filename:
+		case f.Expired():
+			http.Error(w, "文件的分享已过期", http.StatusGone)
+			return
+		case f.Exhausted():
+			http.Error(w, "文件的下载次数已用完", http.StatusGone)
+			return
+		}
+	}
+	http.Error(w, "文件不存在", http.StatusNotFound)
+}
+
+// requireUnexpired 整个分享过期后拒绝请求，返回410
+func (s *Server) requireUnexpired(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.shareExpired() {
+			http.Error(w, "分享链接已过期", http.StatusGone)
+			return
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,114 @@
+package pairserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// hashCache 已计算的文件SHA-256，以文件路径、大小和修改时间为键，文件变化后重新计算
+type hashCache struct {
+	mu      sync.Mutex
+	entries map[string]*hashEntry
+}
+
+// hashEntry 一个文件的SHA-256，同一文件同时被请求时只计算一次
+type hashEntry struct {
+	once sync.Once
+	sum  string
+	err  error
+}
+
+// FileSHA256 返回文件的SHA-256（十六进制），首次请求时计算并缓存
+func (s *Server) FileSHA256(f File) (string, error) {
+	info, err := os.Stat(f.AbsPath)
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("%s|%d|%d", f.AbsPath, info.Size(), info.ModTime().UnixNano())
+
+	s.hashes.mu.Lock()
+	if s.hashes.entries == nil {
+		s.hashes.entries = make(map[string]*hashEntry)
+	}
+	e, ok := s.hashes.entries[key]
+	if !ok {
+		e = &hashEntry{}
+		s.hashes.entries[key] = e
+	}
+	s.hashes.mu.Unlock()
+
+	e.once.Do(func() {
+		e.sum, e.err = sha256File(f.AbsPath)
+	})
+	if e.err != nil {
+		// 计算失败时不缓存，下次请求重试
+		s.hashes.mu.Lock()
+		delete(s.hashes.entries, key)
+		s.hashes.mu.Unlock()
+	}
+	return e.sum, e.err
+}
+
+// sha256File 计算文件的SHA-256
+func sha256File(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checksumHandler 返回单个文件的SHA-256，格式与sha256sum输出相同：“校验和  文件名”
+func (s *Server) checksumHandler(w http.ResponseWriter, r *http.Request) {
+	filename := r.URL.Query().Get("file")
+	if filename == "" {
+		http.Error(w, "缺少file参数", http.StatusBadRequest)
+		return
+	}
+
+	targetFile, found := s.findFile(filename)
+	if !found {
+		http.Error(w, "文件不存在", http.StatusNotFound)
+		return
+	}
+	if !s.requireFilePassword(w, r, targetFile, false) {
+		return
+	}
+
+	sum, err := s.FileSHA256(targetFile)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("计算校验和失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%s  %s\n", sum, targetFile.Filename)
+}
+
+// sha256SumsHandler 返回下载列表中全部文件的SHA256SUMS清单，可用 sha256sum -c SHA256SUMS 校验
+func (s *Server) sha256SumsHandler(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	for _, f := range s.unlockedFiles(r, s.activeFiles()) {
+		sum, err := s.FileSHA256(f)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("计算校验和失败: %s: %v", f.Filename, err), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(&b, "%s  %s\n", sum, f.Filename)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", "SHA256SUMS"))
+	io.WriteString(w, b.String())
+}
@@ -0,0 +1,180 @@
+package pairserver
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// unlockCookie 输入文件密码后记录已解锁文件的会话
+const unlockCookie = "pair_unlock"
+
+// filePassState 文件密码的解锁状态，与PIN码相互独立
+type filePassState struct {
+	mu       sync.Mutex
+	sessions map[string]map[string]string // 会话ID -> 文件路径 -> 解锁时的密码，修改密码后原解锁失效
+	failures map[string]*pinFailures      // 按客户端IP统计的密码输错次数
+}
+
+// Protected 返回文件是否设有单独的下载密码
+func (f File) Protected() bool {
+	return f.Password != ""
+}
+
+// SetFilePassword 为下载列表中的单个文件设置下载密码，网页下载前需要输入，WebDAV和DLNA中不再列出；
+// 空字符串表示取消密码。文件不在下载列表中时返回false
+func (s *Server) SetFilePassword(absPath, password string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.files {
+		if s.files[i].AbsPath == absPath {
+			s.files[i].Password = password
+			s.publish(EventFilesChanged, nil)
+			return true
+		}
+	}
+	return false
+}
+
+// fileUnlocked 判断请求的会话是否已输入该文件的密码，没有密码的文件总是返回true
+func (s *Server) fileUnlocked(r *http.Request, f File) bool {
+	if !f.Protected() {
+		return true
+	}
+	c, err := r.Cookie(unlockCookie)
+	if err != nil {
+		return false
+	}
+
+	s.filePass.mu.Lock()
+	defer s.filePass.mu.Unlock()
+
+	pw, ok := s.filePass.sessions[c.Value][f.AbsPath]
+	return ok && subtle.ConstantTimeCompare([]byte(pw), []byte(f.Password)) == 1
+}
+
+// unlockedFiles 返回files中请求已解锁或没有密码的文件
+func (s *Server) unlockedFiles(r *http.Request, files []File) []File {
+	var list []File
+	for _, f := range files {
+		if s.fileUnlocked(r, f) {
+			list = append(list, f)
+		}
+	}
+	return list
+}
+
+// publicFiles 返回下载列表中未过期且没有密码的文件，供无法输入密码的WebDAV和DLNA客户端列出
+func (s *Server) publicFiles() []File {
+	var files []File
+	for _, f := range s.activeFiles() {
+		if !f.Protected() {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// unlockFile 校验文件密码，正确时将文件记入会话并返回会话ID；输错过多时locked为true
+func (s *Server) unlockFile(r *http.Request, f File, password string) (session string, locked bool) {
+	s.filePass.mu.Lock()
+	defer s.filePass.mu.Unlock()
+
+	if s.filePass.failures == nil {
+		s.filePass.failures = make(map[string]*pinFailures)
+	}
+	ip := clientIP(r)
+	fail := s.filePass.failures[ip]
+	if fail != nil && time.Now().Before(fail.until) {
+		return "", true
+	}
+	if subtle.ConstantTimeCompare([]byte(password), []byte(f.Password)) != 1 {
+		if fail == nil {
+			fail = &pinFailures{}
+			s.filePass.failures[ip] = fail
+		}
+		fail.count++
+		if fail.count >= maxPINAttempts {
+			fail.count = 0
+			fail.until = time.Now().Add(pinLockout)
+		}
+		return "", false
+	}
+	delete(s.filePass.failures, ip)
+
+	if s.filePass.sessions == nil {
+		s.filePass.sessions = make(map[string]map[string]string)
+	}
+	if c, err := r.Cookie(unlockCookie); err == nil && s.filePass.sessions[c.Value] != nil {
+		session = c.Value
+	} else {
+		session = newSessionID()
+		s.filePass.sessions[session] = make(map[string]string)
+	}
+	s.filePass.sessions[session][f.AbsPath] = f.Password
+	return session, false
+}
+
+// requireFilePassword 文件设有密码且请求尚未解锁时，页面请求显示密码输入页、其他请求返回401，并返回false
+func (s *Server) requireFilePassword(w http.ResponseWriter, r *http.Request, f File, page bool) bool {
+	if s.fileUnlocked(r, f) {
+		return true
+	}
+	if page {
+		s.filePasswordPage(w, r, f.Filename, r.URL.RequestURI(), "")
+	} else {
+		http.Error(w, "该文件需要输入密码", http.StatusUnauthorized)
+	}
+	return false
+}
+
+// fileUnlockHandler 文件密码验证接口：密码正确后设置Cookie并跳回原请求
+func (s *Server) fileUnlockHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filename, next := r.FormValue("file"), r.FormValue("next")
+	f, found := s.findFile(filename)
+	if !found {
+		s.writeNotFound(w, filename)
+		return
+	}
+
+	T := webStrings(r)
+	session, locked := s.unlockFile(r, f, r.FormValue("password"))
+	if locked {
+		s.filePasswordPage(w, r, f.Filename, next, T["PinLocked"])
+		return
+	}
+	if session == "" {
+		s.filePasswordPage(w, r, f.Filename, next, T["FilePassWrong"])
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     unlockCookie,
+		Value:    session,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, s.sitePath(localPath(next, "/download-page")), http.StatusSeeOther)
+}
+
+// filePasswordPage 显示文件密码输入页面，验证通过后跳转到next，errMsg非空时显示错误提示
+func (s *Server) filePasswordPage(w http.ResponseWriter, r *http.Request, filename, next, errMsg string) {
+	data := struct {
+		T        map[string]string
+		Filename string
+		Next     string
+		Error    string
+	}{T: webStrings(r), Filename: filename, Next: next, Error: errMsg}
+
+	s.renderPage(w, http.StatusUnauthorized, "file-password.html", data)
+}
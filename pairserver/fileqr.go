@@ -0,0 +1,45 @@
+package pairserver
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	fileQRSize    = 256              // 下载列表中单个文件二维码的边长(像素)，点击放大后仍保持清晰
+	fileQRLinkTTL = 10 * time.Minute // 二维码中链接的有效期，只供旁边的设备当场扫描
+)
+
+// fileQRHandler 单个文件的下载二维码：内容为该文件的签名下载链接，另一台设备扫描页面上的二维码
+// 即可直接下载，无需PIN码和访问令牌；设有密码的文件仍需输入密码。
+// 链接由访客生成，因此有效期较短，并绑定当前的PIN码和访问令牌，PIN码或访问令牌改变后失效
+func (s *Server) fileQRHandler(w http.ResponseWriter, r *http.Request) {
+	filename := r.URL.Query().Get("file")
+	if _, found := s.findFile(filename); !found {
+		s.writeNotFound(w, filename)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	link, err := s.signedURL(scheme+"://"+r.Host, filename, fileQRLinkTTL, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	png, err := qrcode.Encode(link, qrcode.Medium, fileQRSize)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("生成二维码失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// 链接带有过期时间，不能缓存
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(png)
+}
@@ -0,0 +1,207 @@
+package pairserver
+
+import (
+	"errors"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrIsDir 指定的路径是目录而非文件
+var ErrIsDir = errors.New("请选择文件而非目录")
+
+// File 下载文件信息结构体
+type File struct {
+	Filename string    // 文件名
+	AbsPath  string    // 绝对路径
+	SizeKB   int64     // 文件大小(KB)
+	MimeType string    // 按扩展名推断的MIME类型
+	ModTime  time.Time // 最后修改时间
+	Expires  time.Time // 分享的过期时间，零值表示不过期
+	Password string    // 单独的下载密码，空表示不需要
+
+	Downloads    int // 本次运行中已完整下载的次数
+	MaxDownloads int // 允许完整下载的次数，0表示不限
+
+	reserved int // 进行中的完整下载预留的次数，见downloadSlot
+}
+
+// NewFile 校验文件路径并生成下载文件信息
+func NewFile(path string) (File, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return File{}, err
+	}
+
+	// 验证文件
+	fileInfo, err := os.Stat(absPath)
+	if err != nil {
+		return File{}, err
+	}
+	if fileInfo.IsDir() {
+		return File{}, ErrIsDir
+	}
+
+	// 计算文件大小(KB)
+	sizeKB := fileInfo.Size() / 1024
+	if fileInfo.Size()%1024 != 0 {
+		sizeKB += 1
+	}
+
+	return File{
+		Filename: filepath.Base(absPath),
+		AbsPath:  absPath,
+		SizeKB:   sizeKB,
+		MimeType: mimeType(absPath),
+		ModTime:  fileInfo.ModTime(),
+	}, nil
+}
+
+// Icon 返回表示文件类型的图标，用于下载列表
+func (f File) Icon() string {
+	switch {
+	case strings.HasPrefix(f.MimeType, "image/"):
+		return "🖼️"
+	case strings.HasPrefix(f.MimeType, "video/"):
+		return "🎬"
+	case strings.HasPrefix(f.MimeType, "audio/"):
+		return "🎵"
+	case archiveTypes[f.MimeType]:
+		return "🗜️"
+	case strings.HasPrefix(f.MimeType, "text/") || documentTypes[f.MimeType]:
+		return "📄"
+	default:
+		return "📦"
+	}
+}
+
+// Previewable 返回文件能否在浏览器中直接查看或播放
+func (f File) Previewable() bool {
+	for _, prefix := range []string{"image/", "video/", "audio/", "text/"} {
+		if strings.HasPrefix(f.MimeType, prefix) {
+			return true
+		}
+	}
+	return f.MimeType == "application/pdf"
+}
+
+// archiveTypes 压缩包的MIME类型
+var archiveTypes = map[string]bool{
+	"application/zip":              true,
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/x-tar":            true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/vnd.rar":          true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+}
+
+// documentTypes 文档的MIME类型
+var documentTypes = map[string]bool{
+	"application/pdf":    true,
+	"application/msword": true,
+	"application/rtf":    true,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   true,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
+	"application/vnd.ms-excel":                true,
+	"application/vnd.ms-powerpoint":           true,
+	"application/vnd.oasis.opendocument.text": true,
+	"application/epub+zip":                    true,
+}
+
+// mimeType 按扩展名推断文件的MIME类型，无法识别时为application/octet-stream
+func mimeType(path string) string {
+	t, _, err := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(path)))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return t
+}
+
+// AddFile 校验并添加单个文件到下载列表
+func (s *Server) AddFile(path string) (File, error) {
+	f, err := NewFile(path)
+	if err != nil {
+		return File{}, err
+	}
+	s.AddFiles(f)
+	return f, nil
+}
+
+// AddFiles 一次性将多个文件追加到下载列表，已存在的文件会被跳过，返回实际添加的文件
+func (s *Server) AddFiles(files ...File) []File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var added []File
+	for _, f := range files {
+		if s.hasFileLocked(f.AbsPath) {
+			continue
+		}
+		s.files = append(s.files, f)
+		added = append(added, f)
+	}
+	if len(added) > 0 {
+		s.publish(EventFilesChanged, nil)
+	}
+	return added
+}
+
+// RemoveFile 从下载列表中移除指定文件
+func (s *Server) RemoveFile(absPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, f := range s.files {
+		if f.AbsPath == absPath {
+			s.files = append(s.files[:i], s.files[i+1:]...)
+			s.publish(EventFilesChanged, nil)
+			return
+		}
+	}
+}
+
+// ClearFiles 清空下载列表
+func (s *Server) ClearFiles() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files = nil
+	s.publish(EventFilesChanged, nil)
+}
+
+// Files 返回下载列表的副本
+func (s *Server) Files() []File {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]File(nil), s.files...)
+}
+
+// findFile 按文件名查找仍可下载（未过期且未达到下载次数上限）的下载文件
+func (s *Server) findFile(filename string) (File, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, f := range s.files {
+		if f.Filename == filename && f.available() {
+			return f, true
+		}
+	}
+	return File{}, false
+}
+
+// hasFileLocked 判断文件是否已在下载列表中，调用方需持有锁
+func (s *Server) hasFileLocked(absPath string) bool {
+	for _, f := range s.files {
+		if f.AbsPath == absPath {
+			return true
+		}
+	}
+	return false
+}
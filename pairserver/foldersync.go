@@ -0,0 +1,436 @@
+package pairserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 两台pair-gui之间的双向文件夹同步：双方各自定期扫描同步目录，并从对方拉取新增或修改过的文件，
+// 每一方只写入自己的目录。上次同步一致时的文件版本记录在同步目录的.pair-sync/state.json中，
+// 据此判断是哪一方修改了文件；双方都修改过时较新的版本保留原名，另一版本改名为冲突副本。
+// 删除不会同步，本地删除的已同步文件在对方再次修改前不会被重新拉回。双方的认证见syncauth.go
+const (
+	syncInterval = 5 * time.Second // 扫描本地目录和对方清单的间隔
+	syncSettle   = 2 * time.Second // 修改后不足该时间的文件可能仍在写入，暂不提供给对方
+	syncStateDir = ".pair-sync"    // 同步状态和临时文件的目录，位于同步目录下
+)
+
+// SyncConfig 文件夹同步设置
+type SyncConfig struct {
+	Dir  string // 本地同步目录
+	Peer string // 对方的设备名称，即附近设备列表中显示的名称
+	Key  string // 双方相同的同步密钥，用于双方互相验证，不在网络上传输；应由NewSyncKey生成
+}
+
+// syncEntry 同步目录中的一个文件
+type syncEntry struct {
+	Path    string `json:"path"` // 相对同步目录的路径，以/分隔
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"` // 修改时间(Unix纳秒)
+	SHA256  string `json:"sha256"`
+}
+
+// syncState 上次同步一致时各文件的SHA-256
+type syncState struct {
+	Peer string            `json:"peer"`
+	Base map[string]string `json:"base"`
+}
+
+// folderSync 运行中的文件夹同步
+type folderSync struct {
+	cfg     SyncConfig
+	cancel  context.CancelFunc
+	done    chan struct{}
+	state   syncState
+	lastErr string // 上一次记录的错误，相同的错误不重复记录
+
+	mu         sync.Mutex
+	challenges map[string]syncGrant // 本机发放给对方的质询
+}
+
+// StartSync 开始与附近设备双向同步目录，需要启用设备发现且双方都已启动服务。已在同步时先停止
+func (s *Server) StartSync(cfg SyncConfig) error {
+	s.StopSync()
+
+	if cfg.Peer == "" || cfg.Key == "" {
+		return errors.New("缺少同步设备或同步密钥")
+	}
+	if len(cfg.Key) < MinSyncKeyLength {
+		return ErrWeakSyncKey
+	}
+	info, err := os.Stat(cfg.Dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s 不是目录", cfg.Dir)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &folderSync{cfg: cfg, cancel: cancel, done: make(chan struct{}), challenges: make(map[string]syncGrant)}
+	f.loadState()
+
+	s.mu.Lock()
+	s.folderSync = f
+	s.mu.Unlock()
+
+	go f.run(ctx, s)
+	log.Printf("开始与 %s 同步目录: %s", cfg.Peer, cfg.Dir)
+	return nil
+}
+
+// StopSync 停止文件夹同步，等待正在拉取的文件结束
+func (s *Server) StopSync() {
+	s.mu.Lock()
+	f := s.folderSync
+	s.folderSync = nil
+	s.mu.Unlock()
+
+	if f == nil {
+		return
+	}
+	f.cancel()
+	<-f.done
+}
+
+// syncIndexHandler 返回同步目录中的文件清单，响应头中带有以同步密钥对清单的签名
+func (s *Server) syncIndexHandler(w http.ResponseWriter, r *http.Request) {
+	cfg, challenge, ok := s.syncAuthorized(w, r)
+	if !ok {
+		return
+	}
+	entries, err := s.scanSyncDir(r.Context(), cfg.Dir)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("读取同步目录失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var body bytes.Buffer
+	json.NewEncoder(&body).Encode(entries)
+	sum := sha256.Sum256(body.Bytes())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set(syncProofName, syncMAC(cfg.Key, "index", challenge, hex.EncodeToString(sum[:])))
+	w.Write(body.Bytes())
+}
+
+// syncFileHandler 返回同步目录中的一个文件，不跟随指向同步目录之外的符号链接
+func (s *Server) syncFileHandler(w http.ResponseWriter, r *http.Request) {
+	cfg, _, ok := s.syncAuthorized(w, r)
+	if !ok {
+		return
+	}
+	p, ok := syncLocalPath(cfg.Dir, r.URL.Query().Get("path"))
+	if !ok {
+		http.Error(w, "无效的路径", http.StatusBadRequest)
+		return
+	}
+	p, err := syncConfined(cfg.Dir, p)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, info, err := openBasis(p)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	if t := requestTransfer(r); t != nil {
+		t.describe(filepath.Base(p), info.Size(), 0)
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "", info.ModTime(), newRateLimitedReadSeeker(r.Context(), f, s.RateLimit()))
+}
+
+// syncLocalPath 将清单中的相对路径转换为同步目录中的路径，拒绝绝对路径、..和同步状态目录
+func syncLocalPath(dir, rel string) (string, bool) {
+	if rel == "" || strings.Contains(rel, "\\") || path.IsAbs(rel) || path.Clean(rel) != rel ||
+		rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	top, _, _ := strings.Cut(rel, "/")
+	if top == syncStateDir || top == partialDir {
+		return "", false
+	}
+	return filepath.Join(dir, filepath.FromSlash(rel)), true
+}
+
+// scanSyncDir 列出同步目录中的普通文件及其SHA-256，跳过同步状态目录、未完成的上传和刚修改的文件
+func (s *Server) scanSyncDir(ctx context.Context, dir string) ([]syncEntry, error) {
+	entries := []syncEntry{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir {
+				return err
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			if p != dir && (d.Name() == syncStateDir || d.Name() == partialDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || time.Since(info.ModTime()) < syncSettle {
+			return nil
+		}
+		sum, err := s.FileSHA256(File{AbsPath: p})
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, p)
+		entries = append(entries, syncEntry{
+			Path: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime().UnixNano(), SHA256: sum,
+		})
+		return nil
+	})
+	return entries, err
+}
+
+// run 定期与对方同步，直到停止
+func (f *folderSync) run(ctx context.Context, s *Server) {
+	defer close(f.done)
+
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+	for {
+		f.report(f.syncOnce(ctx, s))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// report 记录同步错误，与上一次相同的错误不重复记录
+func (f *folderSync) report(err error) {
+	msg := ""
+	if err != nil && !errors.Is(err, context.Canceled) {
+		msg = err.Error()
+	}
+	if msg != "" && msg != f.lastErr {
+		log.Printf("同步失败: %s", msg)
+	}
+	f.lastErr = msg
+}
+
+// connect 在附近设备中查找同步的对方并完成验证。设备名称可被冒用，
+// 同名的设备逐个验证，使用第一个持有同步密钥的
+func (f *folderSync) connect(ctx context.Context, s *Server) (Peer, *syncSession, error) {
+	err := fmt.Errorf("未发现已启动服务的设备 %s", f.cfg.Peer)
+	for _, p := range s.Peers() {
+		if p.Name != f.cfg.Peer || p.LocalSend || p.URL() == "" {
+			continue
+		}
+		var sess *syncSession
+		if sess, err = f.handshake(ctx, p); err == nil {
+			return p, sess, nil
+		}
+	}
+	return Peer{}, nil, err
+}
+
+// syncOnce 比较本地和对方的文件清单，拉取需要更新的文件
+func (f *folderSync) syncOnce(ctx context.Context, s *Server) error {
+	peer, sess, err := f.connect(ctx, s)
+	if err != nil {
+		return err
+	}
+	defer sess.client.CloseIdleConnections()
+	remote, err := f.getIndex(ctx, sess)
+	if err != nil {
+		return err
+	}
+	local, err := s.scanSyncDir(ctx, f.cfg.Dir)
+	if err != nil {
+		return err
+	}
+	byPath := make(map[string]syncEntry, len(local))
+	for _, e := range local {
+		byPath[e.Path] = e
+	}
+
+	changed := false
+	for _, r := range remote {
+		dst, ok := syncLocalPath(f.cfg.Dir, r.Path)
+		if !ok {
+			continue
+		}
+		l, exists := byPath[r.Path]
+		if !exists && fileExists(dst) {
+			// 刚修改过或不是普通文件，不在本地清单中，等下一次再比较
+			continue
+		}
+		synced, known := f.state.Base[r.Path]
+		switch {
+		case exists && l.SHA256 == r.SHA256:
+			// 双方一致
+			if synced != r.SHA256 {
+				f.state.Base[r.Path] = r.SHA256
+				changed = true
+			}
+			continue
+		case !exists && known && synced == r.SHA256:
+			// 本地删除了已同步的文件，对方之后修改过时再拉取
+			continue
+		case exists && synced == r.SHA256:
+			// 只有本地修改过，由对方拉取
+			continue
+		case exists && (!known || synced != l.SHA256) && !remoteWins(l, r):
+			// 双方都修改过，本地版本较新，对方将其版本改为冲突副本后拉取本地版本
+			continue
+		case exists && (!known || synced != l.SHA256):
+			// 双方都修改过，对方版本较新，本地版本改为冲突副本
+			if err := f.keepConflict(s, r.Path); err != nil {
+				return err
+			}
+		}
+		if err := f.pull(ctx, s, sess, "sync/file?path="+url.QueryEscape(r.Path), dst, r); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("同步 %s 失败: %v", r.Path, err)
+			continue
+		}
+		f.state.Base[r.Path] = r.SHA256
+		changed = true
+		log.Printf("已从 %s 同步: %s", peer.Name, r.Path)
+	}
+	if changed {
+		f.saveState()
+	}
+	return nil
+}
+
+// remoteWins 双方都修改过同一文件时，修改时间较新的版本保留原名；时间相同时按校验和比较，双方结论一致
+func remoteWins(local, remote syncEntry) bool {
+	if local.ModTime != remote.ModTime {
+		return remote.ModTime > local.ModTime
+	}
+	return remote.SHA256 > local.SHA256
+}
+
+// keepConflict 将本地版本改名为冲突副本，如“a.sync-conflict-设备名-20240102-150405.txt”
+func (f *folderSync) keepConflict(s *Server, rel string) error {
+	p := filepath.Join(f.cfg.Dir, filepath.FromSlash(rel))
+	info, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	ext := filepath.Ext(p)
+	name := fmt.Sprintf("%s.sync-conflict-%s-%s%s", strings.TrimSuffix(filepath.Base(p), ext),
+		sanitizeFilename(s.deviceName()), info.ModTime().Format("20060102-150405"), ext)
+	conflict := filepath.Join(filepath.Dir(p), name)
+	if fileExists(conflict) {
+		conflict = uniquePath(filepath.Dir(p), name)
+	}
+	log.Printf("同步冲突: %s 的本地版本保存为 %s", rel, filepath.Base(conflict))
+	return os.Rename(p, conflict)
+}
+
+// deviceName 返回设备发现中广播的本机名称，未启动发现时为pair-gui
+func (s *Server) deviceName() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.discovery == nil {
+		return discoveryApp
+	}
+	return s.discovery.name
+}
+
+// pull 下载对方的文件到临时文件，校验SHA-256并设置与对方相同的修改时间后保存为dst
+func (f *folderSync) pull(ctx context.Context, s *Server, sess *syncSession, target, dst string, e syncEntry) error {
+	resp, err := f.get(ctx, sess, target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	tmpDir := filepath.Join(f.cfg.Dir, syncStateDir)
+	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(tmpDir, "pull-*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), newRateLimitedReader(ctx, resp.Body, s.RateLimit()))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != e.SHA256 {
+		return errors.New("文件在传输期间发生变化")
+	}
+	mtime := time.Unix(0, e.ModTime)
+	if err := os.Chtimes(tmp.Name(), mtime, mtime); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	// 本地的子目录可能是指向同步目录之外的符号链接
+	if _, err := syncConfined(f.cfg.Dir, filepath.Dir(dst)); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// statePath 返回同步状态文件的路径
+func (f *folderSync) statePath() string {
+	return filepath.Join(f.cfg.Dir, syncStateDir, "state.json")
+}
+
+// loadState 读取上次同步的状态，对方设备变化后重新开始
+func (f *folderSync) loadState() {
+	f.state = syncState{}
+	if data, err := os.ReadFile(f.statePath()); err == nil {
+		json.Unmarshal(data, &f.state)
+	}
+	if f.state.Peer != f.cfg.Peer || f.state.Base == nil {
+		f.state = syncState{Peer: f.cfg.Peer, Base: make(map[string]string)}
+	}
+}
+
+// saveState 保存同步状态
+func (f *folderSync) saveState() {
+	data, err := json.Marshal(f.state)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(f.statePath()), 0o755); err != nil {
+		log.Printf("保存同步状态失败: %v", err)
+		return
+	}
+	if err := os.WriteFile(f.statePath(), data, 0o644); err != nil {
+		log.Printf("保存同步状态失败: %v", err)
+	}
+}
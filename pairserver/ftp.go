@@ -0,0 +1,755 @@
+package pairserver
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FTP参数
+const (
+	DefaultFTPPort = 2121
+	ftpIdleTimeout = 5 * time.Minute  // 控制连接无命令的最长时间
+	ftpDataTimeout = 30 * time.Second // 等待客户端建立数据连接的最长时间
+)
+
+// ftpServer 运行中的FTP服务
+type ftpServer struct {
+	ln    net.Listener
+	port  int
+	mu    sync.Mutex
+	conns map[io.Closer]bool // 正在使用的控制连接、数据连接和被动模式端口，停止时一并关闭
+	owner map[string]string  // 通过FTP新建的文件路径及上传者（IP和用户名），续传只能写入自己上传的文件
+	wg    sync.WaitGroup
+}
+
+// SetFTPPort 设置FTP服务端口，0表示不提供FTP；下次启动服务时生效。
+// FTP服务与WebDAV使用相同的虚拟目录：分享文件和共享目录只读，上传只能在uploads目录中新建文件或续传
+func (s *Server) SetFTPPort(port int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ftpPort = port
+}
+
+// FTPURL 返回FTP服务地址，未启用时为空；启用HTTPS时支持显式FTPS（AUTH TLS）
+func (s *Server) FTPURL(host string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.ftp == nil {
+		return ""
+	}
+	return fmt.Sprintf("ftp://%s/", HostPort(host, s.ftp.port))
+}
+
+// ftpPassword 返回FTP登录密码：启用基本认证时为其密码，其次设置PIN码时为PIN码，
+// 否则要求访问令牌时为令牌，都未设置时允许匿名登录
+func (s *Server) ftpPassword() (password string, isPIN bool) {
+	if _, basic := s.BasicAuth(); basic != "" {
+		return basic, false
+	}
+	if pin := s.PIN(); pin != "" {
+		return pin, true
+	}
+	return s.Token(), false
+}
+
+// startFTP 按当前设置启动FTP服务，失败时只记录日志，不影响HTTP服务
+func (s *Server) startFTP() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ftpPort == 0 {
+		return
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", s.ftpPort))
+	if err != nil {
+		log.Printf("启动FTP服务失败: %v", err)
+		return
+	}
+	f := &ftpServer{ln: ln, port: s.ftpPort, conns: make(map[io.Closer]bool)}
+	s.ftp = f
+	f.wg.Add(1)
+	go f.serve(s)
+	log.Printf("FTP服务启动成功: :%d", s.ftpPort)
+}
+
+// stopFTP 停止FTP服务并断开所有连接
+func (s *Server) stopFTP() {
+	s.mu.Lock()
+	f := s.ftp
+	s.ftp = nil
+	s.mu.Unlock()
+
+	if f == nil {
+		return
+	}
+	f.ln.Close()
+	f.mu.Lock()
+	for c := range f.conns {
+		c.Close()
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+}
+
+// track 记录正在使用的连接，停止服务时关闭；done为true时移除记录
+func (f *ftpServer) track(c io.Closer, done bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if done {
+		delete(f.conns, c)
+	} else {
+		f.conns[c] = true
+	}
+}
+
+// addUpload 记录owner新建的文件，之后同一用户重新连接也能续传
+func (f *ftpServer) addUpload(path, owner string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.owner == nil {
+		f.owner = make(map[string]string)
+	}
+	f.owner[path] = owner
+}
+
+// ownsUpload 返回path是否为owner通过FTP新建的文件
+func (f *ftpServer) ownsUpload(path, owner string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.owner[path] == owner
+}
+
+// serve 接受控制连接，直到监听关闭
+func (f *ftpServer) serve(s *Server) {
+	defer f.wg.Done()
+
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		f.track(conn, false)
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			defer f.track(conn, true)
+			defer conn.Close()
+			newFTPSession(s, f, conn).run()
+		}()
+	}
+}
+
+// ftpSession 一个FTP控制连接的状态
+type ftpSession struct {
+	s         *Server
+	srv       *ftpServer
+	fs        davFS
+	conn      net.Conn
+	r         *bufio.Reader
+	ip        string
+	user      string
+	authed    bool
+	cwd       string       // 当前目录，虚拟路径
+	pasv      net.Listener // 被动模式的数据端口
+	active    string       // 主动模式下客户端的数据地址
+	protected bool         // 数据连接是否使用TLS（PROT P）
+	restart   int64        // REST指定的断点位置
+	allocate  int64        // ALLO声明的上传大小
+	tlsConf   *tls.Config  // 控制连接和数据连接共用，以便客户端复用TLS会话
+}
+
+// newFTPSession 创建控制连接的会话
+func newFTPSession(s *Server, srv *ftpServer, conn net.Conn) *ftpSession {
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	return &ftpSession{s: s, srv: srv, fs: davFS{s}, conn: conn, r: bufio.NewReader(conn), ip: host, cwd: "/"}
+}
+
+// reply 发送一行回复
+func (c *ftpSession) reply(code int, format string, args ...any) {
+	fmt.Fprintf(c.conn, "%d %s\r\n", code, fmt.Sprintf(format, args...))
+}
+
+// run 逐条处理命令，直到客户端退出或连接断开
+func (c *ftpSession) run() {
+	defer c.closeData()
+
+	if !c.s.ipFilter.allowed(c.ip) {
+		c.reply(421, "Access denied")
+		return
+	}
+	c.reply(220, "pair-gui FTP ready")
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(ftpIdleTimeout))
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		if !c.handle(strings.ToUpper(cmd), arg) {
+			return
+		}
+	}
+}
+
+// handle 处理一条命令，返回false表示结束会话
+func (c *ftpSession) handle(cmd, arg string) bool {
+	switch cmd {
+	case "USER":
+		if c.expired() {
+			return false
+		}
+		c.authed = false
+		c.user = arg
+		if password, _ := c.s.ftpPassword(); password == "" {
+			c.authed = true
+			c.reply(230, "Login successful")
+		} else {
+			c.reply(331, "Password required")
+		}
+		return true
+	case "PASS":
+		if c.expired() {
+			return false
+		}
+		c.login(arg)
+		return true
+	case "AUTH":
+		return c.startTLS(arg)
+	case "PBSZ":
+		c.reply(200, "PBSZ=0")
+		return true
+	case "PROT":
+		c.protected = strings.EqualFold(arg, "P")
+		c.reply(200, "Protection level set")
+		return true
+	case "FEAT":
+		features := []string{"UTF8", "SIZE", "MDTM", "EPSV", "PASV", "REST STREAM"}
+		if c.tlsConfig() != nil {
+			features = append(features, "AUTH TLS", "PBSZ", "PROT")
+		}
+		fmt.Fprintf(c.conn, "211-Features:\r\n %s\r\n211 End\r\n", strings.Join(features, "\r\n "))
+		return true
+	case "SYST":
+		c.reply(215, "UNIX Type: L8")
+		return true
+	case "OPTS", "NOOP", "TYPE", "MODE", "STRU":
+		c.reply(200, "OK")
+		return true
+	case "ALLO":
+		// 格式为“ALLO 大小 [R 记录大小]”，只记下大小用于检查磁盘空间
+		size, _, _ := strings.Cut(arg, " ")
+		c.allocate, _ = strconv.ParseInt(size, 10, 64)
+		c.reply(200, "OK")
+		return true
+	case "QUIT":
+		c.reply(221, "Goodbye")
+		return false
+	}
+
+	if !c.authed {
+		c.reply(530, "Please login with USER and PASS")
+		return true
+	}
+	// 已登录的会话在分享过期后同样不能再列出或下载文件
+	if c.expired() {
+		return false
+	}
+	switch cmd {
+	case "PWD", "XPWD":
+		c.reply(257, "%q is the current directory", c.cwd)
+	case "CWD", "XCWD":
+		c.changeDir(c.resolve(arg))
+	case "CDUP", "XCUP":
+		c.changeDir(path.Dir(c.cwd))
+	case "PASV":
+		c.passive(false)
+	case "EPSV":
+		c.passive(true)
+	case "PORT":
+		c.port(arg)
+	case "LIST", "NLST":
+		c.list(arg, cmd == "NLST")
+	case "RETR":
+		c.retrieve(c.resolve(arg))
+	case "STOR", "APPE":
+		c.store(c.resolve(arg), cmd == "APPE")
+	case "REST":
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || n < 0 {
+			c.reply(501, "Invalid offset")
+			break
+		}
+		c.restart = n
+		c.reply(350, "Restarting at %d", n)
+	case "SIZE", "MDTM":
+		info, err := c.fs.Stat(context.Background(), c.resolve(arg))
+		if err != nil || info.IsDir() {
+			c.reply(550, "File not found")
+		} else if cmd == "SIZE" {
+			c.reply(213, "%d", info.Size())
+		} else {
+			c.reply(213, "%s", info.ModTime().UTC().Format("20060102150405"))
+		}
+	case "MKD", "XMKD", "DELE", "RMD", "XRMD", "RNFR", "RNTO":
+		// 只提供下载和上传新文件，不能修改已接收的文件
+		c.reply(550, "Permission denied")
+	default:
+		c.reply(502, "Command not implemented")
+	}
+	return true
+}
+
+// expired 整个分享已过期时回复421并返回true，调用方随即结束会话
+func (c *ftpSession) expired() bool {
+	if !c.s.shareExpired() {
+		return false
+	}
+	c.reply(421, "Share expired")
+	return true
+}
+
+// login 校验密码，启用基本认证时还要求用户名一致，否则用户名任意
+func (c *ftpSession) login(password string) {
+	expected, isPIN := c.s.ftpPassword()
+	_, basic := c.s.BasicAuth()
+	var ok, locked bool
+	switch {
+	case expected == "":
+		ok = true
+	case basic != "":
+		ok, locked = c.s.checkBasicAuth(c.ip, c.user, password)
+	case isPIN:
+		ok, locked = c.s.verifyPIN(c.ip, password)
+	default:
+		ok = subtle.ConstantTimeCompare([]byte(password), []byte(expected)) == 1
+	}
+	if locked {
+		c.reply(421, "Too many failed attempts, try again later")
+		return
+	}
+	if !ok {
+		c.reply(530, "Login incorrect")
+		return
+	}
+	c.authed = true
+	c.reply(230, "Login successful")
+}
+
+// tlsConfig 返回FTPS使用的TLS配置，未启用HTTPS时为nil
+func (c *ftpSession) tlsConfig() *tls.Config {
+	c.s.mu.RLock()
+	defer c.s.mu.RUnlock()
+
+	if c.s.tlsCert == nil {
+		return nil
+	}
+	if c.tlsConf == nil {
+		c.tlsConf = &tls.Config{Certificates: []tls.Certificate{*c.s.tlsCert}}
+	}
+	return c.tlsConf
+}
+
+// startTLS 处理AUTH TLS，将控制连接升级为TLS
+func (c *ftpSession) startTLS(mechanism string) bool {
+	conf := c.tlsConfig()
+	if conf == nil || !(strings.EqualFold(mechanism, "TLS") || strings.EqualFold(mechanism, "SSL")) {
+		c.reply(504, "AUTH not supported")
+		return true
+	}
+	c.reply(234, "Proceed with negotiation")
+	conn := tls.Server(c.conn, conf)
+	if err := conn.Handshake(); err != nil {
+		return false
+	}
+	c.conn, c.r = conn, bufio.NewReader(conn)
+	return true
+}
+
+// result 根据文件操作的结果回复
+func (c *ftpSession) result(err error, code int, msg string) {
+	switch {
+	case err == nil:
+		c.reply(code, "%s", msg)
+	case errors.Is(err, os.ErrPermission):
+		c.reply(550, "Permission denied")
+	default:
+		c.reply(550, "%v", err)
+	}
+}
+
+// resolve 将命令参数解析为虚拟路径
+func (c *ftpSession) resolve(arg string) string {
+	if strings.HasPrefix(arg, "/") {
+		return path.Clean(arg)
+	}
+	return path.Join(c.cwd, arg)
+}
+
+// changeDir 切换当前目录
+func (c *ftpSession) changeDir(dir string) {
+	info, err := c.fs.Stat(context.Background(), dir)
+	if err != nil || !info.IsDir() {
+		c.reply(550, "Directory not found")
+		return
+	}
+	c.cwd = dir
+	c.reply(250, "Directory changed to %s", dir)
+}
+
+// passive 打开被动模式的数据端口，监听控制连接所在的本机地址
+func (c *ftpSession) passive(extended bool) {
+	c.closeData()
+	host, _, _ := net.SplitHostPort(c.conn.LocalAddr().String())
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		c.reply(425, "Cannot open data connection")
+		return
+	}
+	c.pasv = ln
+	c.srv.track(ln, false)
+	port := ln.Addr().(*net.TCPAddr).Port
+	if extended {
+		c.reply(229, "Entering Extended Passive Mode (|||%d|)", port)
+		return
+	}
+	ip := net.ParseIP(host).To4()
+	if ip == nil {
+		c.reply(425, "Use EPSV for IPv6")
+		return
+	}
+	c.reply(227, "Entering Passive Mode (%d,%d,%d,%d,%d,%d)", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff)
+}
+
+// port 处理主动模式，只允许连接回控制连接的客户端，防止被用于FTP跳转攻击
+func (c *ftpSession) port(arg string) {
+	parts := strings.Split(arg, ",")
+	if len(parts) != 6 {
+		c.reply(501, "Invalid PORT")
+		return
+	}
+	var nums [6]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || n < 0 || n > 255 {
+			c.reply(501, "Invalid PORT")
+			return
+		}
+		nums[i] = n
+	}
+	ip := net.IPv4(byte(nums[0]), byte(nums[1]), byte(nums[2]), byte(nums[3]))
+	if !ip.Equal(net.ParseIP(c.ip)) {
+		c.reply(501, "PORT must point to the client")
+		return
+	}
+	c.closeData()
+	c.active = net.JoinHostPort(ip.String(), strconv.Itoa(nums[4]<<8|nums[5]))
+	c.reply(200, "PORT OK")
+}
+
+// openData 建立数据连接：被动模式等待客户端连入，主动模式连接客户端
+func (c *ftpSession) openData() (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	switch {
+	case c.pasv != nil:
+		ln := c.pasv
+		c.pasv = nil
+		defer c.srv.track(ln, true)
+		defer ln.Close()
+		ln.(*net.TCPListener).SetDeadline(time.Now().Add(ftpDataTimeout))
+		conn, err = ln.Accept()
+		if err == nil {
+			// 只接受控制连接的客户端连入数据端口
+			if host, _, _ := net.SplitHostPort(conn.RemoteAddr().String()); host != c.ip {
+				conn.Close()
+				return nil, fmt.Errorf("数据连接来自其他地址: %s", host)
+			}
+		}
+	case c.active != "":
+		addr := c.active
+		c.active = ""
+		conn, err = net.DialTimeout("tcp", addr, ftpDataTimeout)
+	default:
+		return nil, fmt.Errorf("请先使用PASV或PORT")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if conf := c.tlsConfig(); c.protected && conf != nil {
+		conn = tls.Server(conn, conf)
+	}
+	return conn, nil
+}
+
+// closeData 关闭未使用的被动模式端口
+func (c *ftpSession) closeData() {
+	if c.pasv != nil {
+		c.pasv.Close()
+		c.srv.track(c.pasv, true)
+		c.pasv = nil
+	}
+	c.active = ""
+}
+
+// transfer 打开数据连接并执行传输，回复传输结果
+func (c *ftpSession) transfer(fn func(conn net.Conn) error) {
+	c.reply(150, "Opening data connection")
+	conn, err := c.openData()
+	if err != nil {
+		c.reply(425, "Cannot open data connection: %v", err)
+		return
+	}
+	c.srv.track(conn, false)
+	c.s.active.Add(1)
+	err = fn(conn)
+	c.s.active.Add(-1)
+	c.srv.track(conn, true)
+	if cerr := conn.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		c.reply(426, "Transfer aborted: %v", err)
+		return
+	}
+	c.reply(226, "Transfer complete")
+}
+
+// list 列出目录内容；LIST为ls -l格式，NLST只列出名称
+func (c *ftpSession) list(arg string, namesOnly bool) {
+	// 忽略客户端附带的ls参数，如 -la
+	var target string
+	for _, field := range strings.Fields(arg) {
+		if !strings.HasPrefix(field, "-") {
+			target = field
+		}
+	}
+	dir := c.resolve(target)
+	f, err := c.fs.OpenFile(context.Background(), dir, os.O_RDONLY, 0)
+	if err != nil {
+		c.reply(550, "Directory not found")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		c.reply(550, "%v", err)
+		return
+	}
+	entries := []os.FileInfo{info}
+	if info.IsDir() {
+		if entries, err = f.Readdir(-1); err != nil {
+			c.reply(550, "%v", err)
+			return
+		}
+	}
+
+	c.transfer(func(conn net.Conn) error {
+		w := bufio.NewWriter(conn)
+		for _, e := range entries {
+			if namesOnly {
+				fmt.Fprintf(w, "%s\r\n", e.Name())
+			} else {
+				fmt.Fprint(w, ftpListLine(e))
+			}
+		}
+		return w.Flush()
+	})
+}
+
+// ftpListLine 返回ls -l格式的一行
+func ftpListLine(info os.FileInfo) string {
+	t := info.ModTime()
+	if t.IsZero() {
+		t = time.Now()
+	}
+	stamp := t.Format("Jan _2 15:04")
+	if time.Since(t) > 180*24*time.Hour {
+		stamp = t.Format("Jan _2  2006")
+	}
+	mode := []byte(info.Mode().Perm().String())
+	if info.IsDir() {
+		mode[0] = 'd'
+	}
+	return fmt.Sprintf("%s 1 pair pair %12d %s %s\r\n", mode, info.Size(), stamp, info.Name())
+}
+
+// retrieve 下载文件，支持REST断点续传
+func (c *ftpSession) retrieve(name string) {
+	offset := c.restart
+	c.restart = 0
+	f, err := c.fs.OpenFile(context.Background(), name, os.O_RDONLY, 0)
+	if err != nil {
+		c.reply(550, "File not found")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		c.reply(550, "Not a file")
+		return
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		c.reply(550, "%v", err)
+		return
+	}
+
+	// 下载分享文件时预留下载次数，传输结束时结算，失败时归还。REST续传同样读到文件末尾，也需预留
+	var slot *downloadSlot
+	if sf, ok := c.fs.sharedFile(name); ok {
+		if slot, ok = c.s.reserveDownload(sf); !ok {
+			c.reply(550, "Download limit reached")
+			return
+		}
+	}
+
+	t := c.s.beginTransfer(TransferDownload, info.Name(), c.ip, info.Size())
+	defer c.s.endTransfer(t)
+	t.setSlot(slot)
+	t.describe(info.Name(), info.Size(), offset)
+	c.transfer(func(conn net.Conn) error {
+		t.setAbort(func() { conn.Close() })
+		_, err := io.Copy(conn, t.reader(newRateLimitedReader(context.Background(), f, c.s.RateLimit())))
+		if err != nil {
+			t.fail()
+		}
+		return err
+	})
+	c.fs.describeTransfer(t, name)
+}
+
+// store 上传文件，只能写入uploads目录：新文件按重名策略保存，不覆盖已接收的文件；
+// APPE和REST只能从同一用户之前通过FTP上传的文件末尾续传。失败时删除本次新建的文件，续传的文件恢复到原来的大小
+func (c *ftpSession) store(name string, appendTo bool) {
+	offset, size := c.restart, c.allocate
+	c.restart, c.allocate = 0, 0
+	dir, filename, ok := c.fs.uploadTarget(name)
+	if !ok {
+		c.reply(550, "Permission denied")
+		return
+	}
+	resume := appendTo || offset > 0
+	owner := c.ip + "\x00" + c.user
+	if resume && !c.srv.ownsUpload(filepath.Join(dir, filename), owner) {
+		c.reply(550, "Can only resume files uploaded by you")
+		return
+	}
+	req := UploadRequest{Filename: filename, Size: -1, IP: c.ip, UserAgent: "FTP"}
+	if size > 0 {
+		req.Size = size
+	}
+	if !c.s.approveUpload(context.Background(), req) {
+		c.reply(550, "Upload denied")
+		return
+	}
+	if free, ok := hasSpace(dir, size); !ok {
+		c.reply(452, "Insufficient storage space, %s free", formatSize(int64(free)))
+		return
+	}
+
+	var f *os.File
+	var upload *uploadFile // 本次新建的文件，续传时为nil
+	var err error
+	origSize := int64(0)
+	if resume {
+		f, err = os.OpenFile(filepath.Join(dir, filename), os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			c.reply(550, "File not found")
+			return
+		}
+		info, err := f.Stat()
+		if err != nil || !info.Mode().IsRegular() || (offset > 0 && offset != info.Size()) {
+			f.Close()
+			c.reply(550, "Can only resume at the end of the file")
+			return
+		}
+		origSize = info.Size()
+	} else {
+		upload, err = c.fs.create(name)
+		if errors.Is(err, ErrFileExists) {
+			c.reply(553, "File exists")
+			return
+		}
+		if err != nil {
+			c.result(err, 0, "")
+			return
+		}
+		f = upload.File
+	}
+	defer f.Close()
+	path := f.Name()
+	if upload != nil {
+		path = upload.path
+	}
+
+	// discard 撤销本次写入：新建的文件删除（覆盖时删除临时文件），续传的文件截断到原来的大小
+	discard := func() {
+		if upload != nil {
+			upload.abort()
+		} else {
+			f.Truncate(origSize)
+		}
+	}
+	committed := false
+	limit := c.s.MaxUploadSize()
+	t := c.s.beginTransfer(TransferUpload, filepath.Base(path), c.ip, -1)
+	defer c.s.endTransfer(t)
+	c.transfer(func(conn net.Conn) error {
+		t.setAbort(func() { conn.Close() })
+		var r io.Reader = t.reader(newRateLimitedReader(context.Background(), conn, c.s.RateLimit()))
+		if limit > 0 {
+			r = io.LimitReader(r, max(limit-origSize, 0)+1)
+		}
+		n, err := io.Copy(f, r)
+		if err == nil && limit > 0 && origSize+n > limit {
+			discard()
+			t.fail()
+			return fmt.Errorf("超过上传大小限制")
+		}
+		// 在界面中取消的新上传删除已写入的部分，续传时保留之前的内容
+		if t.canceled() && upload != nil {
+			discard()
+		}
+		if err != nil {
+			t.fail()
+			return err
+		}
+		if upload != nil {
+			if err := upload.commit(); err != nil {
+				t.fail()
+				return err
+			}
+			committed = true
+		}
+		return nil
+	})
+	// 覆盖已有文件时只在完整接收后替换原文件；未完成的临时文件不能续传，直接删除，原文件保持不变
+	if upload != nil && upload.overwrites() && !committed {
+		upload.abort()
+		return
+	}
+	if upload != nil && fileExists(path) {
+		c.srv.addUpload(path, owner)
+	}
+	if !t.canceled() {
+		t.setFile(path)
+	}
+}
@@ -0,0 +1,228 @@
+package pairserver
+
+import (
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ftpTestClient 测试用的FTP客户端，只支持EPSV被动模式
+type ftpTestClient struct {
+	t    *testing.T
+	conn *textproto.Conn
+	host string
+}
+
+// newFTPTestServer 启动上传目录为dir、允许匿名登录的FTP服务，返回已登录的客户端和服务地址
+func newFTPTestServer(t *testing.T, s *Server, dir string) (*ftpTestClient, string) {
+	t.Helper()
+	s.SetUploadDir(dir)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &ftpServer{ln: ln, conns: make(map[io.Closer]bool)}
+	s.mu.Lock()
+	s.ftp = f
+	s.mu.Unlock()
+	f.wg.Add(1)
+	go f.serve(s)
+	t.Cleanup(s.stopFTP)
+	return dialFTP(t, ln.Addr().String()), ln.Addr().String()
+}
+
+// dialFTP 连接addr上的FTP服务并匿名登录
+func dialFTP(t *testing.T, addr string) *ftpTestClient {
+	t.Helper()
+	c := dialFTPAddr(t, addr)
+	c.cmd(230, "USER anonymous")
+	return c
+}
+
+// dialFTPAddr 连接addr上的FTP服务，不登录
+func dialFTPAddr(t *testing.T, addr string) *ftpTestClient {
+	t.Helper()
+	conn, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := &ftpTestClient{t: t, conn: conn, host: "127.0.0.1"}
+	c.expect(220)
+	return c
+}
+
+// expect 读取一条回复，状态码不为code时测试失败
+func (c *ftpTestClient) expect(code int) string {
+	c.t.Helper()
+	_, msg, err := c.conn.ReadResponse(code)
+	if err != nil {
+		c.t.Fatalf("应回复%d: %v", code, err)
+	}
+	return msg
+}
+
+// cmd 发送命令并检查回复的状态码
+func (c *ftpTestClient) cmd(code int, format string, args ...any) string {
+	c.t.Helper()
+	if _, err := c.conn.Cmd(format, args...); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.expect(code)
+}
+
+// open 以被动模式发送传输命令cmd并建立数据连接；命令在传输前被拒绝时返回nil和该状态码
+func (c *ftpTestClient) open(cmd string) (net.Conn, int) {
+	c.t.Helper()
+	msg := c.cmd(229, "EPSV")
+	port := strings.Trim(msg[strings.Index(msg, "(")+1:strings.Index(msg, ")")], "|")
+	if _, err := c.conn.Cmd("%s", cmd); err != nil {
+		c.t.Fatal(err)
+	}
+	if code, _, _ := c.conn.ReadResponse(0); code != 150 {
+		return nil, code
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(c.host, port))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return conn, 150
+}
+
+// finish 关闭数据连接，返回传输结束时的状态码
+func (c *ftpTestClient) finish(conn net.Conn) int {
+	conn.Close()
+	code, _, _ := c.conn.ReadResponse(0)
+	return code
+}
+
+// store 以命令cmd上传data，返回传输结束时的状态码；命令在传输前被拒绝时返回该状态码
+func (c *ftpTestClient) store(cmd, data string) int {
+	c.t.Helper()
+	conn, code := c.open(cmd)
+	if conn == nil {
+		return code
+	}
+	io.WriteString(conn, data)
+	return c.finish(conn)
+}
+
+// retrieve 以RETR下载name并读取全部数据，返回传输结束时的状态码；命令在传输前被拒绝时返回该状态码
+func (c *ftpTestClient) retrieve(name string) int {
+	c.t.Helper()
+	conn, code := c.open("RETR " + name)
+	if conn == nil {
+		return code
+	}
+	io.Copy(io.Discard, conn)
+	return c.finish(conn)
+}
+
+// TestFTPStore 上传只能新建文件或在已有文件末尾续传，失败时不影响之前接收的文件
+func TestFTPStore(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := New()
+	s.SetConflictPolicy(ConflictRename)
+	c, addr := newFTPTestServer(t, s, dir)
+	read := func(name string) string {
+		data, _ := os.ReadFile(filepath.Join(dir, name))
+		return string(data)
+	}
+
+	if code := c.store("STOR /uploads/a.txt", "new"); code != 226 {
+		t.Fatalf("上传状态码为%d", code)
+	}
+	if read("a.txt") != "old" || read("a (1).txt") != "new" {
+		t.Errorf("重名时应另存为新文件，a.txt为%q", read("a.txt"))
+	}
+	if code := c.store("STOR /uploads/b<c>.txt", "x"); code != 226 || read("b_c_.txt") != "x" {
+		t.Errorf("文件名应经过清理，状态码为%d", code)
+	}
+
+	for _, cmd := range []string{"DELE /uploads/a.txt", "RMD /uploads", "MKD /uploads/d", "RNFR /uploads/a.txt", "RNTO /uploads/z.txt"} {
+		c.cmd(550, "%s", cmd)
+	}
+	if read("a.txt") != "old" {
+		t.Error("已接收的文件不应被删除或重命名")
+	}
+
+	// 只能续传自己通过FTP上传的文件，其他客户端或其他方式保存的文件不能追加
+	if code := c.store("APPE /uploads/a.txt", "+1"); code != 550 || read("a.txt") != "old" {
+		t.Errorf("续传不是自己上传的文件时状态码为%d，内容为%q", code, read("a.txt"))
+	}
+	c.cmd(350, "REST 3")
+	if code := c.store("STOR /uploads/a.txt", "+1"); code != 550 || read("a.txt") != "old" {
+		t.Errorf("REST续传不是自己上传的文件时状态码为%d，内容为%q", code, read("a.txt"))
+	}
+	if code := c.store("STOR /uploads/r.txt", "old"); code != 226 {
+		t.Fatalf("上传状态码为%d", code)
+	}
+	if code := c.store("APPE /uploads/r.txt", "+1"); code != 226 || read("r.txt") != "old+1" {
+		t.Errorf("APPE应在末尾续传，状态码为%d，内容为%q", code, read("r.txt"))
+	}
+	c.cmd(350, "REST 1")
+	if code := c.store("STOR /uploads/r.txt", "x"); code != 550 || read("r.txt") != "old+1" {
+		t.Errorf("只能从文件末尾续传，状态码为%d", code)
+	}
+	other := dialFTPAddr(t, addr)
+	other.cmd(230, "USER bob")
+	if code := other.store("APPE /uploads/r.txt", "x"); code != 550 || read("r.txt") != "old+1" {
+		t.Errorf("其他用户续传时状态码为%d，内容为%q", code, read("r.txt"))
+	}
+	// 同一用户重新连接后可以继续续传
+	c = dialFTP(t, addr)
+	c.cmd(350, "REST 5")
+	if code := c.store("STOR /uploads/r.txt", "2"); code != 226 || read("r.txt") != "old+12" {
+		t.Errorf("REST应在末尾续传，状态码为%d，内容为%q", code, read("r.txt"))
+	}
+
+	// 超过大小限制时删除本次新建的文件，续传的文件恢复原来的内容；续传后的总大小也不能超过限制
+	s.SetMaxUploadSize(8)
+	if code := c.store("STOR /uploads/big.txt", "0123456789"); code != 426 {
+		t.Errorf("超过大小限制时状态码为%d，应为426", code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "big.txt")); !os.IsNotExist(err) {
+		t.Error("超过大小限制的新文件应被删除")
+	}
+	if code := c.store("APPE /uploads/r.txt", "0123"); code != 426 || read("r.txt") != "old+12" {
+		t.Errorf("超过大小限制的续传应恢复原来的内容，状态码为%d，内容为%q", code, read("r.txt"))
+	}
+
+	s.SetMaxUploadSize(0)
+	s.SetConflictPolicy(ConflictReject)
+	if code := c.store("STOR /uploads/a.txt", "new"); code != 553 {
+		t.Errorf("重名策略为拒绝时状态码为%d，应为553", code)
+	}
+	if code := c.store("STOR /a.txt", "x"); code != 550 {
+		t.Errorf("上传目录之外的状态码为%d，应为550", code)
+	}
+	c.cmd(200, "ALLO %s", strconv.FormatInt(1<<62, 10))
+	if code := c.store("STOR /uploads/huge.bin", "x"); code != 452 {
+		t.Errorf("ALLO超过可用空间时状态码为%d，应为452", code)
+	}
+}
+
+// TestFTPShareExpired 整个分享过期后，已登录的会话不能再列出或下载文件，新的登录被拒绝
+func TestFTPShareExpired(t *testing.T) {
+	s, _ := newRegistryServer(t, 1)
+	f := s.Files()[0]
+	c, addr := newFTPTestServer(t, s, t.TempDir())
+	if code := c.retrieve("/" + f.Filename); code != 226 {
+		t.Fatalf("过期前下载返回 %d", code)
+	}
+	listing := dialFTP(t, addr)
+
+	s.SetShareExpiry(time.Now().Add(-time.Second))
+	c.cmd(421, "RETR /%s", f.Filename)
+	listing.cmd(421, "LIST /")
+	dialFTPAddr(t, addr).cmd(421, "USER anonymous")
+}
@@ -0,0 +1,37 @@
+package pairserver
+
+import (
+	"net/http"
+	"strings"
+)
+
+// imageFiles 返回下载列表中的图片文件
+func imageFiles(files []File) []File {
+	var images []File
+	for _, f := range files {
+		if strings.HasPrefix(f.MimeType, "image/") {
+			images = append(images, f)
+		}
+	}
+	return images
+}
+
+// mostlyImages 返回下载列表中是否大部分为图片，此时在下载页面提供相册入口
+func mostlyImages(files []File) bool {
+	return len(files) > 0 && len(imageFiles(files))*2 > len(files)
+}
+
+// galleryHandler 相册页面：以网格显示下载列表中的图片，点击后全屏查看，可左右滑动切换
+func (s *Server) galleryHandler(w http.ResponseWriter, r *http.Request) {
+	images := imageFiles(s.unlockedFiles(r, s.activeFiles()))
+	names := make([]string, len(images))
+	for i, f := range images {
+		names[i] = f.Filename
+	}
+	data := struct {
+		T      map[string]string
+		Images []File
+		Names  []string
+	}{T: webStrings(r), Images: images, Names: names}
+	s.renderPage(w, http.StatusOK, "gallery.html", data)
+}
@@ -0,0 +1,335 @@
+package pairserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// indexHandler 上传页面处理器【调整按钮样式：放大字号/尺寸】
+func (s *Server) indexHandler(w http.ResponseWriter, r *http.Request) {
+	s.renderPage(w, http.StatusOK, "upload.html", struct {
+		T      map[string]string
+		Device string
+		CSRF   string
+	}{T: webStrings(r), Device: s.ClientName(clientIP(r)), CSRF: s.csrfToken(w, r)})
+}
+
+// downloadListHandler 下载列表页面处理器【修复水平对齐问题】
+// downloadListHandler 下载列表页面处理器【支持文件名折行】
+func (s *Server) downloadListHandler(w http.ResponseWriter, r *http.Request) {
+	files := s.activeFiles()
+	data := struct {
+		T       map[string]string
+		Files   []File
+		HasDirs bool
+		Gallery bool
+		CSRF    string
+	}{T: webStrings(r), Files: files, HasDirs: len(s.Dirs()) > 0, Gallery: mostlyImages(files), CSRF: s.csrfToken(w, r)}
+	s.renderPage(w, http.StatusOK, "download.html", data)
+}
+
+// uploadHandler 文件上传接口处理器
+func (s *Server) uploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.checkCSRF(w, r) {
+		return
+	}
+	// 带offset参数的请求以原始请求体续传单个文件，见resume.go
+	if r.URL.Query().Has("offset") {
+		s.resumeUpload(w, r)
+		return
+	}
+
+	uploadId := r.URL.Query().Get("uploadId")
+	if uploadId == "" {
+		http.Error(w, "缺少uploadId参数", http.StatusBadRequest)
+		return
+	}
+
+	// 超出大小限制的请求直接拒绝，未声明长度的请求在读取超限时中止
+	limit := s.MaxUploadSize()
+	if limit > 0 {
+		if r.ContentLength > limit {
+			writeTooLarge(w, r, limit)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	if !ensureSpace(w, r, s.UploadDir(), r.ContentLength) {
+		return
+	}
+
+	// 逐个读取multipart中的文件部分直接写入磁盘，不在内存或临时文件中缓存，
+	// 文件大小不受限制；单个文件的大小未知，以请求体长度作为进度总量
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("解析表单失败: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	progress := &UploadProgress{
+		TotalSize: r.ContentLength,
+		Uploaded:  0,
+	}
+	s.progress.add(uploadId, progress)
+	defer s.progress.remove(uploadId)
+
+	var saved []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if tooLarge(err) {
+			writeTooLarge(w, r, limit)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("解析表单失败: %v", err), http.StatusBadRequest)
+			return
+		}
+		if part.FormName() != "file" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		if !s.approveRequest(r, sanitizeFilename(part.FileName()), -1) {
+			part.Close()
+			writeUploadDenied(w, r)
+			return
+		}
+		if t := requestTransfer(r); t != nil {
+			t.describe(sanitizeFilename(part.FileName()), r.ContentLength, 0)
+		}
+		name, status, err := s.savePart(r.Context(), part, progress)
+		part.Close()
+		if status == http.StatusRequestEntityTooLarge {
+			writeTooLarge(w, r, limit)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		setRequestFile(r, filepath.Join(s.UploadDir(), name))
+		saved = append(saved, name)
+	}
+
+	if len(saved) == 0 {
+		http.Error(w, "获取文件失败: 请求中没有文件", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "文件上传成功: %s", strings.Join(saved, ", "))
+}
+
+// savePart 将multipart中的一个文件部分写入上传目录，重名时按策略处理；
+// 失败或ctx结束(客户端取消上传)时删除已写入的部分文件，并返回对应的HTTP状态码
+func (s *Server) savePart(ctx context.Context, part *multipart.Part, progress *UploadProgress) (string, int, error) {
+	filename := sanitizeFilename(part.FileName())
+	outFile, err := s.createUpload(s.UploadDir(), filename)
+	if errors.Is(err, ErrFileExists) {
+		return "", http.StatusConflict, fmt.Errorf("文件已存在: %s", filename)
+	}
+	if err != nil {
+		return "", http.StatusInternalServerError, fmt.Errorf("创建文件失败: %v", err)
+	}
+
+	// 包装Reader以跟踪进度
+	progressReader := &ProgressReader{
+		Reader:   newRateLimitedReader(ctx, part, s.RateLimit()),
+		Progress: progress,
+	}
+
+	_, err = io.Copy(outFile, progressReader)
+	if err != nil {
+		outFile.abort()
+		if tooLarge(err) {
+			return "", http.StatusRequestEntityTooLarge, err
+		}
+		return "", http.StatusInternalServerError, fmt.Errorf("保存文件失败: %v", err)
+	}
+	if err := outFile.commit(); err != nil {
+		return "", http.StatusInternalServerError, fmt.Errorf("保存文件失败: %v", err)
+	}
+	return filepath.Base(outFile.path), http.StatusOK, nil
+}
+
+// contentDisposition 返回Content-Disposition响应头，文件名中的引号、换行和非ASCII字符按RFC 2231编码；
+// 文件名无法编码时只返回disposition
+func contentDisposition(disposition, filename string) string {
+	if v := mime.FormatMediaType(disposition, map[string]string{"filename": filename}); v != "" {
+		return v
+	}
+	return disposition
+}
+
+// downloadHandler 文件下载接口处理器
+func (s *Server) downloadHandler(w http.ResponseWriter, r *http.Request) {
+	filename := r.URL.Query().Get("file")
+	if filename == "" {
+		http.Error(w, "缺少file参数", http.StatusBadRequest)
+		return
+	}
+
+	// 查找文件
+	targetFile, found := s.findFile(filename)
+	if !found {
+		s.writeNotFound(w, filename)
+		return
+	}
+	if !s.requireFilePassword(w, r, targetFile, true) {
+		return
+	}
+	if !s.reserveRequestDownload(w, r, targetFile) {
+		return
+	}
+
+	// 设置下载响应头
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", targetFile.Filename))
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	// 打开文件并写入响应
+	file, err := os.Open(targetFile.AbsPath)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("打开文件失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("读取文件信息失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	setRequestFile(r, targetFile.AbsPath)
+
+	// ServeContent处理Range/If-Range/If-Modified-Since等请求头，支持断点续传和拖动播放；
+	// 未限速时直接传入*os.File，明文HTTP/1.1下由sendfile发送，见sendfile.go
+	http.ServeContent(w, r, targetFile.Filename, fileInfo.ModTime(), newRateLimitedReadSeeker(r.Context(), file, s.RateLimit()))
+}
+
+// scriptableTypes 浏览器中可执行脚本的文件类型
+var scriptableTypes = map[string]bool{
+	"text/html":             true,
+	"application/xhtml+xml": true,
+	"image/svg+xml":         true,
+	"text/xml":              true,
+	"application/xml":       true,
+}
+
+// viewHandler 在浏览器中直接查看文件：按文件类型返回Content-Type并支持Range请求，
+// 图片直接显示，音视频可边下边播和拖动进度
+func (s *Server) viewHandler(w http.ResponseWriter, r *http.Request) {
+	filename := r.URL.Query().Get("file")
+	if filename == "" {
+		http.Error(w, "缺少file参数", http.StatusBadRequest)
+		return
+	}
+
+	targetFile, found := s.findFile(filename)
+	if !found {
+		s.writeNotFound(w, filename)
+		return
+	}
+	if !s.requireFilePassword(w, r, targetFile, true) {
+		return
+	}
+	if !s.reserveRequestDownload(w, r, targetFile) {
+		return
+	}
+
+	file, err := os.Open(targetFile.AbsPath)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("打开文件失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("读取文件信息失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// 禁止浏览器猜测类型；可包含脚本的网页和SVG在沙箱中打开，以免其中的脚本访问本站
+	w.Header().Set("Content-Type", targetFile.MimeType)
+	w.Header().Set("Content-Disposition", contentDisposition("inline", targetFile.Filename))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if scriptableTypes[targetFile.MimeType] {
+		w.Header().Set("Content-Security-Policy", "sandbox")
+	}
+	setRequestFile(r, targetFile.AbsPath)
+	http.ServeContent(w, r, targetFile.Filename, fileInfo.ModTime(), newRateLimitedReadSeeker(r.Context(), file, s.RateLimit()))
+}
+
+// pinHandler PIN码验证接口：验证通过后设置会话Cookie并跳回原页面
+func (s *Server) pinHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	T := webStrings(r)
+	session, locked := s.checkPIN(r, r.FormValue("pin"))
+	if locked {
+		s.pinPage(w, r, T["PinLocked"])
+		return
+	}
+	if session == "" {
+		s.pinPage(w, r, T["PinWrong"])
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    session,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	next := localPath(r.FormValue("next"), "/")
+	http.Redirect(w, r, s.sitePath(next), http.StatusSeeOther)
+}
+
+// localPath 返回可以安全跳转的站内路径：next须能解析为不带协议和主机的绝对路径，否则返回fallback。
+// 浏览器会把反斜杠当作斜杠，/\evil.com会被当作//evil.com，因此含反斜杠的也不允许
+func localPath(next, fallback string) string {
+	u, err := url.Parse(next)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Opaque != "" ||
+		!strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.Contains(next, `\`) {
+		return fallback
+	}
+	return next
+}
+
+// pinPage 显示PIN码输入页面，errMsg非空时显示错误提示
+func (s *Server) pinPage(w http.ResponseWriter, r *http.Request, errMsg string) {
+	next := r.URL.RequestURI()
+	if r.Method == http.MethodPost {
+		next = r.FormValue("next")
+	}
+	data := struct {
+		T     map[string]string
+		Next  string
+		Error string
+	}{T: webStrings(r), Next: next, Error: errMsg}
+
+	s.renderPage(w, http.StatusUnauthorized, "pin.html", data)
+}
@@ -0,0 +1,95 @@
+package pairserver
+
+import (
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestLocalPath PIN码和文件密码验证后只能跳转到站内路径
+func TestLocalPath(t *testing.T) {
+	tests := []struct {
+		next, want string
+	}{
+		{"/text-page", "/text-page"},
+		{"/download?file=a.txt", "/download?file=a.txt"},
+		{"", "/"},
+		{"text-page", "/"},
+		{"//evil.com", "/"},
+		{`/\evil.com`, "/"},
+		{`/\/evil.com`, "/"},
+		{"/%5Cevil.com", "/%5Cevil.com"},
+		{"https://evil.com/", "/"},
+		{"javascript:alert(1)", "/"},
+		{"/\t/evil.com", "/"},
+		{"/\n/evil.com", "/"},
+	}
+	for _, tt := range tests {
+		if got := localPath(tt.next, "/"); got != tt.want {
+			t.Errorf("localPath(%q) = %q，应为 %q", tt.next, got, tt.want)
+		}
+	}
+}
+
+// TestContentDisposition 文件名中的引号、分号和非ASCII字符经过编码，解析后仍为原文件名
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"a.txt", "attachment; filename=a.txt"},
+		{`a "b".txt`, `attachment; filename="a \"b\".txt"`},
+		{"a; filename=x.exe", `attachment; filename="a; filename=x.exe"`},
+		{"照片.jpg", "attachment; filename*=utf-8''%E7%85%A7%E7%89%87.jpg"},
+	}
+	for _, tt := range tests {
+		got := contentDisposition("attachment", tt.name)
+		if got != tt.want {
+			t.Errorf("contentDisposition(%q) = %q，应为 %q", tt.name, got, tt.want)
+		}
+		if _, params, err := mime.ParseMediaType(got); err != nil || params["filename"] != tt.name {
+			t.Errorf("%q 解析后的文件名为 %q: %v", got, params["filename"], err)
+		}
+	}
+	if got := contentDisposition("inline", "a\r\nX-Evil: 1"); strings.ContainsAny(got, "\r\n") {
+		t.Errorf("文件名中的换行不应出现在响应头中: %q", got)
+	}
+}
+
+// TestCSRFProtectedForms 网页发出的文本、剪贴板和设备名称提交必须携带CSRF令牌，非网页程序不受影响
+func TestCSRFProtectedForms(t *testing.T) {
+	s, h := newRegistryServer(t, 0)
+	s.SetClipboardSync(true)
+	cookie := &http.Cookie{Name: clientCookie, Value: "session"}
+	post := func(path, body, token string, browser bool) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(cookie)
+		if browser {
+			r.Header.Set("Origin", "http://evil.example")
+		}
+		if token != "" {
+			r.Header.Set(csrfHeader, token)
+		}
+		return r
+	}
+	for _, tt := range []struct{ path, body string }{
+		{"/text", "text=hi"},
+		{"/clipboard", "text=hi"},
+		{"/device-name", "name=phone"},
+	} {
+		if code := serve(h, post(tt.path, tt.body, "", true)); code != http.StatusForbidden {
+			t.Errorf("%s 缺少令牌的跨站请求返回 %d，应为403", tt.path, code)
+		}
+		if code := serve(h, post(tt.path, tt.body, "wrong", true)); code != http.StatusForbidden {
+			t.Errorf("%s 令牌错误的跨站请求返回 %d，应为403", tt.path, code)
+		}
+		if code := serve(h, post(tt.path, tt.body, s.csrfFor(cookie.Value), true)); code == http.StatusForbidden {
+			t.Errorf("%s 携带正确令牌的请求被拒绝", tt.path)
+		}
+		if code := serve(h, post(tt.path, tt.body, "", false)); code == http.StatusForbidden {
+			t.Errorf("%s 非网页程序的请求被拒绝", tt.path)
+		}
+	}
+}
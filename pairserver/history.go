@@ -0,0 +1,346 @@
+package pairserver
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// HistoryResult 传输的结果
+type HistoryResult string
+
+const (
+	HistoryCompleted HistoryResult = "completed" // 传输完成
+	HistoryFailed    HistoryResult = "failed"    // 传输出错或连接中断
+	HistoryCanceled  HistoryResult = "canceled"  // 在界面中取消
+)
+
+// HistoryEntry 传输记录中的一次上传或下载
+type HistoryEntry struct {
+	Time       time.Time         `json:"time"` // 传输结束的时间
+	Direction  TransferDirection `json:"direction"`
+	Filename   string            `json:"filename"`
+	Path       string            `json:"path,omitempty"` // 本机文件的路径，上传时为保存的位置；打包下载等没有对应文件时为空
+	Size       int64             `json:"size"`           // 字节数，未完成时为实际传输的字节数
+	ClientIP   string            `json:"client_ip"`
+	ClientName string            `json:"client_name,omitempty"`
+	Duration   time.Duration     `json:"duration"`
+	Result     HistoryResult     `json:"result"`
+}
+
+// maxHistoryResults 搜索和历史页面最多返回的记录数，导出不受限制
+const maxHistoryResults = 1000
+
+// historySchema 记录表及索引：按时间倒序列出和搜索，按文件名、客户端查找
+const historySchema = `
+CREATE TABLE IF NOT EXISTS transfers (
+	id          INTEGER PRIMARY KEY,
+	time        INTEGER NOT NULL, -- 传输结束的时间，Unix纳秒
+	direction   INTEGER NOT NULL,
+	filename    TEXT NOT NULL,
+	path        TEXT NOT NULL,
+	size        INTEGER NOT NULL,
+	client_ip   TEXT NOT NULL,
+	client_name TEXT NOT NULL,
+	duration    INTEGER NOT NULL, -- 纳秒
+	result      TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS transfers_time ON transfers(time);
+CREATE INDEX IF NOT EXISTS transfers_filename ON transfers(filename COLLATE NOCASE);
+CREATE INDEX IF NOT EXISTS transfers_client ON transfers(client_ip, time);
+`
+
+// historyColumns 读取记录时的列，顺序与scanHistory一致
+const historyColumns = "time, direction, filename, path, size, client_ip, client_name, duration, result"
+
+// History 保存在SQLite数据库中的传输记录，按时间、文件名和客户端IP建立索引，
+// 搜索和导出直接查询数据库，不把记录读入内存
+type History struct {
+	db *sql.DB
+}
+
+// OpenHistory 打开传输记录数据库，不存在时创建
+func OpenHistory(path string) (*History, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	// WAL模式下导出等读操作不阻塞写入新的记录
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("打开传输记录失败: %w", err)
+	}
+	return &History{db: db}, nil
+}
+
+// Close 关闭传输记录数据库
+func (h *History) Close() error {
+	return h.db.Close()
+}
+
+// Add 写入一条记录
+func (h *History) Add(e HistoryEntry) error {
+	_, err := h.db.Exec("INSERT INTO transfers ("+historyColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", historyValues(e)...)
+	return err
+}
+
+// ImportJSONLines 导入早期版本保存的记录文件（每行一条JSON记录），跳过损坏的行，返回导入的记录数
+func (h *History) ImportJSONLines(r io.Reader) (int, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare("INSERT INTO transfers (" + historyColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var e HistoryEntry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		if _, err := stmt.Exec(historyValues(e)...); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return count, tx.Commit()
+}
+
+// historyValues 返回记录在historyColumns各列中的值
+func historyValues(e HistoryEntry) []any {
+	return []any{e.Time.UnixNano(), int(e.Direction), e.Filename, e.Path, e.Size, e.ClientIP, e.ClientName, int64(e.Duration), string(e.Result)}
+}
+
+// Count 返回记录总数
+func (h *History) Count() (int, error) {
+	var n int
+	err := h.db.QueryRow("SELECT COUNT(*) FROM transfers").Scan(&n)
+	return n, err
+}
+
+// Search 返回文件名、路径、客户端IP或名称包含关键字的记录，不区分大小写，最近的在前，
+// 最多maxHistoryResults条；关键字为空时返回最近的记录
+func (h *History) Search(keyword string) []HistoryEntry {
+	query := "SELECT " + historyColumns + " FROM transfers"
+	var args []any
+	if keyword = strings.TrimSpace(keyword); keyword != "" {
+		// 沿时间索引倒序扫描，找到足够的记录即停止
+		query += ` WHERE filename LIKE ?1 ESCAPE '\' OR path LIKE ?1 ESCAPE '\'
+			OR client_ip LIKE ?1 ESCAPE '\' OR client_name LIKE ?1 ESCAPE '\'`
+		args = append(args, "%"+escapeLike(keyword)+"%")
+	}
+	query += " ORDER BY time DESC, id DESC LIMIT " + strconv.Itoa(maxHistoryResults)
+
+	var list []HistoryEntry
+	if err := h.query(func(e HistoryEntry) error {
+		list = append(list, e)
+		return nil
+	}, query, args...); err != nil {
+		log.Printf("查询传输记录失败: %v", err)
+	}
+	return list
+}
+
+// escapeLike 转义LIKE模式中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// each 按时间顺序逐条读取全部记录，不把记录全部读入内存
+func (h *History) each(fn func(HistoryEntry) error) error {
+	return h.query(fn, "SELECT "+historyColumns+" FROM transfers ORDER BY time, id")
+}
+
+// query 执行查询并将每行记录交给fn
+func (h *History) query(fn func(HistoryEntry) error, query string, args ...any) error {
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e HistoryEntry
+		var t, duration int64
+		var result string
+		if err := rows.Scan(&t, &e.Direction, &e.Filename, &e.Path, &e.Size, &e.ClientIP, &e.ClientName, &duration, &result); err != nil {
+			return err
+		}
+		e.Time, e.Duration, e.Result = time.Unix(0, t), time.Duration(duration), HistoryResult(result)
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// historyCSVHeader 导出CSV的表头
+var historyCSVHeader = []string{"time", "direction", "filename", "path", "size", "client_ip", "client_name", "duration_seconds", "result"}
+
+// WriteCSV 将全部记录按时间顺序以CSV格式写入w，第一行为表头，返回写入的记录数；
+// 开头写入UTF-8 BOM，以便Excel正确识别中文文件名
+func (h *History) WriteCSV(w io.Writer) (int, error) {
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return 0, err
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(historyCSVHeader)
+	count := 0
+	err := h.each(func(e HistoryEntry) error {
+		count++
+		return cw.Write([]string{
+			e.Time.Format(time.RFC3339),
+			e.Direction.String(),
+			e.Filename,
+			e.Path,
+			strconv.FormatInt(e.Size, 10),
+			e.ClientIP,
+			e.ClientName,
+			strconv.FormatFloat(e.Duration.Seconds(), 'f', 3, 64),
+			string(e.Result),
+		})
+	})
+	if err != nil {
+		return count, err
+	}
+	cw.Flush()
+	return count, cw.Error()
+}
+
+// WriteJSON 将全部记录按时间顺序以JSON数组写入w，字段与HistoryEntry的JSON相同，返回写入的记录数
+func (h *History) WriteJSON(w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("[")
+	count := 0
+	err := h.each(func(e HistoryEntry) error {
+		data, err := json.MarshalIndent(e, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			bw.WriteString(",")
+		}
+		count++
+		bw.WriteString("\n  ")
+		_, err = bw.Write(data)
+		return err
+	})
+	if err != nil {
+		return count, err
+	}
+	if count > 0 {
+		bw.WriteString("\n")
+	}
+	bw.WriteString("]\n")
+	return count, bw.Flush()
+}
+
+// SetHistory 设置保存传输记录的位置，nil表示不记录
+func (s *Server) SetHistory(h *History) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.history = h
+}
+
+// History 返回保存传输记录的位置，未设置时返回nil
+func (s *Server) History() *History {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.history
+}
+
+// recordHistory 将结束的传输记入传输记录，发布上传或下载结束的事件，通知Webhook并交给接收后命令和插件处理
+func (s *Server) recordHistory(t *transfer) {
+	e, ok := s.historyEntry(t)
+	if !ok {
+		return
+	}
+	typ := EventDownloadFinished
+	if t.dir == TransferUpload {
+		typ = EventUploadFinished
+	}
+	s.publish(typ, e)
+	s.notifyWebhooks(typ, e)
+	s.runPostReceive(e)
+	if e.Direction == TransferDownload && e.Result == HistoryCompleted && e.Path != "" {
+		if slot := t.downloadSlot(); slot != nil {
+			slot.finish(true)
+		} else {
+			s.countDownloads(e.Path)
+		}
+		s.markServed(e.Path)
+	}
+	processTransfer(e)
+	if h := s.History(); h != nil {
+		if err := h.Add(e); err != nil {
+			log.Printf("写入传输记录失败: %v", err)
+		}
+	}
+}
+
+// historyEntry 返回结束的传输对应的记录。只传输了文件一部分的请求（如断点续传的分块、
+// 播放器的Range请求）、没有保存文件的上传请求和出错的下载请求不记录，返回false
+func (s *Server) historyEntry(t *transfer) (HistoryEntry, bool) {
+	snap := t.snapshot()
+	t.mu.Lock()
+	file, fileSize, status, partial, failed := t.file, t.fileSize, t.status, t.partial, t.failed
+	t.mu.Unlock()
+
+	e := HistoryEntry{
+		Time:       time.Now(),
+		Direction:  t.dir,
+		Filename:   snap.Filename,
+		Path:       file,
+		Size:       snap.Done,
+		ClientIP:   t.ip,
+		ClientName: s.ClientName(t.ip),
+		Result:     HistoryCompleted,
+	}
+	e.Duration = e.Time.Sub(t.started).Round(time.Millisecond)
+	switch {
+	case t.canceled():
+		e.Result = HistoryCanceled
+	case partial || status == http.StatusPartialContent || status == http.StatusNotModified:
+		return e, false
+	case t.dir == TransferDownload && status >= http.StatusBadRequest:
+		// 下载出错时写出的是错误信息而不是文件
+		return e, false
+	case failed || t.dir == TransferDownload && snap.Total >= 0 && snap.Done < snap.Total:
+		if t.count.Load() == 0 {
+			return e, false
+		}
+		e.Result = HistoryFailed
+	case t.dir == TransferUpload && file == "":
+		// 创建断点续传等没有保存文件的请求
+		return e, false
+	case file != "":
+		e.Size = fileSize
+	}
+	return e, true
+}
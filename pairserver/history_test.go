@@ -0,0 +1,139 @@
+package pairserver
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// openTestHistory 打开临时目录中的传输记录
+func openTestHistory(t *testing.T) (*History, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "history.db")
+	h, err := OpenHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h, path
+}
+
+// addHistory 向h追加n条记录，文件名依次为start、start+1……，时间依次递增
+func addHistory(t *testing.T, h *History, start, n int, ip string) {
+	t.Helper()
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := start; i < start+n; i++ {
+		e := HistoryEntry{Time: base.Add(time.Duration(i) * time.Second), Filename: strconv.Itoa(i), ClientIP: ip, Result: HistoryCompleted}
+		if err := h.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestHistoryPersist 重新打开后保留全部记录，字段与写入的相同，导出包含全部记录
+func TestHistoryPersist(t *testing.T) {
+	h, path := openTestHistory(t)
+	want := HistoryEntry{
+		Time:       time.Date(2026, 3, 4, 5, 6, 7, 8, time.Local),
+		Direction:  TransferDownload,
+		Filename:   "照片.jpg",
+		Path:       "/tmp/照片.jpg",
+		Size:       1234,
+		ClientIP:   "192.168.1.2",
+		ClientName: "手机",
+		Duration:   1500 * time.Millisecond,
+		Result:     HistoryFailed,
+	}
+	if err := h.Add(want); err != nil {
+		t.Fatal(err)
+	}
+	addHistory(t, h, 0, maxHistoryResults+500, "10.0.0.1")
+	h.Close()
+
+	h, err := OpenHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if n, err := h.Count(); err != nil || n != maxHistoryResults+501 {
+		t.Errorf("重新打开后有 %d 条记录: %v", n, err)
+	}
+	got := h.Search("照片")
+	if len(got) != 1 || !got[0].Time.Equal(want.Time) {
+		t.Fatalf("搜索到 %v", got)
+	}
+	got[0].Time = want.Time
+	if got[0] != want {
+		t.Errorf("读出的记录为 %+v，应为 %+v", got[0], want)
+	}
+
+	var buf bytes.Buffer
+	count, err := h.WriteJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exported []HistoryEntry
+	if err := json.Unmarshal(buf.Bytes(), &exported); err != nil {
+		t.Fatalf("导出的JSON无效: %v", err)
+	}
+	if count != maxHistoryResults+501 || len(exported) != count || exported[0].Filename != "0" || exported[count-1].Filename != "照片.jpg" {
+		t.Errorf("导出 %d 条记录，解析出 %d 条，应按时间顺序导出全部 %d 条", count, len(exported), maxHistoryResults+501)
+	}
+	buf.Reset()
+	if count, err := h.WriteCSV(&buf); err != nil || count != maxHistoryResults+501 {
+		t.Errorf("导出CSV %d 条记录: %v", count, err)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(buf.Bytes(), []byte("\ufeff")))).ReadAll()
+	if err != nil || len(rows) != maxHistoryResults+502 || rows[0][0] != "time" {
+		t.Errorf("导出的CSV有 %d 行: %v", len(rows), err)
+	}
+}
+
+// TestHistorySearch 搜索全部记录而不只是最近的记录，最近的在前，最多返回maxHistoryResults条；
+// 关键字中的通配符按原样匹配
+func TestHistorySearch(t *testing.T) {
+	h, _ := openTestHistory(t)
+	addHistory(t, h, 0, 10, "192.168.1.9")
+	addHistory(t, h, 10, maxHistoryResults+10, "10.0.0.1")
+	h.Add(HistoryEntry{Time: time.Now(), Filename: "100%_done.txt", ClientName: "Pixel", Result: HistoryCompleted})
+
+	tests := []struct {
+		keyword string
+		n       int
+		first   string // 第一条（最近的）记录的文件名
+	}{
+		{"", maxHistoryResults, "100%_done.txt"},
+		{"192.168.1.9", 10, "9"},
+		{"  pixel ", 1, "100%_done.txt"},
+		{"%_", 1, "100%_done.txt"},
+		{"_", 1, "100%_done.txt"},
+		{"missing", 0, ""},
+	}
+	for _, tt := range tests {
+		got := h.Search(tt.keyword)
+		if len(got) != tt.n || tt.n > 0 && got[0].Filename != tt.first {
+			t.Errorf("搜索 %q 得到 %d 条记录，应为 %d 条，第一条为 %q", tt.keyword, len(got), tt.n, tt.first)
+		}
+	}
+}
+
+// TestHistoryImport 导入早期版本的记录文件，跳过损坏的行
+func TestHistoryImport(t *testing.T) {
+	h, _ := openTestHistory(t)
+	data := `{"time":"2025-01-01T00:00:00Z","direction":"download","filename":"a.txt","size":3,"client_ip":"10.0.0.2","duration":1000000,"result":"completed"}
+{broken
+{"time":"2025-01-02T00:00:00Z","direction":"upload","filename":"b.txt","size":5,"client_ip":"10.0.0.3","duration":0,"result":"failed"}
+`
+	n, err := h.ImportJSONLines(bytes.NewReader([]byte(data)))
+	if err != nil || n != 2 {
+		t.Fatalf("导入了 %d 条记录: %v", n, err)
+	}
+	got := h.Search("")
+	if len(got) != 2 || got[0].Filename != "b.txt" || got[1].Direction != TransferDownload || got[1].Duration != time.Millisecond {
+		t.Errorf("导入后的记录为 %+v", got)
+	}
+}
@@ -0,0 +1,96 @@
+package pairserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// http3Server 运行中的HTTP/3监听，与TCP服务使用相同的端口号
+type http3Server struct {
+	server *http3.Server
+	conn   net.PacketConn // 监听的UDP套接字，http3.Server关闭时不会关闭它
+	port   int
+}
+
+// SetHTTP3 设置是否在TCP服务之外同时提供HTTP/3（QUIC）监听，仅在启用HTTPS时生效，下次启动服务时生效；
+// 丢包较多的Wi-Fi下QUIC的传输速度明显更好
+func (s *Server) SetHTTP3(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.useHTTP3 = enabled
+}
+
+// HTTP3Enabled 返回HTTP/3监听是否正在运行
+func (s *Server) HTTP3Enabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.h3 != nil
+}
+
+// startHTTP3 在UDP端口上启动HTTP/3监听，未启用或未设置HTTPS证书时不启动
+func (s *Server) startHTTP3(port int, handler http.Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.useHTTP3 || s.tlsCert == nil {
+		return
+	}
+	conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		log.Printf("启动HTTP/3监听失败: %v", err)
+		return
+	}
+	server := &http3.Server{
+		Handler: handler,
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{
+			Certificates: []tls.Certificate{*s.tlsCert},
+			MinVersion:   tls.VersionTLS13,
+		}),
+		// 空闲超时与TCP连接一致，为0时使用quic-go的默认值
+		QUICConfig:  &quic.Config{MaxIdleTimeout: s.timeouts.idle},
+		IdleTimeout: s.timeouts.idle,
+	}
+	s.h3 = &http3Server{server: server, conn: conn, port: port}
+	go func() {
+		if err := server.Serve(conn); err != nil && err != http.ErrServerClosed {
+			log.Printf("HTTP/3服务运行失败: %v", err)
+		}
+	}()
+	log.Printf("HTTP/3监听启动成功: udp :%d", port)
+}
+
+// stopHTTP3 停止HTTP/3监听并断开所有连接
+func (s *Server) stopHTTP3() {
+	s.mu.Lock()
+	h3 := s.h3
+	s.h3 = nil
+	s.mu.Unlock()
+
+	if h3 == nil {
+		return
+	}
+	h3.server.Close()
+	h3.conn.Close()
+}
+
+// advertiseHTTP3 HTTP/3监听运行时在TCP响应中添加Alt-Svc头，支持的浏览器随后会改用QUIC连接
+func (s *Server) advertiseHTTP3(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		h3 := s.h3
+		s.mu.RUnlock()
+
+		if h3 != nil && r.TLS != nil {
+			w.Header().Set("Alt-Svc", fmt.Sprintf(`h3=":%d"; ma=86400`, h3.port))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
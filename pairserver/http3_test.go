@@ -0,0 +1,136 @@
+package pairserver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// newH3Client 以handler启动HTTP/3监听，返回只使用HTTP/3的客户端和监听地址
+func newH3Client(t *testing.T, s *Server, handler http.Handler) (*http.Client, string) {
+	t.Helper()
+	cert, err := LoadOrCreateCert(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetTLSCert(&cert)
+	s.SetHTTP3(true)
+	s.startHTTP3(0, handler)
+	if !s.HTTP3Enabled() {
+		t.Fatal("HTTP/3监听未启动")
+	}
+	t.Cleanup(s.stopHTTP3)
+
+	tr := &http3.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	t.Cleanup(func() { tr.Close() })
+	addr := fmt.Sprintf("https://127.0.0.1:%d", s.h3.conn.LocalAddr().(*net.UDPAddr).Port)
+	return &http.Client{Transport: tr}, addr
+}
+
+// h3Do 发送请求并读取完整的响应体
+func h3Do(t *testing.T, c *http.Client, r *http.Request) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := c.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+// echoHandler 在响应中返回请求的方法、路径、部分请求头和请求体
+var echoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("X-Proto", r.Proto)
+	w.Header().Set("X-TLS", fmt.Sprint(r.TLS != nil))
+	w.Header().Set("X-Test", r.Header.Get("X-Test"))
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "%s %s %s", r.Method, r.URL.RequestURI(), body)
+})
+
+// TestHTTP3RoundTrip 请求头、请求体和响应均能通过HTTP/3传输，处理函数看到的是HTTPS请求
+func TestHTTP3RoundTrip(t *testing.T) {
+	c, addr := newH3Client(t, New(), echoHandler)
+
+	r, _ := http.NewRequest(http.MethodGet, addr+"/a%20b?x=1", nil)
+	r.Header.Set("X-Test", "值")
+	resp, body := h3Do(t, c, r)
+	if resp.StatusCode != http.StatusCreated || string(body) != "GET /a%20b?x=1 " {
+		t.Errorf("响应为 %d %q", resp.StatusCode, body)
+	}
+	for name, want := range map[string]string{"X-Proto": "HTTP/3.0", "X-TLS": "true", "X-Test": "值"} {
+		if got := resp.Header.Get(name); got != want {
+			t.Errorf("响应头%s为 %q，应为 %q", name, got, want)
+		}
+	}
+
+	r, _ = http.NewRequest(http.MethodPost, addr+"/upload", strings.NewReader("hello, world"))
+	if _, body := h3Do(t, c, r); string(body) != "POST /upload hello, world" {
+		t.Errorf("响应体为 %q", body)
+	}
+}
+
+// TestHTTP3Download 通过服务的完整处理链下载文件
+func TestHTTP3Download(t *testing.T) {
+	s, h := newRegistryServer(t, 1)
+	c, addr := newH3Client(t, s, h)
+	f := s.Files()[0]
+	want, err := os.ReadFile(f.AbsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, addr+"/download?file="+f.Filename, nil)
+	if resp, body := h3Do(t, c, r); resp.StatusCode != http.StatusOK || !bytes.Equal(body, want) {
+		t.Errorf("下载响应为 %d，%d字节，应为%d字节", resp.StatusCode, len(body), len(want))
+	}
+
+	r, _ = http.NewRequest(http.MethodGet, addr+"/download?file="+f.Filename, nil)
+	r.Header.Set("Range", "bytes=10-19")
+	if resp, body := h3Do(t, c, r); resp.StatusCode != http.StatusPartialContent || !bytes.Equal(body, want[10:20]) {
+		t.Errorf("Range响应为 %d %x", resp.StatusCode, body)
+	}
+}
+
+// TestAdvertiseHTTP3 HTTP/3监听运行时HTTPS响应带Alt-Svc头，HTTP响应不带
+func TestAdvertiseHTTP3(t *testing.T) {
+	s := New()
+	h := s.advertiseHTTP3(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodGet, "https://pair.test/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got := w.Header().Get("Alt-Svc"); got != "" {
+		t.Errorf("未启动HTTP/3时Alt-Svc为 %q", got)
+	}
+
+	s.h3 = &http3Server{port: 8443}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got, want := w.Header().Get("Alt-Svc"), `h3=":8443"; ma=86400`; got != want {
+		t.Errorf("Alt-Svc为 %q，应为 %q", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://pair.test/", nil))
+	if got := w.Header().Get("Alt-Svc"); got != "" {
+		t.Errorf("HTTP请求的Alt-Svc为 %q", got)
+	}
+}
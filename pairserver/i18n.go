@@ -0,0 +1,220 @@
+package pairserver
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 网页支持的语言
+const (
+	langZh = "zh" // 中文
+	langEn = "en" // English
+)
+
+// webMessages 网页字符串表，按语言区分
+var webMessages = map[string]map[string]string{
+	langZh: {
+		"HTMLLang":         "zh-CN",
+		"UploadTitle":      "文件上传（带进度）",
+		"UploadHeading":    "多文件上传",
+		"SelectFiles":      "选择文件",
+		"StartUpload":      "开始上传",
+		"DropHint":         "也可以将文件拖到这里，或粘贴剪贴板中的截图",
+		"OfflineTitle":     "无法连接到电脑",
+		"OfflineHint":      "电脑上的pair-gui没有运行，或手机与电脑不在同一网络。请在电脑上启动服务后重试，恢复连接后会自动返回。",
+		"OfflineRetry":     "重试",
+		"OfflineLast":      "上次访问：",
+		"PushEnable":       "开启通知",
+		"PushEnabled":      "已开启通知",
+		"PushFailed":       "开启通知失败：",
+		"PushNewFiles":     "电脑分享了新文件",
+		"PushUploadDone":   "上传完成",
+		"GoDownload":       "前往文件下载页面",
+		"UploadDone":       "上传完成",
+		"UploadMerging":    "正在合并…",
+		"UploadFailed":     "上传失败",
+		"NetworkError":     "上传失败（网络错误）",
+		"UploadRetrying":   "连接中断，正在重试…",
+		"FileExists":       "上传失败（电脑上已有同名文件）",
+		"UploadCanceled":   "电脑端已取消该上传",
+		"UploadDenied":     "电脑端拒绝接收该文件",
+		"FileTooLarge":     "文件超过大小限制（最大 %s）",
+		"DiskFull":         "电脑磁盘空间不足（剩余 %s）",
+		"DownloadTitle":    "文件下载列表",
+		"ColName":          "文件名",
+		"ColSize":          "文件大小 (KB)",
+		"ColModified":      "修改时间",
+		"ColOp":            "操作",
+		"NoFiles":          "暂无可下载文件",
+		"Download":         "下载",
+		"Preview":          "预览",
+		"FileQR":           "扫码下载此文件（点击放大）",
+		"Checksums":        "下载校验和清单（SHA256SUMS）",
+		"DownloadAll":      "全部下载（ZIP）",
+		"DownloadSel":      "下载选中文件",
+		"GoUpload":         "前往文件上传页面",
+		"GoBrowse":         "浏览共享文件夹",
+		"GoDownloadList":   "返回文件下载列表",
+		"BrowseTitle":      "共享文件夹",
+		"GalleryTitle":     "相册",
+		"TextTitle":        "文本传输",
+		"TextHint":         "输入要发送到电脑的文本，如链接、验证码",
+		"SendText":         "发送文本",
+		"GoText":           "发送文本",
+		"DeviceName":       "本设备名称：",
+		"Save":             "保存",
+		"Saved":            "已保存",
+		"SaveFailed":       "保存失败",
+		"FromPhone":        "手机",
+		"FromComputer":     "电脑",
+		"Copy":             "复制",
+		"Copied":           "已复制",
+		"SendFailed":       "发送失败",
+		"ClipSync":         "剪贴板同步",
+		"ClipSyncHint":     "电脑复制的内容会显示在这里；在HTTPS页面中手机剪贴板的变化也会自动同步到电脑",
+		"ClipPaste":        "同步到电脑",
+		"GoGallery":        "以相册方式浏览图片",
+		"NoImages":         "暂无图片",
+		"BrowseRoot":       "全部",
+		"EmptyDir":         "文件夹为空",
+		"PinTitle":         "需要PIN码",
+		"PinPrompt":        "请输入电脑上显示的PIN码",
+		"PinSubmit":        "确定",
+		"PinWrong":         "PIN码错误，请重试",
+		"PinLocked":        "错误次数过多，请稍后再试",
+		"WordCodeTitle":    "输入配对码",
+		"WordCodePrompt":   "请输入电脑上显示的配对码",
+		"WordCodeWrong":    "配对码错误",
+		"WordCodeDisabled": "通过外网分享时配对码不可用，请扫描二维码",
+		"FilePassTitle":    "需要密码",
+		"FilePassPrompt":   "请输入该文件的下载密码",
+		"FilePassWrong":    "密码错误，请重试",
+		"DownloadCount":    "已下载 %d 次",
+		"DownloadsOf":      "已下载 %d/%d 次",
+	},
+	langEn: {
+		"HTMLLang":         "en",
+		"UploadTitle":      "File Upload (with Progress)",
+		"UploadHeading":    "Upload Files",
+		"SelectFiles":      "Select Files",
+		"StartUpload":      "Start Upload",
+		"DropHint":         "or drop files here, or paste a screenshot",
+		"OfflineTitle":     "Can't reach the computer",
+		"OfflineHint":      "pair-gui is not running on the computer, or the phone is on a different network. Start the service on the computer and try again; this page returns automatically once it is back.",
+		"OfflineRetry":     "Retry",
+		"OfflineLast":      "Last visited: ",
+		"PushEnable":       "Enable notifications",
+		"PushEnabled":      "Notifications on",
+		"PushFailed":       "Could not enable notifications: ",
+		"PushNewFiles":     "New files shared from the computer",
+		"PushUploadDone":   "Upload finished",
+		"GoDownload":       "Go to Download Page",
+		"UploadDone":       "Upload complete",
+		"UploadMerging":    "Merging…",
+		"UploadFailed":     "Upload failed",
+		"NetworkError":     "Upload failed (network error)",
+		"UploadRetrying":   "Connection lost, retrying…",
+		"FileExists":       "Upload failed (a file with this name already exists)",
+		"UploadCanceled":   "The upload was canceled on the computer",
+		"UploadDenied":     "The computer declined this file",
+		"FileTooLarge":     "File exceeds the size limit (max %s)",
+		"DiskFull":         "Not enough disk space on the computer (%s free)",
+		"DownloadTitle":    "Download List",
+		"ColName":          "File Name",
+		"ColSize":          "Size (KB)",
+		"ColModified":      "Modified",
+		"ColOp":            "Action",
+		"NoFiles":          "No files available for download",
+		"Download":         "Download",
+		"Preview":          "Preview",
+		"FileQR":           "Scan to download this file (click to enlarge)",
+		"Checksums":        "Download Checksums (SHA256SUMS)",
+		"DownloadAll":      "Download All (ZIP)",
+		"DownloadSel":      "Download Selected",
+		"GoUpload":         "Go to Upload Page",
+		"GoBrowse":         "Browse Shared Folders",
+		"GoDownloadList":   "Back to Download List",
+		"BrowseTitle":      "Shared Folders",
+		"GalleryTitle":     "Gallery",
+		"TextTitle":        "Text Transfer",
+		"TextHint":         "Type text to send to the computer, e.g. a link or a code",
+		"SendText":         "Send Text",
+		"GoText":           "Send Text",
+		"DeviceName":       "This device's name:",
+		"Save":             "Save",
+		"Saved":            "Saved",
+		"SaveFailed":       "Save failed",
+		"FromPhone":        "Phone",
+		"FromComputer":     "Computer",
+		"Copy":             "Copy",
+		"Copied":           "Copied",
+		"SendFailed":       "Failed to send",
+		"ClipSync":         "Clipboard Sync",
+		"ClipSyncHint":     "Text copied on the computer shows up here; on HTTPS pages the phone clipboard is synced back automatically",
+		"ClipPaste":        "Sync to Computer",
+		"GoGallery":        "View Photos as Gallery",
+		"NoImages":         "No images available",
+		"BrowseRoot":       "All",
+		"EmptyDir":         "This folder is empty",
+		"PinTitle":         "PIN Required",
+		"PinPrompt":        "Enter the PIN shown on the computer",
+		"PinSubmit":        "OK",
+		"PinWrong":         "Wrong PIN, please try again",
+		"PinLocked":        "Too many attempts, please try again later",
+		"WordCodeTitle":    "Enter Pairing Code",
+		"WordCodePrompt":   "Enter the pairing code shown on the computer",
+		"WordCodeWrong":    "Wrong pairing code",
+		"WordCodeDisabled": "The pairing code is off while sharing over the Internet. Scan the QR code instead.",
+		"FilePassTitle":    "Password Required",
+		"FilePassPrompt":   "Enter the password for this file",
+		"FilePassWrong":    "Wrong password, please try again",
+		"DownloadCount":    "%d downloads",
+		"DownloadsOf":      "%d/%d downloads",
+	},
+}
+
+// negotiateLanguage 根据Accept-Language请求头选择网页语言，无匹配时使用英文
+func negotiateLanguage(r *http.Request) string {
+	type langQ struct {
+		tag string
+		q   float64
+	}
+
+	var prefs []langQ
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if v, ok := strings.CutPrefix(param, "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		prefs = append(prefs, langQ{tag: tag, q: q})
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+
+	for _, p := range prefs {
+		if p.q <= 0 {
+			continue
+		}
+		base, _, _ := strings.Cut(p.tag, "-")
+		if _, ok := webMessages[base]; ok {
+			return base
+		}
+	}
+	return langEn
+}
+
+// webStrings 返回请求对应语言的网页字符串表
+func webStrings(r *http.Request) map[string]string {
+	return webMessages[negotiateLanguage(r)]
+}
@@ -0,0 +1,158 @@
+package pairserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client 访问过服务的客户端
+type Client struct {
+	IP         string           // 客户端IP
+	LastSeen   time.Time        // 最近访问时间
+	Blocked    bool             // 是否已被屏蔽
+	Name       string           // 设备名称，未设置时为空
+	Device     string           // 根据浏览器判断的设备类型，如iPhone、Android
+	UserAgent  string           // 最近一次请求的User-Agent
+	Uploaded   int64            // 上传到本机的字节数
+	Downloaded int64            // 从本机下载的字节数
+	History    []ClientTransfer // 最近的传输记录，按时间先后排列
+}
+
+// ipFilter 客户端IP访问控制
+type ipFilter struct {
+	mu     sync.RWMutex
+	allow  []*net.IPNet         // 允许列表，为空表示允许所有未被屏蔽的地址
+	block  []*net.IPNet         // 屏蔽列表
+	recent map[string]time.Time // 最近访问的客户端
+}
+
+// ParseIPRules 解析IP或网段规则（如 192.168.1.10、192.168.1.0/24），忽略空行
+func ParseIPRules(rules []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		if !strings.Contains(rule, "/") {
+			ip := net.ParseIP(rule)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的IP地址: %s", rule)
+			}
+			bits := 128
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(rule)
+		if err != nil {
+			return nil, fmt.Errorf("无效的网段: %s", rule)
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+// SetAllowlist 设置允许访问的IP或网段，为空表示不限制
+func (s *Server) SetAllowlist(rules []string) error {
+	nets, err := ParseIPRules(rules)
+	if err != nil {
+		return err
+	}
+
+	s.ipFilter.mu.Lock()
+	defer s.ipFilter.mu.Unlock()
+	s.ipFilter.allow = nets
+	return nil
+}
+
+// SetBlocklist 设置禁止访问的IP或网段
+func (s *Server) SetBlocklist(rules []string) error {
+	nets, err := ParseIPRules(rules)
+	if err != nil {
+		return err
+	}
+
+	s.ipFilter.mu.Lock()
+	defer s.ipFilter.mu.Unlock()
+	s.ipFilter.block = nets
+	return nil
+}
+
+// RecentClients 返回访问过服务的客户端及其名称和传输记录，按最近访问时间倒序
+func (s *Server) RecentClients() []Client {
+	s.ipFilter.mu.RLock()
+	clients := make([]Client, 0, len(s.ipFilter.recent))
+	for ip, seen := range s.ipFilter.recent {
+		clients = append(clients, Client{IP: ip, LastSeen: seen, Blocked: s.ipFilter.blockedLocked(ip)})
+	}
+	s.ipFilter.mu.RUnlock()
+
+	for i := range clients {
+		s.clients.fill(&clients[i])
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].LastSeen.After(clients[j].LastSeen) })
+	return clients
+}
+
+// allowed 记录客户端访问并判断其是否允许访问
+func (f *ipFilter) allowed(ip string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.recent == nil {
+		f.recent = make(map[string]time.Time)
+	}
+	f.recent[ip] = time.Now()
+
+	if f.blockedLocked(ip) {
+		return false
+	}
+	return len(f.allow) == 0 || containsIP(f.allow, net.ParseIP(ip))
+}
+
+// blockedLocked 判断IP是否在屏蔽列表中，调用方需持有锁
+func (f *ipFilter) blockedLocked(ip string) bool {
+	return containsIP(f.block, net.ParseIP(ip))
+}
+
+// containsIP 判断IP是否属于任一网段
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// requireIP IP访问控制中间件，被屏蔽或不在允许列表中的客户端返回403
+func (s *Server) requireIP(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.ipFilter.allowed(clientIP(r)) {
+			http.Error(w, "禁止访问", http.StatusForbidden)
+			return
+		}
+		if s.clients.seen(r) {
+			client := Client{IP: clientIP(r)}
+			s.clients.fill(&client)
+			s.publish(EventClientConnected, map[string]string{
+				"client_ip":   client.IP,
+				"client_name": client.Name,
+				"device":      client.Device,
+				"user_agent":  client.UserAgent,
+			})
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,93 @@
+package pairserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// SetMaxUploadSize 设置单次上传的最大字节数，<=0表示不限制
+func (s *Server) SetMaxUploadSize(size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxUploadSize = max(size, 0)
+}
+
+// MaxUploadSize 返回单次上传的最大字节数，0表示不限制
+func (s *Server) MaxUploadSize() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.maxUploadSize
+}
+
+// tooLarge 判断错误是否由请求体超过http.MaxBytesReader的限制引起
+func tooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+// uploadError 上传被拒绝时返回给网页的JSON，Error为按请求语言翻译的说明
+type uploadError struct {
+	Error   string `json:"error"`
+	MaxSize int64  `json:"maxSize,omitempty"` // 允许的最大字节数
+}
+
+// writeUploadError 以JSON返回上传被拒绝的原因，便于手机端直接显示
+func writeUploadError(w http.ResponseWriter, status int, e uploadError) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(e)
+}
+
+// writeTooLarge 返回413及超出大小限制的说明
+func writeTooLarge(w http.ResponseWriter, r *http.Request, limit int64) {
+	writeUploadError(w, http.StatusRequestEntityTooLarge, uploadError{
+		Error:   fmt.Sprintf(webStrings(r)["FileTooLarge"], formatSize(limit)),
+		MaxSize: limit,
+	})
+}
+
+// ensureSpace 判断dir所在磁盘能否容纳size字节，空间不足时返回507及剩余空间说明，
+// 避免写到一半失败留下不完整的文件；无法查询可用空间时不做限制
+func ensureSpace(w http.ResponseWriter, r *http.Request, dir string, size int64) bool {
+	free, ok := hasSpace(dir, size)
+	if ok {
+		return true
+	}
+	writeUploadError(w, http.StatusInsufficientStorage, uploadError{
+		Error: fmt.Sprintf(webStrings(r)["DiskFull"], formatSize(int64(free))),
+	})
+	return false
+}
+
+// hasSpace 判断dir所在磁盘能否容纳size字节，同时返回剩余空间；size未知或无法查询可用空间时不做限制
+func hasSpace(dir string, size int64) (free uint64, ok bool) {
+	if size <= 0 {
+		return 0, true
+	}
+	free, err := freeSpace(dir)
+	if err != nil {
+		log.Printf("查询磁盘可用空间失败: %v", err)
+		return 0, true
+	}
+	return free, uint64(size) <= free
+}
+
+// formatSize 将字节数格式化为便于阅读的大小，如 1.5 GB
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	size, exp := float64(bytes)/unit, 0
+	for size >= unit && exp < 3 {
+		size /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", size, "KMGT"[exp])
+}
@@ -0,0 +1,330 @@
+package pairserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// LocalSend协议（v2）参数，参见 https://github.com/localsend/protocol
+const (
+	localSendAPI     = "/api/localsend/v2/"
+	localSendVersion = "2.1"
+	localSendModel   = "pair-gui" // 本程序使用的设备型号，收到相同型号的LocalSend广播时忽略，已通过自有协议发现
+)
+
+// localSendGroup LocalSend的组播地址
+var localSendGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 167), Port: 53317}
+
+// localSendInfo LocalSend协议中的设备信息，用于组播公告、注册和发送请求
+type localSendInfo struct {
+	Alias       string `json:"alias"`
+	Version     string `json:"version"`
+	DeviceModel string `json:"deviceModel,omitempty"`
+	DeviceType  string `json:"deviceType,omitempty"`
+	Fingerprint string `json:"fingerprint"`
+	Port        int    `json:"port,omitempty"`
+	Protocol    string `json:"protocol,omitempty"`
+	Download    bool   `json:"download"`
+	Announce    bool   `json:"announce,omitempty"`
+}
+
+// localSendFile LocalSend发送请求中的一个文件
+type localSendFile struct {
+	ID       string `json:"id"`
+	FileName string `json:"fileName"`
+	Size     int64  `json:"size"`
+	FileType string `json:"fileType"`
+}
+
+// localSendPrepare LocalSend的发送请求
+type localSendPrepare struct {
+	Info  localSendInfo            `json:"info"`
+	Files map[string]localSendFile `json:"files"`
+}
+
+// localSendSession LocalSend发送请求的响应：会话ID及每个文件的上传令牌
+type localSendSession struct {
+	SessionID string            `json:"sessionId"`
+	Files     map[string]string `json:"files"`
+}
+
+// localSendInfo 返回本机的LocalSend设备信息，设备名称和标识与局域网发现一致
+func (s *Server) localSendInfo(announce bool) localSendInfo {
+	s.mu.RLock()
+	d := s.discovery
+	info := localSendInfo{
+		Version:     localSendVersion,
+		DeviceModel: localSendModel,
+		DeviceType:  "desktop",
+		Port:        s.port,
+		Protocol:    "http",
+		Announce:    announce,
+	}
+	if s.tlsCert != nil {
+		info.Protocol = "https"
+	}
+	s.mu.RUnlock()
+
+	if d != nil {
+		info.Alias, info.Fingerprint = d.name, d.id
+	} else {
+		info.Alias, _ = os.Hostname()
+	}
+	return info
+}
+
+// sendLocalSend 在每个网卡上组播LocalSend公告
+func (d *discovery) sendLocalSend(info localSendInfo) {
+	if d.lsPC == nil {
+		return
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return
+	}
+	for _, iface := range multicastInterfaces() {
+		d.lsPC.WriteTo(data, &ipv4.ControlMessage{IfIndex: iface.Index}, localSendGroup)
+	}
+}
+
+// listenLocalSend 接收LocalSend应用的组播公告，收到需要回应的公告时向其注册本机
+func (d *discovery) listenLocalSend(s *Server) {
+	defer d.wg.Done()
+
+	buf := make([]byte, 4096)
+	for {
+		n, src, err := d.lsConn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-d.done:
+			default:
+				log.Printf("接收LocalSend广播失败: %v", err)
+			}
+			return
+		}
+		var info localSendInfo
+		if json.Unmarshal(buf[:n], &info) != nil || info.Fingerprint == "" || info.DeviceModel == localSendModel {
+			continue
+		}
+		ip := src.IP.String()
+		d.addLocalSend(info, ip)
+		if info.Announce {
+			go d.registerLocalSend(s, info, ip)
+		}
+	}
+}
+
+// addLocalSend 将LocalSend设备加入设备列表
+func (d *discovery) addLocalSend(info localSendInfo, ip string) {
+	port := info.Port
+	if port == 0 {
+		port = localSendGroup.Port
+	}
+	d.add(Peer{
+		ID:        "localsend:" + info.Fingerprint,
+		Name:      info.Alias,
+		IP:        ip,
+		Port:      port,
+		HTTPS:     info.Protocol != "http",
+		Sharing:   true,
+		LocalSend: true,
+		LastSeen:  time.Now(),
+	})
+}
+
+// registerLocalSend 回应LocalSend公告：通过HTTP向对方注册本机，失败时改为组播回应
+func (d *discovery) registerLocalSend(s *Server, info localSendInfo, ip string) {
+	self := s.localSendInfo(false)
+	peer := Peer{Name: info.Alias, IP: ip, Port: info.Port, HTTPS: info.Protocol != "http", Sharing: true, LocalSend: true}
+	if peer.Port == 0 {
+		peer.Port = localSendGroup.Port
+	}
+
+	body, err := json.Marshal(self)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	resp, err := doPush(ctx, insecureClient(), http.MethodPost, peer.URL()+"register", bytes.NewReader(body), int64(len(body)))
+	if err == nil {
+		resp.Body.Close()
+		return
+	}
+	d.sendLocalSend(self)
+}
+
+// localSendInfoHandler 返回本机的LocalSend设备信息
+func (s *Server) localSendInfoHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.localSendInfo(false))
+}
+
+// localSendRegisterHandler LocalSend应用回应本机公告时注册自身，返回本机信息
+func (s *Server) localSendRegisterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+	var info localSendInfo
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushRequestSize)).Decode(&info); err != nil {
+		http.Error(w, fmt.Sprintf("解析请求失败: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.RLock()
+	d := s.discovery
+	s.mu.RUnlock()
+	if d != nil && info.Fingerprint != "" && info.DeviceModel != localSendModel {
+		d.addLocalSend(info, clientIP(r))
+	}
+	s.localSendInfoHandler(w, r)
+}
+
+// localSendPrepareHandler 接收LocalSend应用的发送请求，与直接发送使用相同的确认流程
+func (s *Server) localSendPrepareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+	s.push.mu.Lock()
+	handler := s.push.handler
+	s.push.mu.Unlock()
+	if handler == nil {
+		http.Error(w, ErrPushDeclined.Error(), http.StatusForbidden)
+		return
+	}
+
+	var prepare localSendPrepare
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushRequestSize)).Decode(&prepare); err != nil {
+		http.Error(w, fmt.Sprintf("解析请求失败: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(prepare.Files) == 0 {
+		http.Error(w, "没有要发送的文件", http.StatusBadRequest)
+		return
+	}
+
+	req := PushRequest{From: prepare.Info.Alias, IP: clientIP(r)}
+	items := make(map[string]pushItem, len(prepare.Files))
+	tokens := make(map[string]string, len(prepare.Files))
+	for id, f := range prepare.Files {
+		if f.Size < 0 {
+			http.Error(w, fmt.Sprintf("无效的文件: %s", f.FileName), http.StatusBadRequest)
+			return
+		}
+		name := sanitizeFilename(f.FileName)
+		token := newSessionID()
+		items[id] = pushItem{Name: name, Size: f.Size, Token: token}
+		tokens[id] = token
+		req.Files = append(req.Files, PushFile{Name: name, Size: f.Size})
+	}
+
+	total := req.TotalSize()
+	if limit := s.MaxUploadSize(); limit > 0 && total > limit {
+		writeTooLarge(w, r, limit)
+		return
+	}
+	if !ensureSpace(w, r, s.UploadDir(), total) {
+		return
+	}
+
+	id, ok := s.acceptPush(r, handler, req, items)
+	if !ok {
+		http.Error(w, ErrPushDeclined.Error(), http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(localSendSession{SessionID: id, Files: tokens})
+}
+
+// localSendUploadHandler 接收LocalSend发送请求中的一个文件
+func (s *Server) localSendUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	item, ok := s.takePushFile(query.Get("sessionId"), query.Get("fileId"), query.Get("token"))
+	if !ok {
+		http.Error(w, "发送请求未确认或已过期", http.StatusForbidden)
+		return
+	}
+	if s.savePushFile(w, r, item) {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// localSendCancelHandler LocalSend应用取消发送
+func (s *Server) localSendCancelHandler(w http.ResponseWriter, r *http.Request) {
+	s.cancelPush(r.URL.Query().Get("sessionId"))
+	w.WriteHeader(http.StatusOK)
+}
+
+// prepareLocalSend 向LocalSend应用发送请求并等待确认，返回每个文件的上传地址；
+// 对方未要求的文件地址为空
+func prepareLocalSend(ctx context.Context, client *http.Client, base string, req PushRequest) ([]string, error) {
+	prepare := localSendPrepare{
+		Info: localSendInfo{
+			Alias:       req.From,
+			Version:     localSendVersion,
+			DeviceModel: localSendModel,
+			DeviceType:  "desktop",
+			Fingerprint: newSessionID(),
+			Port:        localSendGroup.Port,
+			Protocol:    "http",
+		},
+		Files: make(map[string]localSendFile, len(req.Files)),
+	}
+	for i, f := range req.Files {
+		fileType := mime.TypeByExtension(filepath.Ext(f.Name))
+		if fileType == "" {
+			fileType = "application/octet-stream"
+		}
+		id := strconv.Itoa(i)
+		prepare.Files[id] = localSendFile{ID: id, FileName: f.Name, Size: f.Size, FileType: fileType}
+	}
+	body, err := json.Marshal(prepare)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := doPush(ctx, client, http.MethodPost, base+"prepare-upload", bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// 204表示对方无需接收任何文件
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+
+	var session localSendSession
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+	targets := make([]string, len(req.Files))
+	for i := range req.Files {
+		id := strconv.Itoa(i)
+		token, ok := session.Files[id]
+		if !ok {
+			continue
+		}
+		targets[i] = fmt.Sprintf("%supload?sessionId=%s&fileId=%s&token=%s", base,
+			url.QueryEscape(session.SessionID), id, url.QueryEscape(token))
+	}
+	return targets, nil
+}
@@ -0,0 +1,317 @@
+package pairserver
+
+import (
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+)
+
+// mDNS参数
+const (
+	DefaultMDNSName = "pair-gui" // 默认广播的主机名，对应 pair-gui.local
+	mdnsTTL         = 120        // 记录的缓存时间(秒)
+	mdnsService     = "_http._tcp.local."
+	mdnsServiceList = "_services._dns-sd._udp.local."
+	mdnsCacheFlush  = 1 << 15 // 唯一记录的cache-flush位，与记录类别组合使用
+)
+
+// mdnsGroup mDNS的IPv4组播地址
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// mdnsResponder 在局域网中响应 <name>.local 的A记录查询，并以 _http._tcp 服务广播文件传输服务；
+// 不进行名称冲突探测，局域网中有同名设备时应改用其他名称
+type mdnsResponder struct {
+	conn      *net.UDPConn
+	pc        *ipv4.PacketConn
+	host      string // 主机名，如 pair-gui.local.
+	instance  string // 服务实例名，如 pair-gui._http._tcp.local.
+	port      uint16
+	https     bool
+	done      chan struct{}  // 关闭时通知各协程退出
+	wg        sync.WaitGroup // 等待读取协程退出
+	announced sync.WaitGroup // 等待启动广播结束
+}
+
+// SetMDNSName 设置通过mDNS广播的主机名（不含.local），空表示不广播，下次启动服务时生效
+func (s *Server) SetMDNSName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mdnsName = strings.TrimSuffix(strings.TrimSuffix(name, "."), ".local")
+}
+
+// MDNSHost 返回正在广播的主机名，如 pair-gui.local；未广播时为空
+func (s *Server) MDNSHost() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.mdns == nil {
+		return ""
+	}
+	return strings.TrimSuffix(s.mdns.host, ".")
+}
+
+// startMDNS 按当前设置开始广播，失败时只记录日志，不影响HTTP服务
+func (s *Server) startMDNS() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.mdnsName == "" {
+		return
+	}
+	m, err := newMDNSResponder(s.mdnsName, s.port, s.tlsCert != nil)
+	if err != nil {
+		log.Printf("启动mDNS广播失败: %v", err)
+		return
+	}
+	s.mdns = m
+	log.Printf("mDNS广播: %s:%d", strings.TrimSuffix(m.host, "."), s.port)
+}
+
+// stopMDNS 停止广播，并通知局域网中的设备清除缓存的记录
+func (s *Server) stopMDNS() {
+	s.mu.Lock()
+	m := s.mdns
+	s.mdns = nil
+	s.mu.Unlock()
+
+	if m != nil {
+		m.close()
+	}
+}
+
+// newMDNSResponder 加入mDNS组播组并开始响应查询
+func newMDNSResponder(name string, port int, https bool) (*mdnsResponder, error) {
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &mdnsResponder{
+		conn:     conn,
+		pc:       ipv4.NewPacketConn(conn),
+		host:     name + ".local.",
+		instance: name + "." + mdnsService,
+		port:     uint16(port),
+		https:    https,
+		done:     make(chan struct{}),
+	}
+	// 在所有支持组播的网卡上加入组播组；默认网卡已加入，重复加入的错误可以忽略
+	for _, iface := range multicastInterfaces() {
+		m.pc.JoinGroup(&iface, mdnsGroup)
+	}
+	m.pc.SetMulticastTTL(255)
+	// 部分平台（如Windows）不支持获取接收网卡，此时回答全部网卡的地址
+	m.pc.SetControlMessage(ipv4.FlagInterface, true)
+
+	m.wg.Add(1)
+	go m.serve()
+	m.announced.Add(1)
+	go m.announce()
+	return m, nil
+}
+
+// close 发送TTL为0的告别记录后关闭连接
+func (m *mdnsResponder) close() {
+	close(m.done)
+	m.announced.Wait()
+	for _, iface := range multicastInterfaces() {
+		m.send(m.records(iface.Index, 0), &iface)
+	}
+	m.conn.Close()
+	m.wg.Wait()
+}
+
+// announce 启动时主动广播记录，间隔1秒发送两次，使已缓存旧地址的设备及时更新
+func (m *mdnsResponder) announce() {
+	defer m.announced.Done()
+
+	for i := 0; i < 2; i++ {
+		for _, iface := range multicastInterfaces() {
+			m.send(m.records(iface.Index, mdnsTTL), &iface)
+		}
+		select {
+		case <-m.done:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// serve 读取并响应查询，直到连接关闭
+func (m *mdnsResponder) serve() {
+	defer m.wg.Done()
+
+	buf := make([]byte, 9000)
+	for {
+		n, cm, src, err := m.pc.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-m.done:
+				return
+			default:
+			}
+			log.Printf("读取mDNS查询失败: %v", err)
+			return
+		}
+		ifIndex := 0
+		if cm != nil {
+			ifIndex = cm.IfIndex
+		}
+		m.handleQuery(buf[:n], ifIndex, src.(*net.UDPAddr))
+	}
+}
+
+// handleQuery 响应与本服务相关的查询；来自非5353端口的普通DNS查询以单播回复
+func (m *mdnsResponder) handleQuery(packet []byte, ifIndex int, src *net.UDPAddr) {
+	var p dnsmessage.Parser
+	header, err := p.Start(packet)
+	if err != nil || header.Response {
+		return
+	}
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return
+	}
+
+	var answers, extras []dnsmessage.Resource
+	for _, q := range questions {
+		name := q.Name.String()
+		want := func(t dnsmessage.Type) bool { return q.Type == t || q.Type == dnsmessage.TypeALL }
+		switch {
+		case strings.EqualFold(name, m.host) && want(dnsmessage.TypeA):
+			answers = append(answers, m.addrRecords(ifIndex, mdnsTTL)...)
+		case strings.EqualFold(name, mdnsService) && want(dnsmessage.TypePTR):
+			answers = append(answers, m.ptrRecord(mdnsTTL))
+			extras = append(extras, m.srvRecord(mdnsTTL), m.txtRecord(mdnsTTL))
+			extras = append(extras, m.addrRecords(ifIndex, mdnsTTL)...)
+		case strings.EqualFold(name, m.instance) && (want(dnsmessage.TypeSRV) || want(dnsmessage.TypeTXT)):
+			answers = append(answers, m.srvRecord(mdnsTTL), m.txtRecord(mdnsTTL))
+			extras = append(extras, m.addrRecords(ifIndex, mdnsTTL)...)
+		case strings.EqualFold(name, mdnsServiceList) && want(dnsmessage.TypePTR):
+			answers = append(answers, resource(mdnsServiceList, mdnsTTL, false,
+				&dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(mdnsService)}))
+		}
+	}
+	if len(answers) == 0 {
+		return
+	}
+
+	msg := dnsmessage.Message{
+		Header:      dnsmessage.Header{Response: true, Authoritative: true},
+		Answers:     answers,
+		Additionals: extras,
+	}
+	if src.Port != mdnsGroup.Port {
+		// 普通DNS客户端要求回复中带有原查询的ID和问题
+		msg.Header.ID = header.ID
+		msg.Questions = questions
+		m.write(&msg, ifIndex, src)
+		return
+	}
+	m.write(&msg, ifIndex, mdnsGroup)
+}
+
+// records 返回主动广播的全部记录
+func (m *mdnsResponder) records(ifIndex int, ttl uint32) *dnsmessage.Message {
+	answers := []dnsmessage.Resource{m.ptrRecord(ttl), m.srvRecord(ttl), m.txtRecord(ttl)}
+	answers = append(answers, m.addrRecords(ifIndex, ttl)...)
+	return &dnsmessage.Message{
+		Header:  dnsmessage.Header{Response: true, Authoritative: true},
+		Answers: answers,
+	}
+}
+
+// send 从指定网卡组播消息
+func (m *mdnsResponder) send(msg *dnsmessage.Message, iface *net.Interface) {
+	m.write(msg, iface.Index, mdnsGroup)
+}
+
+// write 编码并发送消息，ifIndex非0时从该网卡发出
+func (m *mdnsResponder) write(msg *dnsmessage.Message, ifIndex int, dst *net.UDPAddr) {
+	packet, err := msg.Pack()
+	if err != nil {
+		log.Printf("编码mDNS响应失败: %v", err)
+		return
+	}
+	var cm *ipv4.ControlMessage
+	if ifIndex != 0 {
+		cm = &ipv4.ControlMessage{IfIndex: ifIndex}
+	}
+	m.pc.WriteTo(packet, cm, dst)
+}
+
+// ptrRecord 服务类型到服务实例的记录
+func (m *mdnsResponder) ptrRecord(ttl uint32) dnsmessage.Resource {
+	return resource(mdnsService, ttl, false, &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(m.instance)})
+}
+
+// srvRecord 服务实例的主机名和端口
+func (m *mdnsResponder) srvRecord(ttl uint32) dnsmessage.Resource {
+	return resource(m.instance, ttl, true, &dnsmessage.SRVResource{Target: dnsmessage.MustNewName(m.host), Port: m.port})
+}
+
+// txtRecord 服务实例的附加信息：访问路径及是否使用HTTPS
+func (m *mdnsResponder) txtRecord(ttl uint32) dnsmessage.Resource {
+	txt := []string{"path=/"}
+	if m.https {
+		txt = append(txt, "scheme=https")
+	}
+	return resource(m.instance, ttl, true, &dnsmessage.TXTResource{TXT: txt})
+}
+
+// addrRecords 主机名的A记录：ifIndex对应网卡的IPv4地址，为0时为全部网卡的地址
+func (m *mdnsResponder) addrRecords(ifIndex int, ttl uint32) []dnsmessage.Resource {
+	var records []dnsmessage.Resource
+	for _, iface := range multicastInterfaces() {
+		if ifIndex != 0 && iface.Index != ifIndex {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ip4 := ipnet.IP.To4(); ip4 != nil && !ip4.IsLoopback() {
+				records = append(records, resource(m.host, ttl, true, &dnsmessage.AResource{A: [4]byte(ip4)}))
+			}
+		}
+	}
+	return records
+}
+
+// resource 创建IN类别的记录，unique为true时设置cache-flush位
+func resource(name string, ttl uint32, unique bool, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	class := dnsmessage.ClassINET
+	if unique {
+		class |= mdnsCacheFlush
+	}
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Class: class, TTL: ttl},
+		Body:   body,
+	}
+}
+
+// multicastInterfaces 返回已启用且支持组播的非回环网卡
+func multicastInterfaces() []net.Interface {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var result []net.Interface
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagMulticast != 0 && iface.Flags&net.FlagLoopback == 0 {
+			result = append(result, iface)
+		}
+	}
+	return result
+}
@@ -0,0 +1,237 @@
+package pairserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackpal/gateway"
+)
+
+// LocalIP 获取本机局域网IP：优先使用与默认IPv4网关处于同一网段的IPv4地址，
+// 没有时（如纯IPv6网络）使用IPv6地址，见localIPv6
+func LocalIP() (string, error) {
+	if ip, err := localIPv4(); err == nil {
+		return ip, nil
+	}
+	if ip := localIPv6(); ip != "" {
+		return ip, nil
+	}
+	return "", fmt.Errorf("未找到有效局域网IP")
+}
+
+// localIPv4 返回与默认网关处于同一网段的IPv4地址
+func localIPv4() (string, error) {
+	gwIP, err := gateway.DiscoverGateway()
+	if err != nil {
+		return "", err
+	}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.IsLoopback() {
+				continue
+			}
+
+			ipv4 := ipnet.IP.To4()
+			if ipv4 != nil && ipnet.Contains(gwIP) {
+				return ipv4.String(), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("未找到与网关同网段的IPv4地址")
+}
+
+// localIPv6 返回本机的IPv6地址，跳过VPN网卡；优先全局单播地址，其次唯一本地地址（fc00::/7），
+// 最后为带网卡区域的链路本地地址（如fe80::1%eth0）。没有时返回空
+func localIPv6() string {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+
+	best, bestRank := "", 3
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || isVPNInterface(iface) {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.To4() != nil || ipnet.IP.To16() == nil {
+				continue
+			}
+			ip, rank := ipnet.IP.String(), 3
+			switch {
+			case ipnet.IP.IsGlobalUnicast() && !ipnet.IP.IsPrivate():
+				rank = 0
+			case ipnet.IP.IsPrivate():
+				rank = 1
+			case ipnet.IP.IsLinkLocalUnicast():
+				rank, ip = 2, ip+"%"+iface.Name
+			}
+			if rank < bestRank {
+				best, bestRank = ip, rank
+			}
+		}
+	}
+	return best
+}
+
+// LocalAddr 本机网卡上的一个地址
+type LocalAddr struct {
+	Interface string // 网卡名称
+	IP        string
+	VPN       bool // 是否为VPN网卡
+}
+
+// LocalAddrs 返回本机所有可供其他设备访问的地址（不含回环和链路本地地址），IPv4地址在前；
+// 本机有多个网卡（Wi-Fi、有线、VPN）时可从中选择手机能访问的地址
+func LocalAddrs() []LocalAddr {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var v4, v6 []LocalAddr
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		vpn := isVPNInterface(iface)
+
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			if ipv4 := ipnet.IP.To4(); ipv4 != nil {
+				v4 = append(v4, LocalAddr{Interface: iface.Name, IP: ipv4.String(), VPN: vpn || isSharedAddress(ipv4)})
+			} else {
+				v6 = append(v6, LocalAddr{Interface: iface.Name, IP: ipnet.IP.String(), VPN: vpn})
+			}
+		}
+	}
+	return append(v4, v6...)
+}
+
+// HostPort 将主机和端口组合为URL中的地址部分：IPv6地址加方括号，链路本地地址的区域分隔符"%"编码为"%25"
+func HostPort(host string, port int) string {
+	if strings.Contains(host, ":") {
+		host = strings.ReplaceAll(host, "%", "%25")
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// vpnInterfacePrefixes 常见VPN网卡名称前缀（小写）：Tailscale、WireGuard、ZeroTier及macOS/BSD的隧道网卡
+var vpnInterfacePrefixes = []string{"tailscale", "wg", "wireguard", "zt", "utun", "tun"}
+
+// VPNAddr 本机在VPN（Tailscale、WireGuard等）中的地址，可供不在同一局域网的自有设备访问
+type VPNAddr struct {
+	Interface string // 网卡名称
+	IP        string // 网卡的IPv4地址
+	Tailscale bool   // 是否为Tailscale网络
+}
+
+// VPNAddrs 返回本机VPN网卡的IPv4地址：网卡名称为常见VPN前缀、点对点网卡，
+// 或地址位于Tailscale使用的100.64.0.0/10网段
+func VPNAddrs() []VPNAddr {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var result []VPNAddr
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		name := strings.ToLower(iface.Name)
+		named := isVPNInterface(iface)
+
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+			shared := isSharedAddress(ipnet.IP)
+			if !named && !shared {
+				continue
+			}
+			result = append(result, VPNAddr{
+				Interface: iface.Name,
+				IP:        ipnet.IP.To4().String(),
+				Tailscale: shared || strings.HasPrefix(name, "tailscale"),
+			})
+		}
+	}
+	return result
+}
+
+// isVPNInterface 判断网卡是否为VPN网卡：名称为常见VPN前缀，或为点对点网卡
+func isVPNInterface(iface net.Interface) bool {
+	if iface.Flags&net.FlagPointToPoint != 0 {
+		return true
+	}
+	name := strings.ToLower(iface.Name)
+	for _, prefix := range vpnInterfacePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// TailscaleName 通过tailscale命令获取本机的MagicDNS名称（如host.tailnet.ts.net），
+// 未安装Tailscale或未启用MagicDNS时返回空
+func TailscaleName() string {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "tailscale", "status", "--json").Output()
+	if err != nil {
+		return ""
+	}
+	var status struct {
+		Self struct {
+			DNSName string
+		}
+	}
+	if json.Unmarshal(out, &status) != nil {
+		return ""
+	}
+	return strings.TrimSuffix(status.Self.DNSName, ".")
+}
@@ -0,0 +1,85 @@
+package pairserver
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// oneShotStopTimeout 一次性分享结束后等待其他传输完成的最长时间
+const oneShotStopTimeout = 30 * time.Second
+
+// OneShotHandler 一次性分享的文件都已下载、服务已停止时调用，在后台协程中执行
+type OneShotHandler func()
+
+// oneShotState 一次性分享状态
+type oneShotState struct {
+	mu       sync.Mutex
+	enabled  bool
+	served   map[string]bool // 本次服务运行期间已完整下载过的文件路径
+	finished bool            // 本次服务的一次性分享已结束，正在停止服务
+	handler  OneShotHandler
+}
+
+// SetOneShot 设置是否为一次性分享：下载列表中的每个文件都被完整下载过至少一次后自动停止服务。
+// 只统计下载列表中的文件，共享目录中的文件不计入
+func (s *Server) SetOneShot(enabled bool) {
+	s.oneShot.mu.Lock()
+	defer s.oneShot.mu.Unlock()
+
+	s.oneShot.enabled = enabled
+}
+
+// SetOneShotHandler 设置一次性分享结束后的回调
+func (s *Server) SetOneShotHandler(h OneShotHandler) {
+	s.oneShot.mu.Lock()
+	defer s.oneShot.mu.Unlock()
+
+	s.oneShot.handler = h
+}
+
+// resetServed 清除已下载的记录，启动服务时调用
+func (s *Server) resetServed() {
+	s.oneShot.mu.Lock()
+	defer s.oneShot.mu.Unlock()
+
+	s.oneShot.served = nil
+	s.oneShot.finished = false
+}
+
+// markServed 记录完整下载过的文件；一次性分享的文件都已下载时停止服务并调用回调
+func (s *Server) markServed(paths ...string) {
+	files := s.Files()
+
+	s.oneShot.mu.Lock()
+	if s.oneShot.served == nil {
+		s.oneShot.served = make(map[string]bool)
+	}
+	for _, p := range paths {
+		s.oneShot.served[p] = true
+	}
+	// 服务停止前可能还有下载完成，只结束一次
+	done := s.oneShot.enabled && !s.oneShot.finished && len(files) > 0
+	for _, f := range files {
+		done = done && s.oneShot.served[f.AbsPath]
+	}
+	s.oneShot.finished = s.oneShot.finished || done
+	handler := s.oneShot.handler
+	s.oneShot.mu.Unlock()
+	if !done {
+		return
+	}
+
+	// 当前请求还在处理中，在后台等待其结束后停止服务
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), oneShotStopTimeout)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil && err != ErrNotRunning {
+			log.Printf("一次性分享结束后停止服务失败: %v", err)
+		}
+		if handler != nil {
+			handler()
+		}
+	}()
+}
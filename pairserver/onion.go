@@ -0,0 +1,270 @@
+package pairserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// torControlTimeout 连接Tor控制端口并创建洋葱服务的最长时间
+const torControlTimeout = 10 * time.Second
+
+// DefaultTorControlAddrs 未指定控制端口时依次尝试的地址：Tor服务和Tor Browser
+var DefaultTorControlAddrs = []string{"127.0.0.1:9051", "127.0.0.1:9151"}
+
+// ErrTorUnavailable 本机没有可连接的Tor控制端口
+var ErrTorUnavailable = errors.New("无法连接Tor控制端口，请确认已运行Tor（ControlPort 9051）或Tor Browser")
+
+// onionClientIP 通过洋葱服务访问的客户端在clientIP中返回的地址。Tor的访问者都来自127.0.0.1，
+// 按IP信任、锁定和过滤会把全部访问者当作本机客户端；改用此地址后不会被信任自动接收上传，
+// 输错次数与本机客户端分开统计，允许列表不为空时不匹配任何规则
+const onionClientIP = "onion"
+
+// onionService 通过Tor控制端口创建的临时洋葱服务；未设置Detach，控制连接关闭时Tor自动删除
+type onionService struct {
+	ctrl *torControl
+	ln   net.Listener // 只接收Tor转发连接的本机监听，与局域网访问的端口分开
+	host string       // 洋葱地址，如xxx.onion
+	port int          // 洋葱服务的虚拟端口，与本机服务端口相同
+}
+
+// onionConn 通过洋葱服务监听接收的连接
+type onionConn struct {
+	net.Conn
+}
+
+// onionListener 将接收的连接标记为onionConn
+type onionListener struct {
+	net.Listener
+}
+
+// Accept 实现net.Listener接口
+func (l onionListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return onionConn{c}, nil
+}
+
+// onionKey 请求上下文中标记来自洋葱服务的连接
+type onionKey struct{}
+
+// onionConnContext 供http.Server.ConnContext使用，标记来自洋葱服务监听的连接
+func onionConnContext(ctx context.Context, c net.Conn) context.Context {
+	if _, ok := c.(onionConn); ok {
+		return context.WithValue(ctx, onionKey{}, true)
+	}
+	return ctx
+}
+
+// viaOnion 返回请求是否通过洋葱服务到达
+func viaOnion(r *http.Request) bool {
+	v, _ := r.Context().Value(onionKey{}).(bool)
+	return v
+}
+
+// StartOnion 连接本机Tor的控制端口，将服务发布为临时.onion地址并返回该地址，无需端口映射即可从外网访问；
+// 私钥不保存，每次启动地址都不同，停止服务时失效。controlAddr为空时依次尝试DefaultTorControlAddrs。
+// 服务未运行时返回ErrNotRunning
+func (s *Server) StartOnion(ctx context.Context, controlAddr string) (string, error) {
+	s.mu.RLock()
+	server, port := s.httpServer, s.port
+	s.mu.RUnlock()
+	if server == nil {
+		return "", ErrNotRunning
+	}
+	s.stopOnion()
+
+	ctx, cancel := context.WithTimeout(ctx, torControlTimeout)
+	defer cancel()
+
+	addrs := DefaultTorControlAddrs
+	if controlAddr != "" {
+		addrs = []string{controlAddr}
+	}
+	var ctrl *torControl
+	var dialer net.Dialer
+	for _, addr := range addrs {
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			log.Printf("连接Tor控制端口 %s 失败: %v", addr, err)
+			continue
+		}
+		ctrl = &torControl{conn: conn, r: bufio.NewReader(conn)}
+		break
+	}
+	if ctrl == nil {
+		return "", ErrTorUnavailable
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		ctrl.conn.SetDeadline(deadline)
+	}
+
+	// Tor转发到单独的本机端口，处理请求时据此区分洋葱服务的访问者和本机的客户端
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		ctrl.conn.Close()
+		return "", err
+	}
+	host, err := ctrl.addOnion(port, ln.Addr().(*net.TCPAddr).Port)
+	if err != nil {
+		ctrl.conn.Close()
+		ln.Close()
+		return "", err
+	}
+	ctrl.conn.SetDeadline(time.Time{})
+
+	s.mu.Lock()
+	s.onion = &onionService{ctrl: ctrl, ln: ln, host: host, port: port}
+	s.mu.Unlock()
+	go func() {
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ServeTLS(onionListener{ln}, "", "")
+		} else {
+			err = server.Serve(onionListener{ln})
+		}
+		if err != nil && err != http.ErrServerClosed && !errors.Is(err, net.ErrClosed) {
+			log.Printf("洋葱服务运行失败: %v", err)
+		}
+	}()
+	log.Printf("洋葱服务已创建: %s", host)
+	return host, nil
+}
+
+// OnionURL 返回通过Tor访问的URL，未创建洋葱服务时为空。
+// 新地址发布到Tor网络需要几十秒，之前访问会失败
+func (s *Server) OnionURL() string {
+	s.mu.RLock()
+	o := s.onion
+	s.mu.RUnlock()
+
+	if o == nil {
+		return ""
+	}
+	return s.urlFor(o.host, o.port)
+}
+
+// stopOnion 关闭控制连接，Tor随之删除洋葱服务
+func (s *Server) stopOnion() {
+	s.mu.Lock()
+	o := s.onion
+	s.onion = nil
+	s.mu.Unlock()
+
+	if o != nil {
+		o.ctrl.conn.Close()
+		o.ln.Close()
+	}
+}
+
+// torControl Tor控制协议连接，参见 https://spec.torproject.org/control-spec/
+type torControl struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// command 发送一条命令，返回去掉状态码的各行回复；状态码不为250时返回错误
+func (c *torControl) command(cmd string) ([]string, error) {
+	if _, err := fmt.Fprintf(c.conn, "%s\r\n", cmd); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) < 4 {
+			return nil, fmt.Errorf("Tor: 无效的回复 %q", line)
+		}
+		code, sep, text := line[:3], line[3], line[4:]
+		if code != "250" {
+			return nil, fmt.Errorf("Tor: %s %s", code, text)
+		}
+		lines = append(lines, text)
+		switch sep {
+		case ' ':
+			return lines, nil
+		case '+':
+			// 多行数据以单独的"."结束
+			for {
+				data, err := c.r.ReadString('\n')
+				if err != nil {
+					return nil, err
+				}
+				if strings.TrimRight(data, "\r\n") == "." {
+					break
+				}
+			}
+		}
+	}
+}
+
+// authenticate 按Tor支持的方式认证：无需认证或读取cookie文件
+func (c *torControl) authenticate() error {
+	lines, err := c.command("PROTOCOLINFO 1")
+	if err != nil {
+		return err
+	}
+	var methods []string
+	var cookieFile string
+	for _, line := range lines {
+		rest, ok := strings.CutPrefix(line, "AUTH METHODS=")
+		if !ok {
+			continue
+		}
+		list, file, _ := strings.Cut(rest, " COOKIEFILE=")
+		methods = strings.Split(list, ",")
+		if file != "" {
+			cookieFile, _ = strconv.Unquote(file)
+		}
+	}
+
+	for _, m := range methods {
+		if m == "NULL" {
+			_, err := c.command("AUTHENTICATE")
+			return err
+		}
+	}
+	for _, m := range methods {
+		if m == "COOKIE" && cookieFile != "" {
+			cookie, err := os.ReadFile(cookieFile)
+			if err != nil {
+				return fmt.Errorf("读取Tor认证cookie失败（需有读取权限）: %v", err)
+			}
+			_, err = c.command("AUTHENTICATE " + hex.EncodeToString(cookie))
+			return err
+		}
+	}
+	return fmt.Errorf("不支持Tor控制端口的认证方式: %s，请启用CookieAuthentication", strings.Join(methods, ","))
+}
+
+// addOnion 认证后创建临时洋葱服务，虚拟端口port转发到本机端口target，返回洋葱地址
+func (c *torControl) addOnion(port, target int) (string, error) {
+	if err := c.authenticate(); err != nil {
+		return "", err
+	}
+	lines, err := c.command(fmt.Sprintf("ADD_ONION NEW:ED25519-V3 Flags=DiscardPK Port=%d,127.0.0.1:%d", port, target))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range lines {
+		if id, ok := strings.CutPrefix(line, "ServiceID="); ok {
+			return id + ".onion", nil
+		}
+	}
+	return "", fmt.Errorf("Tor未返回洋葱地址")
+}
@@ -0,0 +1,56 @@
+package pairserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestOnionClientIP 通过洋葱服务监听到达的请求不按127.0.0.1处理：不匹配允许列表，也不沿用本机客户端的信任
+func TestOnionClientIP(t *testing.T) {
+	s, h := newRegistryServer(t, 1)
+	if err := s.SetAllowlist([]string{"127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	local := httptest.NewServer(h)
+	defer local.Close()
+	onion := httptest.NewUnstartedServer(h)
+	onion.Listener = onionListener{onion.Listener}
+	onion.Config.ConnContext = onionConnContext
+	onion.Start()
+	defer onion.Close()
+
+	for _, c := range []struct {
+		url  string
+		want int
+	}{{local.URL, http.StatusOK}, {onion.URL, http.StatusForbidden}} {
+		resp, err := http.Get(c.url + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.want {
+			t.Errorf("%s 返回 %d，应为 %d", c.url, resp.StatusCode, c.want)
+		}
+	}
+
+	// 信任本机客户端后，洋葱服务的访问者仍需确认，选择信任也不会记住
+	asked := 0
+	s.SetUploadApproval(true)
+	s.SetUploadApprover(func(UploadRequest) (bool, bool) {
+		asked++
+		return true, true
+	})
+	ctx := context.Background()
+	s.askUpload(ctx, UploadRequest{Filename: "a", IP: "127.0.0.1"})
+	s.askUpload(ctx, UploadRequest{Filename: "b", IP: "127.0.0.1"})
+	if asked != 1 {
+		t.Fatalf("信任后本机客户端被询问 %d 次，应为1", asked)
+	}
+	s.askUpload(ctx, UploadRequest{Filename: "c", IP: onionClientIP})
+	s.askUpload(ctx, UploadRequest{Filename: "d", IP: onionClientIP})
+	if asked != 3 {
+		t.Errorf("洋葱服务的访问者被询问 %d 次，应为2", asked-1)
+	}
+}
@@ -0,0 +1,125 @@
+package pairserver
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PluginPrefix 插件路由的路径前缀，插件的路由位于 /plugins/<名称>/ 之下
+const PluginPrefix = "/plugins/"
+
+// Plugin 编译进程序的扩展，在init中调用RegisterPlugin注册。
+// 插件按需实现RouteProvider、UploadFilter、TransferProcessor等接口，界面程序还可为插件添加页面
+type Plugin interface {
+	// Name 返回插件名称，只能包含字母、数字、-和_，用作路由前缀
+	Name() string
+}
+
+// RouteProvider 提供HTTP路由的插件。路由挂载在 /plugins/<名称>/ 之下，
+// 与网页一样受PIN码和访问令牌保护；键为相对路径，如"status"对应 /plugins/<名称>/status
+type RouteProvider interface {
+	Plugin
+	Routes() map[string]http.HandlerFunc
+}
+
+// UploadFilter 在接收上传前检查的插件，返回错误时拒绝该上传
+type UploadFilter interface {
+	Plugin
+	FilterUpload(req UploadRequest) error
+}
+
+// TransferProcessor 在上传或下载完成后处理文件的插件，在后台协程中调用
+type TransferProcessor interface {
+	Plugin
+	ProcessTransfer(e HistoryEntry)
+}
+
+// pluginName 合法的插件名称
+var pluginName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// plugins 已注册的插件
+var plugins struct {
+	mu   sync.RWMutex
+	list map[string]Plugin
+}
+
+// RegisterPlugin 注册插件，通常在插件包的init中调用；名称无效或重复时panic
+func RegisterPlugin(p Plugin) {
+	name := p.Name()
+	if !pluginName.MatchString(name) {
+		panic(fmt.Sprintf("pairserver: 无效的插件名称 %q", name))
+	}
+
+	plugins.mu.Lock()
+	defer plugins.mu.Unlock()
+
+	if _, dup := plugins.list[name]; dup {
+		panic(fmt.Sprintf("pairserver: 插件 %s 重复注册", name))
+	}
+	if plugins.list == nil {
+		plugins.list = make(map[string]Plugin)
+	}
+	plugins.list[name] = p
+}
+
+// Plugins 返回已注册的插件，按名称排序
+func Plugins() []Plugin {
+	plugins.mu.RLock()
+	defer plugins.mu.RUnlock()
+
+	list := make([]Plugin, 0, len(plugins.list))
+	for _, p := range plugins.list {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// pluginRoutes 将插件提供的路由注册到mux，wrap为路由添加访问控制
+func pluginRoutes(mux *http.ServeMux, wrap func(http.HandlerFunc) http.HandlerFunc) {
+	for _, p := range Plugins() {
+		rp, ok := p.(RouteProvider)
+		if !ok {
+			continue
+		}
+		for route, h := range rp.Routes() {
+			mux.HandleFunc(PluginPrefix+p.Name()+"/"+strings.TrimPrefix(route, "/"), wrap(h))
+		}
+	}
+}
+
+// filterUpload 依次交给插件检查上传，第一个返回的错误即拒绝的原因
+func filterUpload(req UploadRequest) error {
+	for _, p := range Plugins() {
+		if f, ok := p.(UploadFilter); ok {
+			if err := f.FilterUpload(req); err != nil {
+				return fmt.Errorf("%s: %w", p.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// processTransfer 将完成的传输交给插件处理，每个插件在各自的协程中运行
+func processTransfer(e HistoryEntry) {
+	if e.Result != HistoryCompleted {
+		return
+	}
+	for _, p := range Plugins() {
+		if tp, ok := p.(TransferProcessor); ok {
+			go func() {
+				defer func() {
+					if err := recover(); err != nil {
+						log.Printf("插件 %s 处理 %s 时出错: %v", p.Name(), e.Filename, err)
+					}
+				}()
+				tp.ProcessTransfer(e)
+			}()
+		}
+	}
+}
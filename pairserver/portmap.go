@@ -0,0 +1,519 @@
+package pairserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackpal/gateway"
+)
+
+// 端口映射参数
+const (
+	natPMPPort         = 5351
+	portMapLifetime    = time.Hour       // 映射的有效期，到期前一半时间续期
+	ssdpTimeout        = 2 * time.Second // 等待路由器回应SSDP搜索的时间
+	portMapDescription = "pair-gui"      // 路由器管理页面中显示的映射说明
+)
+
+// ErrNoPortMapping 路由器不支持NAT-PMP和UPnP，或未开启这些功能
+var ErrNoPortMapping = errors.New("路由器不支持NAT-PMP/UPnP端口映射")
+
+// ssdpAddr UPnP设备发现使用的组播地址
+var ssdpAddr = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+
+// upnpServiceTypes 支持端口映射的UPnP服务类型
+var upnpServiceTypes = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+// PortMapping 路由器上已建立的端口映射
+type PortMapping struct {
+	Method       string // 建立映射使用的协议：NAT-PMP或UPnP
+	ExternalIP   string // 路由器的公网IP
+	ExternalPort int    // 路由器上的外部端口
+	InternalPort int    // 映射到本机的端口
+}
+
+// Public 返回外部IP是否为公网地址；运营商级NAT或多级路由时为内网地址，外网仍无法访问
+func (m PortMapping) Public() bool {
+	ip := net.ParseIP(m.ExternalIP)
+	return ip != nil && isPublicIP(ip)
+}
+
+// isSharedAddress 返回ip是否属于运营商级NAT使用的100.64.0.0/10
+func isSharedAddress(ip net.IP) bool {
+	ip4 := ip.To4()
+	return ip4 != nil && ip4[0] == 100 && ip4[1]&0xc0 == 64
+}
+
+// portMapper 一种端口映射协议的实现
+type portMapper interface {
+	name() string
+	externalIP(ctx context.Context) (string, error)
+	// add 建立或续期映射，返回路由器实际分配的外部端口
+	add(ctx context.Context, internalPort, externalPort int, lifetime time.Duration) (int, error)
+	remove(ctx context.Context, internalPort, externalPort int) error
+}
+
+// activeMapping 运行中的端口映射及其续期协程
+type activeMapping struct {
+	mapping PortMapping
+	mapper  portMapper
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// MapPort 请求路由器将服务端口映射到公网，依次尝试NAT-PMP和UPnP，并定期续期；
+// 停止服务时自动删除映射。服务未运行时返回ErrNotRunning
+func (s *Server) MapPort(ctx context.Context) (PortMapping, error) {
+	s.mu.RLock()
+	running, port := s.httpServer != nil, s.port
+	s.mu.RUnlock()
+	if !running {
+		return PortMapping{}, ErrNotRunning
+	}
+	s.unmapPort()
+
+	var errs []error
+	for _, find := range []func(context.Context) (portMapper, error){findNATPMP, findUPnP} {
+		mapper, err := find(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		external, err := mapper.add(ctx, port, port, portMapLifetime)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", mapper.name(), err))
+			continue
+		}
+		ip, err := mapper.externalIP(ctx)
+		if err != nil {
+			mapper.remove(ctx, port, external)
+			errs = append(errs, fmt.Errorf("%s: %v", mapper.name(), err))
+			continue
+		}
+
+		m := &activeMapping{
+			mapping: PortMapping{Method: mapper.name(), ExternalIP: ip, ExternalPort: external, InternalPort: port},
+			mapper:  mapper,
+			done:    make(chan struct{}),
+			stopped: make(chan struct{}),
+		}
+		s.mu.Lock()
+		s.portMap = m
+		s.mu.Unlock()
+		go m.renew()
+		log.Printf("端口映射成功(%s): %s:%d -> %d", m.mapping.Method, ip, external, port)
+		return m.mapping, nil
+	}
+	return PortMapping{}, errors.Join(append([]error{ErrNoPortMapping}, errs...)...)
+}
+
+// PortMapping 返回当前的端口映射，未映射时返回false
+func (s *Server) PortMapping() (PortMapping, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.portMap == nil {
+		return PortMapping{}, false
+	}
+	return s.portMap.mapping, true
+}
+
+// PublicURL 返回通过端口映射从外网访问的URL，未映射时为空
+func (s *Server) PublicURL() string {
+	m, ok := s.PortMapping()
+	if !ok {
+		return ""
+	}
+	return s.urlFor(m.ExternalIP, m.ExternalPort)
+}
+
+// unmapPort 停止续期并删除路由器上的映射
+func (s *Server) unmapPort() {
+	s.mu.Lock()
+	m := s.portMap
+	s.portMap = nil
+	s.mu.Unlock()
+
+	if m == nil {
+		return
+	}
+	close(m.done)
+	<-m.stopped
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := m.mapper.remove(ctx, m.mapping.InternalPort, m.mapping.ExternalPort); err != nil {
+		log.Printf("删除端口映射失败: %v", err)
+	}
+}
+
+// renew 在映射到期前续期，直到映射被删除
+func (m *activeMapping) renew() {
+	defer close(m.stopped)
+
+	ticker := time.NewTicker(portMapLifetime / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err := m.mapper.add(ctx, m.mapping.InternalPort, m.mapping.ExternalPort, portMapLifetime)
+		cancel()
+		if err != nil {
+			log.Printf("端口映射续期失败: %v", err)
+		}
+	}
+}
+
+// findNATPMP 返回向默认网关请求映射的NAT-PMP客户端
+func findNATPMP(context.Context) (portMapper, error) {
+	gw, err := gateway.DiscoverGateway()
+	if err != nil {
+		return nil, fmt.Errorf("NAT-PMP: %v", err)
+	}
+	if gw.To4() == nil {
+		return nil, fmt.Errorf("NAT-PMP: 网关不是IPv4地址")
+	}
+	return natPMP{gateway: gw}, nil
+}
+
+// findUPnP 在局域网中查找支持端口映射的UPnP路由器
+func findUPnP(ctx context.Context) (portMapper, error) {
+	igd, err := discoverUPnP(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("UPnP: %v", err)
+	}
+	return igd, nil
+}
+
+// natPMP NAT-PMP协议（RFC 6886）
+type natPMP struct {
+	gateway net.IP
+}
+
+func (natPMP) name() string { return "NAT-PMP" }
+
+// call 向网关发送请求并等待响应，按协议要求从250ms开始加倍重试
+func (n natPMP) call(ctx context.Context, req []byte, respLen int) ([]byte, error) {
+	conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: n.gateway, Port: natPMPPort})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 16)
+	wait := 250 * time.Millisecond
+	for attempt := 0; attempt < 4; attempt++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(wait)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		conn.SetReadDeadline(deadline)
+		n, err := conn.Read(buf)
+		if err == nil {
+			if n < respLen || buf[1] != req[1]+128 {
+				return nil, fmt.Errorf("无效的响应")
+			}
+			if code := binary.BigEndian.Uint16(buf[2:4]); code != 0 {
+				return nil, fmt.Errorf("错误码 %d", code)
+			}
+			return buf[:n], nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		wait *= 2
+	}
+	return nil, fmt.Errorf("网关无响应")
+}
+
+func (n natPMP) externalIP(ctx context.Context) (string, error) {
+	resp, err := n.call(ctx, []byte{0, 0}, 12)
+	if err != nil {
+		return "", err
+	}
+	return net.IP(resp[8:12]).String(), nil
+}
+
+func (n natPMP) add(ctx context.Context, internalPort, externalPort int, lifetime time.Duration) (int, error) {
+	req := make([]byte, 12)
+	req[1] = 2 // TCP映射
+	binary.BigEndian.PutUint16(req[4:6], uint16(internalPort))
+	binary.BigEndian.PutUint16(req[6:8], uint16(externalPort))
+	binary.BigEndian.PutUint32(req[8:12], uint32(lifetime/time.Second))
+	resp, err := n.call(ctx, req, 16)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint16(resp[10:12])), nil
+}
+
+func (n natPMP) remove(ctx context.Context, internalPort, _ int) error {
+	_, err := n.add(ctx, internalPort, 0, 0)
+	return err
+}
+
+// upnpIGD 支持端口映射的UPnP路由器（Internet Gateway Device）
+type upnpIGD struct {
+	controlURL  string
+	serviceType string
+	localIP     string // 本机在路由器所在网络中的IP
+}
+
+func (upnpIGD) name() string { return "UPnP" }
+
+// upnpDevice UPnP设备描述中的设备，可嵌套子设备
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// findService 在设备及其子设备中查找指定类型的服务，返回控制地址
+func (d upnpDevice) findService(serviceType string) (string, bool) {
+	for _, svc := range d.Services {
+		if svc.ServiceType == serviceType {
+			return svc.ControlURL, true
+		}
+	}
+	for _, sub := range d.Devices {
+		if u, ok := sub.findService(serviceType); ok {
+			return u, true
+		}
+	}
+	return "", false
+}
+
+// discoverUPnP 通过SSDP查找路由器并读取其设备描述
+func discoverUPnP(ctx context.Context) (upnpIGD, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return upnpIGD{}, err
+	}
+	defer conn.Close()
+
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n\r\n"
+	if _, err := conn.WriteToUDP([]byte(search), ssdpAddr); err != nil {
+		return upnpIGD{}, err
+	}
+
+	deadline := time.Now().Add(ssdpTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return upnpIGD{}, ErrNoPortMapping
+		}
+		location := ssdpHeader(string(buf[:n]), "location")
+		if location == "" {
+			continue
+		}
+		if igd, err := loadIGD(ctx, location); err == nil {
+			return igd, nil
+		}
+	}
+}
+
+// ssdpHeader 返回SSDP响应中的头部值，名称不区分大小写
+func ssdpHeader(resp, name string) string {
+	for _, line := range strings.Split(resp, "\r\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(key), name) {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// loadIGD 读取路由器的设备描述，找到端口映射服务的控制地址
+func loadIGD(ctx context.Context, location string) (upnpIGD, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return upnpIGD{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return upnpIGD{}, err
+	}
+	defer resp.Body.Close()
+
+	var root struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&root); err != nil {
+		return upnpIGD{}, err
+	}
+	base, err := url.Parse(location)
+	if err != nil {
+		return upnpIGD{}, err
+	}
+	if root.URLBase != "" {
+		if u, err := url.Parse(root.URLBase); err == nil {
+			base = u
+		}
+	}
+
+	// 本机IP取与路由器通信时使用的地址
+	host := base.Hostname()
+	conn, err := net.Dial("udp4", net.JoinHostPort(host, "1900"))
+	if err != nil {
+		return upnpIGD{}, err
+	}
+	localIP := conn.LocalAddr().(*net.UDPAddr).IP.String()
+	conn.Close()
+
+	for _, serviceType := range upnpServiceTypes {
+		if control, ok := root.Device.findService(serviceType); ok {
+			u, err := base.Parse(control)
+			if err != nil {
+				return upnpIGD{}, err
+			}
+			return upnpIGD{controlURL: u.String(), serviceType: serviceType, localIP: localIP}, nil
+		}
+	}
+	return upnpIGD{}, ErrNoPortMapping
+}
+
+// soap 调用路由器的UPnP操作，args按顺序作为参数，返回响应正文
+func (g upnpIGD) soap(ctx context.Context, action string, args [][2]string) (string, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:` + action + ` xmlns:u="` + g.serviceType + `">`)
+	for _, arg := range args {
+		body.WriteString("<" + arg[0] + ">")
+		xml.EscapeText(&body, []byte(arg[1]))
+		body.WriteString("</" + arg[0] + ">")
+	}
+	body.WriteString(`</u:` + action + `></s:Body></s:Envelope>`)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.controlURL, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+g.serviceType+"#"+action+`"`)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if code := xmlValue(data, "errorCode"); code != "" {
+			return "", &upnpError{Action: action, Code: code, Description: xmlValue(data, "errorDescription")}
+		}
+		return "", fmt.Errorf("%s: %s", action, resp.Status)
+	}
+	return string(data), nil
+}
+
+// upnpError 路由器返回的UPnP错误
+type upnpError struct {
+	Action      string
+	Code        string
+	Description string
+}
+
+func (e *upnpError) Error() string {
+	return fmt.Sprintf("%s: 错误码 %s %s", e.Action, e.Code, e.Description)
+}
+
+// xmlValue 返回XML中第一个指定名称元素的文本
+func xmlValue(data []byte, name string) string {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == name {
+			var value string
+			dec.DecodeElement(&value, &start)
+			return strings.TrimSpace(value)
+		}
+	}
+}
+
+func (g upnpIGD) externalIP(ctx context.Context) (string, error) {
+	resp, err := g.soap(ctx, "GetExternalIPAddress", nil)
+	if err != nil {
+		return "", err
+	}
+	ip := xmlValue([]byte(resp), "NewExternalIPAddress")
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("路由器未返回公网IP")
+	}
+	return ip, nil
+}
+
+func (g upnpIGD) add(ctx context.Context, internalPort, externalPort int, lifetime time.Duration) (int, error) {
+	args := func(lease time.Duration) [][2]string {
+		return [][2]string{
+			{"NewRemoteHost", ""},
+			{"NewExternalPort", strconv.Itoa(externalPort)},
+			{"NewProtocol", "TCP"},
+			{"NewInternalPort", strconv.Itoa(internalPort)},
+			{"NewInternalClient", g.localIP},
+			{"NewEnabled", "1"},
+			{"NewPortMappingDescription", portMapDescription},
+			{"NewLeaseDuration", strconv.Itoa(int(lease / time.Second))},
+		}
+	}
+	_, err := g.soap(ctx, "AddPortMapping", args(lifetime))
+	var upnpErr *upnpError
+	if errors.As(err, &upnpErr) && upnpErr.Code == "725" {
+		// 部分路由器只支持永久映射（错误码725），停止服务时会删除
+		_, err = g.soap(ctx, "AddPortMapping", args(0))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return externalPort, nil
+}
+
+func (g upnpIGD) remove(ctx context.Context, _, externalPort int) error {
+	_, err := g.soap(ctx, "DeletePortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(externalPort)},
+		{"NewProtocol", "TCP"},
+	})
+	return err
+}
@@ -0,0 +1,72 @@
+package pairserver
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// postReceiveTimeout 接收后命令的最长运行时间，超时后结束命令
+const postReceiveTimeout = 10 * time.Minute
+
+// SetPostReceiveCommand 设置每次上传完成后执行的命令，为空表示不执行。
+// 命令通过系统shell（Windows为cmd，其他平台为sh）在文件所在目录运行，可使用以下环境变量：
+// PAIR_FILE（保存路径）、PAIR_FILENAME、PAIR_SIZE（字节数）、PAIR_CLIENT_IP、PAIR_CLIENT_NAME；
+// 也可使用占位符{file}、{filename}、{size}、{ip}、{name}，替换为加了双引号的环境变量引用
+// （sh为"$PAIR_FILE"，cmd为"%PAIR_FILE%"），值本身不进入命令行
+func (s *Server) SetPostReceiveCommand(command string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.postReceive = strings.TrimSpace(command)
+}
+
+// runPostReceive 上传完成后在后台执行接收后命令；多个上传的命令依次执行，失败只记录日志
+func (s *Server) runPostReceive(e HistoryEntry) {
+	s.mu.RLock()
+	command := s.postReceive
+	s.mu.RUnlock()
+	if command == "" || e.Direction != TransferUpload || e.Result != HistoryCompleted || e.Path == "" {
+		return
+	}
+
+	go func() {
+		s.postReceiveMu.Lock()
+		defer s.postReceiveMu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), postReceiveTimeout)
+		defer cancel()
+		cmd := postReceiveCommand(ctx, command, e)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			log.Printf("接收后命令执行失败（%s）: %v %s", e.Filename, err, strings.TrimSpace(string(out)))
+		}
+	}()
+}
+
+// postReceiveCommand 替换command中的占位符，返回在文件所在目录运行、带PAIR_*环境变量的命令。
+// 设备名称等值由手机提供，不可信，只放在环境变量中，命令行中只有shellVar返回的变量引用
+func postReceiveCommand(ctx context.Context, command string, e HistoryEntry) *exec.Cmd {
+	vars := []struct{ key, env, value string }{
+		{"file", "PAIR_FILE", e.Path},
+		{"filename", "PAIR_FILENAME", e.Filename},
+		{"size", "PAIR_SIZE", strconv.FormatInt(e.Size, 10)},
+		{"ip", "PAIR_CLIENT_IP", e.ClientIP},
+		{"name", "PAIR_CLIENT_NAME", e.ClientName},
+	}
+	pairs := make([]string, 0, 2*len(vars))
+	env := os.Environ()
+	for _, v := range vars {
+		pairs = append(pairs, "{"+v.key+"}", shellVar(v.env))
+		env = append(env, v.env+"="+shellEnv(v.value))
+	}
+
+	cmd := shellCommand(ctx, strings.NewReplacer(pairs...).Replace(command))
+	cmd.Dir = filepath.Dir(e.Path)
+	cmd.Env = env
+	return cmd
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package pairserver
+
+import (
+	"context"
+	"os/exec"
+)
+
+// shellCommand 返回通过sh执行command的命令
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// shellVar 返回替换占位符的内容：加了双引号的环境变量引用，sh展开后不再拆分或解析其中的字符
+func shellVar(env string) string {
+	return `"$` + env + `"`
+}
+
+// shellEnv 返回环境变量的值，sh展开变量后不再解析其中的字符，原样传递
+func shellEnv(value string) string {
+	return value
+}
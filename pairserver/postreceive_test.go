@@ -0,0 +1,63 @@
+package pairserver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPostReceiveHostileName 手机可以任意设置设备名称，名称只放在环境变量中，不能注入命令，也不能展开变量
+func TestPostReceiveHostileName(t *testing.T) {
+	dir := t.TempDir()
+	name := `x"' & echo pwned > pwned.txt & $(echo pwned > pwned.txt) | %PATH% "`
+	e := HistoryEntry{Path: filepath.Join(dir, "a.txt"), Filename: "a.txt", Size: 1, ClientIP: "192.168.1.2", ClientName: name}
+
+	cmd := postReceiveCommand(context.Background(), "echo {name} {filename} > out.txt", e)
+	if strings.Contains(strings.Join(cmd.Args, " "), "pwned") {
+		t.Errorf("设备名称出现在命令行中: %q", cmd.Args)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("命令执行失败: %v %s", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pwned.txt")); err == nil {
+		t.Fatal("设备名称注入了命令")
+	}
+	out, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"echo pwned", "%PATH%", "a.txt"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("输出 %q 中缺少 %q", out, want)
+		}
+	}
+}
+
+// TestPostReceiveEnv 命令通过环境变量获取上传信息
+func TestPostReceiveEnv(t *testing.T) {
+	dir := t.TempDir()
+	e := HistoryEntry{Path: filepath.Join(dir, "a b.txt"), Filename: "a b.txt", Size: 42, ClientIP: "192.168.1.2", ClientName: "手机"}
+
+	cmd := postReceiveCommand(context.Background(), "echo {size}", e)
+	if cmd.Dir != dir {
+		t.Errorf("工作目录为 %q，应为 %q", cmd.Dir, dir)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Trim(strings.TrimSpace(string(out)), `"'`); got != "42" {
+		t.Errorf("{size}替换为 %q", got)
+	}
+	for _, want := range []string{"PAIR_FILE=" + e.Path, "PAIR_SIZE=42", "PAIR_CLIENT_NAME=手机"} {
+		found := false
+		for _, kv := range cmd.Env {
+			found = found || kv == want
+		}
+		if !found {
+			t.Errorf("环境变量中缺少 %s", want)
+		}
+	}
+}
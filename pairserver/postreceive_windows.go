@@ -0,0 +1,32 @@
+package pairserver
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// shellCommand 返回通过cmd执行command的命令；命令行原样交给cmd，不按程序参数规则转义
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "cmd")
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: `cmd /S /C "` + command + `"`}
+	return cmd
+}
+
+// shellVar 返回替换占位符的内容：加了双引号的环境变量引用。cmd中无法转义双引号内的%和双引号，
+// 值若直接写入命令行，设备名称等可以注入命令；变量只展开一次，展开结果中的%不会再次展开
+func shellVar(env string) string {
+	return `"%` + env + `%"`
+}
+
+// shellEnv 返回环境变量的值：去掉双引号和换行，展开在双引号内时&、|等字符不会被cmd解析。
+// Windows的文件名中不会出现这些字符，只影响设备名称
+func shellEnv(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '"' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,87 @@
+package pairserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// 路径前缀：放在反向代理后与其他服务共用一个域名时，整个网页挂在如/share/的前缀下。
+// 带前缀的请求去掉前缀后再路由；不带前缀的请求照常处理，局域网内的直接访问、
+// 其他设备的直接发送和LocalSend等不受影响，反向代理自行去掉前缀时也能工作
+
+// prefixKey 请求上下文中记录去掉的路径前缀
+type prefixKey struct{}
+
+// SetPathPrefix 设置网页的路径前缀，如"/share"，为空时不使用前缀
+func (s *Server) SetPathPrefix(prefix string) error {
+	prefix = "/" + strings.Trim(prefix, "/")
+	if prefix == "/" {
+		prefix = ""
+	}
+	if prefix != "" && (path.Clean(prefix) != prefix || strings.ContainsAny(prefix, "?#%\\ ")) {
+		return fmt.Errorf("无效的路径前缀: %s", prefix)
+	}
+	s.mu.Lock()
+	s.prefix = prefix
+	s.mu.Unlock()
+	return nil
+}
+
+// PathPrefix 返回网页的路径前缀，未设置时为空
+func (s *Server) PathPrefix() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.prefix
+}
+
+// sitePath 返回站内路径加上前缀后的地址，用于跳转和生成链接
+func (s *Server) sitePath(p string) string {
+	return s.PathPrefix() + p
+}
+
+// basePath 页面中<base>的地址，页面内的链接和脚本请求均相对于它
+func (s *Server) basePath() string {
+	return s.PathPrefix() + "/"
+}
+
+// requestPrefix 返回请求去掉的路径前缀，请求不带前缀时为空
+func requestPrefix(r *http.Request) string {
+	prefix, _ := r.Context().Value(prefixKey{}).(string)
+	return prefix
+}
+
+// stripPrefix 路径前缀中间件：访问前缀本身时跳转到带斜杠的地址，带前缀的请求去掉前缀后交给h
+func (s *Server) stripPrefix(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := s.PathPrefix()
+		if prefix == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path == prefix {
+			u := *r.URL
+			u.Path, u.RawPath = prefix+"/", ""
+			http.Redirect(w, r, u.RequestURI(), http.StatusMovedPermanently)
+			return
+		}
+		p, ok := strings.CutPrefix(r.URL.Path, prefix+"/")
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		r2 := r.WithContext(context.WithValue(r.Context(), prefixKey{}, prefix))
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = "/" + p
+		r2.URL.RawPath = ""
+		if raw, ok := strings.CutPrefix(r.URL.RawPath, prefix+"/"); ok {
+			r2.URL.RawPath = "/" + raw
+		}
+		r2.RequestURI = r2.URL.RequestURI()
+		h.ServeHTTP(w, r2)
+	})
+}
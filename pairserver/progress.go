@@ -0,0 +1,171 @@
+package pairserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 进度推送参数
+const (
+	progressInterval = 300 * time.Millisecond // 推送进度的间隔
+	progressWait     = 10 * time.Second       // 上传尚未开始时等待的最长时间
+)
+
+// UploadProgress 上传进度结构体
+type UploadProgress struct {
+	TotalSize int64
+	Uploaded  int64
+}
+
+// ProgressReader 包装io.Reader以跟踪读取进度
+type ProgressReader struct {
+	Reader   io.Reader
+	Progress *UploadProgress
+}
+
+// Read 实现io.Reader接口，更新上传进度
+func (pr *ProgressReader) Read(p []byte) (n int, err error) {
+	n, err = pr.Reader.Read(p)
+	atomic.AddInt64(&pr.Progress.Uploaded, int64(n))
+	return
+}
+
+// UploadStatus 一个进行中上传的进度，Uploaded为已写入磁盘的字节数
+type UploadStatus struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename,omitempty"` // 表单上传一次可包含多个文件，此时为空
+	Total    int64  `json:"total"`              // 总字节数，未知时为-1
+	Uploaded int64  `json:"uploaded"`
+}
+
+// progressStore 表单上传的进度
+type progressStore struct {
+	mu      sync.Mutex
+	uploads map[string]*UploadProgress
+}
+
+// add 记录上传进度
+func (p *progressStore) add(id string, progress *UploadProgress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.uploads == nil {
+		p.uploads = make(map[string]*UploadProgress)
+	}
+	p.uploads[id] = progress
+}
+
+// remove 移除上传进度
+func (p *progressStore) remove(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.uploads, id)
+}
+
+// Upload 返回指定上传的进度，包括表单上传和断点续传上传
+func (s *Server) Upload(id string) (UploadStatus, bool) {
+	s.progress.mu.Lock()
+	progress, ok := s.progress.uploads[id]
+	s.progress.mu.Unlock()
+	if ok {
+		return UploadStatus{ID: id, Total: progress.TotalSize, Uploaded: atomic.LoadInt64(&progress.Uploaded)}, true
+	}
+
+	s.tus.mu.Lock()
+	u, ok := s.tus.uploads[id]
+	s.tus.mu.Unlock()
+	if ok {
+		return u.status(), true
+	}
+	return UploadStatus{}, false
+}
+
+// Uploads 返回全部进行中上传的进度，按ID排序，可用于在界面中显示
+func (s *Server) Uploads() []UploadStatus {
+	var list []UploadStatus
+	s.progress.mu.Lock()
+	for id, progress := range s.progress.uploads {
+		list = append(list, UploadStatus{ID: id, Total: progress.TotalSize, Uploaded: atomic.LoadInt64(&progress.Uploaded)})
+	}
+	s.progress.mu.Unlock()
+
+	s.tus.mu.Lock()
+	for _, u := range s.tus.uploads {
+		list = append(list, u.status())
+	}
+	s.tus.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// progressHandler 上传进度查询接口；请求头Accept为text/event-stream时以Server-Sent Events推送
+// 服务器实际写入磁盘的字节数，直到上传结束
+func (s *Server) progressHandler(w http.ResponseWriter, r *http.Request) {
+	uploadId := r.URL.Query().Get("uploadId")
+	if uploadId == "" {
+		http.Error(w, "缺少uploadId参数", http.StatusBadRequest)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.progressEvents(w, r, uploadId)
+		return
+	}
+
+	status, _ := s.Upload(uploadId)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"total":%d,"uploaded":%d}`, status.Total, status.Uploaded)
+}
+
+// progressEvents 推送上传进度：进度变化时发送message事件，上传结束或超时未开始时发送end事件后关闭
+func (s *Server) progressEvents(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "不支持事件推送", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	// 浏览器断开后按该间隔重连
+	fmt.Fprintf(w, "retry: 1000\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	deadline := time.Now().Add(progressWait)
+	seen := false
+	last := UploadStatus{Uploaded: -1}
+	for {
+		status, ok := s.Upload(id)
+		switch {
+		case ok:
+			seen = true
+			if status != last {
+				data, _ := json.Marshal(status)
+				fmt.Fprintf(w, "data: %s\n\n", data)
+				flusher.Flush()
+				last = status
+			}
+		case seen || time.Now().After(deadline):
+			fmt.Fprintf(w, "event: end\ndata: {}\n\n")
+			flusher.Flush()
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,591 @@
+package pairserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 直接发送参数
+const (
+	pushPromptTimeout  = 2 * time.Minute  // 等待接收方确认的最长时间
+	pushSessionTimeout = 30 * time.Minute // 确认后完成发送的最长时间
+	maxPushRequestSize = 1 << 20          // 发送请求（文件清单）的最大字节数
+	minDeltaSize       = 64 << 10         // 小于该大小的文件直接发送，不尝试增量传输
+)
+
+// ErrPushDeclined 接收方拒绝或未及时确认
+var ErrPushDeclined = errors.New("对方拒绝接收")
+
+// PushFile 直接发送的一个文件
+type PushFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// PushRequest 其他设备请求直接发送文件
+type PushRequest struct {
+	From  string     `json:"from"` // 发送方设备名称
+	IP    string     `json:"-"`    // 发送方IP
+	Files []PushFile `json:"files"`
+}
+
+// TotalSize 返回全部文件的总大小
+func (r PushRequest) TotalSize() int64 {
+	var total int64
+	for _, f := range r.Files {
+		total += f.Size
+	}
+	return total
+}
+
+// PushHandler 询问是否接收其他设备直接发送的文件，在处理请求的协程中调用，返回前发送方保持等待；
+// 未设置时拒绝所有直接发送
+type PushHandler func(PushRequest) bool
+
+// pushItem 已确认接收的一个文件
+type pushItem struct {
+	Name  string
+	Size  int64
+	Token string // 上传时需附带的令牌，为空表示不需要
+
+	expires time.Time // 取出时所属会话的过期时间，放回会话时沿用
+}
+
+// pushSession 已确认接收、尚未传完的发送请求
+type pushSession struct {
+	remaining map[string]pushItem // 尚未接收的文件，以文件ID为键
+	expires   time.Time
+}
+
+// pushState 直接发送的接收状态
+type pushState struct {
+	mu       sync.Mutex
+	handler  PushHandler
+	sessions map[string]*pushSession
+}
+
+// SetPushHandler 设置其他设备直接发送文件时的确认回调
+func (s *Server) SetPushHandler(h PushHandler) {
+	s.push.mu.Lock()
+	defer s.push.mu.Unlock()
+
+	s.push.handler = h
+}
+
+// pushRequestHandler 接收发送请求：等待用户确认后返回本次发送的会话ID。
+// 不要求访问令牌和PIN码，由接收方逐次确认代替
+func (s *Server) pushRequestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+	s.push.mu.Lock()
+	handler := s.push.handler
+	s.push.mu.Unlock()
+	if handler == nil {
+		http.Error(w, "不接收直接发送的文件", http.StatusNotFound)
+		return
+	}
+
+	var req PushRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushRequestSize)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("解析请求失败: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(req.Files) == 0 {
+		http.Error(w, "没有要发送的文件", http.StatusBadRequest)
+		return
+	}
+	items := make(map[string]pushItem, len(req.Files))
+	for i, f := range req.Files {
+		name := sanitizeFilename(f.Name)
+		if _, dup := items[name]; dup || f.Size < 0 {
+			http.Error(w, fmt.Sprintf("无效的文件: %s", f.Name), http.StatusBadRequest)
+			return
+		}
+		req.Files[i].Name = name
+		items[name] = pushItem{Name: name, Size: f.Size}
+	}
+	req.IP = clientIP(r)
+
+	total := req.TotalSize()
+	if limit := s.MaxUploadSize(); limit > 0 && total > limit {
+		writeTooLarge(w, r, limit)
+		return
+	}
+	if !ensureSpace(w, r, s.UploadDir(), total) {
+		return
+	}
+
+	id, ok := s.acceptPush(r, handler, req, items)
+	if !ok {
+		http.Error(w, ErrPushDeclined.Error(), http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"session": id})
+}
+
+// acceptPush 请用户确认是否接收，确认后以items创建接收会话并返回会话ID
+func (s *Server) acceptPush(r *http.Request, handler PushHandler, req PushRequest, items map[string]pushItem) (string, bool) {
+	// 等待用户确认；发送方断开或超时视为拒绝
+	ctx, cancel := context.WithTimeout(r.Context(), pushPromptTimeout)
+	defer cancel()
+	answer := make(chan bool, 1)
+	go func() { answer <- handler(req) }()
+	accepted := false
+	select {
+	case accepted = <-answer:
+	case <-ctx.Done():
+	}
+	if !accepted {
+		return "", false
+	}
+
+	id := newSessionID()
+	s.push.mu.Lock()
+	defer s.push.mu.Unlock()
+	if s.push.sessions == nil {
+		s.push.sessions = make(map[string]*pushSession)
+	}
+	for key, sess := range s.push.sessions {
+		if time.Now().After(sess.expires) {
+			delete(s.push.sessions, key)
+		}
+	}
+	s.push.sessions[id] = &pushSession{remaining: items, expires: time.Now().Add(pushSessionTimeout)}
+	return id, true
+}
+
+// takePushFile 从会话中取出待接收的文件，令牌不匹配或会话已过期时返回false
+func (s *Server) takePushFile(session, fileID, token string) (pushItem, bool) {
+	s.push.mu.Lock()
+	defer s.push.mu.Unlock()
+
+	sess, ok := s.push.sessions[session]
+	if !ok || time.Now().After(sess.expires) {
+		return pushItem{}, false
+	}
+	item, ok := sess.remaining[fileID]
+	if !ok || item.Token != token {
+		return pushItem{}, false
+	}
+	item.expires = sess.expires
+	delete(sess.remaining, fileID)
+	if len(sess.remaining) == 0 {
+		delete(s.push.sessions, session)
+	}
+	return item, true
+}
+
+// peekPushFile 返回会话中待接收的文件，不取出
+func (s *Server) peekPushFile(session, fileID string) (pushItem, bool) {
+	s.push.mu.Lock()
+	defer s.push.mu.Unlock()
+
+	sess, ok := s.push.sessions[session]
+	if !ok || time.Now().After(sess.expires) {
+		return pushItem{}, false
+	}
+	item, ok := sess.remaining[fileID]
+	return item, ok
+}
+
+// restorePushFile 接收失败后将文件放回会话，发送方可以改用完整上传重试；
+// 会话的过期时间保持不变，已过期时不再放回
+func (s *Server) restorePushFile(session string, item pushItem) {
+	s.push.mu.Lock()
+	defer s.push.mu.Unlock()
+
+	if time.Now().After(item.expires) {
+		return
+	}
+	sess, ok := s.push.sessions[session]
+	if !ok {
+		if s.push.sessions == nil {
+			s.push.sessions = make(map[string]*pushSession)
+		}
+		sess = &pushSession{remaining: make(map[string]pushItem), expires: item.expires}
+		s.push.sessions[session] = sess
+	}
+	sess.remaining[item.Name] = item
+}
+
+// cancelPush 取消接收会话
+func (s *Server) cancelPush(session string) {
+	s.push.mu.Lock()
+	defer s.push.mu.Unlock()
+
+	delete(s.push.sessions, session)
+}
+
+// pushFileHandler 接收已确认的发送请求中的一个文件，请求体为文件内容
+func (s *Server) pushFileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "仅支持PUT方法", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	item, ok := s.takePushFile(query.Get("session"), sanitizeFilename(query.Get("name")), "")
+	if !ok {
+		http.Error(w, "发送请求未确认或已过期", http.StatusForbidden)
+		return
+	}
+	if s.savePushFile(w, r, item) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// pushSignatureHandler 返回上传目录中同名旧文件的块签名，发送方据此只发送变化的部分；
+// 没有旧文件或重名策略为拒绝时返回404，发送方改用完整上传
+func (s *Server) pushSignatureHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "仅支持GET方法", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	item, ok := s.peekPushFile(query.Get("session"), sanitizeFilename(query.Get("name")))
+	if !ok {
+		http.Error(w, "发送请求未确认或已过期", http.StatusForbidden)
+		return
+	}
+	dir := s.UploadDir()
+	if s.rejectsExisting(dir, item.Name) {
+		http.NotFound(w, r)
+		return
+	}
+	basis, info, err := openBasis(filepath.Join(dir, item.Name))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer basis.Close()
+	sig, err := computeSignature(basis, info.Size())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("读取文件失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sig)
+}
+
+// pushDeltaHandler 接收增量数据，在同名旧文件的基础上重建新文件后按重名策略保存。
+// 失败时文件放回会话，发送方可以改用完整上传
+func (s *Server) pushDeltaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "仅支持PUT方法", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	session := query.Get("session")
+	item, ok := s.takePushFile(session, sanitizeFilename(query.Get("name")), "")
+	if !ok {
+		http.Error(w, "发送请求未确认或已过期", http.StatusForbidden)
+		return
+	}
+	if !s.saveDelta(w, r, item) {
+		s.restorePushFile(session, item)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// saveDelta 重建并保存增量传输的文件；失败时返回错误响应和false
+func (s *Server) saveDelta(w http.ResponseWriter, r *http.Request, item pushItem) bool {
+	dir := s.UploadDir()
+	basis, info, err := openBasis(filepath.Join(dir, item.Name))
+	if err != nil {
+		http.Error(w, "旧文件不存在", http.StatusConflict)
+		return false
+	}
+	defer basis.Close()
+	if !s.startPushFile(w, r, item) {
+		return false
+	}
+	if err := os.MkdirAll(filepath.Join(dir, partialDir), 0o755); err != nil {
+		http.Error(w, fmt.Sprintf("创建临时目录失败: %v", err), http.StatusInternalServerError)
+		return false
+	}
+	tmp, err := os.CreateTemp(filepath.Join(dir, partialDir), "delta-*.part")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("创建文件失败: %v", err), http.StatusInternalServerError)
+		return false
+	}
+	err = applyDelta(tmp, newRateLimitedReader(r.Context(), r.Body, s.RateLimit()), basis, info.Size(), item.Size)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	basis.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		status := http.StatusBadRequest
+		if errors.Is(err, errDeltaMismatch) {
+			status = http.StatusConflict
+		}
+		http.Error(w, fmt.Sprintf("保存文件失败: %v", err), status)
+		return false
+	}
+
+	var saved string
+	err = s.saveAs(dir, item.Name, func(path string) error {
+		saved = path
+		return os.Rename(tmp.Name(), path)
+	})
+	if err != nil {
+		os.Remove(tmp.Name())
+		if errors.Is(err, ErrFileExists) {
+			http.Error(w, fmt.Sprintf("文件已存在: %s", item.Name), http.StatusConflict)
+		} else {
+			http.Error(w, fmt.Sprintf("保存文件失败: %v", err), http.StatusInternalServerError)
+		}
+		return false
+	}
+	setRequestFile(r, saved)
+	return true
+}
+
+// startPushFile 记录开始接收的文件并按上传过滤规则检查；被拒绝时返回错误响应和false
+func (s *Server) startPushFile(w http.ResponseWriter, r *http.Request, item pushItem) bool {
+	if t := requestTransfer(r); t != nil {
+		t.describe(item.Name, item.Size, 0)
+	}
+	req := UploadRequest{Filename: item.Name, Size: item.Size, IP: clientIP(r), UserAgent: r.UserAgent()}
+	if err := filterUpload(req); err != nil {
+		http.Error(w, fmt.Sprintf("拒绝接收 %s: %v", item.Name, err), http.StatusForbidden)
+		return false
+	}
+	s.publish(EventUploadStarted, req)
+	return true
+}
+
+// savePushFile 将请求体保存为上传目录中的文件，重名时按策略处理；失败时返回错误响应和false
+func (s *Server) savePushFile(w http.ResponseWriter, r *http.Request, item pushItem) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, item.Size)
+	if !s.startPushFile(w, r, item) {
+		return false
+	}
+
+	outFile, err := s.createUpload(s.UploadDir(), item.Name)
+	if errors.Is(err, ErrFileExists) {
+		http.Error(w, fmt.Sprintf("文件已存在: %s", item.Name), http.StatusConflict)
+		return false
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("创建文件失败: %v", err), http.StatusInternalServerError)
+		return false
+	}
+
+	n, err := io.Copy(outFile, newRateLimitedReader(r.Context(), r.Body, s.RateLimit()))
+	if err == nil && n != item.Size {
+		err = fmt.Errorf("文件不完整: %d/%d", n, item.Size)
+	}
+	if err != nil {
+		outFile.abort()
+		http.Error(w, fmt.Sprintf("保存文件失败: %v", err), http.StatusBadRequest)
+		return false
+	}
+	if err := outFile.commit(); err != nil {
+		http.Error(w, fmt.Sprintf("保存文件失败: %v", err), http.StatusInternalServerError)
+		return false
+	}
+	setRequestFile(r, outFile.path)
+	return true
+}
+
+// PushFiles 将文件直接发送到附近设备：先请求对方确认，确认后逐个上传；对方为LocalSend应用时使用LocalSend协议。
+// progress非nil时在发送过程中报告已发送和总字节数。对方使用自签名证书，因此不校验HTTPS证书
+func PushFiles(ctx context.Context, peer Peer, from string, files []File, progress func(sent, total int64)) error {
+	base := peer.URL()
+	if base == "" {
+		return fmt.Errorf("%s 未启动服务", peer.Name)
+	}
+	client := insecureClient()
+
+	req := PushRequest{From: from}
+	for _, f := range files {
+		info, err := os.Stat(f.AbsPath)
+		if err != nil {
+			return err
+		}
+		req.Files = append(req.Files, PushFile{Name: f.Filename, Size: info.Size()})
+	}
+
+	// targets为每个文件的上传地址，为nil表示对方无需接收任何文件
+	var method string
+	var targets []string
+	var err error
+	if peer.LocalSend {
+		method = http.MethodPost
+		targets, err = prepareLocalSend(ctx, client, base, req)
+	} else {
+		method = http.MethodPut
+		targets, err = preparePush(ctx, client, base, req)
+	}
+	if err != nil {
+		return err
+	}
+
+	var sent atomic.Int64
+	total := req.TotalSize()
+	for i, target := range targets {
+		if target == "" {
+			continue
+		}
+		file, err := os.Open(files[i].AbsPath)
+		if err != nil {
+			return err
+		}
+		var reader io.Reader = file
+		if progress != nil {
+			reader = &countingReader{Reader: file, onRead: func(n int) { progress(sent.Add(int64(n)), total) }}
+		}
+		// 对方已有同名的旧文件时只发送变化的部分，不可用或失败时从头完整发送
+		if !peer.LocalSend && req.Files[i].Size >= minDeltaSize {
+			start := sent.Load()
+			done, err := pushDelta(ctx, client, target, reader)
+			if err != nil || done {
+				file.Close()
+				if err != nil {
+					return fmt.Errorf("%s: %v", files[i].Filename, err)
+				}
+				continue
+			}
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				file.Close()
+				return err
+			}
+			if progress != nil {
+				sent.Store(start)
+				progress(start, total)
+			}
+		}
+		resp, err := doPush(ctx, client, method, target, reader, req.Files[i].Size)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", files[i].Filename, err)
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// preparePush 向pair-gui实例发送请求并等待确认，返回每个文件的上传地址
+func preparePush(ctx context.Context, client *http.Client, base string, req PushRequest) ([]string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doPush(ctx, client, http.MethodPost, base+"push/request", bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var session struct {
+		Session string `json:"session"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+	targets := make([]string, len(req.Files))
+	for i, f := range req.Files {
+		targets[i] = fmt.Sprintf("%spush/file?session=%s&name=%s", base,
+			url.QueryEscape(session.Session), url.QueryEscape(f.Name))
+	}
+	return targets, nil
+}
+
+// pushDelta 尝试以增量方式发送文件：target为完整上传的地址，增量接口使用相同的查询参数。
+// 返回true表示已发送完成；返回false且没有错误表示对方没有旧文件或增量传输失败，应改用完整上传
+func pushDelta(ctx context.Context, client *http.Client, target string, src io.Reader) (bool, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return false, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "push/file") + "push/signature"
+	resp, err := doPush(ctx, client, http.MethodGet, u.String(), nil, 0)
+	if err != nil {
+		return false, ctx.Err()
+	}
+	var sig deltaSignature
+	err = json.NewDecoder(resp.Body).Decode(&sig)
+	resp.Body.Close()
+	if err != nil || !sig.valid() {
+		return false, ctx.Err()
+	}
+
+	// 边计算边发送，增量数据的长度事先未知，以分块编码上传
+	pr, pw := io.Pipe()
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		pw.CloseWithError(writeDelta(pw, src, &sig))
+	}()
+	u.Path = strings.TrimSuffix(u.Path, "push/signature") + "push/delta"
+	resp, err = doPush(ctx, client, http.MethodPut, u.String(), pr, -1)
+	// 请求提前结束时解除写入的阻塞，等待其退出后才能重新读取文件
+	pr.CloseWithError(io.ErrClosedPipe)
+	<-written
+	if err != nil {
+		return false, ctx.Err()
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// insecureClient 返回不校验HTTPS证书的客户端，用于连接使用自签名证书的附近设备
+func insecureClient() *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+}
+
+// doPush 发送请求，状态码不为2xx时返回错误；发送请求返回403表示对方拒绝接收
+func doPush(ctx context.Context, client *http.Client, method, target string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusForbidden && method == http.MethodPost {
+		return nil, ErrPushDeclined
+	}
+	return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// countingReader 读取时回调已读取的字节数
+type countingReader struct {
+	io.Reader
+	onRead func(n int)
+}
+
+// Read 实现io.Reader接口
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	if n > 0 {
+		c.onRead(n)
+	}
+	return n, err
+}
@@ -0,0 +1,49 @@
+package pairserver
+
+import (
+	"testing"
+	"time"
+)
+
+// TestRestorePushFile 放回会话的文件沿用原来的过期时间，会话已过期时不再放回
+func TestRestorePushFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		expired bool
+		restore bool
+	}{
+		{"未过期", false, true},
+		{"已过期", true, false},
+	}
+	for _, tt := range tests {
+		s := New()
+		deadline := time.Now().Add(time.Minute)
+		s.push.sessions = map[string]*pushSession{
+			"s": {remaining: map[string]pushItem{"a.txt": {Name: "a.txt", Size: 1}}, expires: deadline},
+		}
+		item, ok := s.takePushFile("s", "a.txt", "")
+		if !ok {
+			t.Fatalf("%s: 应能取出文件", tt.name)
+		}
+		if _, ok := s.push.sessions["s"]; ok {
+			t.Fatalf("%s: 最后一个文件取出后会话应被移除", tt.name)
+		}
+		if !item.expires.Equal(deadline) {
+			t.Fatalf("%s: 取出的文件应记录会话的过期时间", tt.name)
+		}
+		if tt.expired {
+			// 会话在接收过程中过期
+			item.expires = time.Now().Add(-time.Second)
+		}
+		s.restorePushFile("s", item)
+
+		sess, ok := s.push.sessions["s"]
+		if ok != tt.restore {
+			t.Errorf("%s: 是否放回应为%v", tt.name, tt.restore)
+			continue
+		}
+		if ok && !sess.expires.Equal(item.expires) {
+			t.Errorf("%s: 放回后的过期时间为%v，应为%v", tt.name, sess.expires, item.expires)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package pairserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"sync"
+)
+
+// 可安装的网页应用(PWA)：上传、下载和文本页面引用Web应用清单并注册Service Worker，
+// 手机可将页面添加到主屏幕；Service Worker只缓存离线页面及其样式和脚本，电脑上的服务未运行时代替页面显示。
+// 浏览器只在HTTPS（证书受信任）或localhost下注册Service Worker，HTTP下仍可添加主屏幕快捷方式
+const pwaThemeColor = "#4285f4"
+
+// appIcons 按边长缓存生成的应用图标
+var appIcons sync.Map
+
+// manifestHandler 返回Web应用清单
+func (s *Server) manifestHandler(w http.ResponseWriter, r *http.Request) {
+	type icon struct {
+		Src     string `json:"src"`
+		Sizes   string `json:"sizes"`
+		Type    string `json:"type"`
+		Purpose string `json:"purpose"`
+	}
+	name := "pair-gui"
+	if title := s.branding().Title; title != "" {
+		name = title
+	}
+	manifest := struct {
+		Name            string `json:"name"`
+		ShortName       string `json:"short_name"`
+		Lang            string `json:"lang"`
+		StartURL        string `json:"start_url"`
+		Scope           string `json:"scope"`
+		Display         string `json:"display"`
+		BackgroundColor string `json:"background_color"`
+		ThemeColor      string `json:"theme_color"`
+		Icons           []icon `json:"icons"`
+	}{
+		Name:            name,
+		ShortName:       name,
+		Lang:            webStrings(r)["HTMLLang"],
+		StartURL:        "./",
+		Scope:           "./",
+		Display:         "standalone",
+		BackgroundColor: "#ffffff",
+		ThemeColor:      s.accentColor(),
+	}
+	for _, size := range []int{192, 512} {
+		manifest.Icons = append(manifest.Icons, icon{
+			Src: fmt.Sprintf("icon-%d.png", size), Sizes: fmt.Sprintf("%dx%d", size, size),
+			Type: "image/png", Purpose: "any maskable",
+		})
+	}
+	w.Header().Set("Content-Type", "application/manifest+json")
+	json.NewEncoder(w).Encode(manifest)
+}
+
+// offlineAssets 离线页面引用的静态资源，由Service Worker一并缓存
+var offlineAssets = []string{"common.css", "theme.js", "offline.css"}
+
+// serviceWorkerHandler 返回Service Worker脚本，不缓存以便更新后及时生效。
+// 脚本前附加离线页面所需资源的地址，缓存名称取自这些地址，资源更新后旧缓存被清除
+func (s *Server) serviceWorkerHandler(w http.ResponseWriter, r *http.Request) {
+	urls := make([]string, len(offlineAssets))
+	for i, name := range offlineAssets {
+		urls[i] = assetURL(name)
+	}
+	list, _ := json.Marshal(urls)
+	sum := sha256.Sum256(list)
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprintf(w, "const CACHE = 'pair-gui-%x';\nconst OFFLINE_ASSETS = %s;\n\n", sum[:4], list)
+	w.Write(staticAssets["sw.js"].data)
+}
+
+// iconHandler 返回指定边长的应用图标
+func iconHandler(size int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, ok := appIcons.Load(size)
+		if !ok {
+			data, _ = appIcons.LoadOrStore(size, drawAppIcon(size))
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		w.Write(data.([]byte))
+	}
+}
+
+// drawAppIcon 绘制应用图标：蓝色背景上一上一下两个白色箭头，表示上传和下载。
+// 图形位于中央安全区内，可作为maskable图标裁剪为圆形
+func drawAppIcon(size int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	bg := color.RGBA{0x42, 0x85, 0xf4, 0xff}
+	u := float64(size) / 16
+	inArrow := func(x, y, cx, tail, head, tip float64) bool {
+		// 箭杆从tail到head，箭头三角形从head到tip，tip在上方或下方
+		lo, hi := min(tail, head), max(tail, head)
+		if y >= lo && y <= hi && x >= cx-0.9*u && x <= cx+0.9*u {
+			return true
+		}
+		lo, hi = min(head, tip), max(head, tip)
+		if y < lo || y > hi {
+			return false
+		}
+		half := 2.4 * u * (1 - (y-head)/(tip-head))
+		return x >= cx-half && x <= cx+half
+	}
+	for py := 0; py < size; py++ {
+		for px := 0; px < size; px++ {
+			x, y := float64(px)+0.5, float64(py)+0.5
+			c := bg
+			if inArrow(x, y, 5.6*u, 11.6*u, 7.2*u, 4.2*u) || inArrow(x, y, 10.4*u, 4.4*u, 8.8*u, 11.8*u) {
+				c = color.RGBA{0xff, 0xff, 0xff, 0xff}
+			}
+			img.SetRGBA(px, py, c)
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// offlineHandler 离线页面，由Service Worker缓存，电脑上的服务未运行时显示；
+// 定时检查服务是否恢复，恢复后自动回到上次访问的页面
+func (s *Server) offlineHandler(w http.ResponseWriter, r *http.Request) {
+	s.renderPage(w, http.StatusOK, "offline.html", struct{ T map[string]string }{T: webStrings(r)})
+}
@@ -0,0 +1,88 @@
+package pairserver
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// rateLimitedReader 按固定速率限制读取速度的Reader
+type rateLimitedReader struct {
+	ctx       context.Context
+	reader    io.Reader
+	bytesPerS int64
+	start     time.Time
+	total     int64
+}
+
+// newRateLimitedReader 创建限速Reader，limitKB为每秒KB数，<=0时不限速；
+// ctx结束(如客户端断开)后读取立即返回ctx.Err()，不再等待限速或继续读写磁盘
+func newRateLimitedReader(ctx context.Context, r io.Reader, limitKB int) io.Reader {
+	if limitKB <= 0 {
+		if ctx.Done() == nil {
+			return r
+		}
+		return contextReader{ctx, r}
+	}
+	return &rateLimitedReader{
+		ctx:       ctx,
+		reader:    r,
+		bytesPerS: int64(limitKB) * 1024,
+		start:     time.Now(),
+	}
+}
+
+// Read 实现io.Reader接口，读取过快时休眠以保持平均速率，休眠中ctx结束时立即返回
+func (l *rateLimitedReader) Read(p []byte) (int, error) {
+	if err := l.ctx.Err(); err != nil {
+		return 0, err
+	}
+	// 单次读取不超过每秒配额，避免突发流量
+	if int64(len(p)) > l.bytesPerS {
+		p = p[:l.bytesPerS]
+	}
+
+	n, err := l.reader.Read(p)
+	l.total += int64(n)
+
+	expected := time.Duration(float64(l.total) / float64(l.bytesPerS) * float64(time.Second))
+	if elapsed := time.Since(l.start); expected > elapsed {
+		timer := time.NewTimer(expected - elapsed)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-l.ctx.Done():
+			return n, l.ctx.Err()
+		}
+	}
+	return n, err
+}
+
+// contextReader ctx结束后读取返回ctx.Err()
+type contextReader struct {
+	ctx context.Context
+	io.Reader
+}
+
+// Read 实现io.Reader接口
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.Reader.Read(p)
+}
+
+// rateLimitedReadSeeker 支持Seek的限速Reader，用于http.ServeContent
+type rateLimitedReadSeeker struct {
+	io.Reader
+	io.Seeker
+}
+
+// newRateLimitedReadSeeker 创建支持Seek的限速Reader，limitKB<=0时不限速。
+// 不限速时原样返回rs以保留sendfile路径，客户端断开后写入失败即停止
+func newRateLimitedReadSeeker(ctx context.Context, rs io.ReadSeeker, limitKB int) io.ReadSeeker {
+	if limitKB <= 0 {
+		return rs
+	}
+	return rateLimitedReadSeeker{Reader: newRateLimitedReader(ctx, rs, limitKB), Seeker: rs}
+}
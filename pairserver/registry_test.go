@@ -0,0 +1,191 @@
+package pairserver
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 进度、传输和下载列表在处理请求的协程和界面之间共享，以下测试并发操作它们，需以-race运行
+
+// newRegistryServer 返回上传目录为临时目录、下载列表中有n个文件的服务
+func newRegistryServer(t *testing.T, n int) (*Server, http.Handler) {
+	t.Helper()
+	s := New()
+	s.SetUploadDir(t.TempDir())
+	dir := t.TempDir()
+	for i := range n {
+		p := filepath.Join(dir, fmt.Sprintf("file%d.bin", i))
+		if err := os.WriteFile(p, bytes.Repeat([]byte{byte(i)}, 64<<10), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.AddFile(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s, s.Handler()
+}
+
+// serve 向h发送请求，返回响应的状态码
+func serve(h http.Handler, r *http.Request) int {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+// TestProgressRegistryConcurrent 多个表单上传同时进行，期间查询进度
+func TestProgressRegistryConcurrent(t *testing.T) {
+	s, h := newRegistryServer(t, 0)
+
+	var wg, poller sync.WaitGroup
+	done := make(chan struct{})
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			fw, _ := mw.CreateFormFile("file", fmt.Sprintf("upload%d.bin", i))
+			fw.Write(bytes.Repeat([]byte("x"), 256<<10))
+			mw.Close()
+			r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/upload?uploadId=u%d", i), &body)
+			r.Header.Set("Content-Type", mw.FormDataContentType())
+			if code := serve(h, r); code != http.StatusOK {
+				t.Errorf("上传%d返回 %d", i, code)
+			}
+		}()
+	}
+	poller.Add(1)
+	go func() {
+		defer poller.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			for _, u := range s.Uploads() {
+				s.Upload(u.ID)
+			}
+			serve(h, httptest.NewRequest(http.MethodGet, "/progress?uploadId=u0", nil))
+		}
+	}()
+	wg.Wait()
+	close(done)
+	poller.Wait()
+
+	if list := s.Uploads(); len(list) != 0 {
+		t.Errorf("上传结束后仍有进度记录: %v", list)
+	}
+	entries, _ := os.ReadDir(s.UploadDir())
+	if len(entries) != 8 {
+		t.Errorf("保存了 %d 个文件，应为8个", len(entries))
+	}
+}
+
+// TestTransferRegistryConcurrent 多个下载同时进行，界面定期查询速度，另一个协程（如管理接口）同时取消传输。
+// 限速使下载持续超过速度的采样间隔；另登记一个取消后仍在收尾的传输，如阻塞在写入中的FTP传输
+func TestTransferRegistryConcurrent(t *testing.T) {
+	s, h := newRegistryServer(t, 4)
+	s.SetRateLimit(64)
+
+	var wg sync.WaitGroup
+	for i := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// 被取消的下载以http.ErrAbortHandler中止
+			defer func() {
+				if err := recover(); err != nil && err != http.ErrAbortHandler {
+					t.Error(err)
+				}
+			}()
+			serve(h, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/download?file=file%d.bin", i%4), nil))
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		tr := s.beginTransfer(TransferUpload, "slow.bin", "192.0.2.2", 1<<20)
+		defer s.endTransfer(tr)
+		for range 60 {
+			tr.add(1024)
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+
+	done := make(chan struct{})
+	var pollers sync.WaitGroup
+	for i := range 2 {
+		pollers.Add(1)
+		go func() {
+			defer pollers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for _, tr := range s.Transfers() {
+					tr.Percent()
+					tr.ETA()
+					if i == 1 && (tr.Filename == "file0.bin" || tr.Filename == "slow.bin") && tr.Speed > 0 {
+						s.CancelTransfer(tr.ID)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	pollers.Wait()
+
+	if list := s.Transfers(); len(list) != 0 {
+		t.Errorf("传输结束后仍有登记: %v", list)
+	}
+}
+
+// TestFileRegistryConcurrent 下载的同时增删下载列表中的文件
+func TestFileRegistryConcurrent(t *testing.T) {
+	s, h := newRegistryServer(t, 4)
+	extra := filepath.Join(t.TempDir(), "extra.bin")
+	if err := os.WriteFile(extra, []byte("extra"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				if _, err := s.AddFile(extra); err != nil {
+					t.Error(err)
+				}
+				s.Files()
+				s.RemoveFile(extra)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 5 {
+				if code := serve(h, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/download?file=file%d.bin", i%4), nil)); code != http.StatusOK {
+					t.Errorf("下载返回 %d", code)
+				}
+				serve(h, httptest.NewRequest(http.MethodGet, "/download-page", nil))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if files := s.Files(); len(files) != 4 {
+		t.Errorf("下载列表中有 %d 个文件，应为4个", len(files))
+	}
+}
@@ -0,0 +1,232 @@
+package pairserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 简单的按偏移续传：比tus少了创建上传的步骤，适合curl等脚本。
+// HEAD /upload-status?name=文件名&size=总大小[&id=上传ID] 返回已接收的字节数(Upload-Offset响应头)，
+// 没有id时分配新的上传ID(Upload-ID响应头)；
+// POST /upload?name=文件名&size=总大小&id=上传ID&offset=已接收字节数 以原始请求体追加剩余数据，
+// 接收完整后按重名策略保存到上传目录。未完成的数据按上传ID保存在partialDir中，断开后可凭ID继续追加，
+// 从0开始上传时请用户确认，其他客户端不知道ID，无法向已确认的上传追加数据
+
+// resumeLocks 同一上传同时只允许一个追加请求
+var resumeLocks lockMap
+
+// lockMap 按键加锁，没有请求等待时删除该键的锁
+type lockMap struct {
+	mu    sync.Mutex
+	locks map[string]*refLock
+}
+
+// refLock 带引用计数的锁，refs为持有和等待该锁的请求数
+type refLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock 锁定key，返回解锁函数
+func (m *lockMap) lock(key string) (unlock func()) {
+	m.mu.Lock()
+	if m.locks == nil {
+		m.locks = make(map[string]*refLock)
+	}
+	l := m.locks[key]
+	if l == nil {
+		l = &refLock{}
+		m.locks[key] = l
+	}
+	l.refs++
+	m.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if l.refs--; l.refs == 0 {
+			delete(m.locks, key)
+		}
+	}
+}
+
+// resumeParams 解析续传请求的文件名、总大小和上传ID，id为空表示新的上传
+func resumeParams(r *http.Request) (name string, size int64, id string, err error) {
+	if r.URL.Query().Get("name") == "" {
+		return "", 0, "", errors.New("缺少name参数")
+	}
+	name = sanitizeFilename(r.URL.Query().Get("name"))
+	size, err = strconv.ParseInt(r.URL.Query().Get("size"), 10, 64)
+	if err != nil || size < 0 {
+		return "", 0, "", errors.New("缺少或无效的size参数")
+	}
+	// 上传ID由newSessionID分配，为32个十六进制字符
+	id = r.URL.Query().Get("id")
+	if id != "" && (len(id) != 32 || strings.Trim(id, "0123456789abcdef") != "") {
+		return "", 0, "", errors.New("无效的id参数")
+	}
+	return name, size, id, nil
+}
+
+// resumePartPath 返回续传数据的临时文件路径，由上传ID、文件名和总大小确定，断开后凭ID重新请求时可以找到
+func resumePartPath(dir, id, name string, size int64) string {
+	sum := sha256.Sum256([]byte(id + "\x00" + name + "\x00" + strconv.FormatInt(size, 10)))
+	return filepath.Join(dir, partialDir, "resume-"+hex.EncodeToString(sum[:8])+".part")
+}
+
+// partOffset 返回临时文件中已接收的字节数，文件不存在时为0；超过partialExpiry未写入的文件删除后从0开始
+func partOffset(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	if time.Since(info.ModTime()) > partialExpiry {
+		os.Remove(path)
+		return 0
+	}
+	return info.Size()
+}
+
+// uploadStatusHandler 查询续传文件已接收的字节数，结果在Upload-Offset响应头中
+func (s *Server) uploadStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodHead && r.Method != http.MethodGet {
+		http.Error(w, "仅支持HEAD和GET方法", http.StatusMethodNotAllowed)
+		return
+	}
+	name, size, id, err := resumeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset := int64(0)
+	if id == "" {
+		id = newSessionID()
+	} else {
+		offset = partOffset(resumePartPath(s.UploadDir(), id, name, size))
+	}
+	w.Header().Set("Upload-ID", id)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// resumeUpload 从offset开始追加文件数据，offset与已接收的字节数不一致时返回409和正确的Upload-Offset；
+// 没有上传ID时只能从0开始，并在Upload-ID响应头中返回分配的ID
+func (s *Server) resumeUpload(w http.ResponseWriter, r *http.Request) {
+	name, size, id, err := resumeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil || offset < 0 || offset > size {
+		http.Error(w, "无效的offset参数", http.StatusBadRequest)
+		return
+	}
+	if limit := s.MaxUploadSize(); limit > 0 && size > limit {
+		writeTooLarge(w, r, limit)
+		return
+	}
+	if s.rejectsExisting(s.UploadDir(), name) {
+		http.Error(w, fmt.Sprintf("文件已存在: %s", name), http.StatusConflict)
+		return
+	}
+
+	if id == "" {
+		id = newSessionID()
+	}
+	w.Header().Set("Upload-ID", id)
+
+	dir := s.UploadDir()
+	part := resumePartPath(dir, id, name, size)
+	defer resumeLocks.lock(part)()
+
+	current := partOffset(part)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(current, 10))
+	if offset != current {
+		http.Error(w, "offset与已接收的字节数不一致", http.StatusConflict)
+		return
+	}
+	// 只在开始上传时确认，续传时凭上传ID找到已确认的数据，不再重复询问
+	if offset == 0 && !s.approveRequest(r, name, size) {
+		writeUploadDenied(w, r)
+		return
+	}
+	if !ensureSpace(w, r, dir, size-offset) {
+		return
+	}
+	if err := os.MkdirAll(filepath.Join(dir, partialDir), 0o755); err != nil {
+		http.Error(w, fmt.Sprintf("创建临时目录失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("打开文件失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	progress := &UploadProgress{TotalSize: size, Uploaded: offset}
+	if id := r.URL.Query().Get("uploadId"); id != "" {
+		s.progress.add(id, progress)
+		defer s.progress.remove(id)
+	}
+	t := requestTransfer(r)
+	if t != nil {
+		t.describe(name, size, offset)
+	}
+	n, copyErr := io.Copy(f, &ProgressReader{
+		Reader:   io.LimitReader(newRateLimitedReader(r.Context(), r.Body, s.RateLimit()), size-offset),
+		Progress: progress,
+	})
+	f.Close()
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset+n, 10))
+	if offset+n < size && t != nil {
+		t.setPartial()
+	}
+	// 在界面中取消的上传删除已接收的部分，其他错误保留以便续传
+	if t != nil && t.canceled() {
+		os.Remove(part)
+		writeUploadError(w, http.StatusGone, uploadError{Error: webStrings(r)["UploadCanceled"]})
+		return
+	}
+	if copyErr != nil {
+		http.Error(w, fmt.Sprintf("保存文件失败: %v", copyErr), http.StatusInternalServerError)
+		return
+	}
+	if offset+n < size {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var saved string
+	err = s.saveAs(dir, name, func(path string) error {
+		saved = path
+		return os.Rename(part, path)
+	})
+	if errors.Is(err, ErrFileExists) {
+		os.Remove(part)
+		http.Error(w, fmt.Sprintf("文件已存在: %s", name), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("保存文件失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	setRequestFile(r, saved)
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "文件上传成功: %s", filepath.Base(saved))
+}
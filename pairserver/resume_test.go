@@ -0,0 +1,115 @@
+package pairserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resumePost 以offset续传body，返回响应
+func resumePost(h http.Handler, query, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/upload?"+query, strings.NewReader(body)))
+	return w
+}
+
+// TestResumeUploadID 续传的数据按服务器分配的上传ID保存：不知道ID的客户端无法向已确认的上传追加数据，
+// 凭ID续传时不再询问；超过期限未写入的数据删除后从0开始
+func TestResumeUploadID(t *testing.T) {
+	s, h := newRegistryServer(t, 0)
+	s.SetUploadApproval(true)
+	var asked atomic.Int32
+	s.SetUploadApprover(func(UploadRequest) (bool, bool) {
+		asked.Add(1)
+		return true, false
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/upload-status?name=a.txt&size=6", nil))
+	id := w.Header().Get("Upload-ID")
+	if len(id) != 32 || w.Header().Get("Upload-Offset") != "0" {
+		t.Fatalf("查询新上传返回ID %q，偏移 %q", id, w.Header().Get("Upload-Offset"))
+	}
+	if w := resumePost(h, "name=a.txt&size=6&offset=0&id="+id, "abc"); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "3" {
+		t.Fatalf("上传前半部分返回 %d，偏移 %q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+
+	// 没有ID或ID不同时找不到已接收的数据
+	for _, query := range []string{"name=a.txt&size=6&offset=3", "name=a.txt&size=6&offset=3&id=" + strings.Repeat("0", 32)} {
+		if w := resumePost(h, query, "def"); w.Code != http.StatusConflict || w.Header().Get("Upload-Offset") != "0" {
+			t.Errorf("%s 返回 %d，偏移 %q，应为409和0", query, w.Code, w.Header().Get("Upload-Offset"))
+		}
+	}
+	if w := resumePost(h, "name=a.txt&size=6&offset=0&id=../x", "abc"); w.Code != http.StatusBadRequest {
+		t.Errorf("无效的ID返回 %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/upload-status?name=a.txt&size=6&id="+id, nil))
+	if w.Header().Get("Upload-Offset") != "3" {
+		t.Errorf("查询已接收的字节数为 %q，应为3", w.Header().Get("Upload-Offset"))
+	}
+	if w := resumePost(h, "name=a.txt&size=6&offset=3&id="+id, "def"); w.Code != http.StatusOK {
+		t.Fatalf("续传返回 %d", w.Code)
+	}
+	if n := asked.Load(); n != 1 {
+		t.Errorf("询问了%d次，应只在开始上传时询问一次", n)
+	}
+	if data, _ := os.ReadFile(filepath.Join(s.UploadDir(), "a.txt")); string(data) != "abcdef" {
+		t.Errorf("保存的内容为 %q", data)
+	}
+	resumeLocks.mu.Lock()
+	if n := len(resumeLocks.locks); n != 0 {
+		t.Errorf("请求结束后仍有%d个锁", n)
+	}
+	resumeLocks.mu.Unlock()
+
+	// 过期的数据
+	w = resumePost(h, "name=b.txt&size=6&offset=0", "abc")
+	id = w.Header().Get("Upload-ID")
+	part := resumePartPath(s.UploadDir(), id, "b.txt", 6)
+	old := time.Now().Add(-partialExpiry - time.Hour)
+	if err := os.Chtimes(part, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if w := resumePost(h, "name=b.txt&size=6&offset=3&id="+id, "def"); w.Code != http.StatusConflict || w.Header().Get("Upload-Offset") != "0" {
+		t.Errorf("续传过期的数据返回 %d，偏移 %q，应为409和0", w.Code, w.Header().Get("Upload-Offset"))
+	}
+	if _, err := os.Stat(part); !os.IsNotExist(err) {
+		t.Error("过期的数据应被删除")
+	}
+}
+
+// TestLockMap 等待同一个锁的请求都结束后才删除该锁
+func TestLockMap(t *testing.T) {
+	var m lockMap
+	unlock := m.lock("a")
+	locked := make(chan func())
+	go func() { locked <- m.lock("a") }()
+	// 等待第二个请求开始等待
+	for {
+		m.mu.Lock()
+		refs := m.locks["a"].refs
+		m.mu.Unlock()
+		if refs == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	unlock()
+	second := <-locked
+	m.mu.Lock()
+	if m.locks["a"] == nil {
+		t.Error("仍有请求持有锁时删除了锁")
+	}
+	m.mu.Unlock()
+	second()
+	if len(m.locks) != 0 {
+		t.Errorf("所有请求结束后仍有%d个锁", len(m.locks))
+	}
+}
@@ -0,0 +1,85 @@
+package pairserver
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxFilenameBytes 文件名的最大字节数，多数文件系统限制为255字节
+const maxFilenameBytes = 255
+
+// defaultFilename 清理后文件名为空时使用的名字
+const defaultFilename = "unnamed"
+
+// windowsReserved Windows保留的设备名，不区分大小写，带扩展名也不可用；
+// COM和LPT后的数字还包括0以及上标的¹²³
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true, "CONIN$": true, "CONOUT$": true,
+	"COM0": true, "COM1": true, "COM2": true, "COM3": true, "COM4": true,
+	"COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"COM¹": true, "COM²": true, "COM³": true,
+	"LPT0": true, "LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true,
+	"LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+	"LPT¹": true, "LPT²": true, "LPT³": true,
+}
+
+// sanitizeFilename 将客户端提供的文件名清理为可以安全写入任意平台磁盘的名字：
+//   - 去掉路径部分（同时处理/和\分隔符）
+//   - 替换无效的UTF-8、控制字符以及Windows不允许的 <>:"/\|?* 字符
+//   - Unicode规范化为NFC，避免同一名字在不同系统上显示相同而字节不同
+//   - 去掉开头的点和空格（隐藏文件、..）以及结尾的点和空格（Windows会忽略）
+//   - Windows保留设备名前加下划线，如 CON.txt 变为 _CON.txt
+//   - 超长的名字在保留扩展名的前提下截断到255字节
+func sanitizeFilename(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = norm.NFC.String(strings.ToValidUTF8(name, "_"))
+
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	name = strings.TrimLeft(name, ". ")
+	name = strings.TrimRight(name, ". ")
+	if name == "" {
+		return defaultFilename
+	}
+
+	stem, _, _ := strings.Cut(name, ".")
+	if windowsReserved[strings.ToUpper(strings.TrimRight(stem, " "))] {
+		name = "_" + name
+	}
+
+	return truncateFilename(name, maxFilenameBytes)
+}
+
+// truncateFilename 将文件名截断到max字节以内，尽量保留扩展名，且不截断多字节字符
+func truncateFilename(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+
+	ext := ""
+	if i := strings.LastIndex(name, "."); i > 0 && len(name)-i <= max/4 {
+		ext = name[i:]
+	}
+	return truncateUTF8(name[:len(name)-len(ext)], max-len(ext)) + ext
+}
+
+// truncateUTF8 将s截断到n字节以内，不截断多字节字符
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
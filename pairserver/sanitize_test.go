@@ -0,0 +1,78 @@
+package pairserver
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// TestSanitizeFilename 客户端提供的文件名清理后可安全写入任意平台
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"照片 2024.jpg", "照片 2024.jpg"},
+		{"../../etc/passwd", "passwd"},
+		{`..\..\Windows\win.ini`, "win.ini"},
+		{"C:\\Users\\a\\b.txt", "b.txt"},
+		{"dir/", defaultFilename},
+		{"", defaultFilename},
+		{"..", defaultFilename},
+		{". .", defaultFilename},
+		{".bashrc", "bashrc"},
+		{"name. . ", "name"},
+		{`a<b>c:d"e|f?g*h.txt`, "a_b_c_d_e_f_g_h.txt"},
+		{"tab\there\x00nul\x7f.txt", "tab_here_nul_.txt"},
+		{"bad\xffutf8.txt", "bad_utf8.txt"},
+		{"cafe\u0301.txt", "caf\u00e9.txt"},
+		{"CON", "_CON"},
+		{"con.txt", "_con.txt"},
+		{"Nul.tar.gz", "_Nul.tar.gz"},
+		{"AUX .txt", "_AUX .txt"},
+		{"COM0", "_COM0"},
+		{"com9.log", "_com9.log"},
+		{"LPT0.txt", "_LPT0.txt"},
+		{"COM¹", "_COM¹"},
+		{"com².txt", "_com².txt"},
+		{"LPT³.dat", "_LPT³.dat"},
+		{"CONIN$", "_CONIN$"},
+		{"conout$.txt", "_conout$.txt"},
+		{"COM10", "COM10"},
+		{"LPT", "LPT"},
+		{"CONSOLE.txt", "CONSOLE.txt"},
+		{"my.con", "my.con"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeFilename(tt.name); got != tt.want {
+			t.Errorf("sanitizeFilename(%q) = %q，应为 %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestSanitizeFilenameLength 超长的文件名截断到255字节，保留扩展名且不截断多字节字符
+func TestSanitizeFilenameLength(t *testing.T) {
+	tests := []struct {
+		name, ext string
+	}{
+		{strings.Repeat("a", 300) + ".txt", ".txt"},
+		{strings.Repeat("文", 100) + ".docx", ".docx"},
+		{strings.Repeat("😀", 80) + ".png", ".png"},
+		{strings.Repeat("a", 300) + "." + strings.Repeat("x", 100), ""},
+	}
+	for _, tt := range tests {
+		got := sanitizeFilename(tt.name)
+		if len(got) > maxFilenameBytes {
+			t.Errorf("%d字节的文件名清理后为%d字节", len(tt.name), len(got))
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("截断后不是有效的UTF-8: %q", got)
+		}
+		if !strings.HasSuffix(got, tt.ext) {
+			t.Errorf("截断后丢失扩展名%s: %q", tt.ext, got)
+		}
+	}
+	if got := sanitizeFilename(strings.Repeat("a", 255)); len(got) != 255 {
+		t.Errorf("255字节的文件名不应被截断，实际为%d字节", len(got))
+	}
+}
@@ -0,0 +1,350 @@
+// Package pairserver 提供手机与电脑之间互传文件的HTTP服务，包括上传页面、
+// 下载列表、上传进度查询以及服务的启动和停止，可嵌入图形界面或命令行程序使用。
+package pairserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNotRunning 服务未运行
+var ErrNotRunning = errors.New("服务未运行")
+
+// Server 文件传输服务
+type Server struct {
+	mu         sync.RWMutex
+	files      []File             // 待下载文件列表
+	dirs       []SharedDir        // 共享目录列表
+	progress   progressStore      // 表单上传的进度
+	uploadDir  string             // 上传文件保存目录
+	rateLimit  int                // 传输限速(KB/s)，0表示不限速
+	httpServer *http.Server       // HTTP服务实例
+	port       int                // 当前监听端口
+	tlsCert    *tls.Certificate   // HTTPS证书，nil表示使用HTTP
+	active     atomic.Int64       // 正在进行的上传/下载数量
+	transfers  transferRegistry   // 进行中的上传和下载，供界面显示
+	auth       authState          // 访问控制状态
+	approval   approvalState      // 接收上传前的确认
+	ipFilter   ipFilter           // 客户端IP访问控制
+	clients    clientRegistry     // 客户端的名称和传输记录
+	tus        tusStore           // 可续传上传
+	thumbs     thumbCache         // 缩略图缓存
+	hashes     hashCache          // 文件SHA-256缓存
+	snippets   snippetStore       // 手机与电脑之间传递的文本
+	clipboard  clipboardState     // 同步的剪贴板内容
+	push       pushState          // 其他设备直接发送文件的会话
+	mdnsName   string             // mDNS广播的主机名，空表示不广播
+	mdns       *mdnsResponder     // 运行中的mDNS广播，nil表示未广播
+	discovery  *discovery         // 局域网设备发现，nil表示未启动
+	folderSync *folderSync        // 与附近设备的文件夹同步，nil表示未启动
+	webPush    webPushState       // 浏览器的推送通知订阅
+	pages      *template.Template // 网页模板
+	brand      brandState         // 网页的品牌定制
+	prefix     string             // 网页的路径前缀，空表示不使用前缀
+	portMap    *activeMapping     // 路由器上的端口映射，nil表示未映射
+	onion      *onionService      // Tor洋葱服务，nil表示未创建
+	dav        davState           // WebDAV服务
+	ftpPort    int                // FTP服务端口，0表示不提供FTP
+	ftp        *ftpServer         // 运行中的FTP服务，nil表示未启动
+	dlnaName   string             // DLNA媒体服务器名称，空表示不提供DLNA
+	dlna       *dlnaServer        // 运行中的DLNA媒体服务器，nil表示未启动
+	history    *History           // 保存的传输记录，nil表示不记录
+	api        apiState           // 管理接口
+	events     eventHub           // 事件的订阅者
+	webhooks   []string           // 传输完成时通知的Webhook地址
+
+	maxUploadSize   int64           // 单次上传的最大字节数，0表示不限制
+	conflictPolicy  ConflictPolicy  // 上传文件重名时的处理方式
+	conflictHandler ConflictHandler // 询问重名处理方式的回调
+	saveMu          sync.Mutex      // 保存上传文件时确定文件名的锁
+	peersHandler    PeersHandler    // 附近设备列表变化时的回调
+	postReceive     string          // 上传完成后执行的命令，空表示不执行
+	postReceiveMu   sync.Mutex      // 依次执行接收后命令的锁
+	oneShot         oneShotState    // 一次性分享
+	shareExpiry     time.Time       // 整个分享的过期时间，零值表示不过期
+	filePass        filePassState   // 文件密码的解锁状态
+	signingKey      []byte          // 签名下载链接和CSRF令牌的密钥，首次使用时生成
+	basicUser       string          // HTTP基本认证的用户名
+	basicPass       string          // HTTP基本认证的密码，空表示不启用
+	accessLog       accessLog       // 请求日志
+	useHTTP3        bool            // 启用HTTPS时同时提供HTTP/3监听
+	h3              *http3Server    // 运行中的HTTP/3监听，nil表示未启动
+	sweepDone       chan struct{}   // 关闭时停止清理过期的上传，nil表示未在清理
+	timeouts        timeouts        // HTTP服务的超时设置
+}
+
+// New 创建文件传输服务，上传文件默认保存到当前目录
+func New() *Server {
+	s := &Server{
+		uploadDir:      ".",
+		conflictPolicy: ConflictRename,
+		timeouts:       timeouts{readHeader: DefaultReadHeaderTimeout, idle: DefaultIdleTimeout, stall: DefaultStallTimeout},
+	}
+	pages, err := s.parseTemplates("")
+	if err != nil {
+		panic(fmt.Sprintf("解析内置模板失败: %v", err))
+	}
+	s.pages = pages
+	return s
+}
+
+// Start 在指定端口启动HTTP服务，已在运行的服务会先停止
+func (s *Server) Start(port int) error {
+	if err := s.Stop(); err != nil && err != ErrNotRunning {
+		log.Printf("停止原有服务失败: %v", err)
+	}
+
+	addr := fmt.Sprintf(":%d", port)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.resetToken()
+	s.resetWordCode()
+	s.resetTrusted()
+	s.resetServed()
+	handler := s.Handler()
+	server := &http.Server{Addr: addr, Handler: s.advertiseHTTP3(handler), Protocols: serverProtocols(), ConnContext: onionConnContext}
+	s.applyTimeouts(server)
+	s.mu.Lock()
+	s.httpServer = server
+	s.port = port
+	if s.tlsCert != nil {
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{*s.tlsCert}}
+	}
+	s.mu.Unlock()
+	s.startMDNS()
+	s.startFTP()
+	s.startDLNA()
+	s.startHTTP3(port, handler)
+	s.startSweep()
+
+	go func() {
+		log.Printf("服务启动成功: %s", addr)
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ServeTLS(ln, "", "")
+		} else {
+			err = server.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Printf("服务运行失败: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Stop 立即停止HTTP服务，服务未运行时返回ErrNotRunning
+func (s *Server) Stop() error {
+	s.stopMDNS()
+	s.unmapPort()
+	s.stopOnion()
+	s.stopFTP()
+	s.stopDLNA()
+	s.stopHTTP3()
+	s.stopSweep()
+	s.closePages()
+	s.mu.Lock()
+	server := s.httpServer
+	s.httpServer = nil
+	s.mu.Unlock()
+
+	if server == nil {
+		return ErrNotRunning
+	}
+	return server.Close()
+}
+
+// Shutdown 停止接受新连接并等待正在进行的传输完成；ctx结束时强制关闭剩余连接并返回ctx的错误
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopMDNS()
+	s.unmapPort()
+	s.stopOnion()
+	s.stopFTP()
+	s.stopDLNA()
+	s.stopHTTP3()
+	s.stopSweep()
+	s.closePages()
+	s.mu.Lock()
+	server := s.httpServer
+	s.httpServer = nil
+	s.mu.Unlock()
+
+	if server == nil {
+		return ErrNotRunning
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
+		return err
+	}
+	return nil
+}
+
+// ActiveTransfers 返回正在进行的上传/下载数量
+func (s *Server) ActiveTransfers() int {
+	return int(s.active.Load())
+}
+
+// serverProtocols 返回服务支持的协议：HTTP/1.1、HTTPS下的HTTP/2，以及明文HTTP/2（h2c），
+// 支持h2c的客户端可在一个连接上同时下载多个文件；WebSocket仍使用HTTP/1.1
+func serverProtocols() *http.Protocols {
+	p := new(http.Protocols)
+	p.SetHTTP1(true)
+	p.SetHTTP2(true)
+	p.SetUnencryptedHTTP2(true)
+	return p
+}
+
+// Running 返回服务是否正在运行
+func (s *Server) Running() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.httpServer != nil
+}
+
+// URL 动态生成不同页面的URL：有下载文件时为下载列表页面，只有共享目录时为浏览页面，否则为上传页面；
+// 启用访问令牌时附带令牌参数
+func (s *Server) URL(host string) string {
+	s.mu.RLock()
+	port := s.port
+	s.mu.RUnlock()
+	return s.urlFor(host, port)
+}
+
+// urlFor 生成指定主机和端口的访问URL
+func (s *Server) urlFor(host string, port int) string {
+	s.mu.RLock()
+	scheme := "http"
+	if s.tlsCert != nil {
+		scheme = "https"
+	}
+	s.mu.RUnlock()
+
+	return fmt.Sprintf("%s://%s%s", scheme, HostPort(host, port), s.sitePath(s.entryPath()))
+}
+
+// entryPath 返回二维码指向的页面路径（不含路径前缀），启用访问令牌时附带令牌参数
+func (s *Server) entryPath() string {
+	path := "/"
+	if len(s.activeFiles()) > 0 {
+		path = "/download-page"
+	} else if len(s.Dirs()) > 0 {
+		path = "/browse"
+	}
+	if token := s.Token(); token != "" {
+		path += "?token=" + token
+	}
+	return path
+}
+
+// SetTLSCert 设置HTTPS证书，nil表示使用HTTP，下次启动服务时生效
+func (s *Server) SetTLSCert(cert *tls.Certificate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tlsCert = cert
+}
+
+// SetUploadDir 设置上传文件保存目录
+func (s *Server) SetUploadDir(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.uploadDir = dir
+}
+
+// UploadDir 返回上传文件保存目录
+func (s *Server) UploadDir() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.uploadDir
+}
+
+// SetRateLimit 设置上传/下载限速(KB/s)，<=0表示不限速
+func (s *Server) SetRateLimit(limitKB int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rateLimit = limitKB
+}
+
+// RateLimit 返回当前的传输限速(KB/s)
+func (s *Server) RateLimit() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.rateLimit
+}
+
+// Handler 创建注册了全部路由的ServeMux，每次调用返回独立的实例，
+// 便于同时运行多个服务或嵌入到其他HTTP服务中
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	protect := func(h http.HandlerFunc, page bool) http.HandlerFunc {
+		return s.requireUnexpired(s.allowSigned(h, s.requireToken(s.requireAuth(h, page))))
+	}
+	mux.HandleFunc("/", protect(compress(s.indexHandler), true))                                           // 上传页面
+	mux.HandleFunc("/upload", protect(s.trackTransfer(s.uploadHandler), false))                            // 上传接口
+	mux.HandleFunc("/upload-status", protect(s.uploadStatusHandler, false))                                // 按偏移续传时查询已接收的字节数
+	mux.HandleFunc("/progress", protect(s.progressHandler, false))                                         // 进度查询接口
+	mux.HandleFunc("/download", protect(compress(s.trackTransfer(s.downloadHandler)), false))              // 下载接口
+	mux.HandleFunc("/checksum", protect(s.checksumHandler, false))                                         // 文件SHA-256接口
+	mux.HandleFunc("/SHA256SUMS", protect(compress(s.sha256SumsHandler), false))                           // 全部文件的校验和清单
+	mux.HandleFunc("/thumb", protect(s.thumbHandler, false))                                               // 缩略图接口
+	mux.HandleFunc("/qr", protect(s.fileQRHandler, false))                                                 // 单个文件的下载二维码
+	mux.HandleFunc("/view", protect(compress(s.trackTransfer(s.viewHandler)), false))                      // 在线预览接口
+	mux.HandleFunc("/download-all", protect(s.trackTransfer(s.downloadAllHandler), false))                 // 打包下载全部文件
+	mux.HandleFunc("/download-selected", protect(s.trackTransfer(s.downloadSelectedHandler), false))       // 打包下载选中文件
+	mux.HandleFunc("/download-page", protect(compress(s.downloadListHandler), true))                       // 下载列表页面
+	mux.HandleFunc("/gallery", protect(compress(s.galleryHandler), true))                                  // 相册页面
+	mux.HandleFunc("/browse", protect(compress(s.browseHandler), true))                                    // 共享目录浏览页面
+	mux.HandleFunc("/browse-download", protect(compress(s.trackTransfer(s.browseDownloadHandler)), false)) // 共享目录文件下载接口
+	mux.HandleFunc("/text-page", protect(compress(s.textPageHandler), true))                               // 文本传输页面
+	mux.HandleFunc("/manifest.webmanifest", s.manifestHandler)                                             // Web应用清单，浏览器获取时不带Cookie，无需令牌
+	mux.HandleFunc("/sw.js", s.serviceWorkerHandler)                                                       // Service Worker脚本
+	mux.HandleFunc("/offline", s.offlineHandler)                                                           // 电脑未运行时显示的离线页面
+	mux.HandleFunc("/icon-192.png", iconHandler(192))                                                      // 应用图标
+	mux.HandleFunc("/icon-512.png", iconHandler(512))
+	mux.HandleFunc("/static/", compress(staticHandler))                                       // 页面的样式和脚本
+	mux.HandleFunc("/favicon.ico", iconHandler(32))                                           // 网站图标
+	mux.HandleFunc("/brand-logo", s.brandLogoHandler)                                         // 品牌Logo，PIN码页面也会显示
+	mux.HandleFunc("/webpush/key", protect(s.webPushKeyHandler, false))                       // 推送通知的VAPID公钥
+	mux.HandleFunc("/webpush/subscribe", protect(s.webPushSubscribeHandler, false))           // 保存或删除推送订阅
+	mux.HandleFunc("/text", protect(s.textHandler, false))                                    // 文本收发接口
+	mux.HandleFunc("/clipboard", protect(s.clipboardHandler, false))                          // 剪贴板同步接口
+	mux.HandleFunc("/device-name", protect(s.deviceNameHandler, false))                       // 手机设置自己的设备名称
+	mux.HandleFunc("/ws", protect(s.wsHandler(true).ServeHTTP, false))                        // 服务事件推送（WebSocket）
+	mux.HandleFunc("/pin", s.requireToken(s.pinHandler))                                      // PIN码验证接口
+	mux.HandleFunc(codePrefix, s.requireUnexpired(s.wordCodeHandler))                         // 配对码跳转，无需令牌
+	mux.HandleFunc("/file-unlock", protect(s.fileUnlockHandler, false))                       // 文件密码验证接口
+	mux.HandleFunc("/push/request", s.pushRequestHandler)                                     // 其他设备直接发送文件的请求
+	mux.HandleFunc("/push/file", s.trackTransfer(s.pushFileHandler))                          // 直接发送的文件上传接口
+	mux.HandleFunc("/push/signature", s.pushSignatureHandler)                                 // 直接发送时已有旧文件的块签名
+	mux.HandleFunc("/push/delta", s.trackTransfer(s.pushDeltaHandler))                        // 直接发送的增量上传接口
+	mux.HandleFunc("/sync/challenge", s.syncChallengeHandler)                                 // 文件夹同步的质询
+	mux.HandleFunc("/sync/verify", s.syncVerifyHandler)                                       // 文件夹同步的验证，双方以同步密钥互相证明
+	mux.HandleFunc("/sync/index", s.syncIndexHandler)                                         // 文件夹同步的文件清单
+	mux.HandleFunc("/sync/file", s.trackTransfer(s.syncFileHandler))                          // 文件夹同步的文件下载
+	mux.HandleFunc(localSendAPI+"info", s.localSendInfoHandler)                               // LocalSend设备信息
+	mux.HandleFunc(localSendAPI+"register", s.localSendRegisterHandler)                       // LocalSend设备注册
+	mux.HandleFunc(localSendAPI+"prepare-upload", s.localSendPrepareHandler)                  // LocalSend发送请求
+	mux.HandleFunc(localSendAPI+"upload", s.trackTransfer(s.localSendUploadHandler))          // LocalSend文件上传
+	mux.HandleFunc(localSendAPI+"cancel", s.localSendCancelHandler)                           // LocalSend取消发送
+	mux.HandleFunc(tusBasePath, protect(s.trackTransfer(s.tusHandler), false))                // 断点续传接口
+	mux.HandleFunc(dlnaPrefix, s.dlnaHandler)                                                 // DLNA媒体服务器，播放器无法输入PIN码
+	mux.HandleFunc(davPrefix, s.trackTransfer(s.davHandler))                                  // WebDAV，自行校验令牌和PIN码
+	pluginRoutes(mux, func(h http.HandlerFunc) http.HandlerFunc { return protect(h, false) }) // 插件提供的路由
+	return s.logRequests(s.stripPrefix(s.requireIP(s.requireBasicAuth(mux))))
+}
@@ -0,0 +1,239 @@
+package pairserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNotDir 指定的路径是文件而非目录
+var ErrNotDir = errors.New("请选择目录而非文件")
+
+// errOutsideShare 请求的路径不在共享目录内
+var errOutsideShare = errors.New("路径不在共享目录内")
+
+// SharedDir 共享目录，手机端可在浏览页面中逐级浏览并下载其中的文件
+type SharedDir struct {
+	Name    string // 显示名称，即浏览路径的第一级
+	AbsPath string // 绝对路径
+}
+
+// sharedEntry 浏览页面中的一项
+type sharedEntry struct {
+	Name   string // 文件或目录名
+	Path   string // 浏览路径，如 Photos/2024/a.jpg
+	IsDir  bool   // 是否为目录
+	SizeKB int64  // 文件大小(KB)
+}
+
+// breadcrumb 浏览页面的导航路径中的一级
+type breadcrumb struct {
+	Name string
+	Path string
+}
+
+// AddDir 校验并添加共享目录，已共享的目录返回已有记录；显示名称与已有目录重复时追加序号
+func (s *Server) AddDir(dir string) (SharedDir, error) {
+	absPath, err := filepath.Abs(dir)
+	if err != nil {
+		return SharedDir{}, err
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return SharedDir{}, err
+	}
+	if !info.IsDir() {
+		return SharedDir{}, ErrNotDir
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make(map[string]bool)
+	for _, d := range s.dirs {
+		if d.AbsPath == absPath {
+			return d, nil
+		}
+		names[d.Name] = true
+	}
+	d := SharedDir{Name: uniqueEntryName(names, filepath.Base(absPath)), AbsPath: absPath}
+	s.dirs = append(s.dirs, d)
+	s.publish(EventFilesChanged, nil)
+	return d, nil
+}
+
+// RemoveDir 移除共享目录
+func (s *Server) RemoveDir(absPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, d := range s.dirs {
+		if d.AbsPath == absPath {
+			s.dirs = append(s.dirs[:i], s.dirs[i+1:]...)
+			s.publish(EventFilesChanged, nil)
+			return
+		}
+	}
+}
+
+// ClearDirs 清空共享目录
+func (s *Server) ClearDirs() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dirs = nil
+	s.publish(EventFilesChanged, nil)
+}
+
+// Dirs 返回共享目录列表的副本
+func (s *Server) Dirs() []SharedDir {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]SharedDir(nil), s.dirs...)
+}
+
+// resolveShared 将浏览路径（共享目录名/相对路径）解析为磁盘上的绝对路径；
+// 路径先按URL规则清理去掉..，再解析符号链接，确保最终路径仍在对应的共享目录内
+func (s *Server) resolveShared(p string) (string, error) {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	name, rest, _ := strings.Cut(p, "/")
+
+	var root string
+	for _, d := range s.Dirs() {
+		if d.Name == name {
+			root = d.AbsPath
+			break
+		}
+	}
+	if root == "" {
+		return "", os.ErrNotExist
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	real, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(rest)))
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(realRoot, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errOutsideShare
+	}
+	return real, nil
+}
+
+// listShared 列出浏览路径对应目录的内容，目录在前，按名称排序；根路径列出全部共享目录
+func (s *Server) listShared(p string) ([]sharedEntry, error) {
+	if p == "" {
+		var entries []sharedEntry
+		for _, d := range s.Dirs() {
+			entries = append(entries, sharedEntry{Name: d.Name, Path: d.Name, IsDir: true})
+		}
+		return entries, nil
+	}
+
+	dir, err := s.resolveShared(p)
+	if err != nil {
+		return nil, err
+	}
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []sharedEntry
+	for _, e := range dirEntries {
+		info, err := os.Stat(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		entry := sharedEntry{Name: e.Name(), Path: p + "/" + e.Name(), IsDir: info.IsDir()}
+		if !entry.IsDir {
+			entry.SizeKB = (info.Size() + 1023) / 1024
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
+	})
+	return entries, nil
+}
+
+// breadcrumbs 返回浏览路径各级的导航链接
+func breadcrumbs(p string) []breadcrumb {
+	if p == "" {
+		return nil
+	}
+	var crumbs []breadcrumb
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		crumbs = append(crumbs, breadcrumb{Name: part, Path: strings.Join(parts[:i+1], "/")})
+	}
+	return crumbs
+}
+
+// browseHandler 共享目录浏览页面，path参数为共享目录名/相对路径，为空时列出全部共享目录
+func (s *Server) browseHandler(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(path.Clean("/"+r.URL.Query().Get("path")), "/")
+	entries, err := s.listShared(p)
+	if err != nil {
+		http.Error(w, "目录不存在", http.StatusNotFound)
+		return
+	}
+
+	data := struct {
+		T       map[string]string
+		Crumbs  []breadcrumb
+		Entries []sharedEntry
+	}{T: webStrings(r), Crumbs: breadcrumbs(p), Entries: entries}
+	s.renderPage(w, http.StatusOK, "browse.html", data)
+}
+
+// browseDownloadHandler 下载共享目录中的文件，路径限制在共享目录内
+func (s *Server) browseDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Query().Get("path")
+	if p == "" {
+		http.Error(w, "缺少path参数", http.StatusBadRequest)
+		return
+	}
+
+	absPath, err := s.resolveShared(p)
+	if err != nil {
+		http.Error(w, "文件不存在", http.StatusNotFound)
+		return
+	}
+
+	file, err := os.Open(absPath)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("打开文件失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("读取文件信息失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if fileInfo.IsDir() {
+		http.Error(w, "请选择文件而非目录", http.StatusBadRequest)
+		return
+	}
+
+	name := path.Base(p)
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", name))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	setRequestFile(r, absPath)
+	http.ServeContent(w, r, name, fileInfo.ModTime(), newRateLimitedReadSeeker(r.Context(), file, s.RateLimit()))
+}
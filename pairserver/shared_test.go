@@ -0,0 +1,83 @@
+package pairserver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestResolveShared 浏览路径只能解析到共享目录内：..、绝对路径和指向目录外的符号链接都被拒绝
+func TestResolveShared(t *testing.T) {
+	tmp := t.TempDir()
+	outside := filepath.Join(tmp, "outside")
+	root := filepath.Join(tmp, "share")
+	for _, dir := range []string{outside, filepath.Join(root, "sub")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []string{filepath.Join(outside, "secret.txt"), filepath.Join(root, "a.txt"), filepath.Join(root, "sub", "b.txt")} {
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"out":     outside,
+		"outfile": filepath.Join(outside, "secret.txt"),
+		"up":      "..",
+		"inlink":  "sub",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("无法创建符号链接: %v", err)
+		}
+	}
+
+	s := New()
+	d, err := s.AddDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want string // 相对于共享目录的结果，空表示应失败
+		err  error
+	}{
+		{d.Name, ".", nil},
+		{d.Name + "/", ".", nil},
+		{d.Name + "/a.txt", "a.txt", nil},
+		{"/" + d.Name + "/a.txt", "a.txt", nil},
+		{d.Name + "/sub/../a.txt", "a.txt", nil},
+		{d.Name + "/../" + d.Name + "/a.txt", "a.txt", nil},
+		{d.Name + "/inlink/b.txt", filepath.Join("sub", "b.txt"), nil},
+		{"", "", os.ErrNotExist},
+		{"..", "", os.ErrNotExist},
+		{d.Name + "/../outside/secret.txt", "", os.ErrNotExist},
+		{d.Name + "/../../../etc/passwd", "", os.ErrNotExist},
+		{filepath.ToSlash(outside), "", os.ErrNotExist},
+		{d.Name + "/out", "", errOutsideShare},
+		{d.Name + "/out/secret.txt", "", errOutsideShare},
+		{d.Name + "/outfile", "", errOutsideShare},
+		{d.Name + "/up", "", errOutsideShare},
+		{d.Name + "/up/outside/secret.txt", "", errOutsideShare},
+		{d.Name + "/missing.txt", "", os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		got, err := s.resolveShared(tt.path)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("resolveShared(%q) = %q, %v，应返回 %v", tt.path, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != filepath.Join(realRoot, tt.want) {
+			t.Errorf("resolveShared(%q) = %q, %v，应为 %q", tt.path, got, err, filepath.Join(realRoot, tt.want))
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package pairserver
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// 签名下载链接
+const (
+	signedPath     = "/download" // 签名链接指向的路径
+	defaultLinkTTL = time.Hour   // 管理接口生成链接的默认有效期
+)
+
+// SignedDownloadURL 生成单个文件的签名下载链接，形如 /download?file=...&exp=...&sig=...；
+// base为服务的访问地址，只取其协议和主机。持有链接即可在有效期内下载该文件而无需PIN码和访问令牌，
+// 修改链接中的文件名或过期时间都会使签名失效
+func (s *Server) SignedDownloadURL(base, filename string, ttl time.Duration) (string, error) {
+	return s.signedURL(base, filename, ttl, false)
+}
+
+// signedURL 生成签名下载链接；bound为真时签名同时绑定当前的PIN码和访问令牌，
+// 用于网页上访客生成的链接，PIN码或访问令牌改变后链接随之失效
+func (s *Server) signedURL(base, filename string, ttl time.Duration, bound bool) (string, error) {
+	if ttl <= 0 {
+		return "", errors.New("签名链接必须设置有效期")
+	}
+	if _, found := s.findFile(filename); !found {
+		return "", fmt.Errorf("文件不在分享列表中: %s", filename)
+	}
+	u, err := url.Parse(base)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("无效的访问地址: %s", base)
+	}
+
+	exp := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	q := url.Values{}
+	q.Set("file", filename)
+	q.Set("exp", exp)
+	bind := ""
+	if bound {
+		q.Set("auth", "1")
+		bind = s.authBinding()
+	}
+	q.Set("sig", s.sign(signedPath, filename, exp, bind))
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: s.sitePath(signedPath), RawQuery: q.Encode()}).String(), nil
+}
+
+// signKey 返回签名密钥，首次使用时随机生成；程序重启后之前的签名链接和CSRF令牌全部失效
+func (s *Server) signKey() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.signingKey == nil {
+		s.signingKey = make([]byte, 32)
+		if _, err := rand.Read(s.signingKey); err != nil {
+			panic(err)
+		}
+	}
+	return s.signingKey
+}
+
+// authBinding 返回签名绑定的访问凭据：当前的PIN码和访问令牌
+func (s *Server) authBinding() string {
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+
+	return s.auth.pin + "\x00" + s.auth.token
+}
+
+// sign 计算路径、文件名、过期时间和绑定凭据的HMAC-SHA256签名，bind为空表示不绑定
+func (s *Server) sign(path, filename, exp, bind string) string {
+	mac := hmac.New(sha256.New, s.signKey())
+	mac.Write([]byte(path + "\x00" + filename + "\x00" + exp))
+	if bind != "" {
+		mac.Write([]byte("\x00" + bind))
+	}
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validSignature 判断请求携带的签名是否有效且未过期
+func (s *Server) validSignature(r *http.Request) bool {
+	q := r.URL.Query()
+	exp, err := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	bind := ""
+	if q.Get("auth") == "1" {
+		bind = s.authBinding()
+	}
+	want := s.sign(r.URL.Path, q.Get("file"), q.Get("exp"), bind)
+	return hmac.Equal([]byte(q.Get("sig")), []byte(want))
+}
+
+// allowSigned 带签名的请求校验签名后直接交给h处理，跳过访问令牌和PIN码，签名无效或已过期时返回403；
+// 不带签名的请求交给protected处理
+func (s *Server) allowSigned(h, protected http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.Query().Has("sig") {
+			protected(w, r)
+			return
+		}
+		if r.URL.Path != signedPath || !s.validSignature(r) {
+			http.Error(w, "链接无效或已过期", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,60 @@
+package pairserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSignedLinkBinding 网页上生成的签名链接绑定PIN码和访问令牌，二者改变后失效；
+// 电脑端生成的链接不受影响，去掉绑定标记也无法绕过
+func TestSignedLinkBinding(t *testing.T) {
+	s, h := newRegistryServer(t, 1)
+	name := s.Files()[0].Filename
+	s.SetPIN("1234")
+	s.SetRequireToken(true)
+	s.resetToken()
+
+	link := func(bound bool) string {
+		u, err := s.signedURL("http://example.com", name, time.Minute, bound)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, _ := url.Parse(u)
+		return parsed.RequestURI()
+	}
+	get := func(target string) int {
+		return serve(h, httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	bound, unbound := link(true), link(false)
+	tests := []struct {
+		name   string
+		change func()
+		target *string
+		want   int
+	}{
+		{"绑定的链接", nil, &bound, http.StatusOK},
+		{"未绑定的链接", nil, &unbound, http.StatusOK},
+		{"修改PIN码后绑定的链接", func() { s.SetPIN("5678") }, &bound, http.StatusForbidden},
+		{"修改PIN码后未绑定的链接", nil, &unbound, http.StatusOK},
+		{"更换令牌后绑定的链接", func() { bound = link(true); s.resetToken() }, &bound, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if tt.change != nil {
+			tt.change()
+		}
+		if code := get(*tt.target); code != tt.want {
+			t.Errorf("%s: 状态码为%d，应为%d", tt.name, code, tt.want)
+		}
+	}
+
+	// 去掉绑定标记后签名不再匹配
+	bound = link(true)
+	if code := get(strings.Replace(bound, "auth=1&", "", 1)); code != http.StatusForbidden {
+		t.Errorf("去掉绑定标记后状态码为%d，应为403", code)
+	}
+}
@@ -0,0 +1,74 @@
+package pairserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// 静态资源：各页面的样式和脚本编译进程序，以static/名称?v=版本引用，版本为内容的哈希，
+// 内容变化后地址随之变化，因此带版本的请求可长期缓存
+const staticMaxAge = "public, max-age=31536000, immutable"
+
+//go:embed static
+var staticFS embed.FS
+
+// staticAsset 一个静态资源的内容和版本
+type staticAsset struct {
+	data    []byte
+	version string
+}
+
+// staticAssets 按文件名索引的静态资源，启动时读取
+var staticAssets = loadStaticAssets()
+
+// loadStaticAssets 读取内置的静态资源并计算版本
+func loadStaticAssets() map[string]staticAsset {
+	assets := make(map[string]staticAsset)
+	entries, err := fs.ReadDir(staticFS, "static")
+	if err != nil {
+		panic(err)
+	}
+	for _, e := range entries {
+		data, err := fs.ReadFile(staticFS, "static/"+e.Name())
+		if err != nil {
+			panic(err)
+		}
+		sum := sha256.Sum256(data)
+		assets[e.Name()] = staticAsset{data: data, version: hex.EncodeToString(sum[:4])}
+	}
+	return assets
+}
+
+// assetURL 返回静态资源带版本的相对地址，供模板引用
+func assetURL(name string) string {
+	a, ok := staticAssets[name]
+	if !ok {
+		return "static/" + name
+	}
+	return "static/" + name + "?v=" + a.version
+}
+
+// staticHandler 提供静态资源。版本与当前内容一致时允许长期缓存，否则要求每次验证；
+// PIN码页面同样需要样式，因此无需验证
+func staticHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/static/")
+	a, ok := staticAssets[name]
+	if !ok || path.Base(name) != name {
+		http.NotFound(w, r)
+		return
+	}
+	if r.URL.Query().Get("v") == a.version {
+		w.Header().Set("Cache-Control", staticMaxAge)
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("ETag", `"`+a.version+`"`)
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(a.data))
+}
@@ -0,0 +1,42 @@
+// “开启通知”按钮：订阅推送并登记到电脑上的服务，CSRF令牌和提示文字取自按钮所在元素的data属性
+(() => {
+    if (!window.isSecureContext || !('serviceWorker' in navigator) || !('PushManager' in window) || !('Notification' in window)) return;
+    const box = document.getElementById('push-notify');
+    const btn = document.getElementById('push-btn');
+    const text = box.dataset;
+    const b64 = s => {
+        const raw = atob((s + '==='.slice((s.length + 3) % 4)).replace(/-/g, '+').replace(/_/g, '/'));
+        return Uint8Array.from(raw, c => c.charCodeAt(0));
+    };
+    const save = sub => fetch('webpush/subscribe', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json', 'X-CSRF-Token': text.csrf },
+        body: JSON.stringify(sub.toJSON())
+    }).then(res => { if (!res.ok) throw new Error(res.status); });
+    const enabled = () => { btn.textContent = text.enabled; btn.disabled = true; };
+
+    navigator.serviceWorker.ready.then(async reg => {
+        box.hidden = false;
+        // 电脑上的服务重启后密钥会变化，已有的订阅需要重新登记
+        const key = b64((await (await fetch('webpush/key')).json()).key);
+        let sub = await reg.pushManager.getSubscription();
+        if (sub && Notification.permission === 'granted') {
+            const old = sub.options.applicationServerKey;
+            if (old && new Uint8Array(old).join() === key.join()) {
+                save(sub).then(enabled).catch(() => {});
+                return;
+            }
+            await sub.unsubscribe();
+        }
+        btn.onclick = async () => {
+            try {
+                if (await Notification.requestPermission() !== 'granted') throw new Error(Notification.permission);
+                sub = await reg.pushManager.subscribe({ userVisibleOnly: true, applicationServerKey: key });
+                await save(sub);
+                enabled();
+            } catch (e) {
+                alert(text.failed + e.message);
+            }
+        };
+    }).catch(() => {});
+})();
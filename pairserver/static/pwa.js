@@ -0,0 +1,7 @@
+// 在本地记住最近访问的地址，离线页面据此提供重试链接；安全上下文中注册Service Worker
+try {
+    localStorage.setItem('pair-gui:last', JSON.stringify({ url: location.origin + location.pathname, time: Date.now() }));
+} catch (e) {}
+if ('serviceWorker' in navigator && window.isSecureContext) {
+    navigator.serviceWorker.register('sw.js').catch(() => {});
+}
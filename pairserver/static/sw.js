@@ -0,0 +1,44 @@
+// Service Worker：安装时缓存离线页面及其样式和脚本；页面导航请求失败（电脑未运行或不在同一网络）时返回离线页面，
+// 其他请求（上传、下载等）不经过缓存。CACHE和OFFLINE_ASSETS由服务在脚本前生成，资源更新后缓存名称随之变化；
+// 地址都相对于脚本所在的目录，设置了路径前缀时同样适用
+const OFFLINE = new URL('offline', self.location).href;
+const ASSET_URLS = OFFLINE_ASSETS.map(a => new URL(a, self.location).href);
+
+self.addEventListener('install', e => {
+    e.waitUntil(caches.open(CACHE)
+        .then(c => c.addAll([new Request(OFFLINE, { cache: 'reload' }), ...ASSET_URLS]))
+        .then(() => self.skipWaiting()));
+});
+
+self.addEventListener('activate', e => {
+    e.waitUntil(caches.keys()
+        .then(keys => Promise.all(keys.filter(k => k !== CACHE).map(k => caches.delete(k))))
+        .then(() => self.clients.claim()));
+});
+
+self.addEventListener('fetch', e => {
+    if (e.request.mode === 'navigate') {
+        e.respondWith(fetch(e.request).catch(() => caches.match(OFFLINE)));
+    } else if (ASSET_URLS.includes(e.request.url)) {
+        // 带版本的资源内容不变，直接使用缓存
+        e.respondWith(caches.match(e.request).then(res => res || fetch(e.request)));
+    }
+});
+
+// 电脑发来的推送通知，点击后打开对应页面
+self.addEventListener('push', e => {
+    let data = {};
+    try { data = e.data.json(); } catch (err) {}
+    e.waitUntil(self.registration.showNotification(data.title || 'pair-gui', {
+        body: data.body || '', tag: data.tag, icon: 'icon-192.png', data: { url: data.url || './' }
+    }));
+});
+
+self.addEventListener('notificationclick', e => {
+    e.notification.close();
+    const url = new URL(e.notification.data.url, self.registration.scope).href;
+    e.waitUntil(self.clients.matchAll({ type: 'window' }).then(list => {
+        const win = list.find(c => c.url === url);
+        return win ? win.focus() : self.clients.openWindow(url);
+    }));
+});
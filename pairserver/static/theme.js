@@ -0,0 +1,33 @@
+// 网页的深色模式：默认跟随系统的prefers-color-scheme，页面右上角的按钮可手动切换，
+// 选择保存在浏览器本地，对所有页面生效。在<head>中同步加载，页面显示前就设置好主题，避免先白后黑的闪烁
+(() => {
+    const KEY = 'pair-gui:theme';
+    const media = window.matchMedia('(prefers-color-scheme: dark)');
+    const saved = () => { try { return localStorage.getItem(KEY); } catch (e) { return null; } };
+    const apply = () => {
+        const theme = saved() || (media.matches ? 'dark' : 'light');
+        document.documentElement.classList.toggle('dark', theme === 'dark');
+        const btn = document.querySelector('.theme-toggle');
+        if (btn) btn.textContent = theme === 'dark' ? '☀' : '☾';
+    };
+    apply();
+    // 未手动选择时跟随系统变化
+    media.addEventListener('change', apply);
+    document.addEventListener('DOMContentLoaded', () => {
+        const btn = document.createElement('button');
+        btn.type = 'button';
+        btn.className = 'theme-toggle';
+        btn.onclick = () => {
+            const next = document.documentElement.classList.contains('dark') ? 'light' : 'dark';
+            try {
+                // 与系统一致时清除选择，之后继续跟随系统
+                if (next === (media.matches ? 'dark' : 'light')) localStorage.removeItem(KEY);
+                else localStorage.setItem(KEY, next);
+            } catch (e) {}
+            document.documentElement.classList.toggle('dark', next === 'dark');
+            btn.textContent = next === 'dark' ? '☀' : '☾';
+        };
+        document.body.appendChild(btn);
+        apply();
+    });
+})();
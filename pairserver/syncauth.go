@@ -0,0 +1,361 @@
+package pairserver
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 文件夹同步的双向认证，同步密钥本身不在网络上传输。拉取方先请求质询，再以密钥对质询、随机数和
+// 对方的HTTPS证书指纹计算证明：对方确认拉取方持有密钥、且看到的是自己的证书后，才返回自己的证明，
+// 未通过验证的一方拿不到任何以密钥计算的值，只能在线猜测，输错次数与PIN码共用按IP的限制。
+// 拉取方据此确认对方持有密钥，并在本轮同步中只接受该证书。之后的每个请求以密钥对质询和请求地址签名，
+// 文件清单的响应同样带签名，文件内容再按清单中的SHA-256校验。冒用设备名称的一方仍可收到拉取方的证明
+// 并离线猜测密钥，因此同步密钥须由NewSyncKey随机生成，不能使用容易猜到的短口令
+const (
+	syncAuthName      = "X-Pair-Sync-Auth"  // 请求签名的请求头，格式为“质询:签名”
+	syncProofName     = "X-Pair-Sync-Proof" // 文件清单签名的响应头
+	syncChallengeTTL  = 10 * time.Minute    // 质询的有效期，期间开始的请求均可使用该质询
+	maxSyncChallenges = 64                  // 同时有效的未验证质询数，超出时丢弃最早发放的
+	maxSyncIndexSize  = 64 << 20            // 文件清单的最大字节数
+
+	// MinSyncKeyLength 同步密钥的最短长度
+	MinSyncKeyLength = 16
+)
+
+// syncKeyAlphabet 生成同步密钥使用的字符，去掉了容易混淆的0/o、1/l
+const syncKeyAlphabet = "23456789abcdefghijkmnpqrstuvwxyz"
+
+// ErrWeakSyncKey 同步密钥过短
+var ErrWeakSyncKey = fmt.Errorf("同步密钥至少需要%d个字符，请使用随机生成的密钥", MinSyncKeyLength)
+
+// NewSyncKey 生成随机的同步密钥，如 k7q2-m9x4-p3z8-w5r6-h2n4，共100位熵
+func NewSyncKey() string {
+	var groups []string
+	for range 5 {
+		b := make([]byte, 4)
+		for i := range b {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(syncKeyAlphabet))))
+			if err != nil {
+				panic(err)
+			}
+			b[i] = syncKeyAlphabet[n.Int64()]
+		}
+		groups = append(groups, string(b))
+	}
+	return strings.Join(groups, "-")
+}
+
+// syncChallenge 对方请求质询时返回的内容
+type syncChallenge struct {
+	Challenge string `json:"challenge"`
+}
+
+// syncVerified 拉取方通过验证后对方返回的证明
+type syncVerified struct {
+	Proof string `json:"proof"` // 以同步密钥对拉取方的随机数、质询和本机证书指纹的签名
+}
+
+// syncGrant 本机发放的质询
+type syncGrant struct {
+	expires  time.Time
+	verified bool // 对方已证明持有同步密钥，之后的请求可使用该质询签名
+}
+
+// syncSession 与对方的一轮同步：已验证的质询和只接受对方证书的客户端
+type syncSession struct {
+	base      string
+	challenge string
+	client    *http.Client
+}
+
+// syncMAC 以同步密钥计算各部分以换行连接后的HMAC-SHA256
+func syncMAC(key string, parts ...string) string {
+	m := hmac.New(sha256.New, []byte(key))
+	m.Write([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// certFingerprint 返回本机HTTPS证书的指纹，未启用HTTPS时为空
+func (s *Server) certFingerprint() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.tlsCert == nil {
+		return ""
+	}
+	return CertFingerprint(*s.tlsCert)
+}
+
+// activeSync 返回运行中的文件夹同步，未同步时返回nil
+func (s *Server) activeSync() *folderSync {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.folderSync
+}
+
+// newChallenge 发放新的质询，同时清理过期的质询。未验证的质询超出数量限制时丢弃最早发放的，
+// 大量请求质询不会挤掉已验证的质询
+func (f *folderSync) newChallenge() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	oldest, pending := "", 0
+	for c, g := range f.challenges {
+		switch {
+		case now.After(g.expires):
+			delete(f.challenges, c)
+		case !g.verified:
+			pending++
+			if oldest == "" || g.expires.Before(f.challenges[oldest].expires) {
+				oldest = c
+			}
+		}
+	}
+	if pending >= maxSyncChallenges {
+		delete(f.challenges, oldest)
+	}
+	c := newSessionID()
+	f.challenges[c] = syncGrant{expires: now.Add(syncChallengeTTL)}
+	return c
+}
+
+// takeChallenge 取出本机发放、仍在有效期内且尚未验证的质询，每个质询只能验证一次
+func (f *folderSync) takeChallenge(c string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	g, ok := f.challenges[c]
+	if !ok || g.verified || !time.Now().Before(g.expires) {
+		return false
+	}
+	delete(f.challenges, c)
+	return true
+}
+
+// verifyChallenge 记录对方已用质询c证明持有同步密钥
+func (f *folderSync) verifyChallenge(c string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.challenges[c] = syncGrant{expires: time.Now().Add(syncChallengeTTL), verified: true}
+}
+
+// validChallenge 检查质询是否由本机发放、已通过验证且仍在有效期内
+func (f *folderSync) validChallenge(c string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	g, ok := f.challenges[c]
+	return ok && g.verified && time.Now().Before(g.expires)
+}
+
+// syncChallengeHandler 发放质询，不包含任何以同步密钥计算的值
+func (s *Server) syncChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	f := s.activeSync()
+	if f == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(syncChallenge{Challenge: f.newChallenge()})
+}
+
+// syncVerifyHandler 验证拉取方对质询的证明，通过后返回本机的证明。证明错误时质询作废，
+// 输错次数与PIN码共用按IP的限制，输错过多时返回429
+func (s *Server) syncVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	f := s.activeSync()
+	query := r.URL.Query()
+	challenge, nonce := query.Get("challenge"), query.Get("nonce")
+	if f == nil || nonce == "" || len(nonce) > 64 || !f.takeChallenge(challenge) {
+		http.NotFound(w, r)
+		return
+	}
+	fingerprint := s.certFingerprint()
+	want := syncMAC(f.cfg.Key, "client", nonce, challenge, fingerprint)
+
+	s.auth.mu.Lock()
+	ok, locked := s.matchSecret(clientIP(r), query.Get("proof"), want)
+	s.auth.mu.Unlock()
+	if locked {
+		http.Error(w, "验证失败次数过多，请稍后再试", http.StatusTooManyRequests)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f.verifyChallenge(challenge)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(syncVerified{Proof: syncMAC(f.cfg.Key, "server", nonce, challenge, fingerprint)})
+}
+
+// syncAuthorized 校验请求对质询和请求地址的签名，未同步或签名不符时返回404
+func (s *Server) syncAuthorized(w http.ResponseWriter, r *http.Request) (cfg SyncConfig, challenge string, ok bool) {
+	f := s.activeSync()
+	challenge, mac, _ := strings.Cut(r.Header.Get(syncAuthName), ":")
+	if f != nil && f.validChallenge(challenge) {
+		want := syncMAC(f.cfg.Key, "request", challenge, r.URL.RequestURI())
+		ok = hmac.Equal([]byte(mac), []byte(want))
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return SyncConfig{}, "", false
+	}
+	return f.cfg, challenge, true
+}
+
+// syncConfined 解析符号链接后确认p仍在同步目录dir内，返回解析后的路径
+func syncConfined(dir, p string) (string, error) {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	real, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(realDir, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("路径不在同步目录内")
+	}
+	return real, nil
+}
+
+// handshake 向对方请求质询，先证明本机持有同步密钥，再验证对方返回的证明，确认对方同样持有密钥
+func (f *folderSync) handshake(ctx context.Context, peer Peer) (*syncSession, error) {
+	var c syncChallenge
+	resp, err := syncGetJSON(ctx, insecureClient(), peer, peer.URL()+"sync/challenge", &c)
+	if err != nil {
+		return nil, err
+	}
+	if c.Challenge == "" {
+		return nil, fmt.Errorf("%s 未提供同步质询", peer.Name)
+	}
+	fingerprint := ""
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		fingerprint = fingerprintDER(resp.TLS.PeerCertificates[0].Raw)
+	}
+
+	// 证明中包含本机看到的证书指纹，中间人转发时对方的证书与之不同，对方拒绝验证
+	nonce := newSessionID()
+	client := pinnedClient(fingerprint)
+	target := peer.URL() + "sync/verify?" + url.Values{
+		"challenge": {c.Challenge},
+		"nonce":     {nonce},
+		"proof":     {syncMAC(f.cfg.Key, "client", nonce, c.Challenge, fingerprint)},
+	}.Encode()
+	var v syncVerified
+	if _, err := syncGetJSON(ctx, client, peer, target, &v); err != nil {
+		return nil, err
+	}
+	want := syncMAC(f.cfg.Key, "server", nonce, c.Challenge, fingerprint)
+	if !hmac.Equal([]byte(v.Proof), []byte(want)) {
+		return nil, fmt.Errorf("%s 的同步密钥不一致，或连接被中间人转发", peer.Name)
+	}
+	return &syncSession{base: peer.URL(), challenge: c.Challenge, client: client}, nil
+}
+
+// syncGetJSON 发送握手请求并解析JSON响应；404表示对方未启用同步或未通过验证
+func syncGetJSON(ctx context.Context, client *http.Client, peer Peer, target string, v any) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%s 未启用同步，或同步密钥不一致", peer.Name)
+	default:
+		return nil, fmt.Errorf("%s: %s", peer.Name, resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(v); err != nil {
+		return nil, fmt.Errorf("解析同步握手失败: %v", err)
+	}
+	return resp, nil
+}
+
+// pinnedClient 返回只接受指纹为fingerprint的证书的客户端
+func pinnedClient(fingerprint string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{
+			// 对方使用自签名证书，改为在VerifyConnection中比较指纹
+			InsecureSkipVerify: true,
+			VerifyConnection: func(cs tls.ConnectionState) error {
+				if len(cs.PeerCertificates) == 0 || fingerprintDER(cs.PeerCertificates[0].Raw) != fingerprint {
+					return errors.New("对方的证书与同步验证时的不同")
+				}
+				return nil
+			},
+		},
+	}}
+}
+
+// get 以本轮的质询签名后发送GET请求，状态码不为200时返回错误；404表示质询已过期或对方已停止同步
+func (f *folderSync) get(ctx context.Context, sess *syncSession, target string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sess.base+target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(syncAuthName, sess.challenge+":"+syncMAC(f.cfg.Key, "request", sess.challenge, req.URL.RequestURI()))
+	resp, err := sess.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s 拒绝了同步请求", f.cfg.Peer)
+	}
+	return nil, fmt.Errorf("%s: %s", req.URL, resp.Status)
+}
+
+// getIndex 获取对方的文件清单并校验签名
+func (f *folderSync) getIndex(ctx context.Context, sess *syncSession) ([]syncEntry, error) {
+	resp, err := f.get(ctx, sess, "sync/index")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSyncIndexSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxSyncIndexSize {
+		return nil, errors.New("文件清单过大")
+	}
+	sum := sha256.Sum256(body)
+	want := syncMAC(f.cfg.Key, "index", sess.challenge, hex.EncodeToString(sum[:]))
+	if !hmac.Equal([]byte(resp.Header.Get(syncProofName)), []byte(want)) {
+		return nil, errors.New("文件清单的签名无效")
+	}
+	var entries []syncEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("解析文件清单失败: %v", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,231 @@
+package pairserver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// 测试用的同步密钥
+const (
+	testSyncKey  = "k7q2-m9x4-p3z8-w5r6-h2n4"
+	otherSyncKey = "a2b3-c4d5-e6f7-g8h9-j2k3"
+)
+
+// newSyncPeer 启动同步目录为dir、密钥为key的HTTPS服务，返回指向它的附近设备。
+// served为实际提供的证书，为nil时与服务设置的证书相同，不同时相当于连接被中间人转发
+func newSyncPeer(t *testing.T, dir, key string, served *tls.Certificate) Peer {
+	t.Helper()
+	peer, _ := newSyncPeerServer(t, dir, key, served)
+	return peer
+}
+
+// newSyncPeerServer 同newSyncPeer，同时返回对方的服务
+func newSyncPeerServer(t *testing.T, dir, key string, served *tls.Certificate) (Peer, *Server) {
+	t.Helper()
+	cert, err := LoadOrCreateCert(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if served == nil {
+		served = &cert
+	}
+	s := New()
+	s.SetTLSCert(&cert)
+	if err := s.StartSync(SyncConfig{Dir: dir, Peer: "other", Key: key}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.StopSync)
+
+	ts := httptest.NewUnstartedServer(s.Handler())
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{*served}}
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+
+	host, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return Peer{Name: "peer", IP: host, Port: p, HTTPS: true, Sharing: true}, s
+}
+
+// TestSyncHandshake 双方密钥相同且证书一致时才能通过验证
+func TestSyncHandshake(t *testing.T) {
+	ctx := context.Background()
+	f := &folderSync{cfg: SyncConfig{Peer: "peer", Key: testSyncKey}}
+
+	if _, err := f.handshake(ctx, newSyncPeer(t, t.TempDir(), testSyncKey, nil)); err != nil {
+		t.Errorf("密钥相同时验证失败: %v", err)
+	}
+	if _, err := f.handshake(ctx, newSyncPeer(t, t.TempDir(), otherSyncKey, nil)); err == nil {
+		t.Error("密钥不同时应验证失败")
+	}
+	other, err := LoadOrCreateCert(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.handshake(ctx, newSyncPeer(t, t.TempDir(), testSyncKey, &other)); err == nil {
+		t.Error("实际证书与对方证明的证书不同时应验证失败")
+	}
+}
+
+// TestSyncVerify 质询不含以密钥计算的值；拉取方的证明错误时不返回对方的证明，质询作废，
+// 输错过多时按IP锁定
+func TestSyncVerify(t *testing.T) {
+	peer, s := newSyncPeerServer(t, t.TempDir(), testSyncKey, nil)
+	client := insecureClient()
+	getJSON := func(target string, v any) int {
+		t.Helper()
+		resp, err := client.Get(peer.URL() + target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if v != nil {
+			json.NewDecoder(resp.Body).Decode(v)
+		}
+		return resp.StatusCode
+	}
+	challenge := func() string {
+		t.Helper()
+		var raw map[string]string
+		if code := getJSON("sync/challenge", &raw); code != http.StatusOK {
+			t.Fatalf("请求质询返回 %d", code)
+		}
+		if len(raw) != 1 || raw["challenge"] == "" {
+			t.Fatalf("质询应只包含challenge: %v", raw)
+		}
+		return raw["challenge"]
+	}
+	verify := func(c, key string) (int, syncVerified) {
+		t.Helper()
+		var v syncVerified
+		proof := syncMAC(key, "client", "n", c, s.certFingerprint())
+		code := getJSON("sync/verify?"+url.Values{"challenge": {c}, "nonce": {"n"}, "proof": {proof}}.Encode(), &v)
+		return code, v
+	}
+
+	c := challenge()
+	if code, v := verify(c, otherSyncKey); code != http.StatusNotFound || v.Proof != "" {
+		t.Errorf("证明错误时返回 %d、证明 %q，应为404且不含证明", code, v.Proof)
+	}
+	if code, _ := verify(c, testSyncKey); code != http.StatusNotFound {
+		t.Errorf("验证失败的质询再次使用时返回 %d，应为404", code)
+	}
+	for range maxPINAttempts - 1 {
+		verify(challenge(), otherSyncKey)
+	}
+	if code, _ := verify(challenge(), testSyncKey); code != http.StatusTooManyRequests {
+		t.Errorf("输错过多后返回 %d，应为429", code)
+	}
+}
+
+// TestSyncKey 生成的密钥足够长且每次不同，过短的密钥不能开始同步
+func TestSyncKey(t *testing.T) {
+	a, b := NewSyncKey(), NewSyncKey()
+	if len(a) < MinSyncKeyLength || a == b {
+		t.Errorf("生成的密钥 %q、%q", a, b)
+	}
+	s := New()
+	if err := s.StartSync(SyncConfig{Dir: t.TempDir(), Peer: "peer", Key: "secret"}); err != ErrWeakSyncKey {
+		t.Errorf("过短的密钥返回 %v，应为ErrWeakSyncKey", err)
+	}
+}
+
+// TestSyncRequestAuth 清单和文件请求须以有效的质询签名，签名与请求地址绑定
+func TestSyncRequestAuth(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Minute)
+	os.Chtimes(filepath.Join(dir, "a.txt"), old, old)
+	peer := newSyncPeer(t, dir, testSyncKey, nil)
+	f := &folderSync{cfg: SyncConfig{Peer: "peer", Key: testSyncKey}}
+	sess, err := f.handshake(ctx, peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := f.getIndex(ctx, sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != "a.txt" {
+		t.Errorf("文件清单为 %v", entries)
+	}
+	resp, err := f.get(ctx, sess, "sync/file?path=a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	tests := []struct {
+		name, target, auth string
+	}{
+		{"无签名", "sync/index", ""},
+		{"未知的质询", "sync/index", "unknown:" + syncMAC(testSyncKey, "request", "unknown", "/sync/index")},
+		{"签名用于其他地址", "sync/file?path=a.txt", sess.challenge + ":" + syncMAC(testSyncKey, "request", sess.challenge, "/sync/index")},
+		{"密钥不同", "sync/index", sess.challenge + ":" + syncMAC(otherSyncKey, "request", sess.challenge, "/sync/index")},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, sess.base+tt.target, nil)
+		req.Header.Set(syncAuthName, tt.auth)
+		resp, err := sess.client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: 状态码为 %d，应为404", tt.name, resp.StatusCode)
+		}
+	}
+
+	// 本轮同步只接受验证时的证书
+	if resp, err := pinnedClient("AA:BB").Get(sess.base + "sync/challenge"); err == nil {
+		resp.Body.Close()
+		t.Error("证书指纹不同时应拒绝连接")
+	}
+}
+
+// TestSyncFileSymlink 同步目录中指向目录之外的符号链接不被跟随
+func TestSyncFileSymlink(t *testing.T) {
+	ctx := context.Background()
+	dir, outside := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Skipf("无法创建符号链接: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "file-link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	f := &folderSync{cfg: SyncConfig{Peer: "peer", Key: testSyncKey}}
+	sess, err := f.handshake(ctx, newSyncPeer(t, dir, testSyncKey, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"link/secret.txt", "file-link.txt"} {
+		if resp, err := f.get(ctx, sess, "sync/file?path="+p); err == nil {
+			resp.Body.Close()
+			t.Errorf("%s: 不应返回同步目录之外的文件", p)
+		}
+	}
+
+	// 拉取的文件也不能写到符号链接指向的目录中
+	if _, err := syncConfined(dir, filepath.Join(dir, "link")); err == nil {
+		t.Error("指向同步目录之外的子目录应被拒绝")
+	}
+	if _, err := syncConfined(dir, filepath.Join(dir, ".")); err != nil {
+		t.Errorf("同步目录本身应被接受: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package pairserver
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+)
+
+// 网页模板：templates目录中的页面编译进程序，创建服务时解析一次。
+// 可指定一个模板目录，其中与内置模板同名的文件覆盖内置版本，无需重新编译即可定制页面；
+// 页面通过{{template "common-head.html" .}}等引用的片段也可以单独覆盖
+//
+//go:embed templates/*.html
+var templateFS embed.FS
+
+// templateFuncs 模板中可用的函数，执行时读取服务当前的设置
+func (s *Server) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"asset":        assetURL,
+		"basePath":     s.basePath,
+		"themeColor":   s.accentColor,
+		"brandTitle":   func() string { return s.branding().Title },
+		"hasBrandLogo": func() bool { return s.branding().logo != nil },
+	}
+}
+
+// parseTemplates 解析内置模板，dir非空时再解析其中的*.html，同名的模板覆盖内置版本
+func (s *Server) parseTemplates(dir string) (*template.Template, error) {
+	tmpl, err := template.New("").Funcs(s.templateFuncs()).ParseFS(templateFS, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return tmpl, nil
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s 不是目录", dir)
+	}
+	custom := os.DirFS(dir)
+	names, err := fs.Glob(custom, "*.html")
+	if err != nil || len(names) == 0 {
+		return tmpl, err
+	}
+	for _, name := range names {
+		if tmpl.Lookup(name) == nil {
+			log.Printf("模板目录中的 %s 不对应任何内置模板，可通过{{template}}引用", name)
+		}
+	}
+	return tmpl.ParseFS(custom, names...)
+}
+
+// SetTemplateDir 设置覆盖内置网页模板的目录，空表示只使用内置模板。
+// 模板解析失败时返回错误，继续使用原有模板
+func (s *Server) SetTemplateDir(dir string) error {
+	tmpl, err := s.parseTemplates(dir)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.pages = tmpl
+	s.mu.Unlock()
+	return nil
+}
+
+// renderPage 用模板name渲染页面。先渲染到缓冲区，出错时返回500而不是输出半个页面
+func (s *Server) renderPage(w http.ResponseWriter, status int, name string, data any) {
+	s.mu.RLock()
+	tmpl := s.pages
+	s.mu.RUnlock()
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		http.Error(w, fmt.Sprintf("渲染页面失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
@@ -0,0 +1,121 @@
+package pairserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 文本片段参数
+const (
+	maxTextLength = 64 << 10 // 单条文本的最大字节数
+	maxSnippets   = 50       // 保留的文本条数
+)
+
+// 文本的发送方
+const (
+	FromPhone    = "phone"    // 手机通过网页发送
+	FromComputer = "computer" // 电脑端发送
+)
+
+// Snippet 一条在手机和电脑之间传递的文本，如链接、Wi-Fi密码、验证码
+type Snippet struct {
+	ID   int       `json:"id"`
+	Text string    `json:"text"`
+	From string    `json:"from"` // FromPhone或FromComputer
+	Time time.Time `json:"time"`
+}
+
+// TextHandler 收到手机发送的文本时调用，在处理请求的协程中执行
+type TextHandler func(Snippet)
+
+// snippetStore 最近的文本片段
+type snippetStore struct {
+	mu      sync.Mutex
+	list    []Snippet
+	nextID  int
+	handler TextHandler
+}
+
+// add 记录一条文本，超出数量时丢弃最早的
+func (st *snippetStore) add(text, from string) Snippet {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.nextID++
+	sn := Snippet{ID: st.nextID, Text: text, From: from, Time: time.Now()}
+	st.list = append(st.list, sn)
+	if len(st.list) > maxSnippets {
+		st.list = st.list[len(st.list)-maxSnippets:]
+	}
+	return sn
+}
+
+// SendText 从电脑发送文本，手机端的文本页面会显示并可一键复制
+func (s *Server) SendText(text string) Snippet {
+	return s.snippets.add(text, FromComputer)
+}
+
+// Snippets 返回最近的文本，按发送时间排序
+func (s *Server) Snippets() []Snippet {
+	s.snippets.mu.Lock()
+	defer s.snippets.mu.Unlock()
+
+	return append([]Snippet(nil), s.snippets.list...)
+}
+
+// SetTextHandler 设置收到手机发送文本时的回调
+func (s *Server) SetTextHandler(h TextHandler) {
+	s.snippets.mu.Lock()
+	defer s.snippets.mu.Unlock()
+
+	s.snippets.handler = h
+}
+
+// textHandler 文本接口：GET返回最近的文本（JSON），POST接收手机发送的text字段
+func (s *Server) textHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(s.Snippets())
+	case http.MethodPost:
+		if !s.checkCSRF(w, r) {
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxTextLength+1024)
+		text := strings.TrimSpace(r.FormValue("text"))
+		if text == "" {
+			http.Error(w, "文本为空", http.StatusBadRequest)
+			return
+		}
+		if len(text) > maxTextLength {
+			http.Error(w, "文本过长", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		sn := s.snippets.add(text, FromPhone)
+		s.snippets.mu.Lock()
+		handler := s.snippets.handler
+		s.snippets.mu.Unlock()
+		if handler != nil {
+			handler(sn)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sn)
+	default:
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+	}
+}
+
+// textPageHandler 文本传输页面：发送文本到电脑，并显示双方发送的文本及复制按钮
+func (s *Server) textPageHandler(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		T        map[string]string
+		ClipSync bool
+		CSRF     string
+	}{T: webStrings(r), ClipSync: s.ClipboardSync(), CSRF: s.csrfToken(w, r)}
+	s.renderPage(w, http.StatusOK, "text.html", data)
+}
@@ -0,0 +1,214 @@
+package pairserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	_ "image/gif"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// 缩略图参数
+const (
+	thumbSize       = 160              // 缩略图最长边的像素数
+	thumbQuality    = 75               // JPEG压缩质量
+	thumbCacheLimit = 256              // 内存中缓存的缩略图数量
+	ffmpegTimeout   = 10 * time.Second // 截取视频帧的超时时间
+)
+
+// errNoThumbnail 文件类型不支持生成缩略图
+var errNoThumbnail = errors.New("不支持生成缩略图")
+
+// thumbnailTypes 可以解码生成缩略图的图片类型
+var thumbnailTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/bmp":  true,
+}
+
+// thumbCache 缩略图缓存，以文件路径、大小和修改时间为键，文件变化后自动失效；
+// 超出数量限制时淘汰最早生成的缩略图
+type thumbCache struct {
+	mu    sync.Mutex
+	items map[string][]byte
+	order []string
+}
+
+// get 返回缓存的缩略图
+func (c *thumbCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, ok := c.items[key]
+	return data, ok
+}
+
+// put 缓存缩略图
+func (c *thumbCache) put(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.items == nil {
+		c.items = make(map[string][]byte)
+	}
+	if _, ok := c.items[key]; ok {
+		return
+	}
+	if len(c.order) >= thumbCacheLimit {
+		delete(c.items, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.items[key] = data
+	c.order = append(c.order, key)
+}
+
+// HasThumbnail 返回能否为文件生成缩略图：常见图片格式，以及安装了ffmpeg时的视频
+func (f File) HasThumbnail() bool {
+	if thumbnailTypes[f.MimeType] {
+		return true
+	}
+	return strings.HasPrefix(f.MimeType, "video/") && ffmpegPath() != ""
+}
+
+// ffmpegPath 返回ffmpeg可执行文件的路径，未安装时为空
+var ffmpegPath = sync.OnceValue(func() string {
+	path, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return ""
+	}
+	return path
+})
+
+// thumbHandler 缩略图接口，返回图片或视频首帧缩小后的JPEG
+func (s *Server) thumbHandler(w http.ResponseWriter, r *http.Request) {
+	filename := r.URL.Query().Get("file")
+	if filename == "" {
+		http.Error(w, "缺少file参数", http.StatusBadRequest)
+		return
+	}
+
+	targetFile, found := s.findFile(filename)
+	if !found {
+		http.Error(w, "文件不存在", http.StatusNotFound)
+		return
+	}
+	if !s.requireFilePassword(w, r, targetFile, false) {
+		return
+	}
+	info, err := os.Stat(targetFile.AbsPath)
+	if err != nil {
+		http.Error(w, "文件不存在", http.StatusNotFound)
+		return
+	}
+
+	key := fmt.Sprintf("%s|%d|%d", targetFile.AbsPath, info.Size(), info.ModTime().UnixNano())
+	data, ok := s.thumbs.get(key)
+	if !ok {
+		data, err = makeThumbnail(r.Context(), targetFile)
+		if errors.Is(err, errNoThumbnail) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("生成缩略图失败: %v", err), http.StatusInternalServerError)
+			return
+		}
+		s.thumbs.put(key, data)
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeContent(w, r, "", info.ModTime(), bytes.NewReader(data))
+}
+
+// makeThumbnail 生成文件的JPEG缩略图
+func makeThumbnail(ctx context.Context, f File) ([]byte, error) {
+	var src image.Image
+	var err error
+	switch {
+	case thumbnailTypes[f.MimeType]:
+		src, err = decodeImageFile(f.AbsPath)
+	case strings.HasPrefix(f.MimeType, "video/") && ffmpegPath() != "":
+		src, err = videoFrame(ctx, f.AbsPath)
+	default:
+		return nil, errNoThumbnail
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaleDown(src, thumbSize), &jpeg.Options{Quality: thumbQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeImageFile 解码图片文件
+func decodeImageFile(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	return img, err
+}
+
+// videoFrame 使用ffmpeg截取视频第1秒处的一帧，视频不足1秒时取首帧
+func videoFrame(ctx context.Context, path string) (image.Image, error) {
+	ctx, cancel := context.WithTimeout(ctx, ffmpegTimeout)
+	defer cancel()
+
+	for _, seek := range []string{"1", "0"} {
+		cmd := exec.CommandContext(ctx, ffmpegPath(),
+			"-hide_banner", "-loglevel", "error",
+			"-ss", seek, "-i", path,
+			"-frames:v", "1", "-f", "image2pipe", "-vcodec", "png", "-")
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, err
+		}
+		if len(out) > 0 {
+			img, _, err := image.Decode(bytes.NewReader(out))
+			return img, err
+		}
+	}
+	return nil, errNoThumbnail
+}
+
+// scaleDown 按比例缩小图片使最长边不超过size，透明部分填充为白色
+func scaleDown(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(h*size/w, 1)
+		} else {
+			w, h = max(w*size/h, 1), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+	return dst
+}
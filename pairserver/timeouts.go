@@ -0,0 +1,82 @@
+package pairserver
+
+import (
+	"net/http"
+	"time"
+)
+
+// 默认超时
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second // 读取请求头的最长时间
+	DefaultIdleTimeout       = 2 * time.Minute  // 保持连接空闲等待下一个请求的最长时间
+	DefaultStallTimeout      = time.Minute      // 下载没有任何进展的最长时间
+)
+
+// timeouts HTTP服务的超时设置，0表示不限制
+type timeouts struct {
+	readHeader time.Duration
+	idle       time.Duration
+	stall      time.Duration
+}
+
+// SetTimeouts 设置读取请求头、空闲连接和下载停滞的超时，0表示不限制，下次启动服务时生效。
+// 大文件的下载时间无法预估，因此不使用固定的写超时，而是在下载停滞超过stall后中断连接，
+// 避免不再读取数据的客户端一直占用连接和goroutine
+func (s *Server) SetTimeouts(readHeader, idle, stall time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.timeouts = timeouts{readHeader: max(readHeader, 0), idle: max(idle, 0), stall: max(stall, 0)}
+}
+
+// stallTimeout 返回下载停滞的超时
+func (s *Server) stallTimeout() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.timeouts.stall
+}
+
+// applyTimeouts 将超时设置应用到HTTP服务
+func (s *Server) applyTimeouts(server *http.Server) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	server.ReadHeaderTimeout = s.timeouts.readHeader
+	server.IdleTimeout = s.timeouts.idle
+}
+
+// watchStall 下载期间每隔一段时间检查是否有进展，有进展时顺延写截止时间，
+// 停滞超过stall时截止时间到达，阻塞中的写入返回超时错误。返回的函数停止检查并清除截止时间，
+// 以免影响同一连接上的下一个请求
+func watchStall(rc *http.ResponseController, t *transfer, stall time.Duration) (stop func()) {
+	rc.SetWriteDeadline(time.Now().Add(stall))
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(stall / 4)
+		defer ticker.Stop()
+		last := t.count.Load()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// 在界面中取消的传输已将截止时间设为当前时间，不再顺延
+				if n := t.count.Load(); n != last && !t.canceled() {
+					last = n
+					rc.SetWriteDeadline(time.Now().Add(stall))
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+		if !t.canceled() {
+			rc.SetWriteDeadline(time.Time{})
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package pairserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// speedSampleInterval 计算瞬时速度的最短采样间隔
+const speedSampleInterval = 500 * time.Millisecond
+
+// errTransferCanceled 传输已在界面中取消
+var errTransferCanceled = errors.New("传输已取消")
+
+// TransferDirection 传输方向
+type TransferDirection int
+
+const (
+	TransferUpload   TransferDirection = iota // 其他设备上传到本机
+	TransferDownload                          // 其他设备从本机下载
+)
+
+// String 返回传输方向的名称：upload或download
+func (d TransferDirection) String() string {
+	if d == TransferUpload {
+		return "upload"
+	}
+	return "download"
+}
+
+// MarshalText 以名称保存传输方向
+func (d TransferDirection) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText 解析传输方向的名称
+func (d *TransferDirection) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "upload":
+		*d = TransferUpload
+	case "download":
+		*d = TransferDownload
+	default:
+		return fmt.Errorf("未知的传输方向: %s", text)
+	}
+	return nil
+}
+
+// Transfer 一个进行中传输的快照
+type Transfer struct {
+	ID        string
+	Direction TransferDirection
+	Filename  string
+	ClientIP  string
+	Total     int64 // 总字节数，未知时为-1
+	Done      int64 // 已传输的字节数，断点续传时包括之前已传输的部分
+	Started   time.Time
+	Speed     float64 // 瞬时速度（字节/秒）
+}
+
+// Percent 返回完成百分比，总大小未知时为-1
+func (t Transfer) Percent() float64 {
+	if t.Total <= 0 {
+		return -1
+	}
+	return float64(t.Done) * 100 / float64(t.Total)
+}
+
+// ETA 返回预计剩余时间，无法估计时为0
+func (t Transfer) ETA() time.Duration {
+	if t.Total <= 0 || t.Speed <= 0 || t.Done >= t.Total {
+		return 0
+	}
+	return time.Duration(float64(t.Total-t.Done) / t.Speed * float64(time.Second))
+}
+
+// transfer 登记中的一个传输
+type transfer struct {
+	id      string
+	dir     TransferDirection
+	ip      string
+	started time.Time
+	count   atomic.Int64 // 本次请求传输的字节数
+	stopped atomic.Bool  // 是否已取消
+
+	mu    sync.Mutex
+	name  string
+	total int64
+	base  int64  // 断点续传时之前已传输的字节数
+	abort func() // 取消时中断阻塞中的读写，如设置连接超时或关闭连接
+
+	// 以下字段用于传输记录
+	file     string        // 传输对应的本机文件，上传时为保存的位置
+	fileSize int64         // 本机文件的大小
+	status   int           // HTTP响应的状态码
+	partial  bool          // 只传输了文件的一部分，如断点续传中未完成的分块
+	failed   bool          // 传输出错
+	slot     *downloadSlot // 完整下载预留的下载次数，nil表示未预留
+
+	// 以下字段用于计算瞬时速度
+	lastDone int64
+	lastTime time.Time
+	speed    float64
+}
+
+// add 累加已传输的字节数
+func (t *transfer) add(n int) {
+	t.count.Add(int64(n))
+}
+
+// canceled 返回传输是否已取消
+func (t *transfer) canceled() bool {
+	return t.stopped.Load()
+}
+
+// setAbort 设置取消时中断读写的方法
+func (t *transfer) setAbort(abort func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.abort = abort
+}
+
+// reader 包装r，统计读取的字节数，取消后读取返回errTransferCanceled
+func (t *transfer) reader(r io.Reader) io.Reader {
+	return &countingReader{Reader: cancelableReader{r, t}, onRead: t.add}
+}
+
+// cancelableReader 传输取消后读取返回errTransferCanceled
+type cancelableReader struct {
+	io.Reader
+	t *transfer
+}
+
+// Read 实现io.Reader接口
+func (r cancelableReader) Read(p []byte) (int, error) {
+	if r.t.canceled() {
+		return 0, errTransferCanceled
+	}
+	n, err := r.Reader.Read(p)
+	if err != nil && r.t.canceled() {
+		err = errTransferCanceled
+	}
+	return n, err
+}
+
+// describe 设置文件名、总大小和续传起点，处理器在获知具体文件后调用
+func (t *transfer) describe(name string, total, base int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.name, t.total, t.base = name, total, base
+}
+
+// setFile 设置传输对应的本机文件，传输记录中可据此重新分享；path不是文件时忽略
+func (t *transfer) setFile(path string) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.file, t.fileSize = path, info.Size()
+}
+
+// setPartial 标记只传输了文件的一部分，不记入传输记录
+func (t *transfer) setPartial() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.partial = true
+}
+
+// fail 标记传输出错
+func (t *transfer) fail() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.failed = true
+}
+
+// snapshot 返回传输的快照
+func (t *transfer) snapshot() Transfer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return Transfer{
+		ID:        t.id,
+		Direction: t.dir,
+		Filename:  t.name,
+		ClientIP:  t.ip,
+		Total:     t.total,
+		Done:      t.base + t.count.Load(),
+		Started:   t.started,
+		Speed:     t.speed,
+	}
+}
+
+// sample 距上次采样足够久时更新瞬时速度，与上次的速度平滑以减少跳动，返回更新后的快照
+func (t *transfer) sample(now time.Time) Transfer {
+	t.mu.Lock()
+	if elapsed := now.Sub(t.lastTime); elapsed >= speedSampleInterval {
+		done := t.count.Load()
+		current := float64(done-t.lastDone) / elapsed.Seconds()
+		if t.lastDone == 0 && t.speed == 0 {
+			t.speed = current
+		} else {
+			t.speed = (t.speed + current) / 2
+		}
+		t.lastDone, t.lastTime = done, now
+	}
+	t.mu.Unlock()
+	return t.snapshot()
+}
+
+// transferRegistry 全部进行中的传输，HTTP和FTP传输都在此登记
+type transferRegistry struct {
+	mu    sync.Mutex
+	items map[string]*transfer
+}
+
+// beginTransfer 登记一个传输，结束时需调用endTransfer
+func (s *Server) beginTransfer(dir TransferDirection, name, ip string, total int64) *transfer {
+	now := time.Now()
+	t := &transfer{id: newSessionID(), dir: dir, ip: ip, started: now, name: name, total: total, lastTime: now}
+
+	s.transfers.mu.Lock()
+	defer s.transfers.mu.Unlock()
+
+	if s.transfers.items == nil {
+		s.transfers.items = make(map[string]*transfer)
+	}
+	s.transfers.items[t.id] = t
+	return t
+}
+
+// endTransfer 移除传输登记，并记入客户端的传输记录和保存的传输记录
+func (s *Server) endTransfer(t *transfer) {
+	s.transfers.mu.Lock()
+	delete(s.transfers.items, t.id)
+	s.transfers.mu.Unlock()
+
+	if n := t.count.Load(); n > 0 {
+		s.clients.record(t.ip, ClientTransfer{Direction: t.dir, Filename: t.snapshot().Filename, Bytes: n, Time: time.Now()})
+	}
+	s.recordHistory(t)
+	// 完整下载时已在recordHistory中计入次数；读到文件末尾的Range响应完整发送时在此计入，
+	// 一次性分享中也算作已下载；其余情况归还预留的次数
+	if slot := t.downloadSlot(); slot != nil {
+		completed := t.rangeCompleted()
+		slot.finish(completed)
+		if completed {
+			s.markServed(slot.paths...)
+		}
+	}
+}
+
+// downloadSlot 返回传输预留的下载次数
+func (t *transfer) downloadSlot() *downloadSlot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.slot
+}
+
+// CancelTransfer 取消进行中的传输：中断读写并关闭连接，未完成的上传文件会被删除。
+// 传输不存在时返回false
+func (s *Server) CancelTransfer(id string) bool {
+	s.transfers.mu.Lock()
+	t, ok := s.transfers.items[id]
+	s.transfers.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	t.stopped.Store(true)
+	t.mu.Lock()
+	abort := t.abort
+	t.mu.Unlock()
+	if abort != nil {
+		abort()
+	}
+	log.Printf("已取消传输: %s（%s）", t.snapshot().Filename, t.ip)
+	return true
+}
+
+// Transfers 返回全部进行中的上传和下载，按开始时间排序；定期调用以获得瞬时速度
+func (s *Server) Transfers() []Transfer {
+	s.transfers.mu.Lock()
+	defer s.transfers.mu.Unlock()
+
+	now := time.Now()
+	list := make([]Transfer, 0, len(s.transfers.items))
+	for _, t := range s.transfers.items {
+		list = append(list, t.sample(now))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.Before(list[j].Started) })
+	return list
+}
+
+// transferKey 请求上下文中登记的传输
+type transferKey struct{}
+
+// requestTransfer 返回请求对应的传输登记，未登记时返回nil
+func requestTransfer(r *http.Request) *transfer {
+	t, _ := r.Context().Value(transferKey{}).(*transfer)
+	return t
+}
+
+// setRequestFile 设置请求对应的本机文件，请求未登记传输时忽略
+func setRequestFile(r *http.Request, path string) {
+	if t := requestTransfer(r); t != nil {
+		t.setFile(path)
+	}
+}
+
+// trackTransfer 包装传输处理器，统计正在进行的传输数量；GET请求登记为下载，
+// POST、PUT和PATCH请求登记为上传，并统计实际传输的字节数。传输被取消时关闭连接
+func (s *Server) trackTransfer(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.active.Add(1)
+		defer s.active.Add(-1)
+
+		var t *transfer
+		switch r.Method {
+		case http.MethodGet:
+			t = s.beginTransfer(TransferDownload, requestName(r), clientIP(r), -1)
+			w = &countingResponseWriter{ResponseWriter: w, t: t, s: s}
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+			t = s.beginTransfer(TransferUpload, requestName(r), clientIP(r), r.ContentLength)
+			w = &countingResponseWriter{ResponseWriter: w, t: t, s: s}
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{t.reader(r.Body), r.Body}
+		default:
+			h(w, r)
+			return
+		}
+		defer s.endTransfer(t)
+
+		// 取消时让阻塞中的读写立即超时返回
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		rc := http.NewResponseController(w)
+		t.setAbort(func() {
+			cancel()
+			rc.SetReadDeadline(time.Now())
+			rc.SetWriteDeadline(time.Now())
+		})
+		if stall := s.stallTimeout(); stall > 0 && t.dir == TransferDownload {
+			defer watchStall(rc, t, stall)()
+		}
+		h(w, r.WithContext(context.WithValue(ctx, transferKey{}, t)))
+
+		if t.canceled() {
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// requestName 根据请求参数推测传输的文件名，处理器可在之后通过describe更正
+func requestName(r *http.Request) string {
+	query := r.URL.Query()
+	for _, key := range []string{"file", "path", "name"} {
+		if v := query.Get(key); v != "" {
+			return path.Base(v)
+		}
+	}
+	return path.Base(r.URL.Path)
+}
+
+// countingResponseWriter 记录响应的状态码；下载时统计写出的字节数，并从响应头获取文件名和大小
+type countingResponseWriter struct {
+	http.ResponseWriter
+	t           *transfer
+	s           *Server
+	wroteHeader bool
+}
+
+// WriteHeader 记录响应的状态码，下载时记录Content-Length和Content-Disposition中的文件名，
+// 并在开始下载完整文件时发布事件
+func (w *countingResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		header := w.ResponseWriter.Header()
+		w.t.mu.Lock()
+		w.t.status = code
+		if code >= http.StatusBadRequest {
+			w.t.failed = true
+		}
+		if w.t.dir == TransferUpload {
+			w.t.mu.Unlock()
+			w.ResponseWriter.WriteHeader(code)
+			return
+		}
+		if size, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil && code < 300 {
+			w.t.total = size
+		}
+		if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+			w.t.name = params["filename"]
+		}
+		name, total := w.t.name, w.t.total
+		w.t.mu.Unlock()
+		if code == http.StatusOK {
+			w.s.publish(EventDownloadStarted, map[string]any{"filename": name, "size": total, "client_ip": w.t.ip})
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write 实现io.Writer接口，统计写出的字节数
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	if w.t.canceled() {
+		return 0, errTransferCanceled
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(p)
+	if w.t.dir == TransferDownload {
+		w.t.add(n)
+	}
+	return n, err
+}
+
+// Unwrap 供http.ResponseController访问原始的ResponseWriter
+func (w *countingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
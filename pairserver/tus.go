@@ -0,0 +1,688 @@
+package pairserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tus断点续传协议（https://tus.io），实现核心协议及creation、termination、checksum、concatenation、expiration扩展
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,checksum,concatenation,expiration"
+	tusBasePath   = "/files/"
+	partialDir    = ".pair-gui-partial" // 未完成上传的临时目录，位于上传目录下
+
+	partialExpiry        = 24 * time.Hour // 未完成的上传最后一次写入后保留的时间
+	partialSweepInterval = time.Hour      // 清理过期上传的间隔
+)
+
+// tusUpload 一个可续传的上传
+type tusUpload struct {
+	mu       sync.Mutex
+	ID       string `json:"id"`
+	Filename string `json:"filename"`           // 清理后的文件名
+	Size     int64  `json:"size"`               // 文件总大小
+	Offset   int64  `json:"offset"`             // 已接收的字节数
+	Dir      string `json:"dir"`                // 上传完成后保存的目录
+	Partial  bool   `json:"partial,omitempty"`  // 并行上传的一部分，接收完整后等待合并，不保存到上传目录
+	Approved bool   `json:"approved,omitempty"` // 创建该部分时已确认接收整个文件
+	Total    int64  `json:"total,omitempty"`    // 已确认的部分上传对应的整个文件大小，合并后的大小须与之相同
+
+	progress UploadProgress // 已接收的字节数，包括正在接收的分块
+}
+
+// tusStore 进行中的上传
+type tusStore struct {
+	mu       sync.Mutex
+	uploads  map[string]*tusUpload
+	canceled map[string]bool // 在界面中取消的上传，不允许续传
+}
+
+// status 返回上传进度
+func (u *tusUpload) status() UploadStatus {
+	return UploadStatus{ID: u.ID, Filename: u.Filename, Total: u.Size, Uploaded: atomic.LoadInt64(&u.progress.Uploaded)}
+}
+
+// partPath 返回上传数据的临时文件路径
+func (u *tusUpload) partPath() string {
+	return filepath.Join(u.Dir, partialDir, u.ID+".part")
+}
+
+// infoPath 返回上传信息文件路径，用于服务重启后继续上传
+func (u *tusUpload) infoPath() string {
+	return filepath.Join(u.Dir, partialDir, u.ID+".json")
+}
+
+// saveInfo 持久化上传信息
+func (u *tusUpload) saveInfo() error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(u.infoPath(), data, 0o644)
+}
+
+// expires 返回上传的过期时间：最后一次写入数据后partialExpiry
+func (u *tusUpload) expires() time.Time {
+	info, err := os.Stat(u.partPath())
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime().Add(partialExpiry)
+}
+
+// setExpires 在响应中告知客户端上传的过期时间
+func (u *tusUpload) setExpires(w http.ResponseWriter) {
+	if t := u.expires(); !t.IsZero() {
+		w.Header().Set("Upload-Expires", t.UTC().Format(http.TimeFormat))
+	}
+}
+
+// remove 删除上传的临时文件
+func (u *tusUpload) remove() {
+	os.Remove(u.partPath())
+	os.Remove(u.infoPath())
+}
+
+// getUpload 查找上传，内存中没有时尝试从当前上传目录的信息文件恢复
+func (s *Server) getUpload(id string) *tusUpload {
+	s.tus.mu.Lock()
+	defer s.tus.mu.Unlock()
+
+	if u, ok := s.tus.uploads[id]; ok {
+		return u
+	}
+
+	// ID仅由十六进制字符组成，避免路径穿越
+	if strings.Trim(id, "0123456789abcdef") != "" {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(s.UploadDir(), partialDir, id+".json"))
+	if err != nil {
+		return nil
+	}
+	u := &tusUpload{}
+	if err := json.Unmarshal(data, u); err != nil || u.ID != id {
+		return nil
+	}
+	// 以临时文件的实际大小为准
+	if info, err := os.Stat(u.partPath()); err == nil {
+		u.Offset = info.Size()
+		u.progress.Uploaded = u.Offset
+	} else {
+		return nil
+	}
+	s.putUpload(u)
+	return u
+}
+
+// putUpload 记录上传，调用方需持有s.tus.mu
+func (s *Server) putUpload(u *tusUpload) {
+	if s.tus.uploads == nil {
+		s.tus.uploads = make(map[string]*tusUpload)
+	}
+	s.tus.uploads[u.ID] = u
+}
+
+// dropUpload 移除上传记录
+func (s *Server) dropUpload(id string) {
+	s.tus.mu.Lock()
+	defer s.tus.mu.Unlock()
+
+	delete(s.tus.uploads, id)
+}
+
+// cancelUpload 记录已取消的上传，之后的续传请求返回410
+func (s *Server) cancelUpload(id string) {
+	s.tus.mu.Lock()
+	defer s.tus.mu.Unlock()
+
+	if s.tus.canceled == nil {
+		s.tus.canceled = make(map[string]bool)
+	}
+	s.tus.canceled[id] = true
+}
+
+// uploadCanceled 判断上传是否已在界面中取消
+func (s *Server) uploadCanceled(id string) bool {
+	s.tus.mu.Lock()
+	defer s.tus.mu.Unlock()
+
+	return s.tus.canceled[id]
+}
+
+// tusHandler tus协议处理器，路径为 /files/ 和 /files/{id}
+func (s *Server) tusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtensions)
+		w.Header().Set("Tus-Checksum-Algorithm", strings.Join(checksumAlgorithms, ","))
+		if limit := s.MaxUploadSize(); limit > 0 {
+			w.Header().Set("Tus-Max-Size", strconv.FormatInt(limit, 10))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "不支持的tus协议版本", http.StatusPreconditionFailed)
+		return
+	}
+	if r.Method != http.MethodHead && !s.checkCSRF(w, r) {
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, tusBasePath)
+	if id == "" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "仅支持POST方法", http.StatusMethodNotAllowed)
+			return
+		}
+		s.tusCreate(w, r)
+		return
+	}
+
+	u := s.getUpload(id)
+	if u == nil && s.uploadCanceled(id) {
+		writeUploadError(w, http.StatusGone, uploadError{Error: webStrings(r)["UploadCanceled"]})
+		return
+	}
+	if u == nil {
+		http.Error(w, "上传不存在", http.StatusNotFound)
+		return
+	}
+	if time.Now().After(u.expires()) {
+		u.mu.Lock()
+		u.remove()
+		u.mu.Unlock()
+		s.dropUpload(id)
+		http.Error(w, "上传已过期", http.StatusGone)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		u.mu.Lock()
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(u.Size, 10))
+		if u.Partial {
+			w.Header().Set("Upload-Concat", "partial")
+		}
+		u.mu.Unlock()
+		u.setExpires(w)
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPatch:
+		s.tusPatch(w, r, u)
+	case http.MethodDelete:
+		u.mu.Lock()
+		u.remove()
+		u.mu.Unlock()
+		s.dropUpload(id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "不支持的请求方法", http.StatusMethodNotAllowed)
+	}
+}
+
+// tusCreate 创建上传，返回上传地址。Upload-Concat为partial时创建并行上传的一部分：
+// 携带size元数据(整个文件的大小)的部分按整个文件检查并请用户确认；携带first元数据的部分
+// 沿用其指向的已确认部分，不再询问；两者都没有的部分按自身大小请用户确认，合并时再确认一次
+func (s *Server) tusCreate(w http.ResponseWriter, r *http.Request) {
+	concat := r.Header.Get("Upload-Concat")
+	if list, ok := strings.CutPrefix(concat, "final;"); ok {
+		s.tusConcat(w, r, list)
+		return
+	}
+	partial := concat == "partial"
+
+	size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		http.Error(w, "缺少或无效的Upload-Length", http.StatusBadRequest)
+		return
+	}
+
+	if limit := s.MaxUploadSize(); limit > 0 && size > limit {
+		writeTooLarge(w, r, limit)
+		return
+	}
+
+	if !ensureSpace(w, r, s.UploadDir(), size) {
+		return
+	}
+
+	meta := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	filename, ok := meta["filename"]
+	if !ok || filename == "" {
+		http.Error(w, "缺少文件名", http.StatusBadRequest)
+		return
+	}
+	filename = sanitizeFilename(filename)
+
+	if s.rejectsExisting(s.UploadDir(), filename) {
+		http.Error(w, fmt.Sprintf("文件已存在: %s", filename), http.StatusConflict)
+		return
+	}
+
+	// 部分上传的size元数据为整个文件的大小，按整个文件确认一次，合并时不再询问
+	approved, linked, total := false, false, size
+	if partial {
+		if n, err := strconv.ParseInt(meta["size"], 10, 64); err == nil && n >= size {
+			approved, total = true, n
+			if limit := s.MaxUploadSize(); limit > 0 && total > limit {
+				writeTooLarge(w, r, limit)
+				return
+			}
+		} else if n, ok := s.approvedPart(meta["first"], filename); ok && size <= n {
+			approved, linked, total = true, true, n
+		}
+	}
+	if !linked && !s.approveRequest(r, filename, total) {
+		writeUploadDenied(w, r)
+		return
+	}
+
+	u := &tusUpload{
+		ID:       newSessionID(),
+		Filename: filename,
+		Size:     size,
+		Dir:      s.UploadDir(),
+		Partial:  partial,
+		Approved: approved,
+	}
+	if approved {
+		u.Total = total
+	}
+	if err := os.MkdirAll(filepath.Join(u.Dir, partialDir), 0o755); err != nil {
+		http.Error(w, fmt.Sprintf("创建临时目录失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	f, err := os.Create(u.partPath())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("创建文件失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	f.Close()
+	if err := u.saveInfo(); err != nil {
+		http.Error(w, fmt.Sprintf("保存上传信息失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// 空文件直接完成
+	if size == 0 && !partial {
+		saved, err := s.finishUpload(u)
+		if err != nil {
+			s.finishError(w, u, err)
+			return
+		}
+		setRequestFile(r, saved)
+	} else {
+		s.tus.mu.Lock()
+		s.putUpload(u)
+		s.tus.mu.Unlock()
+		u.setExpires(w)
+	}
+
+	w.Header().Set("Location", s.sitePath(tusBasePath+u.ID))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// approvedPart 返回ref指向的部分上传是否已确认接收文件filename，及已确认的整个文件大小
+func (s *Server) approvedPart(ref, filename string) (int64, bool) {
+	if ref == "" {
+		return 0, false
+	}
+	u := s.getUpload(ref[strings.LastIndex(ref, "/")+1:])
+	if u == nil {
+		return 0, false
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.Total, u.Partial && u.Approved && u.Filename == filename
+}
+
+// tusPatch 从指定偏移追加上传数据，数据接收完整后移动到上传目录
+func (s *Server) tusPatch(w http.ResponseWriter, r *http.Request, u *tusUpload) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type必须为application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		http.Error(w, "缺少或无效的Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	// 同一上传同时只允许一个PATCH请求
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if offset != u.Offset {
+		http.Error(w, "Upload-Offset与服务器记录不一致", http.StatusConflict)
+		return
+	}
+
+	// 带校验和的分块必须完整且校验通过才保留
+	var checksum *chunkChecksum
+	if header := r.Header.Get("Upload-Checksum"); header != "" {
+		checksum, err = parseChecksum(header)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	f, err := os.OpenFile(u.partPath(), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("打开文件失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// 只接收剩余长度的数据，未校验的数据中断时保留已写入的部分以便续传
+	var dst io.Writer = f
+	if checksum != nil {
+		dst = io.MultiWriter(f, checksum.hash)
+	}
+	atomic.StoreInt64(&u.progress.Uploaded, u.Offset)
+	t := requestTransfer(r)
+	if t != nil {
+		t.describe(u.Filename, u.Size, u.Offset)
+	}
+	body := &ProgressReader{
+		Reader:   io.LimitReader(newRateLimitedReader(r.Context(), r.Body, s.RateLimit()), u.Size-u.Offset),
+		Progress: &u.progress,
+	}
+	n, copyErr := io.Copy(dst, body)
+	// 未接收完整个文件的分块不记入传输记录，出错时可以续传
+	if t != nil && u.Offset+n < u.Size {
+		t.setPartial()
+	}
+	// 在界面中取消的上传不再续传，删除已接收的部分
+	if t != nil && t.canceled() {
+		f.Close()
+		u.remove()
+		s.dropUpload(u.ID)
+		s.cancelUpload(u.ID)
+		writeUploadError(w, http.StatusGone, uploadError{Error: webStrings(r)["UploadCanceled"]})
+		return
+	}
+	if checksum != nil && (copyErr != nil || !checksum.match()) {
+		f.Truncate(u.Offset)
+		atomic.StoreInt64(&u.progress.Uploaded, u.Offset)
+		f.Close()
+		if copyErr != nil {
+			http.Error(w, fmt.Sprintf("保存文件失败: %v", copyErr), http.StatusInternalServerError)
+		} else {
+			http.Error(w, "分块校验和不匹配", statusChecksumMismatch)
+		}
+		return
+	}
+	f.Close()
+	u.Offset += n
+	u.saveInfo()
+
+	if copyErr != nil {
+		http.Error(w, fmt.Sprintf("保存文件失败: %v", copyErr), http.StatusInternalServerError)
+		return
+	}
+
+	if u.Offset == u.Size && !u.Partial {
+		saved, err := s.finishUpload(u)
+		if err != nil {
+			s.finishError(w, u, err)
+			return
+		}
+		setRequestFile(r, saved)
+	} else {
+		u.setExpires(w)
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusConcat 按顺序合并已接收完整的部分上传，合并后保存到上传目录；
+// 各部分的数据已在接收时按分块校验，任一部分未完成或不存在时返回错误，客户端可续传后重试
+func (s *Server) tusConcat(w http.ResponseWriter, r *http.Request, list string) {
+	filename := parseTusMetadata(r.Header.Get("Upload-Metadata"))["filename"]
+	if filename == "" {
+		http.Error(w, "缺少文件名", http.StatusBadRequest)
+		return
+	}
+	filename = sanitizeFilename(filename)
+
+	var parts []*tusUpload
+	seen := make(map[string]bool)
+	for _, ref := range strings.Fields(list) {
+		// 列表中为部分上传的地址，可以是完整URL，最后一段为ID
+		id := ref[strings.LastIndex(ref, "/")+1:]
+		if seen[id] {
+			http.Error(w, fmt.Sprintf("重复的部分上传: %s", ref), http.StatusBadRequest)
+			return
+		}
+		seen[id] = true
+		u := s.getUpload(id)
+		if u == nil || !u.Partial {
+			http.Error(w, fmt.Sprintf("部分上传不存在: %s", ref), http.StatusBadRequest)
+			return
+		}
+		parts = append(parts, u)
+	}
+
+	// 持有各部分的锁直到合并完成，避免合并时仍有数据写入；按ID顺序加锁，
+	// 同时合并相同部分的请求不会互相等待
+	locked := slices.Clone(parts)
+	slices.SortFunc(locked, func(a, b *tusUpload) int { return strings.Compare(a.ID, b.ID) })
+	for _, u := range locked {
+		u.mu.Lock()
+	}
+	defer func() {
+		for _, u := range locked {
+			u.mu.Unlock()
+		}
+	}()
+
+	var size, total int64
+	for _, u := range parts {
+		if u.Offset != u.Size {
+			http.Error(w, fmt.Sprintf("部分上传未完成: %s", u.ID), http.StatusBadRequest)
+			return
+		}
+		if u.Approved && u.Filename == filename {
+			total = u.Total
+		}
+		size += u.Size
+	}
+	// 已确认的大小与合并后的大小不同时重新确认
+	approved := total > 0 && total == size
+	if len(parts) == 0 {
+		http.Error(w, "缺少要合并的部分", http.StatusBadRequest)
+		return
+	}
+	if limit := s.MaxUploadSize(); limit > 0 && size > limit {
+		writeTooLarge(w, r, limit)
+		return
+	}
+	if s.rejectsExisting(s.UploadDir(), filename) {
+		http.Error(w, fmt.Sprintf("文件已存在: %s", filename), http.StatusConflict)
+		return
+	}
+	if !approved && !s.approveRequest(r, filename, size) {
+		writeUploadDenied(w, r)
+		return
+	}
+
+	// 第一部分直接改名为合并后的文件，之后的部分依次追加，减少复制的数据量
+	u := &tusUpload{ID: newSessionID(), Filename: filename, Size: size, Dir: parts[0].Dir}
+	if err := os.Rename(parts[0].partPath(), u.partPath()); err != nil {
+		http.Error(w, fmt.Sprintf("合并文件失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := appendParts(u.partPath(), parts[1:]); err != nil {
+		os.Rename(u.partPath(), parts[0].partPath())
+		http.Error(w, fmt.Sprintf("合并文件失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	for _, p := range parts {
+		p.remove()
+		s.dropUpload(p.ID)
+	}
+	u.Offset = size
+
+	// 合并后的文件没有保存上传信息，无法续传，保存失败时直接删除，客户端重新上传
+	saved, err := s.finishUpload(u)
+	if err != nil {
+		u.remove()
+		s.finishError(w, u, err)
+		return
+	}
+	setRequestFile(r, saved)
+	w.Header().Set("Location", s.sitePath(tusBasePath+u.ID))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// appendParts 将各部分的数据依次追加到path，失败时恢复path原来的长度
+func appendParts(path string, parts []*tusUpload) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	for _, p := range parts {
+		src, err := os.Open(p.partPath())
+		if err != nil {
+			f.Truncate(info.Size())
+			return err
+		}
+		_, err = io.Copy(f, src)
+		src.Close()
+		if err != nil {
+			f.Truncate(info.Size())
+			return err
+		}
+	}
+	return nil
+}
+
+// finishUpload 将接收完整的临时文件移动到上传目录，重名时按策略处理，返回保存的路径
+func (s *Server) finishUpload(u *tusUpload) (string, error) {
+	var saved string
+	err := s.saveAs(u.Dir, u.Filename, func(path string) error {
+		saved = path
+		return os.Rename(u.partPath(), path)
+	})
+	if err != nil {
+		return "", err
+	}
+	os.Remove(u.infoPath())
+	s.dropUpload(u.ID)
+	return saved, nil
+}
+
+// finishError 返回上传完成时保存失败的错误；因重名被拒绝的上传无法再完成，直接删除
+func (s *Server) finishError(w http.ResponseWriter, u *tusUpload, err error) {
+	if errors.Is(err, ErrFileExists) {
+		u.remove()
+		s.dropUpload(u.ID)
+		http.Error(w, fmt.Sprintf("文件已存在: %s", u.Filename), http.StatusConflict)
+		return
+	}
+	http.Error(w, fmt.Sprintf("保存文件失败: %v", err), http.StatusInternalServerError)
+}
+
+// sweepPartials 删除上传目录中超过partialExpiry未写入的未完成上传，包括服务重启前遗留的上传
+func (s *Server) sweepPartials() {
+	dir := filepath.Join(s.UploadDir(), partialDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	deadline := time.Now().Add(-partialExpiry)
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() || info.ModTime().After(deadline) {
+			continue
+		}
+		// 信息文件只在创建和每次PATCH结束时写入，以数据文件的修改时间为准
+		name := e.Name()
+		if id, ok := strings.CutSuffix(name, ".json"); ok {
+			if data, err := os.Stat(filepath.Join(dir, id+".part")); err == nil && data.ModTime().After(deadline) {
+				continue
+			}
+		}
+		os.Remove(filepath.Join(dir, name))
+		if id, ok := strings.CutSuffix(name, ".part"); ok {
+			s.dropUpload(id)
+		}
+	}
+}
+
+// startSweep 立即清理一次过期的上传，之后每隔partialSweepInterval清理，直到服务停止
+func (s *Server) startSweep() {
+	s.stopSweep()
+	done := make(chan struct{})
+	s.mu.Lock()
+	s.sweepDone = done
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(partialSweepInterval)
+		defer ticker.Stop()
+		for {
+			s.sweepPartials()
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stopSweep 停止定期清理过期的上传
+func (s *Server) stopSweep() {
+	s.mu.Lock()
+	done := s.sweepDone
+	s.sweepDone = nil
+	s.mu.Unlock()
+
+	if done != nil {
+		close(done)
+	}
+}
+
+// parseTusMetadata 解析Upload-Metadata请求头，格式为逗号分隔的“键 base64值”
+func parseTusMetadata(header string) map[string]string {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		meta[key] = string(decoded)
+	}
+	return meta
+}
@@ -0,0 +1,199 @@
+package pairserver
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tusRequest 构造tus请求，meta为Upload-Metadata的键值，按顺序成对给出
+func tusRequest(method, path string, header map[string]string, body string, meta ...string) *http.Request {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Tus-Resumable", tusVersion)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	var pairs []string
+	for i := 0; i+1 < len(meta); i += 2 {
+		pairs = append(pairs, meta[i]+" "+base64.StdEncoding.EncodeToString([]byte(meta[i+1])))
+	}
+	if len(pairs) > 0 {
+		r.Header.Set("Upload-Metadata", strings.Join(pairs, ","))
+	}
+	return r
+}
+
+// tusCreatePart 创建大小为size的部分上传并写入data，返回状态码和上传地址
+func tusCreatePart(t *testing.T, h http.Handler, data string, meta ...string) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, tusRequest(http.MethodPost, tusBasePath, map[string]string{
+		"Upload-Length": fmt.Sprint(len(data)),
+		"Upload-Concat": "partial",
+	}, "", meta...))
+	if w.Code != http.StatusCreated {
+		return w.Code, ""
+	}
+	loc := w.Header().Get("Location")
+	id := loc[strings.LastIndex(loc, "/")+1:]
+	code := serve(h, tusRequest(http.MethodPatch, tusBasePath+id, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "0",
+	}, data))
+	if code != http.StatusNoContent {
+		t.Fatalf("写入部分上传返回 %d", code)
+	}
+	return w.Code, loc
+}
+
+// tusMerge 请求按顺序合并parts，返回状态码
+func tusMerge(h http.Handler, filename string, parts ...string) int {
+	return serve(h, tusRequest(http.MethodPost, tusBasePath, map[string]string{
+		"Upload-Concat": "final;" + strings.Join(parts, " "),
+	}, "", "filename", filename))
+}
+
+// TestTusPartialApproval 部分上传都须经过确认：带size的部分按整个文件确认，带first的部分沿用其确认结果，
+// 两者都没有的部分按自身大小确认，合并时再确认一次；合并后的大小与已确认的大小不同时也重新确认
+func TestTusPartialApproval(t *testing.T) {
+	s, h := newRegistryServer(t, 0)
+	s.SetUploadApproval(true)
+	var asked atomic.Int32
+	var sizes []int64
+	s.SetUploadApprover(func(req UploadRequest) (bool, bool) {
+		asked.Add(1)
+		sizes = append(sizes, req.Size)
+		return true, false
+	})
+
+	_, first := tusCreatePart(t, h, "abc", "filename", "a.txt", "size", "6")
+	_, second := tusCreatePart(t, h, "def", "filename", "a.txt", "first", first)
+	if n := asked.Load(); n != 1 || sizes[0] != 6 {
+		t.Fatalf("带size和first的部分应只按整个文件确认一次，确认了%d次: %v", n, sizes)
+	}
+	if code := tusMerge(h, "a.txt", first, second); code != http.StatusCreated {
+		t.Fatalf("合并返回 %d", code)
+	}
+	if n := asked.Load(); n != 1 {
+		t.Errorf("合并已确认的文件时又询问了%d次", n-1)
+	}
+	if data, _ := os.ReadFile(filepath.Join(s.UploadDir(), "a.txt")); string(data) != "abcdef" {
+		t.Errorf("合并后的内容为 %q", data)
+	}
+
+	// first指向其他文件的部分或没有size的部分单独确认
+	asked.Store(0)
+	_, first = tusCreatePart(t, h, "abc", "filename", "b.txt", "size", "6")
+	_, other := tusCreatePart(t, h, "xyz", "filename", "c.txt", "first", first)
+	_, plain := tusCreatePart(t, h, "uvw", "filename", "c.txt")
+	if n := asked.Load(); n != 3 {
+		t.Errorf("应询问3次，实际%d次", n)
+	}
+	tusMerge(h, "c.txt", other, plain)
+	if n := asked.Load(); n != 4 {
+		t.Errorf("未确认整个文件的部分合并时应再询问一次，实际询问%d次", n)
+	}
+
+	// 合并后的大小与已确认的大小不同
+	asked.Store(0)
+	_, more := tusCreatePart(t, h, "ghij", "filename", "b.txt", "first", first)
+	tusMerge(h, "b.txt", first, more)
+	if n := asked.Load(); n != 1 {
+		t.Errorf("合并后大小与确认的不同时应重新确认，询问了%d次", n)
+	}
+
+	// 拒绝时不创建部分上传
+	s.SetUploadApprover(func(UploadRequest) (bool, bool) { return false, false })
+	if code, _ := tusCreatePart(t, h, "abc", "filename", "d.txt"); code != http.StatusForbidden {
+		t.Errorf("拒绝后创建部分上传返回 %d", code)
+	}
+}
+
+// TestTusConcatLockOrder 以相反顺序同时合并相同的部分时不会死锁，只有一个请求成功
+func TestTusConcatLockOrder(t *testing.T) {
+	_, h := newRegistryServer(t, 0)
+	for range 20 {
+		_, a := tusCreatePart(t, h, "aa", "filename", "e.txt", "size", "4")
+		_, b := tusCreatePart(t, h, "bb", "filename", "e.txt", "first", a)
+		var wg sync.WaitGroup
+		var created atomic.Int32
+		for _, parts := range [][]string{{a, b}, {b, a}} {
+			wg.Go(func() {
+				if tusMerge(h, "e.txt", parts...) == http.StatusCreated {
+					created.Add(1)
+				}
+			})
+		}
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("同时合并相同的部分时死锁")
+		}
+		if n := created.Load(); n != 1 {
+			t.Errorf("同时合并相同的部分时%d个请求成功，应为1个", n)
+		}
+	}
+}
+
+// TestTusExpiry 响应中带有Upload-Expires；超过期限未写入的上传返回410，清理时删除遗留的过期上传
+func TestTusExpiry(t *testing.T) {
+	s, h := newRegistryServer(t, 0)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, tusRequest(http.MethodPost, tusBasePath, map[string]string{"Upload-Length": "10"}, "", "filename", "a.txt"))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("创建上传返回 %d", w.Code)
+	}
+	expires, err := http.ParseTime(w.Header().Get("Upload-Expires"))
+	if err != nil || time.Until(expires) < partialExpiry-time.Minute {
+		t.Errorf("Upload-Expires为 %q", w.Header().Get("Upload-Expires"))
+	}
+	loc := w.Header().Get("Location")
+	id := loc[strings.LastIndex(loc, "/")+1:]
+
+	dir := filepath.Join(s.UploadDir(), partialDir)
+	old := time.Now().Add(-partialExpiry - time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, id+".part"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if code := serve(h, tusRequest(http.MethodHead, tusBasePath+id, nil, "")); code != http.StatusGone {
+		t.Errorf("过期的上传返回 %d，应为410", code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, id+".part")); !os.IsNotExist(err) {
+		t.Error("过期的上传应被删除")
+	}
+
+	// 服务重启前遗留的上传：过期的删除，最近写入过的保留
+	for name, mtime := range map[string]time.Time{
+		"0a.part": old, "0a.json": old,
+		"0b.part": time.Now(), "0b.json": old,
+		"overwrite-1.part": old,
+	} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(p, mtime, mtime)
+	}
+	s.sweepPartials()
+	entries, _ := os.ReadDir(dir)
+	var left []string
+	for _, e := range entries {
+		left = append(left, e.Name())
+	}
+	if strings.Join(left, " ") != "0b.json 0b.part" {
+		t.Errorf("清理后剩余 %v，应只保留最近写入的上传", left)
+	}
+}
@@ -0,0 +1,475 @@
+package pairserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// WebDAV参数
+const (
+	davPrefix  = "/dav/"
+	davUploads = "uploads" // 根目录中对应上传目录的文件夹，唯一可写入的位置
+)
+
+// davState WebDAV服务状态
+type davState struct {
+	mu           sync.Mutex
+	enabled      bool
+	locks        webdav.LockSystem
+	placeholders map[string]bool // LOCK时新建、尚未写入的空文件，随后对同一路径的PUT直接写入
+}
+
+// davRequest 请求上下文中记录的请求方法和本次请求在上传目录中新建的文件；
+// 请求成功时保存该文件（覆盖时替换原文件），失败或被取消时删除
+type davRequest struct {
+	method  string
+	created *uploadFile
+}
+
+// davRequestKey 请求上下文中的davRequest
+type davRequestKey struct{}
+
+// addPlaceholder 登记LOCK时新建的空文件
+func (d *davState) addPlaceholder(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.placeholders == nil {
+		d.placeholders = make(map[string]bool)
+	}
+	d.placeholders[path] = true
+}
+
+// takePlaceholder 取消path的占位登记，返回它是否为仍然为空的占位文件
+func (d *davState) takePlaceholder(path string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.placeholders[path] {
+		return false
+	}
+	delete(d.placeholders, path)
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode().IsRegular() && info.Size() == 0
+}
+
+// isPlaceholder 返回path是否为已登记的占位文件
+func (d *davState) isPlaceholder(path string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.placeholders[path]
+}
+
+// SetWebDAV 设置是否通过WebDAV提供分享文件、共享目录和上传目录，可在文件管理器中挂载为网络驱动器
+func (s *Server) SetWebDAV(enabled bool) {
+	s.dav.mu.Lock()
+	defer s.dav.mu.Unlock()
+
+	s.dav.enabled = enabled
+}
+
+// WebDAVURL 返回WebDAV的挂载地址，未启用或服务未运行时为空；要求访问令牌时令牌作为路径的一部分，
+// 因为文件管理器挂载时无法附带查询参数和Cookie
+func (s *Server) WebDAVURL(host string) string {
+	s.dav.mu.Lock()
+	enabled := s.dav.enabled
+	s.dav.mu.Unlock()
+
+	s.mu.RLock()
+	running, port, scheme := s.httpServer != nil, s.port, "http"
+	if s.tlsCert != nil {
+		scheme = "https"
+	}
+	s.mu.RUnlock()
+
+	if !enabled || !running {
+		return ""
+	}
+	path := s.sitePath(davPrefix)
+	if token := s.Token(); token != "" {
+		path += token + "/"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, HostPort(host, port), path)
+}
+
+// davHandler WebDAV接口：校验路径中的访问令牌，设置PIN码时要求HTTP基本认证，密码为PIN码；
+// 启用了全局的基本认证时已由requireBasicAuth校验，不再要求PIN码。
+// 上传只能新建文件，不能删除、移动或复制已接收的文件，以免绕过上传确认
+func (s *Server) davHandler(w http.ResponseWriter, r *http.Request) {
+	s.dav.mu.Lock()
+	enabled := s.dav.enabled
+	if s.dav.locks == nil {
+		s.dav.locks = webdav.NewMemLS()
+	}
+	locks := s.dav.locks
+	s.dav.mu.Unlock()
+	if !enabled {
+		http.NotFound(w, r)
+		return
+	}
+	if s.shareExpired() {
+		http.Error(w, "分享链接已过期", http.StatusGone)
+		return
+	}
+
+	// 带路径前缀的请求恢复原始路径，返回的文件地址和移动、复制的目标地址都带有前缀
+	prefix := davPrefix
+	if p := requestPrefix(r); p != "" {
+		r = r.Clone(r.Context())
+		r.URL.Path, r.URL.RawPath = p+r.URL.Path, ""
+		prefix = p + prefix
+	}
+	if token := s.Token(); token != "" {
+		got, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "访问令牌无效，请重新复制WebDAV地址", http.StatusForbidden)
+			return
+		}
+		prefix += token + "/"
+	}
+
+	if _, basic := s.BasicAuth(); basic == "" && s.PIN() != "" {
+		_, password, _ := r.BasicAuth()
+		ok, locked := s.verifyPIN(clientIP(r), password)
+		if locked {
+			http.Error(w, "PIN码输错次数过多，请稍后再试", http.StatusTooManyRequests)
+			return
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="pair-gui", charset="UTF-8"`)
+			http.Error(w, "需要输入PIN码", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if r.Method == "MOVE" || r.Method == "COPY" {
+		http.Error(w, "WebDAV不支持移动和复制文件", http.StatusForbidden)
+		return
+	}
+	fsys := davFS{s}
+	name := strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(prefix, "/"))
+	if r.Method == http.MethodPut {
+		if dir, filename, ok := fsys.uploadTarget(name); ok {
+			placeholder := s.dav.isPlaceholder(filepath.Join(dir, filename))
+			if !placeholder && s.rejectsExisting(dir, filename) {
+				http.Error(w, webStrings(r)["FileExists"], http.StatusConflict)
+				return
+			}
+			if !s.approveRequest(r, filename, r.ContentLength) {
+				fsys.removePlaceholder(name)
+				http.Error(w, webStrings(r)["UploadDenied"], http.StatusForbidden)
+				return
+			}
+			if !ensureSpace(w, r, dir, r.ContentLength) {
+				return
+			}
+		}
+		if limit := s.MaxUploadSize(); limit > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+	}
+	if f, ok := fsys.sharedFile(name); ok && !s.reserveRequestDownload(w, r, f) {
+		return
+	}
+	req := &davRequest{method: r.Method}
+	r = r.WithContext(context.WithValue(r.Context(), davRequestKey{}, req))
+	failed := false
+	h := &webdav.Handler{
+		Prefix:     strings.TrimSuffix(prefix, "/"),
+		FileSystem: fsys,
+		LockSystem: locks,
+		Logger:     func(_ *http.Request, err error) { failed = err != nil },
+	}
+	h.ServeHTTP(w, r)
+
+	t := requestTransfer(r)
+	if req.created != nil && (failed || t != nil && t.canceled()) {
+		// 上传失败或在界面中取消时删除本次新建的文件，覆盖时原文件保持不变
+		s.dav.takePlaceholder(req.created.path)
+		req.created.abort()
+		return
+	}
+	if req.created != nil {
+		if err := req.created.commit(); err != nil {
+			log.Printf("WebDAV保存文件失败（%s）: %v", req.created.path, err)
+			if t != nil {
+				t.fail()
+			}
+			return
+		}
+	}
+	if t == nil {
+		return
+	}
+	if req.created != nil {
+		t.setFile(req.created.path)
+	} else if r.Method != http.MethodPut {
+		fsys.describeTransfer(t, name)
+	}
+}
+
+// davFS 将分享文件、共享目录和上传目录组合为一个虚拟文件系统：
+// 根目录列出分享文件、共享目录和uploads文件夹，只有uploads可写入
+type davFS struct {
+	s *Server
+}
+
+// split 将路径拆分为第一级名称和其余部分
+func (davFS) split(name string) (first, rest string) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	first, rest, _ = strings.Cut(name, "/")
+	return first, rest
+}
+
+// uploads 返回name位于上传目录中时的相对路径
+func (fsys davFS) uploads(name string) (string, bool) {
+	first, rest := fsys.split(name)
+	return "/" + rest, first == davUploads
+}
+
+// uploadTarget 返回name在上传目录中对应的磁盘目录和清理后的文件名
+func (fsys davFS) uploadTarget(name string) (dir, filename string, ok bool) {
+	rel, ok := fsys.uploads(name)
+	if !ok || rel == "/" {
+		return "", "", false
+	}
+	dir = filepath.Join(fsys.s.UploadDir(), filepath.FromSlash(path.Dir(rel)))
+	return dir, sanitizeFilename(path.Base(rel)), true
+}
+
+// create 在上传目录中新建文件，与已接收的文件重名时按重名策略处理；覆盖时先写入临时文件，commit后才替换
+func (fsys davFS) create(name string) (*uploadFile, error) {
+	dir, filename, ok := fsys.uploadTarget(name)
+	if !ok {
+		return nil, os.ErrPermission
+	}
+	return fsys.s.createUpload(dir, filename)
+}
+
+// createUpload 为PUT或LOCK新建上传的文件并记入请求上下文：LOCK时新建的空文件登记为占位，
+// 随后对同一路径的PUT直接写入该文件，其余情况通过create按重名策略新建
+func (fsys davFS) createUpload(ctx context.Context, name string) (*uploadFile, error) {
+	dir, filename, ok := fsys.uploadTarget(name)
+	if !ok {
+		return nil, os.ErrPermission
+	}
+	var f *uploadFile
+	var err error
+	if p := filepath.Join(dir, filename); fsys.s.dav.takePlaceholder(p) {
+		var of *os.File
+		of, err = os.OpenFile(p, os.O_WRONLY|os.O_TRUNC, 0)
+		f = &uploadFile{File: of, path: p}
+	} else {
+		f, err = fsys.create(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if req, ok := ctx.Value(davRequestKey{}).(*davRequest); ok {
+		req.created = f
+		if req.method == "LOCK" {
+			fsys.s.dav.addPlaceholder(f.path)
+		}
+	}
+	return f, nil
+}
+
+// removePlaceholder 删除name对应的、LOCK时新建且尚未写入的占位文件，返回是否删除
+func (fsys davFS) removePlaceholder(name string) bool {
+	dir, filename, ok := fsys.uploadTarget(name)
+	if !ok {
+		return false
+	}
+	p := filepath.Join(dir, filename)
+	return fsys.s.dav.takePlaceholder(p) && os.Remove(p) == nil
+}
+
+// Mkdir 只能在上传目录中新建目录，目录名同样经过清理
+func (fsys davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	dir, dirname, ok := fsys.uploadTarget(name)
+	if !ok {
+		return os.ErrPermission
+	}
+	return os.Mkdir(filepath.Join(dir, dirname), perm)
+}
+
+// OpenFile 打开文件；分享文件和共享目录只读，上传目录中只能新建文件，不能修改已接收的文件
+func (fsys davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	writing := flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0
+	if rel, ok := fsys.uploads(name); ok {
+		if !writing {
+			return webdav.Dir(fsys.s.UploadDir()).OpenFile(ctx, rel, flag, perm)
+		}
+		if flag&os.O_CREATE == 0 {
+			return nil, os.ErrPermission
+		}
+		return fsys.createUpload(ctx, name)
+	}
+	if writing {
+		return nil, os.ErrPermission
+	}
+
+	first, _ := fsys.split(name)
+	if first == "" {
+		return &davRoot{info: davDirInfo{name: "/"}, entries: fsys.rootEntries()}, nil
+	}
+	p, display, err := fsys.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil || display == "" {
+		return f, err
+	}
+	return davSharedFile{File: f, name: display}, nil
+}
+
+// RemoveAll 不能删除已接收的文件，只能删除LOCK时新建、尚未写入的占位文件
+func (fsys davFS) RemoveAll(ctx context.Context, name string) error {
+	if !fsys.removePlaceholder(name) {
+		return os.ErrPermission
+	}
+	return nil
+}
+
+// Rename 不能移动或重命名文件
+func (fsys davFS) Rename(ctx context.Context, oldName, newName string) error {
+	return os.ErrPermission
+}
+
+// Stat 返回文件信息
+func (fsys davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	if rel, ok := fsys.uploads(name); ok {
+		return webdav.Dir(fsys.s.UploadDir()).Stat(ctx, rel)
+	}
+	if first, _ := fsys.split(name); first == "" {
+		return davDirInfo{name: "/"}, nil
+	}
+	p, display, err := fsys.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(p)
+	if err != nil || display == "" {
+		return info, err
+	}
+	return davRenamed{FileInfo: info, name: display}, nil
+}
+
+// resolve 将分享文件或共享目录中的路径解析为磁盘上的路径；分享文件另外返回分享时的文件名
+func (fsys davFS) resolve(name string) (p, display string, err error) {
+	first, rest := fsys.split(name)
+	if f, ok := fsys.s.findFile(first); ok {
+		if rest != "" || f.Protected() {
+			return "", "", os.ErrNotExist
+		}
+		return f.AbsPath, f.Filename, nil
+	}
+	p, err = fsys.s.resolveShared(first + "/" + rest)
+	return p, "", err
+}
+
+// sharedFile 返回name对应的分享文件，用于预留下载次数
+func (fsys davFS) sharedFile(name string) (File, bool) {
+	if _, ok := fsys.uploads(name); ok {
+		return File{}, false
+	}
+	first, rest := fsys.split(name)
+	f, ok := fsys.s.findFile(first)
+	if !ok || rest != "" || f.Protected() {
+		return File{}, false
+	}
+	return f, true
+}
+
+// describeTransfer 将传输对应的磁盘文件记入传输登记，name不是文件时忽略
+func (fsys davFS) describeTransfer(t *transfer, name string) {
+	if rel, ok := fsys.uploads(name); ok {
+		t.setFile(filepath.Join(fsys.s.UploadDir(), filepath.FromSlash(path.Clean("/"+rel))))
+	} else if p, _, err := fsys.resolve(name); err == nil {
+		t.setFile(p)
+	}
+}
+
+// rootEntries 返回根目录的内容
+func (fsys davFS) rootEntries() []os.FileInfo {
+	entries := []os.FileInfo{davDirInfo{name: davUploads}}
+	for _, f := range fsys.s.publicFiles() {
+		if info, err := os.Stat(f.AbsPath); err == nil {
+			entries = append(entries, davRenamed{FileInfo: info, name: f.Filename})
+		}
+	}
+	for _, d := range fsys.s.Dirs() {
+		if d.Name != davUploads {
+			entries = append(entries, davDirInfo{name: d.Name})
+		}
+	}
+	return entries
+}
+
+// davRoot 虚拟根目录
+type davRoot struct {
+	info    davDirInfo
+	entries []os.FileInfo
+	read    bool
+}
+
+func (d *davRoot) Close() error                   { return nil }
+func (d *davRoot) Read([]byte) (int, error)       { return 0, os.ErrInvalid }
+func (d *davRoot) Write([]byte) (int, error)      { return 0, os.ErrPermission }
+func (d *davRoot) Seek(int64, int) (int64, error) { return 0, nil }
+func (d *davRoot) Stat() (os.FileInfo, error)     { return d.info, nil }
+func (d *davRoot) Readdir(count int) ([]os.FileInfo, error) {
+	if d.read {
+		return nil, nil
+	}
+	d.read = true
+	return d.entries, nil
+}
+
+// davDirInfo 虚拟目录的文件信息
+type davDirInfo struct {
+	name string
+}
+
+func (i davDirInfo) Name() string       { return i.name }
+func (i davDirInfo) Size() int64        { return 0 }
+func (i davDirInfo) Mode() os.FileMode  { return fs.ModeDir | 0o555 }
+func (i davDirInfo) ModTime() time.Time { return time.Time{} }
+func (i davDirInfo) IsDir() bool        { return true }
+func (i davDirInfo) Sys() any           { return nil }
+
+// davRenamed 以分享时的文件名显示的文件信息
+type davRenamed struct {
+	os.FileInfo
+	name string
+}
+
+func (i davRenamed) Name() string { return i.name }
+
+// davSharedFile 以分享时的文件名显示的分享文件
+type davSharedFile struct {
+	*os.File
+	name string
+}
+
+func (f davSharedFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return davRenamed{FileInfo: info, name: f.name}, nil
+}
@@ -0,0 +1,128 @@
+package pairserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newDAVTestServer 启动上传目录为dir、启用WebDAV的服务
+func newDAVTestServer(t *testing.T, s *Server, dir string) *httptest.Server {
+	t.Helper()
+	s.SetUploadDir(dir)
+	s.SetWebDAV(true)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// davDo 发送WebDAV请求，返回状态码
+func davDo(t *testing.T, method, url, body string, header ...string) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// TestDAVUpload 上传只能新建文件，不能覆盖、删除、移动或复制已接收的文件
+func TestDAVUpload(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := New()
+	s.SetConflictPolicy(ConflictRename)
+	ts := newDAVTestServer(t, s, dir)
+	base := ts.URL + davPrefix + davUploads + "/"
+	read := func(name string) string {
+		data, _ := os.ReadFile(filepath.Join(dir, name))
+		return string(data)
+	}
+
+	if code := davDo(t, http.MethodPut, base+"a.txt", "new"); code != http.StatusCreated {
+		t.Fatalf("上传状态码为%d", code)
+	}
+	if read("a.txt") != "old" || read("a (1).txt") != "new" {
+		t.Errorf("重名时应另存为新文件，a.txt为%q", read("a.txt"))
+	}
+	if code := davDo(t, http.MethodPut, base+"b%3Cc%3E.txt", "x"); code != http.StatusCreated || read("b_c_.txt") != "x" {
+		t.Errorf("文件名应经过清理，状态码为%d", code)
+	}
+
+	tests := []struct {
+		method string
+		header []string
+	}{
+		{"DELETE", nil},
+		{"MOVE", []string{"Destination", base + "z.exe"}},
+		{"COPY", []string{"Destination", base + "z.exe"}},
+		{"PROPPATCH", nil},
+	}
+	for _, tt := range tests {
+		if code := davDo(t, tt.method, base+"a.txt", "", tt.header...); code < 400 {
+			t.Errorf("%s 状态码为%d，应被拒绝", tt.method, code)
+		}
+	}
+	if read("a.txt") != "old" || read("z.exe") != "" {
+		t.Error("已接收的文件不应被删除、移动或复制")
+	}
+
+	// 超过大小限制时删除本次新建的文件
+	s.SetMaxUploadSize(4)
+	if code := davDo(t, http.MethodPut, base+"big.txt", "0123456789"); code < 400 {
+		t.Errorf("超过大小限制时状态码为%d", code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "big.txt")); !os.IsNotExist(err) {
+		t.Error("超过大小限制的新文件应被删除")
+	}
+	s.SetMaxUploadSize(0)
+
+	s.SetConflictPolicy(ConflictReject)
+	if code := davDo(t, http.MethodPut, base+"a.txt", "new"); code != http.StatusConflict || read("a.txt") != "old" {
+		t.Errorf("重名策略为拒绝时状态码为%d，应为409", code)
+	}
+}
+
+// TestDAVLockThenPut 先LOCK再PUT时写入LOCK新建的空文件，不另存为新文件
+func TestDAVLockThenPut(t *testing.T) {
+	dir := t.TempDir()
+	s := New()
+	s.SetConflictPolicy(ConflictRename)
+	ts := newDAVTestServer(t, s, dir)
+	url := ts.URL + davPrefix + davUploads + "/c.txt"
+
+	lock := `<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockinfo>`
+	req, _ := http.NewRequest("LOCK", url, strings.NewReader(lock))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	token := resp.Header.Get("Lock-Token")
+	if resp.StatusCode != http.StatusCreated || token == "" {
+		t.Fatalf("LOCK状态码为%d", resp.StatusCode)
+	}
+	if code := davDo(t, http.MethodPut, url, "data", "If", "("+token+")"); code != http.StatusCreated {
+		t.Fatalf("PUT状态码为%d", code)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("上传目录中有%d个文件，应只有c.txt", len(entries))
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "c.txt")); string(data) != "data" {
+		t.Errorf("c.txt的内容为%q", data)
+	}
+}
@@ -0,0 +1,90 @@
+package pairserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// webhookTimeout 单次Webhook请求的超时时间
+const webhookTimeout = 10 * time.Second
+
+// webhookClient 发送Webhook请求的HTTP客户端
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// webhookPayload Webhook请求的JSON内容：事件的全部字段，另附一句便于聊天机器人直接转发的说明
+type webhookPayload struct {
+	Event
+	Text string `json:"text"`
+}
+
+// SetWebhooks 设置上传完成或文件被下载时通知的URL，为空表示不通知；忽略空行
+func (s *Server) SetWebhooks(urls []string) error {
+	var list []string
+	for _, u := range urls {
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("无效的Webhook地址: %s", u)
+		}
+		list = append(list, u)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.webhooks = list
+	return nil
+}
+
+// notifyWebhooks 将完成的上传或下载以JSON POST发送到全部Webhook地址，在后台发送，失败只记录日志
+func (s *Server) notifyWebhooks(typ string, e HistoryEntry) {
+	s.mu.RLock()
+	urls := s.webhooks
+	s.mu.RUnlock()
+	if len(urls) == 0 || e.Result != HistoryCompleted {
+		return
+	}
+
+	body, err := json.Marshal(webhookPayload{
+		Event: Event{Type: typ, Time: e.Time, Data: e},
+		Text:  webhookText(e),
+	})
+	if err != nil {
+		log.Printf("生成Webhook内容失败: %v", err)
+		return
+	}
+	for _, u := range urls {
+		go func(u string) {
+			resp, err := webhookClient.Post(u, "application/json", bytes.NewReader(body))
+			if err != nil {
+				log.Printf("发送Webhook失败: %v", err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= http.StatusBadRequest {
+				log.Printf("Webhook %s 返回 %s", u, resp.Status)
+			}
+		}(u)
+	}
+}
+
+// webhookText 返回记录的简短说明，如“收到 photo.jpg（3.2 MB），来自 192.168.1.23”
+func webhookText(e HistoryEntry) string {
+	peer := e.ClientIP
+	if e.ClientName != "" {
+		peer = e.ClientName + "（" + e.ClientIP + "）"
+	}
+	if e.Direction == TransferDownload {
+		return fmt.Sprintf("%s（%s）已被 %s 下载", e.Filename, formatSize(e.Size), peer)
+	}
+	return fmt.Sprintf("收到 %s（%s），来自 %s", e.Filename, formatSize(e.Size), peer)
+}
@@ -0,0 +1,400 @@
+package pairserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Web Push通知：手机浏览器订阅后，分享列表中出现新文件或该设备的上传完成时，
+// 即使页面在后台也能收到系统通知。按RFC 8292(VAPID)签名请求、RFC 8291加密内容，
+// 经浏览器厂商的推送服务送达，因此电脑需要能访问互联网，手机浏览器需要HTTPS（受信任的证书）
+const (
+	maxPushSubscriptions = 100              // 最多保存的订阅数
+	webPushTTL           = 12 * time.Hour   // 推送服务为离线设备保留通知的时间
+	webPushTimeout       = 30 * time.Second // 发送一条通知的超时
+	webPushRecordSize    = 4096             // 加密内容的记录大小
+	webPushSubject       = "mailto:pair-gui@localhost"
+)
+
+// pushSubscription 一个浏览器的推送订阅
+type pushSubscription struct {
+	Endpoint string
+	P256DH   []byte // 浏览器的ECDH公钥
+	Auth     []byte // 浏览器的认证密钥
+	IP       string // 订阅时的客户端IP，用于只通知上传的设备
+	Lang     string // 订阅时页面的语言
+}
+
+// webPushState Web Push的密钥和订阅
+type webPushState struct {
+	mu       sync.Mutex
+	key      *ecdsa.PrivateKey // VAPID密钥，首次使用时生成，重启后浏览器需要重新订阅
+	subs     map[string]pushSubscription
+	watching bool            // 是否已开始监听服务事件
+	shared   map[string]bool // 已通知过的分享文件和目录
+}
+
+// vapidKey 返回VAPID密钥，首次调用时生成
+func (s *Server) vapidKey() (*ecdsa.PrivateKey, error) {
+	s.webPush.mu.Lock()
+	defer s.webPush.mu.Unlock()
+
+	if s.webPush.key == nil {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		s.webPush.key = key
+	}
+	return s.webPush.key, nil
+}
+
+// vapidPublicKey 返回VAPID公钥的未压缩形式，供浏览器订阅时作为applicationServerKey
+func vapidPublicKey(key *ecdsa.PrivateKey) []byte {
+	pub, err := key.PublicKey.ECDH()
+	if err != nil {
+		return nil
+	}
+	return pub.Bytes()
+}
+
+// webPushKeyHandler 返回VAPID公钥(base64url)
+func (s *Server) webPushKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := s.vapidKey()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("生成密钥失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"key": base64.RawURLEncoding.EncodeToString(vapidPublicKey(key))})
+}
+
+// webPushSubscribeHandler 保存(POST)或删除(DELETE)浏览器的推送订阅，请求体为PushSubscription.toJSON()的结果
+func (s *Server) webPushSubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "仅支持POST和DELETE方法", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.checkCSRF(w, r) {
+		return
+	}
+	var body struct {
+		Endpoint string `json:"endpoint"`
+		Keys     struct {
+			P256DH string `json:"p256dh"`
+			Auth   string `json:"auth"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 8<<10)).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("解析订阅失败: %v", err), http.StatusBadRequest)
+		return
+	}
+	// 推送服务只能是公网上的HTTPS地址，以免借订阅让电脑向局域网或本机的其他服务发送请求；
+	// 这里先检查域名解析的结果，发送时webPushClient在连接前再检查一次
+	if u, err := url.Parse(body.Endpoint); err != nil || u.Scheme != "https" || u.Host == "" || !resolvesPublic(r.Context(), u.Hostname()) {
+		http.Error(w, "无效的订阅地址", http.StatusBadRequest)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		s.webPush.mu.Lock()
+		delete(s.webPush.subs, body.Endpoint)
+		s.webPush.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	p256dh, err1 := base64.RawURLEncoding.DecodeString(strings.TrimRight(body.Keys.P256DH, "="))
+	auth, err2 := base64.RawURLEncoding.DecodeString(strings.TrimRight(body.Keys.Auth, "="))
+	if err1 != nil || err2 != nil || len(auth) != 16 {
+		http.Error(w, "无效的订阅密钥", http.StatusBadRequest)
+		return
+	}
+	if _, err := ecdh.P256().NewPublicKey(p256dh); err != nil {
+		http.Error(w, "无效的订阅密钥", http.StatusBadRequest)
+		return
+	}
+
+	s.webPush.mu.Lock()
+	if s.webPush.subs == nil {
+		s.webPush.subs = make(map[string]pushSubscription)
+	}
+	if _, ok := s.webPush.subs[body.Endpoint]; !ok && len(s.webPush.subs) >= maxPushSubscriptions {
+		s.webPush.mu.Unlock()
+		http.Error(w, "订阅数已达上限", http.StatusServiceUnavailable)
+		return
+	}
+	s.webPush.subs[body.Endpoint] = pushSubscription{
+		Endpoint: body.Endpoint, P256DH: p256dh, Auth: auth, IP: clientIP(r), Lang: negotiateLanguage(r),
+	}
+	start := !s.webPush.watching
+	s.webPush.watching = true
+	s.webPush.mu.Unlock()
+
+	if start {
+		go s.watchWebPush()
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sharedNames 返回当前分享的文件和目录名称
+func (s *Server) sharedNames() map[string]bool {
+	names := make(map[string]bool)
+	for _, f := range s.Files() {
+		names[f.Filename] = true
+	}
+	for _, d := range s.Dirs() {
+		names[d.Name+"/"] = true
+	}
+	return names
+}
+
+// watchWebPush 监听服务事件并发送通知：新分享的文件通知全部订阅者，上传完成只通知上传的设备。
+// 在第一个订阅时启动，之后一直运行
+func (s *Server) watchWebPush() {
+	events, _ := s.Subscribe()
+	shared := s.sharedNames()
+	s.webPush.mu.Lock()
+	s.webPush.shared = shared
+	s.webPush.mu.Unlock()
+	for e := range events {
+		switch e.Type {
+		case EventFilesChanged:
+			current := s.sharedNames()
+			s.webPush.mu.Lock()
+			var added []string
+			for name := range current {
+				if !s.webPush.shared[name] {
+					added = append(added, name)
+				}
+			}
+			s.webPush.shared = current
+			s.webPush.mu.Unlock()
+			if len(added) > 0 {
+				s.sendWebPush("", "PushNewFiles", strings.Join(added, ", "), "download-page")
+			}
+		case EventUploadFinished:
+			entry, ok := e.Data.(HistoryEntry)
+			if ok && entry.Result == HistoryCompleted {
+				s.sendWebPush(entry.ClientIP, "PushUploadDone", entry.Filename, "./")
+			}
+		}
+	}
+}
+
+// sendWebPush 向订阅者发送通知，ip非空时只发送给该IP的订阅者；key为通知标题的网页字符串，
+// link为点击后打开的页面，相对于网页的根目录
+func (s *Server) sendWebPush(ip, key, body, link string) {
+	vapid, err := s.vapidKey()
+	if err != nil {
+		return
+	}
+	s.webPush.mu.Lock()
+	var targets []pushSubscription
+	for _, sub := range s.webPush.subs {
+		if ip == "" || sub.IP == ip {
+			targets = append(targets, sub)
+		}
+	}
+	s.webPush.mu.Unlock()
+
+	for _, sub := range targets {
+		payload, _ := json.Marshal(map[string]string{
+			"title": webMessages[sub.Lang][key], "body": body, "url": link, "tag": key,
+		})
+		go func() {
+			gone, err := deliverWebPush(vapid, sub, payload)
+			if gone {
+				// 浏览器已取消订阅
+				s.webPush.mu.Lock()
+				delete(s.webPush.subs, sub.Endpoint)
+				s.webPush.mu.Unlock()
+				return
+			}
+			if err != nil {
+				log.Printf("发送推送通知失败: %v", err)
+			}
+		}()
+	}
+}
+
+// deliverWebPush 加密通知内容并发送到推送服务；订阅已失效(404/410)时返回gone为true
+func deliverWebPush(vapid *ecdsa.PrivateKey, sub pushSubscription, payload []byte) (gone bool, err error) {
+	body, err := encryptWebPush(sub, payload)
+	if err != nil {
+		return false, err
+	}
+	u, err := url.Parse(sub.Endpoint)
+	if err != nil {
+		return false, err
+	}
+	token, err := vapidToken(vapid, u.Scheme+"://"+u.Host)
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", fmt.Sprint(int(webPushTTL.Seconds())))
+	req.Header.Set("Urgency", "normal")
+	req.Header.Set("Authorization", "vapid t="+token+", k="+base64.RawURLEncoding.EncodeToString(vapidPublicKey(vapid)))
+
+	resp, err := webPushClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return true, nil
+	case resp.StatusCode/100 != 2:
+		return false, fmt.Errorf("%s: %s", u.Host, resp.Status)
+	}
+	return false, nil
+}
+
+// webPushClient 发送通知的HTTP客户端，只连接公网地址。订阅地址由手机提交，连接时检查解析后的地址，
+// 域名在订阅后改为解析到内网地址时同样拒绝；不使用代理，以免代理替电脑访问内网
+var webPushClient = &http.Client{
+	Timeout: webPushTimeout,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: webPushTimeout, Control: dialPublicOnly}).DialContext,
+		TLSHandshakeTimeout: webPushTimeout,
+	},
+}
+
+// dialPublicOnly 作为net.Dialer的Control，拒绝连接非公网地址
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("推送服务地址 %s 不是公网地址", host)
+	}
+	return nil
+}
+
+// resolvesPublic 返回host解析出的地址是否全部为公网地址
+func resolvesPublic(ctx context.Context, host string) bool {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil || len(ips) == 0 {
+		return false
+	}
+	for _, ip := range ips {
+		if !isPublicIP(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// isPublicIP 返回ip是否为公网地址：排除本机、内网、链路本地、运营商级NAT等地址
+func isPublicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !isSharedAddress(ip)
+}
+
+// vapidToken 生成VAPID的JWT(ES256)，aud为推送服务的源
+func vapidToken(key *ecdsa.PrivateKey, aud string) (string, error) {
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]any{
+		"aud": aud, "exp": time.Now().Add(webPushTTL).Unix(), "sub": webPushSubject,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, sig, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	// JWS要求签名为定长的r||s，而不是ASN.1编码
+	raw := make([]byte, 64)
+	r.FillBytes(raw[:32])
+	sig.FillBytes(raw[32:])
+	return unsigned + "." + enc.EncodeToString(raw), nil
+}
+
+// encryptWebPush 按RFC 8291加密通知内容(aes128gcm)，只使用一条记录
+func encryptWebPush(sub pushSubscription, payload []byte) ([]byte, error) {
+	if len(payload)+17 > webPushRecordSize-86 {
+		return nil, errors.New("通知内容过长")
+	}
+	curve := ecdh.P256()
+	uaPublic, err := curve.NewPublicKey(sub.P256DH)
+	if err != nil {
+		return nil, err
+	}
+	asPrivate, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	keyInfo := "WebPush: info\x00" + string(sub.P256DH) + string(asPublic)
+	ikm, err := hkdf.Key(sha256.New, secret, sub.Auth, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// 头部：salt、记录大小、发送方公钥；内容末尾的0x02表示最后一条记录
+	var buf bytes.Buffer
+	buf.Write(salt)
+	binary.Write(&buf, binary.BigEndian, uint32(webPushRecordSize))
+	buf.WriteByte(byte(len(asPublic)))
+	buf.Write(asPublic)
+	return gcm.Seal(buf.Bytes(), nonce, append(payload, 0x02), nil), nil
+}
@@ -0,0 +1,40 @@
+package pairserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestWebPushEndpoint 订阅地址和发送时连接的地址只能是公网地址
+func TestWebPushEndpoint(t *testing.T) {
+	_, h := newRegistryServer(t, 0)
+	for _, endpoint := range []string{
+		"http://push.example.com/x",
+		"https://192.168.1.1/x",
+		"https://127.0.0.1:8080/x",
+		"https://[::1]/x",
+		"https://169.254.169.254/latest",
+		"https://100.64.0.1/x",
+		"https://localhost/x",
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/webpush/subscribe", strings.NewReader(`{"endpoint":"`+endpoint+`"}`))
+		if code := serve(h, r); code != http.StatusBadRequest {
+			t.Errorf("订阅地址 %s 返回 %d，应为400", endpoint, code)
+		}
+	}
+
+	for addr, ok := range map[string]bool{
+		"10.0.0.1:443":          false,
+		"127.0.0.1:443":         false,
+		"[fe80::1]:443":         false,
+		"[::ffff:c0a8:101]:443": false,
+		"8.8.8.8:443":           true,
+		"[2001:4860::1]:443":    true,
+	} {
+		if err := dialPublicOnly("tcp", addr, nil); (err == nil) != ok {
+			t.Errorf("dialPublicOnly(%s) = %v", addr, err)
+		}
+	}
+}
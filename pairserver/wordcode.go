@@ -0,0 +1,168 @@
+package pairserver
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// codePrefix 配对码跳转的路径前缀，如 /c/7-tiger-lamp
+const codePrefix = "/c/"
+
+// 配对码的全局输错限制：按IP锁定挡不住使用大量地址的猜测，因此另外限制全部客户端在一个时段内的输错次数，
+// 超过后暂停配对码，仍可扫码访问。每10分钟20次，猜中平均需要半年以上
+const (
+	maxWordCodeFailures = 20
+	wordCodeWindow      = 10 * time.Minute
+)
+
+// codeWords 配对码使用的单词，共256个，配对码约有65万种组合，配合输错限制足以防止猜测
+var codeWords = []string{
+	"acorn", "anchor", "apple", "arrow", "badge", "baker", "bamboo", "banjo", "basil", "basket",
+	"beach", "beetle", "bell", "berry", "bird", "biscuit", "blade", "bloom", "blossom", "boat",
+	"bone", "book", "bottle", "brick", "bridge", "brush", "bubble", "bucket", "button", "cabin",
+	"cable", "cactus", "camel", "candle", "candy", "canoe", "canyon", "carrot", "castle", "cedar",
+	"cereal", "chalk", "cherry", "chess", "cloud", "clover", "cobra", "comet", "cookie", "copper",
+	"coral", "cotton", "crane", "crayon", "cricket", "crown", "cup", "daisy", "desert", "dolphin",
+	"donkey", "dove", "dragon", "drum", "dune", "eagle", "echo", "elbow", "ember", "emerald",
+	"engine", "falcon", "feather", "fern", "fiddle", "field", "fig", "flag", "flame", "flute",
+	"forest", "fork", "fossil", "fox", "frog", "garden", "garlic", "gecko", "ginger", "glacier",
+	"globe", "goat", "grape", "guitar", "hammer", "harbor", "hat", "hawk", "hazel", "helmet",
+	"heron", "honey", "horse", "iris", "island", "ivory", "jacket", "jade", "jar", "jelly",
+	"jungle", "kettle", "kite", "kiwi", "koala", "ladder", "lake", "lamp", "lantern", "leaf",
+	"lemon", "lily", "lion", "lizard", "llama", "lotus", "magnet", "mango", "map", "maple",
+	"marble", "meadow", "melon", "mint", "mirror", "moon", "moose", "mountain", "mouse", "mule",
+	"mushroom", "needle", "nest", "noodle", "nut", "oak", "ocean", "olive", "onion", "orange",
+	"orbit", "otter", "owl", "oyster", "paddle", "panda", "paper", "parrot", "peach", "peanut",
+	"pearl", "pebble", "pencil", "pepper", "petal", "piano", "pigeon", "pillow", "pilot", "pine",
+	"planet", "plum", "pocket", "pony", "poppy", "potato", "prism", "pumpkin", "puzzle", "quail",
+	"quartz", "rabbit", "radio", "rain", "raven", "reed", "reef", "ribbon", "rice", "river",
+	"robin", "rocket", "rose", "ruby", "saddle", "sail", "salmon", "sand", "saturn", "scarf",
+	"seal", "seed", "shark", "shell", "ship", "silver", "sky", "sled", "snail", "snow", "sock",
+	"spice", "spider", "sponge", "spoon", "spruce", "squash", "squid", "stamp", "star", "stone",
+	"storm", "sugar", "sun", "swan", "table", "tea", "thistle", "thunder", "tiger", "timber",
+	"toad", "toast", "tomato", "torch", "tower", "train", "tulip", "turtle", "umbrella", "valley",
+	"velvet", "violin", "wagon", "walnut", "water", "wave", "whale", "wheat", "whistle", "willow",
+	"window", "wolf", "wool", "yarn", "zebra",
+}
+
+// randomIndex 返回[0, n)中的随机数
+func randomIndex(n int) int {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		panic(err)
+	}
+	return int(v.Int64())
+}
+
+// newWordCode 生成形如 7-tiger-lamp 的配对码：一位数字加两个单词
+func newWordCode() string {
+	return fmt.Sprintf("%d-%s-%s", randomIndex(10), codeWords[randomIndex(len(codeWords))], codeWords[randomIndex(len(codeWords))])
+}
+
+// WordCode 返回本次服务的配对码，无法扫码时可在浏览器中输入 /c/配对码 代替完整的访问地址
+func (s *Server) WordCode() string {
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+
+	return s.auth.code
+}
+
+// WordCodeURL 返回使用指定主机的配对码地址，服务未运行或配对码不可用时为空
+func (s *Server) WordCodeURL(host string) string {
+	if s.publiclyExposed() {
+		return ""
+	}
+	s.mu.RLock()
+	running, port, scheme := s.httpServer != nil, s.port, "http"
+	if s.tlsCert != nil {
+		scheme = "https"
+	}
+	s.mu.RUnlock()
+
+	code := s.WordCode()
+	if !running || code == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s://%s%s%s%s", scheme, HostPort(host, port), s.PathPrefix(), codePrefix, code)
+}
+
+// resetWordCode 服务启动时生成新的配对码，旧配对码随之失效
+func (s *Server) resetWordCode() {
+	code := newWordCode()
+
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+
+	s.auth.code = code
+}
+
+// publiclyExposed 返回服务是否通过端口映射或洋葱服务从外网访问。
+// 配对码跳转后的地址含访问令牌，外网的猜测者远多于局域网，此时不提供配对码，
+// Tor的访问者都记为onionClientIP，按IP锁定也会殃及全部访问者
+func (s *Server) publiclyExposed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.portMap != nil || s.onion != nil
+}
+
+// wordCodeLimited 返回全部客户端输错配对码的次数是否已达上限，时段结束后清零，调用时须持有s.auth.mu
+func (s *Server) wordCodeLimited(now time.Time) bool {
+	if now.After(s.auth.codeReset) {
+		s.auth.codeFailures, s.auth.codeReset = 0, now.Add(wordCodeWindow)
+	}
+	return s.auth.codeFailures >= maxWordCodeFailures
+}
+
+// wordCodeHandler 配对码跳转：配对码正确时跳转到与二维码相同的页面（含访问令牌），
+// 与PIN码共用按IP的输错次数限制，另有全局的输错次数限制；/c/ 不带配对码时显示输入页面。
+// 从外网访问时配对码不可用
+func (s *Server) wordCodeHandler(w http.ResponseWriter, r *http.Request) {
+	T := webStrings(r)
+	if s.publiclyExposed() {
+		s.wordCodePage(w, r, http.StatusNotFound, T["WordCodeDisabled"])
+		return
+	}
+
+	code := strings.TrimPrefix(r.URL.Path, codePrefix)
+	if code == "" {
+		code = r.URL.Query().Get("code")
+	}
+	code = strings.ToLower(strings.TrimSpace(code))
+	if code == "" {
+		s.wordCodePage(w, r, http.StatusOK, "")
+		return
+	}
+
+	s.auth.mu.Lock()
+	ok, locked := false, s.wordCodeLimited(time.Now())
+	if !locked {
+		ok, locked = s.matchSecret(clientIP(r), code, s.auth.code)
+		if !ok && !locked {
+			s.auth.codeFailures++
+		}
+	}
+	s.auth.mu.Unlock()
+
+	switch {
+	case locked:
+		s.wordCodePage(w, r, http.StatusTooManyRequests, T["PinLocked"])
+	case !ok:
+		s.wordCodePage(w, r, http.StatusNotFound, T["WordCodeWrong"])
+	default:
+		http.Redirect(w, r, s.sitePath(s.entryPath()), http.StatusSeeOther)
+	}
+}
+
+// wordCodePage 以状态码status显示配对码输入页面，errMsg非空时显示错误提示
+func (s *Server) wordCodePage(w http.ResponseWriter, r *http.Request, status int, errMsg string) {
+	data := struct {
+		T     map[string]string
+		Error string
+	}{T: webStrings(r), Error: errMsg}
+	s.renderPage(w, status, "word-code.html", data)
+}
@@ -0,0 +1,563 @@
+package pairserver
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// magic-wormhole传输：与wormhole命令行程序和各种兼容客户端使用的协议相同，经公共邮箱服务器用简短的代码
+// 配对，文件经公共传输中继转发，双方不在同一网络或位于NAT之后也能传输。数据端到端加密，服务器和中继无法解密
+
+// WormholeServer magic-wormhole使用的服务器
+type WormholeServer struct {
+	Mailbox string // 邮箱服务器的WebSocket地址，如 ws://relay.magic-wormhole.io:4000/v1
+	Transit string // 传输中继地址，如 transit.magic-wormhole.io:4001
+}
+
+// DefaultWormholeServer wormhole命令行程序默认使用的公共服务器
+var DefaultWormholeServer = WormholeServer{
+	Mailbox: "ws://relay.magic-wormhole.io:4000/v1",
+	Transit: "transit.magic-wormhole.io:4001",
+}
+
+// ErrWormholeCode wormhole代码格式不正确
+var ErrWormholeCode = errors.New("wormhole代码格式不正确，应如 7-apple-river")
+
+// wormholeDirName 发送多个文件时打包成的目录名
+const wormholeDirName = "pair-gui"
+
+// wormholeMessage 文件传输中双方交换的消息，每条只有一个字段
+type wormholeMessage struct {
+	Transit *wormholeTransitInfo `json:"transit,omitempty"`
+	Offer   *wormholeOffer       `json:"offer,omitempty"`
+	Answer  *wormholeAnswer      `json:"answer,omitempty"`
+	Error   string               `json:"error,omitempty"`
+}
+
+// wormholeOffer 发送方要发送的内容：文本、单个文件或打包成ZIP的目录
+type wormholeOffer struct {
+	Message   *string            `json:"message,omitempty"`
+	File      *wormholeFileOffer `json:"file,omitempty"`
+	Directory *wormholeDirOffer  `json:"directory,omitempty"`
+}
+
+// size 返回传输的字节数
+func (o *wormholeOffer) size() int64 {
+	if o.Directory != nil {
+		return o.Directory.Zipsize
+	}
+	return o.File.Filesize
+}
+
+// wormholeFileOffer 单个文件
+type wormholeFileOffer struct {
+	Filename string `json:"filename"`
+	Filesize int64  `json:"filesize"`
+}
+
+// wormholeDirOffer 打包成ZIP的目录
+type wormholeDirOffer struct {
+	Mode     string `json:"mode"`     // 打包格式，只有zipfile/deflated
+	Dirname  string `json:"dirname"`  // 目录名
+	Zipsize  int64  `json:"zipsize"`  // ZIP文件的大小，即传输的字节数
+	Numbytes int64  `json:"numbytes"` // 解压后的总大小
+	Numfiles int    `json:"numfiles"` // 文件数
+}
+
+// wormholeAnswer 接收方同意接收
+type wormholeAnswer struct {
+	FileAck string `json:"file_ack,omitempty"`
+}
+
+// wormholeAck 接收方收完数据后经传输连接发回的确认
+type wormholeAck struct {
+	Ack    string `json:"ack"`
+	SHA256 string `json:"sha256"`
+}
+
+// validWormholeCode 检查代码是否为数字名牌加上口令，如 7-apple-river
+func validWormholeCode(code string) bool {
+	nameplate, words, ok := strings.Cut(code, "-")
+	return ok && nameplate != "" && words != "" && strings.Trim(nameplate, "0123456789") == "" && !strings.ContainsAny(code, " \t")
+}
+
+// WormholeSend 通过magic-wormhole发送文件：向邮箱服务器申请代码并交给onCode显示，对方输入代码接收完毕后返回。
+// 单个文件直接发送，多个文件与wormhole命令行程序发送目录时一样打包为ZIP。
+// progress非nil时在发送过程中报告已发送和总字节数
+func WormholeSend(ctx context.Context, srv WormholeServer, files []File, onCode func(code string), progress func(sent, total int64)) (err error) {
+	if len(files) == 0 {
+		return errors.New("没有要发送的文件")
+	}
+	payload, offer, err := wormholePayload(files)
+	if err != nil {
+		return err
+	}
+	if offer.Directory != nil {
+		defer os.Remove(payload)
+	}
+	info, err := newWormholeTransitInfo(srv.Transit)
+	if err != nil {
+		return err
+	}
+
+	mb, err := dialWormholeMailbox(ctx, srv.Mailbox)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			mb.close("errory")
+		} else {
+			mb.close("happy")
+		}
+	}()
+	fail := func(err error) error {
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	nameplate, err := mb.allocate()
+	if err != nil {
+		return fail(err)
+	}
+	code := fmt.Sprintf("%s-%s-%s", nameplate, codeWords[randomIndex(len(codeWords))], codeWords[randomIndex(len(codeWords))])
+	if onCode != nil {
+		onCode(code)
+	}
+	ws, err := mb.connect(code)
+	if err != nil {
+		return fail(err)
+	}
+	if err := ws.sendJSON(wormholeMessage{Transit: info}); err != nil {
+		return fail(err)
+	}
+	if err := ws.sendJSON(wormholeMessage{Offer: offer}); err != nil {
+		return fail(err)
+	}
+
+	// 等待接收方同意，期间收到的中继地址也用于连接
+	relays := []string{srv.Transit}
+	for accepted := false; !accepted; {
+		var m wormholeMessage
+		if err := ws.receiveJSON(&m); err != nil {
+			return fail(err)
+		}
+		switch {
+		case m.Error != "":
+			return fmt.Errorf("wormhole接收方出错: %s", m.Error)
+		case m.Transit != nil:
+			relays = m.Transit.addRelays(relays)
+		case m.Answer != nil:
+			if m.Answer.FileAck != "ok" {
+				return errors.New("wormhole接收方拒绝接收")
+			}
+			accepted = true
+		}
+	}
+
+	t, err := connectWormholeTransit(ctx, relays, ws.transitKey(), true)
+	if err != nil {
+		return fail(err)
+	}
+	defer t.Close()
+	return fail(sendWormholeFile(t, payload, offer.size(), progress))
+}
+
+// wormholePayload 返回要发送的文件和对应的offer：单个文件直接发送，
+// 多个文件打包为临时ZIP文件作为目录发送，由调用方删除
+func wormholePayload(files []File) (string, *wormholeOffer, error) {
+	if len(files) == 1 {
+		info, err := os.Stat(files[0].AbsPath)
+		if err != nil {
+			return "", nil, err
+		}
+		return files[0].AbsPath, &wormholeOffer{File: &wormholeFileOffer{Filename: files[0].Filename, Filesize: info.Size()}}, nil
+	}
+
+	tmp, err := os.CreateTemp("", "pair-gui-wormhole-*.zip")
+	if err != nil {
+		return "", nil, err
+	}
+	defer tmp.Close()
+	numbytes, err := writeWormholeZip(tmp, files)
+	var size int64
+	if err == nil {
+		size, err = tmp.Seek(0, io.SeekEnd)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", nil, err
+	}
+	dir := &wormholeDirOffer{Mode: "zipfile/deflated", Dirname: wormholeDirName, Zipsize: size, Numbytes: numbytes, Numfiles: len(files)}
+	return tmp.Name(), &wormholeOffer{Directory: dir}, nil
+}
+
+// writeWormholeZip 将文件以不重复的文件名写入ZIP，返回未压缩的总大小
+func writeWormholeZip(w io.Writer, files []File) (int64, error) {
+	zw := zip.NewWriter(w)
+	used := make(map[string]bool)
+	var total int64
+	for _, f := range files {
+		n, err := addWormholeZipEntry(zw, f.AbsPath, uniqueEntryName(used, f.Filename))
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", f.Filename, err)
+		}
+		total += n
+	}
+	return total, zw.Close()
+}
+
+// addWormholeZipEntry 将文件以name为条目名压缩写入ZIP，返回文件的大小
+func addWormholeZipEntry(zw *zip.Writer, path, name string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return 0, err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	entry, err := zw.CreateHeader(header)
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(entry, file)
+}
+
+// sendWormholeFile 将文件的前total字节分成记录发送，等待接收方确认并核对SHA256
+func sendWormholeFile(t *wormholeTransit, path string, total int64, progress func(sent, total int64)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	buf := make([]byte, wormholeRecordSize)
+	var sent int64
+	for sent < total {
+		n, err := io.ReadFull(io.LimitReader(f, total-sent), buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			if err := t.writeRecord(buf[:n]); err != nil {
+				return err
+			}
+			sent += int64(n)
+			if progress != nil {
+				progress(sent, total)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if sent != total {
+		return errors.New("文件在发送过程中被修改")
+	}
+
+	data, err := t.readRecord()
+	if err != nil {
+		return fmt.Errorf("等待wormhole接收方确认失败: %v", err)
+	}
+	var ack wormholeAck
+	if err := json.Unmarshal(data, &ack); err != nil || ack.Ack != "ok" {
+		return fmt.Errorf("wormhole接收方未确认: %s", data)
+	}
+	if ack.SHA256 != "" && ack.SHA256 != hex.EncodeToString(h.Sum(nil)) {
+		return errors.New("文件校验失败")
+	}
+	return nil
+}
+
+// WormholeReceive 用对方wormhole发送时显示的代码接收文件，保存到上传目录，返回保存的文件路径。
+// 与网页上传一样经过上传过滤、接收确认、大小限制和重名策略，被拒绝时告诉对方并返回空列表；
+// 对方发送的目录作为一次上传确认，解压后的文件直接保存在上传目录中。不接收文本消息
+func (s *Server) WormholeReceive(ctx context.Context, srv WormholeServer, code string) (saved []string, err error) {
+	code = strings.TrimSpace(code)
+	if !validWormholeCode(code) {
+		return nil, ErrWormholeCode
+	}
+	info, err := newWormholeTransitInfo(srv.Transit)
+	if err != nil {
+		return nil, err
+	}
+
+	mb, err := dialWormholeMailbox(ctx, srv.Mailbox)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			mb.close("errory")
+		} else {
+			mb.close("happy")
+		}
+	}()
+	fail := func(err error) error {
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	ws, err := mb.connect(code)
+	if err != nil {
+		return nil, fail(err)
+	}
+	if err := ws.sendJSON(wormholeMessage{Transit: info}); err != nil {
+		return nil, fail(err)
+	}
+	relays := []string{srv.Transit}
+	for {
+		var m wormholeMessage
+		if err := ws.receiveJSON(&m); err != nil {
+			return nil, fail(err)
+		}
+		switch {
+		case m.Error != "":
+			return nil, fmt.Errorf("wormhole发送方出错: %s", m.Error)
+		case m.Transit != nil:
+			relays = m.Transit.addRelays(relays)
+		case m.Offer != nil:
+			r := &wormholeReceiver{s: s, ws: ws, relays: relays}
+			saved, err := r.receive(ctx, m.Offer)
+			return saved, fail(err)
+		}
+	}
+}
+
+// wormholeReceiver 一次wormhole接收的状态
+type wormholeReceiver struct {
+	s      *Server
+	ws     *wormholeSession
+	relays []string
+}
+
+// receive 按对方的offer接收文件或目录
+func (r *wormholeReceiver) receive(ctx context.Context, offer *wormholeOffer) ([]string, error) {
+	switch {
+	case offer.File != nil:
+		return r.receiveFile(ctx, offer.File)
+	case offer.Directory != nil:
+		return r.receiveDirectory(ctx, offer.Directory)
+	default:
+		r.ws.sendJSON(wormholeMessage{Error: "pair-gui only accepts files and directories"})
+		return nil, errors.New("不支持接收wormhole文本消息")
+	}
+}
+
+// accept 检查上传大小限制、请用户确认并检查磁盘空间，size为确认时显示的大小，need为需要的磁盘空间。
+// 不接收时告诉对方并返回false
+func (r *wormholeReceiver) accept(ctx context.Context, name string, size, need int64) (bool, error) {
+	s := r.s
+	if limit := s.MaxUploadSize(); limit > 0 && size > limit {
+		log.Printf("wormhole文件超过上传大小限制，已拒绝: %s", name)
+		return false, r.ws.sendJSON(wormholeMessage{Error: "transfer too large"})
+	}
+	if !s.approveUpload(ctx, UploadRequest{Filename: name, Size: size, IP: r.ws.host, UserAgent: "wormhole", untrusted: true}) {
+		log.Printf("拒绝接收wormhole文件: %s", name)
+		return false, r.ws.sendJSON(wormholeMessage{Error: "transfer rejected"})
+	}
+	if free, ok := hasSpace(s.UploadDir(), need); !ok {
+		r.ws.sendJSON(wormholeMessage{Error: "insufficient disk space"})
+		return false, fmt.Errorf("磁盘空间不足: %s需要%d字节，剩余%d字节", name, need, free)
+	}
+	return true, nil
+}
+
+// receiveFile 接收单个文件
+func (r *wormholeReceiver) receiveFile(ctx context.Context, offer *wormholeFileOffer) ([]string, error) {
+	s := r.s
+	name := sanitizeFilename(offer.Filename)
+	if offer.Filesize < 0 {
+		return nil, errors.New("wormhole文件大小无效")
+	}
+	if ok, err := r.accept(ctx, name, offer.Filesize, offer.Filesize); !ok {
+		return nil, err
+	}
+	file, err := s.createUpload(s.UploadDir(), name)
+	if errors.Is(err, ErrFileExists) {
+		log.Printf("wormhole文件已存在，已跳过: %s", name)
+		return nil, r.ws.sendJSON(wormholeMessage{Error: "file already exists"})
+	}
+	if err != nil {
+		r.ws.sendJSON(wormholeMessage{Error: "cannot create file"})
+		return nil, err
+	}
+
+	t := s.beginTransfer(TransferUpload, filepath.Base(file.path), r.ws.host, offer.Filesize)
+	defer s.endTransfer(t)
+	tc, sum, err := r.receiveData(ctx, file, offer.Filesize, t)
+	if err == nil {
+		defer tc.Close()
+		err = file.commit()
+	}
+	if err != nil {
+		file.abort()
+		t.fail()
+		return nil, err
+	}
+	t.setFile(file.path)
+	return []string{file.path}, tc.ack(sum)
+}
+
+// receiveDirectory 接收打包成ZIP的目录，先保存为partialDir中的临时文件，再把其中的文件直接解压到上传目录
+func (r *wormholeReceiver) receiveDirectory(ctx context.Context, offer *wormholeDirOffer) ([]string, error) {
+	s := r.s
+	if offer.Mode != "zipfile/deflated" {
+		r.ws.sendJSON(wormholeMessage{Error: "unsupported directory mode"})
+		return nil, fmt.Errorf("不支持的wormhole目录格式: %s", offer.Mode)
+	}
+	if offer.Zipsize < 0 || offer.Numbytes < 0 {
+		return nil, errors.New("wormhole目录大小无效")
+	}
+	name := sanitizeFilename(offer.Dirname)
+	if ok, err := r.accept(ctx, name, offer.Numbytes, offer.Zipsize+offer.Numbytes); !ok {
+		return nil, err
+	}
+	tmpDir := filepath.Join(s.UploadDir(), partialDir)
+	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(tmpDir, "wormhole-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	t := s.beginTransfer(TransferUpload, name, r.ws.host, offer.Zipsize)
+	defer s.endTransfer(t)
+	tc, sum, err := r.receiveData(ctx, tmp, offer.Zipsize, t)
+	if err != nil {
+		t.fail()
+		return nil, err
+	}
+	defer tc.Close()
+	saved, err := s.extractWormholeZip(tmp, offer.Zipsize, offer.Numbytes)
+	if err != nil {
+		t.fail()
+		return saved, err
+	}
+	return saved, tc.ack(sum)
+}
+
+// receiveData 告诉对方接收，经传输中继接收size字节写入w，返回传输连接和数据的SHA256；
+// 调用方保存后用ack确认并关闭连接
+func (r *wormholeReceiver) receiveData(ctx context.Context, w io.Writer, size int64, t *transfer) (*wormholeTransit, []byte, error) {
+	if err := r.ws.sendJSON(wormholeMessage{Answer: &wormholeAnswer{FileAck: "ok"}}); err != nil {
+		return nil, nil, err
+	}
+	tc, err := connectWormholeTransit(ctx, r.relays, r.ws.transitKey(), false)
+	if err != nil {
+		return nil, nil, err
+	}
+	t.setAbort(func() { tc.Close() })
+
+	h := sha256.New()
+	w = io.MultiWriter(w, h)
+	for received := int64(0); received < size; {
+		data, err := tc.readRecord()
+		if err == nil && received+int64(len(data)) > size {
+			err = errors.New("收到多余的wormhole数据")
+		}
+		if err == nil {
+			_, err = w.Write(data)
+		}
+		if err != nil {
+			tc.Close()
+			if t.canceled() {
+				err = errTransferCanceled
+			}
+			return nil, nil, err
+		}
+		received += int64(len(data))
+		t.add(len(data))
+	}
+	return tc, h.Sum(nil), nil
+}
+
+// ack 告诉发送方已收到并保存了全部数据
+func (t *wormholeTransit) ack(sum []byte) error {
+	data, err := json.Marshal(wormholeAck{Ack: "ok", SHA256: hex.EncodeToString(sum)})
+	if err != nil {
+		return err
+	}
+	return t.writeRecord(data)
+}
+
+// extractWormholeZip 将收到的ZIP中的文件按重名策略直接保存到上传目录，不保留子目录；
+// 解压的总大小不能超过对方声明的numbytes
+func (s *Server) extractWormholeZip(r io.ReaderAt, size, numbytes int64) ([]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("解析wormhole目录失败: %v", err)
+	}
+	var saved []string
+	remaining := numbytes
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		name := sanitizeFilename(path.Base(f.Name))
+		file, err := s.createUpload(s.UploadDir(), name)
+		if errors.Is(err, ErrFileExists) {
+			log.Printf("wormhole文件已存在，已跳过: %s", name)
+			continue
+		}
+		if err != nil {
+			return saved, err
+		}
+		n, err := copyZipEntry(file, f, remaining)
+		remaining -= n
+		if err == nil {
+			err = file.commit()
+		}
+		if err != nil {
+			file.abort()
+			return saved, fmt.Errorf("%s: %v", name, err)
+		}
+		saved = append(saved, file.path)
+	}
+	return saved, nil
+}
+
+// copyZipEntry 将f解压写入w，超过limit字节时返回错误
+func copyZipEntry(w io.Writer, f *zip.File, limit int64) (int64, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	n, err := io.Copy(w, io.LimitReader(rc, limit+1))
+	if err == nil && n > limit {
+		err = errors.New("解压后的大小超过对方声明的大小")
+	}
+	return n, err
+}
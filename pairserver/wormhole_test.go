@@ -0,0 +1,301 @@
+package pairserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"filippo.io/edwards25519"
+	"golang.org/x/net/websocket"
+)
+
+// fakeWormholeMailbox 测试用的邮箱服务器：分配名牌，把添加到邮箱的消息转发给打开同一邮箱的全部连接
+type fakeWormholeMailbox struct {
+	mu        sync.Mutex
+	nameplate int
+	mailboxes map[string]*fakeMailbox
+}
+
+// fakeMailbox 一个邮箱中的消息和打开它的连接
+type fakeMailbox struct {
+	messages []map[string]string
+	conns    []*websocket.Conn
+}
+
+// startFakeWormhole 启动邮箱服务器和传输中继
+func startFakeWormhole(t *testing.T) WormholeServer {
+	t.Helper()
+	f := &fakeWormholeMailbox{mailboxes: make(map[string]*fakeMailbox)}
+	ts := httptest.NewServer(websocket.Handler(f.handle))
+	t.Cleanup(ts.Close)
+	return WormholeServer{Mailbox: "ws" + strings.TrimPrefix(ts.URL, "http") + "/v1", Transit: startFakeTransitRelay(t)}
+}
+
+// handle 处理一个客户端连接
+func (f *fakeWormholeMailbox) handle(ws *websocket.Conn) {
+	websocket.JSON.Send(ws, map[string]any{"type": "welcome", "welcome": map[string]any{}})
+	var side string
+	for {
+		var m map[string]string
+		if err := websocket.JSON.Receive(ws, &m); err != nil {
+			return
+		}
+		websocket.JSON.Send(ws, map[string]string{"type": "ack", "id": m["id"]})
+		switch m["type"] {
+		case "bind":
+			side = m["side"]
+		case "allocate":
+			f.mu.Lock()
+			f.nameplate++
+			n := f.nameplate
+			f.mu.Unlock()
+			websocket.JSON.Send(ws, map[string]string{"type": "allocated", "nameplate": fmt.Sprint(n)})
+		case "claim":
+			websocket.JSON.Send(ws, map[string]string{"type": "claimed", "mailbox": "mailbox-" + m["nameplate"]})
+		case "open":
+			f.mu.Lock()
+			mb := f.mailboxes[m["mailbox"]]
+			if mb == nil {
+				mb = &fakeMailbox{}
+				f.mailboxes[m["mailbox"]] = mb
+			}
+			for _, msg := range mb.messages {
+				websocket.JSON.Send(ws, msg)
+			}
+			mb.conns = append(mb.conns, ws)
+			f.mu.Unlock()
+		case "add":
+			msg := map[string]string{"type": "message", "side": side, "phase": m["phase"], "body": m["body"]}
+			f.mu.Lock()
+			for _, mb := range f.mailboxes {
+				if !containsConn(mb.conns, ws) {
+					continue
+				}
+				mb.messages = append(mb.messages, msg)
+				for _, c := range mb.conns {
+					websocket.JSON.Send(c, msg)
+				}
+			}
+			f.mu.Unlock()
+		case "release":
+			websocket.JSON.Send(ws, map[string]string{"type": "released"})
+		case "close":
+			websocket.JSON.Send(ws, map[string]string{"type": "closed"})
+			return
+		}
+	}
+}
+
+// containsConn 返回conns中是否有c
+func containsConn(conns []*websocket.Conn, c *websocket.Conn) bool {
+	for _, conn := range conns {
+		if conn == c {
+			return true
+		}
+	}
+	return false
+}
+
+// startFakeTransitRelay 启动传输中继：令牌相同的两个连接都到达后回复ok并互相转发
+func startFakeTransitRelay(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var mu sync.Mutex
+	waiting := make(map[string]net.Conn)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				line, err := bufio.NewReader(c).ReadString('\n')
+				var token, side string
+				if err != nil || !strings.HasPrefix(line, "please relay ") {
+					c.Close()
+					return
+				}
+				fmt.Sscanf(line, "please relay %s for side %s", &token, &side)
+				mu.Lock()
+				other := waiting[token]
+				if other == nil {
+					waiting[token] = c
+					mu.Unlock()
+					return
+				}
+				delete(waiting, token)
+				mu.Unlock()
+				io.WriteString(other, "ok\n")
+				io.WriteString(c, "ok\n")
+				go func() {
+					io.Copy(other, c)
+					other.Close()
+				}()
+				io.Copy(c, other)
+				c.Close()
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// TestWormholeSpake 双方口令相同时协商出相同的密钥，口令不同时密钥不同
+func TestWormholeSpake(t *testing.T) {
+	a, _ := newWormholeSpake([]byte("7-apple-river"))
+	b, _ := newWormholeSpake([]byte("7-apple-river"))
+	c, _ := newWormholeSpake([]byte("7-apple-rivet"))
+	if len(a.bytes()) != 33 || a.bytes()[0] != 'S' {
+		t.Fatalf("SPAKE2消息格式不正确: %x", a.bytes())
+	}
+	ka, err := a.finish(b.bytes(), wormholeAppID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb, _ := b.finish(a.bytes(), wormholeAppID)
+	kc, _ := c.finish(a.bytes(), wormholeAppID)
+	if !bytes.Equal(ka, kb) || len(ka) != 32 {
+		t.Error("口令相同时密钥不同")
+	}
+	if bytes.Equal(ka, kc) {
+		t.Error("口令不同时密钥相同")
+	}
+
+	// 拒绝单位元等小阶的点
+	if _, err := a.finish(append([]byte("S"), edwards25519.NewIdentityPoint().Bytes()...), wormholeAppID); err == nil {
+		t.Error("应拒绝单位元")
+	}
+	if p := spakeS(); p.Equal(edwards25519.NewIdentityPoint()) == 1 || !bytes.Equal(p.Bytes(), spakeElement("symmetric").Bytes()) {
+		t.Error("盲化元素应固定且不是单位元")
+	}
+}
+
+// TestWormholeTransfer 发送单个文件和多个文件（打包为ZIP目录），接收后内容一致，接收确认的地址为邮箱服务器
+func TestWormholeTransfer(t *testing.T) {
+	src := t.TempDir()
+	large := make([]byte, 2*wormholeRecordSize+123)
+	rand.Read(large)
+	var shared []File
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{{"big.bin", large}, {"a<b>.txt", []byte("hello")}, {"empty.txt", nil}} {
+		path := filepath.Join(src, fmt.Sprint(len(shared)))
+		if err := os.WriteFile(path, f.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		shared = append(shared, File{Filename: f.name, AbsPath: path})
+	}
+
+	dir := t.TempDir()
+	s := New()
+	s.SetUploadDir(dir)
+	var asked []UploadRequest
+	s.SetUploadApproval(true)
+	s.SetUploadApprover(func(req UploadRequest) (bool, bool) {
+		asked = append(asked, req)
+		return true, true
+	})
+	srv := startFakeWormhole(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	send := func(files []File) ([]string, int64, error) {
+		codes := make(chan string, 1)
+		sendErr := make(chan error, 1)
+		var sent int64
+		go func() {
+			sendErr <- WormholeSend(ctx, srv, files, func(code string) { codes <- code }, func(n, total int64) { sent = n })
+		}()
+		var code string
+		select {
+		case code = <-codes:
+		case err := <-sendErr:
+			return nil, 0, err
+		}
+		saved, err := s.WormholeReceive(ctx, srv, code)
+		if err := <-sendErr; err != nil {
+			return saved, sent, fmt.Errorf("发送失败: %v", err)
+		}
+		return saved, sent, err
+	}
+
+	saved, sent, err := send(shared[:1])
+	if err != nil {
+		t.Fatalf("接收失败: %v", err)
+	}
+	if len(saved) != 1 || sent != int64(len(large)) {
+		t.Errorf("保存了%v，发送了%d字节", saved, sent)
+	}
+	if len(asked) != 1 || asked[0].IP != "127.0.0.1" || asked[0].Filename != "big.bin" || asked[0].Size != int64(len(large)) {
+		t.Errorf("接收确认为%+v，应确认一次big.bin且地址为邮箱服务器的地址", asked)
+	}
+
+	saved, _, err = send(shared)
+	if err != nil {
+		t.Fatalf("接收失败: %v", err)
+	}
+	if len(saved) != 3 || len(asked) != 2 || asked[1].Filename != wormholeDirName || asked[1].Size != int64(len(large)+5) {
+		t.Errorf("保存了%v，接收确认为%+v，目录应确认一次", saved, asked)
+	}
+	for name, want := range map[string][]byte{"big (1).bin": large, "a_b_.txt": []byte("hello"), "empty.txt": nil} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s 的内容不一致: %v", name, err)
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, partialDir)); len(entries) != 0 {
+		t.Errorf("临时文件未删除: %v", entries)
+	}
+
+	// 拒绝接收时不保存文件，发送方得到错误
+	s.SetUploadApprover(func(req UploadRequest) (bool, bool) { return false, false })
+	saved, _, err = send(shared[1:2])
+	if len(saved) != 0 || err == nil || !strings.Contains(err.Error(), "transfer rejected") {
+		t.Errorf("拒绝后保存了%v，错误为%v", saved, err)
+	}
+}
+
+// TestWormholeErrors 代码格式错误或双方代码不同时返回错误
+func TestWormholeErrors(t *testing.T) {
+	s := New()
+	s.SetUploadDir(t.TempDir())
+	srv := startFakeWormhole(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, code := range []string{"", "apple-river", "7", "7-", "x7-apple"} {
+		if _, err := s.WormholeReceive(ctx, srv, code); err != ErrWormholeCode {
+			t.Errorf("代码 %q 应返回ErrWormholeCode，得到%v", code, err)
+		}
+	}
+
+	// 名牌相同但口令不同时双方都无法解密对方的消息
+	codes := make(chan string, 1)
+	sendErr := make(chan error, 1)
+	go func() {
+		sendErr <- WormholeSend(ctx, srv, []File{{Filename: "a.txt", AbsPath: os.Args[0]}}, func(code string) { codes <- code }, nil)
+	}()
+	nameplate, _, _ := strings.Cut(<-codes, "-")
+	if _, err := s.WormholeReceive(ctx, srv, nameplate+"-wrong-words"); !errors.Is(err, errWormholeKey) {
+		t.Errorf("口令不同时应返回errWormholeKey，得到%v", err)
+	}
+	if err := <-sendErr; !errors.Is(err, errWormholeKey) {
+		t.Errorf("口令不同时发送方应返回errWormholeKey，得到%v", err)
+	}
+}
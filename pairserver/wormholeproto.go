@@ -0,0 +1,650 @@
+package pairserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/edwards25519"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/net/websocket"
+)
+
+// magic-wormhole协议的底层实现：SPAKE2、邮箱服务器客户端、消息加密和传输中继，按magic-wormhole的
+// 文件传输协议（transfer v1）实现；只在pair-gui之间测试过，未与wormhole命令行程序验证互通。
+// 双方经邮箱服务器交换SPAKE2消息协商密钥，之后的消息和文件数据都用NaCl secretbox加密，服务器只能看到密文
+
+const (
+	wormholeAppID          = "lothar.com/wormhole/text-or-file-xfer" // wormhole文件传输的应用ID，双方必须相同
+	wormholeDialTimeout    = 30 * time.Second                        // 连接邮箱服务器和传输中继的超时
+	wormholeTransitTimeout = time.Minute                             // 在传输中继上等待对方的超时
+	wormholeRecordSize     = 256 << 10                               // 发送文件时每条记录的明文大小
+	maxWormholeRecord      = 64 << 20                                // 单条记录的最大长度
+)
+
+// errWormholeKey 无法解密对方的消息，说明双方输入的代码不同
+var errWormholeKey = errors.New("wormhole代码不正确，无法解密对方的消息")
+
+var (
+	// spakeOrder ed25519素数阶子群的阶L
+	spakeOrder, _ = new(big.Int).SetString("7237005577332262213973186563042994240857116359379907606001950938285454250989", 10)
+	// spakeFieldPrime ed25519的域素数 2^255-19
+	spakeFieldPrime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	// spakeS 对称模式SPAKE2双方共用的盲化元素
+	spakeS = sync.OnceValue(func() *edwards25519.Point { return spakeElement("symmetric") })
+)
+
+// wormholeHKDF 用空salt的HKDF-SHA256从secret派生n字节
+func wormholeHKDF(secret []byte, info string, n int) []byte {
+	key, err := hkdf.Key(sha256.New, secret, nil, info, n)
+	if err != nil {
+		panic(err) // n不超过255*32时不会出错
+	}
+	return key
+}
+
+// littleEndian32 将小于2^256的非负整数编码为32字节小端序
+func littleEndian32(i *big.Int) []byte {
+	b := i.FillBytes(make([]byte, 32))
+	slices.Reverse(b)
+	return b
+}
+
+// spakeScalar 按python-spake2的方式将口令映射为标量：HKDF扩展为48字节，作为大端序整数模L
+func spakeScalar(pw []byte) *edwards25519.Scalar {
+	i := new(big.Int).SetBytes(wormholeHKDF(pw, "SPAKE2 pw", 48))
+	s, err := edwards25519.NewScalar().SetCanonicalBytes(littleEndian32(i.Mod(i, spakeOrder)))
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// spakeElement 由种子确定离散对数未知的元素：从种子派生的y坐标起逐个尝试，
+// 取x为偶数的曲线上的点，乘以余因子8得到素数阶子群中的元素
+func spakeElement(seed string) *edwards25519.Point {
+	y := new(big.Int).SetBytes(wormholeHKDF([]byte(seed), "SPAKE2 arbitrary element", 48))
+	y.Mod(y, spakeFieldPrime)
+	for {
+		// 编码的最高位为0表示x为偶数
+		if p, err := new(edwards25519.Point).SetBytes(littleEndian32(y)); err == nil {
+			p.MultByCofactor(p)
+			if p.Equal(edwards25519.NewIdentityPoint()) == 0 {
+				return p
+			}
+		}
+		y.Add(y, big.NewInt(1)).Mod(y, spakeFieldPrime)
+	}
+}
+
+// wormholeSpake 对称模式的SPAKE2，与python-spake2的SPAKE2_Symmetric（Ed25519参数）相同
+type wormholeSpake struct {
+	pw    []byte
+	xy    *edwards25519.Scalar
+	blind *edwards25519.Point // 口令标量乘以S
+	msg   []byte              // 发出的元素
+}
+
+// newWormholeSpake 以口令pw开始协商
+func newWormholeSpake(pw []byte) (*wormholeSpake, error) {
+	var seed [64]byte
+	if _, err := rand.Read(seed[:]); err != nil {
+		return nil, err
+	}
+	xy, err := edwards25519.NewScalar().SetUniformBytes(seed[:])
+	if err != nil {
+		return nil, err
+	}
+	blind := new(edwards25519.Point).ScalarMult(spakeScalar(pw), spakeS())
+	msg := new(edwards25519.Point).ScalarBaseMult(xy)
+	msg.Add(msg, blind)
+	return &wormholeSpake{pw: pw, xy: xy, blind: blind, msg: msg.Bytes()}, nil
+}
+
+// bytes 返回发给对方的消息：对称模式的标记S加上元素
+func (p *wormholeSpake) bytes() []byte {
+	return append([]byte("S"), p.msg...)
+}
+
+// finish 由对方的消息计算共享密钥，idSymmetric为双方共同的标识
+func (p *wormholeSpake) finish(in []byte, idSymmetric string) ([]byte, error) {
+	if len(in) != 33 || in[0] != 'S' {
+		return nil, errors.New("无效的SPAKE2消息")
+	}
+	y, err := new(edwards25519.Point).SetBytes(in[1:])
+	if err != nil {
+		return nil, errors.New("无效的SPAKE2元素")
+	}
+	if new(edwards25519.Point).MultByCofactor(y).Equal(edwards25519.NewIdentityPoint()) == 1 {
+		return nil, errors.New("SPAKE2元素的阶过小")
+	}
+	k := new(edwards25519.Point).Subtract(y, p.blind)
+	k.ScalarMult(p.xy, k)
+
+	first, second := p.msg, in[1:]
+	if bytes.Compare(first, second) > 0 {
+		first, second = second, first
+	}
+	pwHash := sha256.Sum256(p.pw)
+	idHash := sha256.Sum256([]byte(idSymmetric))
+	h := sha256.New()
+	for _, b := range [][]byte{pwHash[:], idHash[:], first, second, k.Bytes()} {
+		h.Write(b)
+	}
+	return h.Sum(nil), nil
+}
+
+// wormholeDeriveKey 按magic-wormhole的derive_key从key派生用于purpose的32字节密钥
+func wormholeDeriveKey(key []byte, purpose string) []byte {
+	return wormholeHKDF(key, purpose, 32)
+}
+
+// wormholePhaseKey 派生side一方在phase阶段发出的消息的密钥
+func wormholePhaseKey(key []byte, side, phase string) []byte {
+	s := sha256.Sum256([]byte(side))
+	p := sha256.Sum256([]byte(phase))
+	return wormholeDeriveKey(key, "wormhole:phase:"+string(s[:])+string(p[:]))
+}
+
+// wormholeSeal 用secretbox加密，返回随机nonce加上密文
+func wormholeSeal(key, plain []byte) ([]byte, error) {
+	var k [32]byte
+	var nonce [24]byte
+	copy(k[:], key)
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	return secretbox.Seal(nonce[:], plain, &nonce, &k), nil
+}
+
+// wormholeOpen 解密wormholeSeal的结果
+func wormholeOpen(key, data []byte) ([]byte, error) {
+	if len(data) < 24+secretbox.Overhead {
+		return nil, errWormholeKey
+	}
+	var k [32]byte
+	var nonce [24]byte
+	copy(k[:], key)
+	copy(nonce[:], data)
+	plain, ok := secretbox.Open(nil, data[24:], &nonce, &k)
+	if !ok {
+		return nil, errWormholeKey
+	}
+	return plain, nil
+}
+
+// wormholeRandomHex 返回n个随机字节的十六进制表示
+func wormholeRandomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// wormholeServerMessage 邮箱服务器发来的消息，只解析用到的字段
+type wormholeServerMessage struct {
+	Type    string `json:"type"`
+	Welcome struct {
+		Error string `json:"error"`
+	} `json:"welcome"`
+	Nameplate string `json:"nameplate"`
+	Mailbox   string `json:"mailbox"`
+	Side      string `json:"side"`
+	Phase     string `json:"phase"`
+	Body      string `json:"body"`
+	Error     string `json:"error"`
+}
+
+// wormholeMailbox 与邮箱服务器的WebSocket连接
+type wormholeMailbox struct {
+	ws        *websocket.Conn
+	host      string // 服务器的主机名，用于接收确认和传输记录
+	side      string // 本机在这次会话中的随机标识
+	nameplate string // 已认领且未释放的名牌
+	mailbox   string // 已打开的邮箱
+	stop      func() bool
+}
+
+// dialWormholeMailbox 连接邮箱服务器并以随机标识绑定到文件传输的应用ID
+func dialWormholeMailbox(ctx context.Context, server string) (*wormholeMailbox, error) {
+	cfg, err := websocket.NewConfig(server, "http://localhost/")
+	if err != nil {
+		return nil, fmt.Errorf("wormhole邮箱服务器地址无效: %v", err)
+	}
+	cfg.Dialer = &net.Dialer{Timeout: wormholeDialTimeout}
+	ws, err := cfg.DialContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("连接wormhole邮箱服务器失败: %v", err)
+	}
+	host := server
+	if u, err := url.Parse(server); err == nil {
+		host = u.Hostname()
+	}
+	mb := &wormholeMailbox{ws: ws, host: host, side: wormholeRandomHex(5)}
+	mb.stop = context.AfterFunc(ctx, func() { ws.Close() })
+
+	m, err := mb.wait("welcome")
+	if err == nil && m.Welcome.Error != "" {
+		err = fmt.Errorf("wormhole邮箱服务器拒绝连接: %s", m.Welcome.Error)
+	}
+	if err == nil {
+		err = mb.send(map[string]any{"type": "bind", "appid": wormholeAppID, "side": mb.side})
+	}
+	if err != nil {
+		mb.stop()
+		ws.Close()
+		return nil, err
+	}
+	return mb, nil
+}
+
+// send 发送一条消息
+func (mb *wormholeMailbox) send(msg map[string]any) error {
+	msg["id"] = wormholeRandomHex(2)
+	return websocket.JSON.Send(mb.ws, msg)
+}
+
+// receive 读取服务器的下一条消息，跳过确认；服务器报告错误时返回错误
+func (mb *wormholeMailbox) receive() (wormholeServerMessage, error) {
+	for {
+		var m wormholeServerMessage
+		if err := websocket.JSON.Receive(mb.ws, &m); err != nil {
+			return m, err
+		}
+		switch m.Type {
+		case "ack":
+		case "error":
+			return m, fmt.Errorf("wormhole邮箱服务器出错: %s", m.Error)
+		default:
+			return m, nil
+		}
+	}
+}
+
+// wait 读取消息直到收到typ类型的消息
+func (mb *wormholeMailbox) wait(typ string) (wormholeServerMessage, error) {
+	for {
+		m, err := mb.receive()
+		if err != nil || m.Type == typ {
+			return m, err
+		}
+	}
+}
+
+// next 返回对方发到邮箱的下一条消息，跳过服务器转回的本机消息
+func (mb *wormholeMailbox) next() (wormholeServerMessage, error) {
+	for {
+		m, err := mb.wait("message")
+		if err != nil || m.Side != mb.side {
+			return m, err
+		}
+	}
+}
+
+// add 向邮箱添加phase阶段的消息
+func (mb *wormholeMailbox) add(phase string, body []byte) error {
+	return mb.send(map[string]any{"type": "add", "phase": phase, "body": hex.EncodeToString(body)})
+}
+
+// allocate 申请一个空闲的名牌，即代码开头的数字
+func (mb *wormholeMailbox) allocate() (string, error) {
+	if err := mb.send(map[string]any{"type": "allocate"}); err != nil {
+		return "", err
+	}
+	m, err := mb.wait("allocated")
+	if err != nil {
+		return "", err
+	}
+	return m.Nameplate, nil
+}
+
+// connect 认领代码中的名牌并打开对应的邮箱，用代码与对方协商密钥。
+// 双方交换加密的版本信息，能解密对方的版本信息说明代码相同，之后释放名牌供他人使用
+func (mb *wormholeMailbox) connect(code string) (*wormholeSession, error) {
+	nameplate, _, _ := strings.Cut(code, "-")
+	if err := mb.send(map[string]any{"type": "claim", "nameplate": nameplate}); err != nil {
+		return nil, err
+	}
+	m, err := mb.wait("claimed")
+	if err != nil {
+		return nil, err
+	}
+	mb.nameplate, mb.mailbox = nameplate, m.Mailbox
+	if err := mb.send(map[string]any{"type": "open", "mailbox": m.Mailbox}); err != nil {
+		return nil, err
+	}
+
+	pake, err := newWormholeSpake([]byte(code))
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(map[string]string{"pake_v1": hex.EncodeToString(pake.bytes())})
+	if err != nil {
+		return nil, err
+	}
+	if err := mb.add("pake", body); err != nil {
+		return nil, err
+	}
+	m, err = mb.next()
+	if err != nil {
+		return nil, err
+	}
+	var peer struct {
+		Pake string `json:"pake_v1"`
+	}
+	body, err = hex.DecodeString(m.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &peer)
+	}
+	if err != nil || m.Phase != "pake" {
+		return nil, fmt.Errorf("意外的wormhole消息: %s", m.Phase)
+	}
+	in, err := hex.DecodeString(peer.Pake)
+	if err != nil {
+		return nil, errors.New("无效的SPAKE2消息")
+	}
+	key, err := pake.finish(in, wormholeAppID)
+	if err != nil {
+		return nil, err
+	}
+
+	ws := &wormholeSession{wormholeMailbox: mb, key: key}
+	if err := ws.addEncrypted("version", []byte(`{"app_versions":{}}`)); err != nil {
+		return nil, err
+	}
+	m, err = mb.next()
+	if err != nil {
+		return nil, err
+	}
+	if m.Phase != "version" {
+		return nil, fmt.Errorf("意外的wormhole消息: %s", m.Phase)
+	}
+	if _, err := ws.decrypt(m); err != nil {
+		return nil, err
+	}
+	mb.release()
+	return ws, nil
+}
+
+// release 释放已认领的名牌
+func (mb *wormholeMailbox) release() {
+	if mb.nameplate != "" {
+		mb.send(map[string]any{"type": "release", "nameplate": mb.nameplate})
+		mb.nameplate = ""
+	}
+}
+
+// close 释放名牌，以mood告诉服务器传输的结果并关闭邮箱，然后断开连接
+func (mb *wormholeMailbox) close(mood string) {
+	defer mb.ws.Close()
+	defer mb.stop()
+
+	mb.release()
+	if mb.mailbox != "" {
+		mb.ws.SetDeadline(time.Now().Add(5 * time.Second))
+		if mb.send(map[string]any{"type": "close", "mailbox": mb.mailbox, "mood": mood}) == nil {
+			mb.wait("closed")
+		}
+	}
+}
+
+// wormholeSession 协商密钥后的wormhole会话
+type wormholeSession struct {
+	*wormholeMailbox
+	key   []byte
+	phase int // 本机下一条消息的编号
+}
+
+// addEncrypted 加密后向邮箱添加phase阶段的消息
+func (ws *wormholeSession) addEncrypted(phase string, plain []byte) error {
+	box, err := wormholeSeal(wormholePhaseKey(ws.key, ws.side, phase), plain)
+	if err != nil {
+		return err
+	}
+	return ws.add(phase, box)
+}
+
+// decrypt 解密对方的消息
+func (ws *wormholeSession) decrypt(m wormholeServerMessage) ([]byte, error) {
+	box, err := hex.DecodeString(m.Body)
+	if err != nil {
+		return nil, errWormholeKey
+	}
+	return wormholeOpen(wormholePhaseKey(ws.key, m.Side, m.Phase), box)
+}
+
+// sendJSON 加密发送下一条编号的消息
+func (ws *wormholeSession) sendJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	phase := strconv.Itoa(ws.phase)
+	ws.phase++
+	return ws.addEncrypted(phase, data)
+}
+
+// receiveJSON 接收并解密对方的下一条消息
+func (ws *wormholeSession) receiveJSON(v any) error {
+	m, err := ws.next()
+	if err != nil {
+		return err
+	}
+	data, err := ws.decrypt(m)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("解析wormhole消息失败: %v", err)
+	}
+	return nil
+}
+
+// transitKey 派生传输连接使用的密钥
+func (ws *wormholeSession) transitKey() []byte {
+	return wormholeDeriveKey(ws.key, wormholeAppID+"/transit-key")
+}
+
+// wormholeHint 传输连接的提示：直连地址，或包含中继地址的relay-v1提示
+type wormholeHint struct {
+	Type     string         `json:"type"`
+	Hostname string         `json:"hostname,omitempty"`
+	Port     int            `json:"port,omitempty"`
+	Priority float64        `json:"priority,omitempty"`
+	Hints    []wormholeHint `json:"hints,omitempty"`
+}
+
+// wormholeTransitInfo 告诉对方本机支持的连接方式和连接提示
+type wormholeTransitInfo struct {
+	Abilities []wormholeHint `json:"abilities-v1"`
+	Hints     []wormholeHint `json:"hints-v1"`
+}
+
+// newWormholeTransitInfo 只通过relay中继传输，不提供直连地址
+func newWormholeTransitInfo(relay string) (*wormholeTransitInfo, error) {
+	host, port, err := net.SplitHostPort(relay)
+	if err != nil {
+		return nil, fmt.Errorf("wormhole传输中继地址无效: %v", err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, fmt.Errorf("wormhole传输中继地址无效: %v", err)
+	}
+	return &wormholeTransitInfo{
+		Abilities: []wormholeHint{{Type: "relay-v1"}},
+		Hints:     []wormholeHint{{Type: "relay-v1", Hints: []wormholeHint{{Type: "direct-tcp-v1", Hostname: host, Port: p}}}},
+	}, nil
+}
+
+// addRelays 将对方提供的中继地址追加到relays中，返回追加后的列表
+func (ti *wormholeTransitInfo) addRelays(relays []string) []string {
+	for _, h := range ti.Hints {
+		if h.Type != "relay-v1" {
+			continue
+		}
+		for _, r := range h.Hints {
+			addr := net.JoinHostPort(r.Hostname, strconv.Itoa(r.Port))
+			if r.Type == "direct-tcp-v1" && r.Hostname != "" && r.Port > 0 && !slices.Contains(relays, addr) {
+				relays = append(relays, addr)
+			}
+		}
+	}
+	return relays
+}
+
+// wormholeTransit 经传输中继与对方建立的加密连接，每条记录是4字节长度加上以序号为nonce的secretbox密文
+type wormholeTransit struct {
+	net.Conn
+	r         *bufio.Reader
+	sendKey   [32]byte
+	recvKey   [32]byte
+	sendNonce uint64
+	recvNonce uint64
+	stop      func() bool
+}
+
+// connectWormholeTransit 依次尝试relays中的中继，与对方完成握手；sender表示本机是否为发送方
+func connectWormholeTransit(ctx context.Context, relays []string, transitKey []byte, sender bool) (*wormholeTransit, error) {
+	var errs []error
+	for _, relay := range relays {
+		t, err := dialWormholeTransit(ctx, relay, transitKey, sender)
+		if err == nil {
+			return t, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		errs = append(errs, fmt.Errorf("%s: %v", relay, err))
+	}
+	return nil, fmt.Errorf("连接wormhole传输中继失败: %v", errors.Join(errs...))
+}
+
+// dialWormholeTransit 连接中继，中继找到使用相同令牌的对方后双方交换由密钥派生的握手，最后由发送方确认使用这个连接
+func dialWormholeTransit(ctx context.Context, relay string, key []byte, sender bool) (*wormholeTransit, error) {
+	d := net.Dialer{Timeout: wormholeDialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", relay)
+	if err != nil {
+		return nil, err
+	}
+	t := &wormholeTransit{Conn: nc, r: bufio.NewReader(nc)}
+	t.stop = context.AfterFunc(ctx, func() { nc.Close() })
+	nc.SetDeadline(time.Now().Add(wormholeTransitTimeout))
+	if err := t.handshake(key, sender); err != nil {
+		t.Close()
+		return nil, err
+	}
+	nc.SetDeadline(time.Time{})
+
+	mine, theirs := "transit_record_sender_key", "transit_record_receiver_key"
+	if !sender {
+		mine, theirs = theirs, mine
+	}
+	copy(t.sendKey[:], wormholeDeriveKey(key, mine))
+	copy(t.recvKey[:], wormholeDeriveKey(key, theirs))
+	return t, nil
+}
+
+// handshake 完成中继握手和双方的握手
+func (t *wormholeTransit) handshake(key []byte, sender bool) error {
+	token := wormholeDeriveKey(key, "transit_relay_token")
+	if _, err := fmt.Fprintf(t.Conn, "please relay %x for side %s\n", token, wormholeRandomHex(8)); err != nil {
+		return err
+	}
+	line, err := t.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if line != "ok\n" {
+		return fmt.Errorf("中继拒绝连接: %s", strings.TrimSpace(line))
+	}
+
+	greeting := func(role string) string {
+		return fmt.Sprintf("transit %s %x ready\n\n", role, wormholeDeriveKey(key, "transit_"+role))
+	}
+	mine, theirs := greeting("sender"), greeting("receiver")
+	if !sender {
+		mine, theirs = theirs, mine
+	}
+	if _, err := io.WriteString(t.Conn, mine); err != nil {
+		return err
+	}
+	buf := make([]byte, len(theirs))
+	if _, err := io.ReadFull(t.r, buf); err != nil {
+		return err
+	}
+	if string(buf) != theirs {
+		return errors.New("wormhole传输握手失败")
+	}
+	if sender {
+		_, err = io.WriteString(t.Conn, "go\n")
+		return err
+	}
+	buf = buf[:3]
+	if _, err := io.ReadFull(t.r, buf); err != nil {
+		return err
+	}
+	if string(buf) != "go\n" {
+		return errors.New("wormhole发送方放弃了这个连接")
+	}
+	return nil
+}
+
+// Close 关闭连接
+func (t *wormholeTransit) Close() error {
+	t.stop()
+	return t.Conn.Close()
+}
+
+// writeRecord 加密发送一条记录
+func (t *wormholeTransit) writeRecord(plain []byte) error {
+	var nonce [24]byte
+	binary.BigEndian.PutUint64(nonce[16:], t.sendNonce)
+	t.sendNonce++
+	frame := binary.BigEndian.AppendUint32(nil, uint32(24+len(plain)+secretbox.Overhead))
+	frame = secretbox.Seal(append(frame, nonce[:]...), plain, &nonce, &t.sendKey)
+	_, err := t.Write(frame)
+	return err
+}
+
+// readRecord 读取并解密一条记录，nonce必须是对方的下一个序号
+func (t *wormholeTransit) readRecord() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(t.r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size < 24+secretbox.Overhead || size > maxWormholeRecord {
+		return nil, fmt.Errorf("wormhole记录长度无效: %d", size)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(t.r, buf); err != nil {
+		return nil, err
+	}
+	var nonce [24]byte
+	binary.BigEndian.PutUint64(nonce[16:], t.recvNonce)
+	if !bytes.Equal(buf[:24], nonce[:]) {
+		return nil, errors.New("wormhole记录的序号不正确")
+	}
+	t.recvNonce++
+	plain, ok := secretbox.Open(nil, buf[24:], &nonce, &t.recvKey)
+	if !ok {
+		return nil, errors.New("wormhole记录解密失败")
+	}
+	return plain, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+
+	"pair-gui/pairserver"
+)
+
+// 插件随程序一起编译：在本目录新建一个文件（如 plugin_example.go）匿名导入插件包，
+// 插件包在init中调用pairserver.RegisterPlugin注册，无需修改main.go：
+//
+//	package main
+//
+//	import _ "example.com/pair-plugin"
+
+// panelPlugin 提供界面页面的插件，页面以插件名称为标题显示在主窗口中；
+// 切换语言重建界面时会再次调用Panel，因此每次都应返回新的界面组件
+type panelPlugin interface {
+	pairserver.Plugin
+	Panel() fyne.CanvasObject
+}
+
+// makePluginTabs 为提供界面页面的插件创建页面
+func makePluginTabs() []*container.TabItem {
+	var tabs []*container.TabItem
+	for _, p := range pairserver.Plugins() {
+		if pp, ok := p.(panelPlugin); ok {
+			tabs = append(tabs, container.NewTabItem(p.Name(), pp.Panel()))
+		}
+	}
+	return tabs
+}
+
+// pluginNames 返回已注册插件的名称
+func pluginNames() []string {
+	var names []string
+	for _, p := range pairserver.Plugins() {
+		names = append(names, p.Name())
+	}
+	return names
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"pair-gui/pairserver"
+)
+
+// pushToPeer 将下载列表中的文件直接发送到附近设备，对方确认接收后显示发送进度
+func pushToPeer(w fyne.Window, peer pairserver.Peer) {
+	files := server.Files()
+	if len(files) == 0 {
+		dialog.ShowInformation(tr("提示"), tr("请先选择需要发送的文件"), w)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	status := widget.NewLabel(tr("等待 %s 确认接收…", peer.Name))
+	bar := widget.NewProgressBar()
+	content := container.NewVBox(status, bar, widget.NewButton(tr("取消"), cancel))
+	d := dialog.NewCustomWithoutButtons(tr("发送文件"), content, w)
+	d.Show()
+
+	go func() {
+		err := pairserver.PushFiles(ctx, peer, deviceName(), files, func(sent, total int64) {
+			fyne.Do(func() {
+				status.SetText(tr("正在发送到 %s…", peer.Name))
+				if total > 0 {
+					bar.SetValue(float64(sent) / float64(total))
+				}
+			})
+		})
+		cancel()
+		fyne.Do(func() {
+			d.Hide()
+			switch {
+			case errors.Is(err, context.Canceled):
+			case errors.Is(err, pairserver.ErrPushDeclined):
+				dialog.ShowInformation(tr("发送文件"), tr("%s 拒绝接收", peer.Name), w)
+			case err != nil:
+				dialog.ShowError(fmt.Errorf(tr("发送失败: %v"), err), w)
+			default:
+				dialog.ShowInformation(tr("发送文件"), tr("已发送 %d 个文件到 %s", len(files), peer.Name), w)
+			}
+		})
+	}()
+}
+
+// askPush 在主窗口中询问是否接收附近设备直接发送的文件，阻塞直到用户选择
+func askPush(req pairserver.PushRequest) bool {
+	result := make(chan bool, 1)
+
+	names := make([]string, len(req.Files))
+	for i, f := range req.Files {
+		names[i] = f.Name
+	}
+
+	fyne.Do(func() {
+		list := widget.NewLabel(strings.Join(names, "\n"))
+		list.Wrapping = fyne.TextWrapWord
+		content := container.NewBorder(
+			widget.NewLabel(tr("%s（%s）想发送 %d 个文件（%d KB）：", req.From, req.IP, len(req.Files), req.TotalSize()/1024)),
+			nil, nil, nil,
+			container.NewVScroll(list),
+		)
+		d := dialog.NewCustomConfirm(tr("接收文件"), tr("接收"), tr("拒绝"), content, func(ok bool) {
+			result <- ok
+		}, mainWindow)
+		d.Resize(fyne.NewSize(420, 300))
+		d.Show()
+		mainWindow.Show()
+	})
+
+	return <-result
+}
+
+// askUpload 在主窗口中询问是否接收手机上传的文件，阻塞直到用户选择；
+// 勾选信任后本次服务运行期间自动接收该设备的上传
+func askUpload(req pairserver.UploadRequest) (accept, trust bool) {
+	result := make(chan [2]bool, 1)
+
+	size := tr("大小未知")
+	if req.Size >= 0 {
+		size = formatBytes(req.Size)
+	}
+	fyne.Do(func() {
+		who := req.IP
+		if name := server.ClientName(req.IP); name != "" {
+			who = fmt.Sprintf("%s（%s）", name, req.IP)
+		}
+		label := widget.NewLabel(tr("%s 想发送 %s（%s）", who, req.Filename, size))
+		label.Wrapping = fyne.TextWrapWord
+		trustCheck := widget.NewCheck(tr("信任该设备，本次服务期间自动接收"), nil)
+		content := container.NewVBox(label, trustCheck)
+		d := dialog.NewCustomConfirm(tr("接收文件"), tr("接收"), tr("拒绝"), content, func(ok bool) {
+			result <- [2]bool{ok, ok && trustCheck.Checked}
+		}, mainWindow)
+		d.Resize(fyne.NewSize(420, 200))
+		d.Show()
+		mainWindow.Show()
+	})
+
+	answer := <-result
+	return answer[0], answer[1]
+}
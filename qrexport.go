@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+)
+
+// qrExportSize 保存为PNG时的图片边长(像素)，比界面中的二维码大，便于打印
+const qrExportSize = 1024
+
+// saveQRCode 将link的二维码保存为PNG或SVG文件，按文件扩展名选择格式，默认为PNG
+func saveQRCode(link string) {
+	d := dialog.NewFileSave(func(w fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, mainWindow)
+			return
+		}
+		if w == nil {
+			return
+		}
+		err = writeQRCode(w, link, strings.EqualFold(filepath.Ext(w.URI().Path()), ".svg"))
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			dialog.ShowError(fmt.Errorf(tr("保存二维码失败: %v"), err), mainWindow)
+			return
+		}
+		dialog.ShowInformation(tr("保存二维码"), tr("二维码已保存到 %s", w.URI().Path()), mainWindow)
+	}, mainWindow)
+	d.SetFilter(storage.NewExtensionFileFilter([]string{".png", ".svg"}))
+	d.SetFileName("pair-gui-qrcode.png")
+	d.Show()
+}
+
+// writeQRCode 按设置中的二维码样式将link的二维码以PNG或SVG格式写入w
+func writeQRCode(w io.Writer, link string, svg bool) error {
+	settingsMutex.RLock()
+	st := appSettings.qrStyle()
+	settingsMutex.RUnlock()
+
+	if !svg {
+		data, err := qrPNG(link, st, max(st.size, qrExportSize))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	q, err := newQRCode(link, st)
+	if err != nil {
+		return err
+	}
+	data, err := qrSVG(q.Bitmap(), st)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// qrSVG 将二维码点阵转换为SVG矢量图，每个模块占一个单位，缩放时保持清晰
+func qrSVG(bitmap [][]bool, st qrStyle) ([]byte, error) {
+	var b bytes.Buffer
+	n := len(bitmap)
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, n, n)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="%s"/><path fill="%s" d="`, n, n, hexColor(st.bg), hexColor(st.fg))
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	b.WriteString(`"/>`)
+	if st.logo != "" {
+		logo, err := qrLogoSVG(st.logo, st.bg, n)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(logo)
+	}
+	b.WriteString("</svg>\n")
+	return b.Bytes(), nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg" // 解码JPEG格式的Logo
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/image/draw"
+)
+
+// 二维码样式
+const (
+	defaultQRSize  = 256  // 默认的二维码边长(像素)
+	minQRSize      = 128  // 二维码边长下限
+	maxQRSize      = 2048 // 二维码边长上限
+	qrLogoFraction = 5    // Logo边长为二维码边长的1/5，遮挡的模块由高纠错级别恢复
+)
+
+// qrLevels 可选的纠错级别，级别越高越耐遮挡和污损，但二维码越密
+var qrLevels = []string{"low", "medium", "high", "highest"}
+
+// qrStyle 生成二维码使用的大小、纠错级别、颜色和Logo
+type qrStyle struct {
+	size   int
+	level  qrcode.RecoveryLevel
+	fg, bg color.Color
+	logo   string // Logo图片路径，空表示不嵌入
+}
+
+// qrSize 返回二维码边长(像素)，未设置时使用默认值
+func (s Settings) qrSize() int {
+	if s.QRSize <= 0 {
+		return defaultQRSize
+	}
+	return min(max(s.QRSize, minQRSize), maxQRSize)
+}
+
+// qrStyle 返回设置中的二维码样式；嵌入Logo时纠错级别至少为high，否则被遮挡的部分无法识别
+func (s Settings) qrStyle() qrStyle {
+	level := qrcode.Medium
+	switch s.QRLevel {
+	case "low":
+		level = qrcode.Low
+	case "high":
+		level = qrcode.High
+	case "highest":
+		level = qrcode.Highest
+	}
+	if s.QRLogo != "" && level < qrcode.High {
+		level = qrcode.High
+	}
+	fg, err := parseHexColor(s.QRForeground)
+	if err != nil {
+		fg = color.Black
+	}
+	bg, err := parseHexColor(s.QRBackground)
+	if err != nil {
+		bg = color.White
+	}
+	return qrStyle{size: s.qrSize(), level: level, fg: fg, bg: bg, logo: s.QRLogo}
+}
+
+// parseHexColor 解析 #rrggbb 或 #rgb 格式的颜色
+func parseHexColor(text string) (color.Color, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(text), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 6 || err != nil {
+		return nil, fmt.Errorf(tr("无效的颜色: %s"), text)
+	}
+	return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+// hexColor 将颜色格式化为 #rrggbb
+func hexColor(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B)
+}
+
+// newQRCode 按样式生成link的二维码
+func newQRCode(link string, st qrStyle) (*qrcode.QRCode, error) {
+	q, err := qrcode.New(link, st.level)
+	if err != nil {
+		return nil, err
+	}
+	q.ForegroundColor = st.fg
+	q.BackgroundColor = st.bg
+	return q, nil
+}
+
+// loadQRLogo 读取Logo图片
+func loadQRLogo(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// qrPNG 按样式生成边长为size的PNG二维码，设置了Logo时将其缩放后绘制在中央，并留出背景色边框
+func qrPNG(link string, st qrStyle, size int) ([]byte, error) {
+	q, err := newQRCode(link, st)
+	if err != nil {
+		return nil, err
+	}
+	if st.logo == "" {
+		return q.PNG(size)
+	}
+	logo, err := loadQRLogo(st.logo)
+	if err != nil {
+		return nil, fmt.Errorf(tr("读取Logo失败: %v"), err)
+	}
+
+	src := q.Image(size)
+	img := image.NewNRGBA(src.Bounds())
+	draw.Draw(img, img.Bounds(), src, image.Point{}, draw.Src)
+
+	n := img.Bounds().Dx()
+	side := n / qrLogoFraction
+	pad := side / 10
+	at := image.Rect((n-side)/2, (n-side)/2, (n+side)/2, (n+side)/2)
+	draw.Draw(img, at.Inset(-pad), image.NewUniform(st.bg), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(img, fitRect(at, logo.Bounds()), logo, logo.Bounds(), draw.Over, nil)
+
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// fitRect 返回在box中居中并保持src宽高比的最大矩形
+func fitRect(box, src image.Rectangle) image.Rectangle {
+	w, h := box.Dx(), box.Dy()
+	if src.Dx()*h > src.Dy()*w {
+		h = w * src.Dy() / max(src.Dx(), 1)
+	} else {
+		w = h * src.Dx() / max(src.Dy(), 1)
+	}
+	x, y := box.Min.X+(box.Dx()-w)/2, box.Min.Y+(box.Dy()-h)/2
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// qrLogoSVG 返回嵌入SVG的Logo元素，坐标以二维码模块为单位，n为二维码边长(模块数)
+func qrLogoSVG(path string, bg color.Color, n int) (string, error) {
+	logo, err := loadQRLogo(path)
+	if err != nil {
+		return "", fmt.Errorf(tr("读取Logo失败: %v"), err)
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, logo); err != nil {
+		return "", err
+	}
+	side := float64(n) / qrLogoFraction
+	pos := (float64(n) - side) / 2
+	pad := side / 10
+	return fmt.Sprintf(`<rect x="%g" y="%g" width="%g" height="%g" fill="%s"/>`+
+		`<image x="%g" y="%g" width="%g" height="%g" href="data:image/png;base64,%s"/>`,
+		pos-pad, pos-pad, side+2*pad, side+2*pad, hexColor(bg),
+		pos, pos, side, side, base64.StdEncoding.EncodeToString(b.Bytes())), nil
+}
+
+// qrStyleWindow 二维码样式设置窗口，同一时间只打开一个
+var qrStyleWindow fyne.Window
+
+// showQRStyle 打开二维码样式设置窗口，可调整大小、纠错级别、颜色和中央的Logo，
+// 在电视或投影上显示时可放大二维码
+func showQRStyle(a fyne.App) {
+	if qrStyleWindow != nil {
+		qrStyleWindow.RequestFocus()
+		return
+	}
+
+	w := a.NewWindow(tr("二维码样式"))
+	qrStyleWindow = w
+	w.SetOnClosed(func() { qrStyleWindow = nil })
+
+	settingsMutex.RLock()
+	s := appSettings
+	settingsMutex.RUnlock()
+
+	sizeEntry := widget.NewEntry()
+	sizeEntry.SetText(strconv.Itoa(s.qrSize()))
+
+	levelLabels := []string{tr("低（7%）"), tr("中（15%）"), tr("高（25%）"), tr("最高（30%）")}
+	levelSelect := widget.NewSelect(levelLabels, nil)
+	levelSelect.SetSelectedIndex(1)
+	for i, level := range qrLevels {
+		if level == s.QRLevel {
+			levelSelect.SetSelectedIndex(i)
+		}
+	}
+
+	fgEntry := widget.NewEntry()
+	fgEntry.SetText(hexColor(s.qrStyle().fg))
+	bgEntry := widget.NewEntry()
+	bgEntry.SetText(hexColor(s.qrStyle().bg))
+
+	logoLabel := widget.NewLabel(s.QRLogo)
+	logoLabel.Truncation = fyne.TextTruncateEllipsis
+	logo := s.QRLogo
+	logoBtn := widget.NewButtonWithIcon("", theme.FolderOpenIcon(), func() {
+		d := dialog.NewFileOpen(func(r fyne.URIReadCloser, err error) {
+			if err != nil || r == nil {
+				return
+			}
+			r.Close()
+			logo = r.URI().Path()
+			logoLabel.SetText(logo)
+		}, w)
+		d.SetFilter(storage.NewExtensionFileFilter([]string{".png", ".jpg", ".jpeg"}))
+		d.Show()
+	})
+	clearLogoBtn := widget.NewButtonWithIcon("", theme.ContentClearIcon(), func() {
+		logo = ""
+		logoLabel.SetText("")
+	})
+
+	saveBtn := widget.NewButton(tr("保存"), func() {
+		size, err := strconv.Atoi(sizeEntry.Text)
+		if err != nil || size < minQRSize || size > maxQRSize {
+			dialog.ShowError(fmt.Errorf(tr("二维码大小应在 %d 到 %d 像素之间"), minQRSize, maxQRSize), w)
+			return
+		}
+		for _, entry := range []*widget.Entry{fgEntry, bgEntry} {
+			if _, err := parseHexColor(entry.Text); err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+		}
+		if logo != "" {
+			if _, err := loadQRLogo(logo); err != nil {
+				dialog.ShowError(fmt.Errorf(tr("读取Logo失败: %v"), err), w)
+				return
+			}
+		}
+		updateSettings(func(s *Settings) {
+			s.QRSize = size
+			s.QRLevel = qrLevels[levelSelect.SelectedIndex()]
+			s.QRForeground = strings.TrimSpace(fgEntry.Text)
+			s.QRBackground = strings.TrimSpace(bgEntry.Text)
+			s.QRLogo = logo
+		})
+		refreshSharePanel()
+		w.Close()
+	})
+	saveBtn.Importance = widget.HighImportance
+
+	form := widget.NewForm(
+		widget.NewFormItem(tr("大小（像素）"), sizeEntry),
+		widget.NewFormItem(tr("纠错级别"), levelSelect),
+		widget.NewFormItem(tr("前景色"), fgEntry),
+		widget.NewFormItem(tr("背景色"), bgEntry),
+		widget.NewFormItem(tr("中央Logo"), container.NewBorder(nil, nil, nil,
+			container.NewHBox(logoBtn, clearLogoBtn), logoLabel)),
+	)
+	hint := widget.NewLabel(tr("嵌入Logo时纠错级别至少为“高”；前景色应明显深于背景色，否则部分手机无法识别"))
+	hint.Wrapping = fyne.TextWrapWord
+	w.SetContent(container.NewBorder(nil, saveBtn, nil, nil, container.NewVBox(form, hint)))
+	w.Resize(fyne.NewSize(480, 0))
+	w.Show()
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+
+	"pair-gui/pairserver"
+)
+
+// 偏好设置键名
+const (
+	prefPort           = "port"                // 端口号
+	prefTheme          = "theme"               // 主题
+	prefUploadDir      = "upload_dir"          // 上传文件保存目录
+	prefSharedFiles    = "shared_files"        // 上次分享的文件列表
+	prefSharedDirs     = "shared_dirs"         // 上次共享的目录列表
+	prefLanguage       = "language"            // 界面语言
+	prefRateLimit      = "rate_limit"          // 传输限速
+	prefTLS            = "tls"                 // 启用HTTPS
+	prefHTTP3          = "http3"               // 启用HTTP/3
+	prefPIN            = "pin"                 // 访问PIN码
+	prefToken          = "access_token"        // 要求访问令牌
+	prefAllowlist      = "allowlist"           // 允许访问的IP
+	prefBlocklist      = "blocklist"           // 屏蔽的IP
+	prefClientNames    = "client_names"        // 在电脑上为客户端设置的名称
+	prefConflict       = "conflict_policy"     // 上传文件重名处理方式
+	prefMaxUpload      = "max_upload_mb"       // 上传大小限制
+	prefClipboard      = "clipboard_sync"      // 剪贴板同步
+	prefConfirmUploads = "confirm_uploads"     // 接收上传前询问
+	prefMDNS           = "mdns"                // mDNS广播主机名
+	prefDiscovery      = "discovery"           // 局域网设备发现
+	prefSyncDir        = "sync_dir"            // 文件夹同步的本地目录
+	prefSyncPeer       = "sync_peer"           // 文件夹同步的对方设备
+	prefSyncKey        = "sync_key"            // 文件夹同步密钥
+	prefInternet       = "internet_sharing"    // Internet分享
+	prefTor            = "tor"                 // Tor洋葱服务分享
+	prefTorControl     = "tor_control"         // Tor控制端口地址
+	prefCrocRelay      = "croc_relay"          // croc中继地址
+	prefCrocPassword   = "croc_relay_password" // croc中继密码
+	prefQRHost         = "qr_host"             // 二维码使用的主机地址
+	prefWebDAV         = "webdav"              // WebDAV
+	prefFTP            = "ftp"                 // FTP服务
+	prefFTPPort        = "ftp_port"            // FTP服务端口
+	prefDLNA           = "dlna"                // DLNA媒体服务器
+	prefAPI            = "api"                 // 管理接口
+	prefAPIKey         = "api_key"             // 管理接口密钥
+	prefAPIAddr        = "api_addr"            // 管理接口监听地址
+	prefWebhooks       = "webhooks"            // 传输完成时通知的Webhook地址
+	prefPostReceive    = "post_receive"        // 上传完成后执行的命令
+	prefNotifyUploads  = "notify_uploads"      // 收到文件时弹出通知
+	prefSoundUpload    = "sound_upload"        // 收到文件时的提示音
+	prefSoundDownload  = "sound_download"      // 开始下载时的提示音
+	prefSoundError     = "sound_error"         // 传输失败时的提示音
+	prefOneShot        = "one_shot"            // 一次性分享
+	prefShareTTL       = "share_ttl"           // 分享链接有效期
+	prefBasicUser      = "basic_user"          // HTTP基本认证用户名
+	prefBasicPassword  = "basic_password"      // HTTP基本认证密码
+	prefLogFile        = "log_file"            // 写入日志文件
+	prefLogMaxMB       = "log_max_mb"          // 日志文件大小上限
+	prefLogBackups     = "log_backups"         // 保留的旧日志文件数
+	prefReadHeaderTO   = "read_header_timeout" // 读取请求头的超时
+	prefIdleTO         = "idle_timeout"        // 空闲连接的超时
+	prefStallTO        = "stall_timeout"       // 下载停滞的超时
+	prefLogLevel       = "log_level"           // 日志详细程度
+	prefQRSize         = "qr_size"             // 二维码边长
+	prefQRLevel        = "qr_level"            // 二维码纠错级别
+	prefQRLogo         = "qr_logo"             // 二维码中央的Logo
+	prefQRForeground   = "qr_foreground"       // 二维码前景色
+	prefQRBackground   = "qr_background"       // 二维码背景色
+	prefTemplateDir    = "template_dir"        // 覆盖内置网页模板的目录
+	prefPathPrefix     = "path_prefix"         // 网页的路径前缀
+	prefBrandTitle     = "brand_title"         // 网页和窗口标题中的名称
+	prefBrandLogo      = "brand_logo"          // 网页顶部的Logo
+	prefBrandAccent    = "brand_accent"        // 网页的主题色
+)
+
+// 默认设置
+const (
+	defaultPort  = 1082
+	defaultTheme = themeLight
+)
+
+// Settings 应用设置，同时对应配置文件中的字段
+type Settings struct {
+	Port            int      `toml:"port"`                // 服务端口
+	Theme           string   `toml:"theme"`               // 主题：light/dark/system
+	UploadDir       string   `toml:"upload_dir"`          // 上传文件保存目录，空表示当前目录
+	SharedFiles     []string `toml:"-"`                   // 分享文件的绝对路径
+	SharedDirs      []string `toml:"-"`                   // 共享目录的绝对路径
+	Language        string   `toml:"language"`            // 界面语言：空表示跟随系统，zh/en
+	RateLimitKB     int      `toml:"rate_limit"`          // 上传/下载限速(KB/s)，0表示不限速
+	TLS             bool     `toml:"tls"`                 // 使用自签名证书启用HTTPS
+	HTTP3           bool     `toml:"http3"`               // 启用HTTPS时同时提供HTTP/3（QUIC）监听
+	PIN             string   `toml:"pin"`                 // 网页访问PIN码，空表示不需要
+	AccessToken     bool     `toml:"access_token"`        // 二维码URL附带一次性访问令牌，无令牌的请求被拒绝
+	Allowlist       []string `toml:"allowlist"`           // 允许访问的IP或网段，为空表示不限制
+	Blocklist       []string `toml:"blocklist"`           // 屏蔽的IP或网段
+	ClientNames     []string `toml:"client_names"`        // 在电脑上为客户端设置的名称，格式为“IP=名称”
+	ConflictPolicy  string   `toml:"conflict_policy"`     // 上传文件重名时：rename/overwrite/reject/ask
+	MaxUploadMB     int      `toml:"max_upload_mb"`       // 单次上传的最大大小(MB)，0表示不限制
+	ClipboardSync   bool     `toml:"clipboard_sync"`      // 电脑与手机网页同步剪贴板
+	ConfirmUploads  bool     `toml:"confirm_uploads"`     // 接收每个上传前在电脑上确认
+	MDNS            bool     `toml:"mdns"`                // 通过mDNS广播 pair-gui.local，二维码使用主机名代替IP
+	Discovery       bool     `toml:"discovery"`           // 在局域网中发现其他实例并广播本机状态
+	SyncDir         string   `toml:"sync_dir"`            // 与附近设备双向同步的目录，空表示不同步
+	SyncPeer        string   `toml:"sync_peer"`           // 同步的对方设备名称
+	SyncKey         string   `toml:"sync_key"`            // 同步密钥，双方需设置相同的值
+	InternetSharing bool     `toml:"internet_sharing"`    // 请求路由器端口映射，二维码使用公网地址，并强制要求访问令牌
+	Tor             bool     `toml:"tor"`                 // 通过本机Tor发布临时洋葱服务，二维码使用.onion地址，并强制要求访问令牌
+	TorControl      string   `toml:"tor_control"`         // Tor控制端口地址，空表示依次尝试9051和9151
+	CrocRelay       string   `toml:"croc_relay"`          // croc传输使用的中继地址，空表示croc的公共中继
+	CrocPassword    string   `toml:"croc_relay_password"` // croc中继密码，空表示公共中继的密码
+	WormholeMailbox string   `toml:"wormhole_mailbox"`    // wormhole传输使用的邮箱服务器，空表示magic-wormhole的公共服务器
+	WormholeTransit string   `toml:"wormhole_transit"`    // wormhole传输使用的传输中继，空表示magic-wormhole的公共中继
+	QRHost          string   `toml:"qr_host"`             // 二维码使用的主机地址，如Tailscale IP或MagicDNS名称，空表示局域网IP
+	WebDAV          bool     `toml:"webdav"`              // 通过WebDAV提供分享文件和上传目录，可挂载为网络驱动器
+	FTP             bool     `toml:"ftp"`                 // 同时提供FTP服务，供只支持FTP的电视等设备使用
+	FTPPort         int      `toml:"ftp_port"`            // FTP服务端口
+	DLNA            bool     `toml:"dlna"`                // 作为DLNA媒体服务器，供电视和播放器浏览播放分享的媒体文件
+	API             bool     `toml:"api"`                 // 启用管理接口，供脚本添加分享文件和控制服务
+	APIKey          string   `toml:"api_key"`             // 管理接口密钥，启用时为空则自动生成
+	APIAddr         string   `toml:"api_addr"`            // 管理接口监听地址
+	Webhooks        []string `toml:"webhooks"`            // 上传完成或文件被下载时以JSON POST通知的URL
+	PostReceive     string   `toml:"post_receive"`        // 每次上传完成后执行的shell命令，空表示不执行
+	NotifyUploads   bool     `toml:"notify_uploads"`      // 收到文件时弹出系统通知
+	SoundUpload     bool     `toml:"sound_upload"`        // 收到文件时播放提示音
+	SoundDownload   bool     `toml:"sound_download"`      // 手机开始下载文件时播放提示音
+	SoundError      bool     `toml:"sound_error"`         // 上传或下载失败时播放提示音
+	OneShot         bool     `toml:"one_shot"`            // 每个分享文件都被完整下载过一次后自动停止服务
+	ShareTTL        int      `toml:"share_ttl"`           // 分享链接从启动服务起的有效期(分钟)，0表示不过期
+	BasicUser       string   `toml:"basic_user"`          // HTTP基本认证的用户名
+	BasicPassword   string   `toml:"basic_password"`      // HTTP基本认证的密码，空表示不启用
+	LogFile         bool     `toml:"log_file"`            // 将请求日志和程序日志写入配置目录下的logs/pair-gui.log
+	LogMaxMB        int      `toml:"log_max_mb"`          // 日志文件超过该大小(MB)时轮转
+	LogBackups      int      `toml:"log_backups"`         // 轮转后保留的旧日志文件数
+	ReadHeaderTO    int      `toml:"read_header_timeout"` // 读取请求头的超时(秒)，0表示不限制
+	IdleTO          int      `toml:"idle_timeout"`        // 保持空闲连接的超时(秒)，0表示不限制
+	StallTO         int      `toml:"stall_timeout"`       // 下载停滞超过该时间(秒)后断开连接，0表示不限制
+	LogLevel        string   `toml:"log_level"`           // 日志详细程度：off/info/debug
+	QRSize          int      `toml:"qr_size"`             // 二维码边长(像素)
+	QRLevel         string   `toml:"qr_level"`            // 二维码纠错级别：low/medium/high/highest
+	QRLogo          string   `toml:"qr_logo"`             // 嵌入二维码中央的Logo图片(PNG/JPEG)，空表示不嵌入
+	QRForeground    string   `toml:"qr_foreground"`       // 二维码前景色，如#000000
+	QRBackground    string   `toml:"qr_background"`       // 二维码背景色，如#ffffff
+	TemplateDir     string   `toml:"template_dir"`        // 覆盖内置网页模板的目录，其中的同名.html文件替换内置版本，空表示只用内置模板
+	PathPrefix      string   `toml:"path_prefix"`         // 网页的路径前缀，如/share，放在反向代理后与其他服务共用域名时使用，空表示不使用
+	BrandTitle      string   `toml:"brand_title"`         // 显示在网页顶部、标签页和窗口标题中的名称，空表示不显示
+	BrandLogo       string   `toml:"brand_logo"`          // 显示在网页顶部的Logo图片(PNG/JPEG/GIF/WebP)，空表示不显示
+	BrandAccent     string   `toml:"brand_accent"`        // 网页按钮和链接的主题色，如#4285f4，空表示默认
+}
+
+// loadSettings 读取配置。配置文件是设置的唯一来源：found为真时直接使用其中的值，
+// 手动修改配置文件后重启即生效；Fyne偏好设置只提供分享的文件和目录列表，旧版本留下的其他设置项随之删除。
+// 配置文件不存在或无法解析时才读取偏好设置，沿用旧版本保存在其中的值，缺少的项取cfg中的默认值
+func loadSettings(p fyne.Preferences, cfg Settings, found bool) Settings {
+	if found {
+		removeLegacyPrefs(p)
+		cfg.SharedFiles = p.StringList(prefSharedFiles)
+		cfg.SharedDirs = p.StringList(prefSharedDirs)
+		return cfg
+	}
+	return Settings{
+		Port:            p.IntWithFallback(prefPort, cfg.Port),
+		Theme:           p.StringWithFallback(prefTheme, cfg.Theme),
+		UploadDir:       p.StringWithFallback(prefUploadDir, cfg.UploadDir),
+		SharedFiles:     p.StringList(prefSharedFiles),
+		SharedDirs:      p.StringList(prefSharedDirs),
+		Language:        p.StringWithFallback(prefLanguage, cfg.Language),
+		RateLimitKB:     p.IntWithFallback(prefRateLimit, cfg.RateLimitKB),
+		TLS:             p.BoolWithFallback(prefTLS, cfg.TLS),
+		HTTP3:           p.BoolWithFallback(prefHTTP3, cfg.HTTP3),
+		PIN:             p.StringWithFallback(prefPIN, cfg.PIN),
+		AccessToken:     p.BoolWithFallback(prefToken, cfg.AccessToken),
+		Allowlist:       p.StringListWithFallback(prefAllowlist, cfg.Allowlist),
+		Blocklist:       p.StringListWithFallback(prefBlocklist, cfg.Blocklist),
+		ClientNames:     p.StringListWithFallback(prefClientNames, cfg.ClientNames),
+		ConflictPolicy:  p.StringWithFallback(prefConflict, cfg.ConflictPolicy),
+		MaxUploadMB:     p.IntWithFallback(prefMaxUpload, cfg.MaxUploadMB),
+		ClipboardSync:   p.BoolWithFallback(prefClipboard, cfg.ClipboardSync),
+		ConfirmUploads:  p.BoolWithFallback(prefConfirmUploads, cfg.ConfirmUploads),
+		MDNS:            p.BoolWithFallback(prefMDNS, cfg.MDNS),
+		Discovery:       p.BoolWithFallback(prefDiscovery, cfg.Discovery),
+		SyncDir:         p.StringWithFallback(prefSyncDir, cfg.SyncDir),
+		SyncPeer:        p.StringWithFallback(prefSyncPeer, cfg.SyncPeer),
+		SyncKey:         p.StringWithFallback(prefSyncKey, cfg.SyncKey),
+		InternetSharing: p.BoolWithFallback(prefInternet, cfg.InternetSharing),
+		Tor:             p.BoolWithFallback(prefTor, cfg.Tor),
+		TorControl:      p.StringWithFallback(prefTorControl, cfg.TorControl),
+		CrocRelay:       p.StringWithFallback(prefCrocRelay, cfg.CrocRelay),
+		CrocPassword:    p.StringWithFallback(prefCrocPassword, cfg.CrocPassword),
+		QRHost:          p.StringWithFallback(prefQRHost, cfg.QRHost),
+		WebDAV:          p.BoolWithFallback(prefWebDAV, cfg.WebDAV),
+		FTP:             p.BoolWithFallback(prefFTP, cfg.FTP),
+		FTPPort:         p.IntWithFallback(prefFTPPort, cfg.FTPPort),
+		DLNA:            p.BoolWithFallback(prefDLNA, cfg.DLNA),
+		API:             p.BoolWithFallback(prefAPI, cfg.API),
+		APIKey:          p.StringWithFallback(prefAPIKey, cfg.APIKey),
+		APIAddr:         p.StringWithFallback(prefAPIAddr, cfg.APIAddr),
+		Webhooks:        p.StringListWithFallback(prefWebhooks, cfg.Webhooks),
+		PostReceive:     p.StringWithFallback(prefPostReceive, cfg.PostReceive),
+		NotifyUploads:   p.BoolWithFallback(prefNotifyUploads, cfg.NotifyUploads),
+		SoundUpload:     p.BoolWithFallback(prefSoundUpload, cfg.SoundUpload),
+		SoundDownload:   p.BoolWithFallback(prefSoundDownload, cfg.SoundDownload),
+		SoundError:      p.BoolWithFallback(prefSoundError, cfg.SoundError),
+		OneShot:         p.BoolWithFallback(prefOneShot, cfg.OneShot),
+		ShareTTL:        p.IntWithFallback(prefShareTTL, cfg.ShareTTL),
+		BasicUser:       p.StringWithFallback(prefBasicUser, cfg.BasicUser),
+		BasicPassword:   p.StringWithFallback(prefBasicPassword, cfg.BasicPassword),
+		LogFile:         p.BoolWithFallback(prefLogFile, cfg.LogFile),
+		LogMaxMB:        p.IntWithFallback(prefLogMaxMB, cfg.LogMaxMB),
+		LogBackups:      p.IntWithFallback(prefLogBackups, cfg.LogBackups),
+		ReadHeaderTO:    p.IntWithFallback(prefReadHeaderTO, cfg.ReadHeaderTO),
+		IdleTO:          p.IntWithFallback(prefIdleTO, cfg.IdleTO),
+		StallTO:         p.IntWithFallback(prefStallTO, cfg.StallTO),
+		LogLevel:        p.StringWithFallback(prefLogLevel, cfg.LogLevel),
+		QRSize:          p.IntWithFallback(prefQRSize, cfg.QRSize),
+		QRLevel:         p.StringWithFallback(prefQRLevel, cfg.QRLevel),
+		QRLogo:          p.StringWithFallback(prefQRLogo, cfg.QRLogo),
+		QRForeground:    p.StringWithFallback(prefQRForeground, cfg.QRForeground),
+		QRBackground:    p.StringWithFallback(prefQRBackground, cfg.QRBackground),
+		TemplateDir:     p.StringWithFallback(prefTemplateDir, cfg.TemplateDir),
+		PathPrefix:      p.StringWithFallback(prefPathPrefix, cfg.PathPrefix),
+		BrandTitle:      p.StringWithFallback(prefBrandTitle, cfg.BrandTitle),
+		BrandLogo:       p.StringWithFallback(prefBrandLogo, cfg.BrandLogo),
+		BrandAccent:     p.StringWithFallback(prefBrandAccent, cfg.BrandAccent),
+	}
+}
+
+// legacyPrefKeys 旧版本保存在Fyne偏好设置中的设置项。偏好设置文件不限制其他用户读取，
+// 设置改为只保存在配置文件中，这些值迁移到配置文件后删除
+var legacyPrefKeys = []string{
+	prefPort, prefTheme, prefUploadDir, prefLanguage, prefRateLimit, prefTLS, prefHTTP3, prefPIN, prefToken,
+	prefAllowlist, prefBlocklist, prefClientNames, prefConflict, prefMaxUpload, prefClipboard, prefConfirmUploads,
+	prefMDNS, prefDiscovery, prefSyncDir, prefSyncPeer, prefSyncKey, prefInternet, prefTor, prefTorControl,
+	prefCrocRelay, prefCrocPassword, prefQRHost, prefWebDAV, prefFTP, prefFTPPort, prefDLNA, prefAPI, prefAPIKey,
+	prefAPIAddr, prefWebhooks, prefPostReceive, prefNotifyUploads, prefSoundUpload, prefSoundDownload, prefSoundError,
+	prefOneShot, prefShareTTL, prefBasicUser, prefBasicPassword, prefLogFile, prefLogMaxMB, prefLogBackups,
+	prefReadHeaderTO, prefIdleTO, prefStallTO, prefLogLevel, prefQRSize, prefQRLevel, prefQRLogo, prefQRForeground,
+	prefQRBackground, prefTemplateDir, prefPathPrefix, prefBrandTitle, prefBrandLogo, prefBrandAccent,
+}
+
+// removeLegacyPrefs 删除旧版本保存在偏好设置中的设置项，其中包括PIN码、密码和密钥
+func removeLegacyPrefs(p fyne.Preferences) {
+	for _, key := range legacyPrefKeys {
+		p.RemoveValue(key)
+	}
+}
+
+// saveSettings 将设置写入配置文件，偏好设置中只保存分享的文件和目录列表。
+// 配置文件写入成功后删除旧版本保存在偏好设置中的设置项
+func saveSettings(p fyne.Preferences, s Settings) {
+	p.SetStringList(prefSharedFiles, s.SharedFiles)
+	p.SetStringList(prefSharedDirs, s.SharedDirs)
+
+	if err := saveConfigFile(s); err != nil {
+		log.Printf("写入配置文件失败: %v", err)
+		return
+	}
+	removeLegacyPrefs(p)
+}
+
+// portString 返回端口号的字符串形式
+func (s Settings) portString() string {
+	return strconv.Itoa(s.Port)
+}
+
+// maxUploadSize 返回上传大小限制的字节数，0表示不限制
+func (s Settings) maxUploadSize() int64 {
+	return int64(s.MaxUploadMB) << 20
+}
+
+// shareTTL 返回分享链接的有效期，0表示不过期
+func (s Settings) shareTTL() time.Duration {
+	return time.Duration(s.ShareTTL) * time.Minute
+}
+
+// logMaxMB 返回日志文件的大小上限(MB)，未设置时使用默认值
+func (s Settings) logMaxMB() int {
+	if s.LogMaxMB <= 0 {
+		return defaultLogMaxMB
+	}
+	return s.LogMaxMB
+}
+
+// logLevel 返回日志详细程度，无效的值视为info
+func (s Settings) logLevel() string {
+	switch s.LogLevel {
+	case logOff, logDebug:
+		return s.LogLevel
+	default:
+		return logInfo
+	}
+}
+
+// logBackups 返回保留的旧日志文件数，0表示轮转时直接删除旧日志
+func (s Settings) logBackups() int {
+	return max(s.LogBackups, 0)
+}
+
+// timeouts 返回读取请求头、空闲连接和下载停滞的超时，0表示不限制
+func (s Settings) timeouts() (readHeader, idle, stall time.Duration) {
+	return time.Duration(max(s.ReadHeaderTO, 0)) * time.Second,
+		time.Duration(max(s.IdleTO, 0)) * time.Second,
+		time.Duration(max(s.StallTO, 0)) * time.Second
+}
+
+// ftpPort 返回FTP服务端口，未启用时为0
+func (s Settings) ftpPort() int {
+	if !s.FTP {
+		return 0
+	}
+	if s.FTPPort <= 0 {
+		return pairserver.DefaultFTPPort
+	}
+	return s.FTPPort
+}
+
+// dlnaName 返回DLNA媒体服务器的名称，未启用时为空
+func (s Settings) dlnaName() string {
+	if !s.DLNA {
+		return ""
+	}
+	return "pair-gui (" + deviceName() + ")"
+}
+
+// apiAddr 返回管理接口的监听地址
+func (s Settings) apiAddr() string {
+	if s.APIAddr == "" {
+		return pairserver.DefaultAPIAddr
+	}
+	return s.APIAddr
+}
+
+// clientNames 返回客户端IP到名称的映射
+func (s Settings) clientNames() map[string]string {
+	names := make(map[string]string, len(s.ClientNames))
+	for _, entry := range s.ClientNames {
+		if ip, name, ok := strings.Cut(entry, "="); ok {
+			names[ip] = name
+		}
+	}
+	return names
+}
+
+// requireToken 返回是否要求访问令牌，Internet分享或Tor分享时始终要求
+func (s Settings) requireToken() bool {
+	return s.AccessToken || s.InternetSharing || s.Tor
+}
+
+// mdnsName 返回mDNS广播的主机名，未启用时为空
+func (s Settings) mdnsName() string {
+	if !s.MDNS {
+		return ""
+	}
+	return pairserver.DefaultMDNSName
+}
+
+// uploadDirOrDefault 返回上传目录，未设置时返回当前工作目录
+func (s Settings) uploadDirOrDefault() string {
+	if s.UploadDir != "" {
+		return s.UploadDir
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return "."
+	}
+	return dir
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"pair-gui/pairserver"
+)
+
+var (
+	sharePanel     *fyne.Container // 主窗口中显示二维码和服务状态的区域，切换语言重建界面时替换
+	sharePanelStop chan struct{}   // 关闭时停止当前面板的有效期倒计时
+	shareUploads   *fyne.Container // 二维码下方正在接收的上传，服务未启动时为nil
+)
+
+// makeSharePanel 创建二维码和服务状态区域，服务启动或停止时由refreshSharePanel更新
+func makeSharePanel() fyne.CanvasObject {
+	sharePanel = container.NewVBox()
+	refreshSharePanel()
+	return container.NewVScroll(sharePanel)
+}
+
+// refreshServiceState 服务启动或停止后更新托盘菜单和主窗口中的二维码
+func refreshServiceState() {
+	refreshTrayMenu()
+	refreshSharePanel()
+}
+
+// refreshSharePanel 按服务状态重建二维码区域：未启动时显示提示，运行中显示二维码、地址和登录方式
+func refreshSharePanel() {
+	if sharePanel == nil {
+		return
+	}
+	if sharePanelStop != nil {
+		close(sharePanelStop)
+		sharePanelStop = nil
+	}
+
+	shareUploads = nil
+	if serviceURL == "" {
+		status := widget.NewLabel(tr("服务未启动"))
+		status.TextStyle = fyne.TextStyle{Bold: true}
+		hint := widget.NewLabel(tr("点击“启动服务”后在此显示二维码"))
+		hint.Wrapping = fyne.TextWrapWord
+		sharePanel.Objects = []fyne.CanvasObject{status, hint}
+		sharePanel.Refresh()
+		return
+	}
+
+	sharePanelStop = make(chan struct{})
+	shareUploads = container.NewVBox()
+	sharePanel.Objects = append(shareContent(serviceURL, sharePanelStop), shareUploads)
+	refreshShareUploads()
+	sharePanel.Refresh()
+}
+
+// refreshShareUploads 在二维码下方列出正在接收的上传及其进度，手机上传时无需切换到传输页面即可查看；
+// 由watchTransfers定期调用
+func refreshShareUploads() {
+	if shareUploads == nil {
+		return
+	}
+	var rows []fyne.CanvasObject
+	for _, t := range transfers {
+		if t.Direction != pairserver.TransferUpload {
+			continue
+		}
+		name := widget.NewLabel(transferTitle(t))
+		name.Truncation = fyne.TextTruncateEllipsis
+		detail := widget.NewLabel(transferDetail(t))
+		detail.Truncation = fyne.TextTruncateEllipsis
+		rows = append(rows, name, detail)
+		// 总大小未知时只显示已接收的字节数和速度
+		if percent := t.Percent(); percent >= 0 {
+			bar := widget.NewProgressBar()
+			bar.SetValue(percent / 100)
+			rows = append(rows, bar)
+		}
+	}
+	if len(rows) > 0 {
+		title := widget.NewLabel(tr("正在接收"))
+		title.TextStyle = fyne.TextStyle{Bold: true}
+		rows = append([]fyne.CanvasObject{widget.NewSeparator(), title}, rows...)
+	}
+	shareUploads.Objects = rows
+	shareUploads.Refresh()
+}
+
+// shareContent 返回服务运行时的二维码区域内容；本机有多个地址时可切换二维码使用的地址
+func shareContent(link string, stop <-chan struct{}) []fyne.CanvasObject {
+	choices := addressChoices(link)
+
+	// 生成二维码图片，大小、颜色和Logo按二维码样式设置
+	st := appSettings.qrStyle()
+	qrImage := canvas.NewImageFromResource(nil)
+	qrImage.SetMinSize(fyne.NewSize(float32(st.size), float32(st.size)))
+	qrImage.FillMode = canvas.ImageFillContain
+
+	// 动态生成提示文本
+	var title string
+	var tipText func(url string) string
+	if len(server.Files()) > 0 {
+		title = tr("文件下载服务已启动")
+		tipText = func(url string) string { return tr("下载列表地址：%s\n扫码直接进入下载页面", url) }
+	} else if len(server.Dirs()) > 0 {
+		title = tr("文件浏览服务已启动")
+		tipText = func(url string) string { return tr("浏览页面地址：%s\n扫码直接进入共享文件夹", url) }
+	} else {
+		title = tr("文件上传服务已启动")
+		tipText = func(url string) string { return tr("上传页面地址：%s\n扫码直接进入上传页面", url) }
+	}
+	titleLabel := widget.NewLabel(title)
+	titleLabel.TextStyle = fyne.TextStyle{Bold: true}
+	tipLabel := widget.NewLabel("")
+	tipLabel.Wrapping = fyne.TextWrapBreak
+	codeLabel := widget.NewLabel("")
+	codeLabel.Wrapping = fyne.TextWrapBreak
+	davLabel := widget.NewLabel("")
+	davLabel.Wrapping = fyne.TextWrapBreak
+	ftpLabel := widget.NewLabel("")
+	ftpLabel.Wrapping = fyne.TextWrapBreak
+
+	// 按选择的地址更新二维码、页面地址以及WebDAV和FTP地址
+	current := choices[0].url
+	show := func(c addressChoice) {
+		current = c.url
+		qrBytes, err := qrPNG(c.url, st, st.size)
+		if err != nil {
+			tipLabel.SetText(fmt.Sprintf(tr("生成二维码失败: %v"), err))
+			return
+		}
+		qrImage.Resource = fyne.NewStaticResource("qrcode.png", qrBytes)
+		qrImage.Refresh()
+		tipLabel.SetText(tipText(c.url))
+		if codeURL := server.WordCodeURL(c.host); codeURL != "" {
+			codeLabel.SetText(tr("配对码：%s\n无法扫码时可在浏览器中输入 %s", server.WordCode(), codeURL))
+		}
+
+		if davURL := server.WebDAVURL(c.host); davURL != "" {
+			davText := tr("WebDAV地址：%s", davURL)
+			if user, password := server.BasicAuth(); password != "" {
+				davText += "\n" + tr("用户名：%s，密码：%s", user, password)
+			} else if server.PIN() != "" {
+				davText += "\n" + tr("用户名任意，密码为PIN码")
+			}
+			davLabel.SetText(davText)
+		}
+		if ftpURL := server.FTPURL(c.host); ftpURL != "" {
+			ftpText := tr("FTP地址：%s", ftpURL)
+			if user, password := server.BasicAuth(); password != "" {
+				ftpText += "\n" + tr("用户名：%s，密码：%s", user, password)
+			} else if pin := server.PIN(); pin != "" {
+				ftpText += "\n" + tr("用户名任意，密码为PIN码")
+			} else if token := server.Token(); token != "" {
+				ftpText += "\n" + tr("用户名任意，密码：%s", token)
+			}
+			ftpLabel.SetText(ftpText)
+		}
+	}
+	show(choices[0])
+
+	content := []fyne.CanvasObject{titleLabel}
+
+	// 有多个候选地址时显示地址选择，手机扫码无法打开时可换用其他网卡的地址
+	if len(choices) > 1 {
+		labels := make([]string, len(choices))
+		for i, c := range choices {
+			labels[i] = c.label
+		}
+		addrSelect := widget.NewSelect(labels, nil)
+		addrSelect.SetSelectedIndex(0)
+		addrSelect.OnChanged = func(string) {
+			show(choices[addrSelect.SelectedIndex()])
+		}
+		content = append(content, container.NewBorder(nil, nil, widget.NewLabel(tr("二维码地址：")), nil, addrSelect))
+	}
+	content = append(content, qrImage, tipLabel)
+	if codeLabel.Text != "" {
+		content = append(content, codeLabel)
+	}
+
+	// 复制地址或在本机浏览器中打开，另一台设备没有摄像头时可直接粘贴地址；
+	// 二维码可保存为PNG或SVG文件，用于邮件、幻灯片或打印
+	copyBtn := widget.NewButtonWithIcon(tr("复制地址"), theme.ContentCopyIcon(), func() {
+		fyne.CurrentApp().Clipboard().SetContent(current)
+	})
+	openBtn := widget.NewButtonWithIcon(tr("在浏览器中打开"), theme.ComputerIcon(), func() {
+		u, err := url.Parse(current)
+		if err == nil {
+			err = fyne.CurrentApp().OpenURL(u)
+		}
+		if err != nil {
+			dialog.ShowError(err, mainWindow)
+		}
+	})
+	saveBtn := widget.NewButtonWithIcon(tr("保存二维码"), theme.DocumentSaveIcon(), func() {
+		saveQRCode(current)
+	})
+	content = append(content, container.NewHBox(copyBtn, openBtn, saveBtn))
+
+	// 启用PIN码保护时显示PIN码
+	if pin := server.PIN(); pin != "" {
+		pinLabel := widget.NewLabel(tr("访问PIN码：%s", pin))
+		pinLabel.TextStyle = fyne.TextStyle{Bold: true}
+		content = append(content, pinLabel)
+	}
+
+	// 启用HTTP基本认证时显示用户名和密码，浏览器打开页面时会要求输入
+	if user, password := server.BasicAuth(); password != "" {
+		basicLabel := widget.NewLabel(tr("登录用户名：%s　密码：%s", user, password))
+		basicLabel.TextStyle = fyne.TextStyle{Bold: true}
+		content = append(content, basicLabel)
+	}
+
+	// 启用WebDAV和FTP时显示地址和登录方式
+	if davLabel.Text != "" {
+		content = append(content, davLabel)
+	}
+	if ftpLabel.Text != "" {
+		content = append(content, ftpLabel)
+	}
+
+	// HTTPS模式下显示证书指纹，便于在浏览器中核对
+	if certFingerprint != "" {
+		fpLabel := widget.NewLabel(tr("证书指纹（SHA-256）：\n%s", certFingerprint))
+		fpLabel.Wrapping = fyne.TextWrapBreak
+		content = append(content, fpLabel)
+	}
+
+	// 设置了有效期时显示倒计时
+	if expiry := server.ShareExpiry(); !expiry.IsZero() {
+		expiryLabel := widget.NewLabel("")
+		expiryLabel.TextStyle = fyne.TextStyle{Bold: true}
+		watchExpiry(expiryLabel, expiry, stop)
+		content = append(content, expiryLabel)
+	}
+	return content
+}
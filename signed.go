@@ -0,0 +1,51 @@
+package main
+
+import (
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"pair-gui/pairserver"
+)
+
+// linkTTLs 签名下载链接可选的有效期，签名链接必须会过期
+var linkTTLs = []time.Duration{15 * time.Minute, time.Hour, 24 * time.Hour}
+
+// showSignedLink 为分享文件生成签名下载链接并复制到剪贴板，持有链接即可在有效期内下载该文件
+func showSignedLink(f pairserver.File) {
+	if serviceURL == "" {
+		dialog.ShowInformation(tr("下载链接"), tr("请先启动服务"), mainWindow)
+		return
+	}
+
+	options := make([]string, len(linkTTLs))
+	for i, d := range linkTTLs {
+		options[i] = ttlLabel(d)
+	}
+	sel := widget.NewSelect(options, nil)
+	sel.SetSelectedIndex(1)
+	dialog.ShowForm(tr("下载链接"), tr("生成"), tr("取消"),
+		[]*widget.FormItem{widget.NewFormItem(tr("有效期"), sel)},
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			link, err := server.SignedDownloadURL(serviceURL, f.Filename, linkTTLs[sel.SelectedIndex()])
+			if err != nil {
+				dialog.ShowError(err, mainWindow)
+				return
+			}
+			fyne.CurrentApp().Clipboard().SetContent(link)
+
+			linkLabel := widget.NewLabel(link)
+			linkLabel.Selectable = true
+			linkLabel.Wrapping = fyne.TextWrapBreak
+			dialog.ShowCustom(tr("下载链接"), tr("关闭"), container.NewVBox(
+				widget.NewLabel(tr("链接已复制到剪贴板，无需PIN码即可下载 %s", f.Filename)),
+				linkLabel,
+			), mainWindow)
+		}, mainWindow)
+}
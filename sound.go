@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"pair-gui/pairserver"
+)
+
+// soundKind 提示音的类型
+type soundKind int
+
+const (
+	soundUploadDone    soundKind = iota // 收到文件
+	soundDownloadStart                  // 手机开始下载
+	soundError                          // 传输失败
+)
+
+// soundInterval 同一种提示音的最短间隔，批量传输时不连续播放
+const soundInterval = time.Second
+
+// lastSound 每种提示音上次播放的时间
+var lastSound struct {
+	mu   sync.Mutex
+	last map[soundKind]time.Time
+}
+
+// eventSound 返回事件对应的提示音，设置中未启用该提示音时返回false
+func eventSound(e pairserver.Event) (soundKind, bool) {
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
+
+	entry, _ := e.Data.(pairserver.HistoryEntry)
+	switch {
+	case e.Type == pairserver.EventDownloadStarted:
+		return soundDownloadStart, appSettings.SoundDownload
+	case e.Type != pairserver.EventUploadFinished && e.Type != pairserver.EventDownloadFinished:
+		return 0, false
+	case entry.Result == pairserver.HistoryFailed:
+		return soundError, appSettings.SoundError
+	case e.Type == pairserver.EventUploadFinished && entry.Result == pairserver.HistoryCompleted:
+		return soundUploadDone, appSettings.SoundUpload
+	}
+	return 0, false
+}
+
+// playSound 在后台播放提示音，距上次播放同一提示音不足soundInterval时忽略
+func playSound(kind soundKind) {
+	lastSound.mu.Lock()
+	if time.Since(lastSound.last[kind]) < soundInterval {
+		lastSound.mu.Unlock()
+		return
+	}
+	if lastSound.last == nil {
+		lastSound.last = make(map[soundKind]time.Time)
+	}
+	lastSound.last[kind] = time.Now()
+	lastSound.mu.Unlock()
+
+	go func() {
+		if err := soundCommand(kind).Run(); err != nil {
+			log.Printf("播放提示音失败: %v", err)
+		}
+	}()
+}
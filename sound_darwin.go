@@ -0,0 +1,13 @@
+package main
+
+import "os/exec"
+
+// soundCommand 返回用afplay播放系统提示音的命令
+func soundCommand(kind soundKind) *exec.Cmd {
+	name := map[soundKind]string{
+		soundUploadDone:    "Glass",
+		soundDownloadStart: "Pop",
+		soundError:         "Basso",
+	}[kind]
+	return exec.Command("afplay", "/System/Library/Sounds/"+name+".aiff")
+}
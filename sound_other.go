@@ -0,0 +1,18 @@
+//go:build !darwin && !windows
+
+package main
+
+import "os/exec"
+
+// soundCommand 返回播放freedesktop提示音的命令：优先使用canberra-gtk-play，否则用paplay播放声音主题中的文件
+func soundCommand(kind soundKind) *exec.Cmd {
+	id := map[soundKind]string{
+		soundUploadDone:    "complete",
+		soundDownloadStart: "message",
+		soundError:         "dialog-error",
+	}[kind]
+	if path, err := exec.LookPath("canberra-gtk-play"); err == nil {
+		return exec.Command(path, "--id="+id)
+	}
+	return exec.Command("paplay", "/usr/share/sounds/freedesktop/stereo/"+id+".oga")
+}
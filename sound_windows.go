@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// soundCommand 返回通过PowerShell播放Windows提示音的命令，不显示控制台窗口
+func soundCommand(kind soundKind) *exec.Cmd {
+	name := map[soundKind]string{
+		soundUploadDone:    "chimes.wav",
+		soundDownloadStart: "ding.wav",
+		soundError:         "Windows Critical Stop.wav",
+	}[kind]
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command",
+		"(New-Object Media.SoundPlayer \"$env:SystemRoot\\Media\\"+name+"\").PlaySync()")
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	return cmd
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"pair-gui/pairserver"
+)
+
+// showSendText 打开发送文本对话框，发送的文本显示在手机的文本传输页面上
+func showSendText() {
+	entry := widget.NewMultiLineEntry()
+	entry.SetPlaceHolder(tr("输入要发送到手机的文本，如链接、Wi-Fi密码"))
+	entry.Wrapping = fyne.TextWrapWord
+	entry.SetMinRowsVisible(5)
+
+	d := dialog.NewCustomConfirm(tr("发送文本"), tr("发送"), tr("取消"), entry, func(ok bool) {
+		if !ok || entry.Text == "" {
+			return
+		}
+		server.SendText(entry.Text)
+	}, mainWindow)
+	d.Resize(fyne.NewSize(480, 300))
+	d.Show()
+}
+
+// showReceivedText 显示手机发送的文本，可一键复制到剪贴板；在处理请求的协程中调用
+func showReceivedText(sn pairserver.Snippet) {
+	fyne.Do(func() {
+		text := widget.NewLabel(sn.Text)
+		text.Wrapping = fyne.TextWrapBreak
+		text.Selectable = true
+
+		var d dialog.Dialog
+		copyBtn := widget.NewButtonWithIcon(tr("复制"), theme.ContentCopyIcon(), func() {
+			fyne.CurrentApp().Clipboard().SetContent(sn.Text)
+			d.Hide()
+		})
+		copyBtn.Importance = widget.HighImportance
+
+		content := container.NewBorder(nil, container.NewHBox(copyBtn), nil, nil, container.NewVScroll(text))
+		d = dialog.NewCustom(tr("收到文本"), tr("关闭"), content, mainWindow)
+		d.Resize(fyne.NewSize(480, 300))
+		d.Show()
+		mainWindow.Show()
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"image/color"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+)
+
+// 主题选项
+const (
+	themeLight  = "light"  // 浅色
+	themeDark   = "dark"   // 深色
+	themeSystem = "system" // 跟随系统
+)
+
+// variantTheme 固定明暗模式的主题，忽略系统的明暗设置
+type variantTheme struct {
+	fyne.Theme
+	variant fyne.ThemeVariant
+}
+
+// Color 使用固定的明暗模式取色
+func (t *variantTheme) Color(name fyne.ThemeColorName, _ fyne.ThemeVariant) color.Color {
+	return t.Theme.Color(name, t.variant)
+}
+
+// themeFor 根据主题选项返回对应的Fyne主题
+func themeFor(name string) fyne.Theme {
+	switch name {
+	case themeDark:
+		return &variantTheme{Theme: theme.DefaultTheme(), variant: theme.VariantDark}
+	case themeSystem:
+		return theme.DefaultTheme()
+	default:
+		return &variantTheme{Theme: theme.DefaultTheme(), variant: theme.VariantLight}
+	}
+}
+
+// applyTheme 立即应用主题
+func applyTheme(a fyne.App, name string) {
+	a.Settings().SetTheme(themeFor(name))
+}
+
+// makeThemeMenu 创建主题切换菜单，选择后立即应用并保存
+func makeThemeMenu(a fyne.App) *fyne.MenuItem {
+	options := []struct {
+		name  string
+		label string
+	}{
+		{themeLight, tr("浅色")},
+		{themeDark, tr("深色")},
+		{themeSystem, tr("跟随系统")},
+	}
+
+	themeItem := fyne.NewMenuItem(tr("主题"), nil)
+	items := make([]*fyne.MenuItem, len(options))
+	for i, opt := range options {
+		items[i] = fyne.NewMenuItem(opt.label, nil)
+	}
+	for i, opt := range options {
+		items[i].Action = func() {
+			applyTheme(a, opt.name)
+			updateSettings(func(s *Settings) { s.Theme = opt.name })
+			for j := range items {
+				items[j].Checked = j == i
+			}
+			if mainWindow != nil && mainWindow.MainMenu() != nil {
+				mainWindow.MainMenu().Refresh()
+			}
+		}
+		items[i].Checked = opt.name == appSettings.Theme
+	}
+	themeItem.ChildMenu = fyne.NewMenu("", items...)
+	return themeItem
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"pair-gui/pairserver"
+)
+
+// transferRefreshInterval 刷新传输列表的间隔
+const transferRefreshInterval = time.Second
+
+var (
+	transfers    []pairserver.Transfer // 传输列表当前显示的内容
+	transferList *widget.List          // 传输页面的列表，切换语言重建界面时替换
+	transferTab  *container.TabItem    // 传输页面，标题显示进行中的传输数量
+	transferNone *widget.Label         // 没有传输时显示的提示
+	mainTabs     *container.AppTabs    // 主窗口的页面
+)
+
+// makeTransferTab 创建“传输”页面，列出进行中的上传和下载
+func makeTransferTab() *container.TabItem {
+	transferNone = widget.NewLabel(tr("暂无进行中的传输"))
+	transferList = widget.NewList(
+		func() int {
+			return len(transfers)
+		},
+		func() fyne.CanvasObject {
+			name := widget.NewLabel("")
+			name.Truncation = fyne.TextTruncateEllipsis
+			name.TextStyle = fyne.TextStyle{Bold: true}
+			detail := widget.NewLabel("")
+			detail.Truncation = fyne.TextTruncateEllipsis
+			return container.NewBorder(nil, nil, nil,
+				widget.NewButtonWithIcon("", theme.CancelIcon(), nil),
+				container.NewVBox(name, detail, widget.NewProgressBar()))
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			if id >= len(transfers) {
+				return
+			}
+			t := transfers[id]
+			row := obj.(*fyne.Container)
+			info := row.Objects[0].(*fyne.Container)
+			info.Objects[0].(*widget.Label).SetText(transferTitle(t))
+			info.Objects[1].(*widget.Label).SetText(transferDetail(t))
+			row.Objects[1].(*widget.Button).OnTapped = func() {
+				confirmCancelTransfer(t)
+			}
+			bar := info.Objects[2].(*widget.ProgressBar)
+			if percent := t.Percent(); percent >= 0 {
+				bar.SetValue(percent / 100)
+				bar.Show()
+			} else {
+				bar.Hide()
+			}
+		},
+	)
+	transferNone.Hidden = len(transfers) > 0
+	transferTab = container.NewTabItem(transferTabTitle(), container.NewStack(transferList, container.NewCenter(transferNone)))
+	return transferTab
+}
+
+// confirmCancelTransfer 确认后取消传输，未完成的上传文件会被删除
+func confirmCancelTransfer(t pairserver.Transfer) {
+	dialog.ShowConfirm(tr("取消传输"), tr("确定取消 %s 的传输吗？", transferTitle(t)), func(ok bool) {
+		if ok && !server.CancelTransfer(t.ID) {
+			dialog.ShowInformation(tr("取消传输"), tr("传输已结束"), mainWindow)
+		}
+	}, mainWindow)
+}
+
+// transferTabTitle 返回传输页面的标题，有进行中的传输时附带数量
+func transferTabTitle() string {
+	if len(transfers) == 0 {
+		return tr("传输")
+	}
+	return tr("传输 (%d)", len(transfers))
+}
+
+// transferTitle 返回传输的方向和文件名
+func transferTitle(t pairserver.Transfer) string {
+	name := t.Filename
+	if name == "" {
+		name = tr("（未知文件）")
+	}
+	if t.Direction == pairserver.TransferUpload {
+		return "↑ " + name
+	}
+	return "↓ " + name
+}
+
+// transferDetail 返回传输的客户端、进度、速度和剩余时间
+func transferDetail(t pairserver.Transfer) string {
+	text := t.ClientIP + "  " + formatBytes(t.Done)
+	if t.Total >= 0 {
+		text += fmt.Sprintf(" / %s (%.0f%%)", formatBytes(t.Total), t.Percent())
+	}
+	text += "  " + formatBytes(int64(t.Speed)) + "/s"
+	if eta := t.ETA(); eta > 0 {
+		text += "  " + tr("剩余 %s", eta.Round(time.Second))
+	}
+	return text
+}
+
+// formatBytes 将字节数格式化为便于阅读的大小，如 1.5 MB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	size, exp := float64(n)/unit, 0
+	for size >= unit && exp < 3 {
+		size /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", size, "KMGT"[exp])
+}
+
+// watchTransfers 定期从服务读取进行中的传输并刷新传输页面
+func watchTransfers() {
+	go func() {
+		ticker := time.NewTicker(transferRefreshInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			list := server.Transfers()
+			fyne.Do(func() {
+				if len(list) == 0 && len(transfers) == 0 {
+					return
+				}
+				// 有传输结束时刷新历史页面
+				if len(list) < len(transfers) {
+					refreshHistory()
+				}
+				transfers = list
+				refreshShareUploads()
+				if transferList == nil {
+					return
+				}
+				transferList.Refresh()
+				transferNone.Hidden = len(transfers) > 0
+				transferNone.Refresh()
+				transferTab.Text = transferTabTitle()
+				mainTabs.Refresh()
+			})
+		}
+	}()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/theme"
+)
+
+// trayApp 支持系统托盘的应用实例，平台不支持托盘时为nil
+var trayApp desktop.App
+
+// setupTray 创建系统托盘图标，关闭主窗口时最小化到托盘，HTTP服务继续运行
+func setupTray(a fyne.App) {
+	desk, ok := a.(desktop.App)
+	if !ok {
+		return
+	}
+	trayApp = desk
+
+	desk.SetSystemTrayIcon(theme.UploadIcon())
+	refreshTrayMenu()
+
+	mainWindow.SetCloseIntercept(func() {
+		mainWindow.Hide()
+	})
+}
+
+// refreshTrayMenu 根据服务状态重建托盘菜单
+func refreshTrayMenu() {
+	if trayApp == nil {
+		return
+	}
+
+	showItem := fyne.NewMenuItem(tr("显示主窗口"), func() {
+		mainWindow.Show()
+		mainWindow.RequestFocus()
+	})
+
+	// 系统通知无法响应点击，从托盘菜单打开收到的文件
+	folderItem := fyne.NewMenuItem(tr("打开接收文件夹"), openReceiveFolder)
+
+	var urlItem *fyne.MenuItem
+	if serviceURL != "" {
+		// 点击地址复制到剪贴板
+		urlItem = fyne.NewMenuItem(serviceURL, func() {
+			fyne.CurrentApp().Clipboard().SetContent(serviceURL)
+		})
+	} else {
+		urlItem = fyne.NewMenuItem(tr("服务未启动"), nil)
+		urlItem.Disabled = true
+	}
+
+	startItem := fyne.NewMenuItem(tr("启动服务"), func() {
+		if _, err := startService(appSettings.Port); err != nil {
+			dialog.ShowError(fmt.Errorf(tr("服务启动失败: %v"), err), mainWindow)
+		}
+	})
+	stopItem := fyne.NewMenuItem(tr("停止服务"), func() {
+		// 可能弹出确认对话框，先显示主窗口
+		mainWindow.Show()
+		requestStopService()
+	})
+	stopItem.Disabled = serviceURL == ""
+
+	quitItem := fyne.NewMenuItem(tr("退出"), func() {
+		fyne.CurrentApp().Quit()
+	})
+	quitItem.IsQuit = true
+
+	trayApp.SetSystemTrayMenu(fyne.NewMenu(tr("跨平台文件传输工具"),
+		showItem,
+		folderItem,
+		fyne.NewMenuItemSeparator(),
+		urlItem,
+		startItem,
+		stopItem,
+		fyne.NewMenuItemSeparator(),
+		quitItem,
+	))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+
+	"fyne.io/fyne/v2/widget"
+	"pair-gui/pairserver"
+)
+
+// hostChoice 二维码地址的一个可选项
+type hostChoice struct {
+	host  string // 二维码中使用的主机地址，空表示自动使用局域网IP
+	label string
+}
+
+// hostChoices 返回可选的二维码地址：局域网IP，以及Tailscale/WireGuard等VPN网卡的IP和MagicDNS名称
+func hostChoices() []hostChoice {
+	choices := []hostChoice{{host: "", label: tr("局域网IP（自动）")}}
+	for _, addr := range pairserver.VPNAddrs() {
+		choices = append(choices, hostChoice{host: addr.IP, label: fmt.Sprintf("%s（%s）", addr.IP, addr.Interface)})
+	}
+	if name := pairserver.TailscaleName(); name != "" {
+		choices = append(choices, hostChoice{host: name, label: fmt.Sprintf("%s（Tailscale MagicDNS）", name)})
+	}
+	return choices
+}
+
+// makeHostSelect 创建二维码地址下拉框，选择VPN地址后可在不同网络间的自有设备之间传输
+func makeHostSelect() *widget.Select {
+	choices := hostChoices()
+	found := false
+	for _, c := range choices {
+		found = found || c.host == appSettings.QRHost
+	}
+	// 之前选择的VPN当前未连接时仍显示该项，避免设置被悄悄清除
+	if !found {
+		choices = append(choices, hostChoice{host: appSettings.QRHost, label: tr("%s（未连接）", appSettings.QRHost)})
+	}
+
+	labels := make([]string, len(choices))
+	for i, c := range choices {
+		labels[i] = c.label
+	}
+	sel := widget.NewSelect(labels, nil)
+	for i, c := range choices {
+		if c.host == appSettings.QRHost {
+			sel.SetSelectedIndex(i)
+		}
+	}
+	sel.OnChanged = func(string) {
+		host := choices[sel.SelectedIndex()].host
+		updateSettings(func(s *Settings) { s.QRHost = host })
+	}
+	return sel
+}
+
+// addressChoice 二维码对话框中的一个可选地址
+type addressChoice struct {
+	host  string // 主机地址，用于生成WebDAV和FTP地址
+	url   string
+	label string
+}
+
+// addressChoices 返回二维码可使用的地址：第一项为当前服务地址，其后为本机各网卡（Wi-Fi、有线、VPN）的地址
+func addressChoices(current string) []addressChoice {
+	host := serviceHost()
+	label := host
+	// Tor和外网分享时当前地址不是本机地址
+	if u, err := url.Parse(current); err == nil && u.Hostname() != "" {
+		label = u.Hostname()
+	}
+	choices := []addressChoice{{host: host, url: current, label: tr("%s（默认）", label)}}
+	for _, addr := range pairserver.LocalAddrs() {
+		u := server.URL(addr.IP)
+		if addr.IP == host || u == current {
+			continue
+		}
+		label := fmt.Sprintf("%s（%s）", addr.IP, addr.Interface)
+		if addr.VPN {
+			label = tr("%s（%s，VPN）", addr.IP, addr.Interface)
+		}
+		choices = append(choices, addressChoice{host: addr.IP, url: u, label: label})
+	}
+	return choices
+}
+
+// vpnHost 返回设置中选择的二维码地址；未选择，或选择的IP已不在本机网卡上时返回空
+func vpnHost(host string) string {
+	if host == "" || net.ParseIP(host) == nil {
+		return host
+	}
+	for _, addr := range pairserver.VPNAddrs() {
+		if addr.IP == host {
+			return host
+		}
+	}
+	log.Printf("二维码地址 %s 当前不可用，改用局域网IP", host)
+	return ""
+}
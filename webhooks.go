@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// webhookWindow Webhook设置窗口，同一时间只打开一个
+var webhookWindow fyne.Window
+
+// showWebhooks 打开Webhook设置窗口，编辑上传完成或文件被下载时通知的URL
+func showWebhooks(a fyne.App) {
+	if webhookWindow != nil {
+		webhookWindow.RequestFocus()
+		return
+	}
+
+	w := a.NewWindow("Webhook")
+	webhookWindow = w
+	w.SetOnClosed(func() { webhookWindow = nil })
+
+	urlEntry := widget.NewMultiLineEntry()
+	urlEntry.SetPlaceHolder("https://example.com/hooks/pair-gui")
+	urlEntry.SetText(strings.Join(appSettings.Webhooks, "\n"))
+
+	saveBtn := widget.NewButton(tr("保存"), func() {
+		urls := splitRules(urlEntry.Text)
+		if err := server.SetWebhooks(urls); err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		updateSettings(func(s *Settings) { s.Webhooks = urls })
+		w.Close()
+	})
+	saveBtn.Importance = widget.HighImportance
+
+	label := widget.NewLabel(tr("Webhook地址（每行一个，上传完成或文件被下载时发送JSON POST）："))
+	label.Wrapping = fyne.TextWrapWord
+	w.SetContent(container.NewBorder(label, saveBtn, nil, nil, urlEntry))
+	w.Resize(fyne.NewSize(480, 300))
+	w.Show()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"pair-gui/pairserver"
+)
+
+// wormholeServer 返回设置中的wormhole服务器，未设置时使用magic-wormhole的公共服务器
+func (s Settings) wormholeServer() pairserver.WormholeServer {
+	srv := pairserver.DefaultWormholeServer
+	if s.WormholeMailbox != "" {
+		srv.Mailbox = s.WormholeMailbox
+	}
+	if s.WormholeTransit != "" {
+		srv.Transit = s.WormholeTransit
+	}
+	return srv
+}
+
+// showWormholeSend 向邮箱服务器申请wormhole代码并发送下载列表中的文件，对方输入代码接收后显示发送进度
+func showWormholeSend() {
+	files := server.Files()
+	if len(files) == 0 {
+		dialog.ShowInformation(tr("提示"), tr("请先选择需要发送的文件"), mainWindow)
+		return
+	}
+
+	var code string
+	codeLabel := widget.NewLabel(tr("正在获取代码…"))
+	codeLabel.TextStyle = fyne.TextStyle{Monospace: true}
+	codeLabel.Selectable = true
+	copyBtn := widget.NewButtonWithIcon("", theme.ContentCopyIcon(), func() {
+		if code != "" {
+			fyne.CurrentApp().Clipboard().SetContent(code)
+		}
+	})
+	hint := widget.NewLabel("")
+	hint.Wrapping = fyne.TextWrapWord
+
+	ctx, cancel := context.WithCancel(context.Background())
+	status := widget.NewLabel("")
+	bar := widget.NewProgressBar()
+	content := container.NewVBox(container.NewBorder(nil, nil, nil, copyBtn, codeLabel), hint, status, bar,
+		widget.NewButton(tr("取消"), cancel))
+	d := dialog.NewCustomWithoutButtons(tr("wormhole发送"), content, mainWindow)
+	d.Resize(fyne.NewSize(460, 0))
+	d.Show()
+
+	go func() {
+		err := pairserver.WormholeSend(ctx, appSettings.wormholeServer(), files, func(c string) {
+			fyne.Do(func() {
+				code = c
+				codeLabel.SetText(c)
+				hint.SetText(tr("对方运行 wormhole receive %s，或在pair-gui中点击“wormhole接收”并输入该代码", c))
+				status.SetText(tr("等待对方输入代码…"))
+			})
+		}, func(sent, total int64) {
+			fyne.Do(func() {
+				status.SetText(tr("正在发送…"))
+				if total > 0 {
+					bar.SetValue(float64(sent) / float64(total))
+				}
+			})
+		})
+		cancel()
+		fyne.Do(func() {
+			d.Hide()
+			switch {
+			case errors.Is(err, context.Canceled):
+			case err != nil:
+				dialog.ShowError(fmt.Errorf(tr("发送失败: %v"), err), mainWindow)
+			default:
+				dialog.ShowInformation(tr("wormhole发送"), tr("已发送 %d 个文件", len(files)), mainWindow)
+			}
+		})
+	}()
+}
+
+// showWormholeReceive 输入对方的wormhole代码，接收文件并保存到上传目录
+func showWormholeReceive() {
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("7-apple-river")
+	dialog.ShowForm(tr("wormhole接收"), tr("接收"), tr("取消"),
+		[]*widget.FormItem{widget.NewFormItem(tr("代码"), entry)},
+		func(ok bool) {
+			if ok {
+				wormholeReceive(entry.Text)
+			}
+		}, mainWindow)
+}
+
+// wormholeReceive 用code接收文件，接收进度显示在传输页面中
+func wormholeReceive(code string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	content := container.NewVBox(widget.NewLabel(tr("正在接收，进度见传输页面…")), widget.NewButton(tr("取消"), cancel))
+	d := dialog.NewCustomWithoutButtons(tr("wormhole接收"), content, mainWindow)
+	d.Show()
+
+	go func() {
+		saved, err := server.WormholeReceive(ctx, appSettings.wormholeServer(), code)
+		cancel()
+		fyne.Do(func() {
+			d.Hide()
+			switch {
+			case errors.Is(err, context.Canceled):
+			case err != nil:
+				dialog.ShowError(fmt.Errorf(tr("接收失败: %v"), err), mainWindow)
+			default:
+				dialog.ShowInformation(tr("wormhole接收"), tr("已接收 %d 个文件", len(saved)), mainWindow)
+			}
+		})
+	}()
+}